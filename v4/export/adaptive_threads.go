@@ -0,0 +1,160 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+// adaptiveThreadsInterval is how often the memory in use is probed with Config.MemoryWatermark
+var adaptiveThreadsInterval = time.Second
+
+// memoryProbe returns the bytes of memory in use
+type memoryProbe func() uint64
+
+// goHeapInUse returns the bytes of the heap spans in use by the Go runtime, which grow with the buffered chunks
+func goHeapInUse() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapInuse
+}
+
+// adaptiveThreads scales the writers taking tasks between Config.MinThreads and Config.Threads by the memory in use.
+// The active writers are halved when the memory exceeds Config.MemoryWatermark, and one more writer is activated
+// each time the memory drops below 3/4 of it. The throttled writers finish their current tasks and wait before
+// taking the next ones like the paused writers, so they keep holding their connections of the consistent snapshot.
+type adaptiveThreads struct {
+	min, max  int
+	watermark uint64
+	probe     memoryProbe
+
+	mu     sync.Mutex
+	active int
+	// released is set after all the tasks are sent, then the writers aren't throttled any more
+	released bool
+	// activated is closed and renewed whenever more writers are activated, to wake up the throttled writers
+	activated chan struct{}
+}
+
+func newAdaptiveThreads(min, max int, watermark uint64, probe memoryProbe) *adaptiveThreads {
+	return &adaptiveThreads{
+		min:       min,
+		max:       max,
+		watermark: watermark,
+		probe:     probe,
+		active:    max,
+		activated: make(chan struct{}),
+	}
+}
+
+// activeWriters returns the number of the writers taking tasks
+func (a *adaptiveThreads) activeWriters() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.active
+}
+
+// setActive sets the number of the active writers, and wakes up the throttled writers if it grows.
+// The caller should hold a.mu
+func (a *adaptiveThreads) setActive(active int) {
+	if active > a.active {
+		close(a.activated)
+		a.activated = make(chan struct{})
+	}
+	a.active = active
+}
+
+// waitIfThrottled blocks the writer of id while it's throttled, until it's activated again or ctx is done
+func (a *adaptiveThreads) waitIfThrottled(ctx context.Context, id int64) error {
+	if a == nil {
+		return nil
+	}
+	for {
+		a.mu.Lock()
+		if id < int64(a.active) {
+			a.mu.Unlock()
+			return nil
+		}
+		activated := a.activated
+		a.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-activated:
+		}
+	}
+}
+
+// update backs off or recovers the active writers by the memory in use
+func (a *adaptiveThreads) update(tctx *tcontext.Context, inUse uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.released {
+		return
+	}
+	active := a.active
+	switch {
+	case inUse > a.watermark && active > a.min:
+		next := active / 2
+		if next < a.min {
+			next = a.min
+		}
+		a.setActive(next)
+		tctx.L().Info("memory exceeds the watermark, throttle the writers",
+			zap.Uint64("in use", inUse), zap.Uint64("watermark", a.watermark), zap.Int("active writers", next))
+	case inUse < a.watermark/4*3 && active < a.max:
+		a.setActive(active + 1)
+		tctx.L().Info("memory drops below the watermark, activate one more writer",
+			zap.Uint64("in use", inUse), zap.Uint64("watermark", a.watermark), zap.Int("active writers", active+1))
+	}
+}
+
+// run probes the memory in use every interval until tctx is done
+func (a *adaptiveThreads) run(tctx *tcontext.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tctx.Done():
+			return
+		case <-tick.C:
+			a.update(tctx, a.probe())
+		}
+	}
+}
+
+// release activates all the writers for good, so the throttled writers see the closed task channel and exit
+func (a *adaptiveThreads) release() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.released = true
+	a.setActive(a.max)
+}
+
+// adjustAdaptiveThreads checks conf.MinThreads and conf.MemoryWatermark
+func adjustAdaptiveThreads(conf *Config) error {
+	if conf.MemoryWatermark == 0 {
+		if conf.MinThreads != 0 {
+			return errors.New("config.MinThreads requires config.MemoryWatermark")
+		}
+		return nil
+	}
+	if conf.MinThreads == 0 {
+		conf.MinThreads = 1
+	}
+	if conf.MinThreads < 0 || conf.MinThreads > conf.Threads {
+		return errors.Errorf("config.MinThreads %d should be between 1 and config.Threads %d", conf.MinThreads, conf.Threads)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestAdaptiveThreadsUpdate(c *C) {
+	tctx := tcontext.Background().WithLogger(appLogger)
+	a := newAdaptiveThreads(1, 4, 1000, nil)
+	c.Assert(a.activeWriters(), Equals, 4)
+
+	// the writers are halved while the memory exceeds the watermark, but not below the min
+	for _, expected := range []int{2, 1, 1} {
+		a.update(tctx, 1200)
+		c.Assert(a.activeWriters(), Equals, expected)
+	}
+	// they're kept between 3/4 of the watermark and the watermark
+	a.update(tctx, 800)
+	c.Assert(a.activeWriters(), Equals, 1)
+	// and activated one by one after the memory drops
+	for _, expected := range []int{2, 3, 4, 4} {
+		a.update(tctx, 500)
+		c.Assert(a.activeWriters(), Equals, expected)
+	}
+
+	a.update(tctx, 1200)
+	c.Assert(a.activeWriters(), Equals, 2)
+	a.release()
+	c.Assert(a.activeWriters(), Equals, 4)
+	a.update(tctx, 1200)
+	c.Assert(a.activeWriters(), Equals, 4)
+}
+
+func (s *testWriterSuite) TestAdaptiveThreadsWaitIfThrottled(c *C) {
+	tctx := tcontext.Background().WithLogger(appLogger)
+	var nilThreads *adaptiveThreads
+	c.Assert(nilThreads.waitIfThrottled(tctx, 3), IsNil)
+	nilThreads.release()
+
+	a := newAdaptiveThreads(1, 4, 1000, nil)
+	a.update(tctx, 1200)
+	c.Assert(a.waitIfThrottled(tctx, 1), IsNil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- a.waitIfThrottled(tctx, 3)
+	}()
+	// writer 3 waits until the 4th writer is activated
+	a.update(tctx, 500)
+	select {
+	case <-done:
+		c.Fatal("writer 3 should be throttled")
+	case <-time.After(50 * time.Millisecond):
+	}
+	a.update(tctx, 500)
+	c.Assert(<-done, IsNil)
+
+	a.update(tctx, 1200)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- a.waitIfThrottled(ctx, 3)
+	}()
+	cancel()
+	c.Assert(<-done, Equals, context.Canceled)
+}
+
+func (s *testWriterSuite) TestAdaptiveThreadsRun(c *C) {
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	var inUse uint64 = 2000
+	a := newAdaptiveThreads(2, 8, 1000, func() uint64 {
+		return atomic.LoadUint64(&inUse)
+	})
+	go a.run(tctx, time.Millisecond)
+
+	waitActive := func(expected int) {
+		for i := 0; i < 5000 && a.activeWriters() != expected; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		c.Assert(a.activeWriters(), Equals, expected)
+	}
+	waitActive(2)
+	c.Assert(a.waitIfThrottled(tctx, 1), IsNil)
+	atomic.StoreUint64(&inUse, 100)
+	c.Assert(a.waitIfThrottled(tctx, 7), IsNil)
+	waitActive(8)
+}
+
+func (s *testConfigSuite) TestAdjustAdaptiveThreads(c *C) {
+	conf := DefaultConfig()
+	c.Assert(adjustAdaptiveThreads(conf), IsNil)
+	conf.MinThreads = 2
+	c.Assert(adjustAdaptiveThreads(conf), ErrorMatches, "config.MinThreads requires config.MemoryWatermark")
+
+	conf.MemoryWatermark = 1 << 30
+	conf.MinThreads = 0
+	c.Assert(adjustAdaptiveThreads(conf), IsNil)
+	c.Assert(conf.MinThreads, Equals, 1)
+	conf.MinThreads = conf.Threads + 1
+	c.Assert(adjustAdaptiveThreads(conf), ErrorMatches, "config.MinThreads 5 should be between 1 and config.Threads 4")
+	conf.MinThreads = -1
+	c.Assert(adjustAdaptiveThreads(conf), ErrorMatches, "config.MinThreads -1 should be between 1 and config.Threads 4")
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var indexDefinitionRegexp = regexp.MustCompile(`(?im)^\s*((PRIMARY|UNIQUE|FULLTEXT|SPATIAL)\s+)?KEY\b.*$`)
+
+// annotateTableMeta adds a comment header summarizing the table to the special comments of meta,
+// which is written at the beginning of every sql data file of the table
+func annotateTableMeta(meta TableMeta, estimatedRows uint64) {
+	tm, ok := meta.(*tableMeta)
+	if !ok {
+		return
+	}
+	header := []string{
+		fmt.Sprintf("-- Table: `%s`.`%s` (%d rows est.)", escapeString(tm.database), escapeString(tm.table), estimatedRows),
+	}
+	names, types := tm.ColumnNames(), tm.ColumnTypes()
+	if len(names) > 0 {
+		columns := make([]string, len(names))
+		for i, name := range names {
+			columns[i] = fmt.Sprintf("`%s` %s", escapeString(name), types[i])
+		}
+		header = append(header, "-- Columns: "+strings.Join(columns, ", "))
+	}
+	if indexes := indexDefinitionRegexp.FindAllString(tm.showCreateTable, -1); len(indexes) > 0 {
+		for i, index := range indexes {
+			indexes[i] = strings.TrimSuffix(strings.TrimSpace(index), ",")
+		}
+		header = append(header, "-- Indexes: "+strings.Join(indexes, ", "))
+	}
+	tm.specCmts = append(header, tm.specCmts...)
+}
+
+// binaryModeHeader documents that the sql data files can be replayed without the --binary-mode client flag
+var binaryModeHeader = []string{
+	"-- Replayable with `mysql < file`, no client flag such as --binary-mode is required:",
+	"-- binary values and strings containing NUL, CR or Ctrl-Z bytes are written as hex literals.",
+}
+
+// addBinaryModeHeader adds binaryModeHeader to the special comments of meta
+func addBinaryModeHeader(meta TableMeta) {
+	tm, ok := meta.(*tableMeta)
+	if !ok {
+		return
+	}
+	tm.specCmts = append(append([]string{}, binaryModeHeader...), tm.specCmts...)
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+const (
+	// BinaryEncodingHex writes the bytes columns as hex literals x'...' in sql files and hex digits in csv files
+	BinaryEncodingHex = "hex"
+	// BinaryEncodingBase64 writes the bytes columns as FROM_BASE64('...') in sql files and base64 in csv files
+	BinaryEncodingBase64 = "base64"
+	// BinaryEncodingRaw writes the bytes columns as escaped byte strings, _binary'...' in sql files
+	BinaryEncodingRaw = "raw"
+)
+
+// adjustBinaryEncoding checks conf.BinaryEncoding, which is only supported for sql and csv files
+func adjustBinaryEncoding(conf *Config) error {
+	conf.BinaryEncoding = strings.ToLower(conf.BinaryEncoding)
+	switch conf.BinaryEncoding {
+	case "":
+		return nil
+	case BinaryEncodingHex, BinaryEncodingBase64, BinaryEncodingRaw:
+	default:
+		return errors.Errorf("unknown config.BinaryEncoding '%s', please use '%s', '%s' or '%s'",
+			conf.BinaryEncoding, BinaryEncodingHex, BinaryEncodingBase64, BinaryEncodingRaw)
+	}
+	if conf.FileType != FileFormatSQLTextString && conf.FileType != FileFormatCSVString {
+		return errors.Errorf("config.BinaryEncoding is only supported for sql and csv files, but config.FileType is '%s'", conf.FileType)
+	}
+	return nil
+}
+
+// binaryEncodingOf returns the encoding of the bytes columns written in the files of conf.FileType,
+// or "" if the file type doesn't support config.BinaryEncoding
+func binaryEncodingOf(conf *Config) string {
+	switch {
+	case conf.FileType != FileFormatSQLTextString && conf.FileType != FileFormatCSVString:
+		return ""
+	case conf.BinaryEncoding != "":
+		return conf.BinaryEncoding
+	case conf.FileType == FileFormatCSVString:
+		return BinaryEncodingRaw
+	default:
+		return BinaryEncodingHex
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"database/sql/driver"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+// binaryEncodingTestData has a BLOB with NUL bytes and quotes, a NULL and a zero-length BLOB
+var binaryEncodingTestData = [][]driver.Value{
+	{"1", []byte("a\x00'b\"c")},
+	{"2", nil},
+	{"3", []byte{}},
+}
+
+func (s *testUtilSuite) TestWriteInsertWithBinaryEncoding(c *C) {
+	for _, tc := range []struct {
+		encoding        string
+		escapeBackslash bool
+		expected        string
+	}{
+		{"", true, "(1,x'610027622263'),\n(2,NULL),\n(3,x'');\n"},
+		{BinaryEncodingHex, false, "(1,x'610027622263'),\n(2,NULL),\n(3,x'');\n"},
+		{BinaryEncodingBase64, true, "(1,FROM_BASE64('YQAnYiJj')),\n(2,NULL),\n(3,FROM_BASE64(''));\n"},
+		{BinaryEncodingRaw, true, "(1,_binary'a\\0\\'b\\\"c'),\n(2,NULL),\n(3,_binary'');\n"},
+		{BinaryEncodingRaw, false, "(1,_binary'a\x00''b\"c'),\n(2,NULL),\n(3,_binary'');\n"},
+	} {
+		tableIR := newMockTableIR("test", "t", binaryEncodingTestData, nil, []string{"INT", "BLOB"})
+		bf := storage.NewBufferWriter()
+		conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+		conf.BinaryEncoding = tc.encoding
+		conf.EscapeBackslash = tc.escapeBackslash
+		n, err := WriteInsert(tcontext.Background(), conf, tableIR, tableIR, bf)
+		c.Assert(err, IsNil)
+		c.Assert(n, Equals, uint64(3))
+		c.Assert(bf.String(), Equals, "INSERT INTO `t` VALUES\n"+tc.expected, Commentf("encoding %q", tc.encoding))
+	}
+}
+
+func (s *testUtilSuite) TestWriteInsertInCsvWithBinaryEncoding(c *C) {
+	opt := &csvOption{separator: []byte(","), delimiter: doubleQuotationMark, nullValue: "\\N"}
+	for _, tc := range []struct {
+		encoding        string
+		escapeBackslash bool
+		expected        string
+	}{
+		{"", true, "1,\"a\\0'b\\\"c\"\n2,\\N\n3,\"\"\n"},
+		{BinaryEncodingRaw, false, "1,\"a\x00'b\"\"c\"\n2,\\N\n3,\"\"\n"},
+		{BinaryEncodingHex, true, "1,\"610027622263\"\n2,\\N\n3,\"\"\n"},
+		{BinaryEncodingBase64, true, "1,\"YQAnYiJj\"\n2,\\N\n3,\"\"\n"},
+	} {
+		tableIR := newMockTableIR("test", "t", binaryEncodingTestData, nil, []string{"INT", "BLOB"})
+		bf := storage.NewBufferWriter()
+		conf := configForWriteCSV(true, opt)
+		conf.BinaryEncoding = tc.encoding
+		conf.EscapeBackslash = tc.escapeBackslash
+		n, err := WriteInsertInCsv(tcontext.Background(), conf, tableIR, tableIR, bf)
+		c.Assert(err, IsNil)
+		c.Assert(n, Equals, uint64(3))
+		c.Assert(bf.String(), Equals, tc.expected, Commentf("encoding %q", tc.encoding))
+	}
+}
+
+func (s *testSQLByteSuite) TestBinaryEncodingOfBinarySafeStrings(c *C) {
+	// the binary safe strings keep their encoding, only the bytes columns are affected
+	row := makeRowReceiver([]string{"VARCHAR", "VARBINARY"}, true, false, BinaryEncodingBase64)
+	row.BindAddress(make([]interface{}, 2))
+	row.receivers[0].(*SQLTypeBinaryString).RawBytes = []byte("'")
+	row.receivers[1].(*SQLTypeBytes).RawBytes = []byte("'")
+	var bf bytes.Buffer
+	row.WriteToBuffer(&bf, true)
+	c.Assert(bf.String(), Equals, "(x'27',FROM_BASE64('Jw=='))")
+}
+
+func (s *testUtilSuite) TestAdjustBinaryEncoding(c *C) {
+	conf := DefaultConfig()
+	conf.FileType = FileFormatSQLTextString
+	c.Assert(adjustBinaryEncoding(conf), IsNil)
+	c.Assert(binaryEncodingOf(conf), Equals, BinaryEncodingHex)
+	conf.FileType = FileFormatCSVString
+	c.Assert(binaryEncodingOf(conf), Equals, BinaryEncodingRaw)
+
+	conf.BinaryEncoding = "Base64"
+	c.Assert(adjustBinaryEncoding(conf), IsNil)
+	c.Assert(binaryEncodingOf(conf), Equals, BinaryEncodingBase64)
+	conf.BinaryEncoding = "base32"
+	c.Assert(adjustBinaryEncoding(conf), ErrorMatches, "unknown config.BinaryEncoding 'base32'.*")
+
+	conf.BinaryEncoding = BinaryEncodingRaw
+	conf.FileType = FileFormatParquetString
+	c.Assert(adjustBinaryEncoding(conf), ErrorMatches, "config.BinaryEncoding is only supported for sql and csv files, but config.FileType is 'parquet'")
+	conf.BinaryEncoding = ""
+	c.Assert(adjustBinaryEncoding(conf), IsNil)
+	c.Assert(binaryEncodingOf(conf), Equals, "")
+}
+
+func (s *testMetaDataSuite) TestRecordBinaryEncoding(c *C) {
+	m := newGlobalMetadata(tcontext.Background(), s.createStorage(c), "")
+	m.recordBinaryEncoding(BinaryEncodingBase64)
+	c.Assert(m.buffer.String(), Equals, "Binary encoding: base64\n")
+}
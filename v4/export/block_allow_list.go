@@ -3,6 +3,9 @@
 package export
 
 import (
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+	tf "github.com/pingcap/tidb-tools/pkg/table-filter"
 	"go.uber.org/zap"
 
 	tcontext "github.com/pingcap/dumpling/v4/context"
@@ -36,3 +39,71 @@ func filterTables(tctx *tcontext.Context, conf *Config) {
 
 	conf.Tables = dbTables
 }
+
+// blockAllowListRules is the rule file shared with TiDB-Binlog and DM. The rules are either written at top level,
+// or as the only rule in the `block-allow-list` (or the deprecated `black-white-list`) section of a DM task file.
+type blockAllowListRules struct {
+	tf.MySQLReplicationRules
+	BlockAllowList map[string]*tf.MySQLReplicationRules `toml:"block-allow-list"`
+	BlackWhiteList map[string]*tf.MySQLReplicationRules `toml:"black-white-list"`
+}
+
+// ParseBlockAllowListFile parses the `do-dbs`, `do-tables`, `ignore-dbs` and `ignore-tables` rules in a TiDB-Binlog/DM
+// compatible TOML file into a table filter. Unlike MySQL replication filter, the ignore rules take precedence over
+// the do rules, that is, a table matched by any ignore rule won't be dumped even if it's matched by a do rule.
+func ParseBlockAllowListFile(path string, caseSensitive bool) (tf.Filter, error) {
+	var file blockAllowListRules
+	if _, err := toml.DecodeFile(path, &file); err != nil {
+		return nil, errors.Annotatef(err, "failed to parse block allow list file %s", path)
+	}
+	rules := &file.MySQLReplicationRules
+	sections := file.BlockAllowList
+	if len(sections) == 0 {
+		sections = file.BlackWhiteList
+	}
+	if len(sections) > 1 {
+		return nil, errors.Errorf("block allow list file %s contains %d rules, only one rule is supported", path, len(sections))
+	}
+	for _, rule := range sections {
+		if rule != nil {
+			rules = rule
+		}
+	}
+
+	doFilter, err := tf.ParseMySQLReplicationRules(&tf.MySQLReplicationRules{
+		DoDBs:    rules.DoDBs,
+		DoTables: rules.DoTables,
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to parse do rules in %s", path)
+	}
+	ignoreFilter, err := tf.ParseMySQLReplicationRules(&tf.MySQLReplicationRules{
+		IgnoreDBs:    rules.IgnoreDBs,
+		IgnoreTables: rules.IgnoreTables,
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to parse ignore rules in %s", path)
+	}
+	if !caseSensitive {
+		doFilter, ignoreFilter = tf.CaseInsensitive(doFilter), tf.CaseInsensitive(ignoreFilter)
+	}
+	return doIgnoreFilter{Filter: doFilter, ignore: ignoreFilter}, nil
+}
+
+// doIgnoreFilter matches the tables which are matched by the do rules and not excluded by the ignore rules.
+// The embedded do filter only provides the unexported method of tf.Filter, so doIgnoreFilter should be
+// made case-insensitive by ParseBlockAllowListFile instead of tf.CaseInsensitive.
+type doIgnoreFilter struct {
+	tf.Filter
+	ignore tf.Filter
+}
+
+// MatchTable implements tf.Filter.MatchTable
+func (f doIgnoreFilter) MatchTable(schema string, table string) bool {
+	return f.Filter.MatchTable(schema, table) && f.ignore.MatchTable(schema, table)
+}
+
+// MatchSchema implements tf.Filter.MatchSchema
+func (f doIgnoreFilter) MatchSchema(schema string) bool {
+	return f.Filter.MatchSchema(schema) && f.ignore.MatchSchema(schema)
+}
@@ -3,6 +3,8 @@
 package export
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"strings"
 
 	tcontext "github.com/pingcap/dumpling/v4/context"
@@ -74,3 +76,67 @@ func (s *testBWListSuite) TestFilterDatabaseWithNoTable(c *C) {
 	c.Assert(conf.Tables, HasLen, 0)
 	c.Assert(conf.Tables, DeepEquals, expectedDBTables)
 }
+
+func (s *testBWListSuite) TestParseBlockAllowListFile(c *C) {
+	dir := c.MkDir()
+	writeRules := func(content string) string {
+		path := filepath.Join(dir, "rules.toml")
+		c.Assert(ioutil.WriteFile(path, []byte(content), 0o644), IsNil)
+		return path
+	}
+
+	// ignore rules take precedence over do rules
+	path := writeRules(`
+do-dbs = ["~^shop_.*", "crm"]
+ignore-dbs = ["shop_tmp"]
+do-tables = [{db-name = "shop_*", tbl-name = "*"}, {db-name = "crm", tbl-name = "users"}]
+ignore-tables = [{db-name = "shop_1", tbl-name = "log_*"}]
+`)
+	f, err := ParseBlockAllowListFile(path, true)
+	c.Assert(err, IsNil)
+	c.Assert(f.MatchTable("shop_1", "orders"), IsTrue)
+	c.Assert(f.MatchTable("shop_1", "log_2021"), IsFalse)
+	c.Assert(f.MatchTable("shop_tmp", "orders"), IsFalse)
+	c.Assert(f.MatchTable("crm", "users"), IsTrue)
+	c.Assert(f.MatchTable("crm", "groups"), IsFalse)
+	c.Assert(f.MatchTable("other", "users"), IsFalse)
+	c.Assert(f.MatchTable("CRM", "users"), IsFalse)
+	c.Assert(f.MatchSchema("shop_1"), IsTrue)
+	c.Assert(f.MatchSchema("shop_tmp"), IsFalse)
+
+	f, err = ParseBlockAllowListFile(path, false)
+	c.Assert(err, IsNil)
+	c.Assert(f.MatchTable("CRM", "Users"), IsTrue)
+	c.Assert(f.MatchTable("SHOP_1", "LOG_1"), IsFalse)
+
+	// DM task file
+	path = writeRules(`
+name = "test"
+task-mode = "all"
+
+[block-allow-list.instance]
+ignore-dbs = ["mysql"]
+
+[[block-allow-list.instance.ignore-tables]]
+db-name = "test"
+tbl-name = "t2"
+`)
+	f, err = ParseBlockAllowListFile(path, true)
+	c.Assert(err, IsNil)
+	c.Assert(f.MatchTable("test", "t1"), IsTrue)
+	c.Assert(f.MatchTable("test", "t2"), IsFalse)
+	c.Assert(f.MatchTable("mysql", "user"), IsFalse)
+
+	path = writeRules(`
+[black-white-list.a]
+do-dbs = ["a"]
+[black-white-list.b]
+do-dbs = ["b"]
+`)
+	_, err = ParseBlockAllowListFile(path, true)
+	c.Assert(err, ErrorMatches, ".*contains 2 rules, only one rule is supported")
+
+	path = writeRules(`do-dbs = "not a list"`)
+	_, err = ParseBlockAllowListFile(path, true)
+	c.Assert(err, ErrorMatches, "failed to parse block allow list file.*")
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/pingcap/errors"
+)
+
+// callerPoolConnector connects by taking a connection from the pool provided by the caller by Config.DB.
+// Dumpling sets the session params like tidb_snapshot, the transactions and the locks on its connections,
+// so they're discarded from the pool of the caller when they're closed instead of being returned to it,
+// where the later queries of the caller would run with them.
+type callerPoolConnector struct {
+	pool *sql.DB
+}
+
+// newCallerPoolDB returns the pool of Dumpling whose connections are taken from pool
+func newCallerPoolDB(pool *sql.DB) *sql.DB {
+	return sql.OpenDB(&callerPoolConnector{pool: pool})
+}
+
+// Connect implements driver.Connector. The driver connection is used out of sql.Conn.Raw, which is safe since the
+// connection is kept taken from the pool of the caller until it's closed, so nothing else uses it meanwhile.
+func (c *callerPoolConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.pool.Conn(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var dc driver.Conn
+	err = conn.Raw(func(driverConn interface{}) error {
+		var ok bool
+		if dc, ok = driverConn.(driver.Conn); !ok {
+			return errors.Errorf("unknown driver connection %T", driverConn)
+		}
+		return nil
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &callerPoolConn{Conn: dc, conn: conn}, nil
+}
+
+// Driver implements driver.Connector
+func (c *callerPoolConnector) Driver() driver.Driver {
+	return c.pool.Driver()
+}
+
+// callerPoolConn is a connection taken from the pool of the caller, it passes the optional interfaces of the
+// driver connection through
+type callerPoolConn struct {
+	driver.Conn
+	conn *sql.Conn
+}
+
+// Close implements driver.Conn, it discards the connection from the pool of the caller
+func (c *callerPoolConn) Close() error {
+	err := c.conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
+	})
+	if err == driver.ErrBadConn {
+		return nil
+	}
+	return err
+}
+
+// BeginTx implements driver.ConnBeginTx
+func (c *callerPoolConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, errors.New("the driver doesn't support the isolation level or the read-only transaction")
+	}
+	return c.Conn.Begin() // nolint:staticcheck
+}
+
+// PrepareContext implements driver.ConnPrepareContext
+func (c *callerPoolConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+// ExecContext implements driver.ExecerContext
+func (c *callerPoolConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+// QueryContext implements driver.QueryerContext
+func (c *callerPoolConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+// Ping implements driver.Pinger
+func (c *callerPoolConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession implements driver.SessionResetter
+func (c *callerPoolConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+// CheckNamedValue implements driver.NamedValueChecker
+func (c *callerPoolConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// IsValid implements driver.Validator
+func (c *callerPoolConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+const catalogPath = "catalog.json"
+
+type catalogColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Nullable is absent if the driver doesn't know it
+	Nullable *bool `json:"nullable,omitempty"`
+}
+
+type catalogTable struct {
+	Name string `json:"name"`
+	// Type is `table` or `view`
+	Type       string          `json:"type"`
+	Columns    []catalogColumn `json:"columns"`
+	PrimaryKey []string        `json:"primary_key"`
+	// EstimatedRows is the estimated rows before dumping, Rows is the rows written
+	EstimatedRows uint64 `json:"estimated_rows"`
+	Rows          uint64 `json:"rows"`
+	// Files are the schema and data files of the table, in the same names as the other manifests
+	Files []string `json:"files"`
+	// KeyColumns is the ordering key which the table is split into chunks by, and KeyRanges are the ranges
+	// of it in the data files. They are absent if the table isn't split by a usable ordering key.
+	KeyColumns []string          `json:"key_columns,omitempty"`
+	KeyRanges  []catalogKeyRange `json:"key_ranges,omitempty"`
+	// UpdateTime and Checksum are the version of the table in information_schema which Config.IncrementalAgainst
+	// compares, they are absent if unknown or not compared
+	UpdateTime *string `json:"update_time,omitempty"`
+	Checksum   *string `json:"checksum,omitempty"`
+	// Status is "unchanged, see prior" if the data isn't dumped again, then the data files PriorFiles are in
+	// the dump of the directory Prior
+	Status     string   `json:"status,omitempty"`
+	Prior      string   `json:"prior,omitempty"`
+	PriorFiles []string `json:"prior_files,omitempty"`
+}
+
+type catalogDatabase struct {
+	Name string `json:"name"`
+	// Files are the schema files of the database
+	Files  []string        `json:"files"`
+	Tables []*catalogTable `json:"tables"`
+}
+
+// catalogRecorder assembles the catalog describing all the databases, tables and files of the dump,
+// so they can be ingested in one read
+type catalogRecorder struct {
+	mu        sync.Mutex
+	databases map[string]*catalogDatabase
+	// database -> table -> catalog
+	tables map[string]map[string]*catalogTable
+}
+
+func newCatalogRecorder() *catalogRecorder {
+	return &catalogRecorder{
+		databases: make(map[string]*catalogDatabase),
+		tables:    make(map[string]map[string]*catalogTable),
+	}
+}
+
+// newCatalogTable builds the catalog of a table from its meta
+func newCatalogTable(conn *sql.Conn, meta TableMeta, tableType TableType, estimatedRows uint64) (*catalogTable, error) {
+	t := &catalogTable{
+		Name:          meta.TableName(),
+		Type:          "table",
+		Columns:       []catalogColumn{},
+		PrimaryKey:    []string{},
+		EstimatedRows: estimatedRows,
+		Files:         []string{},
+	}
+	if tm, ok := meta.(*tableMeta); ok {
+		for _, ct := range tm.colTypes {
+			col := catalogColumn{Name: ct.Name(), Type: ct.DatabaseTypeName()}
+			if nullable, ok := ct.Nullable(); ok {
+				col.Nullable = &nullable
+			}
+			t.Columns = append(t.Columns, col)
+		}
+	}
+	if tableType == TableTypeView {
+		t.Type = "view"
+		return t, nil
+	}
+	pk, err := GetPrimaryKeyColumns(conn, meta.DatabaseName(), meta.TableName())
+	if err != nil {
+		return nil, err
+	}
+	t.PrimaryKey = append(t.PrimaryKey, pk...)
+	return t, nil
+}
+
+func (r *catalogRecorder) database(db string) *catalogDatabase {
+	d, ok := r.databases[db]
+	if !ok {
+		d = &catalogDatabase{Name: db, Files: []string{}, Tables: []*catalogTable{}}
+		r.databases[db] = d
+		r.tables[db] = make(map[string]*catalogTable)
+	}
+	return d
+}
+
+func (r *catalogRecorder) addTable(db string, t *catalogTable) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.database(db)
+	if _, ok := r.tables[db][t.Name]; ok {
+		return
+	}
+	d.Tables = append(d.Tables, t)
+	r.tables[db][t.Name] = t
+}
+
+// addFile records a file of the table, or of the database if table is empty
+func (r *catalogRecorder) addFile(db, table, file string) {
+	if r == nil || db == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if table == "" {
+		d := r.database(db)
+		d.Files = append(d.Files, file)
+		return
+	}
+	t := r.table(db, table)
+	t.Files = append(t.Files, file)
+}
+
+// table returns the catalog of the table, it's added if the table isn't recorded yet
+func (r *catalogRecorder) table(db, table string) *catalogTable {
+	d := r.database(db)
+	t, ok := r.tables[db][table]
+	if !ok {
+		t = &catalogTable{Name: table, Type: "table", Columns: []catalogColumn{}, PrimaryKey: []string{}, Files: []string{}}
+		d.Tables = append(d.Tables, t)
+		r.tables[db][table] = t
+	}
+	return t
+}
+
+// write fills the rows written of each table from results and writes the catalog into catalogPath
+func (r *catalogRecorder) write(tctx *tcontext.Context, extStore storage.ExternalStorage, results []TableDumpResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, result := range results {
+		if t, ok := r.tables[result.Database][result.Table]; ok {
+			t.Rows = result.Rows
+		}
+	}
+	databases := make([]*catalogDatabase, 0, len(r.databases))
+	for _, d := range r.databases {
+		sort.Strings(d.Files)
+		sort.Slice(d.Tables, func(i, j int) bool { return d.Tables[i].Name < d.Tables[j].Name })
+		for _, t := range d.Tables {
+			sort.Strings(t.Files)
+			sort.Slice(t.KeyRanges, func(i, j int) bool { return t.KeyRanges[i].File < t.KeyRanges[j].File })
+		}
+		databases = append(databases, d)
+	}
+	sort.Slice(databases, func(i, j int) bool { return databases[i].Name < databases[j].Name })
+	data, err := json.MarshalIndent(struct {
+		Databases []*catalogDatabase `json:"databases"`
+	}{databases}, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(extStore.WriteFile(tctx, catalogPath, data))
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"io/ioutil"
+	"math/big"
+	"path"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestWriteCatalog(c *C) {
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = c.MkDir()
+
+	writer := s.newWriter(config, c)
+	writer.tableStats = newTableStatsCollector()
+	writer.catalog = newCatalogRecorder()
+	writer.catalog.addTable("test", &catalogTable{
+		Name:          "employee",
+		Type:          "table",
+		Columns:       []catalogColumn{{Name: "id", Type: "INT"}},
+		PrimaryKey:    []string{"id"},
+		EstimatedRows: 10,
+		Files:         []string{},
+	})
+
+	c.Assert(writer.WriteDatabaseMeta("test", "CREATE DATABASE `test`"), IsNil)
+	c.Assert(writer.WriteTableMeta("test", "employee", "CREATE TABLE `employee` (`id` INT PRIMARY KEY)"), IsNil)
+	data := [][]driver.Value{{"1"}, {"2"}}
+	tableIR := newMockTableIR("test", "employee", data, nil, []string{"INT"})
+	c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+	c.Assert(writer.WriteViewMeta("test", "v", "CREATE TABLE `v` (`id` INT)", "CREATE VIEW `v` AS SELECT 1"), IsNil)
+
+	c.Assert(writer.catalog.write(writer.tctx, writer.extStorage, writer.tableStats.results()), IsNil)
+	bytes, err := ioutil.ReadFile(path.Join(config.OutputDirPath, catalogPath))
+	c.Assert(err, IsNil)
+	c.Assert(string(bytes), Equals, `{
+  "databases": [
+    {
+      "name": "test",
+      "files": [
+        "test-schema-create.sql"
+      ],
+      "tables": [
+        {
+          "name": "employee",
+          "type": "table",
+          "columns": [
+            {
+              "name": "id",
+              "type": "INT"
+            }
+          ],
+          "primary_key": [
+            "id"
+          ],
+          "estimated_rows": 10,
+          "rows": 2,
+          "files": [
+            "test.employee-schema.sql",
+            "test.employee.000000000.sql"
+          ]
+        },
+        {
+          "name": "v",
+          "type": "table",
+          "columns": [],
+          "primary_key": [],
+          "estimated_rows": 0,
+          "rows": 0,
+          "files": [
+            "test.v-schema-view.sql",
+            "test.v-schema.sql"
+          ]
+        }
+      ]
+    }
+  ]
+}`)
+}
+
+func (s *testWriterSuite) TestWriteCatalogKeyRanges(c *C) {
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = c.MkDir()
+
+	writer := s.newWriter(config, c)
+	writer.tableStats = newTableStatsCollector()
+	writer.catalog = newCatalogRecorder()
+
+	// the range of the chunk split by an integer column is its WHERE bounds
+	data := [][]driver.Value{{"3", "x"}, {"5", "y"}}
+	tableIR := newMockTableIR("test", "t", data, nil, []string{"INT", "VARCHAR"})
+	tableIR.colNames = []string{"id", "name"}
+	writer.keyRange = &chunkKeyRange{lower: big.NewInt(1), upper: big.NewInt(11)}
+	c.Assert(writer.writeTableData(tableIR, tableIR, 0, "id"), IsNil)
+
+	// the range of the chunk split by the sampled keys is observed, the keys containing NULL are ignored
+	data = [][]driver.Value{{"2", "b"}, {"1", "z"}, {nil, "a"}, {"10", "a"}, {"2", "a"}}
+	tableIR = newMockTableIR("test", "t", data, nil, []string{"INT", "VARCHAR"})
+	tableIR.colNames = []string{"id", "name"}
+	writer.keyColumns, writer.keyRange = []string{"id", "name"}, nil
+	c.Assert(writer.writeTableData(tableIR, tableIR, 1, "id"), IsNil)
+
+	// the table isn't split
+	tableIR = newMockTableIR("test", "u", data, nil, []string{"INT", "VARCHAR"})
+	writer.keyColumns = nil
+	c.Assert(writer.writeTableData(tableIR, tableIR, 0, ""), IsNil)
+
+	t := writer.catalog.tables["test"]["t"]
+	c.Assert(t.KeyColumns, DeepEquals, []string{"id", "name"})
+	c.Assert(t.KeyRanges, DeepEquals, []catalogKeyRange{
+		{File: "test.t.000000000.sql", Min: []string{"1"}, Max: []string{"10"}},
+		{File: "test.t.000000001.sql", Min: []string{"1", "z"}, Max: []string{"10", "a"}},
+	})
+	u := writer.catalog.tables["test"]["u"]
+	c.Assert(u.KeyColumns, IsNil)
+	c.Assert(u.KeyRanges, IsNil)
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+)
+
+// changeFeedSnapshotOp is the operation of the snapshot rows in change-feed files, the same as Debezium's read events
+const changeFeedSnapshotOp = "r"
+
+// tsoPhysicalShiftBits is the bits of the logical part of a TSO, the rest is the physical time in milliseconds
+const tsoPhysicalShiftBits = 18
+
+// changeFeedSnapshotTime returns the TSO and the time in milliseconds of the snapshot of the dump.
+// The TSO is 0 if the snapshot isn't a TSO, and the time the snapshot is taken at is used then.
+func changeFeedSnapshotTime(cfg *Config) (tso uint64, tsMs int64) {
+	if tso, err := strconv.ParseUint(cfg.Snapshot, 10, 64); err == nil {
+		return tso, int64(tso >> tsoPhysicalShiftBits)
+	}
+	if cfg.SnapshotTime.IsZero() {
+		return 0, 0
+	}
+	return 0, cfg.SnapshotTime.UnixNano() / int64(time.Millisecond)
+}
+
+// changeFeedEnvelope returns the bytes written before and after the row in a change event of meta
+func changeFeedEnvelope(cfg *Config, meta TableMeta) (prefix, suffix []byte) {
+	tso, tsMs := changeFeedSnapshotTime(cfg)
+	var bf bytes.Buffer
+	bf.WriteString(`,"source":{"db":`)
+	writeJSONString(&bf, []byte(meta.DatabaseName()))
+	bf.WriteString(`,"table":`)
+	writeJSONString(&bf, []byte(meta.TableName()))
+	bf.WriteString(`,"ts_ms":`)
+	bf.WriteString(strconv.FormatInt(tsMs, 10))
+	bf.WriteString(`,"tso":`)
+	if tso == 0 {
+		bf.WriteString("null")
+	} else {
+		bf.WriteString(strconv.FormatUint(tso, 10))
+	}
+	bf.WriteString("}}")
+	return []byte(`{"op":"` + changeFeedSnapshotOp + `","after":`), bf.Bytes()
+}
+
+// writeChangeFeedValue writes the raw value of a column as a plain JSON value. The integers and floats are numbers,
+// the decimals are strings to keep their precision, and the binary values are base64 strings.
+func writeChangeFeedValue(bf *bytes.Buffer, tp mongoJSONType, raw []byte) {
+	if raw == nil {
+		bf.WriteString("null")
+		return
+	}
+	switch tp {
+	case mongoJSONInt, mongoJSONLong, mongoJSONUnsignedLong, mongoJSONDouble, mongoJSONDocument:
+		bf.Write(raw)
+	case mongoJSONBinary:
+		bf.WriteByte('"')
+		bf.WriteString(base64.StdEncoding.EncodeToString(raw))
+		bf.WriteByte('"')
+	default:
+		writeJSONString(bf, raw)
+	}
+}
+
+// WriteInsertInChangeFeed writes TableDataIR to a storage.ExternalFileWriter as snapshot change events in
+// a Debezium-like envelope, one event per row, so they can be consumed the same as the incremental changes
+func WriteInsertInChangeFeed(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR TableDataIR, w storage.ExternalFileWriter) (uint64, error) {
+	prefix, suffix := changeFeedEnvelope(cfg, meta)
+	return writeInsertInJSONLines(pCtx, cfg, meta, tblIR, w, prefix, suffix, writeChangeFeedValue)
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestWriteInsertInChangeFeed(c *C) {
+	data := [][]driver.Value{
+		{"1", "18446744073709551615", "1.5", "12.340", "2021-03-04 05:06:07", []byte{0, 1, 255}, `{"a": 1}`, "bob \"the\" builder"},
+		{"2", nil, nil, nil, nil, nil, nil, nil},
+	}
+	colTypes := []string{"INT", "UNSIGNED BIGINT", "DOUBLE", "DECIMAL", "DATETIME", "BLOB", "JSON", "VARCHAR"}
+	tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+	tableIR.colNames = []string{"id", "u", "d", "dec", "dt", "b", "j", "s"}
+	bf := storage.NewBufferWriter()
+
+	conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+	// the physical time of the TSO is 1614834367500
+	conf.Snapshot = "423319140433920000"
+	n, err := WriteInsertInChangeFeed(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, uint64(2))
+	source := `"source":{"db":"test","table":"t","ts_ms":1614834367500,"tso":423319140433920000}}`
+	expected := `{"op":"r","after":{"id":1,"u":18446744073709551615,"d":1.5,"dec":"12.340","dt":"2021-03-04 05:06:07",` +
+		`"b":"AAH/","j":{"a": 1},"s":"bob \"the\" builder"},` + source + "\n" +
+		`{"op":"r","after":{"id":2,"u":null,"d":null,"dec":null,"dt":null,"b":null,"j":null,"s":null},` + source + "\n"
+	c.Assert(bf.String(), Equals, expected)
+}
+
+func (s *testUtilSuite) TestChangeFeedSnapshotTime(c *C) {
+	conf := DefaultConfig()
+	tso, tsMs := changeFeedSnapshotTime(conf)
+	c.Assert(tso, Equals, uint64(0))
+	c.Assert(tsMs, Equals, int64(0))
+
+	// the time the snapshot is taken at is used if the snapshot isn't a TSO
+	conf.Snapshot = "2021-03-04 05:06:07"
+	conf.SnapshotTime = time.Unix(1614834367, 500*int64(time.Millisecond))
+	tso, tsMs = changeFeedSnapshotTime(conf)
+	c.Assert(tso, Equals, uint64(0))
+	c.Assert(tsMs, Equals, int64(1614834367500))
+
+	conf.Snapshot = "423319140433920001"
+	tso, tsMs = changeFeedSnapshotTime(conf)
+	c.Assert(tso, Equals, uint64(423319140433920001))
+	c.Assert(tsMs, Equals, int64(1614834367500))
+}
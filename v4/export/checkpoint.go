@@ -0,0 +1,362 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+	pd "github.com/tikv/pd/client"
+	"go.uber.org/zap"
+)
+
+// checkpointFlushInterval is the least interval to write the checkpoint after the chunks are written,
+// the chunks written since the last time are dumped again if the dump dies
+const checkpointFlushInterval = time.Second
+
+// checkpointChunk is a chunk of a table in the checkpoint, which is enough to dump it again
+type checkpointChunk struct {
+	Index      int      `json:"index"`
+	Queries    []string `json:"queries"`
+	ColLen     int      `json:"col_len"`
+	ChunkField string   `json:"chunk_field,omitempty"`
+	KeyColumns []string `json:"key_columns,omitempty"`
+	Done       bool     `json:"done"`
+}
+
+// checkpointTable is a table whose chunks are being dumped, the chunks are recorded before any of them is dumped,
+// so the same chunks are dumped after resuming even if the table would be split differently
+type checkpointTable struct {
+	TotalChunks int                `json:"total_chunks"`
+	Chunks      []*checkpointChunk `json:"chunks"`
+}
+
+// checkpoint records the progress of the dump in Config.Checkpoint of the output storage. A dump resumed from it
+// reuses the snapshot and the metadata of the first attempt, and skips the chunks written before.
+type checkpoint struct {
+	mu        sync.Mutex
+	path      string
+	storage   storage.ExternalStorage
+	resumed   bool
+	lastFlush time.Time
+
+	Snapshot string `json:"snapshot"`
+	// GCSafePointID and SnapshotTS are the service GC safe point protecting the snapshot of the first attempt,
+	// it's registered again before resuming so the snapshot isn't GCed while the dump is restarted
+	GCSafePointID string `json:"gc_safe_point_id,omitempty"`
+	SnapshotTS    uint64 `json:"snapshot_ts,omitempty"`
+	// Metadata and Status are the global metadata and the master status recorded by the first attempt
+	Metadata string `json:"metadata"`
+	Status   string `json:"status"`
+	// Tables are the tables being dumped, `db`.`table` -> chunks
+	Tables map[string]*checkpointTable `json:"tables"`
+	// Finished are the tables whose chunks are all written
+	Finished map[string]bool `json:"finished"`
+}
+
+// loadCheckpoint reads the checkpoint at path of s, a new one is returned if it doesn't exist
+func loadCheckpoint(tctx *tcontext.Context, s storage.ExternalStorage, path string) (*checkpoint, error) {
+	c := &checkpoint{
+		path:     path,
+		storage:  s,
+		Tables:   make(map[string]*checkpointTable),
+		Finished: make(map[string]bool),
+	}
+	exists, err := s.FileExists(tctx, path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "fail to check the checkpoint %s", path)
+	}
+	if !exists {
+		tctx.L().Info("the checkpoint doesn't exist, start a new dump", zap.String("path", path))
+		return c, nil
+	}
+	data, err := s.ReadFile(tctx, path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "fail to read the checkpoint %s", path)
+	}
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, errors.Annotatef(err, "fail to parse the checkpoint %s, remove it to start a new dump", path)
+	}
+	if c.Tables == nil {
+		c.Tables = make(map[string]*checkpointTable)
+	}
+	if c.Finished == nil {
+		c.Finished = make(map[string]bool)
+	}
+	c.resumed = true
+	tctx.L().Info("resume the dump from the checkpoint", zap.String("path", path), zap.String("snapshot", c.Snapshot),
+		zap.Int("finished tables", len(c.Finished)), zap.Int("unfinished tables", len(c.Tables)))
+	return c, nil
+}
+
+// ResumeFrom resumes the dump from the checkpoint at path of the output storage, or starts to record a new one
+// there if it doesn't exist. The snapshot of the checkpoint is reused, so the dumper can't be created with another
+// snapshot. It's called by NewDumper with Config.Checkpoint.
+func (d *Dumper) ResumeFrom(path string) error {
+	c, err := loadCheckpoint(d.tctx, d.extStore, path)
+	if err != nil {
+		return err
+	}
+	conf := d.conf
+	if c.resumed && c.Snapshot != "" && conf.Snapshot != c.Snapshot {
+		if conf.Snapshot != "" {
+			return errors.Errorf("the checkpoint %s is taken at snapshot %s, but the dump is at snapshot %s", path, c.Snapshot, conf.Snapshot)
+		}
+		conf.Snapshot = c.Snapshot
+	}
+	conf.Checkpoint = path
+	d.checkpoint = c
+	return nil
+}
+
+func resumeFromCheckpoint(d *Dumper) error {
+	if d.conf.Checkpoint == "" {
+		return nil
+	}
+	return d.ResumeFrom(d.conf.Checkpoint)
+}
+
+// gcSafePoint returns the service GC safe point recorded by the first attempt, or zero values if it isn't resumed
+func (c *checkpoint) gcSafePoint() (serviceID string, snapshotTS uint64) {
+	if c == nil || !c.resumed {
+		return "", 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.GCSafePointID, c.SnapshotTS
+}
+
+// protectSnapshot records the service GC safe point protecting the snapshot. After resuming, it's registered
+// again at once, and the dump fails fast if the snapshot has been GCed while the dump was restarted, so the
+// chunks left aren't read at a GCed snapshot.
+func (c *checkpoint) protectSnapshot(tctx *tcontext.Context, pdClient pd.Client, serviceID string, snapshotTS uint64) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	c.GCSafePointID, c.SnapshotTS = serviceID, snapshotTS
+	resumed := c.resumed
+	c.mu.Unlock()
+	if !resumed {
+		// it's written with the metadata of the first attempt
+		return nil
+	}
+	minSafePoint, err := pdClient.UpdateServiceGCSafePoint(tctx, serviceID, defaultDumpGCSafePointTTL, snapshotTS)
+	if err != nil {
+		return errors.Annotatef(err, "fail to register the service GC safe point %s again to resume from the checkpoint %s", serviceID, c.path)
+	}
+	if minSafePoint > snapshotTS {
+		err = &snapshotNotProtectedError{clusterID: pdClient.GetClusterID(tctx), minSafePoint: minSafePoint, snapshotTS: snapshotTS}
+		return errors.Annotatef(err, "the snapshot of the checkpoint %s may have been GCed, remove it to start a new dump", c.path)
+	}
+	tctx.L().Info("register the service GC safe point of the checkpoint again", zap.String("id", serviceID),
+		zap.Uint64("snapshotTS", snapshotTS))
+	return nil
+}
+
+// syncMetadata records the global metadata of the first attempt, or restores it after resuming,
+// so the binlog position in the metadata is where the first attempt starts
+func (c *checkpoint) syncMetadata(tctx *tcontext.Context, conf *Config, m *globalMetadata) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed {
+		if conf.ServerInfo.ServerType != ServerTypeTiDB || c.Snapshot == "" {
+			tctx.L().Warn("the chunks resumed aren't read at the snapshot of the first attempt, " +
+				"the changes since the binlog position in the metadata should be replicated in safe mode")
+		}
+		m.buffer.Reset()
+		m.buffer.WriteString(c.Metadata)
+		m.statusBuffer.Reset()
+		m.statusBuffer.WriteString(c.Status)
+		return nil
+	}
+	c.Snapshot = conf.Snapshot
+	c.Metadata = m.buffer.String()
+	c.Status = m.statusBuffer.String()
+	return c.flush(tctx)
+}
+
+func checkpointTableKey(meta TableMeta) string {
+	return wrapBackTicks(escapeString(meta.DatabaseName())) + "." + wrapBackTicks(escapeString(meta.TableName()))
+}
+
+// newCheckpointChunk records the chunk to dump it again, only the chunks selecting by queries can be recorded
+func newCheckpointChunk(t *TaskTableData) (*checkpointChunk, error) {
+	chunk := &checkpointChunk{Index: t.ChunkIndex, ChunkField: t.ChunkField, KeyColumns: t.keyColumns}
+	switch data := t.Data.(type) {
+	case *tableData:
+		chunk.Queries, chunk.ColLen = []string{data.query}, data.colLen
+	case *multiQueriesChunk:
+		chunk.Queries, chunk.ColLen = data.queries, data.colLen
+	default:
+		return nil, errors.Errorf("chunk %d of table `%s`.`%s` can't be recorded in the checkpoint",
+			t.ChunkIndex, t.Meta.DatabaseName(), t.Meta.TableName())
+	}
+	return chunk, nil
+}
+
+func (c *checkpointChunk) task(meta TableMeta, totalChunks int) *TaskTableData {
+	var data TableDataIR
+	if len(c.Queries) == 1 {
+		data = newTableData(c.Queries[0], c.ColLen, false)
+	} else {
+		data = newMultiQueriesChunk(c.Queries, c.ColLen)
+	}
+	task := NewTaskTableData(meta, data, c.Index, totalChunks)
+	task.ChunkField, task.keyColumns = c.ChunkField, c.KeyColumns
+	return task
+}
+
+// tableChunks returns the chunks of the table which aren't written yet. The chunks recorded are returned after
+// resuming, otherwise they're collected from dump and recorded before any of them is sent to the writers.
+// It returns nil if the table is finished.
+func (c *checkpoint) tableChunks(tctx *tcontext.Context, meta TableMeta, dump func() ([]*TaskTableData, error)) ([]*TaskTableData, error) {
+	key := checkpointTableKey(meta)
+	c.mu.Lock()
+	finished, table := c.Finished[key], c.Tables[key]
+	c.mu.Unlock()
+	if finished {
+		tctx.L().Info("skip the table finished before resuming", zap.String("table", key))
+		return nil, nil
+	}
+	if table != nil {
+		var chunks []*TaskTableData
+		for _, chunk := range table.Chunks {
+			if !chunk.Done {
+				chunks = append(chunks, chunk.task(meta, table.TotalChunks))
+			}
+		}
+		tctx.L().Info("resume the table from the checkpoint", zap.String("table", key),
+			zap.Int("total chunks", table.TotalChunks), zap.Int("remaining chunks", len(chunks)))
+		return chunks, nil
+	}
+
+	chunks, err := dump()
+	if err != nil {
+		return nil, err
+	}
+	table = &checkpointTable{Chunks: make([]*checkpointChunk, 0, len(chunks))}
+	for _, t := range chunks {
+		chunk, err := newCheckpointChunk(t)
+		if err != nil {
+			return nil, err
+		}
+		table.TotalChunks = t.TotalChunks
+		table.Chunks = append(table.Chunks, chunk)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(chunks) == 0 {
+		c.Finished[key] = true
+	} else {
+		c.Tables[key] = table
+	}
+	// the chunks must be recorded before they're written, so the table isn't split differently after resuming
+	return chunks, c.flush(tctx)
+}
+
+// finishChunk marks the chunk written, the table is finished after all its chunks are written
+func (c *checkpoint) finishChunk(tctx *tcontext.Context, t *TaskTableData) {
+	if c == nil {
+		return
+	}
+	key := checkpointTableKey(t.Meta)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	table, ok := c.Tables[key]
+	if !ok {
+		return
+	}
+	finished := true
+	for _, chunk := range table.Chunks {
+		if chunk.Index == t.ChunkIndex {
+			chunk.Done = true
+		}
+		finished = finished && chunk.Done
+	}
+	if finished {
+		delete(c.Tables, key)
+		c.Finished[key] = true
+	}
+	if time.Since(c.lastFlush) < checkpointFlushInterval {
+		return
+	}
+	if err := c.flush(tctx); err != nil {
+		tctx.L().Warn("fail to write the checkpoint", zap.String("path", c.path), zap.Error(err))
+	}
+}
+
+// close writes the chunks written since the last flush
+func (c *checkpoint) close(tctx *tcontext.Context) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush(tctx)
+}
+
+// flush writes the checkpoint, the caller should hold c.mu
+func (c *checkpoint) flush(tctx *tcontext.Context) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = c.storage.WriteFile(tctx, c.path, data); err != nil {
+		return errors.Annotatef(err, "fail to write the checkpoint %s", c.path)
+	}
+	c.lastFlush = time.Now()
+	return nil
+}
+
+// collectTableChunks collects the chunks which dump sends to the writers, they aren't sent yet
+func (d *Dumper) collectTableChunks(tctx *tcontext.Context, dump func(taskChan chan<- Task) error) ([]*TaskTableData, error) {
+	chunkChan := make(chan Task, defaultDumpThreads)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- dump(chunkChan)
+		close(chunkChan)
+	}()
+	var chunks []*TaskTableData
+	for task := range chunkChan {
+		td, ok := task.(*TaskTableData)
+		if !ok {
+			tctx.L().Warn("unexpected task when collecting table chunks", zap.String("task", task.Brief()))
+			continue
+		}
+		// the chunk is sent to the writers later, which takes a slot of the table again
+		td.finish()
+		chunks = append(chunks, td)
+	}
+	return chunks, <-errCh
+}
+
+// dumpTableChunks sends the chunks of the table which dump produces, or the ones unwritten before resuming
+// with the checkpoint
+func (d *Dumper) dumpTableChunks(tctx *tcontext.Context, meta TableMeta, taskChan chan<- Task, dump func(taskChan chan<- Task) error) error {
+	if d.checkpoint == nil {
+		return dump(taskChan)
+	}
+	resumed := true
+	chunks, err := d.checkpoint.tableChunks(tctx, meta, func() ([]*TaskTableData, error) {
+		resumed = false
+		return d.collectTableChunks(tctx, dump)
+	})
+	if err != nil {
+		return err
+	}
+	if resumed && len(chunks) > 0 {
+		d.safeMode.register(meta)
+	}
+	for _, task := range chunks {
+		if d.sendTaskToChan(tctx, task, taskChan) {
+			return tctx.Err()
+		}
+	}
+	return nil
+}
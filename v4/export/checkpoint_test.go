@@ -0,0 +1,317 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/errno"
+	"golang.org/x/sync/errgroup"
+)
+
+func (s *testConfigSuite) TestAdjustCheckpoint(c *C) {
+	conf := DefaultConfig()
+	c.Assert(adjustCheckpoint(conf), IsNil)
+	conf.Checkpoint = "checkpoint.json"
+	c.Assert(adjustCheckpoint(conf), IsNil)
+	conf.SQL = "SELECT 1"
+	c.Assert(adjustCheckpoint(conf), ErrorMatches, ".*can't be used with --sql.*")
+	conf.SQL = ""
+	conf.SampleTables = "10"
+	c.Assert(adjustCheckpoint(conf), ErrorMatches, ".*without config.SampleTablesSeed.*")
+	conf.SampleTablesSeed = 42
+	c.Assert(adjustCheckpoint(conf), IsNil)
+}
+
+func (s *testUtilSuite) TestResumeFromCheckpoint(c *C) {
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	extStore, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	meta := &tableMeta{database: "test", table: "t"}
+	queries := []string{
+		"SELECT * FROM `test`.`t` WHERE `id`<10",
+		"SELECT * FROM `test`.`t` WHERE `id`>=10 AND `id`<20",
+		"SELECT * FROM `test`.`t` WHERE `id`>=20",
+	}
+	newDumper := func(snapshot string) *Dumper {
+		conf := DefaultConfig()
+		conf.Snapshot = snapshot
+		d := &Dumper{tctx: tctx, conf: conf, extStore: extStore}
+		c.Assert(d.ResumeFrom("checkpoint.json"), IsNil)
+		return d
+	}
+	dumpChunks := func(d *Dumper, splits int) []*TaskTableData {
+		taskChan := make(chan Task, len(queries))
+		err := d.dumpTableChunks(tctx, meta, taskChan, func(taskChan chan<- Task) error {
+			for i, query := range queries[:splits] {
+				task := NewTaskTableData(meta, newTableData(query, 1, false), i, splits)
+				task.ChunkField = "id"
+				taskChan <- task
+			}
+			return nil
+		})
+		c.Assert(err, IsNil)
+		close(taskChan)
+		var chunks []*TaskTableData
+		for task := range taskChan {
+			chunks = append(chunks, task.(*TaskTableData))
+		}
+		return chunks
+	}
+
+	// the first attempt writes the first chunk and dies
+	d := newDumper("424242")
+	m := &globalMetadata{}
+	m.buffer.WriteString("Log: mysql-bin.000001\nPos: 100\n")
+	c.Assert(d.checkpoint.syncMetadata(tctx, d.conf, m), IsNil)
+	chunks := dumpChunks(d, 3)
+	c.Assert(chunks, HasLen, 3)
+	d.checkpoint.finishChunk(tctx, chunks[0])
+	c.Assert(d.checkpoint.close(tctx), IsNil)
+
+	// the table would be split differently, but the chunks recorded are dumped after resuming
+	d = newDumper("")
+	c.Assert(d.conf.Snapshot, Equals, "424242")
+	m = &globalMetadata{}
+	m.buffer.WriteString("Log: mysql-bin.000002\nPos: 4\n")
+	c.Assert(d.checkpoint.syncMetadata(tctx, d.conf, m), IsNil)
+	c.Assert(m.buffer.String(), Equals, "Log: mysql-bin.000001\nPos: 100\n")
+	resumed := dumpChunks(d, 2)
+	c.Assert(resumed, HasLen, 2)
+	written := []string{queries[0]}
+	for i, chunk := range resumed {
+		c.Assert(chunk.ChunkIndex, Equals, i+1)
+		c.Assert(chunk.TotalChunks, Equals, 3)
+		c.Assert(chunk.ChunkField, Equals, "id")
+		written = append(written, chunk.Data.(*tableData).query)
+		d.checkpoint.finishChunk(tctx, chunk)
+	}
+	c.Assert(written, DeepEquals, queries, Commentf("no chunk is skipped or written twice"))
+	c.Assert(d.checkpoint.close(tctx), IsNil)
+
+	// the finished table isn't dumped again
+	d = newDumper("424242")
+	c.Assert(dumpChunks(d, 3), HasLen, 0)
+
+	// the snapshot can't be changed after resuming
+	d = &Dumper{tctx: tctx, conf: DefaultConfig(), extStore: extStore}
+	d.conf.Snapshot = "1"
+	c.Assert(d.ResumeFrom("checkpoint.json"), ErrorMatches, ".*taken at snapshot 424242.*")
+}
+
+func (s *testSQLSuite) TestResumeGCSafePointFromCheckpoint(c *C) {
+	extStore, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	startDumper := func(snapshot string, pdClient *mockGCPDClient) (*Dumper, error) {
+		tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+		conf := DefaultConfig()
+		conf.Snapshot = snapshot
+		d := &Dumper{tctx: tctx, conf: conf, cancelCtx: cancel, extStore: extStore, tidbPDClientForGC: pdClient}
+		c.Assert(d.ResumeFrom("checkpoint.json"), IsNil)
+		err := tidbStartGCSavepointUpdateService(d)
+		if err == nil {
+			c.Assert(d.checkpoint.syncMetadata(tctx, conf, &globalMetadata{}), IsNil)
+		}
+		// stop updating the safe point as if the dump is killed
+		cancel()
+		return d, err
+	}
+
+	// the first attempt registers the safe point in the background, and records it in the checkpoint
+	pdClient := &mockGCPDClient{}
+	d, err := startDumper("424242", pdClient)
+	c.Assert(err, IsNil)
+	serviceID, snapshotTS := d.checkpoint.GCSafePointID, d.checkpoint.SnapshotTS
+	c.Assert(serviceID, Matches, "dumpling_[0-9]+")
+	c.Assert(snapshotTS, Equals, uint64(424242))
+
+	// the same safe point is registered again before resuming
+	pdClient = &mockGCPDClient{}
+	d, err = startDumper("", pdClient)
+	c.Assert(err, IsNil)
+	c.Assert(d.conf.Snapshot, Equals, "424242")
+	id, safePoint := pdClient.firstUpdate()
+	c.Assert(id, Equals, serviceID)
+	c.Assert(safePoint, Equals, snapshotTS)
+	c.Assert(d.gcLease, NotNil)
+
+	// the dump fails fast if the snapshot has been GCed during the restart
+	pdClient = &mockGCPDClient{minSafePoint: 500000}
+	d, err = startDumper("", pdClient)
+	c.Assert(err, ErrorMatches, "the snapshot of the checkpoint checkpoint.json may have been GCed, remove it to start a new dump: "+
+		"the GC safe point 500000 of cluster 6900000000000000000 is beyond the snapshot 424242.*")
+	c.Assert(pdClient.callCount(), Equals, 1)
+	c.Assert(d.gcLease, IsNil)
+	pdClient = &mockGCPDClient{failures: 1}
+	_, err = startDumper("", pdClient)
+	c.Assert(err, ErrorMatches, "fail to register the service GC safe point "+serviceID+" again.*: pd is unavailable")
+}
+
+func (s *testWriterSuite) TestResumeTableKilledMidway(c *C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.Consistency = consistencyTypeNone
+	conf.Snapshot = "424242"
+	meta := newMockTableIR("test", "t", nil, nil, []string{"INT"})
+	queries := []string{
+		"SELECT * FROM `test`.`t` WHERE `id`<10",
+		"SELECT * FROM `test`.`t` WHERE `id`>=10 AND `id`<20",
+		"SELECT * FROM `test`.`t` WHERE `id`>=20",
+	}
+	// runWriter writes the chunks of the table until one of them fails, the written chunks are marked in the checkpoint
+	runWriter := func(d *Dumper, dump func(taskChan chan<- Task) error) error {
+		writer, _ := s.newRetryWriter(conf, db, c)
+		writer.setFinishTaskCallBack(func(task Task) {
+			d.checkpoint.finishChunk(tctx, task.(*TaskTableData))
+		})
+		taskChan := make(chan Task, len(queries))
+		c.Assert(d.dumpTableChunks(tctx, meta, taskChan, dump), IsNil)
+		close(taskChan)
+		return writer.run(taskChan)
+	}
+	newDumper := func() *Dumper {
+		d := &Dumper{tctx: tctx, conf: conf}
+		d.extStore, err = conf.createExternalStorage(tctx)
+		c.Assert(err, IsNil)
+		c.Assert(d.ResumeFrom("checkpoint.json"), IsNil)
+		c.Assert(d.checkpoint.syncMetadata(tctx, conf, &globalMetadata{}), IsNil)
+		return d
+	}
+
+	// the dump is killed while the second chunk is written, the checkpoint isn't closed
+	d := newDumper()
+	mock.ExpectQuery(queries[0]).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1))
+	mock.ExpectQuery(queries[1]).WillReturnError(&mysql.MySQLError{Number: errno.ErrQueryInterrupted, Message: "Query execution was interrupted"})
+	err = runWriter(d, func(taskChan chan<- Task) error {
+		for i, query := range queries {
+			taskChan <- NewTaskTableData(meta, newTableData(query, 1, false), i, len(queries))
+		}
+		return nil
+	})
+	c.Assert(err, ErrorMatches, ".*Query execution was interrupted.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// after resuming, the recorded chunks not written before the last flush are written, the first chunk may
+	// be written again into the same file, but none is skipped
+	conf.Snapshot = ""
+	d = newDumper()
+	c.Assert(conf.Snapshot, Equals, "424242")
+	var resumed []string
+	for _, chunk := range d.checkpoint.Tables["`test`.`t`"].Chunks {
+		if !chunk.Done {
+			resumed = append(resumed, chunk.Queries[0])
+			mock.ExpectQuery(chunk.Queries[0]).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(chunk.Index + 1))
+		}
+	}
+	c.Assert(resumed, DeepEquals, queries[len(queries)-len(resumed):])
+	c.Assert(len(resumed), GreaterEqual, 2)
+	err = runWriter(d, func(chan<- Task) error {
+		c.Fatal("the table is split again after resuming")
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(d.checkpoint.close(tctx), IsNil)
+	c.Assert(d.checkpoint.Finished["`test`.`t`"], IsTrue)
+	for i := range queries {
+		content, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, fmt.Sprintf("test.t.%09d.sql", i)))
+		c.Assert(err, IsNil)
+		c.Assert(string(content), Equals, fmt.Sprintf("INSERT INTO `t` VALUES\n(%d);\n", i+1))
+	}
+}
+
+func (s *testWriterSuite) TestResumeWithMoreThreads(c *C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.Consistency = consistencyTypeNone
+	conf.Snapshot = "424242"
+	meta := newMockTableIR("test", "t", nil, nil, []string{"INT"})
+	queries := make([]string, 6)
+	for i := range queries {
+		queries[i] = fmt.Sprintf("SELECT * FROM `test`.`t` WHERE `id`>=%d AND `id`<%d", i*10, (i+1)*10)
+	}
+	// runWriters writes the chunks of the table by conf.Threads writers, the written chunks are marked in the checkpoint
+	runWriters := func(d *Dumper, dump func(taskChan chan<- Task) error) error {
+		taskChan := make(chan Task, len(queries))
+		c.Assert(d.dumpTableChunks(tctx, meta, taskChan, dump), IsNil)
+		close(taskChan)
+		var eg errgroup.Group
+		for i := 0; i < conf.Threads; i++ {
+			writer, _ := s.newRetryWriter(conf, db, c)
+			writer.setFinishTaskCallBack(func(task Task) {
+				d.checkpoint.finishChunk(tctx, task.(*TaskTableData))
+			})
+			eg.Go(func() error { return writer.run(taskChan) })
+		}
+		return eg.Wait()
+	}
+	newDumper := func() *Dumper {
+		d := &Dumper{tctx: tctx, conf: conf}
+		d.extStore, err = conf.createExternalStorage(tctx)
+		c.Assert(err, IsNil)
+		c.Assert(d.ResumeFrom("checkpoint.json"), IsNil)
+		c.Assert(d.checkpoint.syncMetadata(tctx, conf, &globalMetadata{}), IsNil)
+		return d
+	}
+
+	// the first attempt with one thread fails at the fourth chunk
+	conf.Threads = 1
+	d := newDumper()
+	for i := 0; i < 3; i++ {
+		mock.ExpectQuery(queries[i]).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(i))
+	}
+	mock.ExpectQuery(queries[3]).WillReturnError(&mysql.MySQLError{Number: errno.ErrQueryInterrupted, Message: "Query execution was interrupted"})
+	err = runWriters(d, func(taskChan chan<- Task) error {
+		for i, query := range queries {
+			taskChan <- NewTaskTableData(meta, newTableData(query, 1, false), i, len(queries))
+		}
+		return nil
+	})
+	c.Assert(err, ErrorMatches, ".*Query execution was interrupted.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(d.checkpoint.close(tctx), IsNil)
+
+	// resuming with more threads skips the finished chunks, and writes each of the others once in any order
+	conf.Threads = 4
+	d = newDumper()
+	mock.MatchExpectationsInOrder(false)
+	for i := 3; i < len(queries); i++ {
+		mock.ExpectQuery(queries[i]).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(i + 100))
+	}
+	err = runWriters(d, func(chan<- Task) error {
+		c.Fatal("the table is split again after resuming")
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(d.checkpoint.close(tctx), IsNil)
+	c.Assert(d.checkpoint.Finished["`test`.`t`"], IsTrue)
+	for i := range queries {
+		content, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, fmt.Sprintf("test.t.%09d.sql", i)))
+		c.Assert(err, IsNil)
+		value := i
+		if i >= 3 {
+			value += 100
+		}
+		c.Assert(string(content), Equals, fmt.Sprintf("INSERT INTO `t` VALUES\n(%d);\n", value))
+	}
+}
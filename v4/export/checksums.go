@@ -0,0 +1,213 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+// checksumsFileName is the file listing the SHA-256 of every written file, in the format of `sha256sum -c`
+const checksumsFileName = "SHA256SUMS"
+
+// checksumManifestFileName is the JSON manifest listing the size, the SHA-256 and the table and chunk of every written file
+const checksumManifestFileName = "checksum.json"
+
+// ManifestEntry is a file in the checksum manifest
+type ManifestEntry struct {
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Database and Table are the ones the file belongs to, they're empty for the files of the whole dump like metadata
+	Database string `json:"database,omitempty"`
+	Table    string `json:"table,omitempty"`
+	// Chunk is the index of the chunk whose data is in the file, it's nil for the schema files
+	Chunk *int `json:"chunk,omitempty"`
+}
+
+type checksumManifest struct {
+	Files []ManifestEntry `json:"files"`
+}
+
+// checksumFileOwner is the table and chunk a written file belongs to
+type checksumFileOwner struct {
+	database, table string
+	// chunk is -1 if the file isn't a data file
+	chunk int
+}
+
+// checksumStorage is an ExternalStorage which records the SHA-256 of every file written through it.
+// The checksums are computed on the bytes written to the storage, i.e. after compression.
+type checksumStorage struct {
+	storage.ExternalStorage
+
+	mu sync.Mutex
+	// file name -> hex encoded SHA-256
+	sums   map[string]string
+	sizes  map[string]int64
+	owners map[string]checksumFileOwner
+}
+
+func newChecksumStorage(s storage.ExternalStorage) *checksumStorage {
+	return &checksumStorage{
+		ExternalStorage: s,
+		sums:            make(map[string]string),
+		sizes:           make(map[string]int64),
+		owners:          make(map[string]checksumFileOwner),
+	}
+}
+
+func (s *checksumStorage) record(name string, h hash.Hash, size int64) {
+	s.mu.Lock()
+	s.sums[name] = hex.EncodeToString(h.Sum(nil))
+	s.sizes[name] = size
+	s.mu.Unlock()
+}
+
+// addFile records the table of a written file, and its chunk if chunk isn't -1
+func (s *checksumStorage) addFile(db, table string, chunk int, file string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.owners[file] = checksumFileOwner{database: db, table: table, chunk: chunk}
+	s.mu.Unlock()
+}
+
+// forget drops the checksum of a deleted file
+func (s *checksumStorage) forget(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.sums, name)
+	delete(s.sizes, name)
+	delete(s.owners, name)
+	s.mu.Unlock()
+}
+
+// WriteFile implements ExternalStorage.WriteFile
+func (s *checksumStorage) WriteFile(ctx context.Context, name string, data []byte) error {
+	if err := s.ExternalStorage.WriteFile(ctx, name, data); err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, _ = h.Write(data)
+	s.record(name, h, int64(len(data)))
+	return nil
+}
+
+// Create implements ExternalStorage.Create
+func (s *checksumStorage) Create(ctx context.Context, path string) (storage.ExternalFileWriter, error) {
+	w, err := s.ExternalStorage.Create(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &checksumFileWriter{ExternalFileWriter: w, storage: s, name: path, hash: sha256.New()}, nil
+}
+
+// writeChecksums writes the checksums of all the written files into checksumsFileName and checksumManifestFileName,
+// sorted by the file names
+func (s *checksumStorage) writeChecksums(ctx context.Context) error {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.sums))
+	for name := range s.sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var bf bytes.Buffer
+	manifest := checksumManifest{Files: make([]ManifestEntry, 0, len(names))}
+	for _, name := range names {
+		fmt.Fprintf(&bf, "%s  %s\n", s.sums[name], name)
+		entry := ManifestEntry{File: name, Size: s.sizes[name], SHA256: s.sums[name]}
+		if owner, ok := s.owners[name]; ok {
+			entry.Database, entry.Table = owner.database, owner.table
+			if owner.chunk >= 0 {
+				chunk := owner.chunk
+				entry.Chunk = &chunk
+			}
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+	s.mu.Unlock()
+	if err := s.ExternalStorage.WriteFile(ctx, checksumsFileName, bf.Bytes()); err != nil {
+		return errors.Trace(err)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.ExternalStorage.WriteFile(ctx, checksumManifestFileName, append(data, '\n')))
+}
+
+// VerifyManifest reads the files in the checksum manifest at path of store again, and returns the entries whose file
+// is missing or whose size or SHA-256 doesn't match. It's used to validate a dump after it's transferred.
+func VerifyManifest(ctx context.Context, store storage.ExternalStorage, path string) ([]ManifestEntry, error) {
+	data, err := store.ReadFile(ctx, path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "fail to read checksum manifest %s", path)
+	}
+	var manifest checksumManifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Annotatef(err, "fail to parse checksum manifest %s", path)
+	}
+	var mismatched []ManifestEntry
+	for _, entry := range manifest.Files {
+		size, sum, err := checksumOfFile(ctx, store, entry.File)
+		if err != nil || size != entry.Size || sum != entry.SHA256 {
+			mismatched = append(mismatched, entry)
+		}
+	}
+	return mismatched, nil
+}
+
+// checksumOfFile returns the size and the hex encoded SHA-256 of a file in store
+func checksumOfFile(ctx context.Context, store storage.ExternalStorage, name string) (int64, string, error) {
+	r, err := store.Open(ctx, name)
+	if err != nil {
+		return 0, "", errors.Trace(err)
+	}
+	defer r.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return 0, "", errors.Trace(err)
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type checksumFileWriter struct {
+	storage.ExternalFileWriter
+	storage *checksumStorage
+	name    string
+	hash    hash.Hash
+	size    int64
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *checksumFileWriter) Write(ctx context.Context, p []byte) (int, error) {
+	n, err := w.ExternalFileWriter.Write(ctx, p)
+	_, _ = w.hash.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+// Close implements ExternalFileWriter.Close
+func (w *checksumFileWriter) Close(ctx context.Context) error {
+	if err := w.ExternalFileWriter.Close(ctx); err != nil {
+		return err
+	}
+	w.storage.record(w.name, w.hash, w.size)
+	return nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestEmitChecksums(c *C) {
+	dir := c.MkDir()
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = dir
+	config.CompressType = CompressGzip
+
+	extStore, err := config.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	checksums := newChecksumStorage(extStore)
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	writer := NewWriter(tctx, 0, config, conn, checksums)
+	writer.checksums = checksums
+
+	c.Assert(writer.WriteTableMeta("test", "t", "CREATE TABLE t (a INT)"), IsNil)
+	tableIR := newMockTableIR("test", "t", [][]driver.Value{{"1"}, {"2"}}, nil, []string{"INT"})
+	c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+	m := newGlobalMetadata(tctx, checksums, "")
+	c.Assert(m.writeGlobalMetaData(), IsNil)
+	c.Assert(checksums.writeChecksums(tctx), IsNil)
+
+	sums, err := ioutil.ReadFile(path.Join(dir, checksumsFileName))
+	c.Assert(err, IsNil)
+	lines := strings.Split(strings.TrimSuffix(string(sums), "\n"), "\n")
+	expectedFiles := []string{"metadata", "test.t-schema.sql.gz", "test.t.000000000.sql.gz"}
+	c.Assert(lines, HasLen, len(expectedFiles))
+	for i, name := range expectedFiles {
+		// the checksum is of the file as stored, i.e. after compression
+		data, err := ioutil.ReadFile(path.Join(dir, name))
+		c.Assert(err, IsNil)
+		c.Assert(lines[i], Equals, fmt.Sprintf("%x  %s", sha256.Sum256(data), name))
+	}
+
+	// the manifest has the sizes and the tables and chunks of the files
+	manifestData, err := ioutil.ReadFile(path.Join(dir, checksumManifestFileName))
+	c.Assert(err, IsNil)
+	var manifest checksumManifest
+	c.Assert(json.Unmarshal(manifestData, &manifest), IsNil)
+	c.Assert(manifest.Files, HasLen, len(expectedFiles))
+	for i, name := range expectedFiles {
+		entry := manifest.Files[i]
+		info, err := os.Stat(path.Join(dir, name))
+		c.Assert(err, IsNil)
+		c.Assert(entry.File, Equals, name)
+		c.Assert(entry.Size, Equals, info.Size())
+		c.Assert(fmt.Sprintf("%s  %s", entry.SHA256, name), Equals, lines[i])
+	}
+	c.Assert(manifest.Files[0].Table, Equals, "")
+	c.Assert(manifest.Files[0].Chunk, IsNil)
+	c.Assert(manifest.Files[1].Database+"."+manifest.Files[1].Table, Equals, "test.t")
+	c.Assert(manifest.Files[1].Chunk, IsNil)
+	c.Assert(manifest.Files[2].Database+"."+manifest.Files[2].Table, Equals, "test.t")
+	c.Assert(manifest.Files[2].Chunk, NotNil)
+	c.Assert(*manifest.Files[2].Chunk, Equals, 0)
+
+	mismatched, err := VerifyManifest(tctx, extStore, checksumManifestFileName)
+	c.Assert(err, IsNil)
+	c.Assert(mismatched, HasLen, 0)
+
+	// corrupting one byte of a file fails the verification of exactly that file
+	dataFile := path.Join(dir, "test.t.000000000.sql.gz")
+	data, err := ioutil.ReadFile(dataFile)
+	c.Assert(err, IsNil)
+	data[len(data)/2] ^= 0xff
+	c.Assert(ioutil.WriteFile(dataFile, data, 0o644), IsNil)
+	mismatched, err = VerifyManifest(tctx, extStore, checksumManifestFileName)
+	c.Assert(err, IsNil)
+	c.Assert(mismatched, HasLen, 1)
+	c.Assert(mismatched[0].File, Equals, "test.t.000000000.sql.gz")
+
+	// a missing file fails the verification too
+	c.Assert(os.Remove(path.Join(dir, "metadata")), IsNil)
+	mismatched, err = VerifyManifest(tctx, extStore, checksumManifestFileName)
+	c.Assert(err, IsNil)
+	c.Assert(mismatched, HasLen, 2)
+	c.Assert(mismatched[0].File, Equals, "metadata")
+
+	_, err = VerifyManifest(tctx, extStore, "not-exist.json")
+	c.Assert(err, ErrorMatches, "fail to read checksum manifest not-exist.json.*")
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// chunkBinlogPos is the binlog position of the server just before a chunk is read with Config.PerChunkBinlogPos,
+// it's written into the `.meta` sidecars of the data files of the chunk
+type chunkBinlogPos struct {
+	File string `json:"file"`
+	Pos  string `json:"pos"`
+	GTID string `json:"gtid,omitempty"`
+}
+
+// readChunkBinlogPos reads the binlog position by `SHOW MASTER STATUS` on conn, it returns nil if the binlog is disabled
+func readChunkBinlogPos(tctx *tcontext.Context, conn *sql.Conn, serverType ServerType) (*chunkBinlogPos, error) {
+	str, err := ShowMasterStatus(conn)
+	if err != nil {
+		return nil, err
+	}
+	logFile := getValidStr(str, fileFieldIndex)
+	if logFile == "" {
+		return nil, nil
+	}
+	pos := &chunkBinlogPos{File: logFile, Pos: getValidStr(str, posFieldIndex)}
+	if serverType != ServerTypeMariaDB {
+		pos.GTID = formatGTIDSet(getValidStr(str, gtidSetFieldIndex))
+		return pos, nil
+	}
+	// the same as the metadata file, the GTID of MariaDB isn't in SHOW MASTER STATUS
+	err = conn.QueryRowContext(context.Background(), "SELECT @@global.gtid_binlog_pos").Scan(&pos.GTID)
+	if err != nil {
+		tctx.L().Warn("fail to get gtid for mariaDB", zap.Error(err))
+	}
+	pos.GTID = formatGTIDSet(pos.GTID)
+	return pos, nil
+}
+
+// checkPerChunkBinlogPos is an initialization step of Dumper.
+// The binlog position of each chunk is only meaningful if the chunks aren't read from the same snapshot.
+func checkPerChunkBinlogPos(d *Dumper) error {
+	conf := d.conf
+	if !conf.PerChunkBinlogPos {
+		return nil
+	}
+	switch conf.ServerInfo.ServerType {
+	case ServerTypeMySQL, ServerTypeMariaDB, ServerTypeTiDB:
+	default:
+		return errors.Errorf("config.PerChunkBinlogPos doesn't support the server type %s", conf.ServerInfo.ServerType)
+	}
+	if conf.Consistency == consistencyTypeSnapshot || conf.Consistency == consistencyTypeConsistentSnapshot {
+		return errors.Errorf("config.PerChunkBinlogPos can't be used with the %s consistency, all the chunks are read from the same snapshot", conf.Consistency)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql/driver"
+	"io/ioutil"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestReadChunkBinlogPos(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+			AddRow("ON.000001", "7502", "", "", "6ce40be3-e359-11e9-87e0-36933cb0ca5a:1-29"))
+	pos, err := readChunkBinlogPos(tctx, conn, ServerTypeMySQL)
+	c.Assert(err, IsNil)
+	c.Assert(pos, DeepEquals, &chunkBinlogPos{File: "ON.000001", Pos: "7502", GTID: "6ce40be3-e359-11e9-87e0-36933cb0ca5a:1-29"})
+
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB"}).
+			AddRow("mariadb-bin.000016", "475", "", ""))
+	mock.ExpectQuery("SELECT @@global.gtid_binlog_pos").WillReturnRows(
+		sqlmock.NewRows([]string{"@@global.gtid_binlog_pos"}).AddRow("0-1-2"))
+	pos, err = readChunkBinlogPos(tctx, conn, ServerTypeMariaDB)
+	c.Assert(err, IsNil)
+	c.Assert(pos, DeepEquals, &chunkBinlogPos{File: "mariadb-bin.000016", Pos: "475", GTID: "0-1-2"})
+
+	// the binlog is disabled
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}))
+	pos, err = readChunkBinlogPos(tctx, conn, ServerTypeMySQL)
+	c.Assert(err, IsNil)
+	c.Assert(pos, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testWriterSuite) TestWriteTableDataWithChunkBinlogPos(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = c.MkDir()
+	config.ChunkMetadata = true
+	config.PerChunkBinlogPos = true
+	config.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	extStore, err := config.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	writer := NewWriter(tcontext.Background(), 0, config, conn, extStore)
+
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+			AddRow("ON.000001", "7502", "", "", ""))
+	data := [][]driver.Value{{"1", "bob"}, {"2", "sarah"}}
+	tableIR := newMockTableIR("test", "employee", data, nil, []string{"INT", "VARCHAR"})
+	tableIR.colNames = []string{"id", "name"}
+	c.Assert(writer.writeTableData(tableIR, tableIR, 0, "id"), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	bytes, err := ioutil.ReadFile(path.Join(config.OutputDirPath, "test.employee.000000000.sql.meta"))
+	c.Assert(err, IsNil)
+	c.Assert(string(bytes), Equals, `{"file":"test.employee.000000000.sql","chunk_index":0,"rows":2,"column":"id","min":"1","max":"2",`+
+		`"binlog_pos":{"file":"ON.000001","pos":"7502"}}`)
+}
+
+func (s *testSQLSuite) TestCheckPerChunkBinlogPos(c *C) {
+	conf := defaultConfigForTest(c)
+	d := &Dumper{conf: conf}
+	c.Assert(checkPerChunkBinlogPos(d), IsNil)
+
+	conf.PerChunkBinlogPos = true
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeTiDB}
+	conf.Consistency = consistencyTypeAuto
+	c.Assert(resolveAutoConsistency(d), IsNil)
+	c.Assert(checkPerChunkBinlogPos(d), ErrorMatches, "config.PerChunkBinlogPos can't be used with the snapshot consistency.*")
+	conf.Consistency = consistencyTypeNone
+	c.Assert(checkPerChunkBinlogPos(d), IsNil)
+	conf.ServerInfo = ServerInfoUnknown
+	c.Assert(checkPerChunkBinlogPos(d), ErrorMatches, "config.PerChunkBinlogPos doesn't support the server type .*")
+}
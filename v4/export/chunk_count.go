@@ -0,0 +1,327 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/summary"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultVerifyChunkCountRetries = 3
+
+	// redumpedTablesUnit is the name of the tables dumped again because of the missing chunks in the summary
+	redumpedTablesUnit = "tables dumped again for chunk count mismatch"
+)
+
+// tableChunkCount is the chunks planned and written of a table
+type tableChunkCount struct {
+	// total is the planned number of chunks, it's 0 if no chunk is sent to the writers yet
+	total   int
+	written map[int]struct{}
+	// files and stats are what the written chunks contribute to the output, they are reverted to dump the table again
+	files  []string
+	stats  tableChunkStats
+	chunks int
+}
+
+// chunkCountMismatch is a table whose written chunks don't match the planned ones
+type chunkCountMismatch struct {
+	meta    TableMeta
+	planned int
+	written int
+}
+
+// chunkCountRecorder records the chunks planned and written of the tables dumped by dumpTableData,
+// so the tables missing chunks can be dumped again with Config.VerifyChunkCount
+type chunkCountRecorder struct {
+	mu     sync.Mutex
+	tables map[TableMeta]*tableChunkCount
+	// metas are the tables in the order they are dumped
+	metas []TableMeta
+}
+
+func newChunkCountRecorder() *chunkCountRecorder {
+	return &chunkCountRecorder{tables: make(map[TableMeta]*tableChunkCount)}
+}
+
+// register starts recording the chunks of meta, the chunks of the tables not registered are ignored
+func (r *chunkCountRecorder) register(meta TableMeta) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tables[meta]; !ok {
+		r.metas = append(r.metas, meta)
+	}
+	r.tables[meta] = &tableChunkCount{written: make(map[int]struct{})}
+}
+
+func (r *chunkCountRecorder) table(meta TableMeta) *tableChunkCount {
+	if r == nil {
+		return nil
+	}
+	return r.tables[meta]
+}
+
+// plan records the planned number of chunks of the table of task when it's sent to the writers
+func (r *chunkCountRecorder) plan(task *TaskTableData) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t := r.table(task.Meta); t != nil {
+		t.total = task.TotalChunks
+	}
+}
+
+// written records the chunk of task is written successfully
+func (r *chunkCountRecorder) written(task *TaskTableData) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t := r.table(task.Meta); t != nil {
+		t.written[task.ChunkIndex] = struct{}{}
+	}
+}
+
+// addFile records a data file written of meta
+func (r *chunkCountRecorder) addFile(meta TableMeta, file string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t := r.table(meta); t != nil {
+		t.files = append(t.files, file)
+	}
+}
+
+// addStats records the statistics of a chunk or a sub-chunk written of meta
+func (r *chunkCountRecorder) addStats(meta TableMeta, chunk tableChunkStats) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t := r.table(meta); t != nil {
+		t.stats.rows += chunk.rows
+		t.stats.bytes += chunk.bytes
+		t.stats.checksum += chunk.checksum
+		t.chunks++
+	}
+}
+
+// mismatches returns the tables whose written chunks don't match the planned ones in the order they are dumped
+func (r *chunkCountRecorder) mismatches() []chunkCountMismatch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []chunkCountMismatch
+	for _, meta := range r.metas {
+		t := r.tables[meta]
+		if t.total == 0 {
+			continue
+		}
+		written := len(t.written)
+		for idx := range t.written {
+			if idx < 0 || idx >= t.total {
+				// a chunk out of the plan is written, the count alone can't tell whether the planned ones are all written
+				written = -1
+				break
+			}
+		}
+		if written != t.total {
+			result = append(result, chunkCountMismatch{meta: meta, planned: t.total, written: written})
+		}
+	}
+	return result
+}
+
+// reset forgets the chunks written of meta, it returns what they contribute to the output
+func (r *chunkCountRecorder) reset(meta TableMeta) tableChunkCount {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.tables[meta]
+	r.tables[meta] = &tableChunkCount{written: make(map[int]struct{})}
+	return *t
+}
+
+// subtract reverts the chunks added of the table
+func (s *tableStatsCollector) subtract(db, table string, chunk tableChunkStats, chunks int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result, ok := s.tables[db][table]
+	if !ok {
+		return
+	}
+	result.Rows -= chunk.rows
+	result.Bytes -= chunk.bytes
+	result.CompressedBytes -= chunk.compressedBytes
+	result.Checksum -= chunk.checksum
+	result.Chunks -= chunks
+	if result.Chunks <= 0 {
+		delete(s.tables[db], table)
+	}
+}
+
+// removeFiles forgets the data files of the table and their key ranges
+func (r *catalogRecorder) removeFiles(db, table string, files []string) {
+	if r == nil || len(files) == 0 {
+		return
+	}
+	removed := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		removed[file] = struct{}{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tables[db][table]
+	if !ok {
+		return
+	}
+	kept := t.Files[:0]
+	for _, file := range t.Files {
+		if _, ok := removed[file]; !ok {
+			kept = append(kept, file)
+		}
+	}
+	t.Files = kept
+	keptRanges := t.KeyRanges[:0]
+	for _, keyRange := range t.KeyRanges {
+		if _, ok := removed[keyRange.File]; !ok {
+			keptRanges = append(keptRanges, keyRange)
+		}
+	}
+	t.KeyRanges = keptRanges
+}
+
+// remove forgets the rows and the samples of meta
+func (r *verificationRecorder) remove(meta TableMeta) {
+	if r == nil {
+		return
+	}
+	var columnGroup string
+	if tm, ok := meta.(*tableMeta); ok {
+		columnGroup = tm.columnGroup
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tables, [3]string{meta.DatabaseName(), meta.TableName(), columnGroup})
+}
+
+// deleteOutputFile deletes a file written into the output. It returns false if the storage can't delete files.
+func (d *Dumper) deleteOutputFile(tctx *tcontext.Context, name string) (bool, error) {
+	if deleter, ok := d.extStore.(fileDeleter); ok {
+		return true, deleter.DeleteFile(tctx, name)
+	}
+	dir, err := localOutputDir(d.conf)
+	if err != nil || dir == "" {
+		return false, err
+	}
+	if err = os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+		return true, err
+	}
+	return true, nil
+}
+
+// revertTableChunks forgets the chunks written of meta and deletes their files, so the table can be dumped again.
+// The files left because they can't be deleted are overwritten if the same chunks are written again.
+func (d *Dumper) revertTableChunks(tctx *tcontext.Context, meta TableMeta) {
+	db, tbl := meta.DatabaseName(), meta.TableName()
+	t := d.chunkCounts.reset(meta)
+	d.tableStats.subtract(db, tbl, t.stats, t.chunks)
+	d.catalog.removeFiles(db, tbl, t.files)
+	d.verification.remove(meta)
+	files := t.files
+	if d.conf.ChunkMetadata {
+		for _, file := range t.files {
+			files = append(files, file+chunkMetadataSuffix)
+		}
+	}
+	for _, file := range files {
+		deleted, err := d.deleteOutputFile(tctx, file)
+		if err != nil {
+			tctx.L().Warn("fail to delete the file of the table to dump again", zap.String("file", file), zap.Error(err))
+			continue
+		}
+		if !deleted {
+			tctx.L().Info("the files of the table to dump again are left since the storage can't delete them",
+				zap.String("database", db), zap.String("table", tbl))
+			break
+		}
+		d.checksums.forget(file)
+		d.sizes.forget(file)
+		d.zstdDict.forget(file)
+	}
+}
+
+// redumpMismatchedTables dumps the tables whose written chunks don't match the planned ones again from scratch
+// until all of them match or Config.VerifyChunkCountRetries is reached
+func (d *Dumper) redumpMismatchedTables(tctx *tcontext.Context, metaConn *sql.Conn,
+	rebuildConnFn func(*sql.Conn) (*sql.Conn, error), newConnFn func() (*sql.Conn, error)) error {
+	conf := d.conf
+	for retry := 0; ; retry++ {
+		mismatches := d.chunkCounts.mismatches()
+		if len(mismatches) == 0 {
+			return nil
+		}
+		for _, m := range mismatches {
+			tctx.L().Warn("the chunks written of the table don't match the planned ones",
+				zap.String("database", m.meta.DatabaseName()), zap.String("table", m.meta.TableName()),
+				zap.Int("planned chunks", m.planned), zap.Int("written chunks", m.written), zap.Int("retry", retry))
+		}
+		first := mismatches[0]
+		if retry >= conf.VerifyChunkCountRetries {
+			return errors.Errorf("the chunks written of %d tables don't match the planned ones after %d retries, "+
+				"e.g. table `%s`.`%s` plans %d chunks but %d are written", len(mismatches), retry,
+				first.meta.DatabaseName(), first.meta.TableName(), first.planned, first.written)
+		}
+		if !canRebuildConn(conf.Consistency, conf.TransactionalConsistency) {
+			return errors.Errorf("the chunks written of table `%s`.`%s` don't match the planned ones, "+
+				"but the tables can't be dumped again consistently with consistency %s", first.meta.DatabaseName(),
+				first.meta.TableName(), conf.Consistency)
+		}
+		for _, m := range mismatches {
+			d.revertTableChunks(tctx, m.meta)
+		}
+		summary.CollectSuccessUnit(redumpedTablesUnit, 1, uint64(len(mismatches)))
+
+		taskChan := make(chan Task, defaultDumpThreads)
+		wg, writingCtx := errgroup.WithContext(tctx)
+		writerCtx := tctx.WithContext(writingCtx)
+		_, tearDownWriters, err := d.startWriters(writerCtx, wg, taskChan, rebuildConnFn, newConnFn)
+		if err != nil {
+			return err
+		}
+		for _, m := range mismatches {
+			if err = d.dumpTableData(writerCtx, metaConn, m.meta, taskChan); err != nil {
+				break
+			}
+		}
+		close(taskChan)
+		if wgErr := wg.Wait(); wgErr != nil && (err == nil || errors.ErrorEqual(err, context.Canceled)) {
+			err = wgErr
+		}
+		tearDownWriters()
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestChunkCountMismatches(c *C) {
+	r := newChunkCountRecorder()
+	complete := &tableMeta{database: "test", table: "complete"}
+	missing := &tableMeta{database: "test", table: "missing"}
+	ignored := &tableMeta{database: "test", table: "ignored"}
+	r.register(complete)
+	r.register(missing)
+	for i := 0; i < 3; i++ {
+		r.plan(NewTaskTableData(complete, nil, i, 3))
+		r.plan(NewTaskTableData(missing, nil, i, 3))
+		r.plan(NewTaskTableData(ignored, nil, i, 3))
+		r.written(NewTaskTableData(complete, nil, i, 3))
+		r.written(NewTaskTableData(ignored, nil, i, 3))
+	}
+	r.written(NewTaskTableData(missing, nil, 0, 3))
+	// a chunk written twice by the sub-chunks is counted once
+	r.written(NewTaskTableData(missing, nil, 0, 3))
+	r.written(NewTaskTableData(missing, nil, 2, 3))
+	c.Assert(r.mismatches(), DeepEquals, []chunkCountMismatch{{meta: missing, planned: 3, written: 2}})
+
+	r.written(NewTaskTableData(missing, nil, 1, 3))
+	c.Assert(r.mismatches(), HasLen, 0)
+}
+
+func (s *testUtilSuite) TestRevertTableChunks(c *C) {
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.OutputDirPath = c.MkDir()
+	d := &Dumper{
+		tctx:        tctx,
+		conf:        conf,
+		tableStats:  newTableStatsCollector(),
+		catalog:     newCatalogRecorder(),
+		chunkCounts: newChunkCountRecorder(),
+	}
+	meta := &tableMeta{database: "test", table: "t"}
+	d.chunkCounts.register(meta)
+	for _, file := range []string{"test.t.000000000.sql", "test.t.000000001.sql"} {
+		c.Assert(ioutil.WriteFile(path.Join(conf.OutputDirPath, file), []byte("INSERT"), 0o644), IsNil)
+		d.catalog.addFile("test", "t", file)
+		d.chunkCounts.addFile(meta, file)
+		d.tableStats.add("test", "t", tableChunkStats{rows: 10, bytes: 100})
+		d.chunkCounts.addStats(meta, tableChunkStats{rows: 10, bytes: 100})
+	}
+	// the stats of the other column groups of the table are kept
+	d.tableStats.add("test", "t", tableChunkStats{rows: 10, bytes: 50})
+
+	d.revertTableChunks(tctx, meta)
+	results := d.tableStats.results()
+	c.Assert(results, HasLen, 1)
+	c.Assert(results[0].Rows, Equals, uint64(10))
+	c.Assert(results[0].Bytes, Equals, uint64(50))
+	c.Assert(results[0].Chunks, Equals, 1)
+	c.Assert(d.catalog.table("test", "t").Files, HasLen, 0)
+	_, err := os.Stat(path.Join(conf.OutputDirPath, "test.t.000000000.sql"))
+	c.Assert(os.IsNotExist(err), IsTrue)
+	c.Assert(d.chunkCounts.reset(meta).files, HasLen, 0)
+}
+
+func (s *testUtilSuite) TestRedumpMismatchedTablesFails(c *C) {
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.VerifyChunkCount = true
+	d := &Dumper{tctx: tctx, conf: conf, chunkCounts: newChunkCountRecorder()}
+	meta := &tableMeta{database: "test", table: "t"}
+	d.chunkCounts.register(meta)
+	d.chunkCounts.plan(NewTaskTableData(meta, nil, 1, 2))
+	d.chunkCounts.written(NewTaskTableData(meta, nil, 1, 2))
+
+	conf.Consistency = consistencyTypeFlush
+	conf.TransactionalConsistency = true
+	err := d.redumpMismatchedTables(tctx, nil, nil, nil)
+	c.Assert(err, ErrorMatches, "the chunks written of table `test`.`t` don't match the planned ones, "+
+		"but the tables can't be dumped again consistently with consistency flush")
+
+	conf.VerifyChunkCountRetries = 0
+	err = d.redumpMismatchedTables(tctx, nil, nil, nil)
+	c.Assert(err, ErrorMatches, "the chunks written of 1 tables don't match the planned ones after 0 retries, "+
+		"e.g. table `test`.`t` plans 2 chunks but 1 are written")
+}
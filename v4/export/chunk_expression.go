@@ -0,0 +1,54 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// ParseChunkExpressions parses the expressions to split the tables into chunks by in the format of `db.table:expr`
+// into database -> table -> expression
+func ParseChunkExpressions(specs []string) (map[string]map[string]string, error) {
+	result := make(map[string]map[string]string)
+	for _, spec := range specs {
+		tablePart, expr, ok := cutString(spec, ":")
+		if !ok {
+			return nil, errors.Errorf("chunk expression `%s` should be in the format of db.table:expr", spec)
+		}
+		db, tbl, ok := cutString(strings.TrimSpace(tablePart), ".")
+		if !ok || db == "" || tbl == "" {
+			return nil, errors.Errorf("chunk expression `%s` only accepts qualified table names", spec)
+		}
+		if _, ok := result[db][tbl]; ok {
+			return nil, errors.Errorf("chunk expression of table `%s`.`%s` is specified more than once", db, tbl)
+		}
+		if expr = strings.TrimSpace(expr); expr == "" {
+			return nil, errors.Errorf("no chunk expression is specified for table `%s`.`%s`", db, tbl)
+		}
+		if _, ok := result[db]; !ok {
+			result[db] = make(map[string]string)
+		}
+		result[db][tbl] = expr
+	}
+	return result, nil
+}
+
+// checkChunkExpression checks the chunk expression of the table returns an integer
+func checkChunkExpression(conn *sql.Conn, db, tbl, expr string) error {
+	colTypes, err := GetColumnTypes(conn, "("+expr+")", db, tbl)
+	if err != nil {
+		return errors.Annotatef(err, "invalid chunk expression `%s` of table `%s`.`%s`", expr, db, tbl)
+	}
+	if len(colTypes) != 1 {
+		return errors.Errorf("chunk expression `%s` of table `%s`.`%s` should return one value", expr, db, tbl)
+	}
+	tp := strings.TrimPrefix(colTypes[0].DatabaseTypeName(), "UNSIGNED ")
+	switch tp {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		return nil
+	}
+	return errors.Errorf("chunk expression `%s` of table `%s`.`%s` should return an integer, but it returns %s", expr, db, tbl, tp)
+}
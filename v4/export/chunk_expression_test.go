@@ -0,0 +1,81 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"regexp"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestParseChunkExpressions(c *C) {
+	exprs, err := ParseChunkExpressions([]string{"db.t1: id DIV 1000000 ", "db.t2:YEAR(created_at)", "db2.t:a:b"})
+	c.Assert(err, IsNil)
+	c.Assert(exprs, DeepEquals, map[string]map[string]string{
+		"db":  {"t1": "id DIV 1000000", "t2": "YEAR(created_at)"},
+		"db2": {"t": "a:b"},
+	})
+
+	_, err = ParseChunkExpressions([]string{"db.t"})
+	c.Assert(err, ErrorMatches, "chunk expression `db.t` should be in the format of db.table:expr")
+	_, err = ParseChunkExpressions([]string{"t:id"})
+	c.Assert(err, ErrorMatches, "chunk expression `t:id` only accepts qualified table names")
+	_, err = ParseChunkExpressions([]string{"db.t: "})
+	c.Assert(err, ErrorMatches, "no chunk expression is specified for table `db`.`t`")
+	_, err = ParseChunkExpressions([]string{"db.t:id", "db.t:id DIV 2"})
+	c.Assert(err, ErrorMatches, "chunk expression of table `db`.`t` is specified more than once")
+}
+
+func (s *testSQLSuite) TestConcurrentDumpTableWithChunkExpression(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.Rows = 10
+	conf.SkipEstimate = true
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	conf.ChunkExpressions = map[string]map[string]string{"test": {"t": "id DIV 10"}}
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "test", table: "t"}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT (id DIV 10) FROM `test`.`t` LIMIT 1")).
+		WillReturnRows(mock.NewRowsWithColumnDefinition(mock.NewColumn("(id DIV 10)").OfType("BIGINT", 0)))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT MIN((id DIV 10)),MAX((id DIV 10)) FROM `test`.`t`")).
+		WillReturnRows(sqlmock.NewRows([]string{"MIN", "MAX"}).AddRow(0, 19))
+	mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("id", ""))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+
+	taskChan := make(chan Task, 16)
+	c.Assert(d.concurrentDumpTable(tctx, conn, meta, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	var tasks []*TaskTableData
+	for task := range taskChan {
+		tasks = append(tasks, task.(*TaskTableData))
+	}
+	c.Assert(tasks, HasLen, 2)
+	c.Assert(tasks[0].Data.(*tableData).query, Equals,
+		"SELECT * FROM `test`.`t` WHERE (((id DIV 10) IS NULL OR ((id DIV 10) >= 0 AND (id DIV 10) < 10))) ORDER BY `id`")
+	c.Assert(tasks[1].Data.(*tableData).query, Equals,
+		"SELECT * FROM `test`.`t` WHERE (((id DIV 10) >= 10 AND (id DIV 10) < 20)) ORDER BY `id`")
+	// the expression isn't a column of the table
+	c.Assert(tasks[0].ChunkField, Equals, "")
+	c.Assert(tasks[0].keyColumns, DeepEquals, []string{"id DIV 10"})
+
+	// the expression should return an integer
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT (id DIV 10) FROM `test`.`t` LIMIT 1")).
+		WillReturnRows(mock.NewRowsWithColumnDefinition(mock.NewColumn("(id DIV 10)").OfType("DECIMAL", 0)))
+	err = d.concurrentDumpTable(tctx, conn, meta, make(chan Task, 16))
+	c.Assert(err, ErrorMatches, "chunk expression `id DIV 10` of table `test`.`t` should return an integer, but it returns DECIMAL")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
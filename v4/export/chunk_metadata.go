@@ -0,0 +1,130 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"math/big"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+const chunkMetadataSuffix = ".meta"
+
+// chunkMetadata is written to a `.meta` sidecar of each data file when Config.ChunkMetadata is set,
+// so that the loader can verify each file independently and detect gaps/overlaps between chunks.
+type chunkMetadata struct {
+	File       string `json:"file"`
+	ChunkIndex int    `json:"chunk_index"`
+	Rows       uint64 `json:"rows"`
+	// UncompressedSize is the size of the file before compression, it's absent when the file isn't compressed
+	UncompressedSize uint64 `json:"uncompressed_size,omitempty"`
+	// Column is the chunk boundary column, it's empty when the table isn't split into chunks.
+	Column string `json:"column,omitempty"`
+	// Min and Max are the observed values of Column, they are absent when Column isn't dumped
+	// (for example `_tidb_rowid`) or all values of Column are NULL.
+	Min *string `json:"min,omitempty"`
+	Max *string `json:"max,omitempty"`
+	// BinlogPos is the binlog position before the chunk is read with Config.PerChunkBinlogPos
+	BinlogPos *chunkBinlogPos `json:"binlog_pos,omitempty"`
+}
+
+func (m *chunkMetadata) observe(value sql.RawBytes) {
+	if value == nil {
+		return
+	}
+	if m.Min == nil || compareChunkValues(value, *m.Min) < 0 {
+		v := string(value)
+		m.Min = &v
+	}
+	if m.Max == nil || compareChunkValues(value, *m.Max) > 0 {
+		v := string(value)
+		m.Max = &v
+	}
+}
+
+func (m *chunkMetadata) write(tctx *tcontext.Context, s storage.ExternalStorage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.WriteFile(tctx, m.File+chunkMetadataSuffix, data))
+}
+
+// compareChunkValues compares a and b as integers if both of them are integers, otherwise compares them bytewise.
+func compareChunkValues(a sql.RawBytes, b string) int {
+	x, okX := new(big.Int).SetString(string(a), 10)
+	y, okY := new(big.Int).SetString(b, 10)
+	if okX && okY {
+		return x.Cmp(y)
+	}
+	return bytes.Compare(a, []byte(b))
+}
+
+// chunkMetadataIR observes the values of the chunk boundary column when the rows are decoded.
+type chunkMetadataIR struct {
+	TableDataIR
+	colIdx int
+	meta   *chunkMetadata
+}
+
+func newChunkMetadataIR(ir TableDataIR, meta TableMeta, chunkField string) *chunkMetadataIR {
+	colIdx := -1
+	for i, col := range meta.ColumnNames() {
+		if chunkField != "" && col == chunkField {
+			colIdx = i
+			break
+		}
+	}
+	return &chunkMetadataIR{TableDataIR: ir, colIdx: colIdx}
+}
+
+// reset starts collecting the metadata of a new data file
+func (c *chunkMetadataIR) reset(meta *chunkMetadata) {
+	c.meta = meta
+}
+
+// Rows implements TableDataIR.Rows
+func (c *chunkMetadataIR) Rows() SQLRowIter {
+	return &chunkMetadataRowIter{SQLRowIter: c.TableDataIR.Rows(), ir: c}
+}
+
+type chunkMetadataRowIter struct {
+	SQLRowIter
+	ir *chunkMetadataIR
+}
+
+// Decode implements SQLRowIter.Decode
+func (it *chunkMetadataRowIter) Decode(row RowReceiver) error {
+	if err := it.SQLRowIter.Decode(row); err != nil {
+		return err
+	}
+	arr, ok := row.(RowReceiverArr)
+	if it.ir.colIdx < 0 || !ok || it.ir.colIdx >= len(arr.receivers) {
+		return nil
+	}
+	it.ir.meta.observe(receiverRawBytes(arr.receivers[it.ir.colIdx]))
+	return nil
+}
+
+func receiverRawBytes(receiver RowReceiverStringer) sql.RawBytes {
+	switch r := receiver.(type) {
+	case *SQLTypeNumber:
+		return r.RawBytes
+	case *SQLTypeString:
+		return r.RawBytes
+	case *SQLTypeClientSafeString:
+		return r.RawBytes
+	case *SQLTypeBytes:
+		return r.RawBytes
+	case *SQLTypeBinaryString:
+		return r.RawBytes
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+const (
+	// sizeChunkSampleRows is the number of the rows sampled to estimate the average row length of a table
+	// whose AVG_ROW_LENGTH isn't available, e.g. before it's analyzed
+	sizeChunkSampleRows = 1000
+	// defaultSizeChunkRows is the rows of each chunk if the average row length of the table can't be estimated
+	defaultSizeChunkRows = 200000
+	// sizeChunkFileSizeFactor is how many times the size of a chunk split by Config.FileSize can exceed it
+	// before the chunk is rotated into another file. The chunks are only split by an estimate, so a chunk
+	// slightly larger than the estimate isn't split again into a full file and a tiny one.
+	sizeChunkFileSizeFactor = 2
+)
+
+// chunkRowsOf returns the rows of each chunk to split the table into. With Config.ChunkByFileSize, they're
+// estimated by the average row length of the table, so each chunk is about Config.FileSize bytes.
+func (d *Dumper) chunkRowsOf(tctx *tcontext.Context, conn *sql.Conn, db, tbl string) uint64 {
+	conf := d.conf
+	if _, ok := conf.TableRows[db][tbl]; ok || !conf.ChunkByFileSize {
+		return conf.rowsOf(db, tbl)
+	}
+	avgRowLength, err := GetAVGRowLength(tctx, conn, db, tbl)
+	if err != nil || avgRowLength == 0 {
+		tctx.L().Debug("fail to get average row length, sample the rows instead",
+			zap.String("database", db), zap.String("table", tbl), zap.Error(err))
+		avgRowLength, err = sampleAVGRowLength(conn, conf, db, tbl)
+	}
+	if err != nil || avgRowLength == 0 {
+		tctx.L().Warn("fail to estimate average row length, use the default rows of each chunk",
+			zap.String("database", db), zap.String("table", tbl),
+			zap.Uint64("rows", defaultSizeChunkRows), zap.Error(err))
+		return defaultSizeChunkRows
+	}
+	rows := conf.FileSize / avgRowLength
+	if rows == 0 {
+		rows = 1
+	}
+	tctx.L().Info("split table into chunks by file size",
+		zap.String("database", db), zap.String("table", tbl),
+		zap.Uint64("average row length", avgRowLength), zap.Uint64("rows", rows))
+	return rows
+}
+
+// sampleAVGRowLength estimates the average row length of the table by the bytes of at most sizeChunkSampleRows rows
+func sampleAVGRowLength(conn *sql.Conn, conf *Config, db, tbl string) (uint64, error) {
+	query := fmt.Sprintf("SELECT * FROM `%s`.`%s`", escapeString(db), escapeString(tbl))
+	if conf.Where != "" {
+		query += " WHERE " + conf.Where
+	}
+	query += fmt.Sprintf(" LIMIT %d", sizeChunkSampleRows)
+	rows, err := conn.QueryContext(context.Background(), query)
+	if err != nil {
+		return 0, errors.Annotatef(err, "sql: %s", query)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, errors.Annotatef(err, "sql: %s", query)
+	}
+	values := make([]sql.RawBytes, len(cols))
+	args := make([]interface{}, len(cols))
+	for i := range values {
+		args[i] = &values[i]
+	}
+	var count, bytes uint64
+	for rows.Next() {
+		if err = rows.Scan(args...); err != nil {
+			return 0, errors.Annotatef(err, "sql: %s", query)
+		}
+		for _, v := range values {
+			bytes += uint64(len(v))
+		}
+		count++
+	}
+	if err = rows.Err(); err != nil {
+		return 0, errors.Annotatef(err, "sql: %s", query)
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	return bytes / count, nil
+}
+
+// fileSizeOf returns the size to rotate the files of a chunk of the table at
+func (conf *Config) fileSizeOf(db, tbl string) uint64 {
+	if _, ok := conf.TableRows[db][tbl]; ok || !conf.ChunkByFileSize {
+		return conf.FileSize
+	}
+	return conf.FileSize * sizeChunkFileSizeFactor
+}
+
+// adjustChunkByFileSize checks the size of each chunk is specified with conf.ChunkByFileSize
+func adjustChunkByFileSize(conf *Config) error {
+	if !conf.ChunkByFileSize {
+		return nil
+	}
+	if conf.FileSize == UnspecifiedSize {
+		return errors.New("config.ChunkByFileSize requires --filesize as the size of each chunk")
+	}
+	if conf.Rows != UnspecifiedSize {
+		return errors.New("config.ChunkByFileSize can't be used with --rows, use --table-rows to split some tables by rows")
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+const avgRowLengthQuery = "select AVG_ROW_LENGTH from INFORMATION_SCHEMA.TABLES where table_schema=\\? and table_name=\\?;"
+
+func (s *testSQLSuite) TestChunkRowsOf(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.Rows = 1000
+	conf.TableRows = map[string]map[string]uint64{"test": {"t2": 10}}
+	d := &Dumper{tctx: tctx, conf: conf}
+	c.Assert(d.chunkRowsOf(tctx, conn, "test", "t"), Equals, uint64(1000))
+
+	conf.Rows = UnspecifiedSize
+	conf.ChunkByFileSize = true
+	conf.FileSize = 64 << 20
+	// the tables in conf.TableRows are still split by rows
+	c.Assert(d.chunkRowsOf(tctx, conn, "test", "t2"), Equals, uint64(10))
+
+	mock.ExpectQuery(avgRowLengthQuery).WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"AVG_ROW_LENGTH"}).AddRow(1 << 20))
+	c.Assert(d.chunkRowsOf(tctx, conn, "test", "t"), Equals, uint64(64))
+
+	// the rows are sampled before the table is analyzed
+	mock.ExpectQuery(avgRowLengthQuery).WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"AVG_ROW_LENGTH"}).AddRow(0))
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t` LIMIT 1000").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "b"}).
+			AddRow("1", strings.Repeat("x", 4<<20-1)).
+			AddRow("2", strings.Repeat("x", 2<<20-1)))
+	c.Assert(d.chunkRowsOf(tctx, conn, "test", "t"), Equals, uint64(21))
+
+	// the rows of a chunk aren't 0 even if a row is larger than the file size
+	mock.ExpectQuery(avgRowLengthQuery).WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"AVG_ROW_LENGTH"}).AddRow(128 << 20))
+	c.Assert(d.chunkRowsOf(tctx, conn, "test", "t"), Equals, uint64(1))
+
+	// fall back to the default rows if the average row length can't be estimated
+	conf.Where = "id < 10"
+	mock.ExpectQuery(avgRowLengthQuery).WithArgs("test", "t").WillReturnError(errors.New("no privilege"))
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t` WHERE id < 10 LIMIT 1000").WillReturnError(errors.New("no privilege"))
+	c.Assert(d.chunkRowsOf(tctx, conn, "test", "t"), Equals, uint64(defaultSizeChunkRows))
+	mock.ExpectQuery(avgRowLengthQuery).WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"AVG_ROW_LENGTH"}).AddRow(0))
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t` WHERE id < 10 LIMIT 1000").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	c.Assert(d.chunkRowsOf(tctx, conn, "test", "t"), Equals, uint64(defaultSizeChunkRows))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testSQLSuite) TestConcurrentDumpTableByFileSize(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	const (
+		blobSize = 32 << 10
+		fileSize = 256 << 10
+		rowCount = 96
+	)
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.FileType = FileFormatCSVString
+	c.Assert(adjustFileFormat(conf), IsNil)
+	conf.FileSize = fileSize
+	conf.ChunkByFileSize = true
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	c.Assert(adjustChunkByFileSize(conf), IsNil)
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "test", table: "t"}
+
+	mock.ExpectQuery(avgRowLengthQuery).WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"AVG_ROW_LENGTH"}).AddRow(blobSize))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.columns").WithArgs("test", "t", "PRI").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+	mock.ExpectQuery("SELECT MIN\\(`id`\\),MAX\\(`id`\\) FROM `test`.`t`").
+		WillReturnRows(sqlmock.NewRows([]string{"MIN", "MAX"}).AddRow(1, rowCount))
+	mock.ExpectQuery("EXPLAIN SELECT `id` FROM `test`.`t`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "rows"}).AddRow("1", rowCount))
+	mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("id", "").AddRow("b", ""))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+
+	taskChan := make(chan Task, rowCount)
+	c.Assert(d.concurrentDumpTable(tctx, conn, meta, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// write the BLOB rows of each chunk, which are in the range of its key
+	extStore, err := conf.createExternalStorage(tctx)
+	c.Assert(err, IsNil)
+	writer := NewWriter(tctx, 0, conf, conn, extStore)
+	blob := strings.Repeat("b", blobSize)
+	chunks := 0
+	for task := range taskChan {
+		td := task.(*TaskTableData)
+		lower, upper := td.keyRange.lower.Int64(), td.keyRange.upper.Int64()
+		var data [][]driver.Value
+		for id := lower; id < upper && id <= rowCount; id++ {
+			data = append(data, []driver.Value{id, blob})
+		}
+		tableIR := newMockTableIR("test", "t", data, nil, []string{"INT", "BLOB"})
+		c.Assert(writer.WriteTableData(tableIR, tableIR, td.ChunkIndex), IsNil)
+		chunks++
+	}
+	c.Assert(chunks, Equals, rowCount/(fileSize/blobSize))
+
+	// every chunk is written into one file of about conf.FileSize bytes
+	files, err := ioutil.ReadDir(conf.OutputDirPath)
+	c.Assert(err, IsNil)
+	var dataFiles int
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "test.t.") {
+			continue
+		}
+		dataFiles++
+		c.Assert(file.Size(), Greater, int64(fileSize*3/4), Commentf("file %s", file.Name()))
+		c.Assert(file.Size(), Less, int64(fileSize*5/4), Commentf("file %s", file.Name()))
+	}
+	c.Assert(dataFiles, Equals, chunks)
+}
+
+func (s *testConfigSuite) TestAdjustChunkByFileSize(c *C) {
+	conf := DefaultConfig()
+	c.Assert(adjustChunkByFileSize(conf), IsNil)
+	conf.ChunkByFileSize = true
+	c.Assert(adjustChunkByFileSize(conf), ErrorMatches, "config.ChunkByFileSize requires --filesize.*")
+	conf.FileSize = 64 << 20
+	c.Assert(adjustChunkByFileSize(conf), IsNil)
+	c.Assert(conf.fileSizeOf("test", "t"), Equals, uint64(128<<20))
+	conf.Rows = 1000
+	c.Assert(adjustChunkByFileSize(conf), ErrorMatches, "config.ChunkByFileSize can't be used with --rows.*")
+}
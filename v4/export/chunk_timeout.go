@@ -0,0 +1,147 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// slowChunkSplits is the number of sub-chunks a chunk is split into if it isn't dumped in Config.ChunkTimeout
+const slowChunkSplits = 4
+
+// chunkKeyRange is the range [lower, upper) of the integer column which the chunk is split by,
+// it's used to split the chunk into smaller sub-chunks
+type chunkKeyRange struct {
+	lower, upper *big.Int
+	// withNull is true if the rows whose column is NULL also belong to the chunk
+	withNull   bool
+	colLen     int
+	buildQuery func(lower, upper *big.Int, withNull bool) string
+}
+
+func (r *chunkKeyRange) query() string {
+	return r.buildQuery(r.lower, r.upper, r.withNull)
+}
+
+// split splits the range into at most n sub-ranges of the same width, it returns nil if the range can't be split
+func (r *chunkKeyRange) split(n int) []*chunkKeyRange {
+	width := new(big.Int).Sub(r.upper, r.lower)
+	if width.Cmp(big.NewInt(1)) <= 0 || n <= 1 {
+		return nil
+	}
+	bigN := big.NewInt(int64(n))
+	if width.Cmp(bigN) < 0 {
+		bigN.Set(width)
+	}
+	// round up, so the last sub-range isn't wider than the others
+	step := new(big.Int).Add(width, new(big.Int).Sub(bigN, big.NewInt(1)))
+	step.Div(step, bigN)
+
+	subRanges := make([]*chunkKeyRange, 0, n)
+	for lower := r.lower; lower.Cmp(r.upper) < 0; {
+		upper := new(big.Int).Add(lower, step)
+		if upper.Cmp(r.upper) > 0 {
+			upper.Set(r.upper)
+		}
+		subRanges = append(subRanges, &chunkKeyRange{
+			lower:      lower,
+			upper:      upper,
+			withNull:   r.withNull && len(subRanges) == 0,
+			colLen:     r.colLen,
+			buildQuery: r.buildQuery,
+		})
+		lower = upper
+	}
+	return subRanges
+}
+
+// canSplitSlowChunk checks whether the chunk can be abandoned and split into sub-chunks if it's too slow.
+// The rows must be able to be re-read by other connections, and a chunk must be written into one file,
+// so the partial file is overwritten by the first sub-chunk.
+func (w *Writer) canSplitSlowChunk(t *TaskTableData) bool {
+	conf := w.conf
+	return conf.ChunkTimeout > 0 && t.keyRange != nil && w.newConnFn != nil &&
+		conf.FileSize == UnspecifiedSize && w.serverSideDumpDir == "" &&
+		canRebuildConn(conf.Consistency, conf.TransactionalConsistency)
+}
+
+// writeChunk writes the data of the chunk. If the chunk isn't written in Config.ChunkTimeout, it's abandoned
+// and its range is dumped in smaller sub-chunks in parallel instead.
+func (w *Writer) writeChunk(t *TaskTableData) error {
+	w.keyColumns, w.keyRange = t.keyColumns, t.keyRange
+	if !w.canSplitSlowChunk(t) {
+		return w.writeTableData(t.Meta, t.Data, t.ChunkIndex, t.ChunkField)
+	}
+	conf := w.conf
+	ctx, cancel := context.WithTimeout(w.tctx, conf.ChunkTimeout)
+	defer cancel()
+	attempt := *w
+	attempt.tctx = w.tctx.WithContext(ctx)
+	err := attempt.writeTableData(t.Meta, t.Data, t.ChunkIndex, t.ChunkField)
+	w.conn = attempt.conn
+	if err == nil || ctx.Err() != context.DeadlineExceeded || w.tctx.Err() != nil {
+		return err
+	}
+	subRanges := t.keyRange.split(slowChunkSplits)
+	if len(subRanges) == 0 {
+		w.tctx.L().Warn("chunk isn't dumped in time and can't be split, dump it without timeout",
+			zap.String("database", t.Meta.DatabaseName()), zap.String("table", t.Meta.TableName()),
+			zap.Int("chunkIdx", t.ChunkIndex))
+		w.conn, err = w.rebuildConnFn(w.conn)
+		if err != nil {
+			return err
+		}
+		return w.writeTableData(t.Meta, newTableData(t.keyRange.query(), t.keyRange.colLen, false), t.ChunkIndex, t.ChunkField)
+	}
+	w.tctx.L().Warn("chunk isn't dumped in time, split it into sub-chunks",
+		zap.String("database", t.Meta.DatabaseName()), zap.String("table", t.Meta.TableName()),
+		zap.Int("chunkIdx", t.ChunkIndex), zap.Duration("timeout", conf.ChunkTimeout),
+		zap.Int("sub-chunks", len(subRanges)))
+	// the query is canceled by closing the connection
+	w.conn, err = w.rebuildConnFn(w.conn)
+	if err != nil {
+		return err
+	}
+	return w.writeSubChunks(t, subRanges)
+}
+
+// writeSubChunks writes the sub-chunks of an abandoned chunk in parallel. The first sub-chunk is written by w
+// into the file of the abandoned chunk, and the others are written by new connections into the files whose
+// indexes are suffixed by the indexes of the sub-chunks.
+func (w *Writer) writeSubChunks(t *TaskTableData, subRanges []*chunkKeyRange) error {
+	g, gctx := errgroup.WithContext(w.tctx)
+	for i, r := range subRanges {
+		i, r := i, r
+		sub := *w
+		sub.tctx = w.tctx.WithContext(gctx)
+		sub.keyRange = r
+		if i > 0 {
+			sub.subChunk = fmt.Sprintf("%04d", i)
+		}
+		g.Go(func() error {
+			if i > 0 {
+				conn, err := w.newConnFn()
+				if conn != nil {
+					sub.conn = conn
+					defer func() {
+						sub.conn.Close()
+					}()
+				}
+				if err != nil {
+					return err
+				}
+			}
+			err := sub.writeTableData(t.Meta, newTableData(r.query(), r.colLen, false), t.ChunkIndex, t.ChunkField)
+			if i == 0 {
+				w.conn = sub.conn
+			}
+			return err
+		})
+	}
+	return g.Wait()
+}
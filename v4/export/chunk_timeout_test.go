@@ -0,0 +1,99 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func testChunkKeyRange(lower, upper int64, withNull bool) *chunkKeyRange {
+	return &chunkKeyRange{
+		lower:    big.NewInt(lower),
+		upper:    big.NewInt(upper),
+		withNull: withNull,
+		colLen:   1,
+		buildQuery: func(lower, upper *big.Int, withNull bool) string {
+			return fmt.Sprintf("SELECT * FROM `test`.`t` WHERE %v `a` >= %d AND `a` < %d", withNull, lower, upper)
+		},
+	}
+}
+
+func (s *testUtilSuite) TestSplitChunkKeyRange(c *C) {
+	testCases := []struct {
+		lower, upper int64
+		n            int
+		expected     [][2]int64
+	}{
+		{0, 8, 4, [][2]int64{{0, 2}, {2, 4}, {4, 6}, {6, 8}}},
+		{0, 10, 4, [][2]int64{{0, 3}, {3, 6}, {6, 9}, {9, 10}}},
+		{-5, -2, 4, [][2]int64{{-5, -4}, {-4, -3}, {-3, -2}}},
+		{0, 1, 4, nil},
+		{0, 8, 1, nil},
+	}
+	for _, tc := range testCases {
+		subRanges := testChunkKeyRange(tc.lower, tc.upper, true).split(tc.n)
+		c.Assert(subRanges, HasLen, len(tc.expected))
+		for i, r := range subRanges {
+			c.Assert(r.lower.Int64(), Equals, tc.expected[i][0])
+			c.Assert(r.upper.Int64(), Equals, tc.expected[i][1])
+			// only the first sub-range contains the NULL values
+			c.Assert(r.withNull, Equals, i == 0)
+		}
+	}
+}
+
+func (s *testWriterSuite) TestWriteSlowChunk(c *C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, IsNil)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.Rows = 10
+	conf.Consistency = consistencyTypeNone
+	conf.ChunkTimeout = 100 * time.Millisecond
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	writer := NewWriter(tcontext.Background().WithLogger(appLogger), 0, conf, conn, extStore)
+	writer.rebuildConnFn = func(conn *sql.Conn) (*sql.Conn, error) {
+		conn.Close()
+		return db.Conn(context.Background())
+	}
+	writer.newConnFn = func() (*sql.Conn, error) {
+		return db.Conn(context.Background())
+	}
+
+	keyRange := testChunkKeyRange(0, 8, true)
+	mock.ExpectQuery(keyRange.query()).WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1))
+	for _, r := range keyRange.split(slowChunkSplits) {
+		mock.ExpectQuery(r.query()).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(r.lower.Int64()))
+	}
+
+	meta := newMockTableIR("test", "t", nil, nil, []string{"INT"})
+	task := NewTaskTableData(meta, newTableData(keyRange.query(), 1, false), 3, 5)
+	task.keyRange = keyRange
+	c.Assert(writer.handleTask(task), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the first sub-chunk is written into the file of the abandoned chunk
+	for i, name := range []string{"test.t.000000003.sql", "test.t.0000000030001.sql", "test.t.0000000030002.sql", "test.t.0000000030003.sql"} {
+		bytes, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, name))
+		c.Assert(err, IsNil)
+		c.Assert(string(bytes), Equals, fmt.Sprintf("INSERT INTO `t` VALUES\n(%d);\n", 2*i))
+	}
+}
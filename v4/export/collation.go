@@ -0,0 +1,132 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// columnTypeRegexp matches the name and the type of a column definition whose quoted literals are hidden,
+// so the character set and collation can be written after it
+var columnTypeRegexp = regexp.MustCompile("^\\s*\x00[0-9]+\x00\\s+\\w+(\\s*\\([^)]*\\))?")
+
+// collationViolation is a collation of a table which isn't in Config.CollationAllowlist
+type collationViolation struct {
+	// column is empty for the default collation of the table
+	column    string
+	collation string
+}
+
+func collationViolationsOf(meta TableMeta) []collationViolation {
+	if tm, ok := meta.(*tableMeta); ok {
+		return tm.collationViolations
+	}
+	return nil
+}
+
+func isAllowedCollation(collation string, allowlist []string) bool {
+	for _, allowed := range allowlist {
+		if strings.EqualFold(collation, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// findCollationViolations returns the default collation of the table and the collations of its columns
+// which aren't in allowlist
+func findCollationViolations(conn *sql.Conn, db, tbl string, allowlist []string) ([]collationViolation, error) {
+	var violations []collationViolation
+	query := "SELECT TABLE_COLLATION FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA=? AND TABLE_NAME=?"
+	var tableCollation sql.NullString
+	if err := conn.QueryRowContext(context.Background(), query, db, tbl).Scan(&tableCollation); err != nil && err != sql.ErrNoRows {
+		return nil, errors.Annotatef(err, "sql: %s", query)
+	}
+	if tableCollation.Valid && !isAllowedCollation(tableCollation.String, allowlist) {
+		violations = append(violations, collationViolation{collation: tableCollation.String})
+	}
+
+	query = "SELECT COLUMN_NAME,COLLATION_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=? AND TABLE_NAME=? AND COLLATION_NAME IS NOT NULL ORDER BY ORDINAL_POSITION"
+	rows, err := conn.QueryContext(context.Background(), query, db, tbl)
+	if err != nil {
+		return nil, errors.Annotatef(err, "sql: %s", query)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var column, collation string
+		if err = rows.Scan(&column, &collation); err != nil {
+			return nil, errors.Annotatef(err, "sql: %s", query)
+		}
+		if !isAllowedCollation(collation, allowlist) {
+			violations = append(violations, collationViolation{column: column, collation: collation})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Annotatef(err, "sql: %s", query)
+	}
+	return violations, nil
+}
+
+// rewriteCollations rewrites the collations of the violations in createTableSQL to collation. The character sets
+// of them are rewritten to the one of collation too. The columns without their own collations follow the table.
+func rewriteCollations(createTableSQL string, violations []collationViolation, collation string) string {
+	// hide the quoted identifiers and strings, so the options in names and comments won't be rewritten
+	var literals []string
+	stmt := quotedLiteralPattern.ReplaceAllStringFunc(createTableSQL, func(literal string) string {
+		literals = append(literals, literal)
+		return fmt.Sprintf("\x00%d\x00", len(literals)-1)
+	})
+	start := strings.IndexByte(stmt, '(')
+	end := closingParenIndex(stmt)
+	if start < 0 || end < 0 {
+		return createTableSQL
+	}
+	charset := collationCharset(collation)
+
+	columns := make(map[string]struct{}, len(violations))
+	rewriteTable := false
+	for _, v := range violations {
+		if v.column == "" {
+			rewriteTable = true
+		} else {
+			columns[wrapBackTicks(escapeString(v.column))] = struct{}{}
+		}
+	}
+	defs := splitDefinitions(stmt[start+1 : end])
+	for i, def := range defs {
+		loc := columnTypeRegexp.FindStringIndex(def)
+		if loc == nil {
+			continue
+		}
+		name := literals[placeholderIndex(placeholderRegexp.FindString(def))]
+		if _, ok := columns[name]; !ok {
+			continue
+		}
+		rest := columnCollateRegexp.ReplaceAllString(columnCharsetRegexp.ReplaceAllString(def[loc[1]:], ""), "")
+		rest = strings.TrimLeft(rest, " ")
+		if rest != "" {
+			rest = " " + rest
+		}
+		defs[i] = def[:loc[1]] + " CHARACTER SET " + charset + " COLLATE " + collation + rest
+	}
+	columnsPart, options := stmt[:start+1]+strings.Join(defs, ",")+"\n"+stmt[end:end+1], stmt[end+1:]
+	if rewriteTable {
+		options = tableCollateRegexp.ReplaceAllString(tableCharsetRegexp.ReplaceAllString(options, ""), "")
+		clause := " DEFAULT CHARSET=" + charset + " COLLATE=" + collation
+		// keep the character set after the engine like `SHOW CREATE TABLE` does
+		pos := 0
+		if loc := tableEngineRegexp.FindStringIndex(options); loc != nil {
+			pos = loc[1]
+		}
+		options = options[:pos] + clause + options[pos:]
+	}
+	return placeholderRegexp.ReplaceAllStringFunc(columnsPart+options, func(placeholder string) string {
+		return literals[placeholderIndex(placeholder)]
+	})
+}
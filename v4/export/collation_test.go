@@ -0,0 +1,66 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestFindCollationViolations(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	mock.ExpectQuery("SELECT TABLE_COLLATION FROM INFORMATION_SCHEMA.TABLES").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_COLLATION"}).AddRow("latin1_swedish_ci"))
+	mock.ExpectQuery("SELECT COLUMN_NAME,COLLATION_NAME FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "COLLATION_NAME"}).
+			AddRow("a", "latin1_swedish_ci").AddRow("b", "utf8mb4_0900_ai_ci").AddRow("c", "utf8_bin"))
+	violations, err := findCollationViolations(conn, "test", "t", []string{"utf8mb4_0900_ai_ci"})
+	c.Assert(err, IsNil)
+	c.Assert(violations, DeepEquals, []collationViolation{
+		{collation: "latin1_swedish_ci"},
+		{column: "a", collation: "latin1_swedish_ci"},
+		{column: "c", collation: "utf8_bin"},
+	})
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testUtilSuite) TestRewriteCollations(c *C) {
+	createTableSQL := "CREATE TABLE `t` (\n" +
+		"  `a` varchar(20) CHARACTER SET latin1 COLLATE latin1_bin NOT NULL COMMENT 'COLLATE x',\n" +
+		"  `b` varchar(20) DEFAULT NULL,\n" +
+		"  `c` enum('x','y') COLLATE utf8_bin,\n" +
+		"  `d` text CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci,\n" +
+		"  PRIMARY KEY (`a`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=latin1 COMMENT='DEFAULT CHARSET=latin1'"
+	violations := []collationViolation{
+		{collation: "latin1_swedish_ci"},
+		{column: "a", collation: "latin1_bin"},
+		{column: "b", collation: "latin1_swedish_ci"},
+		{column: "c", collation: "utf8_bin"},
+	}
+	expected := "CREATE TABLE `t` (\n" +
+		"  `a` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT 'COLLATE x',\n" +
+		"  `b` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci DEFAULT NULL,\n" +
+		"  `c` enum('x','y') CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci,\n" +
+		"  `d` text CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci,\n" +
+		"  PRIMARY KEY (`a`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='DEFAULT CHARSET=latin1'"
+	c.Assert(rewriteCollations(createTableSQL, violations, "utf8mb4_0900_ai_ci"), Equals, expected)
+
+	// only the columns are rewritten if the default collation of the table is allowed
+	expected = "CREATE TABLE `t` (\n" +
+		"  `a` varchar(20) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL COMMENT 'COLLATE x',\n" +
+		"  `b` varchar(20) DEFAULT NULL,\n" +
+		"  `c` enum('x','y') COLLATE utf8_bin,\n" +
+		"  `d` text CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci,\n" +
+		"  PRIMARY KEY (`a`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=latin1 COMMENT='DEFAULT CHARSET=latin1'"
+	c.Assert(rewriteCollations(createTableSQL, violations[1:2], "utf8mb4_0900_ai_ci"), Equals, expected)
+}
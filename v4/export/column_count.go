@@ -0,0 +1,51 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// ColumnCountMismatchFail fails the table whose result has a different number of columns from its column types
+	ColumnCountMismatchFail = "fail"
+	// ColumnCountMismatchRefetch writes the chunk by the column types of its result instead
+	ColumnCountMismatchRefetch = "refetch"
+)
+
+// checkColumnCount checks the number of the columns in the result of ir started against the column types of meta.
+// They differ if a column is added or dropped by DDL after the column types are fetched, then the chunk is written
+// by the column types of the result with Config.ColumnCountMismatch, or it fails instead of scanning the rows wrongly.
+func checkColumnCount(tctx *tcontext.Context, conf *Config, meta TableMeta, ir TableDataIR) (TableMeta, error) {
+	rows := ir.RawRows()
+	if rows == nil {
+		return meta, nil
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return meta, errors.Trace(err)
+	}
+	if uint(len(columns)) == meta.ColumnCount() {
+		return meta, nil
+	}
+	tm, ok := meta.(*tableMeta)
+	td, isTableData := ir.(*tableData)
+	if conf.ColumnCountMismatch != ColumnCountMismatchRefetch || !ok || !isTableData {
+		return meta, errors.Errorf("the result of table `%s`.`%s` has %d columns but %d columns are expected, "+
+			"the columns may be changed by DDL during the dump", meta.DatabaseName(), meta.TableName(), len(columns), meta.ColumnCount())
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return meta, errors.Trace(err)
+	}
+	tctx.L().Warn("the number of columns of table is changed during the dump, write the chunk by the columns of the result",
+		zap.String("database", meta.DatabaseName()), zap.String("table", meta.TableName()),
+		zap.Uint("expected columns", meta.ColumnCount()), zap.Int("actual columns", len(columns)))
+	refetched := *tm
+	refetched.colTypes = colTypes
+	td.colLen = len(columns)
+	return &refetched, nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestWriteTableDataWithColumnAdded(c *C) {
+	for _, mismatch := range []string{ColumnCountMismatchFail, ColumnCountMismatchRefetch} {
+		db, mock, err := sqlmock.New()
+		c.Assert(err, IsNil)
+		conn, err := db.Conn(context.Background())
+		c.Assert(err, IsNil)
+
+		conf := defaultConfigForTest(c)
+		conf.OutputDirPath = c.MkDir()
+		conf.ColumnCountMismatch = mismatch
+		extStore, err := conf.createExternalStorage(context.Background())
+		c.Assert(err, IsNil)
+		writer := NewWriter(tcontext.Background(), 0, conf, conn, extStore)
+
+		mock.ExpectQuery("SELECT \\* FROM `test`.`t` LIMIT 1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+		colTypes, err := GetColumnTypes(conn, "*", "test", "t")
+		c.Assert(err, IsNil)
+		meta := &tableMeta{database: "test", table: "t", colTypes: colTypes, selectedField: "*",
+			specCmts: []string{"/*!40101 SET NAMES binary*/;"}}
+
+		// a column is added before the chunk is selected
+		mock.ExpectQuery("SELECT \\* FROM `test`.`t`").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "age"}).AddRow("1", "bob", "30"))
+		tableIR := newTableData("SELECT * FROM `test`.`t`", 2, false)
+		err = writer.writeTableData(meta, tableIR, 0, "")
+		c.Assert(mock.ExpectationsWereMet(), IsNil)
+		if mismatch == ColumnCountMismatchFail {
+			c.Assert(err, ErrorMatches, ".*the result of table `test`.`t` has 3 columns but 2 columns are expected.*")
+		} else {
+			c.Assert(err, IsNil)
+			bytes, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, "test.t.000000000.sql"))
+			c.Assert(err, IsNil)
+			c.Assert(string(bytes), Equals, "/*!40101 SET NAMES binary*/;\nINSERT INTO `t` VALUES\n('1','bob','30');\n")
+		}
+		db.Close()
+	}
+}
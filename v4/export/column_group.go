@@ -0,0 +1,168 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+)
+
+// columnGroupSeparator separates the table name and the column group name in the data file names
+const columnGroupSeparator = "@"
+
+// ColumnGroup is a vertical partition of a table. Each column group is dumped into its own data files,
+// which always contain the primary key columns so that the groups can be joined back.
+type ColumnGroup struct {
+	Name    string
+	Columns []string
+}
+
+// ParseColumnGroups parses the column groups in the format of `db.table:groupA=col1,col2;groupB=col3`
+// into database -> table -> column groups
+func ParseColumnGroups(specs []string) (map[string]map[string][]ColumnGroup, error) {
+	result := make(map[string]map[string][]ColumnGroup)
+	for _, spec := range specs {
+		tablePart, groupsPart, ok := cutString(spec, ":")
+		if !ok {
+			return nil, errors.Errorf("column groups `%s` should be in the format of db.table:group=col1,col2;group2=col3", spec)
+		}
+		db, tbl, ok := cutString(strings.TrimSpace(tablePart), ".")
+		if !ok || db == "" || tbl == "" {
+			return nil, errors.Errorf("column groups `%s` only accepts qualified table names", spec)
+		}
+		if _, ok := result[db][tbl]; ok {
+			return nil, errors.Errorf("column groups of table `%s`.`%s` are specified more than once", db, tbl)
+		}
+		var groups []ColumnGroup
+		names := make(map[string]struct{})
+		for _, groupSpec := range strings.Split(groupsPart, ";") {
+			if strings.TrimSpace(groupSpec) == "" {
+				continue
+			}
+			name, columnsPart, ok := cutString(groupSpec, "=")
+			name = strings.TrimSpace(name)
+			if !ok || name == "" {
+				return nil, errors.Errorf("column group `%s` of table `%s`.`%s` should be in the format of group=col1,col2", groupSpec, db, tbl)
+			}
+			if _, ok := names[name]; ok {
+				return nil, errors.Errorf("column group `%s` of table `%s`.`%s` is specified more than once", name, db, tbl)
+			}
+			names[name] = struct{}{}
+			group := ColumnGroup{Name: name}
+			for _, col := range strings.Split(columnsPart, ",") {
+				if col = strings.TrimSpace(col); col != "" {
+					group.Columns = append(group.Columns, col)
+				}
+			}
+			if len(group.Columns) == 0 {
+				return nil, errors.Errorf("column group `%s` of table `%s`.`%s` has no column", name, db, tbl)
+			}
+			groups = append(groups, group)
+		}
+		if len(groups) == 0 {
+			return nil, errors.Errorf("no column group is specified for table `%s`.`%s`", db, tbl)
+		}
+		if _, ok := result[db]; !ok {
+			result[db] = make(map[string][]ColumnGroup)
+		}
+		result[db][tbl] = groups
+	}
+	return result, nil
+}
+
+func cutString(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// dumpColumnGroups dumps the data of each column group of the table separately
+func (d *Dumper) dumpColumnGroups(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta, groups []ColumnGroup, taskChan chan<- Task) error {
+	db, tbl := meta.DatabaseName(), meta.TableName()
+	pkCols, err := GetPrimaryKeyColumns(conn, db, tbl)
+	if err != nil {
+		return err
+	}
+	if len(pkCols) == 0 {
+		return errors.Errorf("table `%s`.`%s` has no primary key to join back the column groups", db, tbl)
+	}
+	for _, group := range groups {
+		groupMeta, err := buildColumnGroupMeta(conn, meta, pkCols, group)
+		if err != nil {
+			return err
+		}
+		if err = d.dumpTableData(tctx, conn, groupMeta, taskChan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildColumnGroupMeta builds the TableMeta which only selects the primary key columns and the columns in group
+func buildColumnGroupMeta(conn *sql.Conn, meta TableMeta, pkCols []string, group ColumnGroup) (TableMeta, error) {
+	columns := append([]string{}, pkCols...)
+	for _, col := range group.Columns {
+		isPK := false
+		for _, pkCol := range pkCols {
+			if strings.EqualFold(col, pkCol) {
+				isPK = true
+				break
+			}
+		}
+		if !isPK {
+			columns = append(columns, col)
+		}
+	}
+	fields := make([]string, len(columns))
+	for i, col := range columns {
+		fields[i] = wrapBackTicks(escapeString(col))
+	}
+	selectField := strings.Join(fields, ",")
+	db, tbl := meta.DatabaseName(), meta.TableName()
+	colTypes, err := GetColumnTypes(conn, selectField, db, tbl)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid column group `%s` of table `%s`.`%s`", group.Name, db, tbl)
+	}
+	var specCmts []string
+	for it := meta.SpecialComments(); it.HasNext(); {
+		specCmts = append(specCmts, it.Next())
+	}
+	return &tableMeta{
+		database:         db,
+		table:            tbl,
+		colTypes:         colTypes,
+		selectedField:    selectField,
+		specCmts:         specCmts,
+		showCreateTable:  meta.ShowCreateTable(),
+		columnGroup:      group.Name,
+		dedupKeyColumns:  dedupKeyColumnsOf(meta),
+		sampleKeyColumns: sampleKeyColumnsOf(meta),
+		enumMembers:      enumMembersOf(meta),
+	}, nil
+}
+
+// buildSelectFieldForMeta returns the fields to select for meta, which are the columns of the group for a column group
+func buildSelectFieldForMeta(conn *sql.Conn, meta TableMeta, completeInsert bool) (string, int, error) { // revive:disable-line:flag-parameter
+	if tm, ok := meta.(*tableMeta); ok {
+		if tm.queryField != "" {
+			return tm.queryField, len(tm.colTypes), nil
+		}
+		if tm.columnGroup != "" || len(tm.skippedColumns) > 0 {
+			return tm.selectedField, len(tm.colTypes), nil
+		}
+	}
+	return buildSelectField(conn, meta.DatabaseName(), meta.TableName(), completeInsert)
+}
+
+// outputTableName returns the table name used in the data file names of meta
+func outputTableName(meta TableMeta) string {
+	if tm, ok := meta.(*tableMeta); ok && tm.columnGroup != "" {
+		return tm.table + columnGroupSeparator + tm.columnGroup
+	}
+	return meta.TableName()
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testColumnGroupSuite{})
+
+type testColumnGroupSuite struct{}
+
+func (s *testColumnGroupSuite) TestParseColumnGroups(c *C) {
+	groups, err := ParseColumnGroups([]string{
+		"shop.users:profile=name, email;auth=password_hash",
+		"shop.orders:items=items;",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(groups, DeepEquals, map[string]map[string][]ColumnGroup{
+		"shop": {
+			"users": {
+				{Name: "profile", Columns: []string{"name", "email"}},
+				{Name: "auth", Columns: []string{"password_hash"}},
+			},
+			"orders": {
+				{Name: "items", Columns: []string{"items"}},
+			},
+		},
+	})
+
+	for _, testCase := range []struct {
+		spec []string
+		err  string
+	}{
+		{[]string{"users:a=b"}, ".*only accepts qualified table names"},
+		{[]string{"shop.users"}, ".*should be in the format of.*"},
+		{[]string{"shop.users:a"}, "column group `a` of table `shop`.`users` should be in the format of.*"},
+		{[]string{"shop.users:a=b;a=c"}, ".*is specified more than once"},
+		{[]string{"shop.users:a="}, ".*has no column"},
+		{[]string{"shop.users:"}, "no column group is specified for table `shop`.`users`"},
+		{[]string{"shop.users:a=b", "shop.users:c=d"}, "column groups of table `shop`.`users` are specified more than once"},
+	} {
+		_, err = ParseColumnGroups(testCase.spec)
+		c.Assert(err, ErrorMatches, testCase.err, Commentf("spec %v", testCase.spec))
+	}
+}
+
+func (s *testColumnGroupSuite) TestDumpColumnGroups(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "shop", table: "users", selectedField: "*", specCmts: []string{"/*!40101 SET NAMES binary*/;"}}
+	groups := []ColumnGroup{
+		{Name: "profile", Columns: []string{"name", "ID"}},
+		{Name: "auth", Columns: []string{"password_hash"}},
+	}
+	pkRows := func() *sqlmock.Rows { return sqlmock.NewRows([]string{"column_name"}).AddRow("id") }
+
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("shop", "users").WillReturnRows(pkRows())
+	mock.ExpectQuery("SELECT `id`,`name` FROM `shop`.`users` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("shop", "users").WillReturnRows(pkRows())
+	mock.ExpectQuery("SELECT `id`,`password_hash` FROM `shop`.`users` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash"}))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("shop", "users").WillReturnRows(pkRows())
+
+	taskChan := make(chan Task, 2)
+	c.Assert(d.dumpColumnGroups(tctx, conn, meta, groups, taskChan), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(taskChan, HasLen, 2)
+
+	expected := []struct {
+		query, selectedField, fileTable string
+	}{
+		{"SELECT `id`,`name` FROM `shop`.`users` ORDER BY `id`", "(`id`,`name`)", "users@profile"},
+		{"SELECT `id`,`password_hash` FROM `shop`.`users` ORDER BY `id`", "(`id`,`password_hash`)", "users@auth"},
+	}
+	for _, e := range expected {
+		task := (<-taskChan).(*TaskTableData)
+		c.Assert(task.Data.(*tableData).query, Equals, e.query)
+		c.Assert(task.Meta.TableName(), Equals, "users")
+		c.Assert(task.Meta.SelectedField(), Equals, e.selectedField)
+		c.Assert(newOutputFileNamer(task.Meta, 0, false, false).Table, Equals, e.fileTable)
+	}
+
+	// the table must have a primary key
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("shop", "users").WillReturnRows(sqlmock.NewRows([]string{"column_name"}))
+	err = d.dumpColumnGroups(tctx, conn, meta, groups, taskChan)
+	c.Assert(err, ErrorMatches, "table `shop`.`users` has no primary key to join back the column groups")
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// ParseColumnSelectors parses the column selectors in the format of `db.table:col1,col2` into `db.table` -> columns
+func ParseColumnSelectors(specs []string) (map[string][]string, error) {
+	result := make(map[string][]string, len(specs))
+	for _, spec := range specs {
+		tablePart, columnsPart, ok := cutString(spec, ":")
+		if !ok {
+			return nil, errors.Errorf("column selector `%s` should be in the format of db.table:col1,col2", spec)
+		}
+		table := strings.TrimSpace(tablePart)
+		if _, ok := result[table]; ok {
+			return nil, errors.Errorf("columns of table `%s` are selected more than once", table)
+		}
+		var columns []string
+		for _, col := range strings.Split(columnsPart, ",") {
+			if col = strings.TrimSpace(col); col != "" {
+				columns = append(columns, col)
+			}
+		}
+		result[table] = columns
+	}
+	return result, nil
+}
+
+// buildSelectFieldOfColumns is like buildSelectFieldSkippingTypes, but only the columns in columns are selected.
+// The columns are matched case-insensitively, and the generated columns aren't selected even if they're listed.
+// It returns the columns which aren't selected, and those of them which are skipped by their types.
+//
+// The key to split the table into chunks by is only used in the WHERE clauses, so the table is still split
+// by it even if it isn't selected. The features reading the key from the rows fall back without it.
+func buildSelectFieldOfColumns(db *sql.Conn, dbName, tableName string, columns, skipTypes []string) (selectField string, unselected, skipped []string, err error) {
+	requested := make(map[string]struct{}, len(columns))
+	for _, col := range columns {
+		requested[strings.ToLower(col)] = struct{}{}
+	}
+	query := `SELECT COLUMN_NAME,DATA_TYPE,EXTRA FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=? AND TABLE_NAME=? ORDER BY ORDINAL_POSITION;`
+	rows, err := db.QueryContext(context.Background(), query, dbName, tableName)
+	if err != nil {
+		return "", nil, nil, errors.Annotatef(err, "sql: %s", query)
+	}
+	defer rows.Close()
+	var (
+		fields    []string
+		fieldName string
+		dataType  string
+		extra     string
+	)
+	for rows.Next() {
+		if err = rows.Scan(&fieldName, &dataType, &extra); err != nil {
+			return "", nil, nil, errors.Annotatef(err, "sql: %s", query)
+		}
+		_, ok := requested[strings.ToLower(fieldName)]
+		delete(requested, strings.ToLower(fieldName))
+		switch {
+		case extra == "STORED GENERATED" || extra == "VIRTUAL GENERATED":
+			continue
+		case !ok:
+			unselected = append(unselected, fieldName)
+			continue
+		case isSkippedColumnType(dataType, skipTypes):
+			unselected = append(unselected, fieldName)
+			skipped = append(skipped, fieldName)
+			continue
+		}
+		fields = append(fields, wrapBackTicks(escapeString(fieldName)))
+	}
+	if err = rows.Err(); err != nil {
+		return "", nil, nil, errors.Annotatef(err, "sql: %s", query)
+	}
+	if len(requested) > 0 {
+		missing := make([]string, 0, len(requested))
+		for _, col := range columns {
+			if _, ok := requested[strings.ToLower(col)]; ok {
+				missing = append(missing, col)
+			}
+		}
+		return "", nil, nil, errors.Errorf("columns %s selected by --select-columns don't exist in table `%s`.`%s`",
+			strings.Join(missing, ","), dbName, tableName)
+	}
+	if len(fields) == 0 {
+		return "", nil, nil, errors.Errorf("no column of table `%s`.`%s` is selected by --select-columns", dbName, tableName)
+	}
+	return strings.Join(fields, ","), unselected, skipped, nil
+}
+
+// adjustColumnSelectors checks the tables and the columns of conf.ColumnSelectors
+func adjustColumnSelectors(conf *Config) error {
+	if len(conf.ColumnSelectors) == 0 {
+		if conf.ColumnSelectorsInSchema {
+			return errors.New("config.ColumnSelectorsInSchema requires config.ColumnSelectors")
+		}
+		return nil
+	}
+	for table, columns := range conf.ColumnSelectors {
+		db, tbl, ok := cutString(table, ".")
+		if !ok || db == "" || tbl == "" {
+			return errors.Errorf("column selector of `%s` only accepts qualified table names", table)
+		}
+		if len(columns) == 0 {
+			return errors.Errorf("no column is selected for table `%s`", table)
+		}
+		if _, ok := conf.ColumnGroups[db][tbl]; ok {
+			return errors.Errorf("table `%s` can't be both in config.ColumnSelectors and config.ColumnGroups", table)
+		}
+	}
+	if conf.SQL != "" || len(conf.NamedQueries) > 0 {
+		return errors.New("config.ColumnSelectors is only supported for dumping tables, but --sql or --named-query is specified")
+	}
+	return nil
+}
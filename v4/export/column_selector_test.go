@@ -0,0 +1,114 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+func (s *testSQLSuite) TestDumpTableMetaWithColumnSelectors(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.CompleteInsert = true
+	conf.ColumnSelectors = map[string][]string{"test.t": {"id", "NAME"}}
+	conf.ColumnSelectorsInSchema = true
+	c.Assert(adjustColumnSelectors(conf), IsNil)
+
+	columns := sqlmock.NewRows([]string{"column_name", "data_type", "extra"})
+	createTable := "CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n"
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("c%d", i)
+		switch i {
+		case 0:
+			name = "id"
+		case 5:
+			name = "name"
+		}
+		columns.AddRow(name, "varchar", "")
+		if i > 0 {
+			createTable += fmt.Sprintf("  `%s` varchar(20) DEFAULT NULL,\n", name)
+		}
+	}
+	createTable += "  PRIMARY KEY (`id`),\n  KEY `idx_c1` (`c1`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	mock.ExpectQuery("SELECT COLUMN_NAME,DATA_TYPE,EXTRA").WithArgs("test", "t").WillReturnRows(columns)
+	mock.ExpectQuery("SELECT `id`,`name` FROM `test`.`t` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectQuery("SHOW CREATE TABLE `test`.`t`").
+		WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t", createTable))
+	meta, err := dumpTableMeta(tcontext.Background(), conf, conn, "test", &TableInfo{Name: "t", Type: TableTypeBase})
+	c.Assert(err, IsNil)
+	c.Assert(meta.SelectedField(), Equals, "(`id`,`name`)")
+	c.Assert(skippedColumnsOf(meta), DeepEquals, []string{"c1", "c2", "c3", "c4", "c6", "c7", "c8", "c9"})
+	c.Assert(meta.ShowCreateTable(), Equals, "CREATE TABLE `t` (\n"+
+		"  `id` int(11) NOT NULL,\n"+
+		"  `name` varchar(20) DEFAULT NULL,\n"+
+		"  PRIMARY KEY (`id`)\n"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+
+	// the data only contains the selected columns
+	tctx := tcontext.Background().WithLogger(appLogger)
+	extStore, err := conf.createExternalStorage(tctx)
+	c.Assert(err, IsNil)
+	writer := NewWriter(tctx, 0, conf, conn, extStore)
+	tableIR := newMockTableIR("test", "t", [][]driver.Value{{"1", "a"}, {"2", "b"}}, nil, []string{"INT", "VARCHAR"})
+	tableIR.colNames = []string{"id", "name"}
+	tableIR.selectedField = meta.SelectedField()
+	c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+	data, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, "test.t.000000000.sql"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "INSERT INTO `t` (`id`,`name`) VALUES\n(1,'a'),\n(2,'b');\n")
+
+	// a selected column which doesn't exist fails the dump
+	conf.ColumnSelectors = map[string][]string{"test.t": {"id", "nope"}}
+	mock.ExpectQuery("SELECT COLUMN_NAME,DATA_TYPE,EXTRA").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "extra"}).AddRow("id", "int", ""))
+	_, err = dumpTableMeta(tcontext.Background(), conf, conn, "test", &TableInfo{Name: "t", Type: TableTypeBase})
+	c.Assert(err, ErrorMatches, "columns nope selected by --select-columns don't exist in table `test`.`t`")
+
+	// the generated columns aren't selected
+	conf.ColumnSelectors = map[string][]string{"test.t": {"g"}}
+	mock.ExpectQuery("SELECT COLUMN_NAME,DATA_TYPE,EXTRA").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "extra"}).
+			AddRow("id", "int", "").AddRow("g", "int", "VIRTUAL GENERATED"))
+	_, err = dumpTableMeta(tcontext.Background(), conf, conn, "test", &TableInfo{Name: "t", Type: TableTypeBase})
+	c.Assert(err, ErrorMatches, "no column of table `test`.`t` is selected by --select-columns")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testConfigSuite) TestParseColumnSelectors(c *C) {
+	selectors, err := ParseColumnSelectors([]string{"test.t: id, name", "test.t2:a"})
+	c.Assert(err, IsNil)
+	c.Assert(selectors, DeepEquals, map[string][]string{"test.t": {"id", "name"}, "test.t2": {"a"}})
+	_, err = ParseColumnSelectors([]string{"test.t"})
+	c.Assert(err, ErrorMatches, "column selector `test.t` should be in the format of db.table:col1,col2")
+	_, err = ParseColumnSelectors([]string{"test.t:a", "test.t:b"})
+	c.Assert(err, ErrorMatches, "columns of table `test.t` are selected more than once")
+
+	conf := DefaultConfig()
+	c.Assert(adjustColumnSelectors(conf), IsNil)
+	conf.ColumnSelectorsInSchema = true
+	c.Assert(adjustColumnSelectors(conf), ErrorMatches, "config.ColumnSelectorsInSchema requires config.ColumnSelectors")
+	conf.ColumnSelectors = map[string][]string{"t": {"a"}}
+	c.Assert(adjustColumnSelectors(conf), ErrorMatches, "column selector of `t` only accepts qualified table names")
+	conf.ColumnSelectors = map[string][]string{"test.t": nil}
+	c.Assert(adjustColumnSelectors(conf), ErrorMatches, "no column is selected for table `test.t`")
+	conf.ColumnSelectors = map[string][]string{"test.t": {"a"}}
+	c.Assert(adjustColumnSelectors(conf), IsNil)
+	conf.ColumnGroups = map[string]map[string][]ColumnGroup{"test": {"t": {{Name: "g", Columns: []string{"a"}}}}}
+	c.Assert(adjustColumnSelectors(conf), ErrorMatches, "table `test.t` can't be both in config.ColumnSelectors and config.ColumnGroups")
+}
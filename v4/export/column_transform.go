@@ -0,0 +1,131 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+// columnTransform rewrites the raw value of a column before it's encoded into the output
+type columnTransform = func(value []byte) []byte
+
+// columnTransformsOf returns the transforms in Config.ColumnTransforms of the columns of meta by their indices,
+// it returns nil if no column of meta is transformed. The columns are matched case-insensitively.
+func columnTransformsOf(tctx *tcontext.Context, conf *Config, meta TableMeta) map[int]columnTransform {
+	if len(conf.ColumnTransforms) == 0 {
+		return nil
+	}
+	prefix := meta.DatabaseName() + "." + meta.TableName() + "."
+	byColumn := make(map[string]columnTransform)
+	for key, transform := range conf.ColumnTransforms {
+		if strings.HasPrefix(key, prefix) {
+			byColumn[strings.ToLower(key[len(prefix):])] = transform
+		}
+	}
+	if len(byColumn) == 0 {
+		return nil
+	}
+	transforms := make(map[int]columnTransform, len(byColumn))
+	for i, col := range meta.ColumnNames() {
+		col = strings.ToLower(col)
+		if transform, ok := byColumn[col]; ok {
+			transforms[i] = transform
+			delete(byColumn, col)
+		}
+	}
+	for col := range byColumn {
+		// the column may be in another column group, or it's misspelled
+		tctx.L().Warn("column of the transform isn't dumped",
+			zap.String("database", meta.DatabaseName()),
+			zap.String("table", meta.TableName()),
+			zap.String("column", col))
+	}
+	if len(transforms) == 0 {
+		return nil
+	}
+	return transforms
+}
+
+// columnTransformIR applies Config.ColumnTransforms to the raw values when the rows are decoded
+type columnTransformIR struct {
+	TableDataIR
+	transforms map[int]columnTransform
+}
+
+func newColumnTransformIR(ir TableDataIR, transforms map[int]columnTransform) *columnTransformIR {
+	return &columnTransformIR{TableDataIR: ir, transforms: transforms}
+}
+
+// Rows implements TableDataIR.Rows
+func (t *columnTransformIR) Rows() SQLRowIter {
+	return &columnTransformRowIter{SQLRowIter: t.TableDataIR.Rows(), ir: t}
+}
+
+type columnTransformRowIter struct {
+	SQLRowIter
+	ir *columnTransformIR
+}
+
+// Decode implements SQLRowIter.Decode
+func (it *columnTransformRowIter) Decode(row RowReceiver) error {
+	if err := it.SQLRowIter.Decode(row); err != nil {
+		return err
+	}
+	arr, ok := row.(RowReceiverArr)
+	if !ok {
+		return nil
+	}
+	for idx, transform := range it.ir.transforms {
+		if idx >= len(arr.receivers) {
+			continue
+		}
+		value := rawBytesOf(arr.receivers[idx])
+		if value == nil || *value == nil {
+			continue
+		}
+		*value = transform(*value)
+	}
+	return nil
+}
+
+// rawBytesOf returns the raw value held by receiver, or nil if it doesn't hold one
+func rawBytesOf(receiver RowReceiverStringer) *sql.RawBytes {
+	switch r := receiver.(type) {
+	case *SQLTypeString:
+		return &r.RawBytes
+	case *SQLTypeClientSafeString:
+		return &r.RawBytes
+	case *SQLTypeNumber:
+		return &r.RawBytes
+	case *SQLTypeBytes:
+		return &r.RawBytes
+	case *SQLTypeBinaryString:
+		return &r.RawBytes
+	}
+	return nil
+}
+
+// adjustColumnTransforms checks the keys of conf.ColumnTransforms are qualified column names
+func adjustColumnTransforms(conf *Config) error {
+	if len(conf.ColumnTransforms) == 0 {
+		return nil
+	}
+	for key, transform := range conf.ColumnTransforms {
+		if strings.Count(key, ".") < 2 || strings.HasPrefix(key, ".") || strings.HasSuffix(key, ".") {
+			return errors.Errorf("column transform `%s` should be keyed by db.table.column", key)
+		}
+		if transform == nil {
+			return errors.Errorf("column transform `%s` is nil", key)
+		}
+	}
+	if conf.ServerSideDump {
+		return errors.New("config.ColumnTransforms can't be used with config.ServerSideDump, the data isn't read by Dumpling")
+	}
+	return nil
+}
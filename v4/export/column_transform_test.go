@@ -0,0 +1,67 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"io/ioutil"
+	"path"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestWriteTableDataWithColumnTransforms(c *C) {
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = c.MkDir()
+	config.CompleteInsert = true
+	var calls int
+	config.ColumnTransforms = map[string]func([]byte) []byte{
+		"test.t.Email": func(value []byte) []byte {
+			calls++
+			sum := sha256.Sum256(value)
+			return []byte(hex.EncodeToString(sum[:4]) + "@example.com")
+		},
+		"test.t.ssn": func([]byte) []byte { return nil },
+		// the transforms of the other tables aren't applied
+		"test.t2.name": func([]byte) []byte { return []byte("other") },
+	}
+	c.Assert(adjustColumnTransforms(config), IsNil)
+	writer := s.newWriter(config, c)
+
+	data := [][]driver.Value{
+		{"1", "alice@pingcap.com", "Alice", "123-45-6789"},
+		{"2", nil, "Bob", "987-65-4321"},
+		{"3", "", "Carol", nil},
+	}
+	tableIR := newMockTableIR("test", "t", data, nil, []string{"INT", "VARCHAR", "VARCHAR", "VARCHAR"})
+	tableIR.colNames = []string{"id", "email", "name", "ssn"}
+	tableIR.selectedField = "(`id`,`email`,`name`,`ssn`)"
+	c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+
+	bytes, err := ioutil.ReadFile(path.Join(config.OutputDirPath, "test.t.000000000.sql"))
+	c.Assert(err, IsNil)
+	// NULL isn't passed to the transforms, the empty string is
+	c.Assert(string(bytes), Equals, "INSERT INTO `t` (`id`,`email`,`name`,`ssn`) VALUES\n"+
+		"(1,'158a4470@example.com','Alice',NULL),\n"+
+		"(2,NULL,'Bob',NULL),\n"+
+		"(3,'e3b0c442@example.com','Carol',NULL);\n")
+	c.Assert(calls, Equals, 2)
+}
+
+func (s *testConfigSuite) TestAdjustColumnTransforms(c *C) {
+	conf := DefaultConfig()
+	c.Assert(adjustColumnTransforms(conf), IsNil)
+	identity := func(value []byte) []byte { return value }
+	for _, key := range []string{"t.c", "db.t.", ".t.c", "c"} {
+		conf.ColumnTransforms = map[string]func([]byte) []byte{key: identity}
+		c.Assert(adjustColumnTransforms(conf), ErrorMatches, "column transform .* should be keyed by db.table.column", Commentf("key %s", key))
+	}
+	conf.ColumnTransforms = map[string]func([]byte) []byte{"db.t.c": nil}
+	c.Assert(adjustColumnTransforms(conf), ErrorMatches, "column transform `db.t.c` is nil")
+	conf.ColumnTransforms = map[string]func([]byte) []byte{"db.t.c": identity}
+	c.Assert(adjustColumnTransforms(conf), IsNil)
+	conf.ServerSideDump = true
+	c.Assert(adjustColumnTransforms(conf), ErrorMatches, ".*can't be used with config.ServerSideDump.*")
+}
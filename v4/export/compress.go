@@ -0,0 +1,217 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+// CompressType is the compression type of the output files. Dumpling compresses the files itself, so it supports
+// more types than storage.CompressType of br, which is never used for the output files.
+type CompressType uint8
+
+const (
+	// CompressNone doesn't compress the files
+	CompressNone CompressType = iota
+	// CompressGzip compresses the files in the gzip format
+	CompressGzip
+	// CompressSnappy compresses the files in the snappy framing format
+	CompressSnappy
+	// CompressZstd compresses the files in the zstd format
+	CompressZstd
+)
+
+const compressedBytesUnit = "total compressed bytes"
+
+// compressedStorage compresses the files created through it while they're written, instead of storage.WithCompression
+// which only supports gzip. The compressed bytes of each file are counted, so they're reported besides the bytes written.
+type compressedStorage struct {
+	storage.ExternalStorage
+	compressType CompressType
+	// dict trains the dictionary of the zstd files by Config.CompressDictionary, it's nil without it
+	dict *zstdDictStorage
+}
+
+// newCompressedStorage returns the storage which compresses the files in compressType, it's s if they aren't compressed.
+// The zstd files are compressed with the shared dictionary if s is the zstdDictStorage of Config.CompressDictionary.
+func newCompressedStorage(s storage.ExternalStorage, compressType CompressType) storage.ExternalStorage {
+	if compressType == CompressNone {
+		return s
+	}
+	cs := &compressedStorage{ExternalStorage: s, compressType: compressType}
+	if ds, ok := s.(*zstdDictStorage); ok && compressType == CompressZstd {
+		cs.dict = ds
+	}
+	return cs
+}
+
+// compressTypeName returns the name of compressType which ParseCompressType parses
+func compressTypeName(compressType CompressType) string {
+	switch compressType {
+	case CompressGzip:
+		return "gzip"
+	case CompressSnappy:
+		return "snappy"
+	case CompressZstd:
+		return "zstd"
+	default:
+		return "no-compression"
+	}
+}
+
+// newCompressWriter returns the writer compressing into w, the zstd data is compressed with dict if it's not nil
+func newCompressWriter(compressType CompressType, w io.Writer, dict []byte) (io.WriteCloser, error) {
+	switch compressType {
+	case CompressGzip:
+		return gzip.NewWriter(w), nil
+	case CompressSnappy:
+		return snappy.NewBufferedWriter(w), nil
+	case CompressZstd:
+		if dict != nil {
+			return zstd.NewWriter(w, zstd.WithEncoderDict(dict))
+		}
+		return zstd.NewWriter(w)
+	default:
+		return nil, errors.Errorf("unknown compress type %d", compressType)
+	}
+}
+
+// newDecompressReader returns the reader decompressing r, the zstd frames compressed with dict are decompressed with it
+func newDecompressReader(compressType CompressType, r io.Reader, dict []byte) (io.ReadCloser, error) {
+	switch compressType {
+	case CompressNone:
+		return ioutil.NopCloser(r), nil
+	case CompressGzip:
+		return gzip.NewReader(r)
+	case CompressSnappy:
+		return ioutil.NopCloser(snappy.NewReader(r)), nil
+	case CompressZstd:
+		var opts []zstd.DOption
+		if dict != nil {
+			opts = append(opts, zstd.WithDecoderDicts(dict))
+		}
+		d, err := zstd.NewReader(r, opts...)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return d.IOReadCloser(), nil
+	default:
+		return nil, errors.Errorf("unknown compress type %d", compressType)
+	}
+}
+
+// Create implements ExternalStorage.Create. The data is compressed as it's written, ctx is used to write
+// the compressed data until the file is closed
+func (s *compressedStorage) Create(ctx context.Context, name string) (storage.ExternalFileWriter, error) {
+	if s.dict != nil {
+		return s.dict.create(ctx, name), nil
+	}
+	writer, err := s.ExternalStorage.Create(ctx, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	fw := &compressedFileWriter{file: &compressedFileOutput{ctx: ctx, writer: writer}}
+	fw.compressor, err = newCompressWriter(s.compressType, fw.file, nil)
+	if err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+// WriteFile implements ExternalStorage.WriteFile
+func (s *compressedStorage) WriteFile(ctx context.Context, name string, data []byte) error {
+	if s.dict != nil {
+		w := s.dict.create(ctx, name)
+		if _, err := w.Write(ctx, data); err != nil {
+			_ = w.Close(ctx)
+			return err
+		}
+		return w.Close(ctx)
+	}
+	var bf bytes.Buffer
+	compressor, err := newCompressWriter(s.compressType, &bf, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = compressor.Write(data); err != nil {
+		return errors.Trace(err)
+	}
+	if err = compressor.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	return s.ExternalStorage.WriteFile(ctx, name, bf.Bytes())
+}
+
+// ReadFile implements ExternalStorage.ReadFile
+func (s *compressedStorage) ReadFile(ctx context.Context, name string) ([]byte, error) {
+	data, err := s.ExternalStorage.ReadFile(ctx, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var dict []byte
+	if s.dict != nil {
+		dict, _ = s.dict.dictionary()
+	}
+	r, err := newDecompressReader(s.compressType, bytes.NewReader(data), dict)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer r.Close()
+	data, err = ioutil.ReadAll(r)
+	return data, errors.Trace(err)
+}
+
+// compressedFileOutput writes the compressed data into the file and counts it
+type compressedFileOutput struct {
+	ctx     context.Context
+	writer  storage.ExternalFileWriter
+	written uint64
+}
+
+// Write implements io.Writer
+func (o *compressedFileOutput) Write(p []byte) (int, error) {
+	n, err := o.writer.Write(o.ctx, p)
+	o.written += uint64(n)
+	return n, err
+}
+
+// compressedFileWriter compresses the data written into the file
+type compressedFileWriter struct {
+	compressor io.WriteCloser
+	file       *compressedFileOutput
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *compressedFileWriter) Write(_ context.Context, p []byte) (int, error) {
+	n, err := w.compressor.Write(p)
+	return n, errors.Trace(err)
+}
+
+// Close implements ExternalFileWriter.Close, it flushes the compressed data and closes the file
+func (w *compressedFileWriter) Close(ctx context.Context) error {
+	if err := w.compressor.Close(); err != nil {
+		_ = w.file.writer.Close(ctx)
+		return errors.Trace(err)
+	}
+	return errors.Trace(w.file.writer.Close(ctx))
+}
+
+// compressedSize returns the size of the file written by w after it's closed, uncompressed is the size written into w
+func compressedSize(w storage.ExternalFileWriter, uncompressed uint64) uint64 {
+	switch cw := w.(type) {
+	case *compressedFileWriter:
+		return cw.file.written
+	case *zstdDictFileWriter:
+		return cw.compressedSize(uncompressed)
+	}
+	return uncompressed
+}
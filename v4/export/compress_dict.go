@@ -0,0 +1,297 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// zstdDictionaryPath is the sidecar of the dictionary which the zstd files are compressed with by Config.CompressDictionary
+	zstdDictionaryPath = "zstd-dictionary.dict"
+	// zstdDictSampleSize is how much of the beginning of each file is sampled to train the dictionary
+	zstdDictSampleSize = 64 * 1024
+	// zstdDictTrainingSize is how much sampled data the dictionary is trained from
+	zstdDictTrainingSize = 512 * 1024
+	// zstdDictMaxSize is the max size of the dictionary
+	zstdDictMaxSize = 64 * 1024
+)
+
+func adjustCompressDictionary(conf *Config) error {
+	if !conf.CompressDictionary {
+		return nil
+	}
+	switch {
+	case conf.CompressType != CompressZstd:
+		return errors.New("config.CompressDictionary requires config.CompressType 'zstd'")
+	case conf.Checkpoint != "":
+		return errors.New("config.CompressDictionary can't be used with config.Checkpoint, the files dumped before resuming are compressed with another dictionary")
+	}
+	return nil
+}
+
+// zstdDictStorage trains a zstd dictionary shared by the files compressed through it by Config.CompressDictionary,
+// from the beginning of the first files written. Every file is compressed with the dictionary, so the files closed
+// before it's trained are held in memory and written once it is, and a file growing beyond zstdDictSampleSize
+// trains it right away with the samples so far. The dictionary is written into zstdDictionaryPath.
+// If the samples are too few or too similar to train a dictionary, the files are compressed without one.
+type zstdDictStorage struct {
+	storage.ExternalStorage
+	trainingSize int
+
+	mu      sync.Mutex
+	samples [][]byte
+	sampled int
+	trained bool
+	// dict is nil if the dictionary isn't trained yet or fails to be trained
+	dict []byte
+	// encoder compresses the files no larger than zstdDictSampleSize after the dictionary is trained
+	encoder *zstd.Encoder
+	// file name -> uncompressed data of the files held until the dictionary is trained
+	pending map[string][]byte
+}
+
+func newZstdDictStorage(s storage.ExternalStorage) *zstdDictStorage {
+	return &zstdDictStorage{ExternalStorage: s, trainingSize: zstdDictTrainingSize, pending: make(map[string][]byte)}
+}
+
+// dictionary returns the trained dictionary, it's false if the dictionary isn't trained yet
+func (s *zstdDictStorage) dictionary() ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dict, s.trained
+}
+
+// trainLocked trains the dictionary from the samples and returns the files held for it, s.mu must be held
+func (s *zstdDictStorage) trainLocked() map[string][]byte {
+	s.trained = true
+	s.dict = buildZstdDict(s.samples)
+	s.samples = nil
+	var err error
+	if s.dict != nil {
+		if s.encoder, err = zstd.NewWriter(nil, zstd.WithEncoderDict(s.dict)); err != nil {
+			s.dict = nil
+		}
+	}
+	if s.dict == nil {
+		s.encoder, _ = zstd.NewWriter(nil)
+	}
+	pending := s.pending
+	s.pending = make(map[string][]byte)
+	return pending
+}
+
+// buildZstdDict returns nil if the dictionary can't be trained from samples. The dictionary builder
+// panics instead of failing on the samples with too few repeated sequences, which is recovered here.
+func buildZstdDict(samples [][]byte) (d []byte) {
+	if len(samples) == 0 {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			d = nil
+		}
+	}()
+	d, err := dict.BuildZstdDict(samples, dict.Options{MaxDictSize: zstdDictMaxSize, HashBytes: 6})
+	if err != nil {
+		return nil
+	}
+	return d
+}
+
+// train trains the dictionary with sample if it isn't trained yet, then writes the files held for it
+func (s *zstdDictStorage) train(ctx context.Context, sample []byte) ([]byte, error) {
+	s.mu.Lock()
+	if s.trained {
+		defer s.mu.Unlock()
+		return s.dict, nil
+	}
+	s.samples = append(s.samples, sample)
+	pending := s.trainLocked()
+	d := s.dict
+	s.mu.Unlock()
+	return d, s.writeTrained(ctx, d, pending)
+}
+
+// closeFile writes a file closed with data no larger than zstdDictSampleSize. It's held until the dictionary
+// is trained, or trains it if the samples are enough. It returns the compressed size of the file if it's written.
+func (s *zstdDictStorage) closeFile(ctx context.Context, name string, data []byte) (uint64, bool, error) {
+	s.mu.Lock()
+	if s.trained {
+		s.mu.Unlock()
+		size, err := s.writeFile(ctx, name, data)
+		return size, true, err
+	}
+	s.samples = append(s.samples, data)
+	s.sampled += len(data)
+	s.pending[name] = data
+	if s.sampled < s.trainingSize {
+		s.mu.Unlock()
+		return 0, false, nil
+	}
+	pending := s.trainLocked()
+	d := s.dict
+	s.mu.Unlock()
+	delete(pending, name)
+	size, err := s.writeFile(ctx, name, data)
+	if err != nil {
+		return 0, false, err
+	}
+	return size, true, s.writeTrained(ctx, d, pending)
+}
+
+// writeTrained writes the dictionary and the files held for it
+func (s *zstdDictStorage) writeTrained(ctx context.Context, d []byte, pending map[string][]byte) error {
+	if d != nil {
+		if err := s.ExternalStorage.WriteFile(ctx, zstdDictionaryPath, d); err != nil {
+			return errors.Annotate(err, "fail to write the zstd dictionary")
+		}
+	}
+	names := make([]string, 0, len(pending))
+	for name := range pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := s.writeFile(ctx, name, pending[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile compresses a small file with the trained dictionary and writes it
+func (s *zstdDictStorage) writeFile(ctx context.Context, name string, data []byte) (uint64, error) {
+	compressed := s.encoder.EncodeAll(data, nil)
+	w, err := s.ExternalStorage.Create(ctx, name)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if _, err = w.Write(ctx, compressed); err != nil {
+		_ = w.Close(ctx)
+		return 0, errors.Trace(err)
+	}
+	return uint64(len(compressed)), errors.Trace(w.Close(ctx))
+}
+
+// forget drops a file held for the dictionary after it's deleted, so it isn't written again
+func (s *zstdDictStorage) forget(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.pending, name)
+	s.mu.Unlock()
+}
+
+// flush trains the dictionary with the samples so far if it isn't trained yet, when the dump writes less than
+// zstdDictTrainingSize, and writes the files held for it
+func (s *zstdDictStorage) flush(tctx *tcontext.Context) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	if s.trained {
+		s.mu.Unlock()
+		return nil
+	}
+	pending := s.trainLocked()
+	d := s.dict
+	s.mu.Unlock()
+	if d == nil && len(pending) > 0 {
+		tctx.L().Warn("the samples are too few to train the zstd dictionary, the files are compressed without it",
+			zap.Int("files", len(pending)))
+	}
+	return s.writeTrained(tctx, d, pending)
+}
+
+// create creates a file compressed with the dictionary. The files no larger than zstdDictSampleSize are written
+// when they're closed, and the larger ones are written as they're written once the dictionary is trained.
+func (s *zstdDictStorage) create(ctx context.Context, name string) storage.ExternalFileWriter {
+	return &zstdDictFileWriter{storage: s, ctx: ctx, name: name}
+}
+
+func newZstdFileWriter(ctx context.Context, s storage.ExternalStorage, name string, d []byte) (*compressedFileWriter, error) {
+	writer, err := s.Create(ctx, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	fw := &compressedFileWriter{file: &compressedFileOutput{ctx: ctx, writer: writer}}
+	fw.compressor, err = newCompressWriter(CompressZstd, fw.file, d)
+	if err != nil {
+		_ = writer.Close(ctx)
+		return nil, err
+	}
+	return fw, nil
+}
+
+// zstdDictFileWriter buffers the beginning of a file, then compresses it with the dictionary
+type zstdDictFileWriter struct {
+	storage *zstdDictStorage
+	ctx     context.Context
+	name    string
+	buf     bytes.Buffer
+	// file compresses the file larger than zstdDictSampleSize as it's written, it's nil for the smaller files
+	file *compressedFileWriter
+	// written is the compressed size of the file if it's written when it's closed
+	written    uint64
+	hasWritten bool
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *zstdDictFileWriter) Write(ctx context.Context, p []byte) (int, error) {
+	if w.file != nil {
+		return w.file.Write(ctx, p)
+	}
+	w.buf.Write(p)
+	if w.buf.Len() <= zstdDictSampleSize {
+		return len(p), nil
+	}
+	sample := append([]byte(nil), w.buf.Bytes()[:zstdDictSampleSize]...)
+	d, err := w.storage.train(ctx, sample)
+	if err != nil {
+		return 0, err
+	}
+	if w.file, err = newZstdFileWriter(w.ctx, w.storage.ExternalStorage, w.name, d); err != nil {
+		return 0, err
+	}
+	if _, err = w.file.Write(ctx, w.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	w.buf = bytes.Buffer{}
+	return len(p), nil
+}
+
+// Close implements ExternalFileWriter.Close
+func (w *zstdDictFileWriter) Close(ctx context.Context) error {
+	if w.file != nil {
+		return w.file.Close(ctx)
+	}
+	size, written, err := w.storage.closeFile(ctx, w.name, w.buf.Bytes())
+	w.written, w.hasWritten = size, written
+	return err
+}
+
+// compressedSize returns the compressed size of the file after it's closed, or uncompressed if it's held until
+// the dictionary is trained
+func (w *zstdDictFileWriter) compressedSize(uncompressed uint64) uint64 {
+	switch {
+	case w.file != nil:
+		return w.file.file.written
+	case w.hasWritten:
+		return w.written
+	default:
+		return uncompressed
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestAdjustCompressDictionary(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.CompressDictionary = true
+	c.Assert(adjustCompressDictionary(conf), ErrorMatches, "config.CompressDictionary requires config.CompressType 'zstd'")
+	conf.CompressType = CompressZstd
+	c.Assert(adjustCompressDictionary(conf), IsNil)
+	conf.Checkpoint = "checkpoint.json"
+	c.Assert(adjustCompressDictionary(conf), ErrorMatches, "config.CompressDictionary can't be used with config.Checkpoint.*")
+}
+
+func (s *testWriterSuite) TestCompressDictionary(c *C) {
+	dir := c.MkDir()
+	extStore, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	dictStore := newZstdDictStorage(extStore)
+	// the dictionary is trained from fewer samples to speed up the test
+	dictStore.trainingSize = 128 * 1024
+	ctx := context.Background()
+	tctx := tcontext.Background().WithLogger(appLogger)
+
+	tableData := func(i, rows int) []byte {
+		var buf bytes.Buffer
+		buf.WriteString("/*!40101 SET NAMES binary*/;\n")
+		fmt.Fprintf(&buf, "INSERT INTO `table_%d` VALUES\n", i)
+		for j := 0; j < rows; j++ {
+			fmt.Fprintf(&buf, "(%d,'user_%d_%d','2021-01-%02d 00:00:00','healthy'),\n", j, i, j*7, j%28+1)
+		}
+		return buf.Bytes()
+	}
+	write := func(name string, data []byte) {
+		w, err := newCompressedStorage(dictStore, CompressZstd).Create(ctx, name)
+		c.Assert(err, IsNil)
+		_, err = w.Write(ctx, data)
+		c.Assert(err, IsNil)
+		c.Assert(w.Close(ctx), IsNil)
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(path.Join(dir, name))
+		return err == nil
+	}
+
+	// the small files are held until the samples are enough to train the dictionary
+	contents := make(map[string][]byte)
+	name := func(i int) string { return fmt.Sprintf("test.table_%d.000000000.sql.zst", i) }
+	i, sampled := 0, 0
+	for ; !exists(zstdDictionaryPath); i++ {
+		contents[name(i)] = tableData(i, 30)
+		write(name(i), contents[name(i)])
+		sampled += len(contents[name(i)])
+		c.Assert(exists(name(0)), Equals, exists(zstdDictionaryPath))
+	}
+	c.Assert(sampled >= dictStore.trainingSize, IsTrue)
+	// the files after the dictionary is trained are written when they're closed, including the large ones
+	contents[name(i)] = tableData(i, 3000)
+	write(name(i), contents[name(i)])
+	c.Assert(exists(name(i)), IsTrue)
+	c.Assert(dictStore.flush(tctx), IsNil)
+
+	dict, err := ioutil.ReadFile(path.Join(dir, zstdDictionaryPath))
+	c.Assert(err, IsNil)
+	d, trained := dictStore.dictionary()
+	c.Assert(trained, IsTrue)
+	c.Assert(dict, DeepEquals, d)
+	var compressedBytes int
+	for name, expected := range contents {
+		compressed, err := ioutil.ReadFile(path.Join(dir, name))
+		c.Assert(err, IsNil)
+		compressedBytes += len(compressed)
+		r, err := newDecompressReader(CompressZstd, bytes.NewReader(compressed), nil)
+		c.Assert(err, IsNil)
+		_, err = ioutil.ReadAll(r)
+		c.Assert(err, NotNil, Commentf("file %s is decompressed without the dictionary", name))
+		r, err = newDecompressReader(CompressZstd, bytes.NewReader(compressed), dict)
+		c.Assert(err, IsNil)
+		content, err := ioutil.ReadAll(r)
+		c.Assert(err, IsNil)
+		c.Assert(content, DeepEquals, expected)
+	}
+
+	// the dictionary improves the compression ratio of the small files
+	var plainBytes int
+	for _, data := range contents {
+		var bf bytes.Buffer
+		w, err := newCompressWriter(CompressZstd, &bf, nil)
+		c.Assert(err, IsNil)
+		_, err = w.Write(data)
+		c.Assert(err, IsNil)
+		c.Assert(w.Close(), IsNil)
+		plainBytes += bf.Len()
+	}
+	c.Assert(compressedBytes < plainBytes, IsTrue, Commentf("compressed %d bytes with dictionary, %d bytes without", compressedBytes, plainBytes))
+}
+
+func (s *testWriterSuite) TestCompressDictionaryFlush(c *C) {
+	dir := c.MkDir()
+	extStore, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	dictStore := newZstdDictStorage(extStore)
+	ctx := context.Background()
+	tctx := tcontext.Background().WithLogger(appLogger)
+
+	for _, name := range []string{"test.t1-schema.sql.zst", "test.t2-schema.sql.zst"} {
+		w, err := newCompressedStorage(dictStore, CompressZstd).Create(ctx, name)
+		c.Assert(err, IsNil)
+		_, err = w.Write(ctx, []byte("CREATE TABLE t (a INT);\n"))
+		c.Assert(err, IsNil)
+		c.Assert(w.Close(ctx), IsNil)
+	}
+	// a deleted file isn't written after the dictionary is trained
+	dictStore.forget("test.t2-schema.sql.zst")
+	_, err = os.Stat(path.Join(dir, "test.t1-schema.sql.zst"))
+	c.Assert(os.IsNotExist(err), IsTrue)
+
+	// the samples of a short dump are too few to train the dictionary, so the files are written without it
+	c.Assert(dictStore.flush(tctx), IsNil)
+	_, err = os.Stat(path.Join(dir, zstdDictionaryPath))
+	c.Assert(os.IsNotExist(err), IsTrue)
+	_, err = os.Stat(path.Join(dir, "test.t2-schema.sql.zst"))
+	c.Assert(os.IsNotExist(err), IsTrue)
+	compressed, err := ioutil.ReadFile(path.Join(dir, "test.t1-schema.sql.zst"))
+	c.Assert(err, IsNil)
+	r, err := newDecompressReader(CompressZstd, bytes.NewReader(compressed), nil)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "CREATE TABLE t (a INT);\n")
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestParseCompressType(c *C) {
+	for name, expected := range map[string]CompressType{
+		"":               CompressNone,
+		"no-compression": CompressNone,
+		"gzip":           CompressGzip,
+		"snappy":         CompressSnappy,
+		"zstd":           CompressZstd,
+		"zst":            CompressZstd,
+	} {
+		compressType, err := ParseCompressType(name)
+		c.Assert(err, IsNil)
+		c.Assert(compressType, Equals, expected)
+	}
+	_, err := ParseCompressType("lz4")
+	c.Assert(err, ErrorMatches, "unknown compress type lz4")
+}
+
+func (s *testWriterSuite) TestWriteCompressedTableData(c *C) {
+	data := [][]driver.Value{
+		{"1", "male", "bob@mail.com", "020-1234", nil},
+		{"2", "female", "sarah@mail.com", "020-1253", "healthy"},
+		{"3", "male", "john@mail.com", "020-1256", "healthy"},
+		{"4", "female", "sarah@mail.com", "020-1235", "healthy"},
+	}
+	colTypes := []string{"INT", "SET", "VARCHAR", "VARCHAR", "TEXT"}
+	dump := func(compressType CompressType) (string, TableDumpResult) {
+		config := defaultConfigForTest(c)
+		config.OutputDirPath = c.MkDir()
+		config.CompressType = compressType
+		// the files are rotated by the size before compression
+		config.FileSize = 100
+		writer := s.newWriter(config, c)
+		writer.tableStats = newTableStatsCollector()
+		tableIR := newMockTableIR("test", "employee", data, nil, colTypes)
+		c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+		results := writer.tableStats.results()
+		c.Assert(results, HasLen, 1)
+		return config.OutputDirPath, results[0]
+	}
+
+	plainDir, plain := dump(CompressNone)
+	c.Assert(plain.CompressedBytes, Equals, plain.Bytes)
+	files, err := ioutil.ReadDir(plainDir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 2)
+
+	for _, compressType := range []CompressType{CompressGzip, CompressSnappy, CompressZstd} {
+		dir, result := dump(compressType)
+		comment := Commentf("compress type %s", compressTypeName(compressType))
+		c.Assert(result.Bytes, Equals, plain.Bytes, comment)
+		var compressedBytes uint64
+		for _, f := range files {
+			expected, err := ioutil.ReadFile(path.Join(plainDir, f.Name()))
+			c.Assert(err, IsNil)
+			compressed, err := ioutil.ReadFile(path.Join(dir, f.Name()+compressFileSuffix(compressType)))
+			c.Assert(err, IsNil, comment)
+			compressedBytes += uint64(len(compressed))
+			r, err := newDecompressReader(compressType, bytes.NewReader(compressed), nil)
+			c.Assert(err, IsNil)
+			content, err := ioutil.ReadAll(r)
+			c.Assert(err, IsNil)
+			c.Assert(r.Close(), IsNil)
+			c.Assert(string(content), Equals, string(expected), comment)
+		}
+		c.Assert(result.CompressedBytes, Equals, compressedBytes, comment)
+		_, err = os.Stat(path.Join(dir, files[0].Name()))
+		c.Assert(os.IsNotExist(err), IsTrue, comment)
+	}
+}
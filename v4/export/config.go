@@ -4,10 +4,16 @@ package export
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
@@ -70,6 +76,155 @@ const (
 	flagReadTimeout              = "read-timeout"
 	flagTransactionalConsistency = "transactional-consistency"
 	flagCompress                 = "compress"
+	flagExtendedInsert           = "extended-insert"
+	flagHDFSUser                 = "hdfs-user"
+	flagHDFSDelegationToken      = "hdfs-delegation-token"
+	flagHDFSCA                   = "hdfs-ca"
+	flagDedupSchema              = "dedup-schema"
+	flagLargestFirst             = "largest-first"
+	flagBinarySafeStrings        = "binary-safe-strings"
+	flagTimeColumn               = "time-column"
+	flagTimeFrom                 = "time-from"
+	flagTimeTo                   = "time-to"
+	flagBlockAllowListFile       = "block-allow-list-file"
+	flagCsvInvalidUTF8           = "csv-invalid-utf8"
+	flagChunkMetadata            = "chunk-metadata"
+	flagPreCheckTables           = "pre-check-tables"
+	flagPreCheckFailureMode      = "pre-check-failure-mode"
+	flagGCSafePointRetries       = "gc-safe-point-update-retries"
+	flagGCSafePointFailureAction = "gc-safe-point-failure-action"
+	flagPDAddrs                  = "pd-addrs"
+	flagBinaryEncoding           = "binary-encoding"
+	flagColumnGroups             = "column-groups"
+	flagNoDataMarkers            = "no-data-markers"
+	flagMigrationLayout          = "migration-layout"
+	flagRecordConfig             = "record-config"
+	flagRampUpDuration           = "ramp-up-duration"
+	flagMaterializePartition     = "materialize-partition-column"
+	flagMinFreeSpace             = "min-free-space"
+	flagMinThreads               = "min-threads"
+	flagMemoryWatermark          = "memory-watermark"
+	flagForceEngine              = "force-engine"
+	flagForceCharset             = "force-charset"
+	flagForceCollation           = "force-collation"
+	flagForceColumnCharset       = "force-column-charset"
+	flagAnnotateFiles            = "annotate-files"
+	flagTableThreads             = "table-threads"
+	flagBinaryModeHeader         = "binary-mode-header"
+	flagRecentPartitions         = "recent-partitions"
+	flagStaticTablesList         = "static-tables-list"
+	flagTableListFile            = "table-list-file"
+	flagEmitChecksums            = "emit-checksums"
+	flagEncryptMethod            = "encrypt-method"
+	flagEncryptKey               = "encrypt-key"
+	flagEncryptKMSKeyID          = "encrypt-kms-key-id"
+	flagOutputKeyColumns         = "output-key-columns"
+	flagOutputKeySeparator       = "output-key-separator"
+	flagMaxEstimatedBytes        = "max-estimated-bytes"
+	flagRecordUncompressedSize   = "record-uncompressed-size"
+	flagCompressDictionary       = "compress-dictionary"
+	flagServerSideDump           = "server-side-dump"
+	flagRowsPerTransaction       = "rows-per-transaction"
+	flagDumpStats                = "dump-stats"
+	flagFileMode                 = "file-mode"
+	flagDedupByPrimaryKey        = "dedup-by-primary-key"
+	flagHosts                    = "hosts"
+	flagEmitCatalog              = "emit-catalog"
+	flagNoCreateDatabase         = "no-create-database"
+	flagChunkTimeout             = "chunk-timeout"
+	flagQueryTimeout             = "query-timeout"
+	flagOutputFIFO               = "output-fifo"
+	flagOutputMode               = "output-mode"
+	flagSingleOutputFile         = "single-output-file"
+	flagOnTableError             = "on-table-error"
+	flagSkipEstimate             = "skip-estimate"
+	flagEmitVerificationSample   = "emit-verification-sample"
+	flagVerificationInterval     = "verification-sample-interval"
+	flagViewMode                 = "view-mode"
+	flagRoutines                 = "routines"
+	flagTriggers                 = "triggers"
+	flagEvents                   = "events"
+	flagSequences                = "sequences"
+	flagMaxConcurrentUploads     = "max-concurrent-uploads"
+	flagPerDatabaseMetadata      = "per-database-metadata"
+	flagJobIndex                 = "job-index"
+	flagJobCount                 = "job-count"
+	flagSkipWriteCheck           = "skip-write-check"
+	flagDecimalFormat            = "decimal-format"
+	flagFloatFormat              = "float-format"
+	flagNamedQuery               = "named-query"
+	flagTransactionPerTable      = "transaction-per-table"
+	flagSkipColumnTypes          = "skip-column-types"
+	flagSkipColumnTypesInSchema  = "skip-column-types-in-schema"
+	flagSelectColumns            = "select-columns"
+	flagSelectColumnsInSchema    = "select-columns-in-schema"
+	flagEmitStatsCSV             = "emit-stats-csv"
+	flagChunkExpression          = "chunk-expression"
+	flagCollationAllowlist       = "collation-allowlist"
+	flagCollationMode            = "collation-mode"
+	flagDefaultCollation         = "default-collation"
+	flagVerifyChunkCount         = "verify-chunk-count"
+	flagVerifyChunkCountRetries  = "verify-chunk-count-retries"
+	flagIdentifierQuote          = "identifier-quote"
+	flagTargetDSN                = "target-dsn"
+	flagLoadOnly                 = "load-only"
+	flagStripPartitioning        = "strip-partitioning"
+	flagTableRows                = "table-rows"
+	flagChunkByFileSize          = "chunk-by-filesize"
+	flagErrorReportFile          = "error-report-file"
+	flagNormalizeSchema          = "normalize-schema"
+	flagSafeModeRows             = "safe-mode-rows"
+	flagInsertMethod             = "insert-method"
+	flagIncrementalAgainst       = "incremental-against"
+	flagImportIntoCompat         = "import-into-compat"
+	flagPerTableBudget           = "per-table-budget"
+	flagPerChunkBinlogPos        = "per-chunk-binlog-pos"
+	flagGenerateLightningConfig  = "generate-lightning-config"
+	flagInvalidEnumHandling      = "invalid-enum-handling"
+	flagHashPrefixFiles          = "hash-prefix-files"
+	flagSubsetSeed               = "subset-seed"
+	flagSubsetMaxDepth           = "subset-max-depth"
+	flagSubsetMaxRows            = "subset-max-rows"
+	flagRowCountTrailer          = "row-count-trailer"
+	flagColumnCountMismatch      = "column-count-mismatch"
+	flagLowercaseIdentifiers     = "lowercase-identifiers"
+	flagEmitDependencyGraph      = "emit-dependency-graph"
+	flagMaxReplicaLagSeconds     = "max-replica-lag-seconds"
+	flagEmitConstraints          = "emit-constraints"
+	flagMaxFieldBytes            = "max-field-bytes"
+	flagPartitionByColumn        = "partition-by-column"
+	flagPartitionMaxOpenFiles    = "partition-max-open-files"
+	flagVerifyCoverage           = "verify-coverage"
+	flagConnectionAttributes     = "connection-attributes"
+	flagSplitSchemaByType        = "split-schema-by-type"
+	flagConsistencyCheckOnly     = "consistency-check-only"
+	flagPartitionFilter          = "partition-filter"
+	flagExclusiveTarget          = "exclusive-target"
+	flagExclusiveTargetForce     = "exclusive-target-force"
+	flagExclusiveTargetStale     = "exclusive-target-stale-after"
+	flagStripColumnComments      = "strip-column-comments"
+	flagStripTableComments       = "strip-table-comments"
+	flagNullsHandling            = "nulls-handling"
+	flagKafkaBrokers             = "kafka-brokers"
+	flagKafkaTopic               = "kafka-topic"
+	flagKafkaKeyColumn           = "kafka-key-column"
+	flagKafkaOnly                = "kafka-only"
+	flagUseCoveringIndex         = "use-covering-index"
+	flagEmitRestoreAsserts       = "emit-restore-asserts"
+	flagOrderByCollation         = "order-by-collation"
+	flagEmitPKIndex              = "emit-pk-index"
+	flagSampleTables             = "sample-tables"
+	flagSampleTablesSeed         = "sample-tables-seed"
+	flagSampleFraction           = "sample-fraction"
+	flagCheckpoint               = "checkpoint"
+	flagEnsureTrailingNewline    = "ensure-trailing-newline"
+	flagPreserveTiDBHandles      = "preserve-tidb-handles"
+	flagParquetRowGroupSize      = "parquet-row-group-size"
+	flagMaxRowsPerSecond         = "max-rows-per-second"
+	flagMaxBytesPerSecond        = "max-bytes-per-second"
+	flagProgressInterval         = "progress-interval"
+	flagMaxRetries               = "max-retries"
+	flagRetryableErrors          = "retryable-errors"
 
 	// FlagHelp represents the help flag
 	FlagHelp = "help"
@@ -86,14 +241,48 @@ type Config struct {
 	NoSchemas                bool
 	NoData                   bool
 	CompleteInsert           bool
+	SingleRowInsert          bool
+	DedupSchema              bool
+	LargestFirst             bool
+	BinarySafeStrings        bool
+	ChunkMetadata            bool
+	NoDataMarkers            bool
+	MigrationLayout          bool
+	AnnotateFiles            bool
+	BinaryModeHeader         bool
+	EmitChecksums            bool
+	RecordUncompressedSize   bool
+	ServerSideDump           bool
+	DumpStats                bool
+	DedupByPrimaryKey        bool
+	EmitCatalog              bool
+	NoCreateDatabase         bool
+	SkipEstimate             bool
+	EmitVerificationSample   bool
+	PerDatabaseMetadata      bool
+	SkipWriteCheck           bool
+	TransactionPerTable      bool
+	SkipColumnTypesInSchema  bool
+	EmitStatsCSV             bool
+	VerifyChunkCount         bool
+	LoadOnly                 bool
+	StripPartitioning        bool
+	StripColumnComments      bool
+	StripTableComments       bool
+	NormalizeSchema          bool
+	PerChunkBinlogPos        bool
+	GenerateLightningConfig  bool
+	RecordConfig             bool
 	TransactionalConsistency bool
 	EscapeBackslash          bool
 	DumpEmptyDatabase        bool
 	PosAfterConnect          bool
-	CompressType             storage.CompressType
+	CompressType             CompressType
+	CompressDictionary       bool
 
 	Host     string
 	Port     int
+	Hosts    []string
 	Threads  int
 	User     string
 	Password string `json:"-"`
@@ -102,6 +291,7 @@ type Config struct {
 		CertPath string
 		KeyPath  string
 	}
+	HDFS HDFSConfig
 
 	LogLevel      string
 	LogFile       string
@@ -114,22 +304,351 @@ type Config struct {
 	SQL           string
 	CsvSeparator  string
 	CsvDelimiter  string
+	TimeColumn    string
+	TimeFrom      string
+	TimeTo        string
 	Databases     []string
 
 	TableFilter        filter.Filter `json:"-"`
 	Where              string
 	FileType           string
+	CsvInvalidUTF8     string
+	DecimalFormat      string
+	FloatFormat        string
 	ServerInfo         ServerInfo
 	Logger             *zap.Logger        `json:"-"`
 	OutputFileTemplate *template.Template `json:"-"`
 	Rows               uint64
 	ReadTimeout        time.Duration
+	RampUpDuration     time.Duration
 	TiDBMemQuotaQuery  uint64
 	FileSize           uint64
 	StatementSize      uint64
 	SessionParams      map[string]interface{}
 	Labels             prometheus.Labels `json:"-"`
 	Tables             DatabaseTables
+
+	// OnFinish is called with the summary of the dump before Dump() returns
+	OnFinish func(result DumpResult) `json:"-"`
+	// OnProgress is called with the progress of the dump every ProgressInterval, including the table chunks being
+	// written. It's called synchronously by the progress goroutine, so it should return quickly
+	OnProgress func(progress DumpProgress) `json:"-"`
+	// ProgressInterval is how often the progress is logged and passed to OnProgress. With OnProgress, the progress
+	// is logged no more often than every 2 minutes
+	ProgressInterval time.Duration
+	// LogHook is called with each log entry at or above LogLevel and its fields, in addition to the logger.
+	// It's called synchronously by the logging goroutine, so it should return quickly
+	LogHook func(level, msg string, fields map[string]interface{}) `json:"-"`
+
+	// PreCheckTables is the integrity probe run on each table before dumping it, can be "", "quick" or "full"
+	PreCheckTables string
+	// PreCheckFailureMode decides whether to "abort" the dump or "skip" the table when PreCheckTables fails
+	PreCheckFailureMode string
+
+	// GCSafePointUpdateRetries is the number of retries to update the service GC safe point in each round
+	GCSafePointUpdateRetries int
+	// GCSafePointFailureAction decides whether to "abort" the dump or "continue" when the service GC safe point
+	// still can't be updated after all the retries
+	GCSafePointFailureAction string
+	// PDAddrs are the addresses of the PD of the TiDB cluster to update the service GC safe point with,
+	// they're fetched from INFORMATION_SCHEMA.CLUSTER_INFO if empty
+	PDAddrs []string
+	// BinaryEncoding is the encoding of the bytes columns, can be BinaryEncodingHex, BinaryEncodingBase64 or
+	// BinaryEncodingRaw. By default they're written in hex in sql files and raw in csv files
+	BinaryEncoding string
+
+	// ColumnGroups splits the tables vertically, database -> table -> column groups.
+	// Every column group is dumped into its own data files with the primary key columns to join back.
+	ColumnGroups map[string]map[string][]ColumnGroup
+
+	// TableThreads limits how many data chunks of a table are dumped concurrently, database -> table -> threads.
+	// The chunks still share the Threads writers with the other tables, so a value above Threads has no effect,
+	// and the writers may idle while the chunks of a limited table are being dispatched.
+	TableThreads map[string]map[string]int
+
+	// ChunkExpressions splits the tables into chunks by an integer expression of their columns instead of
+	// the primary key, database -> table -> expression. It should be deterministic and indexable to be efficient
+	ChunkExpressions map[string]map[string]string
+
+	// TableRows overrides Rows for some tables, database -> table -> rows of each chunk
+	TableRows map[string]map[string]uint64
+	// ChunkByFileSize splits the tables which aren't in TableRows into chunks of about FileSize bytes instead of
+	// Rows rows, the rows of each chunk are estimated by the average row length of the table
+	ChunkByFileSize bool
+
+	// CollationAllowlist are the collations allowed in the tables and columns. The others are reported, or rewritten
+	// to DefaultCollation in the CREATE TABLE statements if CollationMode is "rewrite". The data isn't affected
+	CollationAllowlist []string
+	CollationMode      string
+	DefaultCollation   string
+
+	// VerifyChunkCountRetries is how many times a table is dumped again with VerifyChunkCount
+	// if the chunks written of it don't match the planned ones
+	VerifyChunkCountRetries int
+
+	// IdentifierQuote is how the identifiers are quoted in the INSERT statements and the schema files, it's
+	// "backtick", "double-quote" or "none". The queries to the server always quote the identifiers by backticks
+	IdentifierQuote string
+
+	// TargetDSN is the DSN of a MySQL compatible database to load the dumped schemas and data into while they're
+	// dumped. The files are still written unless LoadOnly. It's excluded from json since it has the password
+	TargetDSN string `json:"-"`
+
+	// ErrorReportFile is the file to write the report of the failure into if Dump fails. It's written into
+	// the output storage if it's relative, or into the local disk if it's absolute
+	ErrorReportFile string
+
+	// SafeModeRows is how many rows of each table are written by REPLACE INTO instead of INSERT INTO, so the rows
+	// can be replayed again by DM when the binlog position is before the data. The rows written first are in safe
+	// mode, and it's SafeModeWholeTable for all the rows. It's 0 if no row is in safe mode
+	SafeModeRows int64
+	// InsertMethod is the statement which the rows are written by in sql files, InsertMethodInsert,
+	// InsertMethodInsertIgnore or InsertMethodReplace, so the files can be loaded into a target with partial data
+	InsertMethod string
+
+	// IncrementalAgainst is the catalog of a previous dump. The data of the tables whose update time and checksum
+	// in information_schema are the same as the ones in it isn't dumped again, but referred to the previous dump
+	IncrementalAgainst string
+	// ImportIntoCompat is the version of the target TiDB. The data files are named to be matched by the globs of
+	// `IMPORT INTO`, and the statements loading them are written into import-into.sql
+	ImportIntoCompat string
+	// ColumnTransforms rewrite the raw values of some columns before they're encoded into the output, e.g. to mask
+	// the PII, keyed by `db.table.column`. A transform is never called with NULL, and the value it returns is written
+	// as NULL if it's nil. The values of the numeric columns are written as is, so they must stay numbers.
+	// The argument is owned by the driver, so it must not be modified or retained.
+	ColumnTransforms map[string]func(value []byte) []byte `json:"-"`
+	// InvalidEnumHandling is how to write the invalid values of ENUM columns, which are read as the empty strings
+	InvalidEnumHandling string
+	// HashPrefixFiles is the number of the hashed prefixes like `000/` which the data files are distributed into,
+	// 0 writes them directly into the output directory
+	HashPrefixFiles int
+	// SubsetSeed is the table and the primary key values in the format of `db.table:pk1,pk2` which the dumped rows
+	// are reached from by the foreign keys, the data of the tables not reached isn't dumped
+	SubsetSeed string
+	// SubsetMaxDepth is the most foreign keys followed from the seed to the rows referencing the reached rows,
+	// and SubsetMaxRows is the most rows read in the traversal
+	SubsetMaxDepth int
+	SubsetMaxRows  int
+	// RowCountTrailer records the rows written in each data file, by the trailer `-- rows: N` of the sql files
+	// and by the `.rows` sidecars of the csv files
+	RowCountTrailer bool
+	// ColumnCountMismatch is what to do if the result of a chunk has a different number of columns from the column types
+	// of its table, which are changed by DDL during the dump
+	ColumnCountMismatch string
+	// LowercaseIdentifiers lowercases the database, table and column names in the schema files, the data files
+	// and the file names, for the target with lower_case_table_names=1
+	LowercaseIdentifiers bool
+	// EmitDependencyGraph writes the dumped tables and views with their dependencies by the foreign keys and
+	// the view definitions, so the consumers can compute a safe order to restore them
+	EmitDependencyGraph bool
+	// MaxReplicaLagSeconds pauses the writers while the replication lag of the source replica exceeds it,
+	// 0 means the lag isn't checked
+	MaxReplicaLagSeconds int
+	// EmitConstraints writes the nullability and the default values of the columns and the CHECK constraints
+	// of each table from information_schema into a sidecar
+	EmitConstraints bool
+	// MaxFieldBytes truncates the string and binary values longer than it in the csv files, it's lossy.
+	// 0 means the values aren't truncated
+	MaxFieldBytes int
+	// PartitionByColumn routes the rows of a table to the Hive-style directories `column=value` by the value
+	// of the column, in the format of `db.table:column`
+	PartitionByColumn string
+	// PartitionMaxOpenFiles is the maximum number of the partition files open at the same time in each writer
+	// with PartitionByColumn, the least recently used one is closed to open a new one
+	PartitionMaxOpenFiles int
+	// VerifyCoverage checks the chunks planned for each table cover the whole key space without gaps or overlaps
+	// before they're dumped, and fails the dump otherwise
+	VerifyCoverage bool
+	// ConnectionAttributes identify the connections of the dump, like the program name and the job id,
+	// they're set as the user variables of each connection opened by dumpling
+	ConnectionAttributes map[string]string
+	// SplitSchemaByType writes the schema files of each object type into its own directory,
+	// like `tables/` and `views/`, the data files aren't affected
+	SplitSchemaByType bool
+	// ConsistencyCheckOnly sets up the consistency and records the global metadata, then tears it down
+	// without dumping anything, to validate the permissions and the consistency behavior
+	ConsistencyCheckOnly bool
+	// PartitionFilter selects the partitions of a table to dump by an expression on the columns of
+	// information_schema.PARTITIONS, in the format of `db.table:expr`
+	PartitionFilter string
+	// ExclusiveTarget writes an advisory lock into the output to prevent the concurrent dumps to it,
+	// the dump refuses to start if the lock is held by another dump which isn't stale
+	ExclusiveTarget bool
+	// ExclusiveTargetForce takes the lock of the output over even if it's held by another dump
+	ExclusiveTargetForce bool
+	// ExclusiveTargetStaleAfter is how long the lock isn't refreshed before it's regarded as stale
+	ExclusiveTargetStaleAfter time.Duration
+	// NullsHandling is how the rows whose chunk key is NULL are dumped when a table is split by an integer key,
+	// they're dumped by the first or the last chunk, a dedicated chunk, or excluded
+	NullsHandling string
+	// KafkaBrokers and KafkaTopic produce the rows dumped into the topic, one message per row whose value is
+	// the JSON object of the row in the data file. The files are still written unless KafkaOnly
+	KafkaBrokers []string
+	KafkaTopic   string
+	// KafkaKeyColumn is the column whose value is the key of the messages, the primary key if it's empty
+	KafkaKeyColumn string
+	KafkaOnly      bool
+	// UseCoveringIndex selects the rows of the column groups or the tables with skipped columns by the secondary
+	// index covering the selected columns, which is cheaper than reading the whole rows
+	UseCoveringIndex bool
+	// EmitRestoreAsserts writes a statement per dumped table which fails if the restored table doesn't have the rows
+	// written by the dump
+	EmitRestoreAsserts bool
+	// OrderByCollation is the collation which the string columns are ordered by in the data queries, so the order
+	// doesn't depend on the collation of the session. OrderByCollationBinary is the binary collation of each column
+	OrderByCollation string
+	// EmitPKIndex writes the primary keys of the rows of each table into a compact binary index, so the primary
+	// keys of two dumps can be diffed without reading the data files
+	EmitPKIndex bool
+	// SampleTables only dumps a random subset of the base tables after filtering, which is the number of the tables
+	// like "10" or the percentage of them like "5%". The tables are selected by SampleTablesSeed, a random seed if it's 0
+	SampleTables     string
+	SampleTablesSeed int64
+	// SampleFraction only dumps about the fraction of the rows of each table, e.g. 0.05. The same rows are selected
+	// every time by the hash of their primary keys. The rows are sampled independently in each table, so the
+	// foreign keys of the sampled rows may refer to the rows which aren't dumped
+	SampleFraction float64
+	// Checkpoint is the path of the checkpoint in the output storage, which records the chunks written. The dump is
+	// resumed from it if it exists, the chunks written before are skipped and the snapshot is reused
+	Checkpoint string
+	// EnsureTrailingNewline makes every schema and data file end with exactly one newline, since the strict parsers
+	// reject a last line without it. The parquet files are binary and aren't affected
+	EnsureTrailingNewline bool
+	// PreserveTiDBHandles keeps the handles of the TiDB tables with AUTO_RANDOM or SHARD_ROW_ID_BITS after they're
+	// restored, `_tidb_rowid` of the SHARD_ROW_ID_BITS tables is dumped as an extra column
+	PreserveTiDBHandles bool
+	// ParquetRowGroupSize is the number of the rows in a row group of the parquet files
+	ParquetRowGroupSize uint64
+	// MaxRowsPerSecond and MaxBytesPerSecond limit the rows and bytes dumped per second by all the writers,
+	// they're unlimited if 0
+	MaxRowsPerSecond  uint64
+	MaxBytesPerSecond uint64
+	// MaxRetries is how many times a chunk query is retried after a retryable error, on a rebuilt connection
+	MaxRetries int
+	// RetryableErrors are the MySQL error codes which the chunk queries are retried on, besides the connection
+	// errors and the errors known to be transient by dbutil.IsRetryableError
+	RetryableErrors []uint16
+
+	// MaterializePartitionColumn is the name of the extra column holding the partition name of each row
+	// of partitioned tables, it's not dumped if empty
+	MaterializePartitionColumn string
+
+	// StaticTableList is the qualified names of the tables to dump. If it's set, the tables are dumped as is
+	// without listing the databases and tables, nor filtering them, which requires fewer privileges.
+	StaticTableList []string
+	// TableListFile is the path of a file listing the `db.table` and `db.*` entries to dump, one per line.
+	// Only the listed tables which also match TableFilter are dumped.
+	TableListFile string
+
+	// OutputKeyColumns prepends a key column joining the values of the given columns to each row in csv files,
+	// database -> table -> key columns. The key columns are still dumped as ordinary columns.
+	OutputKeyColumns map[string]map[string][]string
+	// OutputKeySeparator joins the values of OutputKeyColumns
+	OutputKeySeparator string
+
+	// RecentPartitions dumps only the data of the last N partitions in definition order of partitioned tables
+	// if it's positive. All the partitions are dumped if a table has no more than N partitions.
+	RecentPartitions int
+
+	// MemoryWatermark scales the writers taking tasks between MinThreads and Threads by the memory in use of the
+	// Go runtime, they're throttled while it exceeds the watermark in bytes. The writers aren't scaled if it's 0
+	MemoryWatermark uint64
+	MinThreads      int
+	// MinFreeSpace is the free space in bytes to keep on the local output file system, the dump is aborted
+	// when the free space drops below it. It's not checked if 0
+	MinFreeSpace uint64
+	// MaxEstimatedBytes aborts the dump before reading any data if the estimated data size of all the tables
+	// exceeds it. It's not checked if 0
+	MaxEstimatedBytes uint64
+
+	// RowsPerTransaction wraps the INSERT statements of every N rows in sql files in BEGIN; and COMMIT;
+	// to bound the transactions during restoration. The statements aren't wrapped if 0
+	RowsPerTransaction uint64
+
+	// FileMode is the permission of the files written to the local output directory.
+	// The default permission of the storage is used if 0
+	FileMode os.FileMode
+
+	// ChunkTimeout abandons a chunk split by an integer column if it isn't dumped in time, and dumps its range
+	// in smaller sub-chunks in parallel instead. It's disabled if 0
+	ChunkTimeout time.Duration
+	// QueryTimeout bounds each statement of the tables, i.e. the bounds and the estimated rows of the chunks,
+	// the table regions of TiDB, SHOW CREATE TABLE and the chunk queries until they return. It's disabled if 0
+	QueryTimeout time.Duration
+	// PerTableBudget is the wall-clock budget of dumping the data of each table since its first chunk is written,
+	// the chunks not started before it elapses are skipped and the table is flagged partial. It's disabled if 0
+	PerTableBudget time.Duration
+
+	// OutputFIFO is the path of a pre-created FIFO to stream all the files into instead of OutputDirPath.
+	// The files are written one after another by one thread, each after a line of fifoFileHeader
+	OutputFIFO string
+	// OutputMode is OutputModeFiles to write every schema and chunk into its own file, or OutputModeSingle to merge
+	// the sql files into SingleOutputFile in the order of the tasks, which is "-" for stdout
+	OutputMode       string
+	SingleOutputFile string
+	// OnTableError decides what to do when a table is dropped or altered during the dump, so its queries fail with
+	// a table or column not exists error. It can be TableErrorFail, TableErrorSkip to skip the table and record it
+	// in the metadata, or TableErrorRetrySnapshot to dump the table again at the snapshot of TiDB before skipping it
+	OnTableError string
+
+	// VerificationSampleInterval samples about one in every N primary keys with EmitVerificationSample
+	VerificationSampleInterval uint64
+
+	// ViewMode decides how the views are dumped, can be "definition", "materialize" or "skip".
+	// It's derived from NoViews if it's empty, and NoViews is set by it otherwise
+	ViewMode string
+	// DumpRoutines, DumpTriggers and DumpEvents dump the stored procedures and functions, the triggers of the dumped
+	// tables and the events of each database after the tables and the views. They're skipped on TiDB
+	DumpRoutines bool
+	DumpTriggers bool
+	DumpEvents   bool
+	// DumpSequences dumps the sequences of each database before its tables, which may take their default values
+	// from the sequences. Only TiDB v4.0+ and MariaDB v10.3+ have sequences
+	DumpSequences bool
+
+	// EncryptMethod encrypts every file written to the output storage after it's compressed, by the hex encoded
+	// EncryptKey or a data key generated by the KMS key EncryptKMSKeyID. The checksum files aren't encrypted
+	EncryptMethod   string
+	EncryptKey      string `json:"-"`
+	EncryptKMSKeyID string
+
+	// MaxConcurrentUploads bounds the requests in flight to the output storage, independent of Threads.
+	// It's unlimited if 0
+	MaxConcurrentUploads int
+
+	// JobIndex and JobCount split the tables into JobCount disjoint jobs by the hash of their names,
+	// and only the tables of the job JobIndex are dumped. The tables aren't split if JobCount is 0 or 1
+	JobIndex int
+	JobCount int
+
+	// NamedQueries dumps the result of each SELECT statement as a table with the schema inferred from the result,
+	// instead of the databases and tables. The results aren't split into chunks
+	NamedQueries []NamedQuery
+
+	// SnapshotTime is the time when the consistent snapshot of the dump is taken. It's set by Dumper,
+	// and written as the source time of the rows in change-feed files if Snapshot isn't a TSO
+	SnapshotTime time.Time `json:"-"`
+
+	// SkipColumnTypes are the data types of the columns which aren't dumped in all the tables, e.g. BLOB and JSON.
+	// BLOB and TEXT also match their TINY, MEDIUM and LONG variants. The columns are kept in the CREATE TABLE
+	// statements unless SkipColumnTypesInSchema is set
+	SkipColumnTypes []string
+	// ColumnSelectors are the columns to dump of some tables, `db.table` -> columns. The other columns aren't
+	// selected, and they're kept in the CREATE TABLE statements unless ColumnSelectorsInSchema is set
+	ColumnSelectors         map[string][]string
+	ColumnSelectorsInSchema bool
+
+	// ForceEngine, ForceCharset and ForceCollation rewrite the table options in the emitted CREATE TABLE statements
+	ForceEngine    string
+	ForceCharset   string
+	ForceCollation string
+	// ForceColumnCharset also rewrites the character sets and collations of the columns
+	ForceColumnCharset bool
+
+	// DB is the connection pool provided by the caller. If it's set, Dumpling takes the connections from it instead
+	// of opening a pool with the DSN built from the config, and it's not closed by Dumper.Close(). The connections
+	// are discarded from it after Dumpling uses them, since the session params like tidb_snapshot are set on them.
+	DB *sql.DB `json:"-"`
 }
 
 // DefaultConfig returns the default export Config for dumpling
@@ -163,21 +682,118 @@ func DefaultConfig() *Config {
 		SQL:                "",
 		TableFilter:        allFilter,
 		DumpEmptyDatabase:  true,
+		DumpSequences:      true,
 		SessionParams:      make(map[string]interface{}),
 		OutputFileTemplate: DefaultOutputFileTemplate,
 		PosAfterConnect:    false,
+
+		PreCheckFailureMode: PreCheckFailureAbort,
+
+		GCSafePointUpdateRetries: defaultGCSafePointUpdateRetries,
+		GCSafePointFailureAction: GCSafePointFailureAbort,
+
+		MaxRetries:      defaultMaxRetries,
+		RetryableErrors: defaultRetryableErrors(),
+
+		OutputKeySeparator: defaultOutputKeySeparator,
+
+		VerificationSampleInterval: defaultVerificationSampleInterval,
+
+		VerifyChunkCountRetries: defaultVerifyChunkCountRetries,
+		IdentifierQuote:         IdentifierQuoteBacktick,
+
+		InvalidEnumHandling: InvalidEnumKeep,
+		InsertMethod:        InsertMethodInsert,
+
+		OutputMode:       OutputModeFiles,
+		SingleOutputFile: defaultSingleOutputFile,
+		OnTableError:     TableErrorFail,
+
+		SubsetMaxDepth: defaultSubsetMaxDepth,
+		SubsetMaxRows:  defaultSubsetMaxRows,
+
+		ColumnCountMismatch: ColumnCountMismatchFail,
+
+		PartitionMaxOpenFiles: defaultPartitionMaxOpenFiles,
+
+		ExclusiveTargetStaleAfter: defaultExclusiveTargetStaleAfter,
+		NullsHandling:             NullsHandlingFirst,
+		EnsureTrailingNewline:     true,
+		ParquetRowGroupSize:       defaultParquetRowGroupSize,
+		ProgressInterval:          logProgressTick,
 	}
 }
 
-// String returns dumpling's config in json format
+// String returns dumpling's config in json format, with the credentials redacted
 func (conf *Config) String() string {
-	cfg, err := json.Marshal(conf)
+	cfg, err := json.Marshal(conf.redacted())
 	if err != nil && conf.Logger != nil {
 		conf.Logger.Error("fail to marshal config to json", zap.Error(err))
 	}
 	return string(cfg)
 }
 
+// redacted returns a shallow copy of the config whose storage credentials are hidden.
+// Password and the other credentials are already excluded from json.
+func (conf *Config) redacted() *Config {
+	cfg := *conf
+	if cfg.S3.AccessKey != "" {
+		cfg.S3.AccessKey = redactedValue
+	}
+	if cfg.S3.SecretAccessKey != "" {
+		cfg.S3.SecretAccessKey = redactedValue
+	}
+	cfg.OutputDirPath = redactStorageURL(cfg.OutputDirPath)
+	return &cfg
+}
+
+// redactStorageURL hides the values of the query parameters of a storage URL, like
+// s3://bucket/prefix?access-key=...&secret-access-key=..., which carry the credentials of the storage
+func redactStorageURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		keys[i] = url.QueryEscape(key) + "=" + redactedValue
+	}
+	u.RawQuery = strings.Join(keys, "&")
+	return u.String()
+}
+
+// Hash returns the sha256 of the redacted config. The fields which are decided during the dump
+// like the snapshot, server info and the table list are excluded, so the same logical configs
+// always hash equally.
+func (conf *Config) Hash() (string, error) {
+	cfg := conf.redacted()
+	cfg.Snapshot = ""
+	cfg.ServerInfo = ServerInfo{}
+	cfg.Tables = nil
+	if len(cfg.Hosts) > 0 {
+		// the host is chosen from the candidates during the dump
+		cfg.Host, cfg.Port = "", 0
+	}
+	if _, ok := cfg.SessionParams[snapshotSessionParam]; ok {
+		cfg.SessionParams = make(map[string]interface{}, len(conf.SessionParams))
+		for k, v := range conf.SessionParams {
+			if k != snapshotSessionParam {
+				cfg.SessionParams[k] = v
+			}
+		}
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
 // GetDSN generates DSN from Config
 func (conf *Config) GetDSN(db string) string {
 	// maxAllowedPacket=0 can be used to automatically fetch the max_allowed_packet variable from server on every connection.
@@ -190,6 +806,16 @@ func (conf *Config) GetDSN(db string) string {
 	if conf.AllowCleartextPasswords {
 		dsn += "&allowCleartextPasswords=1"
 	}
+	// the driver doesn't send the connection attributes in the handshake, so they're set as the user variables
+	// on connecting, which can be found in performance_schema.user_variables_by_thread
+	names := make([]string, 0, len(conf.ConnectionAttributes))
+	for name := range conf.ConnectionAttributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		dsn += fmt.Sprintf("&@%s=%s", name, url.QueryEscape(wrapStringWith(conf.ConnectionAttributes[name], "'")))
+	}
 	return dsn
 }
 
@@ -214,14 +840,14 @@ func (conf *Config) DefineFlags(flags *pflag.FlagSet) {
 	flags.String(flagLoglevel, "info", "Log level: {debug|info|warn|error|dpanic|panic|fatal}")
 	flags.StringP(flagLogfile, "L", "", "Log file `path`, leave empty to write to console")
 	flags.String(flagLogfmt, "text", "Log `format`: {text|json}")
-	flags.String(flagConsistency, consistencyTypeAuto, "Consistency level during dumping: {auto|none|flush|lock|snapshot}")
+	flags.String(flagConsistency, consistencyTypeAuto, "Consistency level during dumping: {auto|none|flush|lock|snapshot|consistent-snapshot}")
 	flags.String(flagSnapshot, "", "Snapshot position (uint64 or MySQL style string timestamp). Valid only when consistency=snapshot")
 	flags.BoolP(flagNoViews, "W", true, "Do not dump views")
 	flags.String(flagStatusAddr, ":8281", "dumpling API server and pprof addr")
 	flags.Uint64P(flagRows, "r", UnspecifiedSize, "Split table into chunks of this many rows, default unlimited")
 	flags.String(flagWhere, "", "Dump only selected records")
 	flags.Bool(flagEscapeBackslash, true, "use backslash to escape special characters")
-	flags.String(flagFiletype, "", "The type of export file (sql/csv)")
+	flags.String(flagFiletype, "", "The type of export file (sql/csv/mongo-json/change-feed/parquet/jsonl)")
 	flags.Bool(flagNoHeader, false, "whether not to dump CSV table header")
 	flags.BoolP(flagNoSchemas, "m", false, "Do not dump table schemas with the data")
 	flags.BoolP(flagNoData, "d", false, "Do not dump table data")
@@ -239,13 +865,258 @@ func (conf *Config) DefineFlags(flags *pflag.FlagSet) {
 	flags.String(flagCsvDelimiter, "\"", "The delimiter for values in csv files, default '\"'")
 	flags.String(flagOutputFilenameTemplate, "", "The output filename template (without file extension)")
 	flags.Bool(flagCompleteInsert, false, "Use complete INSERT statements that include column names")
+	flags.Bool(flagExtendedInsert, true, "Use multiple-row INSERT syntax. Set it to false to write one INSERT statement per row")
 	flags.StringToString(flagParams, nil, `Extra session variables used while dumping, accepted format: --params "character_set_client=latin1,character_set_connection=latin1"`)
 	flags.Bool(FlagHelp, false, "Print help message and quit")
 	flags.Duration(flagReadTimeout, 15*time.Minute, "I/O read timeout for db connection.")
 	_ = flags.MarkHidden(flagReadTimeout)
 	flags.Bool(flagTransactionalConsistency, true, "Only support transactional consistency")
 	_ = flags.MarkHidden(flagTransactionalConsistency)
-	flags.StringP(flagCompress, "c", "", "Compress output file type, support 'gzip', 'no-compression' now")
+	flags.StringP(flagCompress, "c", "", "Compress output file type, support 'gzip', 'snappy', 'zstd', 'no-compression' now")
+	flags.Bool(flagDedupSchema, false, "Record the tables whose schema is identical to an emitted one in "+schemaDedupManifestPath+
+		" with the canonical schema file. Their schema files are still written in full")
+	flags.Bool(flagLargestFirst, false, "Dump the tables in descending order of estimated size")
+	flags.Bool(flagBinarySafeStrings, false, "Write character string columns as hex literals in sql files and base64 in csv files, to keep arbitrary bytes safe")
+	flags.String(flagTimeColumn, "", "Only dump rows whose time column is between --time-from and --time-to. The column must be indexed in all dumped tables")
+	flags.String(flagTimeFrom, "", "The inclusive lower bound of --time-column, such as '2021-01-01 00:00:00'")
+	flags.String(flagTimeTo, "", "The inclusive upper bound of --time-column, such as '2021-01-07 23:59:59'")
+	flags.String(flagBlockAllowListFile, "", "TiDB-Binlog/DM compatible TOML file of do-dbs/do-tables/ignore-dbs/ignore-tables rules to select which tables to dump")
+	flags.String(flagBinaryEncoding, "", "The encoding of the binary columns, can be 'hex', 'base64' (written as FROM_BASE64('...') in sql files) or 'raw' (escaped bytes). "+
+		"Default is 'hex' for sql files and 'raw' for csv files")
+	flags.String(flagCsvInvalidUTF8, "", "How to handle the string values which aren't valid UTF-8 in csv files, can be 'error', 'skip' (skip the row) or 'replace' (replace the invalid bytes with U+FFFD). Default writes them as is")
+	flags.Bool(flagChunkMetadata, false, "Write a .meta sidecar for each data file with the rows written and the min/max values of the chunk boundary column")
+	flags.String(flagPreCheckTables, "", "Check the integrity of each table before dumping it, can be 'quick' (CHECK TABLE ... QUICK for MySQL, skipped for TiDB) or 'full' (CHECK TABLE for MySQL, ADMIN CHECK TABLE for TiDB which is expensive)")
+	flags.String(flagPreCheckFailureMode, PreCheckFailureAbort, "What to do when --pre-check-tables fails, can be 'abort' or 'skip' (skip dumping the table)")
+	flags.Int(flagGCSafePointRetries, defaultGCSafePointUpdateRetries, "The number of retries to update the service GC safe point of TiDB in each round")
+	flags.String(flagGCSafePointFailureAction, GCSafePointFailureAbort, "What to do when the service GC safe point of TiDB can't be updated after all the retries, can be 'abort' (cancel the dump) or 'continue'")
+	flags.StringSlice(flagPDAddrs, nil, "The PD addresses of the TiDB cluster to update the service GC safe point with, instead of the ones fetched from TiDB, "+
+		"e.g. when dumping through a proxy in front of several clusters. The dump fails if they don't belong to the cluster of the TiDB")
+	flags.StringArray(flagColumnGroups, nil, "Dump the column groups of a table into separate data files, in the format of 'db.table:groupA=col1,col2;groupB=col3'. "+
+		"The primary key columns are always dumped in every group to join back, so the table must have a primary key. Can be specified multiple times")
+	flags.Bool(flagNoDataMarkers, false, "With --no-data, record every table in "+schemaOnlyManifestPath+" as dumped with schema only and 0 rows")
+	flags.Bool(flagMigrationLayout, false, "Write each database, table, view, trigger and routine schema into its own 'V{n}__create_{db}_{table}.sql' file for migration tools like Flyway, "+
+		"numbered in the order of databases, routines, tables by foreign keys, views by their references, then triggers and events")
+	flags.Bool(flagRecordConfig, false, "Record the config with credentials redacted and its hash in the metadata file, to tell whether two dumps use the same settings")
+	flags.Duration(flagRampUpDuration, 0, "Start the writers gradually over this duration instead of all at once, e.g. '1m'. The writers still connect to the database at the beginning")
+	flags.String(flagMaterializePartition, "", "Append the partition name to each row of partitioned tables as an extra column with this name. "+
+		"Every partition is dumped as a chunk, and the column isn't in the table schema files")
+	flags.String(flagMemoryWatermark, "", "Throttle the writers down to --"+flagMinThreads+" while the heap in use exceeds this size, e.g. '2GiB', "+
+		"and activate them again after it drops. The writers aren't throttled if it's empty")
+	flags.Int(flagMinThreads, 0, "The minimum number of the writers taking tasks with --"+flagMemoryWatermark+", 1 if it's 0")
+	flags.String(flagMinFreeSpace, "", "Abort the dump when the free space of the local output directory drops below this size, e.g. '10GiB'. "+
+		"The partially written file is removed")
+	flags.String(flagForceEngine, "", "Rewrite the ENGINE option of the dumped CREATE TABLE statements, e.g. 'InnoDB'")
+	flags.String(flagForceCharset, "", "Rewrite the DEFAULT CHARSET option of the dumped CREATE TABLE statements, e.g. 'utf8mb4'")
+	flags.String(flagForceCollation, "", "Rewrite the COLLATE option of the dumped CREATE TABLE statements, e.g. 'utf8mb4_bin'")
+	flags.Bool(flagForceColumnCharset, false, "Also rewrite the character sets and collations of the columns with --force-charset and --force-collation")
+	flags.Bool(flagAnnotateFiles, false, "Begin each sql data file with a comment header summarizing the table, including the estimated rows, columns and indexes")
+	flags.StringArray(flagTableThreads, nil, "Limit how many chunks of a table are dumped concurrently, in the format of 'db.table:n'. "+
+		"The chunks still share the --threads writers with the other tables, so n above --threads has no effect. Can be specified multiple times")
+	flags.Bool(flagBinaryModeHeader, false, "Begin each sql data file with a comment noting that it can be replayed by the mysql client without --binary-mode, "+
+		"and write the string values containing NUL, CR or Ctrl-Z bytes as hex literals to make it true")
+	flags.Int(flagRecentPartitions, 0, "Only dump the data of the last N partitions in definition order of partitioned tables, "+
+		"e.g. the most recent ones of time-partitioned tables. Tables which are not partitioned are dumped as a whole")
+	flags.StringSlice(flagStaticTablesList, nil, "Comma delimited qualified table names to dump as is, without listing the databases and tables from INFORMATION_SCHEMA. "+
+		"All of them are dumped as base tables, and it can't be used with --tables-list or --filter")
+	flags.String(flagTableListFile, "", "The file listing the tables to dump, one 'db.table' or 'db.*' per line. Blank lines and lines starting with '#' are skipped. "+
+		"Only the listed tables which also match --tables-list or --filter are dumped")
+	flags.Bool(flagEmitChecksums, false, "Write the SHA-256 of every output file into "+checksumsFileName+" at the end of the dump, which can be verified by 'sha256sum -c'")
+	flags.String(flagEncryptMethod, "", "Encrypt every output file after it's compressed, can be '"+EncryptMethodAES256CTR+"' or '"+EncryptMethodAES128GCM+"'. "+
+		"The files can be decrypted by export.DecryptFile")
+	flags.String(flagEncryptKey, "", "The hex encoded key of --"+flagEncryptMethod+", 32 bytes for '"+EncryptMethodAES256CTR+"' and 16 bytes for '"+EncryptMethodAES128GCM+"'")
+	flags.String(flagEncryptKMSKeyID, "", "The AWS KMS key to generate the data key of --"+flagEncryptMethod+" by, instead of --"+flagEncryptKey+
+		". The wrapped data key is stored in the header of every file")
+	flags.StringArray(flagOutputKeyColumns, nil, "Prepend a "+outputKeyColumnName+" column joining the values of the given columns, usually the primary key, to each row in csv files, "+
+		"in the format of 'db.table:col1,col2'. Can be specified multiple times")
+	flags.String(flagOutputKeySeparator, defaultOutputKeySeparator, "The separator joining the values of --output-key-columns")
+	flags.String(flagMaxEstimatedBytes, "", "Abort the dump before reading any data if the estimated data size of all the tables exceeds this size, e.g. '500GiB'. "+
+		"The size is estimated by the table statistics, disabled by default")
+	flags.Bool(flagRecordUncompressedSize, false, "Record the uncompressed size of every compressed file in "+uncompressedSizesManifestPath+". It takes effect with --compress only")
+	flags.Bool(flagCompressDictionary, false, "Train a zstd dictionary from the beginning of the first files and compress all the files with it, "+
+		"which improves the compression ratio of many small files. It's written into "+zstdDictionaryPath+", which is required to decompress the files. "+
+		"It requires --compress zstd")
+	flags.Bool(flagServerSideDump, false, "Dump the csv data of a local MySQL server by SELECT ... INTO OUTFILE into its secure_file_priv directory, "+
+		"then move the files to the output. Fall back to dump through the connection if it's unsupported")
+	flags.Uint64(flagRowsPerTransaction, 0, "Wrap the INSERT statements of every N rows in sql files in BEGIN; and COMMIT;, which bounds the transactions when the files are restored. "+
+		"The statements are split at every N rows, disabled by default")
+	flags.Bool(flagDumpStats, false, "Write the health and modify count of the statistics of the tables into "+statsHealthManifestPath+
+		", to help to decide how to analyze the tables after restoration, and the statistics of each table at the snapshot into {db}.{table}"+tableStatsFileSuffix+
+		" by the stats dump API of TiDB, which can be loaded by LOAD STATS. It's only supported by TiDB")
+	flags.String(flagFileMode, "", "The octal permission of the files written to the local output directory, such as '0600'. "+
+		"The umask doesn't apply to it. It has no effect on the other storages")
+	flags.Bool(flagDedupByPrimaryKey, false, "Drop the rows whose primary key equals the one of the previous row in each chunk, keeping the first one. "+
+		"It's a best-effort cleanup of the tables with corrupted duplicated primary keys")
+	flags.StringSlice(flagHosts, nil, "Comma delimited host candidates in the format of 'host' or 'host:port' to try in order until one is reachable, "+
+		"instead of --host. The port is --port if it's not specified")
+	flags.Bool(flagEmitCatalog, false, "Write "+catalogPath+" describing all the databases and tables with their columns, primary keys, "+
+		"estimated and written rows, and files at the end of the dump")
+	flags.Bool(flagNoCreateDatabase, false, "Do not dump the CREATE DATABASE statements, so the tables can be restored into existing databases")
+	flags.Duration(flagChunkTimeout, 0, "Abandon a chunk if it isn't dumped in this duration, e.g. '10m', and dump its range in smaller sub-chunks in parallel instead. "+
+		"It only applies to the chunks split by an integer column with --rows and consistency snapshot or none, and isn't supported with --filesize")
+	flags.Duration(flagQueryTimeout, 0, "Fail a statement of a table if it isn't done in this duration, e.g. '5m', including the chunk queries until they return the first rows, "+
+		"which are retried on new connections with --max-retries. 0 means no timeout")
+	flags.Duration(flagPerTableBudget, 0, "The wall-clock budget of dumping the data of each table, e.g. '5m'. The chunks of a table not started before it elapses are skipped, "+
+		"and the table is flagged partial in the metadata file. The chunks are split by --rows or --table-rows")
+	flags.String(flagOutputFIFO, "", "Stream all the files into this pre-created FIFO one after another instead of --output, each after a line of '-- dumpling file: <name>'. "+
+		"The threads are forced to 1 and the failed chunks aren't retried")
+	flags.String(flagOutputMode, OutputModeFiles, "How to write the sql files, can be 'files' (a file per schema and chunk) or 'single' (merge them into --single-output-file in order, "+
+		"the schemas before the data of their tables and the views last, which can be piped into the mysql client). The chunks are still dumped by --threads in parallel, "+
+		"but they're buffered in temporary files and written one after another, so the throughput is bounded by writing the single output")
+	flags.String(flagSingleOutputFile, defaultSingleOutputFile, "The file in --output to merge the sql files into with --output-mode single, or '-' for stdout, where the log is written into stderr instead")
+	flags.String(flagOnTableError, TableErrorFail, "What to do when a table is dropped or altered during the dump, can be 'fail', 'skip' (skip the table and record it in the metadata file) "+
+		"or 'retry-snapshot' (dump the table again at the snapshot of TiDB, and skip it if it still fails). The connection errors are still retried by --max-retries")
+	flags.Bool(flagSkipEstimate, false, "Do not estimate the rows of tables by EXPLAIN, for the accounts which can't run it. "+
+		"The tables are split by assuming the values of the chunk columns are dense, so the chunks may be unbalanced")
+	flags.Bool(flagEmitVerificationSample, false, "Write "+verificationSamplePath+" with the rows and sampled primary keys of every table at the snapshot, "+
+		"for a comparator to verify the target against")
+	flags.Uint64(flagVerificationInterval, defaultVerificationSampleInterval, "Sample about one in every N primary keys with --"+flagEmitVerificationSample)
+	flags.String(flagViewMode, "", "How to dump the views, can be 'definition' (the definitions only, dumped after all the tables), "+
+		"'materialize' (base tables holding the rows of the views) or 'skip'. It overrides --"+flagNoViews+" if set")
+	flags.Bool(flagRoutines, false, "Dump the stored procedures and functions of each database after the tables and the views")
+	flags.Bool(flagTriggers, false, "Dump the triggers of the dumped tables after the tables and the views")
+	flags.Bool(flagEvents, false, "Dump the events of each database after the tables and the views")
+	flags.Bool(flagSequences, true, "Dump the sequences of each database before its tables, on TiDB v4.0+ and MariaDB v10.3+")
+	flags.Int(flagMaxConcurrentUploads, 0, "The maximum number of concurrent requests to the output storage, e.g. the PUTs of S3, "+
+		"independent of --threads. 0 means unlimited")
+	flags.Bool(flagPerDatabaseMetadata, false, "Also write the metadata of each database into <database>/"+metadataPath+
+		", with its tables, their rows dumped and the snapshot of the global metadata")
+	flags.Int(flagJobIndex, 0, "Only dump the tables of this job, between 0 and --"+flagJobCount+"-1")
+	flags.Int(flagJobCount, 0, "Split the tables into this number of disjoint jobs by the hash of their names, "+
+		"to run one dump on several machines with different --"+flagJobIndex)
+	flags.Bool(flagSkipWriteCheck, false, "Skip writing and deleting "+writeCheckPath+" in the output before dumping "+
+		"to check it's writable, e.g. for append-only storages")
+	flags.String(flagDecimalFormat, NumberFormatExact, "How to write the DECIMAL values into csv and mongo-json files, "+
+		"can be 'exact' (as the server returns them) or 'trim-zeros' (without the trailing zeros of the fraction)")
+	flags.String(flagFloatFormat, NumberFormatExact, "How to write the FLOAT and DOUBLE values into csv and mongo-json files, "+
+		"can be 'exact' (as the server returns them), 'plain' (without scientific notation) or 'scientific'")
+	flags.StringArray(flagNamedQuery, nil, "Dump the result of a SELECT statement as a table with the schema inferred from the result, "+
+		"in the format of 'db.table=SELECT ...'. It can be repeated, and only the named queries are dumped if it's set")
+	flags.Bool(flagTransactionPerTable, false, "Wrap all the INSERT statements of a table in sql files in one BEGIN; and COMMIT;. "+
+		"The data of each table must be written into one file, so it can't be used with --rows, --filesize or the other options splitting the data of a table")
+	flags.StringSlice(flagSkipColumnTypes, nil, "Comma delimited data types of the columns not to dump in all the tables, e.g. 'BLOB,TEXT,JSON'. "+
+		"BLOB and TEXT also match their TINY, MEDIUM and LONG variants")
+	flags.Bool(flagSkipColumnTypesInSchema, false, "Also drop the columns skipped by --skip-column-types, and the indexes on them, from the CREATE TABLE statements")
+	flags.StringArray(flagSelectColumns, nil, "Only dump the listed columns of a table, in the format of 'db.table:col1,col2'. Can be specified multiple times")
+	flags.Bool(flagSelectColumnsInSchema, false, "Also drop the columns not selected by --select-columns, and the indexes on them, from the CREATE TABLE statements")
+	flags.Bool(flagEmitStatsCSV, false, "Write the rows, bytes, chunks, duration and checksum of each dumped table into "+statsCSVPath+" at the end of the dump")
+	flags.StringArray(flagChunkExpression, nil, "Split a table into chunks by an integer expression instead of the primary key with --rows, "+
+		"in the format of 'db.table:expr', e.g. 'db.t:id DIV 1000000'. The expression should be deterministic and indexable")
+	flags.StringSlice(flagCollationAllowlist, nil, "Comma delimited collations allowed in the dumped tables and columns, e.g. 'utf8mb4_0900_ai_ci'. "+
+		"The others are reported or rewritten according to --collation-mode")
+	flags.String(flagCollationMode, CollationModeReport, "How to handle the collations not in --collation-allowlist, 'report' logs them, "+
+		"'rewrite' also rewrites them to --default-collation in the CREATE TABLE statements")
+	flags.String(flagDefaultCollation, "", "The collation which the collations not in --collation-allowlist are rewritten to with --collation-mode=rewrite")
+	flags.Bool(flagVerifyChunkCount, false, "Check the number of chunks written of each table matches the planned one, "+
+		"and dump the table again from scratch if it doesn't. It requires a consistency which can re-read the tables")
+	flags.Int(flagVerifyChunkCountRetries, defaultVerifyChunkCountRetries, "How many times a table is dumped again with --verify-chunk-count")
+	flags.String(flagIdentifierQuote, IdentifierQuoteBacktick, "How to quote the identifiers in the INSERT statements and the schema files, "+
+		"'backtick', 'double-quote' or 'none'. It only helps the SQL to be restored into other databases, the rest of the SQL is still MySQL's")
+	flags.String(flagTargetDSN, "", "Load the dumped schemas and data into the MySQL compatible database of this DSN while dumping, "+
+		"e.g. 'user:password@tcp(127.0.0.1:4000)/'. The schemas are loaded in order and then the data files in parallel")
+	flags.Bool(flagLoadOnly, false, "Don't write the data files into --output with --target-dsn, the schema and metadata files are still written")
+	flags.Bool(flagStripPartitioning, false, "Remove the PARTITION BY clauses from the emitted CREATE TABLE statements, "+
+		"so the partitioned tables are restored as non-partitioned tables")
+	flags.Bool(flagStripColumnComments, false, "Remove the COMMENT clauses of the columns and the indexes from the emitted CREATE TABLE statements")
+	flags.Bool(flagStripTableComments, false, "Remove the COMMENT table options from the emitted CREATE TABLE statements, the comments of the partitions are kept")
+	flags.StringSlice(flagTableRows, nil, "Comma delimited rows of each chunk of some tables in the format of 'db.table:n', "+
+		"e.g. 'db.t1:100000,db.t2:5000'. The other tables are split by --rows")
+	flags.Bool(flagChunkByFileSize, false, "Split the tables into chunks of about --filesize bytes instead of --rows rows, "+
+		"the rows of each chunk are estimated by the average row length of the table")
+	flags.String(flagErrorReportFile, "", "File to write a report of the failure into if the dump fails, "+
+		"it's written into the output directory if relative or into the local disk if absolute")
+	flags.Bool(flagNormalizeSchema, false, "Rewrite the emitted CREATE TABLE statements into a canonical format, "+
+		"so the schemas dumped from different server versions diff cleanly. Only the formatting is rewritten")
+	flags.Int64(flagSafeModeRows, 0, "How many rows of each table are written by REPLACE INTO instead of INSERT INTO, "+
+		"so DM can apply the binlog which overlaps the data. The rows written first are in safe mode, and -1 for all the rows")
+	flags.String(flagInsertMethod, InsertMethodInsert, "The statement which the rows are written by in sql files, "+
+		"'insert' for INSERT INTO, 'insert_ignore' for INSERT IGNORE INTO or 'replace' for REPLACE INTO, "+
+		"the last two can load the files into a target with some of the rows already")
+	flags.String(flagIncrementalAgainst, "", "The "+catalogPath+" of a previous dump. The data of the tables unchanged since it "+
+		"isn't dumped again, but referred to the previous dump in the new "+catalogPath+". It requires --emit-catalog")
+	flags.String(flagImportIntoCompat, "", "The version of the target TiDB, e.g. v7.5.0. Name the data files for IMPORT INTO and write the IMPORT INTO statements "+
+		"loading them into import-into.sql, so the dump can be loaded by TiDB directly")
+	flags.Bool(flagPerChunkBinlogPos, false, "Record the binlog position by SHOW MASTER STATUS before reading each chunk into the .meta sidecars of its data files. "+
+		"It runs a query for each chunk, requires --chunk-metadata and can't be used with consistency snapshot")
+	flags.Bool(flagGenerateLightningConfig, false, "Write a tidb-lightning.toml next to the metadata file to restore the dump by tidb-lightning, "+
+		"with the location, the file type and the csv options of the dump, and placeholders of the target")
+	flags.String(flagInvalidEnumHandling, InvalidEnumKeep, "How to write the invalid values (index 0) of ENUM columns which are read as empty strings "+
+		"and rejected on reimport under strict sql_mode: {keep|null|first}. 'null' writes NULL, and 'first' writes the first member of the ENUM")
+	flags.Int(flagHashPrefixFiles, 0, "Distribute the data files into N directories like 000/ by the hashes of their names, to spread the requests "+
+		"across the prefixes of S3. The actual paths are recorded in "+catalogPath+", which requires --emit-catalog")
+	flags.String(flagSubsetSeed, "", "Only dump the rows reached from the seed rows by the foreign keys, in the format of db.table:pk1,pk2. "+
+		"The rows referenced by the reached rows are always included, and the tables not reached are dumped with schema only")
+	flags.Int(flagSubsetMaxDepth, defaultSubsetMaxDepth, "The most foreign keys followed from the seed to the rows referencing the reached rows with --subset-seed")
+	flags.Int(flagSubsetMaxRows, defaultSubsetMaxRows, "The most rows read in following the foreign keys with --subset-seed, the traversal stops beyond it")
+	flags.Bool(flagRowCountTrailer, false, "Record the rows written in each data file, by the trailing comment '-- rows: N' of the sql files "+
+		"inside the compression, or by the "+rowCountSuffix+" sidecars of the csv files")
+	flags.String(flagColumnCountMismatch, ColumnCountMismatchFail, "What to do if a chunk returns a different number of columns from the column types "+
+		"of its table, which are changed by DDL during the dump: {fail|refetch}. 'refetch' writes the chunk by the columns of its result")
+	flags.Bool(flagLowercaseIdentifiers, false, "Lowercase the database, table and column names in the schema files, the data files and the file names, "+
+		"for the target with lower_case_table_names=1")
+	flags.Bool(flagEmitDependencyGraph, false, "Write "+dependencyGraphPath+" listing the dumped tables and views with their dependencies, "+
+		"the tables referenced by the foreign keys and the objects referenced by the views, to compute a safe order to restore them")
+	flags.Int(flagMaxReplicaLagSeconds, 0, "Pause the writers while Seconds_Behind_Master of the source replica exceeds it, until the replica catches up. 0 means the lag isn't checked")
+	flags.Bool(flagEmitConstraints, false, "Write the nullability and the default values of the columns and the CHECK constraints of each table "+
+		"from information_schema into `db.table"+constraintsFileSuffix+"`")
+	flags.Int(flagMaxFieldBytes, 0, "Truncate the string and binary values longer than it in the csv files, with a `"+truncatedFieldMarker+"` marker. "+
+		"It's lossy, the truncated values are counted in the summary. Can't be used with --binary-encoding hex or base64. 0 means the values aren't truncated")
+	flags.String(flagPartitionByColumn, "", "Route the rows of a table to the Hive-style directories `column=value` by the value of the column, "+
+		"in the format of `db.table:column`")
+	flags.Int(flagPartitionMaxOpenFiles, defaultPartitionMaxOpenFiles, "The maximum number of the partition files open at the same time in each writer "+
+		"with --partition-by-column, each open file buffers up to about 1 MiB of rows")
+	flags.Bool(flagVerifyCoverage, false, "Check the chunks planned for each table cover the whole key space without gaps or overlaps "+
+		"before dumping them, and fail otherwise")
+	flags.StringToString(flagConnectionAttributes, nil, "The attributes identifying the connections of the dump, which are set as the user variables of each connection, "+
+		`accepted format: --connection-attributes "program_name=dumpling,job_id=daily-backup"`)
+	flags.Bool(flagSplitSchemaByType, false, "Write the schema files of each object type into its own directory, "+
+		"like 'databases/', 'tables/' and 'views/'")
+	flags.Bool(flagConsistencyCheckOnly, false, "Only set up the consistency and record the snapshot or the binlog position into the metadata, "+
+		"then tear it down without dumping anything")
+	flags.String(flagPartitionFilter, "", "Only dump the partitions of a table whose rows of information_schema.PARTITIONS match the expression, "+
+		"in the format of `db.table:expr`, e.g. \"shop.orders:PARTITION_DESCRIPTION > '20240101'\"")
+	flags.Bool(flagExclusiveTarget, false, "Write a '"+targetLockPath+"' file into the output to prevent the concurrent dumps to it, "+
+		"and refuse to start if it's held by another dump. The lock is only best-effort on the storages other than the local directory")
+	flags.Bool(flagExclusiveTargetForce, false, "Take the lock of the output over with --exclusive-target even if it's held by another dump")
+	flags.Duration(flagExclusiveTargetStale, defaultExclusiveTargetStaleAfter, "The lock of the output with --exclusive-target is regarded as stale "+
+		"if it isn't refreshed in this duration, e.g. the dump holding it crashed")
+	flags.String(flagNullsHandling, NullsHandlingFirst, "How to dump the rows whose chunk key is NULL when a table is split into chunks, "+
+		"'first' or 'last' dumps them with the first or the last chunk, 'separate' dumps them by a dedicated chunk, 'exclude' doesn't dump them")
+	flags.StringSlice(flagKafkaBrokers, nil, "Comma delimited addresses of the kafka brokers to produce the rows into --kafka-topic, "+
+		"one message per row in the JSON of --filetype mongo-json or change-feed")
+	flags.String(flagKafkaTopic, "", "The kafka topic to produce the rows into with --kafka-brokers")
+	flags.String(flagKafkaKeyColumn, "", "The column whose value is the key of the kafka messages, the primary key of each table by default")
+	flags.Bool(flagKafkaOnly, false, "Don't write the data files into --output with --kafka-brokers, the schema and metadata files are still written")
+	flags.Bool(flagUseCoveringIndex, false, "Select the rows of the column groups or the tables with skipped columns with a USE INDEX hint "+
+		"of the secondary index covering the selected columns, for the InnoDB tables of MySQL and MariaDB")
+	flags.Bool(flagEmitRestoreAsserts, false, "Write <db>.<table>"+restoreAssertFileSuffix+" for each dumped table, whose statement fails "+
+		"if the restored table doesn't have the rows written by the dump")
+	flags.String(flagOrderByCollation, "", "Order the string columns by this collation in the data queries, e.g. 'utf8mb4_bin'. "+
+		"'"+OrderByCollationBinary+"' orders each column by the binary collation of its character set")
+	flags.Lookup(flagOrderByCollation).NoOptDefVal = OrderByCollationBinary
+	flags.Bool(flagEmitPKIndex, false, "Write the primary keys of the rows of each table into <db>.<table>"+pkIndexFileSuffix+" to diff them between the dumps")
+	flags.String(flagSampleTables, "", "Only dump a random subset of the tables after filtering, the number of the tables like '10' or the percentage like '5%'")
+	flags.Int64(flagSampleTablesSeed, 0, "The seed to select the tables with --"+flagSampleTables+", the same tables are selected with the same seed. A random seed is used if it's 0")
+	flags.Float64(flagSampleFraction, 0, "Only dump about the fraction of the rows of each table, e.g. 0.05. The same rows are selected every time by the hash of their primary keys, "+
+		"and the foreign keys of the sampled rows may refer to the rows which aren't dumped. 0 means all the rows are dumped")
+	flags.String(flagCheckpoint, "", "The path of the checkpoint in the output directory to record the chunks written, the dump is resumed from it if it exists")
+	flags.Bool(flagEnsureTrailingNewline, true, "Make every schema and data file end with exactly one newline for the strict parsers")
+	flags.Bool(flagPreserveTiDBHandles, false, "Keep the handles of the TiDB tables with AUTO_RANDOM or SHARD_ROW_ID_BITS after they're restored, "+
+		"_tidb_rowid of the SHARD_ROW_ID_BITS tables is dumped as an extra column")
+	flags.Uint64(flagParquetRowGroupSize, defaultParquetRowGroupSize, "The number of the rows in a row group of the parquet files")
+	flags.Uint64(flagMaxRowsPerSecond, 0, "Limit the rows dumped per second by all the threads, unlimited if 0")
+	flags.String(flagMaxBytesPerSecond, "", "Limit the bytes written per second by all the threads, e.g. '50MiB', unlimited if empty")
+	flags.Duration(flagProgressInterval, logProgressTick, "How often the progress is logged")
+	flags.Int(flagMaxRetries, defaultMaxRetries, "How many times a chunk query is retried after a retryable error, e.g. lost connection or region unavailable")
+	retryableErrors := make([]uint, 0, len(defaultRetryableErrors()))
+	for _, code := range defaultRetryableErrors() {
+		retryableErrors = append(retryableErrors, uint(code))
+	}
+	flags.UintSlice(flagRetryableErrors, retryableErrors, "Comma delimited MySQL error codes which the chunk queries are retried on, "+
+		"besides the connection errors and the transient errors of TiDB. The snapshot too old error 9006 is only retried while the snapshot is protected from GC")
+	flags.String(flagHDFSUser, "", "The user name used to access webhdfs:// or swebhdfs:// (https) output with simple authentication")
+	flags.String(flagHDFSDelegationToken, "", "The delegation token used to access webhdfs:// or swebhdfs:// output on a cluster secured by Kerberos. "+
+		"Kerberos (SPNEGO) authentication and keytabs aren't supported, so fetch the token beforehand, e.g. by `hdfs fetchdt`")
+	flags.String(flagHDFSCA, "", "The path of the CA certificate to verify the namenode and the datanodes of swebhdfs:// output, the system CA certificates are used by default")
 }
 
 // ParseFromFlags parses dumpling's export.Config from flags
@@ -380,6 +1251,11 @@ func (conf *Config) ParseFromFlags(flags *pflag.FlagSet) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	extendedInsert, err := flags.GetBool(flagExtendedInsert)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SingleRowInsert = !extendedInsert
 	conf.ReadTimeout, err = flags.GetDuration(flagReadTimeout)
 	if err != nil {
 		return errors.Trace(err)
@@ -392,231 +1268,1017 @@ func (conf *Config) ParseFromFlags(flags *pflag.FlagSet) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
-
-	if conf.Threads <= 0 {
-		return errors.Errorf("--threads is set to %d. It should be greater than 0", conf.Threads)
+	conf.DedupSchema, err = flags.GetBool(flagDedupSchema)
+	if err != nil {
+		return errors.Trace(err)
 	}
-	if len(conf.CsvSeparator) == 0 {
-		return errors.New("--csv-separator is set to \"\". It must not be an empty string")
+	conf.LargestFirst, err = flags.GetBool(flagLargestFirst)
+	if err != nil {
+		return errors.Trace(err)
 	}
-
-	if conf.SessionParams == nil {
-		conf.SessionParams = make(map[string]interface{})
+	conf.BinarySafeStrings, err = flags.GetBool(flagBinarySafeStrings)
+	if err != nil {
+		return errors.Trace(err)
 	}
-
-	tablesList, err := flags.GetStringSlice(flagTablesList)
+	conf.TimeColumn, err = flags.GetString(flagTimeColumn)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	fileSizeStr, err := flags.GetString(flagFilesize)
+	conf.TimeFrom, err = flags.GetString(flagTimeFrom)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	filters, err := flags.GetStringSlice(flagFilter)
+	conf.TimeTo, err = flags.GetString(flagTimeTo)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	caseSensitive, err := flags.GetBool(flagCaseSensitive)
+	conf.CsvInvalidUTF8, err = flags.GetString(flagCsvInvalidUTF8)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	outputFilenameFormat, err := flags.GetString(flagOutputFilenameTemplate)
+	conf.BinaryEncoding, err = flags.GetString(flagBinaryEncoding)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	params, err := flags.GetStringToString(flagParams)
+	conf.ChunkMetadata, err = flags.GetBool(flagChunkMetadata)
 	if err != nil {
 		return errors.Trace(err)
 	}
-
-	conf.TableFilter, err = ParseTableFilter(tablesList, filters)
+	conf.PreCheckTables, err = flags.GetString(flagPreCheckTables)
 	if err != nil {
-		return errors.Errorf("failed to parse filter: %s", err)
+		return errors.Trace(err)
 	}
-
-	if !caseSensitive {
-		conf.TableFilter = filter.CaseInsensitive(conf.TableFilter)
+	conf.PreCheckFailureMode, err = flags.GetString(flagPreCheckFailureMode)
+	if err != nil {
+		return errors.Trace(err)
 	}
-
-	conf.FileSize, err = ParseFileSize(fileSizeStr)
+	conf.GCSafePointUpdateRetries, err = flags.GetInt(flagGCSafePointRetries)
 	if err != nil {
 		return errors.Trace(err)
 	}
-
-	if outputFilenameFormat == "" && conf.SQL != "" {
-		outputFilenameFormat = DefaultAnonymousOutputFileTemplateText
+	conf.GCSafePointFailureAction, err = flags.GetString(flagGCSafePointFailureAction)
+	if err != nil {
+		return errors.Trace(err)
 	}
-	tmpl, err := ParseOutputFileTemplate(outputFilenameFormat)
+	conf.PDAddrs, err = flags.GetStringSlice(flagPDAddrs)
 	if err != nil {
-		return errors.Errorf("failed to parse output filename template (--output-filename-template '%s')\n", outputFilenameFormat)
+		return errors.Trace(err)
 	}
-	conf.OutputFileTemplate = tmpl
-
-	compressType, err := flags.GetString(flagCompress)
+	columnGroups, err := flags.GetStringArray(flagColumnGroups)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	conf.CompressType, err = ParseCompressType(compressType)
+	if len(columnGroups) > 0 {
+		conf.ColumnGroups, err = ParseColumnGroups(columnGroups)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	conf.NoDataMarkers, err = flags.GetBool(flagNoDataMarkers)
 	if err != nil {
 		return errors.Trace(err)
 	}
-
-	for k, v := range params {
-		conf.SessionParams[k] = v
+	conf.MigrationLayout, err = flags.GetBool(flagMigrationLayout)
+	if err != nil {
+		return errors.Trace(err)
 	}
-
-	err = conf.BackendOptions.ParseFromFlags(pflag.CommandLine)
+	conf.RecordConfig, err = flags.GetBool(flagRecordConfig)
 	if err != nil {
 		return errors.Trace(err)
 	}
-
-	return nil
-}
-
-// ParseFileSize parses file size from tables-list and filter arguments
-func ParseFileSize(fileSizeStr string) (uint64, error) {
-	if len(fileSizeStr) == 0 {
-		return UnspecifiedSize, nil
-	} else if fileSizeMB, err := strconv.ParseUint(fileSizeStr, 10, 64); err == nil {
-		fmt.Printf("Warning: -F without unit is not recommended, try using `-F '%dMiB'` in the future\n", fileSizeMB)
-		return fileSizeMB * units.MiB, nil
-	} else if size, err := units.RAMInBytes(fileSizeStr); err == nil {
-		return uint64(size), nil
+	conf.RampUpDuration, err = flags.GetDuration(flagRampUpDuration)
+	if err != nil {
+		return errors.Trace(err)
 	}
-	return 0, errors.Errorf("failed to parse filesize (-F '%s')", fileSizeStr)
-}
-
-// ParseTableFilter parses table filter from tables-list and filter arguments
-func ParseTableFilter(tablesList, filters []string) (filter.Filter, error) {
-	if len(tablesList) == 0 {
-		return filter.Parse(filters)
+	conf.MaterializePartitionColumn, err = flags.GetString(flagMaterializePartition)
+	if err != nil {
+		return errors.Trace(err)
 	}
-
-	// only parse -T when -f is default value. otherwise bail out.
-	if !sameStringArray(filters, []string{"*.*", DefaultTableFilter}) {
-		return nil, errors.New("cannot pass --tables-list and --filter together")
+	memoryWatermark, err := flags.GetString(flagMemoryWatermark)
+	if err != nil {
+		return errors.Trace(err)
 	}
-
-	tableNames := make([]filter.Table, 0, len(tablesList))
-	for _, table := range tablesList {
-		parts := strings.SplitN(table, ".", 2)
-		if len(parts) < 2 {
-			return nil, errors.Errorf("--tables-list only accepts qualified table names, but `%s` lacks a dot", table)
+	if memoryWatermark != "" {
+		size, err := units.RAMInBytes(memoryWatermark)
+		if err != nil || size <= 0 {
+			return errors.Errorf("failed to parse memory-watermark '%s'", memoryWatermark)
 		}
-		tableNames = append(tableNames, filter.Table{Schema: parts[0], Name: parts[1]})
+		conf.MemoryWatermark = uint64(size)
 	}
-
-	return filter.NewTablesFilter(tableNames...), nil
-}
-
-// ParseCompressType parses compressType string to storage.CompressType
-func ParseCompressType(compressType string) (storage.CompressType, error) {
-	switch compressType {
-	case "", "no-compression":
-		return storage.NoCompression, nil
-	case "gzip", "gz":
-		return storage.Gzip, nil
-	default:
-		return storage.NoCompression, errors.Errorf("unknown compress type %s", compressType)
+	conf.MinThreads, err = flags.GetInt(flagMinThreads)
+	if err != nil {
+		return errors.Trace(err)
 	}
-}
-
-func (conf *Config) createExternalStorage(ctx context.Context) (storage.ExternalStorage, error) {
-	b, err := storage.ParseBackend(conf.OutputDirPath, &conf.BackendOptions)
+	minFreeSpace, err := flags.GetString(flagMinFreeSpace)
 	if err != nil {
-		return nil, errors.Trace(err)
+		return errors.Trace(err)
 	}
-	httpClient := http.DefaultClient
-	httpClient.Timeout = 30 * time.Second
-	maxIdleConnsPerHost := http.DefaultMaxIdleConnsPerHost
-	if conf.Threads > maxIdleConnsPerHost {
-		maxIdleConnsPerHost = conf.Threads
+	if minFreeSpace != "" {
+		size, err := units.RAMInBytes(minFreeSpace)
+		if err != nil || size < 0 {
+			return errors.Errorf("failed to parse min-free-space '%s'", minFreeSpace)
+		}
+		conf.MinFreeSpace = uint64(size)
 	}
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
-	httpClient.Transport = transport
-
-	return storage.New(ctx, b, &storage.ExternalStorageOptions{
-		HTTPClient:      httpClient,
-		SkipCheckPath:   true,
-		SendCredentials: false,
-	})
-}
-
-const (
-	// UnspecifiedSize means the filesize/statement-size is unspecified
-	UnspecifiedSize = 0
-	// DefaultStatementSize is the default statement size
-	DefaultStatementSize = 1000000
-	// TiDBMemQuotaQueryName is the session variable TiDBMemQuotaQuery's name in TiDB
-	TiDBMemQuotaQueryName = "tidb_mem_quota_query"
-	// DefaultTableFilter is the default exclude table filter. It will exclude all system databases
-	DefaultTableFilter = "!/^(mysql|sys|INFORMATION_SCHEMA|PERFORMANCE_SCHEMA|METRICS_SCHEMA|INSPECTION_SCHEMA)$/.*"
-
-	defaultDumpThreads        = 128
-	defaultDumpGCSafePointTTL = 5 * 60
-	defaultEtcdDialTimeOut    = 3 * time.Second
-
-	dumplingServiceSafePointPrefix = "dumpling"
-)
-
-var (
-	decodeRegionVersion = semver.New("3.0.0")
-	gcSafePointVersion  = semver.New("4.0.0")
-	tableSampleVersion  = semver.New("5.0.0-nightly")
-)
-
-// ServerInfo is the combination of ServerType and ServerInfo
-type ServerInfo struct {
-	HasTiKV       bool
-	ServerType    ServerType
-	ServerVersion *semver.Version
-}
-
-// ServerInfoUnknown is the unknown database type to dumpling
-var ServerInfoUnknown = ServerInfo{
-	ServerType:    ServerTypeUnknown,
-	ServerVersion: nil,
-}
-
-var (
-	versionRegex     = regexp.MustCompile(`^\d+\.\d+\.\d+([0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?`)
-	tidbVersionRegex = regexp.MustCompile(`-[v]?\d+\.\d+\.\d+([0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?`)
-)
-
-// ParseServerInfo parses exported server type and version info from version string
-func ParseServerInfo(tctx *tcontext.Context, src string) ServerInfo {
-	tctx.L().Debug("parse server info", zap.String("server info string", src))
-	lowerCase := strings.ToLower(src)
-	serverInfo := ServerInfo{}
-	switch {
-	case strings.Contains(lowerCase, "tidb"):
-		serverInfo.ServerType = ServerTypeTiDB
-	case strings.Contains(lowerCase, "mariadb"):
-		serverInfo.ServerType = ServerTypeMariaDB
-	case versionRegex.MatchString(lowerCase):
-		serverInfo.ServerType = ServerTypeMySQL
-	default:
-		serverInfo.ServerType = ServerTypeUnknown
+	conf.ForceEngine, err = flags.GetString(flagForceEngine)
+	if err != nil {
+		return errors.Trace(err)
 	}
-
-	tctx.L().Info("detect server type",
-		zap.String("type", serverInfo.ServerType.String()))
-
-	var versionStr string
-	if serverInfo.ServerType == ServerTypeTiDB {
-		versionStr = tidbVersionRegex.FindString(src)[1:]
-		versionStr = strings.TrimPrefix(versionStr, "v")
-	} else {
-		versionStr = versionRegex.FindString(src)
+	conf.ForceCharset, err = flags.GetString(flagForceCharset)
+	if err != nil {
+		return errors.Trace(err)
 	}
-
-	var err error
-	serverInfo.ServerVersion, err = semver.NewVersion(versionStr)
+	conf.ForceCollation, err = flags.GetString(flagForceCollation)
 	if err != nil {
-		tctx.L().Warn("fail to parse version",
-			zap.String("version", versionStr))
-		return serverInfo
+		return errors.Trace(err)
+	}
+	conf.ForceColumnCharset, err = flags.GetBool(flagForceColumnCharset)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.AnnotateFiles, err = flags.GetBool(flagAnnotateFiles)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tableThreads, err := flags.GetStringArray(flagTableThreads)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(tableThreads) > 0 {
+		conf.TableThreads, err = ParseTableThreads(tableThreads)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	conf.BinaryModeHeader, err = flags.GetBool(flagBinaryModeHeader)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.RecentPartitions, err = flags.GetInt(flagRecentPartitions)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if conf.RecentPartitions < 0 {
+		return errors.Errorf("--recent-partitions is set to %d. It should not be negative", conf.RecentPartitions)
+	}
+	conf.StaticTableList, err = flags.GetStringSlice(flagStaticTablesList)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(conf.StaticTableList) > 0 {
+		if _, err = ParseStaticTableList(conf.StaticTableList); err != nil {
+			return errors.Trace(err)
+		}
+		if flags.Changed(flagTablesList) || flags.Changed(flagFilter) {
+			return errors.Errorf("cannot pass --%s with --%s or --%s", flagStaticTablesList, flagTablesList, flagFilter)
+		}
+	}
+	conf.TableListFile, err = flags.GetString(flagTableListFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.EmitChecksums, err = flags.GetBool(flagEmitChecksums)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.EncryptMethod, err = flags.GetString(flagEncryptMethod)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.EncryptKey, err = flags.GetString(flagEncryptKey)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.EncryptKMSKeyID, err = flags.GetString(flagEncryptKMSKeyID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	outputKeyColumns, err := flags.GetStringArray(flagOutputKeyColumns)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(outputKeyColumns) > 0 {
+		conf.OutputKeyColumns, err = ParseOutputKeyColumns(outputKeyColumns)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	conf.OutputKeySeparator, err = flags.GetString(flagOutputKeySeparator)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	maxEstimatedBytes, err := flags.GetString(flagMaxEstimatedBytes)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if maxEstimatedBytes != "" {
+		size, err := units.RAMInBytes(maxEstimatedBytes)
+		if err != nil || size < 0 {
+			return errors.Errorf("failed to parse max-estimated-bytes '%s'", maxEstimatedBytes)
+		}
+		conf.MaxEstimatedBytes = uint64(size)
+	}
+	conf.RecordUncompressedSize, err = flags.GetBool(flagRecordUncompressedSize)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.CompressDictionary, err = flags.GetBool(flagCompressDictionary)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.ServerSideDump, err = flags.GetBool(flagServerSideDump)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.RowsPerTransaction, err = flags.GetUint64(flagRowsPerTransaction)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.DumpStats, err = flags.GetBool(flagDumpStats)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.DedupByPrimaryKey, err = flags.GetBool(flagDedupByPrimaryKey)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.EmitCatalog, err = flags.GetBool(flagEmitCatalog)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.NoCreateDatabase, err = flags.GetBool(flagNoCreateDatabase)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.ChunkTimeout, err = flags.GetDuration(flagChunkTimeout)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.QueryTimeout, err = flags.GetDuration(flagQueryTimeout)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.PerTableBudget, err = flags.GetDuration(flagPerTableBudget)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.OutputFIFO, err = flags.GetString(flagOutputFIFO)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.OutputMode, err = flags.GetString(flagOutputMode)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SingleOutputFile, err = flags.GetString(flagSingleOutputFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.OnTableError, err = flags.GetString(flagOnTableError)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SkipEstimate, err = flags.GetBool(flagSkipEstimate)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.EmitVerificationSample, err = flags.GetBool(flagEmitVerificationSample)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.VerificationSampleInterval, err = flags.GetUint64(flagVerificationInterval)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if conf.EmitVerificationSample && conf.VerificationSampleInterval == 0 {
+		return errors.Errorf("--%s should be greater than 0", flagVerificationInterval)
+	}
+	conf.ViewMode, err = flags.GetString(flagViewMode)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.DumpRoutines, err = flags.GetBool(flagRoutines)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.DumpTriggers, err = flags.GetBool(flagTriggers)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.DumpSequences, err = flags.GetBool(flagSequences)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.DumpEvents, err = flags.GetBool(flagEvents)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.MaxConcurrentUploads, err = flags.GetInt(flagMaxConcurrentUploads)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if conf.MaxConcurrentUploads < 0 {
+		return errors.Errorf("--%s should not be negative", flagMaxConcurrentUploads)
+	}
+	conf.PerDatabaseMetadata, err = flags.GetBool(flagPerDatabaseMetadata)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.JobIndex, err = flags.GetInt(flagJobIndex)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.JobCount, err = flags.GetInt(flagJobCount)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SkipWriteCheck, err = flags.GetBool(flagSkipWriteCheck)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.DecimalFormat, err = flags.GetString(flagDecimalFormat)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.FloatFormat, err = flags.GetString(flagFloatFormat)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	namedQueries, err := flags.GetStringArray(flagNamedQuery)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(namedQueries) > 0 {
+		conf.NamedQueries, err = ParseNamedQueries(namedQueries)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	conf.TransactionPerTable, err = flags.GetBool(flagTransactionPerTable)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SkipColumnTypes, err = flags.GetStringSlice(flagSkipColumnTypes)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SkipColumnTypesInSchema, err = flags.GetBool(flagSkipColumnTypesInSchema)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	columnSelectors, err := flags.GetStringArray(flagSelectColumns)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(columnSelectors) > 0 {
+		conf.ColumnSelectors, err = ParseColumnSelectors(columnSelectors)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	conf.ColumnSelectorsInSchema, err = flags.GetBool(flagSelectColumnsInSchema)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.EmitStatsCSV, err = flags.GetBool(flagEmitStatsCSV)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	chunkExpressions, err := flags.GetStringArray(flagChunkExpression)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(chunkExpressions) > 0 {
+		conf.ChunkExpressions, err = ParseChunkExpressions(chunkExpressions)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	conf.CollationAllowlist, err = flags.GetStringSlice(flagCollationAllowlist)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.CollationMode, err = flags.GetString(flagCollationMode)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.DefaultCollation, err = flags.GetString(flagDefaultCollation)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.VerifyChunkCount, err = flags.GetBool(flagVerifyChunkCount)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.VerifyChunkCountRetries, err = flags.GetInt(flagVerifyChunkCountRetries)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.IdentifierQuote, err = flags.GetString(flagIdentifierQuote)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.TargetDSN, err = flags.GetString(flagTargetDSN)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.LoadOnly, err = flags.GetBool(flagLoadOnly)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.StripPartitioning, err = flags.GetBool(flagStripPartitioning)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.StripColumnComments, err = flags.GetBool(flagStripColumnComments)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.StripTableComments, err = flags.GetBool(flagStripTableComments)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tableRows, err := flags.GetStringSlice(flagTableRows)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(tableRows) > 0 {
+		conf.TableRows, err = ParseTableRows(tableRows)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	conf.ChunkByFileSize, err = flags.GetBool(flagChunkByFileSize)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.ErrorReportFile, err = flags.GetString(flagErrorReportFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.NormalizeSchema, err = flags.GetBool(flagNormalizeSchema)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SafeModeRows, err = flags.GetInt64(flagSafeModeRows)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.InsertMethod, err = flags.GetString(flagInsertMethod)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.IncrementalAgainst, err = flags.GetString(flagIncrementalAgainst)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.ImportIntoCompat, err = flags.GetString(flagImportIntoCompat)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.PerChunkBinlogPos, err = flags.GetBool(flagPerChunkBinlogPos)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.GenerateLightningConfig, err = flags.GetBool(flagGenerateLightningConfig)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.InvalidEnumHandling, err = flags.GetString(flagInvalidEnumHandling)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.HashPrefixFiles, err = flags.GetInt(flagHashPrefixFiles)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SubsetSeed, err = flags.GetString(flagSubsetSeed)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SubsetMaxDepth, err = flags.GetInt(flagSubsetMaxDepth)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SubsetMaxRows, err = flags.GetInt(flagSubsetMaxRows)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.RowCountTrailer, err = flags.GetBool(flagRowCountTrailer)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.ColumnCountMismatch, err = flags.GetString(flagColumnCountMismatch)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.LowercaseIdentifiers, err = flags.GetBool(flagLowercaseIdentifiers)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.EmitDependencyGraph, err = flags.GetBool(flagEmitDependencyGraph)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.MaxReplicaLagSeconds, err = flags.GetInt(flagMaxReplicaLagSeconds)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.EmitConstraints, err = flags.GetBool(flagEmitConstraints)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.MaxFieldBytes, err = flags.GetInt(flagMaxFieldBytes)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.PartitionByColumn, err = flags.GetString(flagPartitionByColumn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.PartitionMaxOpenFiles, err = flags.GetInt(flagPartitionMaxOpenFiles)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.VerifyCoverage, err = flags.GetBool(flagVerifyCoverage)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.ConnectionAttributes, err = flags.GetStringToString(flagConnectionAttributes)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SplitSchemaByType, err = flags.GetBool(flagSplitSchemaByType)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.ConsistencyCheckOnly, err = flags.GetBool(flagConsistencyCheckOnly)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.PartitionFilter, err = flags.GetString(flagPartitionFilter)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.ExclusiveTarget, err = flags.GetBool(flagExclusiveTarget)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.ExclusiveTargetForce, err = flags.GetBool(flagExclusiveTargetForce)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.ExclusiveTargetStaleAfter, err = flags.GetDuration(flagExclusiveTargetStale)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.NullsHandling, err = flags.GetString(flagNullsHandling)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.KafkaBrokers, err = flags.GetStringSlice(flagKafkaBrokers)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.KafkaTopic, err = flags.GetString(flagKafkaTopic)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.KafkaKeyColumn, err = flags.GetString(flagKafkaKeyColumn)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.KafkaOnly, err = flags.GetBool(flagKafkaOnly)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.UseCoveringIndex, err = flags.GetBool(flagUseCoveringIndex)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.EmitRestoreAsserts, err = flags.GetBool(flagEmitRestoreAsserts)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.OrderByCollation, err = flags.GetString(flagOrderByCollation)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.EmitPKIndex, err = flags.GetBool(flagEmitPKIndex)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SampleTables, err = flags.GetString(flagSampleTables)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SampleTablesSeed, err = flags.GetInt64(flagSampleTablesSeed)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.SampleFraction, err = flags.GetFloat64(flagSampleFraction)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.Checkpoint, err = flags.GetString(flagCheckpoint)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.EnsureTrailingNewline, err = flags.GetBool(flagEnsureTrailingNewline)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.PreserveTiDBHandles, err = flags.GetBool(flagPreserveTiDBHandles)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.ParquetRowGroupSize, err = flags.GetUint64(flagParquetRowGroupSize)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.MaxRowsPerSecond, err = flags.GetUint64(flagMaxRowsPerSecond)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.ProgressInterval, err = flags.GetDuration(flagProgressInterval)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.MaxRetries, err = flags.GetInt(flagMaxRetries)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	retryableErrors, err := flags.GetUintSlice(flagRetryableErrors)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.RetryableErrors = make([]uint16, 0, len(retryableErrors))
+	for _, code := range retryableErrors {
+		if code > math.MaxUint16 {
+			return errors.Errorf("invalid MySQL error code %d in retryable-errors", code)
+		}
+		conf.RetryableErrors = append(conf.RetryableErrors, uint16(code))
+	}
+	maxBytesPerSecond, err := flags.GetString(flagMaxBytesPerSecond)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if maxBytesPerSecond != "" {
+		size, err := units.RAMInBytes(maxBytesPerSecond)
+		if err != nil || size < 0 {
+			return errors.Errorf("failed to parse max-bytes-per-second '%s'", maxBytesPerSecond)
+		}
+		conf.MaxBytesPerSecond = uint64(size)
+	}
+	conf.Hosts, err = flags.GetStringSlice(flagHosts)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(conf.Hosts) > 0 {
+		if flags.Changed(flagHost) {
+			return errors.New("--host and --hosts can't be specified at the same time")
+		}
+		for _, host := range conf.Hosts {
+			if _, _, err = splitHostPort(host, conf.Port); err != nil {
+				return err
+			}
+		}
+	}
+	fileMode, err := flags.GetString(flagFileMode)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if fileMode != "" {
+		conf.FileMode, err = ParseFileMode(fileMode)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	conf.HDFS.User, err = flags.GetString(flagHDFSUser)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.HDFS.DelegationToken, err = flags.GetString(flagHDFSDelegationToken)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.HDFS.CAPath, err = flags.GetString(flagHDFSCA)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if conf.Threads <= 0 {
+		return errors.Errorf("--threads is set to %d. It should be greater than 0", conf.Threads)
+	}
+	if len(conf.CsvSeparator) == 0 {
+		return errors.New("--csv-separator is set to \"\". It must not be an empty string")
+	}
+
+	if conf.SessionParams == nil {
+		conf.SessionParams = make(map[string]interface{})
+	}
+
+	tablesList, err := flags.GetStringSlice(flagTablesList)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	fileSizeStr, err := flags.GetString(flagFilesize)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	filters, err := flags.GetStringSlice(flagFilter)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	caseSensitive, err := flags.GetBool(flagCaseSensitive)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	outputFilenameFormat, err := flags.GetString(flagOutputFilenameTemplate)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	params, err := flags.GetStringToString(flagParams)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	blockAllowListFile, err := flags.GetString(flagBlockAllowListFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if blockAllowListFile != "" {
+		// only parse --block-allow-list-file when -T and -f are default value. otherwise bail out.
+		if len(tablesList) > 0 || !sameStringArray(filters, []string{"*.*", DefaultTableFilter}) {
+			return errors.New("cannot pass --block-allow-list-file with --tables-list or --filter together")
+		}
+		conf.TableFilter, err = ParseBlockAllowListFile(blockAllowListFile, caseSensitive)
+		if err != nil {
+			return errors.Errorf("failed to parse filter: %s", err)
+		}
+	} else {
+		conf.TableFilter, err = ParseTableFilter(tablesList, filters)
+		if err != nil {
+			return errors.Errorf("failed to parse filter: %s", err)
+		}
+
+		if !caseSensitive {
+			conf.TableFilter = filter.CaseInsensitive(conf.TableFilter)
+		}
+	}
+
+	conf.FileSize, err = ParseFileSize(fileSizeStr)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if outputFilenameFormat == "" && conf.SQL != "" {
+		outputFilenameFormat = DefaultAnonymousOutputFileTemplateText
+	}
+	tmpl, err := ParseOutputFileTemplate(outputFilenameFormat)
+	if err != nil {
+		return errors.Errorf("failed to parse output filename template (--output-filename-template '%s')\n", outputFilenameFormat)
+	}
+	conf.OutputFileTemplate = tmpl
+
+	compressType, err := flags.GetString(flagCompress)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	conf.CompressType, err = ParseCompressType(compressType)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	for k, v := range params {
+		conf.SessionParams[k] = v
+	}
+
+	err = conf.BackendOptions.ParseFromFlags(pflag.CommandLine)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	return nil
+}
+
+// ParseFileSize parses file size from tables-list and filter arguments
+func ParseFileSize(fileSizeStr string) (uint64, error) {
+	if len(fileSizeStr) == 0 {
+		return UnspecifiedSize, nil
+	} else if fileSizeMB, err := strconv.ParseUint(fileSizeStr, 10, 64); err == nil {
+		fmt.Fprintf(os.Stderr, "Warning: -F without unit is not recommended, try using `-F '%dMiB'` in the future\n", fileSizeMB)
+		return fileSizeMB * units.MiB, nil
+	} else if size, err := units.RAMInBytes(fileSizeStr); err == nil {
+		return uint64(size), nil
+	}
+	return 0, errors.Errorf("failed to parse filesize (-F '%s')", fileSizeStr)
+}
+
+// ParseTableFilter parses table filter from tables-list and filter arguments
+func ParseTableFilter(tablesList, filters []string) (filter.Filter, error) {
+	if len(tablesList) == 0 {
+		return filter.Parse(filters)
+	}
+
+	// only parse -T when -f is default value. otherwise bail out.
+	if !sameStringArray(filters, []string{"*.*", DefaultTableFilter}) {
+		return nil, errors.New("cannot pass --tables-list and --filter together")
+	}
+
+	tableNames := make([]filter.Table, 0, len(tablesList))
+	for _, table := range tablesList {
+		parts := strings.SplitN(table, ".", 2)
+		if len(parts) < 2 {
+			return nil, errors.Errorf("--tables-list only accepts qualified table names, but `%s` lacks a dot", table)
+		}
+		tableNames = append(tableNames, filter.Table{Schema: parts[0], Name: parts[1]})
+	}
+
+	return filter.NewTablesFilter(tableNames...), nil
+}
+
+// ParseCompressType parses compressType string to CompressType
+func ParseCompressType(compressType string) (CompressType, error) {
+	switch compressType {
+	case "", "no-compression":
+		return CompressNone, nil
+	case "gzip", "gz":
+		return CompressGzip, nil
+	case "snappy":
+		return CompressSnappy, nil
+	case "zstd", "zst":
+		return CompressZstd, nil
+	default:
+		return CompressNone, errors.Errorf("unknown compress type %s", compressType)
+	}
+}
+
+func (conf *Config) createExternalStorage(ctx context.Context) (storage.ExternalStorage, error) {
+	httpClient := http.DefaultClient
+	httpClient.Timeout = 30 * time.Second
+	maxIdleConnsPerHost := http.DefaultMaxIdleConnsPerHost
+	if conf.Threads > maxIdleConnsPerHost {
+		maxIdleConnsPerHost = conf.Threads
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	httpClient.Transport = transport
+
+	if isHDFSURL(conf.OutputDirPath) {
+		s, err := newWebHDFSStorage(conf.OutputDirPath, conf.HDFS, httpClient)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		// create the output directory here to check the connectivity
+		if err = s.mkdirs(ctx); err != nil {
+			return nil, errors.Annotate(err, "fail to connect to webhdfs")
+		}
+		return s, nil
+	}
+
+	b, err := storage.ParseBackend(conf.OutputDirPath, &conf.BackendOptions)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return storage.New(ctx, b, &storage.ExternalStorageOptions{
+		HTTPClient:      httpClient,
+		SkipCheckPath:   true,
+		SendCredentials: false,
+	})
+}
+
+const (
+	// UnspecifiedSize means the filesize/statement-size is unspecified
+	UnspecifiedSize = 0
+	// DefaultStatementSize is the default statement size
+	DefaultStatementSize = 1000000
+	// TiDBMemQuotaQueryName is the session variable TiDBMemQuotaQuery's name in TiDB
+	TiDBMemQuotaQueryName = "tidb_mem_quota_query"
+	// DefaultTableFilter is the default exclude table filter. It will exclude all system databases
+	DefaultTableFilter = "!/^(mysql|sys|INFORMATION_SCHEMA|PERFORMANCE_SCHEMA|METRICS_SCHEMA|INSPECTION_SCHEMA)$/.*"
+
+	defaultDumpThreads        = 128
+	defaultDumpGCSafePointTTL = 5 * 60
+	defaultEtcdDialTimeOut    = 3 * time.Second
+
+	defaultGCSafePointUpdateRetries = 10
+	defaultMaxRetries               = dumpChunkRetryTime - 1
+
+	dumplingServiceSafePointPrefix = "dumpling"
+
+	snapshotSessionParam = "tidb_snapshot"
+	redactedValue        = "******"
+)
+
+const (
+	// PreCheckTablesQuick runs `CHECK TABLE ... QUICK` on MySQL before dumping a table, it's skipped on TiDB
+	PreCheckTablesQuick = "quick"
+	// PreCheckTablesFull runs `CHECK TABLE` on MySQL and `ADMIN CHECK TABLE` on TiDB before dumping a table
+	PreCheckTablesFull = "full"
+	// PreCheckFailureAbort aborts the dump when a table fails the pre-check
+	PreCheckFailureAbort = "abort"
+	// PreCheckFailureSkip skips dumping the table which fails the pre-check
+	PreCheckFailureSkip = "skip"
+	// GCSafePointFailureAbort cancels the dump when the service GC safe point can't be updated
+	GCSafePointFailureAbort = "abort"
+	// GCSafePointFailureContinue keeps dumping when the service GC safe point can't be updated
+	GCSafePointFailureContinue = "continue"
+	// ViewModeDefinition dumps the definitions of the views after all the tables, without reading their rows
+	ViewModeDefinition = "definition"
+	// ViewModeMaterialize dumps the views as base tables holding their rows at the snapshot
+	ViewModeMaterialize = "materialize"
+	// ViewModeSkip doesn't dump the views
+	ViewModeSkip = "skip"
+	// NumberFormatExact writes the DECIMAL or floating point values as the server returns them
+	NumberFormatExact = "exact"
+	// DecimalFormatTrimZeros writes the DECIMAL values without the trailing zeros of the fraction
+	DecimalFormatTrimZeros = "trim-zeros"
+	// FloatFormatPlain writes the floating point values without scientific notation
+	FloatFormatPlain = "plain"
+	// FloatFormatScientific writes the floating point values in scientific notation
+	FloatFormatScientific = "scientific"
+	// CollationModeReport logs the collations not in the allowlist
+	CollationModeReport = "report"
+	// CollationModeRewrite rewrites the collations not in the allowlist to the default collation
+	CollationModeRewrite = "rewrite"
+	// NullsHandlingFirst dumps the rows whose chunk key is NULL with the first chunk
+	NullsHandlingFirst = "first"
+	// NullsHandlingLast dumps the rows whose chunk key is NULL with the last chunk
+	NullsHandlingLast = "last"
+	// NullsHandlingSeparate dumps the rows whose chunk key is NULL by a dedicated chunk
+	NullsHandlingSeparate = "separate"
+	// NullsHandlingExclude doesn't dump the rows whose chunk key is NULL
+	NullsHandlingExclude = "exclude"
+	// OrderByCollationBinary orders the string columns by the binary collations of their character sets
+	OrderByCollationBinary = "binary"
+	// IdentifierQuoteBacktick quotes the identifiers by backticks like MySQL
+	IdentifierQuoteBacktick = "backtick"
+	// IdentifierQuoteDouble quotes the identifiers by double quotes like the ANSI SQL
+	IdentifierQuoteDouble = "double-quote"
+	// IdentifierQuoteNone doesn't quote the identifiers
+	IdentifierQuoteNone = "none"
+)
+
+var (
+	decodeRegionVersion = semver.New("3.0.0")
+	gcSafePointVersion  = semver.New("4.0.0")
+	tableSampleVersion  = semver.New("5.0.0-nightly")
+)
+
+// ServerInfo is the combination of ServerType and ServerInfo
+type ServerInfo struct {
+	HasTiKV       bool
+	HasSequences  bool
+	ServerType    ServerType
+	ServerVersion *semver.Version
+}
+
+// ServerInfoUnknown is the unknown database type to dumpling
+var ServerInfoUnknown = ServerInfo{
+	ServerType:    ServerTypeUnknown,
+	ServerVersion: nil,
+}
+
+var (
+	versionRegex     = regexp.MustCompile(`^\d+\.\d+\.\d+([0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?`)
+	tidbVersionRegex = regexp.MustCompile(`-[v]?\d+\.\d+\.\d+([0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?`)
+)
+
+// ParseServerInfo parses exported server type and version info from version string
+func ParseServerInfo(tctx *tcontext.Context, src string) ServerInfo {
+	tctx.L().Debug("parse server info", zap.String("server info string", src))
+	lowerCase := strings.ToLower(src)
+	serverInfo := ServerInfo{}
+	switch {
+	case strings.Contains(lowerCase, "tidb"):
+		serverInfo.ServerType = ServerTypeTiDB
+	case strings.Contains(lowerCase, "mariadb"):
+		serverInfo.ServerType = ServerTypeMariaDB
+	case versionRegex.MatchString(lowerCase):
+		serverInfo.ServerType = ServerTypeMySQL
+	default:
+		serverInfo.ServerType = ServerTypeUnknown
+	}
+
+	tctx.L().Info("detect server type",
+		zap.String("type", serverInfo.ServerType.String()))
+
+	var versionStr string
+	if serverInfo.ServerType == ServerTypeTiDB {
+		versionStr = tidbVersionRegex.FindString(src)[1:]
+		versionStr = strings.TrimPrefix(versionStr, "v")
+	} else {
+		versionStr = versionRegex.FindString(src)
+	}
+
+	var err error
+	serverInfo.ServerVersion, err = semver.NewVersion(versionStr)
+	if err != nil {
+		tctx.L().Warn("fail to parse version",
+			zap.String("version", versionStr))
+		return serverInfo
 	}
 
 	tctx.L().Info("detect server version",
@@ -684,6 +2346,109 @@ func validateSpecifiedSQL(conf *Config) error {
 	if conf.SQL != "" && conf.Where != "" {
 		return errors.New("can't specify both --sql and --where at the same time. Please try to combine them into --sql")
 	}
+	if len(conf.NamedQueries) > 0 {
+		if conf.SQL != "" {
+			return errors.New("can't specify both --sql and --named-query at the same time")
+		}
+		if conf.Where != "" {
+			return errors.New("can't specify both --named-query and --where at the same time. Please try to combine them into the queries")
+		}
+	}
+	return nil
+}
+
+// adjustTimeWindow appends the time window predicate to conf.Where, so that all the chunk
+// splitting, estimating and selecting queries only scan the given time range.
+func adjustTimeWindow(conf *Config) error {
+	if conf.TimeColumn == "" {
+		if conf.TimeFrom != "" || conf.TimeTo != "" {
+			return errors.New("--time-from and --time-to must be used with --time-column")
+		}
+		return nil
+	}
+	if conf.SQL != "" {
+		return errors.New("can't specify both --sql and --time-column at the same time. Please try to combine them into --sql")
+	}
+	if len(conf.NamedQueries) > 0 {
+		return errors.New("can't specify both --named-query and --time-column at the same time. Please try to combine them into the queries")
+	}
+	if conf.TimeFrom == "" || conf.TimeTo == "" {
+		return errors.New("both --time-from and --time-to should be specified when --time-column is set")
+	}
+	timeWindow := fmt.Sprintf("`%s` BETWEEN '%s' AND '%s'", escapeString(conf.TimeColumn),
+		escapeSQLString(conf.TimeFrom), escapeSQLString(conf.TimeTo))
+	if conf.Where == "" {
+		conf.Where = timeWindow
+	} else {
+		conf.Where = fmt.Sprintf("(%s) AND %s", conf.Where, timeWindow)
+	}
+	return nil
+}
+
+func adjustPreCheckTables(conf *Config) error {
+	conf.PreCheckTables = strings.ToLower(conf.PreCheckTables)
+	switch conf.PreCheckTables {
+	case "", PreCheckTablesQuick, PreCheckTablesFull:
+	default:
+		return errors.Errorf("unknown config.PreCheckTables '%s', please use '%s' or '%s'",
+			conf.PreCheckTables, PreCheckTablesQuick, PreCheckTablesFull)
+	}
+	conf.PreCheckFailureMode = strings.ToLower(conf.PreCheckFailureMode)
+	switch conf.PreCheckFailureMode {
+	case "":
+		conf.PreCheckFailureMode = PreCheckFailureAbort
+	case PreCheckFailureAbort, PreCheckFailureSkip:
+	default:
+		return errors.Errorf("unknown config.PreCheckFailureMode '%s', please use '%s' or '%s'",
+			conf.PreCheckFailureMode, PreCheckFailureAbort, PreCheckFailureSkip)
+	}
+	return nil
+}
+
+func adjustMaxRetries(conf *Config) error {
+	if conf.MaxRetries < 0 {
+		return errors.Errorf("config.MaxRetries should not be negative, got %d", conf.MaxRetries)
+	}
+	return nil
+}
+
+func adjustGCSafePointPolicy(conf *Config) error {
+	if conf.GCSafePointUpdateRetries < 0 {
+		return errors.Errorf("config.GCSafePointUpdateRetries should not be negative, got %d", conf.GCSafePointUpdateRetries)
+	}
+	conf.GCSafePointFailureAction = strings.ToLower(conf.GCSafePointFailureAction)
+	switch conf.GCSafePointFailureAction {
+	case "":
+		conf.GCSafePointFailureAction = GCSafePointFailureAbort
+	case GCSafePointFailureAbort, GCSafePointFailureContinue:
+	default:
+		return errors.Errorf("unknown config.GCSafePointFailureAction '%s', please use '%s' or '%s'",
+			conf.GCSafePointFailureAction, GCSafePointFailureAbort, GCSafePointFailureContinue)
+	}
+	return nil
+}
+
+func adjustMigrationLayout(conf *Config) error {
+	if conf.MigrationLayout && conf.DedupSchema {
+		return errors.New("config.MigrationLayout can't be used with config.DedupSchema, the manifest refers to the schema files which aren't written in the migration layout")
+	}
+	return nil
+}
+
+func adjustTableOptions(conf *Config) error {
+	for name, value := range map[string]string{
+		"ForceEngine":    conf.ForceEngine,
+		"ForceCharset":   conf.ForceCharset,
+		"ForceCollation": conf.ForceCollation,
+	} {
+		if value != "" && !tableOptionRegexp.MatchString(value) {
+			return errors.Errorf("invalid config.%s '%s'", name, value)
+		}
+	}
+	if conf.ForceCharset != "" && conf.ForceCollation != "" &&
+		!strings.EqualFold(collationCharset(conf.ForceCollation), conf.ForceCharset) {
+		return errors.Errorf("config.ForceCollation '%s' doesn't belong to config.ForceCharset '%s'", conf.ForceCollation, conf.ForceCharset)
+	}
 	return nil
 }
 
@@ -700,9 +2465,622 @@ func adjustFileFormat(conf *Config) error {
 		if conf.SQL != "" {
 			return errors.Errorf("unsupported config.FileType '%s' when we specify --sql, please unset --filetype or set it to 'csv'", conf.FileType)
 		}
-	case FileFormatCSVString:
+	case FileFormatCSVString, FileFormatMongoJSONString, FileFormatChangeFeedString, FileFormatJSONLinesString:
+	case FileFormatParquetString:
+		if conf.CompressType != CompressNone {
+			return errors.New("config.CompressType can't be used with the parquet file type, whose pages are compressed by snappy already")
+		}
+		if conf.ParquetRowGroupSize == 0 {
+			return errors.New("config.ParquetRowGroupSize must be positive")
+		}
 	default:
 		return errors.Errorf("unknown config.FileType '%s'", conf.FileType)
 	}
+	if len(conf.OutputKeyColumns) > 0 && conf.FileType != FileFormatCSVString {
+		return errors.Errorf("config.OutputKeyColumns is only supported for csv files, but config.FileType is '%s'", conf.FileType)
+	}
+	conf.CsvInvalidUTF8 = strings.ToLower(conf.CsvInvalidUTF8)
+	switch conf.CsvInvalidUTF8 {
+	case "", CsvInvalidUTF8Error, CsvInvalidUTF8Skip, CsvInvalidUTF8Replace:
+	default:
+		return errors.Errorf("unknown config.CsvInvalidUTF8 '%s', please use '%s', '%s' or '%s'",
+			conf.CsvInvalidUTF8, CsvInvalidUTF8Error, CsvInvalidUTF8Skip, CsvInvalidUTF8Replace)
+	}
+	conf.DecimalFormat = strings.ToLower(conf.DecimalFormat)
+	switch conf.DecimalFormat {
+	case "", NumberFormatExact, DecimalFormatTrimZeros:
+	default:
+		return errors.Errorf("unknown config.DecimalFormat '%s', please use '%s' or '%s'",
+			conf.DecimalFormat, NumberFormatExact, DecimalFormatTrimZeros)
+	}
+	conf.FloatFormat = strings.ToLower(conf.FloatFormat)
+	switch conf.FloatFormat {
+	case "", NumberFormatExact, FloatFormatPlain, FloatFormatScientific:
+	default:
+		return errors.Errorf("unknown config.FloatFormat '%s', please use '%s', '%s' or '%s'",
+			conf.FloatFormat, NumberFormatExact, FloatFormatPlain, FloatFormatScientific)
+	}
+	return nil
+}
+
+// adjustTransactionPerTable checks the data of each table is written into one sql file with conf.TransactionPerTable,
+// so all the INSERT statements of a table can be wrapped in one transaction
+func adjustTransactionPerTable(conf *Config) error {
+	if !conf.TransactionPerTable {
+		return nil
+	}
+	var reason string
+	switch {
+	case conf.FileType != FileFormatSQLTextString:
+		reason = "only sql files have transactions"
+	case conf.Rows != UnspecifiedSize:
+		reason = "--rows splits the tables into chunks"
+	case len(conf.TableRows) > 0:
+		reason = "--table-rows splits the tables into chunks"
+	case conf.FileSize != UnspecifiedSize:
+		reason = "--filesize splits the data of a table into several files"
+	case conf.RowsPerTransaction > 0:
+		reason = "--rows-per-transaction wraps the rows in smaller transactions"
+	case len(conf.ColumnGroups) > 0:
+		reason = "the column groups are written into separate files"
+	case conf.MaterializePartitionColumn != "" || conf.RecentPartitions > 0 || conf.PartitionFilter != "":
+		reason = "the partitions are written into separate files"
+	default:
+		return nil
+	}
+	return errors.Errorf("config.TransactionPerTable requires the data of each table in one sql file, but %s", reason)
+}
+
+// adjustSkipColumnTypes normalizes conf.SkipColumnTypes to upper case, and checks the tables are dumped with it
+func adjustSkipColumnTypes(conf *Config) error {
+	types := make([]string, 0, len(conf.SkipColumnTypes))
+	for _, tp := range conf.SkipColumnTypes {
+		if tp = strings.ToUpper(strings.TrimSpace(tp)); tp != "" {
+			types = append(types, tp)
+		}
+	}
+	conf.SkipColumnTypes = types
+	if len(types) == 0 {
+		if conf.SkipColumnTypesInSchema {
+			return errors.New("config.SkipColumnTypesInSchema requires config.SkipColumnTypes")
+		}
+		return nil
+	}
+	if conf.SQL != "" || len(conf.NamedQueries) > 0 {
+		return errors.New("config.SkipColumnTypes is only supported for dumping tables, but --sql or --named-query is specified")
+	}
+	return nil
+}
+
+// adjustChunkExpressions checks the tables are split into chunks with conf.ChunkExpressions
+func adjustChunkExpressions(conf *Config) error {
+	for db, tables := range conf.ChunkExpressions {
+		for tbl := range tables {
+			if !conf.chunked(db, tbl) {
+				return errors.New("config.ChunkExpressions requires --rows, --table-rows or --chunk-by-filesize to split the tables into chunks")
+			}
+		}
+	}
+	return nil
+}
+
+// adjustCollationAllowlist normalizes conf.CollationAllowlist and checks conf.CollationMode and conf.DefaultCollation.
+// The default collation is always allowed.
+func adjustCollationAllowlist(conf *Config) error {
+	allowlist := make([]string, 0, len(conf.CollationAllowlist)+1)
+	for _, collation := range conf.CollationAllowlist {
+		if collation = strings.ToLower(strings.TrimSpace(collation)); collation != "" {
+			allowlist = append(allowlist, collation)
+		}
+	}
+	conf.CollationMode = strings.ToLower(conf.CollationMode)
+	switch conf.CollationMode {
+	case "":
+		conf.CollationMode = CollationModeReport
+	case CollationModeReport, CollationModeRewrite:
+	default:
+		return errors.Errorf("unknown config.CollationMode '%s', please use '%s' or '%s'",
+			conf.CollationMode, CollationModeReport, CollationModeRewrite)
+	}
+	conf.DefaultCollation = strings.ToLower(strings.TrimSpace(conf.DefaultCollation))
+	if len(allowlist) == 0 {
+		conf.CollationAllowlist = nil
+		if conf.DefaultCollation != "" || conf.CollationMode == CollationModeRewrite {
+			return errors.New("config.CollationMode and config.DefaultCollation require config.CollationAllowlist")
+		}
+		return nil
+	}
+	if conf.CollationMode == CollationModeRewrite && conf.DefaultCollation == "" {
+		return errors.New("config.DefaultCollation is required to rewrite the collations not in config.CollationAllowlist")
+	}
+	if conf.DefaultCollation != "" && !isAllowedCollation(conf.DefaultCollation, allowlist) {
+		allowlist = append(allowlist, conf.DefaultCollation)
+	}
+	conf.CollationAllowlist = allowlist
+	return nil
+}
+
+// adjustVerifyChunkCount checks the tables can be dumped again with conf.VerifyChunkCount
+func adjustVerifyChunkCount(conf *Config) error {
+	if !conf.VerifyChunkCount {
+		return nil
+	}
+	if conf.VerifyChunkCountRetries < 0 {
+		return errors.Errorf("config.VerifyChunkCountRetries is set to %d. It should not be negative", conf.VerifyChunkCountRetries)
+	}
+	if conf.OutputFIFO != "" {
+		return errors.New("config.VerifyChunkCount can't be used with config.OutputFIFO, the files streamed can't be written again")
+	}
+	return nil
+}
+
+// adjustIdentifierQuote normalizes and checks conf.IdentifierQuote
+func adjustIdentifierQuote(conf *Config) error {
+	conf.IdentifierQuote = strings.ToLower(strings.TrimSpace(conf.IdentifierQuote))
+	switch conf.IdentifierQuote {
+	case "":
+		conf.IdentifierQuote = IdentifierQuoteBacktick
+	case IdentifierQuoteBacktick, IdentifierQuoteDouble, IdentifierQuoteNone:
+	default:
+		return errors.Errorf("unknown config.IdentifierQuote '%s', please use '%s', '%s' or '%s'",
+			conf.IdentifierQuote, IdentifierQuoteBacktick, IdentifierQuoteDouble, IdentifierQuoteNone)
+	}
+	return nil
+}
+
+// adjustTargetDSN checks conf.TargetDSN and the options which the dumped SQL can't be loaded with
+func adjustTargetDSN(conf *Config) error {
+	if conf.TargetDSN == "" {
+		if conf.LoadOnly {
+			return errors.New("config.LoadOnly requires config.TargetDSN")
+		}
+		return nil
+	}
+	if _, err := mysql.ParseDSN(conf.TargetDSN); err != nil {
+		return errors.Annotate(err, "invalid config.TargetDSN")
+	}
+	switch {
+	case conf.FileType != FileFormatSQLTextString:
+		return errors.Errorf("config.TargetDSN only loads the sql file type, but config.FileType is '%s'", conf.FileType)
+	case conf.CompressType != CompressNone:
+		return errors.New("config.TargetDSN can't be used with config.CompressType")
+	case conf.OutputFIFO != "":
+		return errors.New("config.TargetDSN can't be used with config.OutputFIFO")
+	case conf.ServerSideDump:
+		return errors.New("config.TargetDSN can't be used with config.ServerSideDump, the data isn't read by Dumpling")
+	case conf.DedupSchema:
+		return errors.New("config.TargetDSN can't be used with config.DedupSchema, no schema file is written for the manifest to refer to")
+	case len(conf.ColumnGroups) > 0:
+		return errors.New("config.TargetDSN can't be used with config.ColumnGroups, the column groups can't be loaded into one table")
+	case conf.RowsPerTransaction > 0 || conf.TransactionPerTable:
+		return errors.New("config.TargetDSN can't be used with the transactions in the sql files, the statements are retried one by one")
+	case conf.IdentifierQuote != IdentifierQuoteBacktick:
+		return errors.New("config.TargetDSN requires the identifiers quoted by backticks")
+	}
+	return nil
+}
+
+// adjustSafeModeRows checks conf.SafeModeRows
+func adjustSafeModeRows(conf *Config) error {
+	if conf.SafeModeRows == 0 {
+		return nil
+	}
+	if conf.SafeModeRows < SafeModeWholeTable {
+		return errors.Errorf("config.SafeModeRows is set to %d. It should be positive, or -1 for all the rows", conf.SafeModeRows)
+	}
+	if conf.FileType != FileFormatSQLTextString {
+		return errors.Errorf("config.SafeModeRows only writes the sql file type, but config.FileType is '%s'", conf.FileType)
+	}
+	return nil
+}
+
+// adjustIncrementalAgainst checks the catalog is emitted to refer to the unchanged tables with conf.IncrementalAgainst
+func adjustIncrementalAgainst(conf *Config) error {
+	if conf.IncrementalAgainst == "" {
+		return nil
+	}
+	if !conf.EmitCatalog {
+		return errors.New("config.IncrementalAgainst requires config.EmitCatalog to refer to the unchanged tables")
+	}
+	return nil
+}
+
+// adjustImportIntoCompat checks the target TiDB of conf.ImportIntoCompat supports `IMPORT INTO`, and names the files for it
+func adjustImportIntoCompat(conf *Config) error {
+	if conf.ImportIntoCompat == "" {
+		return nil
+	}
+	version, err := parseImportIntoVersion(conf.ImportIntoCompat)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version.LessThan(*importIntoVersion):
+		return errors.Errorf("config.ImportIntoCompat requires TiDB v%s or later which supports IMPORT INTO, but the target TiDB is v%s", importIntoVersion, version)
+	case conf.FileType != FileFormatSQLTextString && conf.FileType != FileFormatCSVString:
+		return errors.Errorf("config.ImportIntoCompat only supports the sql and csv file types, but config.FileType is '%s'", conf.FileType)
+	case conf.SQL != "":
+		return errors.New("config.ImportIntoCompat can't be used with config.SQL, IMPORT INTO loads the data files of a table")
+	}
+	conf.OutputFileTemplate = importIntoFileTemplate(conf.OutputFileTemplate)
+	glob, err := importIntoGlob(conf.OutputFileTemplate, "db", "t1", conf.FileType)
+	if err != nil {
+		return err
+	}
+	other, err := importIntoGlob(conf.OutputFileTemplate, "db", "t2", conf.FileType)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(glob, "*") || glob == other {
+		return errors.New("config.ImportIntoCompat requires the data file names of the output filename template to contain the table name and the index")
+	}
+	return nil
+}
+
+// adjustPerTableBudget checks conf.PerTableBudget
+func adjustPerTableBudget(conf *Config) error {
+	switch {
+	case conf.PerTableBudget == 0:
+		return nil
+	case conf.PerTableBudget < 0:
+		return errors.Errorf("config.PerTableBudget is set to %s. It should not be negative", conf.PerTableBudget)
+	case conf.VerifyChunkCount:
+		return errors.New("config.PerTableBudget can't be used with config.VerifyChunkCount, the skipped chunks would be dumped again")
+	}
+	return nil
+}
+
+// adjustPerChunkBinlogPos checks the binlog positions of conf.PerChunkBinlogPos can be stored with the chunks
+func adjustPerChunkBinlogPos(conf *Config) error {
+	switch {
+	case !conf.PerChunkBinlogPos:
+		return nil
+	case !conf.ChunkMetadata:
+		return errors.New("config.PerChunkBinlogPos requires config.ChunkMetadata to store the binlog positions of the chunks")
+	case conf.Consistency == consistencyTypeSnapshot || conf.Consistency == consistencyTypeConsistentSnapshot:
+		return errors.Errorf("config.PerChunkBinlogPos can't be used with the %s consistency, all the chunks are read from the same snapshot", conf.Consistency)
+	}
+	return nil
+}
+
+// adjustGenerateLightningConfig checks tidb-lightning can restore the dump of conf.GenerateLightningConfig
+func adjustGenerateLightningConfig(conf *Config) error {
+	switch {
+	case !conf.GenerateLightningConfig:
+		return nil
+	case conf.FileType != FileFormatSQLTextString && conf.FileType != FileFormatCSVString:
+		return errors.Errorf("config.GenerateLightningConfig only supports the sql and csv file types, but config.FileType is '%s'", conf.FileType)
+	case conf.SQL != "":
+		return errors.New("config.GenerateLightningConfig can't be used with config.SQL, the result files don't belong to any table")
+	}
+	return nil
+}
+
+// adjustInvalidEnumHandling normalizes and checks conf.InvalidEnumHandling
+func adjustInvalidEnumHandling(conf *Config) error {
+	conf.InvalidEnumHandling = strings.ToLower(strings.TrimSpace(conf.InvalidEnumHandling))
+	switch conf.InvalidEnumHandling {
+	case "":
+		conf.InvalidEnumHandling = InvalidEnumKeep
+	case InvalidEnumKeep, InvalidEnumNull, InvalidEnumFirst:
+	default:
+		return errors.Errorf("unknown config.InvalidEnumHandling '%s', please use '%s', '%s' or '%s'",
+			conf.InvalidEnumHandling, InvalidEnumKeep, InvalidEnumNull, InvalidEnumFirst)
+	}
+	return nil
+}
+
+// adjustHashPrefixFiles checks conf.HashPrefixFiles
+func adjustHashPrefixFiles(conf *Config) error {
+	switch {
+	case conf.HashPrefixFiles == 0:
+		return nil
+	case conf.HashPrefixFiles < 0:
+		return errors.Errorf("config.HashPrefixFiles is set to %d. It should not be negative", conf.HashPrefixFiles)
+	case !conf.EmitCatalog:
+		return errors.New("config.HashPrefixFiles requires config.EmitCatalog to record the actual paths of the data files")
+	case conf.OutputFIFO != "":
+		return errors.New("config.HashPrefixFiles can't be used with config.OutputFIFO, the files are written into one stream")
+	case conf.ImportIntoCompat != "":
+		return errors.New("config.HashPrefixFiles can't be used with config.ImportIntoCompat, the data files of a table can't be matched by one glob")
+	}
+	return nil
+}
+
+// adjustSubsetSeed checks conf.SubsetSeed and the limits of the traversal
+func adjustSubsetSeed(conf *Config) error {
+	if conf.SubsetSeed == "" {
+		return nil
+	}
+	if _, _, _, err := parseSubsetSeed(conf.SubsetSeed); err != nil {
+		return err
+	}
+	switch {
+	case conf.SubsetMaxDepth < 0:
+		return errors.Errorf("config.SubsetMaxDepth is set to %d. It should not be negative", conf.SubsetMaxDepth)
+	case conf.SubsetMaxRows <= 0:
+		return errors.Errorf("config.SubsetMaxRows is set to %d. It should be positive", conf.SubsetMaxRows)
+	case conf.SQL != "" || len(conf.NamedQueries) > 0:
+		return errors.New("config.SubsetSeed can't be used with config.SQL or config.NamedQueries")
+	case conf.Where != "":
+		return errors.New("config.SubsetSeed can't be used with config.Where, the filtered rows may be referenced by the subset")
+	case conf.NoData:
+		return errors.New("config.SubsetSeed can't be used with config.NoData")
+	}
+	return nil
+}
+
+// adjustRowCountTrailer checks conf.RowCountTrailer
+func adjustRowCountTrailer(conf *Config) error {
+	if !conf.RowCountTrailer {
+		return nil
+	}
+	switch {
+	case conf.FileType != FileFormatSQLTextString && conf.FileType != FileFormatCSVString:
+		return errors.Errorf("config.RowCountTrailer only supports the sql and csv file types, but config.FileType is '%s'", conf.FileType)
+	case conf.ServerSideDump:
+		return errors.New("config.RowCountTrailer can't be used with config.ServerSideDump, the data files are written by the server")
+	}
+	return nil
+}
+
+// adjustColumnCountMismatch normalizes and checks conf.ColumnCountMismatch
+func adjustColumnCountMismatch(conf *Config) error {
+	conf.ColumnCountMismatch = strings.ToLower(strings.TrimSpace(conf.ColumnCountMismatch))
+	switch conf.ColumnCountMismatch {
+	case "":
+		conf.ColumnCountMismatch = ColumnCountMismatchFail
+	case ColumnCountMismatchFail, ColumnCountMismatchRefetch:
+	default:
+		return errors.Errorf("unknown config.ColumnCountMismatch '%s', please use '%s' or '%s'",
+			conf.ColumnCountMismatch, ColumnCountMismatchFail, ColumnCountMismatchRefetch)
+	}
+	return nil
+}
+
+// adjustLowercaseIdentifiers checks conf.LowercaseIdentifiers
+func adjustLowercaseIdentifiers(conf *Config) error {
+	if conf.LowercaseIdentifiers && conf.FileType != FileFormatSQLTextString && conf.FileType != FileFormatCSVString {
+		return errors.Errorf("config.LowercaseIdentifiers only supports the sql and csv file types, but config.FileType is '%s'", conf.FileType)
+	}
+	return nil
+}
+
+// adjustMaxReplicaLagSeconds checks conf.MaxReplicaLagSeconds
+func adjustMaxReplicaLagSeconds(conf *Config) error {
+	if conf.MaxReplicaLagSeconds < 0 {
+		return errors.Errorf("config.MaxReplicaLagSeconds should be non-negative, but got %d", conf.MaxReplicaLagSeconds)
+	}
+	return nil
+}
+
+// adjustMaxFieldBytes checks conf.MaxFieldBytes only truncates the values in the csv files,
+// the truncated values would be loaded silently from the sql files
+func adjustMaxFieldBytes(conf *Config) error {
+	switch {
+	case conf.MaxFieldBytes == 0:
+		return nil
+	case conf.MaxFieldBytes < minMaxFieldBytes:
+		return errors.Errorf("config.MaxFieldBytes should be at least %d, but got %d", minMaxFieldBytes, conf.MaxFieldBytes)
+	case conf.FileType != FileFormatCSVString:
+		return errors.Errorf("config.MaxFieldBytes only supports the csv file type, but got %s", conf.FileType)
+	case conf.ServerSideDump:
+		return errors.New("config.MaxFieldBytes can't be used with config.ServerSideDump, the values are written by the server")
+	case conf.BinaryEncoding == BinaryEncodingHex || conf.BinaryEncoding == BinaryEncodingBase64:
+		// the marker would be encoded as the bytes of the truncated value, and the encoded values exceed the limit
+		return errors.Errorf("config.MaxFieldBytes can't be used with config.BinaryEncoding '%s', please use '%s'",
+			conf.BinaryEncoding, BinaryEncodingRaw)
+	}
+	return nil
+}
+
+// adjustPartitionByColumn checks conf.PartitionByColumn, the options writing a file per chunk or
+// finding the data files by their names can't be used with it
+func adjustPartitionByColumn(conf *Config) error {
+	if conf.PartitionByColumn == "" {
+		return nil
+	}
+	if _, _, _, err := parsePartitionByColumn(conf.PartitionByColumn); err != nil {
+		return err
+	}
+	var reason string
+	switch {
+	case conf.PartitionMaxOpenFiles <= 0:
+		return errors.Errorf("config.PartitionMaxOpenFiles should be positive, but got %d", conf.PartitionMaxOpenFiles)
+	case conf.FileType != FileFormatSQLTextString && conf.FileType != FileFormatCSVString:
+		return errors.Errorf("config.PartitionByColumn only supports the sql and csv file types, but got %s", conf.FileType)
+	case conf.FileSize != UnspecifiedSize:
+		reason = "config.FileSize"
+	case conf.ChunkMetadata:
+		reason = "config.ChunkMetadata"
+	case conf.RowCountTrailer:
+		reason = "config.RowCountTrailer"
+	case conf.TransactionPerTable:
+		reason = "config.TransactionPerTable"
+	case conf.VerifyChunkCount:
+		reason = "config.VerifyChunkCount"
+	case conf.HashPrefixFiles > 0:
+		reason = "config.HashPrefixFiles"
+	case conf.ImportIntoCompat != "":
+		reason = "config.ImportIntoCompat"
+	case conf.ServerSideDump:
+		reason = "config.ServerSideDump"
+	case conf.OutputFIFO != "":
+		reason = "config.OutputFIFO"
+	case conf.TargetDSN != "":
+		reason = "config.TargetDSN"
+	default:
+		return nil
+	}
+	return errors.Errorf("config.PartitionByColumn can't be used with %s", reason)
+}
+
+const (
+	// programNameAttribute is the connection attribute of the program name, which is dumpling if it isn't set
+	programNameAttribute = "program_name"
+	// maxConnectionAttributeValueLen is the maximum length of the values of the connection attributes
+	maxConnectionAttributeValueLen = 1024
+)
+
+// connectionAttributeNamePattern matches the names of the connection attributes, which are the names of the user variables.
+// The names starting with `_` are reserved by the server.
+var connectionAttributeNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,31}$`)
+
+func adjustConnectionAttributes(conf *Config) error {
+	if len(conf.ConnectionAttributes) == 0 {
+		return nil
+	}
+	for name, value := range conf.ConnectionAttributes {
+		if !connectionAttributeNamePattern.MatchString(name) {
+			return errors.Errorf("invalid connection attribute name `%s`, it should start with a letter and only contain "+
+				"letters, digits and underscores, at most 32 characters", name)
+		}
+		if len(value) > maxConnectionAttributeValueLen {
+			return errors.Errorf("the value of connection attribute `%s` is longer than %d bytes", name, maxConnectionAttributeValueLen)
+		}
+		// the values are quoted in the statements setting them, which don't take arguments
+		if strings.ContainsAny(value, "'\\") {
+			return errors.Errorf("the value of connection attribute `%s` can't contain quotes or backslashes", name)
+		}
+	}
+	if _, ok := conf.ConnectionAttributes[programNameAttribute]; !ok {
+		conf.ConnectionAttributes[programNameAttribute] = "dumpling"
+	}
+	return nil
+}
+
+func adjustSplitSchemaByType(conf *Config) error {
+	switch {
+	case !conf.SplitSchemaByType:
+		return nil
+	case conf.MigrationLayout:
+		return errors.New("config.SplitSchemaByType can't be used with config.MigrationLayout, the migration files are ordered in one directory")
+	case conf.OutputFIFO != "":
+		return errors.New("config.SplitSchemaByType can't be used with config.OutputFIFO, the files are written into one stream")
+	}
+	return nil
+}
+
+func adjustPartitionFilter(conf *Config) error {
+	if conf.PartitionFilter == "" {
+		return nil
+	}
+	if _, _, _, err := parsePartitionFilter(conf.PartitionFilter); err != nil {
+		return err
+	}
+	switch {
+	case conf.RecentPartitions > 0:
+		return errors.New("config.PartitionFilter can't be used with config.RecentPartitions, both of them select the partitions to dump")
+	case conf.MaterializePartitionColumn != "":
+		return errors.New("config.PartitionFilter can't be used with config.MaterializePartitionColumn, which dumps all the partitions")
+	}
+	return nil
+}
+
+func adjustExclusiveTarget(conf *Config) error {
+	switch {
+	case !conf.ExclusiveTarget:
+		return nil
+	case conf.OutputFIFO != "":
+		return errors.New("config.ExclusiveTarget can't be used with config.OutputFIFO, the FIFO has only one reader")
+	case conf.ExclusiveTargetStaleAfter < time.Second:
+		return errors.Errorf("config.ExclusiveTargetStaleAfter should be at least 1s, but got %s", conf.ExclusiveTargetStaleAfter)
+	}
+	return nil
+}
+
+func adjustNullsHandling(conf *Config) error {
+	conf.NullsHandling = strings.ToLower(conf.NullsHandling)
+	switch conf.NullsHandling {
+	case "":
+		conf.NullsHandling = NullsHandlingFirst
+	case NullsHandlingFirst, NullsHandlingLast, NullsHandlingSeparate, NullsHandlingExclude:
+	default:
+		return errors.Errorf("unknown config.NullsHandling '%s', please use '%s', '%s', '%s' or '%s'", conf.NullsHandling,
+			NullsHandlingFirst, NullsHandlingLast, NullsHandlingSeparate, NullsHandlingExclude)
+	}
+	return nil
+}
+
+// adjustKafkaSink checks conf.KafkaBrokers and the options which the rows can't be produced with
+func adjustKafkaSink(conf *Config) error {
+	if len(conf.KafkaBrokers) == 0 {
+		if conf.KafkaTopic != "" || conf.KafkaKeyColumn != "" || conf.KafkaOnly {
+			return errors.New("config.KafkaTopic, config.KafkaKeyColumn and config.KafkaOnly require config.KafkaBrokers")
+		}
+		return nil
+	}
+	switch {
+	case conf.KafkaTopic == "":
+		return errors.New("config.KafkaBrokers requires config.KafkaTopic")
+	case conf.FileType != FileFormatMongoJSONString && conf.FileType != FileFormatChangeFeedString:
+		return errors.Errorf("config.KafkaBrokers only produces the rows in the %s or %s file type, but config.FileType is '%s'",
+			FileFormatMongoJSONString, FileFormatChangeFeedString, conf.FileType)
+	case conf.CompressType != CompressNone:
+		return errors.New("config.KafkaBrokers can't be used with config.CompressType")
+	case conf.ServerSideDump:
+		return errors.New("config.KafkaBrokers can't be used with config.ServerSideDump, the data isn't read by Dumpling")
+	case len(conf.ColumnGroups) > 0:
+		return errors.New("config.KafkaBrokers can't be used with config.ColumnGroups, a row is split into several files")
+	case conf.PartitionByColumn != "":
+		return errors.New("config.KafkaBrokers can't be used with config.PartitionByColumn")
+	}
+	return nil
+}
+
+// adjustRestoreAsserts checks the options which the row counts of the restored tables can't be asserted with
+func adjustRestoreAsserts(conf *Config) error {
+	if conf.EmitRestoreAsserts && len(conf.ColumnGroups) > 0 {
+		return errors.New("config.EmitRestoreAsserts can't be used with config.ColumnGroups, the rows of a table are written several times")
+	}
+	return nil
+}
+
+// adjustOrderByCollation normalizes and checks conf.OrderByCollation
+func adjustOrderByCollation(conf *Config) error {
+	conf.OrderByCollation = strings.ToLower(strings.TrimSpace(conf.OrderByCollation))
+	if conf.OrderByCollation != "" && !tableOptionRegexp.MatchString(conf.OrderByCollation) {
+		return errors.Errorf("invalid config.OrderByCollation '%s'", conf.OrderByCollation)
+	}
+	return nil
+}
+
+// adjustPKIndex checks the options which the primary key indexes can't be written with
+func adjustPKIndex(conf *Config) error {
+	if !conf.EmitPKIndex {
+		return nil
+	}
+	switch {
+	case len(conf.ColumnGroups) > 0:
+		return errors.New("config.EmitPKIndex can't be used with config.ColumnGroups, the primary keys of a table are dumped several times")
+	case conf.ServerSideDump:
+		return errors.New("config.EmitPKIndex can't be used with config.ServerSideDump, the rows aren't read by Dumpling")
+	}
+	return nil
+}
+
+// adjustCheckpoint checks the options which the dump can't be resumed with, the chunks must be recorded by their
+// queries and written again the same way after resuming
+func adjustCheckpoint(conf *Config) error {
+	if conf.Checkpoint == "" {
+		return nil
+	}
+	switch {
+	case conf.SQL != "" || len(conf.NamedQueries) > 0:
+		return errors.New("config.Checkpoint can't be used with --sql or --named-query")
+	case conf.OutputFIFO != "":
+		return errors.New("config.Checkpoint can't be used with config.OutputFIFO, the files streamed can't be resumed")
+	case len(conf.ColumnGroups) > 0 || conf.MaterializePartitionColumn != "":
+		return errors.New("config.Checkpoint can't be used with config.ColumnGroups or config.MaterializePartitionColumn, " +
+			"the chunks of a table select different columns")
+	case conf.SubsetSeed != "":
+		return errors.New("config.Checkpoint can't be used with config.SubsetSeed")
+	case conf.VerifyChunkCount || conf.PerTableBudget > 0 || conf.ChunkTimeout > 0:
+		return errors.New("config.Checkpoint can't be used with config.VerifyChunkCount, config.PerTableBudget or config.ChunkTimeout, " +
+			"the chunks written aren't the ones recorded")
+	case conf.SampleTables != "" && conf.SampleTablesSeed == 0:
+		return errors.New("config.Checkpoint can't be used with config.SampleTables without config.SampleTablesSeed, " +
+			"the other tables would be selected after resuming")
+	}
 	return nil
 }
@@ -4,7 +4,10 @@ package export
 
 import (
 	"context"
+	"strings"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
 	. "github.com/pingcap/check"
 )
 
@@ -18,3 +21,565 @@ func (s *testConfigSuite) TestCreateExternalStorage(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(loc.URI(), Matches, "file:.*")
 }
+
+func (s *testConfigSuite) TestAdjustTimeWindow(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustTimeWindow(conf), IsNil)
+	c.Assert(conf.Where, Equals, "")
+
+	conf.TimeFrom = "2021-01-01"
+	c.Assert(adjustTimeWindow(conf), ErrorMatches, ".*must be used with --time-column.*")
+
+	conf.TimeColumn = "created_at"
+	c.Assert(adjustTimeWindow(conf), ErrorMatches, ".*both --time-from and --time-to should be specified.*")
+
+	conf.TimeTo = "2021-01-07 23:59:59"
+	c.Assert(adjustTimeWindow(conf), IsNil)
+	c.Assert(conf.Where, Equals, "`created_at` BETWEEN '2021-01-01' AND '2021-01-07 23:59:59'")
+
+	conf.Where = "uid = 1"
+	conf.TimeColumn = "create`d"
+	conf.TimeTo = "2021-01-07'"
+	c.Assert(adjustTimeWindow(conf), IsNil)
+	c.Assert(conf.Where, Equals, "(uid = 1) AND `create``d` BETWEEN '2021-01-01' AND '2021-01-07\\''")
+
+	conf.SQL = "select * from t"
+	c.Assert(adjustTimeWindow(conf), ErrorMatches, ".*can't specify both --sql and --time-column.*")
+}
+
+func (s *testConfigSuite) TestAdjustCsvInvalidUTF8(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.CsvInvalidUTF8 = "Replace"
+	c.Assert(adjustFileFormat(conf), IsNil)
+	c.Assert(conf.CsvInvalidUTF8, Equals, CsvInvalidUTF8Replace)
+
+	conf.CsvInvalidUTF8 = "drop"
+	c.Assert(adjustFileFormat(conf), ErrorMatches, "unknown config.CsvInvalidUTF8 'drop'.*")
+
+	// only check the values when the results are expected to be UTF-8
+	conf.CsvInvalidUTF8 = CsvInvalidUTF8Error
+	c.Assert(csvInvalidUTF8Mode(conf), Equals, CsvInvalidUTF8Error)
+	conf.SessionParams = map[string]interface{}{"character_set_results": "latin1"}
+	c.Assert(csvInvalidUTF8Mode(conf), Equals, "")
+	conf.SessionParams["character_set_results"] = "UTF8MB4"
+	c.Assert(csvInvalidUTF8Mode(conf), Equals, CsvInvalidUTF8Error)
+}
+
+func (s *testConfigSuite) TestAdjustNumberFormat(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.DecimalFormat = "Trim-Zeros"
+	conf.FloatFormat = "PLAIN"
+	c.Assert(adjustFileFormat(conf), IsNil)
+	c.Assert(conf.DecimalFormat, Equals, DecimalFormatTrimZeros)
+	c.Assert(conf.FloatFormat, Equals, FloatFormatPlain)
+
+	conf.DecimalFormat = "round"
+	c.Assert(adjustFileFormat(conf), ErrorMatches, "unknown config.DecimalFormat 'round'.*")
+	conf.DecimalFormat = NumberFormatExact
+	conf.FloatFormat = "hex"
+	c.Assert(adjustFileFormat(conf), ErrorMatches, "unknown config.FloatFormat 'hex'.*")
+}
+
+func (s *testConfigSuite) TestAdjustTransactionPerTable(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.FileType = FileFormatSQLTextString
+	conf.TransactionPerTable = true
+	c.Assert(adjustTransactionPerTable(conf), IsNil)
+
+	conf.Rows = 10000
+	c.Assert(adjustTransactionPerTable(conf), ErrorMatches, "config.TransactionPerTable requires the data of each table in one sql file, but --rows splits the tables into chunks")
+	conf.Rows = UnspecifiedSize
+	conf.FileSize = 1 << 20
+	c.Assert(adjustTransactionPerTable(conf), ErrorMatches, ".*--filesize splits the data of a table into several files")
+	conf.FileSize = UnspecifiedSize
+	conf.RowsPerTransaction = 100
+	c.Assert(adjustTransactionPerTable(conf), ErrorMatches, ".*--rows-per-transaction wraps the rows in smaller transactions")
+	conf.RowsPerTransaction = 0
+	conf.RecentPartitions = 2
+	c.Assert(adjustTransactionPerTable(conf), ErrorMatches, ".*the partitions are written into separate files")
+	conf.RecentPartitions = 0
+	conf.FileType = FileFormatCSVString
+	c.Assert(adjustTransactionPerTable(conf), ErrorMatches, ".*only sql files have transactions")
+}
+
+func (s *testConfigSuite) TestAdjustPreCheckTables(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustPreCheckTables(conf), IsNil)
+	c.Assert(conf.PreCheckFailureMode, Equals, PreCheckFailureAbort)
+
+	conf.PreCheckTables = "Full"
+	conf.PreCheckFailureMode = "SKIP"
+	c.Assert(adjustPreCheckTables(conf), IsNil)
+	c.Assert(conf.PreCheckTables, Equals, PreCheckTablesFull)
+	c.Assert(conf.PreCheckFailureMode, Equals, PreCheckFailureSkip)
+
+	conf.PreCheckTables = "extended"
+	c.Assert(adjustPreCheckTables(conf), ErrorMatches, "unknown config.PreCheckTables 'extended'.*")
+	conf.PreCheckTables = PreCheckTablesQuick
+	conf.PreCheckFailureMode = "ignore"
+	c.Assert(adjustPreCheckTables(conf), ErrorMatches, "unknown config.PreCheckFailureMode 'ignore'.*")
+}
+
+func (s *testConfigSuite) TestAdjustViewMode(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustViewMode(conf), IsNil)
+	c.Assert(conf.ViewMode, Equals, ViewModeSkip)
+	c.Assert(conf.NoViews, IsTrue)
+
+	conf.ViewMode = ""
+	conf.NoViews = false
+	c.Assert(adjustViewMode(conf), IsNil)
+	c.Assert(conf.ViewMode, Equals, ViewModeDefinition)
+
+	conf.ViewMode = "Materialize"
+	conf.NoViews = true
+	c.Assert(adjustViewMode(conf), IsNil)
+	c.Assert(conf.ViewMode, Equals, ViewModeMaterialize)
+	c.Assert(conf.NoViews, IsFalse)
+
+	conf.ViewMode = "placeholder"
+	c.Assert(adjustViewMode(conf), ErrorMatches, "unknown config.ViewMode 'placeholder'.*")
+}
+
+func (s *testConfigSuite) TestAdjustGCSafePointPolicy(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustGCSafePointPolicy(conf), IsNil)
+	c.Assert(conf.GCSafePointUpdateRetries, Equals, defaultGCSafePointUpdateRetries)
+	c.Assert(conf.GCSafePointFailureAction, Equals, GCSafePointFailureAbort)
+
+	conf.GCSafePointFailureAction = "Continue"
+	c.Assert(adjustGCSafePointPolicy(conf), IsNil)
+	c.Assert(conf.GCSafePointFailureAction, Equals, GCSafePointFailureContinue)
+
+	conf.GCSafePointFailureAction = "ignore"
+	c.Assert(adjustGCSafePointPolicy(conf), ErrorMatches, "unknown config.GCSafePointFailureAction 'ignore'.*")
+	conf.GCSafePointFailureAction = GCSafePointFailureAbort
+	conf.GCSafePointUpdateRetries = -1
+	c.Assert(adjustGCSafePointPolicy(conf), ErrorMatches, ".*should not be negative.*")
+}
+
+func (s *testConfigSuite) TestAdjustMigrationLayout(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.MigrationLayout = true
+	c.Assert(adjustMigrationLayout(conf), IsNil)
+	conf.DedupSchema = true
+	c.Assert(adjustMigrationLayout(conf), ErrorMatches, ".*can't be used with config.DedupSchema.*")
+}
+
+func (s *testConfigSuite) TestConfigHash(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.Password = "topsecret-password"
+	conf.S3.SecretAccessKey = "topsecret-key"
+	c.Assert(conf.String(), Not(Matches), ".*topsecret.*")
+	c.Assert(conf.S3.SecretAccessKey, Equals, "topsecret-key")
+	// the credentials in the query of the output URL are hidden too
+	conf.OutputDirPath = "s3://bucket/prefix?access-key=topsecret-ak&secret-access-key=topsecret-sk&region=us-west-2"
+	c.Assert(conf.String(), Not(Matches), ".*topsecret.*")
+	c.Assert(conf.redacted().OutputDirPath, Equals, "s3://bucket/prefix?access-key=******&region=******&secret-access-key=******")
+	c.Assert(conf.OutputDirPath, Matches, ".*topsecret-sk.*")
+	c.Assert(redactStorageURL("/data/dump"), Equals, "/data/dump")
+	conf.OutputDirPath = c.MkDir()
+
+	hash, err := conf.Hash()
+	c.Assert(err, IsNil)
+	c.Assert(hash, HasLen, 64)
+
+	// the fields decided during the dump don't change the hash
+	conf.Snapshot = "424242"
+	conf.SessionParams = map[string]interface{}{snapshotSessionParam: "424242"}
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeTiDB}
+	conf.Tables = DatabaseTables{}.AppendTables("test", "t")
+	sameHash, err := conf.Hash()
+	c.Assert(err, IsNil)
+	c.Assert(sameHash, Equals, hash)
+	c.Assert(conf.SessionParams, HasLen, 1)
+
+	// the host chosen from the candidates doesn't change the hash
+	conf.Hosts = []string{"10.0.0.1", "10.0.0.2:3306"}
+	hash, err = conf.Hash()
+	c.Assert(err, IsNil)
+	conf.Host, conf.Port = "10.0.0.2", 3306
+	sameHash, err = conf.Hash()
+	c.Assert(err, IsNil)
+	c.Assert(sameHash, Equals, hash)
+
+	conf.Threads++
+	otherHash, err := conf.Hash()
+	c.Assert(err, IsNil)
+	c.Assert(otherHash, Not(Equals), hash)
+}
+
+func (s *testConfigSuite) TestAdjustSkipColumnTypes(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustSkipColumnTypes(conf), IsNil)
+	conf.SkipColumnTypesInSchema = true
+	c.Assert(adjustSkipColumnTypes(conf), ErrorMatches, "config.SkipColumnTypesInSchema requires config.SkipColumnTypes")
+
+	conf.SkipColumnTypes = []string{" blob", "", "Json "}
+	c.Assert(adjustSkipColumnTypes(conf), IsNil)
+	c.Assert(conf.SkipColumnTypes, DeepEquals, []string{"BLOB", "JSON"})
+
+	conf.SQL = "SELECT 1"
+	c.Assert(adjustSkipColumnTypes(conf), ErrorMatches, "config.SkipColumnTypes is only supported for dumping tables.*")
+}
+
+func (s *testConfigSuite) TestAdjustChunkExpressions(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustChunkExpressions(conf), IsNil)
+	conf.ChunkExpressions = map[string]map[string]string{"db": {"t": "id DIV 10"}}
+	c.Assert(adjustChunkExpressions(conf), ErrorMatches, "config.ChunkExpressions requires --rows, --table-rows or --chunk-by-filesize to split the tables into chunks")
+	conf.TableRows = map[string]map[string]uint64{"db": {"t": 10000}}
+	c.Assert(adjustChunkExpressions(conf), IsNil)
+	conf.TableRows = nil
+	conf.Rows = 10000
+	c.Assert(adjustChunkExpressions(conf), IsNil)
+}
+
+func (s *testConfigSuite) TestAdjustCollationAllowlist(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustCollationAllowlist(conf), IsNil)
+	c.Assert(conf.CollationMode, Equals, CollationModeReport)
+	conf.DefaultCollation = "utf8mb4_0900_ai_ci"
+	c.Assert(adjustCollationAllowlist(conf), ErrorMatches, "config.CollationMode and config.DefaultCollation require config.CollationAllowlist")
+
+	conf.CollationAllowlist = []string{" UTF8MB4_bin", ""}
+	conf.CollationMode = "Rewrite"
+	c.Assert(adjustCollationAllowlist(conf), IsNil)
+	c.Assert(conf.CollationMode, Equals, CollationModeRewrite)
+	// the default collation is allowed
+	c.Assert(conf.CollationAllowlist, DeepEquals, []string{"utf8mb4_bin", "utf8mb4_0900_ai_ci"})
+
+	conf.DefaultCollation = ""
+	c.Assert(adjustCollationAllowlist(conf), ErrorMatches, "config.DefaultCollation is required to rewrite the collations not in config.CollationAllowlist")
+	conf.CollationMode = "drop"
+	c.Assert(adjustCollationAllowlist(conf), ErrorMatches, "unknown config.CollationMode 'drop'.*")
+}
+
+func (s *testConfigSuite) TestAdjustVerifyChunkCount(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(conf.VerifyChunkCountRetries, Equals, defaultVerifyChunkCountRetries)
+	conf.OutputFIFO = "/tmp/dump.fifo"
+	c.Assert(adjustVerifyChunkCount(conf), IsNil)
+	conf.VerifyChunkCount = true
+	c.Assert(adjustVerifyChunkCount(conf), ErrorMatches, "config.VerifyChunkCount can't be used with config.OutputFIFO.*")
+	conf.OutputFIFO = ""
+	c.Assert(adjustVerifyChunkCount(conf), IsNil)
+	conf.VerifyChunkCountRetries = -1
+	c.Assert(adjustVerifyChunkCount(conf), ErrorMatches, "config.VerifyChunkCountRetries is set to -1. It should not be negative")
+}
+
+func (s *testConfigSuite) TestAdjustIdentifierQuote(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustIdentifierQuote(conf), IsNil)
+	c.Assert(conf.IdentifierQuote, Equals, IdentifierQuoteBacktick)
+	conf.IdentifierQuote = ""
+	c.Assert(adjustIdentifierQuote(conf), IsNil)
+	c.Assert(conf.IdentifierQuote, Equals, IdentifierQuoteBacktick)
+	conf.IdentifierQuote = " Double-Quote"
+	c.Assert(adjustIdentifierQuote(conf), IsNil)
+	c.Assert(conf.IdentifierQuote, Equals, IdentifierQuoteDouble)
+	conf.IdentifierQuote = "["
+	c.Assert(adjustIdentifierQuote(conf), ErrorMatches, "unknown config.IdentifierQuote '\\['.*")
+}
+
+func (s *testConfigSuite) TestAdjustTargetDSN(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.FileType = FileFormatSQLTextString
+	c.Assert(adjustTargetDSN(conf), IsNil)
+	conf.LoadOnly = true
+	c.Assert(adjustTargetDSN(conf), ErrorMatches, "config.LoadOnly requires config.TargetDSN")
+
+	conf.TargetDSN = "root@tcp(127.0.0.1:4000"
+	c.Assert(adjustTargetDSN(conf), ErrorMatches, "invalid config.TargetDSN.*")
+	conf.TargetDSN = "root@tcp(127.0.0.1:4000)/"
+	c.Assert(adjustTargetDSN(conf), IsNil)
+	conf.FileType = FileFormatCSVString
+	c.Assert(adjustTargetDSN(conf), ErrorMatches, "config.TargetDSN only loads the sql file type, but config.FileType is 'csv'")
+	conf.FileType = FileFormatSQLTextString
+	conf.RowsPerTransaction = 1000
+	c.Assert(adjustTargetDSN(conf), ErrorMatches, "config.TargetDSN can't be used with the transactions in the sql files.*")
+}
+
+func (s *testConfigSuite) TestAdjustSafeModeRows(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.FileType = FileFormatCSVString
+	c.Assert(adjustSafeModeRows(conf), IsNil)
+	conf.SafeModeRows = 100
+	c.Assert(adjustSafeModeRows(conf), ErrorMatches, "config.SafeModeRows only writes the sql file type, but config.FileType is 'csv'")
+	conf.FileType = FileFormatSQLTextString
+	c.Assert(adjustSafeModeRows(conf), IsNil)
+	conf.SafeModeRows = SafeModeWholeTable
+	c.Assert(adjustSafeModeRows(conf), IsNil)
+	conf.SafeModeRows = -2
+	c.Assert(adjustSafeModeRows(conf), ErrorMatches, "config.SafeModeRows is set to -2. It should be positive, or -1 for all the rows")
+}
+
+func (s *testConfigSuite) TestAdjustIncrementalAgainst(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustIncrementalAgainst(conf), IsNil)
+	conf.IncrementalAgainst = "/backup/day1/catalog.json"
+	c.Assert(adjustIncrementalAgainst(conf), ErrorMatches, "config.IncrementalAgainst requires config.EmitCatalog.*")
+	conf.EmitCatalog = true
+	c.Assert(adjustIncrementalAgainst(conf), IsNil)
+}
+
+func (s *testConfigSuite) TestAdjustImportIntoCompat(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustImportIntoCompat(conf), IsNil)
+	c.Assert(conf.OutputFileTemplate, Equals, DefaultOutputFileTemplate)
+
+	conf.ImportIntoCompat = "v6.5.0"
+	c.Assert(adjustImportIntoCompat(conf), ErrorMatches, "config.ImportIntoCompat requires TiDB v7.2.0 or later.*")
+	conf.ImportIntoCompat = "latest"
+	c.Assert(adjustImportIntoCompat(conf), ErrorMatches, "fail to parse the target TiDB version 'latest'.*")
+	conf.ImportIntoCompat = "7.2.0"
+	conf.FileType = FileFormatMongoJSONString
+	c.Assert(adjustImportIntoCompat(conf), ErrorMatches, "config.ImportIntoCompat only supports the sql and csv file types.*")
+	conf.FileType = FileFormatCSVString
+	conf.SQL = "SELECT 1"
+	c.Assert(adjustImportIntoCompat(conf), ErrorMatches, "config.ImportIntoCompat can't be used with config.SQL.*")
+	conf.SQL = ""
+	conf.OutputFileTemplate, _ = ParseOutputFileTemplate(`{{fn .DB}}.{{.Index}}`)
+	c.Assert(adjustImportIntoCompat(conf), ErrorMatches, "config.ImportIntoCompat requires the data file names .*")
+	conf.OutputFileTemplate = DefaultOutputFileTemplate
+	c.Assert(adjustImportIntoCompat(conf), IsNil)
+	c.Assert(conf.OutputFileTemplate, Not(Equals), DefaultOutputFileTemplate)
+}
+
+func (s *testConfigSuite) TestAdjustPerTableBudget(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustPerTableBudget(conf), IsNil)
+	conf.PerTableBudget = -time.Minute
+	c.Assert(adjustPerTableBudget(conf), ErrorMatches, "config.PerTableBudget is set to -1m0s.*")
+	conf.PerTableBudget = time.Minute
+	c.Assert(adjustPerTableBudget(conf), IsNil)
+	conf.VerifyChunkCount = true
+	c.Assert(adjustPerTableBudget(conf), ErrorMatches, "config.PerTableBudget can't be used with config.VerifyChunkCount.*")
+}
+
+func (s *testConfigSuite) TestAdjustPerChunkBinlogPos(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustPerChunkBinlogPos(conf), IsNil)
+	conf.PerChunkBinlogPos = true
+	c.Assert(adjustPerChunkBinlogPos(conf), ErrorMatches, "config.PerChunkBinlogPos requires config.ChunkMetadata.*")
+	conf.ChunkMetadata = true
+	conf.Consistency = consistencyTypeSnapshot
+	c.Assert(adjustPerChunkBinlogPos(conf), ErrorMatches, "config.PerChunkBinlogPos can't be used with the snapshot consistency.*")
+	conf.Consistency = consistencyTypeNone
+	c.Assert(adjustPerChunkBinlogPos(conf), IsNil)
+}
+
+func (s *testConfigSuite) TestAdjustGenerateLightningConfig(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.GenerateLightningConfig = true
+	c.Assert(adjustGenerateLightningConfig(conf), IsNil)
+	conf.FileType = FileFormatMongoJSONString
+	c.Assert(adjustGenerateLightningConfig(conf), ErrorMatches, "config.GenerateLightningConfig only supports the sql and csv file types.*")
+	conf.FileType = FileFormatCSVString
+	conf.SQL = "SELECT 1"
+	c.Assert(adjustGenerateLightningConfig(conf), ErrorMatches, "config.GenerateLightningConfig can't be used with config.SQL.*")
+}
+
+func (s *testConfigSuite) TestAdjustInvalidEnumHandling(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustInvalidEnumHandling(conf), IsNil)
+	c.Assert(conf.InvalidEnumHandling, Equals, InvalidEnumKeep)
+	conf.InvalidEnumHandling = " NULL "
+	c.Assert(adjustInvalidEnumHandling(conf), IsNil)
+	c.Assert(conf.InvalidEnumHandling, Equals, InvalidEnumNull)
+	conf.InvalidEnumHandling = "last"
+	c.Assert(adjustInvalidEnumHandling(conf), ErrorMatches, "unknown config.InvalidEnumHandling 'last'.*")
+}
+
+func (s *testConfigSuite) TestAdjustHashPrefixFiles(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustHashPrefixFiles(conf), IsNil)
+	conf.HashPrefixFiles = -1
+	c.Assert(adjustHashPrefixFiles(conf), ErrorMatches, "config.HashPrefixFiles is set to -1.*")
+	conf.HashPrefixFiles = 16
+	c.Assert(adjustHashPrefixFiles(conf), ErrorMatches, "config.HashPrefixFiles requires config.EmitCatalog.*")
+	conf.EmitCatalog = true
+	c.Assert(adjustHashPrefixFiles(conf), IsNil)
+	conf.ImportIntoCompat = "v7.5.0"
+	c.Assert(adjustHashPrefixFiles(conf), ErrorMatches, "config.HashPrefixFiles can't be used with config.ImportIntoCompat.*")
+}
+
+func (s *testConfigSuite) TestAdjustSubsetSeed(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustSubsetSeed(conf), IsNil)
+	conf.SubsetSeed = "test.customers:1"
+	c.Assert(adjustSubsetSeed(conf), IsNil)
+	conf.SubsetMaxRows = 0
+	c.Assert(adjustSubsetSeed(conf), ErrorMatches, "config.SubsetMaxRows is set to 0.*")
+	conf.SubsetMaxRows = defaultSubsetMaxRows
+	conf.Where = "id > 1"
+	c.Assert(adjustSubsetSeed(conf), ErrorMatches, "config.SubsetSeed can't be used with config.Where.*")
+	conf.Where = ""
+	conf.SubsetSeed = "customers:1"
+	c.Assert(adjustSubsetSeed(conf), ErrorMatches, ".*only accepts a qualified table name")
+}
+
+func (s *testConfigSuite) TestAdjustRowCountTrailer(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.RowCountTrailer = true
+	conf.FileType = FileFormatCSVString
+	c.Assert(adjustRowCountTrailer(conf), IsNil)
+	conf.FileType = FileFormatMongoJSONString
+	c.Assert(adjustRowCountTrailer(conf), ErrorMatches, "config.RowCountTrailer only supports the sql and csv file types.*")
+	conf.FileType = FileFormatSQLTextString
+	conf.ServerSideDump = true
+	c.Assert(adjustRowCountTrailer(conf), ErrorMatches, "config.RowCountTrailer can't be used with config.ServerSideDump.*")
+}
+
+func (s *testConfigSuite) TestAdjustColumnCountMismatch(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.ColumnCountMismatch = ""
+	c.Assert(adjustColumnCountMismatch(conf), IsNil)
+	c.Assert(conf.ColumnCountMismatch, Equals, ColumnCountMismatchFail)
+	conf.ColumnCountMismatch = "Refetch"
+	c.Assert(adjustColumnCountMismatch(conf), IsNil)
+	c.Assert(conf.ColumnCountMismatch, Equals, ColumnCountMismatchRefetch)
+	conf.ColumnCountMismatch = "skip"
+	c.Assert(adjustColumnCountMismatch(conf), ErrorMatches, "unknown config.ColumnCountMismatch 'skip'.*")
+}
+
+func (s *testConfigSuite) TestAdjustLowercaseIdentifiers(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.LowercaseIdentifiers = true
+	conf.FileType = FileFormatCSVString
+	c.Assert(adjustLowercaseIdentifiers(conf), IsNil)
+	conf.FileType = FileFormatMongoJSONString
+	c.Assert(adjustLowercaseIdentifiers(conf), ErrorMatches, "config.LowercaseIdentifiers only supports the sql and csv file types.*")
+}
+
+func (s *testConfigSuite) TestAdjustMaxReplicaLagSeconds(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustMaxReplicaLagSeconds(conf), IsNil)
+	conf.MaxReplicaLagSeconds = 30
+	c.Assert(adjustMaxReplicaLagSeconds(conf), IsNil)
+	conf.MaxReplicaLagSeconds = -1
+	c.Assert(adjustMaxReplicaLagSeconds(conf), ErrorMatches, "config.MaxReplicaLagSeconds should be non-negative.*")
+}
+
+func (s *testConfigSuite) TestAdjustMaxFieldBytes(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustMaxFieldBytes(conf), IsNil)
+	conf.MaxFieldBytes = 65535
+	c.Assert(adjustMaxFieldBytes(conf), ErrorMatches, "config.MaxFieldBytes only supports the csv file type.*")
+	conf.FileType = FileFormatCSVString
+	c.Assert(adjustMaxFieldBytes(conf), IsNil)
+	conf.MaxFieldBytes = 8
+	c.Assert(adjustMaxFieldBytes(conf), ErrorMatches, "config.MaxFieldBytes should be at least 16.*")
+	// the limit and the marker apply to the raw bytes, not to the encoded ones
+	conf.MaxFieldBytes = 65535
+	conf.BinaryEncoding = BinaryEncodingHex
+	c.Assert(adjustMaxFieldBytes(conf), ErrorMatches, "config.MaxFieldBytes can't be used with config.BinaryEncoding 'hex'.*")
+	conf.BinaryEncoding = BinaryEncodingBase64
+	c.Assert(adjustMaxFieldBytes(conf), ErrorMatches, "config.MaxFieldBytes can't be used with config.BinaryEncoding 'base64'.*")
+	conf.BinaryEncoding = BinaryEncodingRaw
+	c.Assert(adjustMaxFieldBytes(conf), IsNil)
+}
+
+func (s *testConfigSuite) TestAdjustPartitionByColumn(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustPartitionByColumn(conf), IsNil)
+	conf.PartitionByColumn = "t:dt"
+	c.Assert(adjustPartitionByColumn(conf), ErrorMatches, "partition by column `t:dt` only accepts a qualified table name")
+	conf.PartitionByColumn = "test.t:dt"
+	c.Assert(adjustPartitionByColumn(conf), IsNil)
+	conf.FileSize = 1024
+	c.Assert(adjustPartitionByColumn(conf), ErrorMatches, "config.PartitionByColumn can't be used with config.FileSize")
+	conf.FileSize = UnspecifiedSize
+	conf.PartitionMaxOpenFiles = 0
+	c.Assert(adjustPartitionByColumn(conf), ErrorMatches, "config.PartitionMaxOpenFiles should be positive, but got 0")
+}
+
+func (s *testConfigSuite) TestGetDSNWithConnectionAttributes(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.User, conf.Host, conf.Port, conf.ReadTimeout = "root", "127.0.0.1", 4000, 15*time.Minute
+	conf.ConnectionAttributes = map[string]string{"job_id": "daily backup"}
+	c.Assert(adjustConnectionAttributes(conf), IsNil)
+	c.Assert(conf.GetDSN(""), Equals, "root:@tcp(127.0.0.1:4000)/?collation=utf8mb4_general_ci&readTimeout=15m0s&writeTimeout=30s"+
+		"&interpolateParams=true&maxAllowedPacket=0&@job_id=%27daily+backup%27&@program_name=%27dumpling%27")
+
+	cfg, err := mysql.ParseDSN(conf.GetDSN(""))
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Params, DeepEquals, map[string]string{"@job_id": "'daily backup'", "@program_name": "'dumpling'"})
+}
+
+func (s *testConfigSuite) TestAdjustConnectionAttributes(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustConnectionAttributes(conf), IsNil)
+	c.Assert(conf.ConnectionAttributes, HasLen, 0)
+
+	conf.ConnectionAttributes = map[string]string{"program_name": "nightly-dump"}
+	c.Assert(adjustConnectionAttributes(conf), IsNil)
+	c.Assert(conf.ConnectionAttributes, DeepEquals, map[string]string{"program_name": "nightly-dump"})
+
+	conf.ConnectionAttributes = map[string]string{"_client_name": "dumpling"}
+	c.Assert(adjustConnectionAttributes(conf), ErrorMatches, "invalid connection attribute name `_client_name`.*")
+	conf.ConnectionAttributes = map[string]string{"job id": "1"}
+	c.Assert(adjustConnectionAttributes(conf), ErrorMatches, "invalid connection attribute name `job id`.*")
+	conf.ConnectionAttributes = map[string]string{"job_id": "it's"}
+	c.Assert(adjustConnectionAttributes(conf), ErrorMatches, "the value of connection attribute `job_id` can't contain quotes or backslashes")
+	conf.ConnectionAttributes = map[string]string{"job_id": strings.Repeat("a", 1025)}
+	c.Assert(adjustConnectionAttributes(conf), ErrorMatches, "the value of connection attribute `job_id` is longer than 1024 bytes")
+}
+
+func (s *testConfigSuite) TestAdjustSplitSchemaByType(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.SplitSchemaByType = true
+	c.Assert(adjustSplitSchemaByType(conf), IsNil)
+	conf.MigrationLayout = true
+	c.Assert(adjustSplitSchemaByType(conf), ErrorMatches, "config.SplitSchemaByType can't be used with config.MigrationLayout.*")
+}
+
+func (s *testConfigSuite) TestAdjustPartitionFilter(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.PartitionFilter = "shop.logs:PARTITION_NAME LIKE 'p2021%'"
+	c.Assert(adjustPartitionFilter(conf), IsNil)
+	conf.RecentPartitions = 2
+	c.Assert(adjustPartitionFilter(conf), ErrorMatches, "config.PartitionFilter can't be used with config.RecentPartitions.*")
+	conf.RecentPartitions = 0
+	conf.PartitionFilter = "logs:PARTITION_NAME LIKE 'p2021%'"
+	c.Assert(adjustPartitionFilter(conf), ErrorMatches, "partition filter .* only accepts a qualified table name")
+}
+
+func (s *testConfigSuite) TestAdjustExclusiveTarget(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.ExclusiveTarget = true
+	c.Assert(adjustExclusiveTarget(conf), IsNil)
+	conf.ExclusiveTargetStaleAfter = time.Millisecond
+	c.Assert(adjustExclusiveTarget(conf), ErrorMatches, "config.ExclusiveTargetStaleAfter should be at least 1s, but got 1ms")
+	conf.ExclusiveTargetStaleAfter = time.Minute
+	conf.OutputFIFO = "/tmp/dumpling.fifo"
+	c.Assert(adjustExclusiveTarget(conf), ErrorMatches, "config.ExclusiveTarget can't be used with config.OutputFIFO.*")
+}
+
+func (s *testConfigSuite) TestAdjustNullsHandling(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(conf.NullsHandling, Equals, NullsHandlingFirst)
+	conf.NullsHandling = "Separate"
+	c.Assert(adjustNullsHandling(conf), IsNil)
+	c.Assert(conf.NullsHandling, Equals, NullsHandlingSeparate)
+	conf.NullsHandling = ""
+	c.Assert(adjustNullsHandling(conf), IsNil)
+	c.Assert(conf.NullsHandling, Equals, NullsHandlingFirst)
+	conf.NullsHandling = "middle"
+	c.Assert(adjustNullsHandling(conf), ErrorMatches, "unknown config.NullsHandling 'middle'.*")
+}
+
+func (s *testConfigSuite) TestAdjustKafkaSink(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.KafkaOnly = true
+	c.Assert(adjustKafkaSink(conf), ErrorMatches, ".* require config.KafkaBrokers")
+	conf.KafkaBrokers = []string{"127.0.0.1:9092"}
+	c.Assert(adjustKafkaSink(conf), ErrorMatches, "config.KafkaBrokers requires config.KafkaTopic")
+	conf.KafkaTopic = "dump"
+	conf.FileType = FileFormatCSVString
+	c.Assert(adjustKafkaSink(conf), ErrorMatches, "config.KafkaBrokers only produces the rows in the mongo-json or change-feed file type.*")
+	conf.FileType = FileFormatChangeFeedString
+	c.Assert(adjustKafkaSink(conf), IsNil)
+	conf.CompressType = CompressGzip
+	c.Assert(adjustKafkaSink(conf), ErrorMatches, "config.KafkaBrokers can't be used with config.CompressType")
+}
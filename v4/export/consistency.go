@@ -5,11 +5,13 @@ package export
 import (
 	"context"
 	"database/sql"
+	"strings"
 
 	tcontext "github.com/pingcap/dumpling/v4/context"
 
 	"github.com/pingcap/br/pkg/utils"
 	"github.com/pingcap/errors"
+	"go.uber.org/zap"
 )
 
 const (
@@ -18,6 +20,13 @@ const (
 	consistencyTypeLock     = "lock"
 	consistencyTypeSnapshot = "snapshot"
 	consistencyTypeNone     = "none"
+	// consistencyTypeConsistentSnapshot starts the transactions of all the connections while the binlog position
+	// doesn't move, so they read the same snapshot without any global lock
+	consistencyTypeConsistentSnapshot = "consistent-snapshot"
+
+	// maxConsistentSnapshotAttempts is how many times the transactions are started again if the binlog position
+	// moves while they're being started
+	maxConsistentSnapshotAttempts = 10
 )
 
 // NewConsistencyController returns a new consistency controller
@@ -42,6 +51,16 @@ func NewConsistencyController(ctx context.Context, conf *Config, session *sql.DB
 			return nil, errors.New("snapshot consistency is not supported for this server")
 		}
 		return &ConsistencyNone{}, nil
+	case consistencyTypeConsistentSnapshot:
+		if conf.ServerInfo.ServerType == ServerTypeTiDB {
+			return nil, errors.New("consistent-snapshot consistency is not supported for TiDB, please use snapshot consistency")
+		}
+		return &ConsistencyConsistentSnapshot{
+			serverType: conf.ServerInfo.ServerType,
+			conn:       conn,
+			pool:       session,
+			connCount:  conf.Threads + 1,
+		}, nil
 	case consistencyTypeNone:
 		return &ConsistencyNone{}, nil
 	default:
@@ -144,4 +163,114 @@ func (c *ConsistencyLockDumpingTables) PingContext(ctx context.Context) error {
 	return c.conn.PingContext(ctx)
 }
 
+// ConsistencyConsistentSnapshot starts the consistent snapshots of the meta connection and the connections of
+// the writers together, and starts them again until the binlog position doesn't move meanwhile. Then no write
+// is committed between the snapshots, so they're the same one, without any lock or the RELOAD privilege.
+type ConsistencyConsistentSnapshot struct {
+	serverType ServerType
+	// conn reads the binlog position outside of the snapshots
+	conn      *sql.Conn
+	pool      *sql.DB
+	connCount int
+	// sessionParams are set on the connections of the snapshots
+	sessionParams map[string]interface{}
+	// metadata records the binlog position of the snapshots if it's set
+	metadata *globalMetadata
+	// conns are the connections whose snapshots are started but not taken yet
+	conns []*sql.Conn
+}
+
+// Setup implements ConsistencyController.Setup
+func (c *ConsistencyConsistentSnapshot) Setup(tctx *tcontext.Context) error {
+	// the connections are opened in advance, so only the transactions are started while checking the position
+	for len(c.conns) < c.connCount {
+		conn, err := openConnWithSessionParams(tctx, c.pool, c.sessionParams)
+		if err != nil {
+			return err
+		}
+		c.conns = append(c.conns, conn)
+	}
+	for attempt := 1; ; attempt++ {
+		before, err := ShowMasterStatus(c.conn)
+		if err != nil {
+			return err
+		}
+		for _, conn := range c.conns {
+			if err = startConsistentSnapshot(tctx, conn); err != nil {
+				return err
+			}
+		}
+		if c.metadata != nil {
+			if err = c.metadata.recordGlobalMetaData(c.conn, c.serverType, false); err != nil {
+				return err
+			}
+		}
+		after, err := ShowMasterStatus(c.conn)
+		if err != nil {
+			return err
+		}
+		if len(before) == 0 {
+			tctx.L().Warn("binlog is disabled, the snapshots of the connections may differ if there are writes meanwhile")
+			return nil
+		}
+		if sameStringArray(before, after) {
+			tctx.L().Info("the snapshots of all the connections are started at the same binlog position",
+				zap.Strings("position", after), zap.Int("connections", len(c.conns)), zap.Int("attempt", attempt))
+			return nil
+		}
+		if attempt >= maxConsistentSnapshotAttempts {
+			return errors.Errorf("the binlog position keeps moving from %v to %v while the snapshots are started after %d attempts, "+
+				"please retry when the server is less busy or use the flush consistency", before, after, attempt)
+		}
+		tctx.L().Warn("the binlog position moves while the snapshots are started, start them again",
+			zap.Strings("before", before), zap.Strings("after", after), zap.Int("attempt", attempt))
+	}
+}
+
+// takeConn returns a connection whose snapshot is started with the others, it's owned by the caller
+func (c *ConsistencyConsistentSnapshot) takeConn() (*sql.Conn, error) {
+	if len(c.conns) == 0 {
+		return nil, errors.New("no connection with the consistent snapshot is left, the connections can't be rebuilt with consistent-snapshot consistency")
+	}
+	conn := c.conns[0]
+	c.conns = c.conns[1:]
+	return conn, nil
+}
+
+// TearDown implements ConsistencyController.TearDown
+func (c *ConsistencyConsistentSnapshot) TearDown(_ context.Context) error {
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+	c.conns = nil
+	if c.conn == nil {
+		return nil
+	}
+	defer func() {
+		c.conn = nil
+	}()
+	return c.conn.Close()
+}
+
+// PingContext implements ConsistencyController.PingContext
+func (c *ConsistencyConsistentSnapshot) PingContext(ctx context.Context) error {
+	if c.conn == nil {
+		return errors.New("consistency connection has already been closed")
+	}
+	return c.conn.PingContext(ctx)
+}
+
 const snapshotFieldIndex = 1
+
+// finishConsistencyCheck reports the position captured with Config.ConsistencyCheckOnly after the consistency is set up,
+// the check fails if the position isn't recorded, recordErr is the error of recording it
+func finishConsistencyCheck(tctx *tcontext.Context, conf *Config, m *globalMetadata, recordErr error) error {
+	if recordErr != nil {
+		return errors.Annotate(recordErr, "consistency check fails to record the global metadata")
+	}
+	tctx.L().Info("consistency check passes, no data is dumped",
+		zap.String("consistency", conf.Consistency),
+		zap.String("snapshot", m.snapshot),
+		zap.String("status", strings.TrimSpace(m.statusBuffer.String())))
+	return nil
+}
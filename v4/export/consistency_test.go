@@ -5,6 +5,7 @@ package export
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 
 	tcontext "github.com/pingcap/dumpling/v4/context"
@@ -162,3 +163,115 @@ func (s *testConsistencySuite) TestConsistencyControllerError(c *C) {
 	err = ctrl.Setup(tctx)
 	c.Assert(err, NotNil)
 }
+
+func (s *testConsistencySuite) TestFinishConsistencyCheck(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background()
+	conf := defaultConfigForTest(c)
+	conf.ConsistencyCheckOnly = true
+
+	m := newGlobalMetadata(tctx, nil, "")
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+			AddRow("ON.000001", "7502", "", "", "6ce40be3-e359-11e9-87e0-36933cb0ca5a:1-29"))
+	mock.ExpectQuery("SHOW SLAVE STATUS").WillReturnRows(sqlmock.NewRows([]string{"exec_master_log_pos", "relay_master_log_file", "master_host", "Executed_Gtid_Set", "Seconds_Behind_Master"}))
+	err = m.recordGlobalMetaData(conn, ServerTypeMySQL, false)
+	c.Assert(finishConsistencyCheck(tctx, conf, m, err), IsNil)
+
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnError(errors.New("access denied"))
+	err = m.recordGlobalMetaData(conn, ServerTypeMySQL, false)
+	c.Assert(finishConsistencyCheck(tctx, conf, m, err), ErrorMatches, "consistency check fails to record the global metadata.*access denied")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testConsistencySuite) TestConsistentSnapshot(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tctx := tcontext.Background().WithContext(ctx).WithLogger(appLogger)
+	conf := defaultConfigForTest(c)
+	conf.Consistency = consistencyTypeConsistentSnapshot
+	conf.ServerInfo.ServerType = ServerTypeMySQL
+	conf.Threads = 2
+	resultOk := sqlmock.NewResult(0, 0)
+	masterStatus := func(pos string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+			AddRow("ON.000001", pos, "", "", "6ce40be3-e359-11e9-87e0-36933cb0ca5a:1-29")
+	}
+	expectSnapshots := func(n int) {
+		for i := 0; i < n; i++ {
+			mock.ExpectExec("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ").WillReturnResult(resultOk)
+			mock.ExpectExec("START TRANSACTION").WillReturnResult(resultOk)
+		}
+	}
+
+	ctrl, err := NewConsistencyController(ctx, conf, db)
+	c.Assert(err, IsNil)
+	snapshot, ok := ctrl.(*ConsistencyConsistentSnapshot)
+	c.Assert(ok, IsTrue)
+	m := newGlobalMetadata(tctx, nil, "")
+	snapshot.metadata = m
+	// a write is committed while the snapshots of the meta connection and the 2 writers are started,
+	// so they may or may not see it, and they're started again
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(masterStatus("7502"))
+	expectSnapshots(3)
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(masterStatus("7502"))
+	mock.ExpectQuery("SELECT @@default_master_connection").WillReturnError(errors.New("unknown variable"))
+	mock.ExpectQuery("SHOW SLAVE STATUS").WillReturnRows(sqlmock.NewRows([]string{"exec_master_log_pos"}))
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(masterStatus("7810"))
+	// no write is committed this time, all the snapshots see it and the position after it is recorded
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(masterStatus("7810"))
+	expectSnapshots(3)
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(masterStatus("7810"))
+	mock.ExpectQuery("SELECT @@default_master_connection").WillReturnError(errors.New("unknown variable"))
+	mock.ExpectQuery("SHOW SLAVE STATUS").WillReturnRows(sqlmock.NewRows([]string{"exec_master_log_pos"}))
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(masterStatus("7810"))
+	c.Assert(ctrl.Setup(tctx), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(m.statusBuffer.String(), Matches, "(?s).*\tPos: 7810\n.*")
+
+	// the connections of the snapshots are taken by the meta connection and the writers, and they can't be rebuilt
+	for i := 0; i < 3; i++ {
+		conn, err := snapshot.takeConn()
+		c.Assert(err, IsNil)
+		conn.Close()
+	}
+	_, err = snapshot.takeConn()
+	c.Assert(err, ErrorMatches, "no connection with the consistent snapshot is left.*")
+	c.Assert(canRebuildConn(conf.Consistency, false), IsFalse)
+	c.Assert(ctrl.TearDown(tctx), IsNil)
+	c.Assert(ctrl.TearDown(tctx), IsNil)
+
+	// fail if the position keeps moving
+	conf.Threads = 0
+	ctrl, err = NewConsistencyController(ctx, conf, db)
+	c.Assert(err, IsNil)
+	for i := 0; i < maxConsistentSnapshotAttempts; i++ {
+		mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(masterStatus(fmt.Sprint(i)))
+		expectSnapshots(1)
+		mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(masterStatus(fmt.Sprint(i + 1)))
+	}
+	c.Assert(ctrl.Setup(tctx), ErrorMatches, "the binlog position keeps moving .* after 10 attempts.*")
+	c.Assert(ctrl.TearDown(tctx), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the position can't be checked if binlog is disabled
+	ctrl, err = NewConsistencyController(ctx, conf, db)
+	c.Assert(err, IsNil)
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(sqlmock.NewRows([]string{"File", "Position"}))
+	expectSnapshots(1)
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(sqlmock.NewRows([]string{"File", "Position"}))
+	c.Assert(ctrl.Setup(tctx), IsNil)
+	c.Assert(ctrl.TearDown(tctx), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	conf.ServerInfo.ServerType = ServerTypeTiDB
+	_, err = NewConsistencyController(ctx, conf, db)
+	c.Assert(err, ErrorMatches, "consistent-snapshot consistency is not supported for TiDB.*")
+}
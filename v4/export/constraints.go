@@ -0,0 +1,149 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+const constraintsFileSuffix = ".constraints.json"
+
+// the first versions reporting the CHECK constraints in information_schema
+var (
+	mysqlCheckConstraintVersion   = semver.New("8.0.16")
+	mariadbCheckConstraintVersion = semver.New("10.2.1")
+	tidbCheckConstraintVersion    = semver.New("7.2.0")
+)
+
+// columnConstraint is the nullability and the default value of a column
+type columnConstraint struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	// Default is null if the column has no default value
+	Default *string `json:"default"`
+	// Extra is the EXTRA of information_schema.COLUMNS, like auto_increment or DEFAULT_GENERATED
+	Extra string `json:"extra"`
+}
+
+type checkConstraint struct {
+	Name   string `json:"name"`
+	Clause string `json:"clause"`
+}
+
+// tableConstraints is the content of the constraints sidecar of a table with Config.EmitConstraints
+type tableConstraints struct {
+	Database string             `json:"database"`
+	Table    string             `json:"table"`
+	Columns  []columnConstraint `json:"columns"`
+	// Checks is null if the server doesn't report the CHECK constraints
+	Checks []checkConstraint `json:"checks"`
+}
+
+// supportsCheckConstraints returns whether the CHECK constraints can be read from information_schema of the server
+func supportsCheckConstraints(si ServerInfo) bool {
+	if si.ServerVersion == nil {
+		return false
+	}
+	switch si.ServerType {
+	case ServerTypeMySQL:
+		return si.ServerVersion.Compare(*mysqlCheckConstraintVersion) >= 0
+	case ServerTypeMariaDB:
+		return si.ServerVersion.Compare(*mariadbCheckConstraintVersion) >= 0
+	case ServerTypeTiDB:
+		return si.ServerVersion.Compare(*tidbCheckConstraintVersion) >= 0
+	}
+	return false
+}
+
+// readTableConstraints reads the constraints of the columns and the CHECK constraints of the table from information_schema
+func readTableConstraints(conn *sql.Conn, si ServerInfo, db, table string) (*tableConstraints, error) {
+	tc := &tableConstraints{Database: db, Table: table, Columns: []columnConstraint{}}
+	query := "SELECT COLUMN_NAME,COLUMN_TYPE,IS_NULLABLE,COLUMN_DEFAULT,EXTRA FROM INFORMATION_SCHEMA.COLUMNS " +
+		"WHERE TABLE_SCHEMA=? AND TABLE_NAME=? ORDER BY ORDINAL_POSITION"
+	err := simpleQueryWithArgs(conn, func(rows *sql.Rows) error {
+		var (
+			col        columnConstraint
+			isNullable string
+			colDefault sql.NullString
+		)
+		if err := rows.Scan(&col.Name, &col.Type, &isNullable, &colDefault, &col.Extra); err != nil {
+			return errors.Trace(err)
+		}
+		col.Nullable = isNullable == "YES"
+		if colDefault.Valid {
+			col.Default = &colDefault.String
+		}
+		tc.Columns = append(tc.Columns, col)
+		return nil
+	}, query, db, table)
+	if err != nil {
+		return nil, err
+	}
+	if !supportsCheckConstraints(si) {
+		return tc, nil
+	}
+	tc.Checks = []checkConstraint{}
+	query = "SELECT tc.CONSTRAINT_NAME,cc.CHECK_CLAUSE FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS tc " +
+		"JOIN INFORMATION_SCHEMA.CHECK_CONSTRAINTS cc ON tc.CONSTRAINT_SCHEMA=cc.CONSTRAINT_SCHEMA AND tc.CONSTRAINT_NAME=cc.CONSTRAINT_NAME " +
+		"WHERE tc.TABLE_SCHEMA=? AND tc.TABLE_NAME=? AND tc.CONSTRAINT_TYPE='CHECK' ORDER BY tc.CONSTRAINT_NAME"
+	err = simpleQueryWithArgs(conn, func(rows *sql.Rows) error {
+		var check checkConstraint
+		if err := rows.Scan(&check.Name, &check.Clause); err != nil {
+			return errors.Trace(err)
+		}
+		tc.Checks = append(tc.Checks, check)
+		return nil
+	}, query, db, table)
+	if err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// constraintsFileName returns the name of the constraints sidecar of the table, like `db.table.constraints.json`
+func constraintsFileName(conf *Config, db, table string) (string, error) {
+	namer := &outputFileNamer{DB: outputIdentifier(conf, db), Table: outputIdentifier(conf, table)}
+	name, err := namer.render(DefaultOutputFileTemplate, "objectName")
+	if err != nil {
+		return "", err
+	}
+	return name + constraintsFileSuffix, nil
+}
+
+// writeTableConstraints writes the constraints of the table into its sidecar with Config.EmitConstraints,
+// the names are lowercased with Config.LowercaseIdentifiers as the schema files
+func writeTableConstraints(tctx *tcontext.Context, conn *sql.Conn, extStore storage.ExternalStorage, conf *Config, db, table string) (string, error) {
+	tc, err := readTableConstraints(conn, conf.ServerInfo, db, table)
+	if err != nil {
+		return "", err
+	}
+	tc.Database, tc.Table = outputIdentifier(conf, db), outputIdentifier(conf, table)
+	for i := range tc.Columns {
+		tc.Columns[i].Name = outputIdentifier(conf, tc.Columns[i].Name)
+	}
+	for i := range tc.Checks {
+		tc.Checks[i].Clause = outputIdentifiers(conf, tc.Checks[i].Clause)
+	}
+	fileName, err := constraintsFileName(conf, db, table)
+	if err != nil {
+		return "", err
+	}
+	// the clauses are kept readable, e.g. `>=` isn't escaped
+	var bf bytes.Buffer
+	enc := json.NewEncoder(&bf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(tc); err != nil {
+		return "", errors.Trace(err)
+	}
+	return fileName, errors.Trace(extStore.WriteFile(tctx, fileName, bf.Bytes()))
+}
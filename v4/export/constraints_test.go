@@ -0,0 +1,90 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coreos/go-semver/semver"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestSupportsCheckConstraints(c *C) {
+	c.Assert(supportsCheckConstraints(ServerInfo{ServerType: ServerTypeMySQL, ServerVersion: semver.New("8.0.16")}), IsTrue)
+	c.Assert(supportsCheckConstraints(ServerInfo{ServerType: ServerTypeMySQL, ServerVersion: semver.New("5.7.30")}), IsFalse)
+	c.Assert(supportsCheckConstraints(ServerInfo{ServerType: ServerTypeMariaDB, ServerVersion: semver.New("10.3.0")}), IsTrue)
+	c.Assert(supportsCheckConstraints(ServerInfo{ServerType: ServerTypeTiDB, ServerVersion: semver.New("5.0.0")}), IsFalse)
+	c.Assert(supportsCheckConstraints(ServerInfoUnknown), IsFalse)
+}
+
+func (s *testSQLSuite) TestWriteTableConstraints(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.LowercaseIdentifiers = true
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL, ServerVersion: semver.New("8.0.25")}
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+
+	mock.ExpectQuery("SELECT COLUMN_NAME,COLUMN_TYPE,IS_NULLABLE,COLUMN_DEFAULT,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").
+		WithArgs("test", "T").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_DEFAULT", "EXTRA"}).
+		AddRow("ID", "int", "NO", nil, "auto_increment").
+		AddRow("price", "decimal(10,2)", "YES", "0.00", ""))
+	mock.ExpectQuery("SELECT tc.CONSTRAINT_NAME,cc.CHECK_CLAUSE FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS").
+		WithArgs("test", "T").WillReturnRows(sqlmock.NewRows([]string{"CONSTRAINT_NAME", "CHECK_CLAUSE"}).
+		AddRow("T_chk_1", "(`Price` >= 0)"))
+	fileName, err := writeTableConstraints(tcontext.Background(), conn, extStore, conf, "test", "T")
+	c.Assert(err, IsNil)
+	c.Assert(fileName, Equals, "test.t.constraints.json")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	data, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, fileName))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `{
+  "database": "test",
+  "table": "t",
+  "columns": [
+    {
+      "name": "id",
+      "type": "int",
+      "nullable": false,
+      "default": null,
+      "extra": "auto_increment"
+    },
+    {
+      "name": "price",
+      "type": "decimal(10,2)",
+      "nullable": true,
+      "default": "0.00",
+      "extra": ""
+    }
+  ],
+  "checks": [
+    {
+      "name": "T_chk_1",
+      "clause": "(`+"`price`"+` >= 0)"
+    }
+  ]
+}
+`)
+
+	// the CHECK constraints aren't read before MySQL 8.0.16
+	conf.LowercaseIdentifiers = false
+	conf.ServerInfo.ServerVersion = semver.New("5.7.30")
+	mock.ExpectQuery("SELECT COLUMN_NAME,COLUMN_TYPE,IS_NULLABLE,COLUMN_DEFAULT,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").
+		WithArgs("test", "t").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE", "IS_NULLABLE", "COLUMN_DEFAULT", "EXTRA"}))
+	tc, err := readTableConstraints(conn, conf.ServerInfo, "test", "t")
+	c.Assert(err, IsNil)
+	c.Assert(tc, DeepEquals, &tableConstraints{Database: "test", Table: "t", Columns: []columnConstraint{}})
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
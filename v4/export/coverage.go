@@ -0,0 +1,70 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"math/big"
+
+	"github.com/pingcap/errors"
+)
+
+// verifyIntChunkCoverage checks the ranges of the chunks split by an integer key with Config.VerifyCoverage.
+// The ranges should be contiguous from min to beyond max, each lower bound equals the upper bound of the previous one,
+// and the rows whose key is NULL belong to the chunk nullChunk only, -1 if they're not dumped by the ranges.
+func verifyIntChunkCoverage(db, tbl string, ranges []*chunkKeyRange, min, max *big.Int, nullChunk int, totalChunks int) error {
+	if len(ranges) == 0 {
+		return errors.Errorf("no chunk is planned for table `%s`.`%s`", db, tbl)
+	}
+	if len(ranges) != totalChunks {
+		return errors.Errorf("%d chunks are planned for table `%s`.`%s` but the total chunks is %d", len(ranges), db, tbl, totalChunks)
+	}
+	if ranges[0].lower.Cmp(min) != 0 {
+		return errors.Errorf("the first chunk of table `%s`.`%s` starts at %s but the minimum value is %s", db, tbl, ranges[0].lower, min)
+	}
+	for i, r := range ranges {
+		if r.lower.Cmp(r.upper) >= 0 {
+			return errors.Errorf("chunk %d of table `%s`.`%s` is empty: [%s, %s)", i, db, tbl, r.lower, r.upper)
+		}
+		if r.withNull != (i == nullChunk) {
+			return errors.Errorf("chunk %d of table `%s`.`%s` has withNull=%t, the NULL values should be dumped by chunk %d only",
+				i, db, tbl, r.withNull, nullChunk)
+		}
+		if i == 0 {
+			continue
+		}
+		switch prev := ranges[i-1]; r.lower.Cmp(prev.upper) {
+		case -1:
+			return errors.Errorf("chunk %d of table `%s`.`%s` starts at %s which overlaps chunk %d ending at %s", i, db, tbl, r.lower, i-1, prev.upper)
+		case 1:
+			return errors.Errorf("chunk %d of table `%s`.`%s` starts at %s which leaves a gap after chunk %d ending at %s", i, db, tbl, r.lower, i-1, prev.upper)
+		}
+	}
+	if last := ranges[len(ranges)-1]; last.upper.Cmp(max) <= 0 {
+		return errors.Errorf("the last chunk of table `%s`.`%s` ends at %s which doesn't cover the maximum value %s", db, tbl, last.upper, max)
+	}
+	return nil
+}
+
+// verifyHandleChunkCoverage checks the boundaries of the chunks split by the handle columns with Config.VerifyCoverage.
+// The chunks are open-ended, the first one is before the first boundary and the last one is from the last boundary,
+// so there should be one more chunk than the boundaries, which should be strictly increasing.
+// The handle columns are the primary key or _tidb_rowid, so they're never NULL.
+func verifyHandleChunkCoverage(db, tbl, partition string, handleColNames []string, handleVals [][]string, where []string) error {
+	table := "`" + db + "`.`" + tbl + "`"
+	if partition != "" {
+		table += " partition `" + partition + "`"
+	}
+	if len(where) != len(handleVals)+1 {
+		return errors.Errorf("%d chunks are planned for table %s but there are %d boundaries", len(where), table, len(handleVals))
+	}
+	for i, val := range handleVals {
+		if len(val) != len(handleColNames) {
+			return errors.Errorf("boundary %d of table %s has %d values but the handle has %d columns", i, table, len(val), len(handleColNames))
+		}
+		if i > 0 && compareHandleVals(handleVals[i-1], val) >= 0 {
+			return errors.Errorf("boundary %d of table %s %v isn't greater than boundary %d %v, the chunks between them overlap",
+				i, table, val, i-1, handleVals[i-1])
+		}
+	}
+	return nil
+}
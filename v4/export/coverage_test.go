@@ -0,0 +1,53 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"math/big"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestVerifyIntChunkCoverage(c *C) {
+	newRanges := func(bounds ...int64) []*chunkKeyRange {
+		ranges := make([]*chunkKeyRange, 0, len(bounds)/2)
+		for i := 0; i < len(bounds); i += 2 {
+			ranges = append(ranges, &chunkKeyRange{lower: big.NewInt(bounds[i]), upper: big.NewInt(bounds[i+1])})
+		}
+		ranges[0].withNull = true
+		return ranges
+	}
+	min, max := big.NewInt(1), big.NewInt(30)
+
+	c.Assert(verifyIntChunkCoverage("test", "t", newRanges(1, 11, 11, 21, 21, 31), min, max, 0, 3), IsNil)
+	c.Assert(verifyIntChunkCoverage("test", "t", newRanges(1, 11, 11, 21, 21, 31), min, max, 0, 4),
+		ErrorMatches, "3 chunks are planned for table `test`.`t` but the total chunks is 4")
+	c.Assert(verifyIntChunkCoverage("test", "t", newRanges(2, 11, 11, 21, 21, 31), min, max, 0, 3),
+		ErrorMatches, "the first chunk of table `test`.`t` starts at 2 but the minimum value is 1")
+	c.Assert(verifyIntChunkCoverage("test", "t", newRanges(1, 11, 12, 21, 21, 31), min, max, 0, 3),
+		ErrorMatches, "chunk 1 of table `test`.`t` starts at 12 which leaves a gap after chunk 0 ending at 11")
+	c.Assert(verifyIntChunkCoverage("test", "t", newRanges(1, 11, 10, 21, 21, 31), min, max, 0, 3),
+		ErrorMatches, "chunk 1 of table `test`.`t` starts at 10 which overlaps chunk 0 ending at 11")
+	c.Assert(verifyIntChunkCoverage("test", "t", newRanges(1, 11, 11, 21, 21, 30), min, max, 0, 3),
+		ErrorMatches, "the last chunk of table `test`.`t` ends at 30 which doesn't cover the maximum value 30")
+	c.Assert(verifyIntChunkCoverage("test", "t", newRanges(1, 11, 11, 11, 11, 31), min, max, 0, 3),
+		ErrorMatches, "chunk 1 of table `test`.`t` is empty: \\[11, 11\\)")
+	// the NULL values aren't selected with a where condition
+	c.Assert(verifyIntChunkCoverage("test", "t", newRanges(1, 11, 11, 21, 21, 31), min, max, -1, 3),
+		ErrorMatches, "chunk 0 of table `test`.`t` has withNull=true.*")
+}
+
+func (s *testUtilSuite) TestVerifyHandleChunkCoverage(c *C) {
+	cols := []string{"a", "b"}
+	handleVals := [][]string{{"1", "2"}, {"1", "5"}, {"3", "1"}}
+	where := buildWhereClauses(cols, handleVals)
+	c.Assert(verifyHandleChunkCoverage("test", "t", "", cols, handleVals, where), IsNil)
+
+	c.Assert(verifyHandleChunkCoverage("test", "t", "p0", cols, handleVals, where[1:]),
+		ErrorMatches, "3 chunks are planned for table `test`.`t` partition `p0` but there are 3 boundaries")
+	overlapped := [][]string{{"1", "2"}, {"1", "5"}, {"1", "5"}}
+	c.Assert(verifyHandleChunkCoverage("test", "t", "", cols, overlapped, where),
+		ErrorMatches, "boundary 2 of table `test`.`t` \\[1 5\\] isn't greater than boundary 1 \\[1 5\\].*")
+	c.Assert(verifyHandleChunkCoverage("test", "t", "", cols, [][]string{{"1"}, {"2"}, {"3"}}, where),
+		ErrorMatches, "boundary 0 of table `test`.`t` has 1 values but the handle has 2 columns")
+}
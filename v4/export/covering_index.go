@@ -0,0 +1,130 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// the first versions which can't use the invisible or ignored indexes in the index hints
+var (
+	mysqlInvisibleIndexVersion = semver.New("8.0.0")
+	mariadbIgnoredIndexVersion = semver.New("10.6.0")
+)
+
+// indexStatisticsQuery returns the query of the columns of the indexes of a table which can be used in the hints
+func indexStatisticsQuery(si ServerInfo) string {
+	query := "SELECT INDEX_NAME,COLUMN_NAME,SUB_PART FROM INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA=? AND TABLE_NAME=?"
+	if si.ServerVersion != nil {
+		switch {
+		case si.ServerType == ServerTypeMySQL && si.ServerVersion.Compare(*mysqlInvisibleIndexVersion) >= 0:
+			query += " AND IS_VISIBLE='YES'"
+		case si.ServerType == ServerTypeMariaDB && si.ServerVersion.Compare(*mariadbIgnoredIndexVersion) >= 0:
+			query += " AND IGNORED='NO'"
+		}
+	}
+	return query + " ORDER BY INDEX_NAME,SEQ_IN_INDEX"
+}
+
+// findCoveringIndex returns the secondary index of the table which covers all the columns, the one with the fewest
+// columns if there are several. The secondary indexes of InnoDB contain the primary key, so its columns are covered
+// by every index. The columns of the prefix indexes aren't covered since only their prefixes are stored.
+func findCoveringIndex(conn *sql.Conn, si ServerInfo, db, tbl string, columns []string) (string, error) {
+	var (
+		indexNames   []string
+		indexColumns = make(map[string]map[string]struct{})
+	)
+	err := simpleQueryWithArgs(conn, func(rows *sql.Rows) error {
+		var (
+			indexName string
+			column    sql.NullString
+			subPart   sql.NullInt64
+		)
+		if err := rows.Scan(&indexName, &column, &subPart); err != nil {
+			return errors.Trace(err)
+		}
+		cols, ok := indexColumns[indexName]
+		if !ok {
+			cols = make(map[string]struct{})
+			indexColumns[indexName] = cols
+			if indexName != "PRIMARY" {
+				indexNames = append(indexNames, indexName)
+			}
+		}
+		// the expressions of the functional indexes don't cover any column
+		if column.Valid && !subPart.Valid {
+			cols[strings.ToLower(column.String)] = struct{}{}
+		}
+		return nil
+	}, indexStatisticsQuery(si), db, tbl)
+	if err != nil {
+		return "", err
+	}
+
+	primary := indexColumns["PRIMARY"]
+	best, bestColumns := "", 0
+	for _, indexName := range indexNames {
+		cols := indexColumns[indexName]
+		covered := true
+		for _, col := range columns {
+			col = strings.ToLower(col)
+			_, inIndex := cols[col]
+			_, inPrimary := primary[col]
+			if !inIndex && !inPrimary {
+				covered = false
+				break
+			}
+		}
+		if covered && (best == "" || len(cols) < bestColumns) {
+			best, bestColumns = indexName, len(cols)
+		}
+	}
+	return best, nil
+}
+
+// setCoveringIndex sets the index hint of meta to read its rows by the secondary index covering the selected
+// columns with Config.UseCoveringIndex. Only the thin projections of the column groups or the skipped column types
+// are considered, and only the InnoDB tables of MySQL and MariaDB, whose secondary indexes contain the primary key.
+func setCoveringIndex(tctx *tcontext.Context, conn *sql.Conn, conf *Config, meta TableMeta) error {
+	tm, ok := meta.(*tableMeta)
+	if !ok || tm.queryField != "" || (tm.columnGroup == "" && len(tm.skippedColumns) == 0) {
+		return nil
+	}
+	switch conf.ServerInfo.ServerType {
+	case ServerTypeMySQL, ServerTypeMariaDB:
+	default:
+		return nil
+	}
+	var engine sql.NullString
+	err := simpleQueryWithArgs(conn, func(rows *sql.Rows) error {
+		return errors.Trace(rows.Scan(&engine))
+	}, "SELECT ENGINE FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA=? AND TABLE_NAME=?", tm.database, tm.table)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(engine.String, "InnoDB") {
+		return nil
+	}
+	index, err := findCoveringIndex(conn, conf.ServerInfo, tm.database, tm.table, tm.ColumnNames())
+	if err != nil || index == "" {
+		return err
+	}
+	tm.indexHint = "USE INDEX(" + wrapBackTicks(escapeString(index)) + ")"
+	tctx.L().Info("select the rows by the covering index", zap.String("database", tm.database),
+		zap.String("table", tm.table), zap.String("column group", tm.columnGroup), zap.String("index", index))
+	return nil
+}
+
+func indexHintOf(meta TableMeta) string {
+	if tm, ok := meta.(*tableMeta); ok {
+		return tm.indexHint
+	}
+	return ""
+}
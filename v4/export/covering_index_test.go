@@ -0,0 +1,107 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"regexp"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coreos/go-semver/semver"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestFindCoveringIndex(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	si := ServerInfo{ServerType: ServerTypeMySQL, ServerVersion: semver.New("8.0.25")}
+
+	statistics := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAME", "SUB_PART"}).
+			AddRow("PRIMARY", "id", nil).
+			AddRow("idx_email_name", "email", nil).
+			AddRow("idx_email_name", "name", nil).
+			AddRow("idx_func", nil, nil).
+			AddRow("idx_func", "name", nil).
+			AddRow("idx_name", "Name", nil).
+			AddRow("idx_prefix", "bio", 10)
+	}
+	query := regexp.QuoteMeta("SELECT INDEX_NAME,COLUMN_NAME,SUB_PART FROM INFORMATION_SCHEMA.STATISTICS " +
+		"WHERE TABLE_SCHEMA=? AND TABLE_NAME=? AND IS_VISIBLE='YES' ORDER BY INDEX_NAME,SEQ_IN_INDEX")
+
+	testCases := []struct {
+		columns []string
+		index   string
+	}{
+		// the primary key is in every secondary index, the one with the fewest columns is chosen
+		{[]string{"id", "name"}, "idx_func"},
+		{[]string{"ID", "email", "name"}, "idx_email_name"},
+		{[]string{"email"}, "idx_email_name"},
+		// only the prefix of the column is in the index
+		{[]string{"id", "bio"}, ""},
+		{[]string{"id", "phone"}, ""},
+	}
+	for _, t := range testCases {
+		mock.ExpectQuery(query).WithArgs("shop", "users").WillReturnRows(statistics())
+		index, err := findCoveringIndex(conn, si, "shop", "users", t.columns)
+		c.Assert(err, IsNil)
+		c.Assert(index, Equals, t.index, Commentf("columns %v", t.columns))
+	}
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	c.Assert(indexStatisticsQuery(ServerInfo{ServerType: ServerTypeMariaDB, ServerVersion: semver.New("10.6.4")}), Matches, ".* AND IGNORED='NO' .*")
+	c.Assert(indexStatisticsQuery(ServerInfo{ServerType: ServerTypeMySQL, ServerVersion: semver.New("5.7.33")}), Not(Matches), ".*IS_VISIBLE.*")
+}
+
+func (s *testSQLSuite) TestDumpColumnGroupsWithCoveringIndex(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.UseCoveringIndex = true
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL, ServerVersion: semver.New("5.7.33")}
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "shop", table: "users", selectedField: "*"}
+	groups := []ColumnGroup{{Name: "profile", Columns: []string{"name"}}, {Name: "auth", Columns: []string{"password_hash"}}}
+	pkRows := func() *sqlmock.Rows { return sqlmock.NewRows([]string{"column_name"}).AddRow("id") }
+	engineRows := func() *sqlmock.Rows { return sqlmock.NewRows([]string{"ENGINE"}).AddRow("InnoDB") }
+	statistics := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"INDEX_NAME", "COLUMN_NAME", "SUB_PART"}).
+			AddRow("PRIMARY", "id", nil).
+			AddRow("idx_name", "name", nil)
+	}
+
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("shop", "users").WillReturnRows(pkRows())
+	mock.ExpectQuery("SELECT `id`,`name` FROM `shop`.`users` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectQuery("SELECT ENGINE FROM INFORMATION_SCHEMA.TABLES").WithArgs("shop", "users").WillReturnRows(engineRows())
+	mock.ExpectQuery("SELECT INDEX_NAME,COLUMN_NAME,SUB_PART FROM INFORMATION_SCHEMA.STATISTICS").
+		WithArgs("shop", "users").WillReturnRows(statistics())
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("shop", "users").WillReturnRows(pkRows())
+	mock.ExpectQuery("SELECT `id`,`password_hash` FROM `shop`.`users` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash"}))
+	mock.ExpectQuery("SELECT ENGINE FROM INFORMATION_SCHEMA.TABLES").WithArgs("shop", "users").WillReturnRows(engineRows())
+	mock.ExpectQuery("SELECT INDEX_NAME,COLUMN_NAME,SUB_PART FROM INFORMATION_SCHEMA.STATISTICS").
+		WithArgs("shop", "users").WillReturnRows(statistics())
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("shop", "users").WillReturnRows(pkRows())
+
+	taskChan := make(chan Task, 2)
+	c.Assert(d.dumpColumnGroups(tctx, conn, meta, groups, taskChan), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert((<-taskChan).(*TaskTableData).Data.(*tableData).query, Equals,
+		"SELECT `id`,`name` FROM `shop`.`users` USE INDEX(`idx_name`) ORDER BY `id`")
+	// no index covers password_hash
+	c.Assert((<-taskChan).(*TaskTableData).Data.(*tableData).query, Equals,
+		"SELECT `id`,`password_hash` FROM `shop`.`users` ORDER BY `id`")
+}
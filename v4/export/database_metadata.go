@@ -0,0 +1,80 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/pingcap/errors"
+)
+
+// databaseMetadataPath returns the path of the metadata of a database, which is in the directory of the database
+func databaseMetadataPath(db string) string {
+	return path.Join(escapeFileName(db), metadataPath)
+}
+
+// databaseMetaData builds the metadata of a database, which has the same snapshot as the global metadata,
+// and the rows dumped of each table in it
+func (m *globalMetadata) databaseMetaData(db string, tables []*TableInfo, rows map[string]uint64) string {
+	var buf bytes.Buffer
+	buf.WriteString("Started dump at: " + m.startTime.Format(metadataTimeLayout) + "\n")
+	buf.WriteString("Database: " + db + "\n")
+	buf.Write(m.statusBuffer.Bytes())
+	buf.Write(m.afterConnBuffer.Bytes())
+	sorted := append([]*TableInfo(nil), tables...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	buf.WriteString("Tables:\n")
+	for _, table := range sorted {
+		if table.Type == TableTypeView {
+			fmt.Fprintf(&buf, "\t%s: view\n", table.Name)
+			continue
+		}
+		fmt.Fprintf(&buf, "\t%s: %d rows\n", table.Name, rows[table.Name])
+	}
+	buf.WriteString("Finished dump at: " + m.finishTime.Format(metadataTimeLayout) + "\n")
+	return buf.String()
+}
+
+// writeDatabaseMetaData writes the metadata of every database dumped into its own directory,
+// so each database can be restored on its own
+func (d *Dumper) writeDatabaseMetaData(m *globalMetadata) error {
+	tctx, conf := d.tctx, d.conf
+	// the local storage doesn't create the directories of the files
+	dir := ""
+	if d.fifo == nil {
+		var err error
+		if dir, err = localOutputDir(conf); err != nil {
+			return err
+		}
+	}
+	rows := make(map[string]map[string]uint64, len(conf.Tables))
+	for _, result := range d.tableStats.results() {
+		if rows[result.Database] == nil {
+			rows[result.Database] = make(map[string]uint64)
+		}
+		rows[result.Database][result.Table] = result.Rows
+	}
+	for db, tables := range conf.Tables {
+		if dir != "" {
+			if err := os.MkdirAll(filepath.Join(dir, escapeFileName(db)), 0o755); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		// keep consistent with the global metadata. Never compress metadata
+		fileWriter, tearDown, err := buildFileWriter(tctx, d.extStore, databaseMetadataPath(db), CompressNone, false)
+		if err != nil {
+			return err
+		}
+		err = write(tctx, fileWriter, m.databaseMetaData(db, tables, rows[db]))
+		tearDown(tctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// droppedDuplicatedRowsUnit is the name of the dropped duplicated rows in the summary
+const droppedDuplicatedRowsUnit = "dropped duplicated rows"
+
+// setDedupKey sets the primary key columns of meta to dedupe its rows by with Config.DedupByPrimaryKey
+func setDedupKey(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta) error {
+	tm, ok := meta.(*tableMeta)
+	if !ok {
+		return nil
+	}
+	cols, err := GetPrimaryKeyColumns(conn, tm.database, tm.table)
+	if err != nil {
+		return err
+	}
+	if len(cols) == 0 {
+		tctx.L().Warn("table has no primary key, its rows aren't deduplicated",
+			zap.String("database", tm.database), zap.String("table", tm.table))
+		return nil
+	}
+	tm.dedupKeyColumns = cols
+	return nil
+}
+
+func dedupKeyColumnsOf(meta TableMeta) []string {
+	if tm, ok := meta.(*tableMeta); ok {
+		return tm.dedupKeyColumns
+	}
+	return nil
+}
+
+// dedupKeyIndices returns the indices of the primary key columns of meta to dedupe its rows by,
+// or nil if the rows aren't deduplicated
+func dedupKeyIndices(tctx *tcontext.Context, meta TableMeta) []int {
+	tm, ok := meta.(*tableMeta)
+	if !ok || len(tm.dedupKeyColumns) == 0 {
+		return nil
+	}
+	indices, missing := keyColumnIndices(meta, tm.dedupKeyColumns)
+	if missing != "" {
+		// e.g. the column group doesn't contain the whole primary key
+		tctx.L().Warn("primary key isn't dumped, the rows aren't deduplicated",
+			zap.String("database", tm.database), zap.String("table", tm.table),
+			zap.String("column", missing))
+		return nil
+	}
+	return indices
+}
+
+// keyColumnIndices returns the indices of keyColumns in the columns of meta,
+// or the first key column which isn't selected
+func keyColumnIndices(meta TableMeta, keyColumns []string) ([]int, string) {
+	colNames := meta.ColumnNames()
+	indices := make([]int, 0, len(keyColumns))
+	for _, keyColumn := range keyColumns {
+		idx := -1
+		for i, name := range colNames {
+			if strings.EqualFold(name, keyColumn) {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, keyColumn
+		}
+		indices = append(indices, idx)
+	}
+	return indices, ""
+}
+
+// dedupRowsIR drops the rows whose primary key equals the one of the previous row. The rows of a chunk are
+// ordered by the primary key, so the duplicated rows are adjacent. The chunks don't overlap with each other,
+// so the rows only need to be deduplicated within a chunk.
+type dedupRowsIR struct {
+	TableDataIR
+	keyIndices []int
+
+	// the row is scanned as []byte instead of sql.RawBytes, which holds the rows from being scanned again
+	raw     [][]byte
+	dest    []interface{}
+	prevKey [][]byte
+	dropped uint64
+	// checked is true if the current row isn't a duplicated one. It's kept across the iterators
+	// of the data files of the chunk, since the row may be checked by the previous file.
+	checked bool
+	err     error
+}
+
+func newDedupRowsIR(ir TableDataIR, keyIndices []int) *dedupRowsIR {
+	return &dedupRowsIR{TableDataIR: ir, keyIndices: keyIndices}
+}
+
+// Rows implements TableDataIR.Rows
+func (d *dedupRowsIR) Rows() SQLRowIter {
+	return &dedupRowIter{SQLRowIter: d.TableDataIR.Rows(), ir: d}
+}
+
+// isDuplicated checks whether the current row has the same primary key as the previous row,
+// and records its primary key if not.
+func (d *dedupRowsIR) isDuplicated() (bool, error) {
+	rows := d.RawRows()
+	if d.dest == nil {
+		cols, err := rows.Columns()
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		d.raw = make([][]byte, len(cols))
+		d.dest = make([]interface{}, len(cols))
+		for i := range d.raw {
+			d.dest[i] = &d.raw[i]
+		}
+	}
+	// the row can be scanned again when it's decoded
+	if err := rows.Scan(d.dest...); err != nil {
+		return false, errors.Trace(err)
+	}
+	if d.prevKey != nil {
+		duplicated := true
+		for i, idx := range d.keyIndices {
+			if !bytes.Equal(d.prevKey[i], d.raw[idx]) {
+				duplicated = false
+				break
+			}
+		}
+		if duplicated {
+			d.dropped++
+			return true, nil
+		}
+	} else {
+		d.prevKey = make([][]byte, len(d.keyIndices))
+	}
+	for i, idx := range d.keyIndices {
+		d.prevKey[i] = d.raw[idx]
+	}
+	return false, nil
+}
+
+type dedupRowIter struct {
+	SQLRowIter
+	ir *dedupRowsIR
+}
+
+// HasNext implements SQLRowIter.HasNext
+func (it *dedupRowIter) HasNext() bool {
+	ir := it.ir
+	if ir.checked || ir.err != nil {
+		return true
+	}
+	for it.SQLRowIter.HasNext() {
+		duplicated, err := ir.isDuplicated()
+		if err != nil {
+			// return the error when the row is decoded
+			ir.err = err
+			return true
+		}
+		if !duplicated {
+			ir.checked = true
+			return true
+		}
+		it.SQLRowIter.Next()
+	}
+	return false
+}
+
+// Next implements SQLRowIter.Next
+func (it *dedupRowIter) Next() {
+	it.ir.checked = false
+	it.SQLRowIter.Next()
+}
+
+// Decode implements SQLRowIter.Decode
+func (it *dedupRowIter) Decode(row RowReceiver) error {
+	if it.ir.err != nil {
+		return it.ir.err
+	}
+	return it.SQLRowIter.Decode(row)
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestWriteInsertDedupByPrimaryKey(c *C) {
+	data := [][]driver.Value{
+		{"1", "1", "a"},
+		{"1", "1", "duplicated"},
+		{"1", "2", "b"},
+		{"2", "1", "c"},
+		{"2", "1", "duplicated"},
+		{"2", "1", "duplicated"},
+	}
+	colTypes := []string{"INT", "INT", "VARCHAR"}
+	tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+	ir := newDedupRowsIR(tableIR, []int{0, 1})
+	bf := storage.NewBufferWriter()
+
+	conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+	n, err := WriteInsert(tcontext.Background(), conf, tableIR, ir, bf)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, uint64(3))
+	c.Assert(ir.dropped, Equals, uint64(3))
+	expected := "INSERT INTO `t` VALUES\n" +
+		"(1,1,'a'),\n" +
+		"(1,2,'b'),\n" +
+		"(2,1,'c');\n"
+	c.Assert(bf.String(), Equals, expected)
+}
+
+func (s *testUtilSuite) TestWriteInsertInCsvDedupByPrimaryKeyAcrossFiles(c *C) {
+	data := [][]driver.Value{
+		{"1", "a"},
+		{"1", "duplicated"},
+		{"2", "b"},
+		{"2", "duplicated"},
+		{"3", "c"},
+	}
+	colTypes := []string{"INT", "VARCHAR"}
+	tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+	ir := newDedupRowsIR(tableIR, []int{0})
+	opt := &csvOption{separator: []byte(","), delimiter: doubleQuotationMark, nullValue: "\\N"}
+	conf := configForWriteCSV(true, opt)
+	// each file holds a single row
+	conf.FileSize = 1
+
+	var files []string
+	for ir.Rows().HasNext() {
+		bf := storage.NewBufferWriter()
+		_, err := WriteInsertInCsv(tcontext.Background(), conf, tableIR, ir, bf)
+		c.Assert(err, IsNil)
+		files = append(files, bf.String())
+	}
+	c.Assert(files, DeepEquals, []string{"1,\"a\"\n", "2,\"b\"\n", "3,\"c\"\n"})
+	c.Assert(ir.dropped, Equals, uint64(2))
+}
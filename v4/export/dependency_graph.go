@@ -0,0 +1,184 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+const (
+	dependencyGraphPath = "tables.json"
+
+	// dependencyForeignKey is the edge from a table to the table its foreign key references
+	dependencyForeignKey = "foreign_key"
+	// dependencyViewReference is the edge from a view to the table or view it selects from
+	dependencyViewReference = "view_reference"
+)
+
+type dependencyEdge struct {
+	Database string `json:"database"`
+	Name     string `json:"name"`
+	// Kind is foreign_key or view_reference
+	Kind string `json:"kind"`
+}
+
+type dependencyObject struct {
+	Database string `json:"database"`
+	Name     string `json:"name"`
+	// Type is `table` or `view`
+	Type string `json:"type"`
+	// DependsOn are the dumped objects which should be restored before this one
+	DependsOn []dependencyEdge `json:"depends_on"`
+}
+
+// dependencyGraphRecorder records the dumped tables and views with their dependencies by the foreign keys
+// and the view definitions, so the consumers can restore them in a safe order
+type dependencyGraphRecorder struct {
+	mu sync.Mutex
+	// database -> name -> object
+	objects map[string]map[string]*dependencyObject
+}
+
+// newDependencyGraphRecorder records all the objects in tables with the dependencies by fks,
+// the dependencies of the views are added when their definitions are read
+func newDependencyGraphRecorder(tables DatabaseTables, fks []foreignKey, materialized bool) *dependencyGraphRecorder {
+	r := &dependencyGraphRecorder{objects: make(map[string]map[string]*dependencyObject, len(tables))}
+	for db, tbls := range tables {
+		r.objects[db] = make(map[string]*dependencyObject, len(tbls))
+		for _, t := range tbls {
+			objectType := "table"
+			if t.Type == TableTypeView && !materialized {
+				objectType = "view"
+			}
+			r.objects[db][t.Name] = &dependencyObject{Database: db, Name: t.Name, Type: objectType, DependsOn: []dependencyEdge{}}
+		}
+	}
+	for _, fk := range fks {
+		// a table referencing itself doesn't affect the order
+		if fk.childDB == fk.parentDB && fk.childTable == fk.parentTable {
+			continue
+		}
+		r.addEdge(fk.childDB, fk.childTable, dependencyEdge{Database: fk.parentDB, Name: fk.parentTable, Kind: dependencyForeignKey})
+	}
+	return r
+}
+
+// addView adds the dependencies of the view parsed from its definition createViewSQL
+func (r *dependencyGraphRecorder) addView(db, view, createViewSQL string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ref := range viewReferences(db, createViewSQL) {
+		if ref[0] == db && ref[1] == view {
+			continue
+		}
+		if _, ok := r.objects[ref[0]][ref[1]]; ok {
+			r.addEdge(db, view, dependencyEdge{Database: ref[0], Name: ref[1], Kind: dependencyViewReference})
+		}
+	}
+}
+
+func (r *dependencyGraphRecorder) addEdge(db, name string, edge dependencyEdge) {
+	o, ok := r.objects[db][name]
+	if !ok {
+		return
+	}
+	for _, e := range o.DependsOn {
+		if e == edge {
+			return
+		}
+	}
+	o.DependsOn = append(o.DependsOn, edge)
+}
+
+// viewReferences returns the database and the name of the objects referenced in the view definition createViewSQL.
+// They are the qualified names like `db`.`t`, and the unqualified names following FROM or JOIN which are in db.
+// The column references qualified by the tables are returned too, they're filtered out by the dumped objects.
+func viewReferences(db, createViewSQL string) [][2]string {
+	// only the select statement after AS is parsed, the definer and the view name are before it
+	all := quotedLiteralPattern.FindAllStringIndex(createViewSQL, -1)
+	var literals [][]int
+	start := 0
+	for i, loc := range all {
+		if gap := strings.ToUpper(createViewSQL[start:loc[0]]); strings.Contains(gap, " AS ") {
+			literals = all[i:]
+			break
+		}
+		start = loc[1]
+	}
+	var refs [][2]string
+	for i := 0; i < len(literals); i++ {
+		literal := createViewSQL[literals[i][0]:literals[i][1]]
+		if literal[0] != '`' {
+			continue
+		}
+		name := unquoteBackticks(literal)
+		if i+1 < len(literals) && strings.TrimSpace(createViewSQL[literals[i][1]:literals[i+1][0]]) == "." {
+			next := createViewSQL[literals[i+1][0]:literals[i+1][1]]
+			if next[0] == '`' {
+				refs = append(refs, [2]string{name, unquoteBackticks(next)})
+				i++
+				continue
+			}
+		}
+		prevEnd := 0
+		if i > 0 {
+			prevEnd = literals[i-1][1]
+		}
+		// the joined tables are parenthesized in the definitions the server returns
+		fields := strings.Fields(strings.ToUpper(strings.ReplaceAll(createViewSQL[prevEnd:literals[i][0]], "(", " ")))
+		if len(fields) > 0 && (fields[len(fields)-1] == "FROM" || fields[len(fields)-1] == "JOIN") {
+			refs = append(refs, [2]string{db, name})
+		}
+	}
+	return refs
+}
+
+func unquoteBackticks(literal string) string {
+	return strings.ReplaceAll(literal[1:len(literal)-1], "``", "`")
+}
+
+// write writes the objects sorted by the database and the name into dependencyGraphPath
+func (r *dependencyGraphRecorder) write(tctx *tcontext.Context, extStore storage.ExternalStorage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	objects := make([]*dependencyObject, 0, len(r.objects))
+	for _, dbObjects := range r.objects {
+		for _, o := range dbObjects {
+			sort.Slice(o.DependsOn, func(i, j int) bool {
+				a, b := o.DependsOn[i], o.DependsOn[j]
+				if a.Database != b.Database {
+					return a.Database < b.Database
+				}
+				if a.Name != b.Name {
+					return a.Name < b.Name
+				}
+				return a.Kind < b.Kind
+			})
+			objects = append(objects, o)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Database != objects[j].Database {
+			return objects[i].Database < objects[j].Database
+		}
+		return objects[i].Name < objects[j].Name
+	})
+	data, err := json.MarshalIndent(struct {
+		Objects []*dependencyObject `json:"objects"`
+	}{objects}, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(extStore.WriteFile(tctx, dependencyGraphPath, data))
+}
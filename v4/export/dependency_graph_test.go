@@ -0,0 +1,101 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestViewReferences(c *C) {
+	createViewSQL := "CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`%` SQL SECURITY DEFINER VIEW `v` (`a`,`b`) AS " +
+		"SELECT `t`.`a` AS `a`,`o`.`b` AS `b` FROM (`t` JOIN `other`.`o` ON (`t`.`a` = `o`.`a`))"
+	c.Assert(viewReferences("test", createViewSQL), DeepEquals, [][2]string{
+		{"t", "a"}, {"o", "b"}, {"test", "t"}, {"other", "o"}, {"t", "a"}, {"o", "a"},
+	})
+	c.Assert(viewReferences("test", "CREATE VIEW `v` AS SELECT 1 AS `a`"), IsNil)
+}
+
+func (s *testUtilSuite) TestWriteDependencyGraph(c *C) {
+	tables := DatabaseTables{}.
+		AppendTables("test", "t", "child").
+		AppendViews("test", "v", "self").
+		AppendTables("other", "o")
+	fks := []foreignKey{
+		{childDB: "test", childTable: "child", childColumns: []string{"t_id"}, parentDB: "test", parentTable: "t", parentColumns: []string{"id"}},
+		{childDB: "test", childTable: "t", childColumns: []string{"parent_id"}, parentDB: "test", parentTable: "t", parentColumns: []string{"id"}},
+	}
+	r := newDependencyGraphRecorder(tables, fks, false)
+	r.addView("test", "v", "CREATE VIEW `v` AS SELECT `t`.`id` AS `id` FROM `t` JOIN `other`.`o` JOIN `missing`")
+	// the view referencing itself is ignored
+	r.addView("test", "self", "CREATE VIEW `self` AS SELECT * FROM `self`")
+
+	dir := c.MkDir()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = dir
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	c.Assert(r.write(tcontext.Background(), extStore), IsNil)
+	data, err := ioutil.ReadFile(path.Join(dir, dependencyGraphPath))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `{
+  "objects": [
+    {
+      "database": "other",
+      "name": "o",
+      "type": "table",
+      "depends_on": []
+    },
+    {
+      "database": "test",
+      "name": "child",
+      "type": "table",
+      "depends_on": [
+        {
+          "database": "test",
+          "name": "t",
+          "kind": "foreign_key"
+        }
+      ]
+    },
+    {
+      "database": "test",
+      "name": "self",
+      "type": "view",
+      "depends_on": []
+    },
+    {
+      "database": "test",
+      "name": "t",
+      "type": "table",
+      "depends_on": []
+    },
+    {
+      "database": "test",
+      "name": "v",
+      "type": "view",
+      "depends_on": [
+        {
+          "database": "other",
+          "name": "o",
+          "kind": "view_reference"
+        },
+        {
+          "database": "test",
+          "name": "t",
+          "kind": "view_reference"
+        }
+      ]
+    }
+  ]
+}`)
+
+	// the views are dumped as the tables in the materialize view mode
+	r = newDependencyGraphRecorder(tables, nil, true)
+	c.Assert(r.objects["test"]["v"].Type, Equals, "table")
+}
@@ -8,10 +8,12 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"math/big"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pingcap/dumpling/v4/cli"
@@ -40,11 +42,65 @@ type Dumper struct {
 	tctx      *tcontext.Context
 	conf      *Config
 	cancelCtx context.CancelFunc
-
-	extStore storage.ExternalStorage
-	dbHandle *sql.DB
+	// abortErr is the reason why the dump is cancelled by the dumper itself
+	abortMu  sync.Mutex
+	abortErr error
+
+	extStore     storage.ExternalStorage
+	dbHandle     *sql.DB
+	pauseCtl     *pauseController
+	tableStats   *tableStatsCollector
+	tableThreads *tableThreadsLimiter
+
+	schemaDeduper *schemaDeduper
+	schemaOnly    *schemaOnlyRecorder
+	checksums     *checksumStorage
+	sizes         *uncompressedSizeStorage
+	zstdDict      *zstdDictStorage
+	migration     *migrationVersions
+	catalog       *catalogRecorder
+	importInto    *importIntoRecorder
+	verification  *verificationRecorder
+	pkIndex       *pkIndexRecorder
+	checkpoint    *checkpoint
+	chunkCounts   *chunkCountRecorder
+	loader        *loader
+	kafkaSink     *kafkaSink
+	safeMode      *safeModeRecorder
+	budgets       *tableBudgetRecorder
+	prior         *priorCatalog
+	subset        *subset
+	dependencies  *dependencyGraphRecorder
+	fifo          *fifoStorage
+	stream        *singleStream
+	tableErrors   *tableErrorHandler
+	uploads       *uploadLimitStorage
+	replicaLag    *replicaLagMonitor
+	threads       *adaptiveThreads
+	targetLock    *targetLock
+	// rowsLimiter and bytesLimiter are shared by all the writers to limit the rows and bytes dumped per second
+	rowsLimiter  *rateLimiter
+	bytesLimiter *rateLimiter
+	// progress tracks the table chunks being written for conf.OnProgress and the /status API
+	progress *progressTracker
+	// gcLease is renewed while the service GC safe point protects the snapshot, it's nil without the safe point
+	gcLease *gcSafePointLease
+	// freeSpaceDir is the local output directory whose free space should be kept above conf.MinFreeSpace
+	freeSpaceDir string
+	// serverSideDumpDir is the secure_file_priv directory of the server when the data is dumped by SELECT ... INTO OUTFILE
+	serverSideDumpDir string
+	// database -> table -> estimated size in bytes
+	tableEstimatedSize map[string]map[string]uint64
+	// connSessionParams is set on each connection when the pool is provided by the caller
+	connSessionParams map[string]interface{}
+	// snapshotConns provides the connections to dump with the consistent-snapshot consistency
+	snapshotConns *ConsistencyConsistentSnapshot
+	// database -> table -> estimated rows
+	tableEstimatedRows map[string]map[string]uint64
+	preCheckFailures   []TableCheckFailure
 
 	tidbPDClientForGC         pd.Client
+	checkSameClusterFunc      func(tctx *tcontext.Context, db *sql.DB, pdAddrs []string) (bool, error)
 	selectTiDBTableRegionFunc func(tctx *tcontext.Context, conn *sql.Conn, dbName, tableName string) (pkFields []string, pkVals [][]string, err error)
 }
 
@@ -55,18 +111,85 @@ func NewDumper(ctx context.Context, conf *Config) (*Dumper, error) {
 		tctx:                      tctx,
 		conf:                      conf,
 		cancelCtx:                 cancelFn,
+		pauseCtl:                  newPauseController(),
+		tableStats:                newTableStatsCollector(),
+		tableThreads:              newTableThreadsLimiter(conf.TableThreads),
+		rowsLimiter:               newRateLimiter(conf.MaxRowsPerSecond, rowsPerSecondGauge, conf.Labels),
+		bytesLimiter:              newRateLimiter(conf.MaxBytesPerSecond, bytesPerSecondGauge, conf.Labels),
+		progress:                  newProgressTracker(conf),
+		checkSameClusterFunc:      checkSameCluster,
 		selectTiDBTableRegionFunc: selectTiDBTableRegion,
 	}
 	err := adjustConfig(conf,
 		registerTLSConfig,
 		validateSpecifiedSQL,
-		adjustFileFormat)
+		adjustTimeWindow,
+		adjustPreCheckTables,
+		adjustGCSafePointPolicy,
+		adjustMigrationLayout,
+		adjustTableOptions,
+		adjustOutputFIFO,
+		adjustViewMode,
+		adjustJob,
+		adjustFileFormat,
+		adjustBinaryEncoding,
+		adjustOutputMode,
+		adjustOnTableError,
+		adjustEncryption,
+		adjustTransactionPerTable,
+		adjustSkipColumnTypes,
+		adjustColumnSelectors,
+		adjustChunkExpressions,
+		adjustCollationAllowlist,
+		adjustVerifyChunkCount,
+		adjustIdentifierQuote,
+		adjustTargetDSN,
+		adjustSafeModeRows,
+		adjustIncrementalAgainst,
+		adjustImportIntoCompat,
+		adjustPerTableBudget,
+		adjustPerChunkBinlogPos,
+		adjustGenerateLightningConfig,
+		adjustInvalidEnumHandling,
+		adjustHashPrefixFiles,
+		adjustSubsetSeed,
+		adjustRowCountTrailer,
+		adjustColumnCountMismatch,
+		adjustLowercaseIdentifiers,
+		adjustMaxReplicaLagSeconds,
+		adjustMaxFieldBytes,
+		adjustCompressDictionary,
+		adjustPartitionByColumn,
+		adjustConnectionAttributes,
+		adjustSplitSchemaByType,
+		adjustPartitionFilter,
+		adjustExclusiveTarget,
+		adjustNullsHandling,
+		adjustKafkaSink,
+		adjustRestoreAsserts,
+		adjustOrderByCollation,
+		adjustPKIndex,
+		adjustSampleTables,
+		adjustSampleFraction,
+		adjustCheckpoint,
+		adjustPreserveTiDBHandles,
+		adjustRateLimit,
+		adjustAdaptiveThreads,
+		adjustMaxRetries,
+		adjustDumpRoutines,
+		adjustChunkByFileSize,
+		adjustColumnTransforms,
+		adjustInsertMethod,
+		adjustTableListFile)
 	if err != nil {
 		return nil, err
 	}
 	err = runSteps(d,
 		initLogger,
 		createExternalStore,
+		resumeFromCheckpoint,
+		createHashPrefixDirs,
+		createSchemaDirs,
 		startHTTPService,
 		openSQLDB,
 		detectServerInfo,
@@ -76,7 +199,16 @@ func NewDumper(ctx context.Context, conf *Config) (*Dumper, error) {
 		tidbGetSnapshot,
 		tidbStartGCSavepointUpdateService,
 
-		setSessionParam)
+		setSessionParam,
+		checkServerSideDump,
+		checkPerChunkBinlogPos,
+		checkPreserveTiDBHandles,
+		checkOnTableError,
+		startReplicaLagMonitor)
+	if err != nil {
+		// the caller doesn't close the dumper failing to be created
+		d.releaseTargetLock()
+	}
 	return d, err
 }
 
@@ -91,16 +223,57 @@ func (d *Dumper) Dump() (dumpErr error) {
 	)
 	tctx, conf, pool := d.tctx, d.conf, d.dbHandle
 	tctx.L().Info("begin to run Dump", zap.Stringer("conf", conf))
+	startTime := time.Now()
+	if conf.OnFinish != nil {
+		defer func() {
+			conf.OnFinish(d.buildDumpResult(startTime, dumpErr))
+		}()
+	}
+	if conf.ErrorReportFile != "" {
+		defer func() {
+			if dumpErr != nil {
+				d.writeErrorReport(tctx, d.buildDumpResult(startTime, dumpErr))
+			}
+		}()
+	}
+	// the checksums are written after all the other files including the metadata
+	if d.checksums != nil {
+		defer func() {
+			if dumpErr == nil {
+				dumpErr = d.checksums.writeChecksums(tctx)
+			}
+		}()
+	}
+	// the files held to train the zstd dictionary are written before the checksums
+	if d.zstdDict != nil {
+		defer func() {
+			if dumpErr == nil {
+				dumpErr = d.zstdDict.flush(tctx)
+			}
+		}()
+	}
 	m := newGlobalMetadata(tctx, d.extStore, conf.Snapshot)
 	defer func() {
 		if dumpErr == nil {
 			_ = m.writeGlobalMetaData()
 		}
 	}()
+	if conf.PerDatabaseMetadata {
+		defer func() {
+			if dumpErr == nil {
+				dumpErr = d.writeDatabaseMetaData(m)
+			}
+		}()
+	}
+	defer func() {
+		if err := d.abortError(); err != nil {
+			dumpErr = err
+		}
+	}()
 
 	// for consistency lock, we should get table list at first to generate the lock tables SQL
 	if conf.Consistency == consistencyTypeLock {
-		conn, err = createConnWithConsistency(tctx, pool)
+		conn, err = createConnWithSessionParams(tctx, pool, d.connSessionParams)
 		if err != nil {
 			return errors.Trace(err)
 		}
@@ -115,6 +288,12 @@ func (d *Dumper) Dump() (dumpErr error) {
 	if err != nil {
 		return err
 	}
+	if snapshotConns, ok := conCtrl.(*ConsistencyConsistentSnapshot); ok {
+		// the meta connection and the writers read the snapshots started together, whose position is recorded meanwhile
+		snapshotConns.sessionParams = d.connSessionParams
+		snapshotConns.metadata = m
+		d.snapshotConns = snapshotConns
+	}
 	if err = conCtrl.Setup(tctx); err != nil {
 		return errors.Trace(err)
 	}
@@ -126,22 +305,55 @@ func (d *Dumper) Dump() (dumpErr error) {
 		}
 	}()
 
-	metaConn, err := createConnWithConsistency(tctx, pool)
+	metaConn, err := d.createDumpConn(tctx)
 	if err != nil {
 		return err
 	}
 	defer metaConn.Close()
-	m.recordStartTime(time.Now())
+	conf.SnapshotTime = time.Now()
+	m.recordStartTime(conf.SnapshotTime)
+	if len(conf.Hosts) > 0 {
+		m.recordHost(conf.Host, conf.Port)
+	}
+	if conf.JobCount > 1 {
+		m.recordJob(conf.JobIndex, conf.JobCount)
+	}
+	if encoding := binaryEncodingOf(conf); encoding != "" {
+		m.recordBinaryEncoding(encoding)
+	}
+	if conf.RecordConfig {
+		if err = m.recordConfig(conf); err != nil {
+			tctx.L().Warn("fail to record config in metadata", zap.Error(err))
+		}
+	}
 	// for consistency lock, we can write snapshot info after all tables are locked.
 	// the binlog pos may changed because there is still possible write between we lock tables and write master status.
 	// but for the locked tables doing replication that starts from metadata is safe.
 	// for consistency flush, record snapshot after whole tables are locked. The recorded meta info is exactly the locked snapshot.
 	// for consistency snapshot, we should use the snapshot that we get/set at first in metadata. TiDB will assure the snapshot of TSO.
-	// for consistency none, the binlog pos in metadata might be earlier than dumped data. We need to enable safe-mode to assure data safety.
-	err = m.recordGlobalMetaData(metaConn, conf.ServerInfo.ServerType, false)
+	// for consistency none, the binlog pos in metadata might be earlier than dumped data. We need to enable safe-mode to assure data safety,
+	// e.g. by writing the rows in safe mode with conf.SafeModeRows.
+	// for consistency consistent-snapshot, the binlog pos is recorded while the snapshots are started.
+	if d.snapshotConns == nil {
+		err = m.recordGlobalMetaData(metaConn, conf.ServerInfo.ServerType, false)
+	}
+	if conf.ConsistencyCheckOnly {
+		// the consistency is torn down and the metadata is written without dumping anything
+		return finishConsistencyCheck(tctx, conf, m, err)
+	}
 	if err != nil {
 		tctx.L().Info("get global metadata failed", zap.Error(err))
 	}
+	if d.checkpoint != nil {
+		if err = d.checkpoint.syncMetadata(tctx, conf, m); err != nil {
+			return err
+		}
+		defer func() {
+			if err := d.checkpoint.close(tctx); err != nil && dumpErr == nil {
+				dumpErr = err
+			}
+		}()
+	}
 
 	// for other consistencies, we should get table list after consistency is set up and GlobalMetaData is cached
 	if conf.Consistency != consistencyTypeLock {
@@ -149,23 +361,37 @@ func (d *Dumper) Dump() (dumpErr error) {
 			return err
 		}
 	}
+	if conf.SampleTables != "" {
+		m.recordSampledTables(conf.SampleTablesSeed, sampledTableNames(conf.Tables))
+	}
+	if conf.TimeColumn != "" {
+		if err = checkTimeColumn(metaConn, conf); err != nil {
+			return err
+		}
+	}
+	if conf.EmitDependencyGraph {
+		fks, err := getForeignKeys(metaConn, conf.Tables)
+		if err != nil {
+			return err
+		}
+		d.dependencies = newDependencyGraphRecorder(conf.Tables, fks, conf.ViewMode == ViewModeMaterialize)
+	}
+	if conf.LowercaseIdentifiers {
+		for _, collision := range lowercaseCollisions(conf.Tables) {
+			tctx.L().Warn("the names are the same after they're lowercased, they would be restored into the same one",
+				zap.String("names", collision))
+		}
+	}
 	if err = d.renewSelectTableRegionFuncForLowerTiDB(tctx); err != nil {
 		tctx.L().Error("fail to update select table region info for TiDB", zap.Error(err))
 	}
 
-	rebuildConn := func(conn *sql.Conn) (*sql.Conn, error) {
-		// make sure that the lock connection is still alive
-		err1 := conCtrl.PingContext(tctx)
-		if err1 != nil {
-			return conn, errors.Trace(err1)
-		}
-		// give up the last broken connection
-		conn.Close()
-		newConn, err1 := createConnWithConsistency(tctx, pool)
+	// newConn opens a new connection to dump data, it may return the connection with an error
+	newConn := func() (*sql.Conn, error) {
+		conn, err1 := createConnWithSessionParams(tctx, pool, d.connSessionParams)
 		if err1 != nil {
-			return conn, errors.Trace(err1)
+			return nil, errors.Trace(err1)
 		}
-		conn = newConn
 		// renew the master status after connection. dm can't close safe-mode until dm reaches current pos
 		if conf.PosAfterConnect {
 			err1 = m.recordGlobalMetaData(conn, conf.ServerInfo.ServerType, true)
@@ -175,16 +401,94 @@ func (d *Dumper) Dump() (dumpErr error) {
 		}
 		return conn, nil
 	}
+	rebuildConn := func(conn *sql.Conn) (*sql.Conn, error) {
+		// make sure that the lock connection is still alive
+		err1 := conCtrl.PingContext(tctx)
+		if err1 != nil {
+			return conn, errors.Trace(err1)
+		}
+		// give up the last broken connection
+		conn.Close()
+		rebuilt, err1 := newConn()
+		if rebuilt == nil {
+			return conn, err1
+		}
+		return rebuilt, err1
+	}
 
+	if conf.EmitCatalog {
+		d.catalog = newCatalogRecorder()
+	}
+	if conf.ImportIntoCompat != "" {
+		d.importInto = newImportIntoRecorder()
+	}
+	if conf.IncrementalAgainst != "" {
+		if conf.ServerInfo.ServerType == ServerTypeTiDB {
+			tctx.L().Warn("TiDB doesn't maintain the update time of tables, dump all the tables")
+		} else if d.prior, err = loadPriorCatalog(tctx, conf.IncrementalAgainst); err != nil {
+			return err
+		}
+	}
+	if conf.EmitVerificationSample {
+		d.verification = newVerificationRecorder(conf.VerificationSampleInterval)
+	}
+	if conf.EmitPKIndex {
+		d.pkIndex = newPKIndexRecorder()
+	}
+	if conf.VerifyChunkCount {
+		d.chunkCounts = newChunkCountRecorder()
+	}
+	if conf.SafeModeRows != 0 {
+		d.safeMode = newSafeModeRecorder(conf.SafeModeRows)
+	}
+	if conf.PerTableBudget > 0 {
+		d.budgets = newTableBudgetRecorder(conf.PerTableBudget)
+	}
+	if conf.SubsetSeed != "" {
+		if d.subset, err = traverseSubset(tctx, metaConn, conf); err != nil {
+			return err
+		}
+	}
+	if conf.TargetDSN != "" {
+		if d.loader, err = newLoader(tctx, conf); err != nil {
+			return err
+		}
+		defer d.loader.close()
+	}
+	if conf.OutputMode == OutputModeSingle {
+		if d.stream, err = newSingleStream(tctx, conf, d.extStore); err != nil {
+			return err
+		}
+		defer d.stream.cleanup()
+	}
+	if len(conf.KafkaBrokers) > 0 {
+		d.kafkaSink = newKafkaSink(conf)
+		defer func() {
+			if err := d.kafkaSink.close(); err != nil {
+				tctx.L().Warn("fail to close the kafka producer", zap.Error(err))
+			}
+		}()
+	}
 	taskChan := make(chan Task, defaultDumpThreads)
 	AddGauge(taskChannelCapacity, conf.Labels, defaultDumpThreads)
 	wg, writingCtx := errgroup.WithContext(tctx)
 	writerCtx := tctx.WithContext(writingCtx)
-	writers, tearDownWriters, err := d.startWriters(writerCtx, wg, taskChan, rebuildConn)
+	if conf.MemoryWatermark > 0 {
+		d.threads = newAdaptiveThreads(conf.MinThreads, conf.Threads, conf.MemoryWatermark, goHeapInUse)
+		threadsCtx, stopThreads := writerCtx.WithCancel()
+		defer stopThreads()
+		go d.threads.run(threadsCtx, adaptiveThreadsInterval)
+	}
+	writers, tearDownWriters, err := d.startWriters(writerCtx, wg, taskChan, rebuildConn, newConn)
 	if err != nil {
 		return err
 	}
 	defer tearDownWriters()
+	if d.freeSpaceDir != "" {
+		monitorCtx, stopMonitor := writerCtx.WithCancel()
+		defer stopMonitor()
+		go d.monitorFreeSpace(monitorCtx, freeSpaceCheckInterval)
+	}
 
 	if conf.TransactionalConsistency {
 		if conf.Consistency == consistencyTypeFlush || conf.Consistency == consistencyTypeLock {
@@ -210,8 +514,16 @@ func (d *Dumper) Dump() (dumpErr error) {
 	defer summary.Summary(summary.BackupUnit)
 
 	logProgressCtx, logProgressCancel := tctx.WithCancel()
-	go d.runLogProgress(logProgressCtx)
-	defer logProgressCancel()
+	logProgressDone := make(chan struct{})
+	go func() {
+		d.runLogProgress(logProgressCtx)
+		close(logProgressDone)
+	}()
+	// conf.OnProgress isn't called any more after Dump returns
+	defer func() {
+		logProgressCancel()
+		<-logProgressDone
+	}()
 
 	tableDataStartTime := time.Now()
 
@@ -227,40 +539,202 @@ func (d *Dumper) Dump() (dumpErr error) {
 	})
 
 	// get estimate total count
-	if err = d.getEstimateTotalRowsCount(tctx, metaConn); err != nil {
+	if conf.SkipEstimate {
+		if conf.MaxEstimatedBytes > 0 {
+			return errors.New("can't check max-estimated-bytes with skip-estimate")
+		}
+		tctx.L().Info("skip estimating the rows of tables")
+	} else if err = d.getEstimateTotalRowsCount(tctx, metaConn); err != nil {
 		tctx.L().Error("fail to get estimate total count", zap.Error(err))
+		if conf.MaxEstimatedBytes > 0 {
+			return errors.Annotate(err, "can't check max-estimated-bytes")
+		}
+	}
+	if conf.MaxEstimatedBytes > 0 {
+		if err = d.checkEstimatedSize(); err != nil {
+			return err
+		}
+	}
+	if conf.DumpStats {
+		if err = d.dumpStatsHealth(tctx, metaConn); err != nil {
+			return err
+		}
+		if err = d.dumpTableStats(tctx, metaConn); err != nil {
+			return err
+		}
 	}
 
-	if conf.SQL == "" {
-		if err = d.dumpDatabases(writerCtx, metaConn, taskChan); err != nil && !errors.ErrorEqual(err, context.Canceled) {
+	if conf.DedupSchema {
+		d.schemaDeduper = newSchemaDeduper()
+	}
+	if conf.MigrationLayout {
+		fks, err := getForeignKeys(metaConn, conf.Tables)
+		if err != nil {
 			return err
 		}
-	} else {
+		routines, err := listMigrationRoutines(metaConn, conf)
+		if err != nil {
+			return err
+		}
+		d.migration = newMigrationVersions(tctx, conf.Tables, routines, fks)
+	}
+	if conf.NoData && conf.NoDataMarkers {
+		d.schemaOnly = newSchemaOnlyRecorder()
+	}
+	switch {
+	case conf.SQL != "":
 		d.dumpSQL(writerCtx, taskChan)
+	case len(conf.NamedQueries) > 0:
+		if err = d.dumpNamedQueries(writerCtx, metaConn, taskChan); err != nil && !errors.ErrorEqual(err, context.Canceled) {
+			return err
+		}
+	default:
+		if err = d.dumpDatabases(writerCtx, metaConn, taskChan); err != nil && !errors.ErrorEqual(err, context.Canceled) {
+			return err
+		}
 	}
 	close(taskChan)
+	// the throttled writers should see the closed channel to exit
+	d.threads.release()
 	if err := wg.Wait(); err != nil {
 		summary.CollectFailureUnit("dump table data", err)
 		return errors.Trace(err)
 	}
+	if err = d.stream.close(tctx); err != nil {
+		return err
+	}
+	if d.chunkCounts != nil {
+		if err = d.redumpMismatchedTables(tctx, metaConn, rebuildConn, newConn); err != nil {
+			summary.CollectFailureUnit("dump table data", err)
+			return err
+		}
+	}
 	summary.CollectSuccessUnit("dump cost", countTotalTask(writers), time.Since(tableDataStartTime))
+	if d.safeMode != nil {
+		m.recordSafeMode(d.safeMode)
+	}
+	if d.budgets != nil {
+		for _, meta := range d.budgets.partialTables() {
+			tctx.L().Warn("the table is partially dumped, its chunks are skipped after the budget elapses",
+				zap.String("database", meta.DatabaseName()), zap.String("table", meta.TableName()),
+				zap.Int64("skipped chunks", tableBudgetOf(meta).skippedChunks()), zap.Duration("budget", conf.PerTableBudget))
+		}
+		m.recordPartialTables(d.budgets)
+	}
+	if skipped := d.tableErrors.skippedTables(); len(skipped) > 0 {
+		summary.CollectSuccessUnit(skippedTablesUnit, 1, uint64(len(skipped)))
+		m.recordSkippedTables(skipped)
+	}
+	if d.schemaDeduper != nil {
+		if err = d.schemaDeduper.writeManifest(tctx, d.extStore); err != nil {
+			return err
+		}
+	}
+	if d.schemaOnly != nil {
+		if err = d.schemaOnly.writeManifest(tctx, d.extStore); err != nil {
+			return err
+		}
+	}
+	if d.sizes != nil {
+		if err = d.sizes.writeManifest(tctx); err != nil {
+			return err
+		}
+	}
+	if d.catalog != nil {
+		if err = d.catalog.write(tctx, d.extStore, d.tableStats.results()); err != nil {
+			return err
+		}
+	}
+	if d.importInto != nil {
+		if err = d.importInto.write(tctx, d.extStore, conf); err != nil {
+			return err
+		}
+	}
+	if conf.GenerateLightningConfig {
+		if err = writeLightningConfig(tctx, d.extStore, conf); err != nil {
+			return err
+		}
+	}
+	if d.dependencies != nil {
+		if err = d.dependencies.write(tctx, d.extStore); err != nil {
+			return err
+		}
+	}
+	if d.subset != nil {
+		if err = d.subset.write(tctx, d.extStore, conf, d.tableStats.results()); err != nil {
+			return err
+		}
+	}
+	if d.verification != nil {
+		if err = d.verification.write(tctx, d.extStore); err != nil {
+			return err
+		}
+	}
+	if d.pkIndex != nil {
+		if err = d.pkIndex.write(tctx, d.extStore, conf); err != nil {
+			return err
+		}
+	}
+	if conf.EmitStatsCSV {
+		if err = writeStatsCSV(tctx, d.extStore, d.tableStats.results()); err != nil {
+			return err
+		}
+	}
+	if conf.EmitRestoreAsserts {
+		if err = writeRestoreAsserts(tctx, d.extStore, conf, d.tableStats.results()); err != nil {
+			return err
+		}
+	}
 
 	summary.SetSuccessStatus(true)
 	m.recordFinishTime(time.Now())
 	return nil
 }
 
+// rampUpDelay returns the start delay of the i-th writer, so that the writers are started evenly over rampUp
+func rampUpDelay(rampUp time.Duration, i, threads int) time.Duration {
+	if rampUp <= 0 || threads <= 1 {
+		return 0
+	}
+	return rampUp * time.Duration(i) / time.Duration(threads)
+}
+
 func (d *Dumper) startWriters(tctx *tcontext.Context, wg *errgroup.Group, taskChan <-chan Task,
-	rebuildConnFn func(*sql.Conn) (*sql.Conn, error)) ([]*Writer, func(), error) {
-	conf, pool := d.conf, d.dbHandle
+	rebuildConnFn func(*sql.Conn) (*sql.Conn, error), newConnFn func() (*sql.Conn, error)) ([]*Writer, func(), error) {
+	conf := d.conf
 	writers := make([]*Writer, conf.Threads)
 	for i := 0; i < conf.Threads; i++ {
-		conn, err := createConnWithConsistency(tctx, pool)
+		conn, err := d.createDumpConn(tctx)
 		if err != nil {
 			return nil, func() {}, err
 		}
 		writer := NewWriter(tctx, int64(i), conf, conn, d.extStore)
 		writer.rebuildConnFn = rebuildConnFn
+		writer.newConnFn = newConnFn
+		writer.pauseCtl = d.pauseCtl
+		if d.replicaLag != nil {
+			writer.replicaLagPauseCtl = d.replicaLag.pauseCtl
+		}
+		writer.threads = d.threads
+		writer.tableStats = d.tableStats
+		writer.catalog = d.catalog
+		writer.checksums = d.checksums
+		writer.importInto = d.importInto
+		writer.verification = d.verification
+		writer.pkIndex = d.pkIndex
+		writer.chunkCounts = d.chunkCounts
+		writer.loader = d.loader
+		writer.kafkaSink = d.kafkaSink
+		writer.startDelay = rampUpDelay(conf.RampUpDuration, i, conf.Threads)
+		writer.freeSpaceDir = d.freeSpaceDir
+		writer.serverSideDumpDir = d.serverSideDumpDir
+		writer.rowsLimiter, writer.bytesLimiter = d.rowsLimiter, d.bytesLimiter
+		writer.progress = d.progress
+		writer.gcLease = d.gcLease
+		writer.tableErrors = d.tableErrors
+		if writer.stream = d.stream.storage(d.extStore); writer.stream != nil {
+			writer.extStorage = writer.stream
+		}
 		writer.setFinishTableCallBack(func(task Task) {
 			if _, ok := task.(*TaskTableData); ok {
 				IncCounter(finishedTablesCounter, conf.Labels)
@@ -275,6 +749,9 @@ func (d *Dumper) startWriters(tctx *tcontext.Context, wg *errgroup.Group, taskCh
 		writer.setFinishTaskCallBack(func(task Task) {
 			IncGauge(taskChannelCapacity, conf.Labels)
 			if td, ok := task.(*TaskTableData); ok {
+				td.finish()
+				d.checkpoint.finishChunk(tctx, td)
+				d.progress.finishChunk(td)
 				tctx.L().Debug("finish dumping table data task",
 					zap.String("database", td.Meta.DatabaseName()),
 					zap.String("table", td.Meta.TableName()),
@@ -297,45 +774,367 @@ func (d *Dumper) startWriters(tctx *tcontext.Context, wg *errgroup.Group, taskCh
 func (d *Dumper) dumpDatabases(tctx *tcontext.Context, metaConn *sql.Conn, taskChan chan<- Task) error {
 	conf := d.conf
 	allTables := conf.Tables
-	for dbName, tables := range allTables {
-		createDatabaseSQL, err := ShowCreateDatabase(metaConn, dbName)
-		if err != nil {
+	if conf.LargestFirst {
+		return d.dumpDatabasesLargestFirst(tctx, metaConn, taskChan)
+	}
+	views := DatabaseTables{}
+	dbNames := make([]string, 0, len(allTables))
+	for dbName := range allTables {
+		dbNames = append(dbNames, dbName)
+	}
+	// the databases are dumped in a deterministic order, e.g. for the single output
+	sort.Strings(dbNames)
+	for _, dbName := range dbNames {
+		tables := allTables[dbName]
+		if err := d.dumpDatabaseMeta(tctx, metaConn, dbName, taskChan); err != nil {
 			return err
 		}
-		task := NewTaskDatabaseMeta(dbName, createDatabaseSQL)
-		ctxDone := d.sendTaskToChan(tctx, task, taskChan)
-		if ctxDone {
-			return tctx.Err()
+		if err := d.dumpSequences(tctx, metaConn, dbName, taskChan); err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if d.isViewDumpedLast(table) {
+				views.AppendTable(dbName, table)
+				continue
+			}
+			if err := d.dumpTable(tctx, metaConn, dbName, table, taskChan); err != nil {
+				return err
+			}
 		}
+	}
+
+	if err := d.dumpViewsLast(tctx, metaConn, views, taskChan); err != nil {
+		return err
+	}
+	return d.dumpRoutinesLast(tctx, metaConn, taskChan)
+}
+
+// isViewDumpedLast checks whether the table is a view whose definition is dumped after all the tables,
+// so the views are restored after the tables they may reference, even in other databases
+func (d *Dumper) isViewDumpedLast(table *TableInfo) bool {
+	return table.Type == TableTypeView && d.conf.ViewMode == ViewModeDefinition
+}
 
+// dumpViewsLast dumps the views sorted by their dependencies, so a view is restored after the views it selects from
+func (d *Dumper) dumpViewsLast(tctx *tcontext.Context, metaConn *sql.Conn, views DatabaseTables, taskChan chan<- Task) error {
+	var toDump []*viewToDump
+	for dbName, tables := range views {
 		for _, table := range tables {
-			tctx.L().Debug("start dumping table...", zap.String("database", dbName),
-				zap.String("table", table.Name))
-			meta, err := dumpTableMeta(conf, metaConn, dbName, table)
+			meta, err := dumpTableMeta(tctx, d.conf, metaConn, dbName, table)
 			if err != nil {
 				return err
 			}
+			toDump = append(toDump, &viewToDump{db: dbName, table: table, meta: meta})
+		}
+	}
+	steps := sortViewsByDependencies(tctx, toDump)
+	if d.migration != nil {
+		d.migration.reorderViews(steps)
+	}
+	for _, step := range steps {
+		v := step.view
+		switch step.part {
+		case viewPartPlaceholder:
+			// the migration files have no placeholder tables
+			if d.migration != nil {
+				continue
+			}
+			task := NewTaskViewMeta(v.db, v.table.Name, v.meta.ShowCreateTable(), "")
+			if d.sendTaskToChan(tctx, task, taskChan) {
+				return tctx.Err()
+			}
+		case viewPartDefinition:
+			if err := d.dumpTableWithMeta(tctx, metaConn, v.db, v.table, viewDefinitionMeta{v.meta}, taskChan); err != nil {
+				return err
+			}
+		default:
+			if err := d.dumpTableWithMeta(tctx, metaConn, v.db, v.table, v.meta, taskChan); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-			if table.Type == TableTypeView {
-				task := NewTaskViewMeta(dbName, table.Name, meta.ShowCreateTable(), meta.ShowCreateView())
-				ctxDone = d.sendTaskToChan(tctx, task, taskChan)
-				if ctxDone {
-					return tctx.Err()
-				}
-			} else {
-				task := NewTaskTableMeta(dbName, table.Name, meta.ShowCreateTable())
-				ctxDone = d.sendTaskToChan(tctx, task, taskChan)
-				if ctxDone {
-					return tctx.Err()
-				}
-				err = d.dumpTableData(tctx, metaConn, meta, taskChan)
-				if err != nil {
-					return err
-				}
+// dumpDatabasesLargestFirst dumps all the database meta first, then dumps tables in descending order of estimated size,
+// so that the largest tables won't become the tail of the dump.
+func (d *Dumper) dumpDatabasesLargestFirst(tctx *tcontext.Context, metaConn *sql.Conn, taskChan chan<- Task) error {
+	type dbTable struct {
+		db    string
+		table *TableInfo
+		size  uint64
+	}
+	var allTables []dbTable
+	views := DatabaseTables{}
+	for dbName, tables := range d.conf.Tables {
+		if err := d.dumpDatabaseMeta(tctx, metaConn, dbName, taskChan); err != nil {
+			return err
+		}
+		if err := d.dumpSequences(tctx, metaConn, dbName, taskChan); err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if d.isViewDumpedLast(table) {
+				views.AppendTable(dbName, table)
+				continue
+			}
+			allTables = append(allTables, dbTable{db: dbName, table: table, size: d.tableEstimatedSize[dbName][table.Name]})
+		}
+	}
+	sort.SliceStable(allTables, func(i, j int) bool {
+		return allTables[i].size > allTables[j].size
+	})
+	for _, t := range allTables {
+		if err := d.dumpTable(tctx, metaConn, t.db, t.table, taskChan); err != nil {
+			return err
+		}
+	}
+	if err := d.dumpViewsLast(tctx, metaConn, views, taskChan); err != nil {
+		return err
+	}
+	return d.dumpRoutinesLast(tctx, metaConn, taskChan)
+}
+
+func (d *Dumper) dumpDatabaseMeta(tctx *tcontext.Context, metaConn *sql.Conn, dbName string, taskChan chan<- Task) error {
+	// the tables are restored into the existing databases, whose charset and collation may differ from the source
+	if d.conf.NoCreateDatabase {
+		return nil
+	}
+	createDatabaseSQL, err := ShowCreateDatabase(metaConn, dbName)
+	if err != nil {
+		return err
+	}
+	task := NewTaskDatabaseMeta(dbName, createDatabaseSQL)
+	if d.migration != nil {
+		task.MigrationVersion = d.migration.database(dbName)
+	}
+	ctxDone := d.sendTaskToChan(tctx, task, taskChan)
+	if ctxDone {
+		return tctx.Err()
+	}
+	return nil
+}
+
+func (d *Dumper) dumpTable(tctx *tcontext.Context, metaConn *sql.Conn, dbName string, table *TableInfo, taskChan chan<- Task) error {
+	conf := d.conf
+	tctx.L().Debug("start dumping table...", zap.String("database", dbName),
+		zap.String("table", table.Name))
+	readMeta := func(conn *sql.Conn) (TableMeta, error) {
+		meta, err := dumpTableMeta(tctx, conf, conn, dbName, table)
+		if err == nil {
+			err = injectedTableNotExistErr(dbName, table.Name)
+		}
+		return meta, err
+	}
+	conn := metaConn
+	meta, err := readMeta(conn)
+	// nothing of the table is sent before its meta is read, so it can be dumped again at the snapshot from the start
+	if d.tableErrors.retriesAtSnapshot() && d.tableErrors.handles(err) {
+		tctx.L().Warn("the table is dropped or altered during the dump, dump it at the snapshot",
+			zap.String("database", dbName), zap.String("table", table.Name), zap.String("snapshot", conf.Snapshot), zap.Error(err))
+		if conn, err = d.tableErrors.snapshotConn(tctx); err != nil {
+			return err
+		}
+		defer conn.Close()
+		meta, err = readMeta(conn)
+	}
+	if err == nil {
+		err = d.dumpTableWithMeta(tctx, conn, dbName, table, meta, taskChan)
+	}
+	// the chunks of the table sent before it fails are skipped by the writers
+	if d.tableErrors.handles(err) {
+		d.tableErrors.skip(tctx, dbName, table.Name, err)
+		return nil
+	}
+	return err
+}
+
+// dumpTableWithMeta dumps the table whose meta has been read
+func (d *Dumper) dumpTableWithMeta(tctx *tcontext.Context, metaConn *sql.Conn, dbName string, table *TableInfo, meta TableMeta, taskChan chan<- Task) error {
+	conf := d.conf
+	var err error
+	if skipped := skippedColumnsOf(meta); len(skipped) > 0 {
+		tctx.L().Info("skip the columns by --skip-column-types or --select-columns", zap.String("database", dbName),
+			zap.String("table", table.Name), zap.Strings("columns", skipped))
+	}
+	for _, v := range collationViolationsOf(meta) {
+		if conf.CollationMode == CollationModeRewrite {
+			tctx.L().Info("rewrite the collation not in --collation-allowlist", zap.String("database", dbName),
+				zap.String("table", table.Name), zap.String("column", v.column),
+				zap.String("collation", v.collation), zap.String("rewritten collation", conf.DefaultCollation))
+		} else {
+			tctx.L().Warn("collation isn't in --collation-allowlist", zap.String("database", dbName),
+				zap.String("table", table.Name), zap.String("column", v.column), zap.String("collation", v.collation))
+		}
+	}
+
+	// the materialized views are dumped as base tables
+	materialized := table.Type == TableTypeView && conf.ViewMode == ViewModeMaterialize
+	unchanged := false
+	if d.catalog != nil {
+		tableType := table.Type
+		if materialized {
+			tableType = TableTypeBase
+		}
+		t, err := newCatalogTable(metaConn, meta, tableType, d.tableEstimatedRows[dbName][table.Name])
+		if err != nil {
+			return err
+		}
+		// the version is recorded without the prior catalog too, so the next dump can compare against this one
+		if conf.IncrementalAgainst != "" && conf.ServerInfo.ServerType != ServerTypeTiDB && table.Type == TableTypeBase {
+			if err = setTableVersion(metaConn, dbName, t); err != nil {
+				return err
+			}
+			unchanged = d.prior.unchanged(dbName, t)
+		}
+		d.catalog.addTable(dbName, t)
+	}
+	if d.dependencies != nil && table.Type == TableTypeView && !materialized {
+		createViewSQL := meta.ShowCreateView()
+		// the view definition isn't read without the schemas
+		if createViewSQL == "" {
+			if _, createViewSQL, err = ShowCreateView(metaConn, dbName, table.Name); err != nil {
+				return err
 			}
 		}
+		d.dependencies.addView(dbName, table.Name, createViewSQL)
+	}
+	if conf.EmitConstraints && table.Type == TableTypeBase {
+		fileName, err := writeTableConstraints(tctx, metaConn, d.extStore, conf, dbName, table.Name)
+		if err != nil {
+			return err
+		}
+		d.catalog.addFile(dbName, table.Name, fileName)
+	}
+	if conf.AnnotateFiles && table.Type == TableTypeBase {
+		annotateTableMeta(meta, d.tableEstimatedRows[dbName][table.Name])
+	}
+	if conf.BinaryModeHeader && conf.FileType == FileFormatSQLTextString && table.Type == TableTypeBase {
+		addBinaryModeHeader(meta)
+	}
+
+	if table.Type == TableTypeView && !materialized {
+		task := NewTaskViewMeta(dbName, table.Name, meta.ShowCreateTable(), meta.ShowCreateView())
+		if d.migration != nil {
+			task.MigrationVersion = d.migration.table(dbName, table.Name)
+		}
+		ctxDone := d.sendTaskToChan(tctx, task, taskChan)
+		if ctxDone {
+			return tctx.Err()
+		}
+		return nil
+	}
+	if conf.PreCheckTables != "" && !materialized {
+		passed, err := d.preCheckTable(tctx, metaConn, dbName, table.Name)
+		if err != nil || !passed {
+			return err
+		}
+	}
+	if err := d.dedupSchema(tctx, dbName, table.Name, meta.ShowCreateTable()); err != nil {
+		return err
+	}
+	task := NewTaskTableMeta(dbName, table.Name, meta.ShowCreateTable())
+	if d.migration != nil {
+		task.MigrationVersion = d.migration.table(dbName, table.Name)
+		task.CreateTableSQL = d.migration.createTableSQL(dbName, table.Name, task.CreateTableSQL)
+	}
+	ctxDone := d.sendTaskToChan(tctx, task, taskChan)
+	if ctxDone {
+		return tctx.Err()
+	}
+	if conf.NoData {
+		if d.schemaOnly != nil {
+			d.schemaOnly.record(dbName, table.Name)
+		}
+		return nil
+	}
+	if unchanged {
+		tctx.L().Info("skip dumping the data of table unchanged since the prior dump", zap.String("database", dbName),
+			zap.String("table", table.Name), zap.String("prior", d.prior.location))
+		return nil
+	}
+	if conf.PreserveTiDBHandles && !materialized {
+		if err = preserveTiDBHandles(tctx, metaConn, meta); err != nil {
+			return err
+		}
+	}
+	if conf.DedupByPrimaryKey {
+		if err = setDedupKey(tctx, metaConn, meta); err != nil {
+			return err
+		}
+	}
+	if conf.EmitVerificationSample {
+		if err = setSampleKey(tctx, metaConn, meta); err != nil {
+			return err
+		}
+	}
+	if conf.EmitPKIndex {
+		if err = setPKIndexKey(tctx, metaConn, meta); err != nil {
+			return err
+		}
+	}
+	if conf.InvalidEnumHandling != InvalidEnumKeep {
+		if err = setEnumMembers(metaConn, meta); err != nil {
+			return err
+		}
+	}
+	if err = setPartitionByColumn(conf, meta); err != nil {
+		return err
+	}
+	if d.kafkaSink != nil {
+		if err = setKafkaKey(tctx, metaConn, conf, meta); err != nil {
+			return err
+		}
+	}
+	if d.subset != nil {
+		return d.dumpSubsetTable(tctx, metaConn, meta, taskChan)
+	}
+	return d.dumpTableChunks(tctx, meta, taskChan, func(taskChan chan<- Task) error {
+		if materialized {
+			// the rows of a view can't be split into chunks by its keys
+			return d.dumpWholeTableDirectly(tctx, metaConn, meta, taskChan, "", 0, 1)
+		}
+		if groups := conf.ColumnGroups[dbName][table.Name]; len(groups) > 0 {
+			return d.dumpColumnGroups(tctx, metaConn, meta, groups, taskChan)
+		}
+		return d.dumpTableData(tctx, metaConn, meta, taskChan)
+	})
+}
+
+// preCheckTable runs the integrity probe on the table. It returns false if the table should be skipped.
+func (d *Dumper) preCheckTable(tctx *tcontext.Context, conn *sql.Conn, db, table string) (bool, error) {
+	conf := d.conf
+	problem, err := checkTableIntegrity(tctx, conn, conf.ServerInfo.ServerType, db, table, conf.PreCheckTables)
+	if err != nil {
+		return false, err
+	}
+	if problem == "" {
+		return true, nil
 	}
+	if conf.PreCheckFailureMode != PreCheckFailureSkip {
+		return false, errors.Errorf("table `%s`.`%s` fails the pre-check: %s", db, table, problem)
+	}
+	tctx.L().Warn("skip dumping table which fails the pre-check", zap.String("database", db),
+		zap.String("table", table), zap.String("problem", problem))
+	d.preCheckFailures = append(d.preCheckFailures, TableCheckFailure{Database: db, Table: table, Message: problem})
+	return false, nil
+}
 
+// dedupSchema records the table schema file in the manifest if an identical one has been emitted.
+func (d *Dumper) dedupSchema(tctx *tcontext.Context, db, table, createTableSQL string) error {
+	conf := d.conf
+	if !conf.DedupSchema || conf.NoSchemas {
+		return nil
+	}
+	fileName, err := (&outputFileNamer{DB: outputIdentifier(conf, db), Table: outputIdentifier(conf, table)}).render(conf.OutputFileTemplate, outputFileTemplateTable)
+	if err != nil {
+		return err
+	}
+	fileName = schemaFilePath(conf, schemaDirTables, fileName+".sql") + compressFileSuffix(conf.CompressType)
+	if canonical, dup := d.schemaDeduper.dedup(fileName, createTableSQL); dup {
+		tctx.L().Debug("record duplicated table schema", zap.String("database", db),
+			zap.String("table", table), zap.String("canonical file", canonical))
+	}
 	return nil
 }
 
@@ -344,7 +1143,47 @@ func (d *Dumper) dumpTableData(tctx *tcontext.Context, conn *sql.Conn, meta Tabl
 	if conf.NoData {
 		return nil
 	}
-	if conf.Rows == UnspecifiedSize {
+	temporary, err := isGlobalTemporaryTable(conf, conn, meta)
+	if err != nil {
+		return err
+	}
+	if temporary {
+		tctx.L().Info("skip dumping the data of global temporary table, it has no persistent data",
+			zap.String("database", meta.DatabaseName()), zap.String("table", meta.TableName()))
+		return nil
+	}
+	if conf.UseCoveringIndex {
+		if err = setCoveringIndex(tctx, conn, conf, meta); err != nil {
+			return err
+		}
+	}
+	if conf.SampleFraction > 0 {
+		if err = setSampleCondition(tctx, conn, conf, meta); err != nil {
+			return err
+		}
+	}
+	d.chunkCounts.register(meta)
+	d.safeMode.register(meta)
+	d.budgets.register(meta)
+	if conf.MaterializePartitionColumn != "" {
+		partitioned, err := d.dumpPartitionsWithColumn(tctx, conn, meta, taskChan)
+		if partitioned || err != nil {
+			return err
+		}
+	}
+	if conf.RecentPartitions > 0 {
+		partitioned, err := d.dumpRecentPartitions(tctx, conn, meta, taskChan)
+		if partitioned || err != nil {
+			return err
+		}
+	}
+	if conf.PartitionFilter != "" {
+		filtered, err := d.dumpFilteredPartitions(tctx, conn, meta, taskChan)
+		if filtered || err != nil {
+			return err
+		}
+	}
+	if !conf.chunked(meta.DatabaseName(), meta.TableName()) {
 		return d.sequentialDumpTable(tctx, conn, meta, taskChan)
 	}
 	return d.concurrentDumpTable(tctx, conn, meta, taskChan)
@@ -354,8 +1193,12 @@ func (d *Dumper) buildConcatTask(tctx *tcontext.Context, conn *sql.Conn, meta Ta
 	tableChan := make(chan Task, 128)
 	errCh := make(chan error, 1)
 	go func() {
-		// adjust rows to suitable rows for this table
-		d.conf.Rows = GetSuitableRows(tctx, conn, meta.DatabaseName(), meta.TableName())
+		// adjust rows to suitable rows for this table, unless it's tuned by conf.TableRows
+		rows := d.conf.rowsOf(meta.DatabaseName(), meta.TableName())
+		if rows == UnspecifiedSize {
+			rows = GetSuitableRows(tctx, conn, meta.DatabaseName(), meta.TableName())
+		}
+		d.conf.Rows = rows
 		err := d.concurrentDumpTable(tctx, conn, meta, tableChan)
 		d.conf.Rows = UnspecifiedSize
 		if err != nil {
@@ -371,6 +1214,8 @@ func (d *Dumper) buildConcatTask(tctx *tcontext.Context, conn *sql.Conn, meta Ta
 			tctx.L().Warn("unexpected task when splitting table chunks", zap.String("task", tableTask.Brief()))
 			return
 		}
+		// the chunk is merged into the concatenated task, which takes a slot of the table again
+		tableTask.finish()
 		tableDataInst, ok := tableTask.Data.(*tableData)
 		if !ok {
 			tctx.L().Warn("unexpected task.Data when splitting table chunks", zap.String("task", tableTask.Brief()))
@@ -451,24 +1296,54 @@ func (d *Dumper) sequentialDumpTable(tctx *tcontext.Context, conn *sql.Conn, met
 func (d *Dumper) concurrentDumpTable(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta, taskChan chan<- Task) error {
 	conf := d.conf
 	db, tbl := meta.DatabaseName(), meta.TableName()
-	if conf.ServerInfo.ServerType == ServerTypeTiDB &&
+	chunkExpr := conf.ChunkExpressions[db][tbl]
+	if chunkExpr == "" && conf.ServerInfo.ServerType == ServerTypeTiDB &&
 		conf.ServerInfo.ServerVersion != nil &&
 		(conf.ServerInfo.ServerVersion.Compare(*tableSampleVersion) >= 0 ||
 			(conf.ServerInfo.HasTiKV && conf.ServerInfo.ServerVersion.Compare(*decodeRegionVersion) >= 0)) {
 		return d.concurrentDumpTiDBTables(tctx, conn, meta, taskChan)
 	}
-	field, err := pickupPossibleField(db, tbl, conn, conf)
-	if err != nil {
-		return err
+	rows := d.chunkRowsOf(tctx, conn, db, tbl)
+	// key is the column or the expression to split the table by in the queries
+	var field, key string
+	if chunkExpr != "" {
+		if err := checkChunkExpression(conn, db, tbl, chunkExpr); err != nil {
+			return err
+		}
+		key = "(" + chunkExpr + ")"
+	} else {
+		var err error
+		field, err = pickupPossibleField(db, tbl, conn, conf)
+		if err != nil {
+			return err
+		}
+		if field == "" {
+			// split the table by the primary key without any numeric column
+			keyColumns, keyColTypes, err := GetPrimaryKeyAndColumnTypes(conn, db, tbl)
+			if err != nil {
+				return err
+			}
+			if len(keyColumns) > 0 {
+				return d.concurrentDumpTableByKey(tctx, conn, meta, taskChan, keyColumns, keyColTypes, rows)
+			}
+			// skip split chunk logic if not found proper field
+			tctx.L().Warn("fallback to sequential dump due to no proper field",
+				zap.String("database", db), zap.String("table", tbl))
+			return d.dumpWholeTableDirectly(tctx, conn, meta, taskChan, "", 0, 1)
+		}
+		key = wrapBackTicks(escapeString(field))
 	}
-	if field == "" {
-		// skip split chunk logic if not found proper field
-		tctx.L().Warn("fallback to sequential dump due to no proper field",
-			zap.String("database", db), zap.String("table", tbl))
-		return d.dumpWholeTableDirectly(tctx, conn, meta, taskChan, "", 0, 1)
+	if conf.ServerInfo.ServerType != ServerTypeTiDB {
+		partitions, err := GetPartitionNames(conn, db, tbl)
+		if err != nil {
+			tctx.L().Warn("fail to get partitions of table, split it as a whole",
+				zap.String("database", db), zap.String("table", tbl), zap.Error(err))
+		} else if len(partitions) > 0 {
+			return d.concurrentDumpMySQLPartitionTable(tctx, conn, meta, taskChan, partitions, field, key, rows)
+		}
 	}
 
-	min, max, err := d.selectMinAndMaxIntValue(conn, db, tbl, field)
+	min, max, err := d.selectMinAndMaxIntValue(conn, db, tbl, "", key)
 	if err != nil {
 		return err
 	}
@@ -476,32 +1351,41 @@ func (d *Dumper) concurrentDumpTable(tctx *tcontext.Context, conn *sql.Conn, met
 		zap.String("lower", min.String()),
 		zap.String("upper", max.String()))
 
-	count := estimateCount(d.tctx, db, tbl, conn, field, conf)
-	tctx.L().Info("get estimated rows count",
-		zap.String("database", db),
-		zap.String("table", tbl),
-		zap.Uint64("estimateCount", count))
-	if count < conf.Rows {
+	var count uint64
+	if conf.SkipEstimate {
+		// assume the values of the field are dense, so every chunk covers rows values
+		width := new(big.Int).Sub(max, min)
+		width.Add(width, big.NewInt(1))
+		count = math.MaxUint64
+		if width.IsUint64() {
+			count = width.Uint64()
+		}
+	} else {
+		count = estimateCount(d.tctx, db, tbl, conn, field, conf)
+		tctx.L().Info("get estimated rows count",
+			zap.String("database", db),
+			zap.String("table", tbl),
+			zap.Uint64("estimateCount", count))
+	}
+	if count < rows {
 		// skip chunk logic if estimates are low
 		tctx.L().Warn("skip concurrent dump due to estimate count < rows",
 			zap.Uint64("estimate count", count),
-			zap.Uint64("conf.rows", conf.Rows),
+			zap.Uint64("conf.rows", rows),
 			zap.String("database", db),
 			zap.String("table", tbl))
 		return d.dumpWholeTableDirectly(tctx, conn, meta, taskChan, "", 0, 1)
 	}
 
 	// every chunk would have eventual adjustments
-	estimatedChunks := count / conf.Rows
+	estimatedChunks := count / rows
 	estimatedStep := new(big.Int).Sub(max, min).Uint64()/estimatedChunks + 1
 	bigEstimatedStep := new(big.Int).SetUint64(estimatedStep)
 	cutoff := new(big.Int).Set(min)
-	totalChunks := estimatedChunks
-	if estimatedStep == 1 {
-		totalChunks = new(big.Int).Sub(max, min).Uint64() + 1
-	}
+	// the chunks are sent until the cutoff exceeds max, so the number of them is exact to verify it
+	totalChunks := new(big.Int).Sub(max, min).Uint64()/estimatedStep + 1
 
-	selectField, selectLen, err := buildSelectField(conn, db, tbl, conf.CompleteInsert)
+	selectField, selectLen, err := buildSelectFieldForMeta(conn, meta, conf.CompleteInsert)
 	if err != nil {
 		return err
 	}
@@ -511,35 +1395,86 @@ func (d *Dumper) concurrentDumpTable(tctx *tcontext.Context, conn *sql.Conn, met
 		return err
 	}
 
-	chunkIndex := 0
-	nullValueCondition := ""
-	if conf.Where == "" {
-		nullValueCondition = fmt.Sprintf("`%s` IS NULL OR ", escapeString(field))
+	buildQuery := func(lower, upper *big.Int, withNull bool) string {
+		where := chunkRangeCondition(key, lower, upper, withNull)
+		return buildSelectQueryWithHint(db, tbl, selectField, "", indexHintOf(meta), buildTableWhereCondition(conf, meta, where), orderByClause)
 	}
+
+	var keyRanges []*chunkKeyRange
 	for max.Cmp(cutoff) >= 0 {
 		nextCutOff := new(big.Int).Add(cutoff, bigEstimatedStep)
-		where := fmt.Sprintf("%s(`%s` >= %d AND `%s` < %d)", nullValueCondition, escapeString(field), cutoff, escapeString(field), nextCutOff)
-		query := buildSelectQuery(db, tbl, selectField, "", buildWhereCondition(conf, where), orderByClause)
-		if len(nullValueCondition) > 0 {
-			nullValueCondition = ""
+		keyRanges = append(keyRanges, &chunkKeyRange{lower: cutoff, upper: nextCutOff, colLen: selectLen, buildQuery: buildQuery})
+		cutoff = nextCutOff
+	}
+	nullChunk := nullChunkIndex(conf, len(keyRanges))
+	if nullChunk >= 0 {
+		keyRanges[nullChunk].withNull = true
+	}
+	if conf.VerifyCoverage {
+		if err = verifyIntChunkCoverage(db, tbl, keyRanges, min, max, nullChunk, int(totalChunks)); err != nil {
+			return err
+		}
+	}
+	// the rows whose key is NULL are dumped by a dedicated chunk after the ranges
+	var nullQuery string
+	switch conf.NullsHandling {
+	case NullsHandlingSeparate:
+		nullQuery = buildSelectQueryWithHint(db, tbl, selectField, "", indexHintOf(meta), buildTableWhereCondition(conf, meta, key+" IS NULL"), orderByClause)
+		totalChunks++
+	case NullsHandlingExclude:
+		if err = warnExcludedNulls(tctx, conn, conf, db, tbl, key); err != nil {
+			return err
+		}
+	}
+
+	for chunkIndex, keyRange := range keyRanges {
+		task := NewTaskTableData(meta, newTableData(keyRange.query(), selectLen, false), chunkIndex, int(totalChunks))
+		task.ChunkField = field
+		if chunkExpr != "" {
+			task.keyColumns = []string{chunkExpr}
 		}
-		task := NewTaskTableData(meta, newTableData(query, selectLen, false), chunkIndex, int(totalChunks))
+		task.keyRange = keyRange
 		ctxDone := d.sendTaskToChan(tctx, task, taskChan)
 		if ctxDone {
 			return tctx.Err()
 		}
-		cutoff = nextCutOff
-		chunkIndex++
+	}
+	if nullQuery != "" {
+		task := NewTaskTableData(meta, newTableData(nullQuery, selectLen, false), len(keyRanges), int(totalChunks))
+		task.ChunkField = field
+		if chunkExpr != "" {
+			task.keyColumns = []string{chunkExpr}
+		}
+		if d.sendTaskToChan(tctx, task, taskChan) {
+			return tctx.Err()
+		}
 	}
 	return nil
 }
 
 func (d *Dumper) sendTaskToChan(tctx *tcontext.Context, task Task, taskChan chan<- Task) (ctxDone bool) {
 	conf := d.conf
+	// the schema is loaded before the data is sent, so the data can be loaded in parallel
+	if err := d.loader.loadSchema(tctx, task); err != nil {
+		d.abort(err)
+		return true
+	}
+	if td, ok := task.(*TaskTableData); ok && d.tableThreads.acquire(tctx, td) {
+		return true
+	}
+	// the task is appended to the single output in the order it's sent
+	d.stream.register(task)
 	select {
 	case <-tctx.Done():
+		if td, ok := task.(*TaskTableData); ok {
+			td.finish()
+		}
 		return true
 	case taskChan <- task:
+		if td, ok := task.(*TaskTableData); ok {
+			d.chunkCounts.plan(td)
+			d.progress.planChunk(td)
+		}
 		tctx.L().Debug("send task to writer",
 			zap.String("task", task.Brief()))
 		DecGauge(taskChannelCapacity, conf.Labels)
@@ -547,10 +1482,15 @@ func (d *Dumper) sendTaskToChan(tctx *tcontext.Context, task Task, taskChan chan
 	}
 }
 
-func (d *Dumper) selectMinAndMaxIntValue(conn *sql.Conn, db, tbl, field string) (*big.Int, *big.Int, error) {
+// selectMinAndMaxIntValue selects the bounds of key, which is a quoted column or an expression of the table,
+// in the partition of the table if partition isn't empty
+func (d *Dumper) selectMinAndMaxIntValue(conn *sql.Conn, db, tbl, partition, key string) (*big.Int, *big.Int, error) {
 	tctx, conf, zero := d.tctx, d.conf, &big.Int{}
-	query := fmt.Sprintf("SELECT MIN(`%s`),MAX(`%s`) FROM `%s`.`%s`",
-		escapeString(field), escapeString(field), escapeString(db), escapeString(tbl))
+	query := fmt.Sprintf("SELECT MIN(%s),MAX(%s) FROM `%s`.`%s`",
+		key, key, escapeString(db), escapeString(tbl))
+	if partition != "" {
+		query = fmt.Sprintf("%s PARTITION(`%s`)", query, escapeString(partition))
+	}
 	if conf.Where != "" {
 		query = fmt.Sprintf("%s WHERE %s", query, conf.Where)
 	}
@@ -558,8 +1498,9 @@ func (d *Dumper) selectMinAndMaxIntValue(conn *sql.Conn, db, tbl, field string)
 
 	var smin sql.NullString
 	var smax sql.NullString
-	row := conn.QueryRowContext(tctx, query)
-	err := row.Scan(&smin, &smax)
+	err := runWithQueryTimeout(tctx, conf, db, tbl, query, func(qctx *tcontext.Context) error {
+		return conn.QueryRowContext(qctx, query).Scan(&smin, &smax)
+	})
 	if err != nil {
 		tctx.L().Error("split chunks - get max min failed", zap.String("query", query), zap.Error(err))
 		return zero, zero, errors.Trace(err)
@@ -585,35 +1526,66 @@ func (d *Dumper) selectMinAndMaxIntValue(conn *sql.Conn, db, tbl, field string)
 func (d *Dumper) concurrentDumpTiDBTables(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta, taskChan chan<- Task) error {
 	db, tbl := meta.DatabaseName(), meta.TableName()
 
+	// for TiDB v3.0+, we can use table region decode in TiDB directly
+	if d.conf.ServerInfo.ServerVersion.Compare(*tableSampleVersion) < 0 {
+		return d.concurrentDumpTiDBTableRegions(tctx, conn, meta, taskChan, false)
+	}
+	// for TiDB v5.0+, we can use table sample directly
+	tctx.L().Debug("dumping TiDB tables with TABLESAMPLE",
+		zap.String("database", db), zap.String("table", tbl))
+	handleColNames, handleVals, err := selectTiDBTableSample(tctx, conn, db, tbl)
+	if err != nil {
+		if tctx.Err() != nil {
+			return err
+		}
+		// some tables can't be sampled even though the version supports TABLESAMPLE, e.g. the tables without regions
+		if !d.conf.ServerInfo.HasTiKV {
+			tctx.L().Warn("fail to split TiDB table by TABLESAMPLE, fallback to dump the whole table",
+				zap.String("database", db), zap.String("table", tbl), zap.Error(err))
+			return d.dumpWholeTableDirectly(tctx, conn, meta, taskChan, "", 0, 1)
+		}
+		tctx.L().Warn("fail to split TiDB table by TABLESAMPLE, fallback to TABLE REGIONS",
+			zap.String("database", db), zap.String("table", tbl), zap.Error(err))
+		return d.concurrentDumpTiDBTableRegions(tctx, conn, meta, taskChan, true)
+	}
+	handleVals = dedupeTiDBHandleVals(tctx, db, tbl, "", handleVals)
+	return d.sendConcurrentDumpTiDBTasks(tctx, conn, meta, taskChan, handleColNames, handleVals, "", 0, len(handleVals)+1)
+}
+
+// concurrentDumpTiDBTableRegions splits the table by the decoded keys of its regions. If fallback is set, the table
+// is dumped as a whole when its regions can't be read, which happens before any task of the table is sent.
+func (d *Dumper) concurrentDumpTiDBTableRegions(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta, taskChan chan<- Task, fallback bool) error {
+	db, tbl := meta.DatabaseName(), meta.TableName()
+	tctx.L().Debug("dumping TiDB tables with TABLE REGIONS",
+		zap.String("database", db), zap.String("table", tbl))
+
 	var (
 		handleColNames []string
 		handleVals     [][]string
+		partitions     []string
 		err            error
 	)
-	// for TiDB v5.0+, we can use table sample directly
-	if d.conf.ServerInfo.ServerVersion.Compare(*tableSampleVersion) >= 0 {
-		tctx.L().Debug("dumping TiDB tables with TABLESAMPLE",
-			zap.String("database", db), zap.String("table", tbl))
-		handleColNames, handleVals, err = selectTiDBTableSample(tctx, conn, db, tbl)
-	} else {
-		// for TiDB v3.0+, we can use table region decode in TiDB directly
-		tctx.L().Debug("dumping TiDB tables with TABLE REGIONS",
-			zap.String("database", db), zap.String("table", tbl))
-		var partitions []string
-		if d.conf.ServerInfo.ServerVersion.Compare(*gcSafePointVersion) >= 0 {
-			partitions, err = GetPartitionNames(conn, db, tbl)
-		}
-		if err == nil {
-			if len(partitions) == 0 {
-				handleColNames, handleVals, err = d.selectTiDBTableRegionFunc(tctx, conn, db, tbl)
-			} else {
-				return d.concurrentDumpTiDBPartitionTables(tctx, conn, meta, taskChan, partitions)
-			}
+	if d.conf.ServerInfo.ServerVersion.Compare(*gcSafePointVersion) >= 0 {
+		partitions, err = GetPartitionNames(conn, db, tbl)
+	}
+	if err == nil {
+		if len(partitions) > 0 {
+			return d.concurrentDumpTiDBPartitionTables(tctx, conn, meta, taskChan, partitions)
 		}
+		err = runWithQueryTimeout(tctx, d.conf, db, tbl, tableRegionSQL, func(qctx *tcontext.Context) (err error) {
+			handleColNames, handleVals, err = d.selectTiDBTableRegionFunc(qctx, conn, db, tbl)
+			return err
+		})
 	}
 	if err != nil {
-		return err
+		if !fallback || tctx.Err() != nil {
+			return err
+		}
+		tctx.L().Warn("fail to split TiDB table by TABLE REGIONS, fallback to dump the whole table",
+			zap.String("database", db), zap.String("table", tbl), zap.Error(err))
+		return d.dumpWholeTableDirectly(tctx, conn, meta, taskChan, "", 0, 1)
 	}
+	handleVals = dedupeTiDBHandleVals(tctx, db, tbl, "", handleVals)
 	return d.sendConcurrentDumpTiDBTasks(tctx, conn, meta, taskChan, handleColNames, handleVals, "", 0, len(handleVals)+1)
 }
 
@@ -630,12 +1602,27 @@ func (d *Dumper) concurrentDumpTiDBPartitionTables(tctx *tcontext.Context, conn
 	if err != nil {
 		return err
 	}
+	if d.conf.TimeColumn != "" {
+		partitions = selectPrunedPartitions(tctx, conn, db, tbl, d.conf.Where, partitions)
+		if len(partitions) == 0 {
+			tctx.L().Info("all partitions are pruned by time window, skip dumping data",
+				zap.String("database", db), zap.String("table", tbl))
+			return nil
+		}
+		cachedHandleVals = cachedHandleVals[:len(partitions)]
+	}
 	// cache handleVals here to calculate the total chunks
 	for i, partition := range partitions {
-		handleVals, err := selectTiDBPartitionRegion(tctx, conn, db, tbl, partition)
+		var handleVals [][]string
+		query := fmt.Sprintf(partitionRegionSQL, escapeString(db), escapeString(tbl), escapeString(partition))
+		err := runWithQueryTimeout(tctx, d.conf, db, tbl, query, func(qctx *tcontext.Context) (err error) {
+			handleVals, err = selectTiDBPartitionRegion(qctx, conn, db, tbl, partition)
+			return err
+		})
 		if err != nil {
 			return err
 		}
+		handleVals = dedupeTiDBHandleVals(tctx, db, tbl, partition, handleVals)
 		totalChunk += len(handleVals) + 1
 		cachedHandleVals[i] = handleVals
 	}
@@ -657,16 +1644,26 @@ func (d *Dumper) sendConcurrentDumpTiDBTasks(tctx *tcontext.Context,
 	}
 	conf := d.conf
 	db, tbl := meta.DatabaseName(), meta.TableName()
-	selectField, selectLen, err := buildSelectField(conn, db, tbl, conf.CompleteInsert)
+	selectField, selectLen, err := buildSelectFieldForMeta(conn, meta, conf.CompleteInsert)
 	if err != nil {
 		return err
 	}
 	where := buildWhereClauses(handleColNames, handleVals)
-	orderByClause := buildOrderByClauseString(handleColNames)
+	if conf.VerifyCoverage {
+		if err = verifyHandleChunkCoverage(db, tbl, partition, handleColNames, handleVals, where); err != nil {
+			return err
+		}
+	}
+	orderByClause, err := buildCollatedOrderByClause(conf, conn, db, tbl, handleColNames)
+	if err != nil {
+		return err
+	}
 
 	for i, w := range where {
-		query := buildSelectQuery(db, tbl, selectField, partition, buildWhereCondition(conf, w), orderByClause)
+		query := buildSelectQuery(db, tbl, selectField, partition, buildTableWhereCondition(conf, meta, w), orderByClause)
 		task := NewTaskTableData(meta, newTableData(query, selectLen, false), i+startChunkIdx, totalChunk)
+		task.ChunkField = handleColNames[0]
+		task.keyColumns = handleColNames
 		ctxDone := d.sendTaskToChan(tctx, task, taskChan)
 		if ctxDone {
 			return tctx.Err()
@@ -675,6 +1672,18 @@ func (d *Dumper) sendConcurrentDumpTiDBTasks(tctx *tcontext.Context,
 	return nil
 }
 
+// dedupeTiDBHandleVals drops the duplicated or disordered chunk boundaries of a table,
+// so that no row is dumped twice or skipped
+func dedupeTiDBHandleVals(tctx *tcontext.Context, db, tbl, partition string, handleVals [][]string) [][]string {
+	handleVals, dropped := dedupeHandleVals(handleVals)
+	if dropped > 0 {
+		tctx.L().Warn("drop duplicated or disordered chunk boundaries",
+			zap.String("database", db), zap.String("table", tbl),
+			zap.String("partition", partition), zap.Int("dropped", dropped))
+	}
+	return handleVals
+}
+
 // L returns real logger
 func (d *Dumper) L() log.Logger {
 	return d.tctx.L()
@@ -754,6 +1763,9 @@ func checkTiDBTableRegionPkFields(pkFields, pkColTypes []string) (err error) {
 	return
 }
 
+// tableRegionSQL selects the start keys of the regions of a TiDB table
+const tableRegionSQL = "SELECT START_KEY,tidb_decode_key(START_KEY) from INFORMATION_SCHEMA.TIKV_REGION_STATUS s WHERE s.DB_NAME = ? AND s.TABLE_NAME = ? AND IS_INDEX = 0 ORDER BY START_KEY;"
+
 func selectTiDBTableRegion(tctx *tcontext.Context, conn *sql.Conn, dbName, tableName string) (pkFields []string, pkVals [][]string, err error) {
 	pkFields, _, err = selectTiDBRowKeyFields(conn, dbName, tableName, checkTiDBTableRegionPkFields)
 	if err != nil {
@@ -764,12 +1776,9 @@ func selectTiDBTableRegion(tctx *tcontext.Context, conn *sql.Conn, dbName, table
 		startKey, decodedKey sql.NullString
 		rowID                = -1
 	)
-	const (
-		tableRegionSQL = "SELECT START_KEY,tidb_decode_key(START_KEY) from INFORMATION_SCHEMA.TIKV_REGION_STATUS s WHERE s.DB_NAME = ? AND s.TABLE_NAME = ? AND IS_INDEX = 0 ORDER BY START_KEY;"
-		tidbRowID      = "_tidb_rowid="
-	)
+	const tidbRowID = "_tidb_rowid="
 	logger := tctx.L().With(zap.String("database", dbName), zap.String("table", tableName))
-	err = simpleQueryWithArgs(conn, func(rows *sql.Rows) error {
+	err = queryWithArgs(tctx, conn, func(rows *sql.Rows) error {
 		rowID++
 		err = rows.Scan(&startKey, &decodedKey)
 		if err != nil {
@@ -800,15 +1809,15 @@ func selectTiDBTableRegion(tctx *tcontext.Context, conn *sql.Conn, dbName, table
 	return pkFields, pkVals, errors.Trace(err)
 }
 
+// partitionRegionSQL shows the regions of a partition of a TiDB table
+const partitionRegionSQL = "SHOW TABLE `%s`.`%s` PARTITION(`%s`) REGIONS"
+
 func selectTiDBPartitionRegion(tctx *tcontext.Context, conn *sql.Conn, dbName, tableName, partition string) (pkVals [][]string, err error) {
 	var (
 		rows      *sql.Rows
 		startKeys []string
 	)
-	const (
-		partitionRegionSQL = "SHOW TABLE `%s`.`%s` PARTITION(`%s`) REGIONS"
-		regionRowKey       = "r_"
-	)
+	const regionRowKey = "r_"
 	logger := tctx.L().With(zap.String("database", dbName), zap.String("table", tableName), zap.String("partition", partition))
 	rows, err = conn.QueryContext(tctx, fmt.Sprintf(partitionRegionSQL, escapeString(dbName), escapeString(tableName), escapeString(partition)))
 	if err != nil {
@@ -844,10 +1853,31 @@ func extractTiDBRowIDFromDecodedKey(indexField, key string) (string, error) {
 }
 
 func prepareTableListToDump(tctx *tcontext.Context, conf *Config, db *sql.Conn) error {
+	if len(conf.StaticTableList) > 0 {
+		// the tables are used as is, without any discovery or filtering
+		tables, err := ParseStaticTableList(conf.StaticTableList)
+		if err != nil {
+			return err
+		}
+		conf.Tables = tables
+		tctx.L().Info("use the static table list to dump", zap.String("tables", conf.Tables.Literal()))
+		filterTablesByJob(tctx, conf)
+		sampleTables(tctx, conf)
+		return nil
+	}
 	databases, err := prepareDumpingDatabases(conf, db)
 	if err != nil {
 		return err
 	}
+	var list *tableList
+	if conf.TableListFile != "" {
+		if list, err = parseTableListFile(conf.TableListFile); err != nil {
+			return err
+		}
+		if databases, err = list.selectDatabases(databases); err != nil {
+			return err
+		}
+	}
 
 	conf.Tables, err = listAllTables(db, databases)
 	if err != nil {
@@ -862,13 +1892,40 @@ func prepareTableListToDump(tctx *tcontext.Context, conf *Config, db *sql.Conn)
 		conf.Tables.Merge(views)
 	}
 
+	if list != nil {
+		filterTablesByList(tctx, conf, list)
+	}
 	filterTables(tctx, conf)
+	filterTablesByJob(tctx, conf)
+	sampleTables(tctx, conf)
 	return nil
 }
 
-func dumpTableMeta(conf *Config, conn *sql.Conn, db string, table *TableInfo) (TableMeta, error) {
+func dumpTableMeta(tctx *tcontext.Context, conf *Config, conn *sql.Conn, db string, table *TableInfo) (TableMeta, error) {
 	tbl := table.Name
-	selectField, _, err := buildSelectField(conn, db, tbl, conf.CompleteInsert)
+	var (
+		selectField    string
+		skippedColumns []string
+		// prunedColumns are the columns dropped from the CREATE TABLE statement
+		prunedColumns []string
+		err           error
+	)
+	if columns, ok := conf.ColumnSelectors[db+"."+tbl]; ok {
+		var skippedByTypes []string
+		selectField, skippedColumns, skippedByTypes, err = buildSelectFieldOfColumns(conn, db, tbl, columns, conf.SkipColumnTypes)
+		if conf.ColumnSelectorsInSchema {
+			prunedColumns = skippedColumns
+		} else if conf.SkipColumnTypesInSchema {
+			prunedColumns = skippedByTypes
+		}
+	} else if len(conf.SkipColumnTypes) > 0 {
+		selectField, skippedColumns, err = buildSelectFieldSkippingTypes(conn, db, tbl, conf.CompleteInsert, conf.SkipColumnTypes)
+		if conf.SkipColumnTypesInSchema {
+			prunedColumns = skippedColumns
+		}
+	} else {
+		selectField, _, err = buildSelectField(conn, db, tbl, conf.CompleteInsert)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -881,14 +1938,18 @@ func dumpTableMeta(conf *Config, conn *sql.Conn, db string, table *TableInfo) (T
 		colTypes, err = GetColumnTypes(conn, selectField, db, tbl)
 	}
 	if err != nil {
+		if len(conf.StaticTableList) > 0 && isNoSuchTableErr(err) {
+			return nil, errors.Errorf("table `%s`.`%s` in the static table list doesn't exist", db, tbl)
+		}
 		return nil, err
 	}
 
 	meta := &tableMeta{
-		database:      db,
-		table:         tbl,
-		colTypes:      colTypes,
-		selectedField: selectField,
+		database:       db,
+		table:          tbl,
+		colTypes:       colTypes,
+		selectedField:  selectField,
+		skippedColumns: skippedColumns,
 		specCmts: []string{
 			"/*!40101 SET NAMES binary*/;",
 		},
@@ -897,6 +1958,13 @@ func dumpTableMeta(conf *Config, conn *sql.Conn, db string, table *TableInfo) (T
 	if conf.NoSchemas {
 		return meta, nil
 	}
+	if table.Type == TableTypeView && conf.ViewMode == ViewModeMaterialize {
+		meta.showCreateTable, err = ShowCreateMaterializedView(conn, db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		return meta, nil
+	}
 	if table.Type == TableTypeView {
 		viewName := table.Name
 		createTableSQL, createViewSQL, err1 := ShowCreateView(conn, db, viewName)
@@ -907,11 +1975,36 @@ func dumpTableMeta(conf *Config, conn *sql.Conn, db string, table *TableInfo) (T
 		meta.showCreateView = createViewSQL
 		return meta, nil
 	}
-	createTableSQL, err := ShowCreateTable(conn, db, tbl)
+	var createTableSQL string
+	query := fmt.Sprintf("SHOW CREATE TABLE `%s`.`%s`", escapeString(db), escapeString(tbl))
+	err = runWithQueryTimeout(tctx, conf, db, tbl, query, func(qctx *tcontext.Context) (err error) {
+		createTableSQL, err = showCreateTable(qctx, conn, db, tbl)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	meta.showCreateTable = createTableSQL
+	if len(prunedColumns) > 0 {
+		createTableSQL = dropColumnsFromCreateTable(createTableSQL, prunedColumns)
+	}
+	if len(conf.CollationAllowlist) > 0 {
+		meta.collationViolations, err = findCollationViolations(conn, db, tbl, conf.CollationAllowlist)
+		if err != nil {
+			return nil, err
+		}
+		if conf.CollationMode == CollationModeRewrite && len(meta.collationViolations) > 0 {
+			createTableSQL = rewriteCollations(createTableSQL, meta.collationViolations, conf.DefaultCollation)
+		}
+	}
+	if conf.StripPartitioning {
+		createTableSQL = stripPartitioning(createTableSQL)
+	}
+	createTableSQL = stripComments(createTableSQL, conf.StripColumnComments, conf.StripTableComments)
+	createTableSQL = rewriteTableOptions(conf, createTableSQL)
+	if conf.NormalizeSchema {
+		createTableSQL = normalizeCreateTable(createTableSQL)
+	}
+	meta.showCreateTable = preserveCachedTable(conf.ServerInfo, tbl, createTableSQL)
 	return meta, nil
 }
 
@@ -929,14 +2022,34 @@ func canRebuildConn(consistency string, trxConsistencyOnly bool) bool {
 		return !trxConsistencyOnly
 	case consistencyTypeSnapshot, consistencyTypeNone:
 		return true
+	case consistencyTypeConsistentSnapshot:
+		// a new connection doesn't read the same snapshot
+		return false
 	default:
 		return false
 	}
 }
 
+// createDumpConn creates a connection to dump with, it's one of the connections whose snapshots are started together
+// with the consistent-snapshot consistency
+func (d *Dumper) createDumpConn(tctx *tcontext.Context) (*sql.Conn, error) {
+	if d.snapshotConns != nil {
+		return d.snapshotConns.takeConn()
+	}
+	return createConnWithSessionParams(tctx, d.dbHandle, d.connSessionParams)
+}
+
 // Close closes a Dumper and stop dumping immediately
 func (d *Dumper) Close() error {
 	d.cancelCtx()
+	d.releaseTargetLock()
+	if d.fifo != nil {
+		// the reader sees the end of the stream
+		if err := d.fifo.close(); err != nil {
+			d.L().Warn("fail to close output FIFO", zap.Error(err))
+		}
+	}
+	// the pool of the caller isn't closed, only the connections Dumpling takes from it are
 	return d.dbHandle.Close()
 }
 
@@ -965,10 +2078,17 @@ func initLogger(d *Dumper) error {
 			Level:  conf.LogLevel,
 			File:   conf.LogFile,
 			Format: conf.LogFormat,
+			// the log would be mixed into the sql streamed into stdout
+			Stderr: streamsToStdout(conf),
 		})
 		if err != nil {
 			return errors.Trace(err)
 		}
+	}
+	if conf.LogHook != nil {
+		logger = log.NewAppLogger(withLogHook(logger.Logger, conf.LogLevel, conf.LogHook))
+	}
+	if conf.Logger == nil {
 		pclog.ReplaceGlobals(logger.Logger, props)
 		cli.LogLongVersion(logger)
 	}
@@ -979,11 +2099,82 @@ func initLogger(d *Dumper) error {
 // createExternalStore is an initialization step of Dumper.
 func createExternalStore(d *Dumper) error {
 	tctx, conf := d.tctx, d.conf
-	extStore, err := conf.createExternalStorage(tctx)
+	if conf.OutputFIFO != "" {
+		tctx.L().Info("wait for the reader of output FIFO", zap.String("path", conf.OutputFIFO))
+		fifo, err := openFIFOStorage(conf.OutputFIFO)
+		if err != nil {
+			return err
+		}
+		d.fifo = fifo
+		d.extStore = fifo
+	} else {
+		extStore, err := conf.createExternalStorage(tctx)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !conf.SkipWriteCheck {
+			if err = checkWritable(tctx, conf, extStore); err != nil {
+				return err
+			}
+		}
+		// the lock is written into the storage directly, so it's not recorded like the dumped files
+		if conf.ExclusiveTarget {
+			if err = acquireTargetLock(d, extStore); err != nil {
+				return err
+			}
+		}
+		d.extStore = extStore
+	}
+	if conf.MaxConcurrentUploads > 0 {
+		d.uploads = newUploadLimitStorage(d.extStore, conf.MaxConcurrentUploads)
+		d.extStore = d.uploads
+	}
+	if conf.FileMode != 0 {
+		dir, err := localOutputDir(conf)
+		if err != nil {
+			return err
+		}
+		if dir != "" {
+			d.extStore = newFileModeStorage(d.extStore, dir, conf.FileMode)
+		} else {
+			tctx.L().Warn("file mode is only applied to local output directory", zap.String("output", redactStorageURL(conf.OutputDirPath)))
+		}
+	}
+	if conf.EmitChecksums {
+		d.checksums = newChecksumStorage(d.extStore)
+		d.extStore = d.checksums
+	}
+	// the files are encrypted above the checksums, so the checksums can be verified without the key
+	if conf.EncryptMethod != "" {
+		encrypted, err := encryptStorage(tctx, d.extStore, conf)
+		if err != nil {
+			return err
+		}
+		d.extStore = encrypted
+	}
+	if conf.RecordUncompressedSize && conf.CompressType != CompressNone {
+		d.sizes = newUncompressedSizeStorage(d.extStore)
+		d.extStore = d.sizes
+	}
+	if conf.CompressDictionary {
+		d.zstdDict = newZstdDictStorage(d.extStore)
+		d.extStore = d.zstdDict
+	}
+	if conf.MinFreeSpace == 0 {
+		return nil
+	}
+	dir, err := localOutputDir(conf)
 	if err != nil {
-		return errors.Trace(err)
+		return err
+	}
+	if dir == "" {
+		tctx.L().Warn("min free space is only checked for local output directory", zap.String("output", redactStorageURL(conf.OutputDirPath)))
+		return nil
+	}
+	if err = checkFreeSpace(dir, conf.MinFreeSpace); err != nil {
+		return err
 	}
-	d.extStore = extStore
+	d.freeSpaceDir = dir
 	return nil
 }
 
@@ -992,7 +2183,7 @@ func startHTTPService(d *Dumper) error {
 	conf := d.conf
 	if conf.StatusAddr != "" {
 		go func() {
-			err := startDumplingService(d.tctx, conf.StatusAddr)
+			err := startDumplingService(d.tctx, conf.StatusAddr, d)
 			if err != nil {
 				d.L().Warn("meet error when stopping dumpling http service", zap.Error(err))
 			}
@@ -1004,6 +2195,18 @@ func startHTTPService(d *Dumper) error {
 // openSQLDB is an initialization step of Dumper.
 func openSQLDB(d *Dumper) error {
 	conf := d.conf
+	if conf.DB != nil {
+		d.dbHandle = newCallerPoolDB(conf.DB)
+		return nil
+	}
+	if len(conf.Hosts) > 0 {
+		pool, err := openFirstReachableHost(d.tctx, conf)
+		if err != nil {
+			return err
+		}
+		d.dbHandle = pool
+		return nil
+	}
 	pool, err := sql.Open("mysql", conf.GetDSN(""))
 	if err != nil {
 		return errors.Trace(err)
@@ -1021,6 +2224,7 @@ func detectServerInfo(d *Dumper) error {
 		return err
 	}
 	conf.ServerInfo = ParseServerInfo(d.tctx, versionStr)
+	conf.ServerInfo.HasSequences = serverHasSequences(conf.ServerInfo)
 	return nil
 }
 
@@ -1049,22 +2253,43 @@ func tidbSetPDClientForGC(d *Dumper) error {
 		si.ServerVersion.Compare(*gcSafePointVersion) < 0 {
 		return nil
 	}
-	pdAddrs, err := GetPdAddrs(tctx, pool)
-	if err != nil {
-		return err
-	}
-	if len(pdAddrs) > 0 {
-		doPdGC, err := checkSameCluster(tctx, pool, pdAddrs)
+	// the PD addresses fetched from TiDB may belong to another cluster behind a proxy, they're skipped then.
+	// But the ones specified by the user are expected to protect the snapshot, so the dump fails instead.
+	pdAddrs, specified := d.conf.PDAddrs, len(d.conf.PDAddrs) > 0
+	if !specified {
+		var err error
+		pdAddrs, err = GetPdAddrs(tctx, pool)
 		if err != nil {
-			tctx.L().Warn("meet error while check whether fetched pd addr and TiDB belong to one cluster", zap.Error(err), zap.Strings("pdAddrs", pdAddrs))
-		} else if doPdGC {
-			pdClient, err := pd.NewClientWithContext(tctx, pdAddrs, pd.SecurityOption{})
-			if err != nil {
-				tctx.L().Warn("create pd client to control GC failed", zap.Error(err), zap.Strings("pdAddrs", pdAddrs))
-			}
-			d.tidbPDClientForGC = pdClient
+			return err
+		}
+	}
+	if len(pdAddrs) == 0 {
+		return nil
+	}
+	sameCluster, err := d.checkSameClusterFunc(tctx, pool, pdAddrs)
+	switch {
+	case err != nil && specified:
+		return errors.Annotatef(err, "fail to check whether pd %v and TiDB belong to one cluster", pdAddrs)
+	case err != nil:
+		tctx.L().Warn("meet error while check whether fetched pd addr and TiDB belong to one cluster", zap.Error(err), zap.Strings("pdAddrs", pdAddrs))
+		return nil
+	case !sameCluster && specified:
+		return errors.Errorf("pd %v doesn't belong to the cluster of TiDB, the service GC safe point can't protect the snapshot", pdAddrs)
+	case !sameCluster:
+		tctx.L().Warn("fetched pd addr and TiDB don't belong to one cluster, skip setting the service GC safe point", zap.Strings("pdAddrs", pdAddrs))
+		return nil
+	}
+	pdClient, err := pd.NewClientWithContext(tctx, pdAddrs, pd.SecurityOption{})
+	if err != nil {
+		if specified {
+			return errors.Annotatef(err, "create pd client to control GC failed, pd: %v", pdAddrs)
 		}
+		tctx.L().Warn("create pd client to control GC failed", zap.Error(err), zap.Strings("pdAddrs", pdAddrs))
+		return nil
 	}
+	tctx.L().Info("create pd client to control GC", zap.Strings("pdAddrs", pdAddrs),
+		zap.Uint64("clusterID", pdClient.GetClusterID(tctx)))
+	d.tidbPDClientForGC = pdClient
 	return nil
 }
 
@@ -1096,11 +2321,24 @@ func tidbStartGCSavepointUpdateService(d *Dumper) error {
 	tctx, pool, conf := d.tctx, d.dbHandle, d.conf
 	snapshot, si := conf.Snapshot, conf.ServerInfo
 	if d.tidbPDClientForGC != nil {
-		snapshotTS, err := parseSnapshotToTSO(pool, snapshot)
-		if err != nil {
+		// the service GC safe point of the first attempt is kept after resuming from the checkpoint
+		serviceID, snapshotTS := d.checkpoint.gcSafePoint()
+		if snapshotTS == 0 {
+			var err error
+			snapshotTS, err = parseSnapshotToTSO(pool, snapshot)
+			if err != nil {
+				return err
+			}
+		}
+		if serviceID == "" {
+			serviceID = fmt.Sprintf("%s_%d", dumplingServiceSafePointPrefix, time.Now().UnixNano())
+		}
+		if err := d.checkpoint.protectSnapshot(tctx, d.tidbPDClientForGC, serviceID, snapshotTS); err != nil {
 			return err
 		}
-		go updateServiceSafePoint(tctx, d.tidbPDClientForGC, defaultDumpGCSafePointTTL, snapshotTS)
+		d.gcLease = &gcSafePointLease{}
+		go updateServiceSafePoint(tctx, d.tidbPDClientForGC, defaultDumpGCSafePointTTL, serviceID, snapshotTS,
+			conf.GCSafePointUpdateRetries, d.gcLease, d.onGCSafePointFailure)
 	} else if si.ServerType == ServerTypeTiDB {
 		tctx.L().Warn("If the amount of data to dump is large, criteria: (data more than 60GB or dumped time more than 10 minutes)\n" +
 			"you'd better adjust the tikv_gc_life_time to avoid export failure due to TiDB GC during the dump process.\n" +
@@ -1110,28 +2348,73 @@ func tidbStartGCSavepointUpdateService(d *Dumper) error {
 	return nil
 }
 
-func updateServiceSafePoint(tctx *tcontext.Context, pdClient pd.Client, ttl int64, snapshotTS uint64) {
+// onGCSafePointFailure handles the failure to update the service GC safe point by Config.GCSafePointFailureAction.
+// The dump is always aborted if the snapshot can't be protected any more.
+func (d *Dumper) onGCSafePointFailure(err error) {
+	if _, ok := err.(*snapshotNotProtectedError); !ok && d.conf.GCSafePointFailureAction == GCSafePointFailureContinue {
+		d.tctx.L().Warn("fail to update PD safePoint, the snapshot may be GCed during the dump", zap.Error(err))
+		return
+	}
+	d.abort(errors.Annotate(err, "fail to update PD safePoint, cancel the dump to avoid reading GCed data"))
+}
+
+// snapshotNotProtectedError is returned if the GC safe point of PD is beyond the snapshot, then the snapshot
+// may have been GCed, and it won't be protected by updating the service GC safe point again
+type snapshotNotProtectedError struct {
+	clusterID    uint64
+	minSafePoint uint64
+	snapshotTS   uint64
+}
+
+func (e *snapshotNotProtectedError) Error() string {
+	return fmt.Sprintf("the GC safe point %d of cluster %d is beyond the snapshot %d, the snapshot can't be protected",
+		e.minSafePoint, e.clusterID, e.snapshotTS)
+}
+
+// updateServiceSafePoint keeps the service GC safe point dumplingServiceSafePointID at snapshotTS, lease is renewed
+// after each update. onFailure is called when the safe point still can't be updated after retries, or with
+// a snapshotNotProtectedError at once when PD has GCed beyond the snapshot. If the dump has been cancelled by
+// onFailure, it returns.
+func updateServiceSafePoint(tctx *tcontext.Context, pdClient pd.Client, ttl int64, dumplingServiceSafePointID string,
+	snapshotTS uint64, retries int, lease *gcSafePointLease, onFailure func(error)) {
 	updateInterval := time.Duration(ttl/2) * time.Second
 	tick := time.NewTicker(updateInterval)
-	dumplingServiceSafePointID := fmt.Sprintf("%s_%d", dumplingServiceSafePointPrefix, time.Now().UnixNano())
-	tctx.L().Info("generate dumpling gc safePoint id", zap.String("id", dumplingServiceSafePointID))
+	clusterID := pdClient.GetClusterID(tctx)
+	tctx.L().Info("update dumpling gc safePoint", zap.String("id", dumplingServiceSafePointID),
+		zap.Uint64("clusterID", clusterID))
 
 	for {
 		tctx.L().Debug("update PD safePoint limit with ttl",
 			zap.Uint64("safePoint", snapshotTS),
 			zap.Int64("ttl", ttl))
-		for retryCnt := 0; retryCnt <= 10; retryCnt++ {
-			_, err := pdClient.UpdateServiceGCSafePoint(tctx, dumplingServiceSafePointID, ttl, snapshotTS)
+		var err error
+		for retryCnt := 0; retryCnt <= retries; retryCnt++ {
+			var minSafePoint uint64
+			minSafePoint, err = pdClient.UpdateServiceGCSafePoint(tctx, dumplingServiceSafePointID, ttl, snapshotTS)
+			if err == nil && minSafePoint > snapshotTS {
+				err = &snapshotNotProtectedError{clusterID: clusterID, minSafePoint: minSafePoint, snapshotTS: snapshotTS}
+				break
+			}
 			if err == nil {
+				lease.renew(time.Duration(ttl) * time.Second)
 				break
 			}
 			tctx.L().Debug("update PD safePoint failed", zap.Error(err), zap.Int("retryTime", retryCnt))
+			if retryCnt == retries {
+				break
+			}
 			select {
 			case <-tctx.Done():
 				return
 			case <-time.After(time.Second):
 			}
 		}
+		if err != nil {
+			onFailure(err)
+			if tctx.Err() != nil {
+				return
+			}
+		}
 		select {
 		case <-tctx.Done():
 			return
@@ -1140,6 +2423,22 @@ func updateServiceSafePoint(tctx *tcontext.Context, pdClient pd.Client, ttl int6
 	}
 }
 
+// abort cancels the dump, err will be returned by Dump()
+func (d *Dumper) abort(err error) {
+	d.abortMu.Lock()
+	if d.abortErr == nil {
+		d.abortErr = err
+	}
+	d.abortMu.Unlock()
+	d.cancelCtx()
+}
+
+func (d *Dumper) abortError() error {
+	d.abortMu.Lock()
+	defer d.abortMu.Unlock()
+	return d.abortErr
+}
+
 // setSessionParam is an initialization step of Dumper.
 func setSessionParam(d *Dumper) error {
 	conf, pool := d.conf, d.dbHandle
@@ -1149,6 +2448,15 @@ func setSessionParam(d *Dumper) error {
 	if si.ServerType == ServerTypeTiDB && conf.TiDBMemQuotaQuery != UnspecifiedSize {
 		sessionParam[TiDBMemQuotaQueryName] = conf.TiDBMemQuotaQuery
 	}
+	// make sure `SHOW CREATE TABLE` keeps expression defaults and `ON UPDATE` clauses verbatim
+	if sqlMode, ok := sessionParam["sql_mode"].(string); ok {
+		newSQLMode, removed := removeSchemaLossySQLModes(sqlMode)
+		if len(removed) > 0 {
+			d.L().Warn("remove sql modes which make dumped schema lose column options",
+				zap.Strings("removed", removed), zap.String("sql_mode", newSQLMode))
+			sessionParam["sql_mode"] = newSQLMode
+		}
+	}
 	var err error
 	if snapshot != "" {
 		if si.ServerType != ServerTypeTiDB {
@@ -1160,10 +2468,15 @@ func setSessionParam(d *Dumper) error {
 				return err
 			}
 			if conf.ServerInfo.HasTiKV {
-				sessionParam["tidb_snapshot"] = snapshot
+				sessionParam[snapshotSessionParam] = snapshot
 			}
 		}
 	}
+	if conf.DB != nil {
+		// the DSN of the pool provided by the caller is unknown, so the session params are set on each connection
+		d.connSessionParams, err = checkSessionParams(d.tctx, pool, conf.SessionParams)
+		return err
+	}
 	if d.dbHandle, err = resetDBWithSessionParams(d.tctx, pool, conf.GetDSN(""), conf.SessionParams); err != nil {
 		return errors.Trace(err)
 	}
@@ -1178,11 +2491,15 @@ func (d *Dumper) renewSelectTableRegionFuncForLowerTiDB(tctx *tcontext.Context)
 		tctx.L().Debug("no need to build region info because database is not TiDB 3.x")
 		return nil
 	}
-	dbHandle, err := openDBFunc("mysql", conf.GetDSN(""))
-	if err != nil {
-		return errors.Trace(err)
+	dbHandle := conf.DB
+	if dbHandle == nil {
+		var err error
+		dbHandle, err = openDBFunc("mysql", conf.GetDSN(""))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer dbHandle.Close()
 	}
-	defer dbHandle.Close()
 	conn, err := dbHandle.Conn(tctx)
 	if err != nil {
 		return errors.Trace(err)
@@ -4,14 +4,20 @@ package export
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"sync"
 	"time"
 
 	tcontext "github.com/pingcap/dumpling/v4/context"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coreos/go-semver/semver"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/pingcap/br/pkg/storage"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/errors"
+	pd "github.com/tikv/pd/client"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -53,3 +59,564 @@ func (s *testSQLSuite) TestDumpBlock(c *C) {
 	c.Assert(errors.ErrorEqual(d.dumpDatabases(writerCtx, conn, taskChan), context.Canceled), IsTrue)
 	c.Assert(errors.ErrorEqual(wg.Wait(), writerErr), IsTrue)
 }
+
+func (s *testSQLSuite) TestPauseAndResumeWriter(c *C) {
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+
+	pauseCtl := newPauseController()
+	c.Assert(pauseCtl.Pause(), IsTrue)
+	c.Assert(pauseCtl.Pause(), IsFalse)
+	c.Assert(pauseCtl.IsPaused(), IsTrue)
+
+	w := &Writer{tctx: tctx, pauseCtl: pauseCtl, finishTaskCallBack: func(Task) {}}
+	taskChan := make(chan Task, 1)
+	// an unknown task will be skipped by writer
+	taskChan <- nil
+	close(taskChan)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- w.run(taskChan)
+	}()
+
+	// paused writer shouldn't pick up any task
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(w.receivedTaskCount, Equals, 0)
+	c.Assert(taskChan, HasLen, 1)
+
+	c.Assert(pauseCtl.Resume(), IsTrue)
+	c.Assert(pauseCtl.Resume(), IsFalse)
+	select {
+	case err := <-errCh:
+		c.Assert(err, IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("writer is not resumed")
+	}
+	c.Assert(w.receivedTaskCount, Equals, 1)
+
+	// cancelling context should wake up the paused writer
+	c.Assert(pauseCtl.Pause(), IsTrue)
+	cancel()
+	c.Assert(pauseCtl.waitIfPaused(tctx), Equals, context.Canceled)
+}
+
+func (s *testSQLSuite) TestRampUpWriters(c *C) {
+	c.Assert(rampUpDelay(0, 3, 4), Equals, time.Duration(0))
+	c.Assert(rampUpDelay(time.Minute, 0, 1), Equals, time.Duration(0))
+	delays := make([]time.Duration, 4)
+	for i := range delays {
+		delays[i] = rampUpDelay(time.Minute, i, 4)
+	}
+	c.Assert(delays, DeepEquals, []time.Duration{0, 15 * time.Second, 30 * time.Second, 45 * time.Second})
+
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	w := &Writer{tctx: tctx, pauseCtl: newPauseController(), finishTaskCallBack: func(Task) {}, startDelay: 300 * time.Millisecond}
+	taskChan := make(chan Task, 1)
+	taskChan <- nil
+	close(taskChan)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- w.run(taskChan)
+	}()
+
+	// the writer shouldn't pick up any task before its start delay
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(taskChan, HasLen, 1)
+	select {
+	case err := <-errCh:
+		c.Assert(err, IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("writer is not started")
+	}
+	c.Assert(w.receivedTaskCount, Equals, 1)
+
+	// cancelling context should stop the writer which is waiting to start
+	w = &Writer{tctx: tctx, pauseCtl: newPauseController(), startDelay: time.Hour}
+	cancel()
+	c.Assert(w.run(make(chan Task)), IsNil)
+}
+
+func (s *testSQLSuite) TestCheckEstimatedSize(c *C) {
+	conf := DefaultConfig()
+	conf.MaxEstimatedBytes = 3 << 30
+	d := &Dumper{conf: conf, tableEstimatedSize: map[string]map[string]uint64{
+		"shop": {"orders": 2 << 30, "users": 512 << 20},
+		"log":  {"events": 0},
+	}}
+	c.Assert(d.checkEstimatedSize(), IsNil)
+
+	d.tableEstimatedSize["log"]["events"] = 1 << 30
+	c.Assert(d.checkEstimatedSize(), ErrorMatches, "the estimated data size 3.5GiB exceeds the budget 3GiB of max-estimated-bytes, "+
+		"the largest table is `shop`.`orders` of 2GiB, please check the table filter or raise the budget")
+}
+
+func (s *testSQLSuite) TestCallerProvidedDB(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+
+	conf := DefaultConfig()
+	conf.DB = db
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	conf.SessionParams = map[string]interface{}{"max_execution_time": "100", "unknown_variable": "1"}
+	d := &Dumper{tctx: tctx, conf: conf, cancelCtx: cancel}
+	c.Assert(openSQLDB(d), IsNil)
+	c.Assert(d.dbHandle, Not(Equals), db)
+
+	// session params are checked on the provided pool
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectExec("SET SESSION max_execution_time = \\?").WithArgs(int64(100)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET SESSION unknown_variable = \\?").WithArgs(int64(1)).
+		WillReturnError(&mysqldriver.MySQLError{Number: 1193, Message: "Unknown system variable 'unknown_variable'"})
+	c.Assert(setSessionParam(d), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(d.connSessionParams, DeepEquals, map[string]interface{}{"max_execution_time": int64(100)})
+
+	// and applied to each connection
+	mock.MatchExpectationsInOrder(true)
+	mock.ExpectExec("SET SESSION max_execution_time = \\?").WithArgs(int64(100)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("START TRANSACTION").WillReturnResult(sqlmock.NewResult(0, 0))
+	conn, err := createConnWithSessionParams(tctx, d.dbHandle, d.connSessionParams)
+	c.Assert(err, IsNil)
+	c.Assert(conn.Close(), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(db.Stats().InUse, Equals, 1)
+
+	// the connection is discarded instead of being returned to the pool with the session params,
+	// and the pool isn't closed by Dumper
+	mock.ExpectClose()
+	c.Assert(d.Close(), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(db.Stats().OpenConnections, Equals, 0)
+	c.Assert(db.PingContext(context.Background()), Not(ErrorMatches), "sql: database is closed")
+}
+
+func (s *testSQLSuite) TestDedupSchema(c *C) {
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.DedupSchema = true
+	conf.CompressType = CompressGzip
+	d := &Dumper{tctx: tctx, conf: conf, schemaDeduper: newSchemaDeduper()}
+
+	createSQL := "CREATE TABLE `t` (`a` int)"
+	c.Assert(d.dedupSchema(tctx, "shard_1", "t", createSQL), IsNil)
+	c.Assert(d.dedupSchema(tctx, "shard_2", "t", createSQL), IsNil)
+	c.Assert(d.dedupSchema(tctx, "shard_2", "t2", "CREATE TABLE `t2` (`a` int)"), IsNil)
+	c.Assert(d.schemaDeduper.DuplicatedFiles, DeepEquals, map[string]string{
+		"shard_2.t-schema.sql.gz": "shard_1.t-schema.sql.gz",
+	})
+
+	dir := c.MkDir()
+	extStore, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	c.Assert(d.schemaDeduper.writeManifest(tctx, extStore), IsNil)
+	data, err := extStore.ReadFile(tctx, schemaDedupManifestPath)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "{\n  \"duplicated_files\": {\n    \"shard_2.t-schema.sql.gz\": \"shard_1.t-schema.sql.gz\"\n  }\n}")
+
+	// schemas are never deduplicated without the option
+	conf.DedupSchema = false
+	c.Assert(d.dedupSchema(tctx, "shard_3", "t", createSQL), IsNil)
+	c.Assert(d.schemaDeduper.DuplicatedFiles, HasLen, 1)
+}
+
+func (s *testSQLSuite) TestDedupSchemaKeepsFullSchema(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.NoData = true
+	conf.DedupSchema = true
+	conf.Tables = DatabaseTables{}.AppendTables("shard_1", "c", "t").AppendTables("shard_2", "c", "t")
+	d := &Dumper{tctx: tctx, conf: conf, schemaDeduper: newSchemaDeduper()}
+	createSQLs := map[string]string{
+		"t": "CREATE TABLE `t` (`a` int)",
+		"c": "CREATE TABLE `c` (`a` int, `p` int, CONSTRAINT `fk` FOREIGN KEY (`p`) REFERENCES `t` (`a`))",
+	}
+	for _, dbName := range []string{"shard_1", "shard_2"} {
+		mock.ExpectQuery(fmt.Sprintf("SHOW CREATE DATABASE `%s`", dbName)).
+			WillReturnRows(sqlmock.NewRows([]string{"Database", "Create Database"}).
+				AddRow(dbName, fmt.Sprintf("CREATE DATABASE `%s`", dbName)))
+		for _, tbl := range []string{"c", "t"} {
+			mock.ExpectQuery("SELECT COLUMN_NAME").WithArgs(dbName, tbl).
+				WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("a", ""))
+			mock.ExpectQuery(fmt.Sprintf("SELECT \\* FROM `%s`.`%s` LIMIT 1", dbName, tbl)).
+				WillReturnRows(sqlmock.NewRows([]string{"a"}))
+			mock.ExpectQuery(fmt.Sprintf("SHOW CREATE TABLE `%s`.`%s`", dbName, tbl)).
+				WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow(tbl, createSQLs[tbl]))
+		}
+	}
+
+	taskChan := make(chan Task, 8)
+	c.Assert(d.dumpDatabases(tctx, conn, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	// the duplicated tables still have their full schema files, which keep the foreign keys
+	schemas := make(map[string]string)
+	for task := range taskChan {
+		if t, ok := task.(*TaskTableMeta); ok {
+			schemas[t.DatabaseName+"."+t.TableName] = t.CreateTableSQL
+		}
+	}
+	c.Assert(schemas, DeepEquals, map[string]string{
+		"shard_1.c": createSQLs["c"],
+		"shard_1.t": createSQLs["t"],
+		"shard_2.c": createSQLs["c"],
+		"shard_2.t": createSQLs["t"],
+	})
+	c.Assert(d.schemaDeduper.DuplicatedFiles, DeepEquals, map[string]string{
+		"shard_2.c-schema.sql": "shard_1.c-schema.sql",
+		"shard_2.t-schema.sql": "shard_1.t-schema.sql",
+	})
+}
+
+func (s *testSQLSuite) TestPreCheckTable(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	conf.PreCheckTables = PreCheckTablesQuick
+	d := &Dumper{tctx: tctx, conf: conf}
+	columns := []string{"Table", "Op", "Msg_type", "Msg_text"}
+
+	mock.ExpectQuery("CHECK TABLE `test`.`t1` QUICK").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("test.t1", "check", "status", "OK"))
+	passed, err := d.preCheckTable(tctx, conn, "test", "t1")
+	c.Assert(err, IsNil)
+	c.Assert(passed, IsTrue)
+
+	mock.ExpectQuery("CHECK TABLE `test`.`t2` QUICK").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("test.t2", "check", "error", "Corrupt"))
+	_, err = d.preCheckTable(tctx, conn, "test", "t2")
+	c.Assert(err, ErrorMatches, "table `test`.`t2` fails the pre-check: Corrupt")
+
+	conf.PreCheckFailureMode = PreCheckFailureSkip
+	mock.ExpectQuery("CHECK TABLE `test`.`t2` QUICK").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("test.t2", "check", "error", "Corrupt"))
+	passed, err = d.preCheckTable(tctx, conn, "test", "t2")
+	c.Assert(err, IsNil)
+	c.Assert(passed, IsFalse)
+	c.Assert(d.buildDumpResult(time.Now(), nil).PreCheckFailures, DeepEquals,
+		[]TableCheckFailure{{Database: "test", Table: "t2", Message: "Corrupt"}})
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testSQLSuite) TestDumpLargestTableFirst(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.NoData = true
+	conf.LargestFirst = true
+	conf.Tables = DatabaseTables{}.AppendTables("test", "t1", "t2", "t3")
+	d := &Dumper{
+		tctx: tctx,
+		conf: conf,
+		tableEstimatedSize: map[string]map[string]uint64{
+			"test": {"t1": 100, "t2": 300, "t3": 200},
+		},
+	}
+	mock.ExpectQuery("SHOW CREATE DATABASE `test`").
+		WillReturnRows(sqlmock.NewRows([]string{"Database", "Create Database"}).
+			AddRow("test", "CREATE DATABASE `test`"))
+	for _, tbl := range []string{"t2", "t3", "t1"} {
+		mock.ExpectQuery("SELECT COLUMN_NAME").WithArgs("test", tbl).
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("a", ""))
+		mock.ExpectQuery(fmt.Sprintf("SELECT \\* FROM `test`.`%s` LIMIT 1", tbl)).
+			WillReturnRows(sqlmock.NewRows([]string{"a"}))
+		mock.ExpectQuery(fmt.Sprintf("SHOW CREATE TABLE `test`.`%s`", tbl)).
+			WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).
+				AddRow(tbl, fmt.Sprintf("CREATE TABLE `%s` (`a` int)", tbl)))
+	}
+
+	taskChan := make(chan Task, 4)
+	c.Assert(d.dumpDatabases(tctx, conn, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	var tables []string
+	for task := range taskChan {
+		if t, ok := task.(*TaskTableMeta); ok {
+			tables = append(tables, t.TableName)
+		}
+	}
+	c.Assert(tables, DeepEquals, []string{"t2", "t3", "t1"})
+}
+
+func (s *testSQLSuite) TestNoDataMarkers(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.NoData = true
+	conf.NoDataMarkers = true
+	conf.Tables = DatabaseTables{}.AppendTables("test", "t1", "t2")
+	d := &Dumper{tctx: tctx, conf: conf, schemaOnly: newSchemaOnlyRecorder()}
+	mock.ExpectQuery("SHOW CREATE DATABASE `test`").
+		WillReturnRows(sqlmock.NewRows([]string{"Database", "Create Database"}).
+			AddRow("test", "CREATE DATABASE `test`"))
+	for _, tbl := range []string{"t1", "t2"} {
+		mock.ExpectQuery("SELECT COLUMN_NAME").WithArgs("test", tbl).
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("a", ""))
+		mock.ExpectQuery(fmt.Sprintf("SELECT \\* FROM `test`.`%s` LIMIT 1", tbl)).
+			WillReturnRows(sqlmock.NewRows([]string{"a"}))
+		mock.ExpectQuery(fmt.Sprintf("SHOW CREATE TABLE `test`.`%s`", tbl)).
+			WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).
+				AddRow(tbl, fmt.Sprintf("CREATE TABLE `%s` (`a` int)", tbl)))
+	}
+
+	taskChan := make(chan Task, 4)
+	c.Assert(d.dumpDatabases(tctx, conn, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	for task := range taskChan {
+		_, ok := task.(*TaskTableData)
+		c.Assert(ok, IsFalse)
+	}
+	c.Assert(d.schemaOnly.Tables, DeepEquals, []schemaOnlyTable{
+		{Database: "test", Table: "t1"},
+		{Database: "test", Table: "t2"},
+	})
+
+	dir := c.MkDir()
+	extStore, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	c.Assert(d.schemaOnly.writeManifest(tctx, extStore), IsNil)
+	data, err := extStore.ReadFile(tctx, schemaOnlyManifestPath)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Matches, `(?s).*"table": "t2",\s*"data_dumped": false,\s*"rows": 0.*`)
+}
+
+func (s *testSQLSuite) TestNoCreateDatabase(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.NoData = true
+	conf.NoCreateDatabase = true
+	conf.Tables = DatabaseTables{}.AppendTables("test", "t1")
+	d := &Dumper{tctx: tctx, conf: conf}
+	// SHOW CREATE DATABASE isn't queried
+	mock.ExpectQuery("SELECT COLUMN_NAME").WithArgs("test", "t1").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("a", ""))
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t1` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"a"}))
+	mock.ExpectQuery("SHOW CREATE TABLE `test`.`t1`").
+		WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).
+			AddRow("t1", "CREATE TABLE `t1` (`a` int)"))
+
+	taskChan := make(chan Task, 4)
+	c.Assert(d.dumpDatabases(tctx, conn, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	var tasks []Task
+	for task := range taskChan {
+		tasks = append(tasks, task)
+	}
+	c.Assert(tasks, HasLen, 1)
+	_, ok := tasks[0].(*TaskTableMeta)
+	c.Assert(ok, IsTrue)
+}
+
+type mockGCPDClient struct {
+	pd.Client
+	mu sync.Mutex
+	// failures is the number of calls to fail before succeeding
+	failures int
+	calls    int
+	// minSafePoint is the GC safe point of PD returned by the updates
+	minSafePoint uint64
+	// serviceIDs and safePoints are the service GC safe points updated
+	serviceIDs []string
+	safePoints []uint64
+}
+
+func (m *mockGCPDClient) GetClusterID(context.Context) uint64 {
+	return 6900000000000000000
+}
+
+func (m *mockGCPDClient) UpdateServiceGCSafePoint(_ context.Context, serviceID string, _ int64, safePoint uint64) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	m.serviceIDs = append(m.serviceIDs, serviceID)
+	m.safePoints = append(m.safePoints, safePoint)
+	if m.calls <= m.failures {
+		return 0, errors.New("pd is unavailable")
+	}
+	return m.minSafePoint, nil
+}
+
+func (m *mockGCPDClient) callCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
+// firstUpdate returns the first service GC safe point updated
+func (m *mockGCPDClient) firstUpdate() (string, uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.serviceIDs) == 0 {
+		return "", 0
+	}
+	return m.serviceIDs[0], m.safePoints[0]
+}
+
+func (s *testSQLSuite) TestUpdateServiceSafePointFailure(c *C) {
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	d := &Dumper{tctx: tctx, conf: DefaultConfig(), cancelCtx: cancel}
+
+	// abort the dump when the safe point can't be updated after retries
+	pdClient := &mockGCPDClient{failures: 100}
+	lease := &gcSafePointLease{}
+	updateServiceSafePoint(tctx, pdClient, 2, "dumpling_1", 1, 1, lease, func(err error) {
+		d.abort(errors.Annotate(err, "fail to update PD safePoint"))
+	})
+	c.Assert(pdClient.callCount(), Equals, 2)
+	c.Assert(tctx.Err(), NotNil)
+	c.Assert(d.abortError(), ErrorMatches, "fail to update PD safePoint: pd is unavailable")
+	c.Assert(lease.valid(), IsFalse)
+
+	// keep updating in the next round when continuing on failure
+	tctx, cancel = tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	pdClient = &mockGCPDClient{failures: 1}
+	var failures []error
+	done := make(chan struct{})
+	go func() {
+		updateServiceSafePoint(tctx, pdClient, 2, "dumpling_1", 1, 0, lease, func(err error) {
+			failures = append(failures, err)
+		})
+		close(done)
+	}()
+	for i := 0; i < 50 && pdClient.callCount() < 2; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	c.Assert(pdClient.callCount(), GreaterEqual, 2)
+	c.Assert(failures, HasLen, 1)
+	// the snapshot is protected for a ttl after the safe point is updated
+	c.Assert(lease.valid(), IsTrue)
+}
+
+func (s *testSQLSuite) TestUpdateServiceSafePointBeyondSnapshot(c *C) {
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conf := DefaultConfig()
+	conf.GCSafePointFailureAction = GCSafePointFailureContinue
+	d := &Dumper{tctx: tctx, conf: conf, cancelCtx: cancel}
+
+	// the dump is aborted at once even if it continues on the other failures, since the snapshot may have been GCed
+	pdClient := &mockGCPDClient{minSafePoint: 100}
+	lease := &gcSafePointLease{}
+	updateServiceSafePoint(tctx, pdClient, 2, "dumpling_1", 10, 3, lease, d.onGCSafePointFailure)
+	c.Assert(pdClient.callCount(), Equals, 1)
+	c.Assert(d.abortError(), ErrorMatches, "fail to update PD safePoint, cancel the dump to avoid reading GCed data: the GC safe point 100 of cluster 6900000000000000000 is beyond the snapshot 10, the snapshot can't be protected")
+	c.Assert(lease.valid(), IsFalse)
+}
+
+func (s *testSQLSuite) TestSetPDClientForGCOfAnotherCluster(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeTiDB, ServerVersion: semver.New("4.0.9")}
+	var checkedAddrs []string
+	d := &Dumper{tctx: tctx, conf: conf, dbHandle: db}
+	d.checkSameClusterFunc = func(_ *tcontext.Context, _ *sql.DB, pdAddrs []string) (bool, error) {
+		checkedAddrs = pdAddrs
+		return false, nil
+	}
+
+	// the PD fetched from TiDB which belongs to another cluster is skipped
+	mock.ExpectQuery("SELECT \\* FROM information_schema.cluster_info where type = 'pd';").
+		WillReturnRows(sqlmock.NewRows([]string{"TYPE", "INSTANCE", "STATUS_ADDRESS"}).AddRow("pd", "10.0.0.1:2379", "10.0.0.1:2379"))
+	c.Assert(tidbSetPDClientForGC(d), IsNil)
+	c.Assert(checkedAddrs, DeepEquals, []string{"10.0.0.1:2379"})
+	c.Assert(d.tidbPDClientForGC, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the PD specified by the user is used without querying TiDB, and the dump fails if it belongs to another cluster
+	conf.PDAddrs = []string{"10.0.1.1:2379", "10.0.1.2:2379"}
+	c.Assert(tidbSetPDClientForGC(d), ErrorMatches,
+		"pd \\[10.0.1.1:2379 10.0.1.2:2379\\] doesn't belong to the cluster of TiDB, the service GC safe point can't protect the snapshot")
+	c.Assert(checkedAddrs, DeepEquals, conf.PDAddrs)
+	d.checkSameClusterFunc = func(*tcontext.Context, *sql.DB, []string) (bool, error) {
+		return false, errors.New("context deadline exceeded")
+	}
+	c.Assert(tidbSetPDClientForGC(d), ErrorMatches, "fail to check whether pd .* and TiDB belong to one cluster: context deadline exceeded")
+	c.Assert(d.tidbPDClientForGC, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testSQLSuite) TestConcurrentDumpTableWithSkipEstimate(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.Rows = 10
+	conf.SkipEstimate = true
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "test", table: "t"}
+	mock.ExpectQuery("SELECT column_name FROM information_schema.columns").WithArgs("test", "t", "PRI").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+	mock.ExpectQuery("SELECT MIN\\(`id`\\),MAX\\(`id`\\) FROM `test`.`t`").
+		WillReturnRows(sqlmock.NewRows([]string{"MIN", "MAX"}).AddRow(1, 100))
+	// the rows aren't estimated by EXPLAIN
+	mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("id", ""))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+
+	taskChan := make(chan Task, 16)
+	c.Assert(d.concurrentDumpTable(tctx, conn, meta, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// every chunk covers conf.Rows values of the primary key
+	var queries []string
+	for task := range taskChan {
+		queries = append(queries, task.(*TaskTableData).Data.(*tableData).query)
+	}
+	c.Assert(queries, HasLen, 10)
+	c.Assert(queries[0], Equals, "SELECT * FROM `test`.`t` WHERE ((`id` IS NULL OR (`id` >= 1 AND `id` < 11))) ORDER BY `id`")
+	c.Assert(queries[9], Equals, "SELECT * FROM `test`.`t` WHERE ((`id` >= 91 AND `id` < 101)) ORDER BY `id`")
+}
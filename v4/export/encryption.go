@@ -0,0 +1,444 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+const (
+	// EncryptMethodAES256CTR encrypts the files by AES-256 in the CTR mode, which isn't authenticated
+	EncryptMethodAES256CTR = "aes256-ctr"
+	// EncryptMethodAES128GCM encrypts the files by AES-128 in the GCM mode, in authenticated segments
+	EncryptMethodAES128GCM = "aes128-gcm"
+)
+
+const (
+	// encryptionMagic starts the header of every encrypted file
+	encryptionMagic   = "DENC"
+	encryptionVersion = 1
+	// encryptSegmentSize is the size of the plaintext sealed in each segment of aes128-gcm
+	encryptSegmentSize = 64 << 10
+	// gcmNoncePrefixSize is the size of the random prefix of the nonces, which are followed by
+	// the 4 bytes index of the segment and 1 byte marking the last segment
+	gcmNoncePrefixSize = 7
+)
+
+// the method ids in the header
+const (
+	encryptMethodIDAES256CTR byte = iota + 1
+	encryptMethodIDAES128GCM
+)
+
+func encryptMethodID(method string) (byte, int, error) {
+	switch method {
+	case EncryptMethodAES256CTR:
+		return encryptMethodIDAES256CTR, 32, nil
+	case EncryptMethodAES128GCM:
+		return encryptMethodIDAES128GCM, 16, nil
+	default:
+		return 0, 0, errors.Errorf("unknown encrypt method '%s', supported methods are '%s' and '%s'",
+			method, EncryptMethodAES256CTR, EncryptMethodAES128GCM)
+	}
+}
+
+// adjustEncryption checks the method and the key source of the client-side encryption
+func adjustEncryption(conf *Config) error {
+	if conf.EncryptMethod == "" {
+		if conf.EncryptKey != "" || conf.EncryptKMSKeyID != "" {
+			return errors.New("config.EncryptKey and config.EncryptKMSKeyID require config.EncryptMethod")
+		}
+		return nil
+	}
+	conf.EncryptMethod = strings.ToLower(conf.EncryptMethod)
+	_, keySize, err := encryptMethodID(conf.EncryptMethod)
+	if err != nil {
+		return err
+	}
+	if (conf.EncryptKey == "") == (conf.EncryptKMSKeyID == "") {
+		return errors.New("exactly one of config.EncryptKey and config.EncryptKMSKeyID should be set with config.EncryptMethod")
+	}
+	if conf.EncryptKey != "" {
+		if _, err = decodeEncryptKey(conf.EncryptKey, keySize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeEncryptKey(hexKey string, keySize int) ([]byte, error) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, errors.Annotate(err, "config.EncryptKey should be hex encoded")
+	}
+	if len(key) != keySize {
+		return nil, errors.Errorf("config.EncryptKey should be %d bytes for the encrypt method, but it's %d bytes", keySize, len(key))
+	}
+	return key, nil
+}
+
+// newKMSClient connects to the KMS in the region and with the credentials of the S3 options
+func newKMSClient(conf *Config) (kmsiface.KMSAPI, error) {
+	awsConf := aws.NewConfig()
+	if conf.S3.Region != "" {
+		awsConf.WithRegion(conf.S3.Region)
+	}
+	if conf.S3.AccessKey != "" && conf.S3.SecretAccessKey != "" {
+		awsConf.WithCredentials(credentials.NewStaticCredentials(conf.S3.AccessKey, conf.S3.SecretAccessKey, ""))
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{Config: *awsConf, SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, errors.Annotate(err, "fail to create the KMS client")
+	}
+	return kms.New(sess), nil
+}
+
+// encryptStorage returns the storage encrypting the files written into s with conf.EncryptMethod
+func encryptStorage(ctx context.Context, s storage.ExternalStorage, conf *Config) (*encryptedStorage, error) {
+	var kmsClient kmsiface.KMSAPI
+	if conf.EncryptKMSKeyID != "" {
+		var err error
+		if kmsClient, err = newKMSClient(conf); err != nil {
+			return nil, err
+		}
+	}
+	return newEncryptedStorage(ctx, s, conf, kmsClient)
+}
+
+// encryptedStorage encrypts the files created through it, after they're compressed. Every file starts with a header
+// holding the method, the IV or the nonce prefix, and the data key wrapped by KMS if the key is from KMS.
+type encryptedStorage struct {
+	storage.ExternalStorage
+	conf   *Config
+	kms    kmsiface.KMSAPI
+	method byte
+	key    []byte
+	// wrappedKey is the data key encrypted by KMS, it's stored in the headers so the files can be decrypted by KMS
+	wrappedKey []byte
+}
+
+// newEncryptedStorage returns the storage encrypting the files with conf.EncryptMethod. The data key is generated by
+// KMS once for the whole dump if conf.EncryptKMSKeyID is set.
+func newEncryptedStorage(ctx context.Context, s storage.ExternalStorage, conf *Config, kmsClient kmsiface.KMSAPI) (*encryptedStorage, error) {
+	method, keySize, err := encryptMethodID(conf.EncryptMethod)
+	if err != nil {
+		return nil, err
+	}
+	es := &encryptedStorage{ExternalStorage: s, conf: conf, kms: kmsClient, method: method}
+	if conf.EncryptKMSKeyID == "" {
+		es.key, err = decodeEncryptKey(conf.EncryptKey, keySize)
+		return es, err
+	}
+	out, err := kmsClient.GenerateDataKeyWithContext(ctx, &kms.GenerateDataKeyInput{
+		KeyId:         aws.String(conf.EncryptKMSKeyID),
+		NumberOfBytes: aws.Int64(int64(keySize)),
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, "fail to generate the data key by KMS key %s", conf.EncryptKMSKeyID)
+	}
+	es.key, es.wrappedKey = out.Plaintext, out.CiphertextBlob
+	return es, nil
+}
+
+// newHeader returns the header of a new file with a random IV or nonce prefix
+func (s *encryptedStorage) newHeader() ([]byte, []byte, error) {
+	ivSize := aes.BlockSize
+	if s.method == encryptMethodIDAES128GCM {
+		ivSize = gcmNoncePrefixSize
+	}
+	iv := make([]byte, ivSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	header := make([]byte, 0, len(encryptionMagic)+5+ivSize+len(s.wrappedKey))
+	header = append(header, encryptionMagic...)
+	header = append(header, encryptionVersion, s.method, byte(ivSize))
+	header = append(header, iv...)
+	header = append(header, byte(len(s.wrappedKey)>>8), byte(len(s.wrappedKey)))
+	header = append(header, s.wrappedKey...)
+	return header, iv, nil
+}
+
+func (s *encryptedStorage) newEncryptWriter(w io.Writer) (io.WriteCloser, error) {
+	header, iv, err := s.newHeader()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(header); err != nil {
+		return nil, errors.Trace(err)
+	}
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if s.method == encryptMethodIDAES256CTR {
+		return &cipher.StreamWriter{S: cipher.NewCTR(block, iv), W: w}, nil
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &gcmSegmentWriter{w: w, aead: aead, noncePrefix: iv, header: header, buf: make([]byte, 0, encryptSegmentSize)}, nil
+}
+
+// Create implements ExternalStorage.Create. The data is encrypted as it's written, ctx is used to write
+// the encrypted data until the file is closed
+func (s *encryptedStorage) Create(ctx context.Context, name string) (storage.ExternalFileWriter, error) {
+	writer, err := s.ExternalStorage.Create(ctx, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	file := &compressedFileOutput{ctx: ctx, writer: writer}
+	encryptor, err := s.newEncryptWriter(file)
+	if err != nil {
+		_ = writer.Close(ctx)
+		return nil, err
+	}
+	return &encryptedFileWriter{encryptor: encryptor, file: file}, nil
+}
+
+// WriteFile implements ExternalStorage.WriteFile
+func (s *encryptedStorage) WriteFile(ctx context.Context, name string, data []byte) error {
+	var bf bytes.Buffer
+	encryptor, err := s.newEncryptWriter(&bf)
+	if err != nil {
+		return err
+	}
+	if _, err = encryptor.Write(data); err != nil {
+		return errors.Trace(err)
+	}
+	if err = encryptor.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	return s.ExternalStorage.WriteFile(ctx, name, bf.Bytes())
+}
+
+// ReadFile implements ExternalStorage.ReadFile
+func (s *encryptedStorage) ReadFile(ctx context.Context, name string) ([]byte, error) {
+	data, err := s.ExternalStorage.ReadFile(ctx, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	data, err = decryptFile(ctx, s.conf, s.kms, data)
+	return data, errors.Annotatef(err, "fail to decrypt %s", name)
+}
+
+// Open implements ExternalStorage.Open. The whole file is read and decrypted into memory.
+func (s *encryptedStorage) Open(ctx context.Context, name string) (storage.ExternalFileReader, error) {
+	data, err := s.ReadFile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return decryptedFileReader{bytes.NewReader(data)}, nil
+}
+
+type decryptedFileReader struct {
+	*bytes.Reader
+}
+
+// Close implements io.Closer.
+func (decryptedFileReader) Close() error {
+	return nil
+}
+
+// encryptedFileWriter encrypts the data written into the file
+type encryptedFileWriter struct {
+	encryptor io.WriteCloser
+	file      *compressedFileOutput
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *encryptedFileWriter) Write(_ context.Context, p []byte) (int, error) {
+	n, err := w.encryptor.Write(p)
+	return n, errors.Trace(err)
+}
+
+// Close implements ExternalFileWriter.Close, it flushes the last encrypted segment and closes the file
+func (w *encryptedFileWriter) Close(ctx context.Context) error {
+	if err := w.encryptor.Close(); err != nil {
+		_ = w.file.writer.Close(ctx)
+		return errors.Trace(err)
+	}
+	return errors.Trace(w.file.writer.Close(ctx))
+}
+
+// gcmSegmentWriter seals the plaintext in segments of encryptSegmentSize. The nonce of each segment is made of the
+// random prefix, the index of the segment and whether it's the last one, so the reordered or truncated segments fail
+// the authentication. The header is authenticated in every segment as the additional data.
+type gcmSegmentWriter struct {
+	w           io.Writer
+	aead        cipher.AEAD
+	noncePrefix []byte
+	header      []byte
+	buf         []byte
+	index       uint32
+}
+
+// Write implements io.Writer. A full segment is only sealed when more data comes, so the last segment is always
+// sealed by Close.
+func (w *gcmSegmentWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if len(w.buf) == encryptSegmentSize {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):encryptSegmentSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close implements io.Closer, it seals the last segment, which is empty if nothing is written
+func (w *gcmSegmentWriter) Close() error {
+	return w.seal(true)
+}
+
+func (w *gcmSegmentWriter) seal(last bool) error {
+	sealed := w.aead.Seal(nil, gcmSegmentNonce(w.noncePrefix, w.index, last), w.buf, w.header)
+	w.index++
+	w.buf = w.buf[:0]
+	_, err := w.w.Write(sealed)
+	return errors.Trace(err)
+}
+
+func gcmSegmentNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, gcmNoncePrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[gcmNoncePrefixSize:], index)
+	if last {
+		nonce[gcmNoncePrefixSize+4] = 1
+	}
+	return nonce
+}
+
+// DecryptFile decrypts the data of a file encrypted by the dump with conf. The key is conf.EncryptKey, or the data key
+// in the header unwrapped by KMS if conf.EncryptKMSKeyID is set. The files encrypted by aes128-gcm fail to decrypt
+// with a wrong key, while the ones encrypted by aes256-ctr aren't authenticated and decrypt into garbage.
+func DecryptFile(ctx context.Context, conf *Config, data []byte) ([]byte, error) {
+	var kmsClient kmsiface.KMSAPI
+	if conf.EncryptKMSKeyID != "" {
+		var err error
+		if kmsClient, err = newKMSClient(conf); err != nil {
+			return nil, err
+		}
+	}
+	return decryptFile(ctx, conf, kmsClient, data)
+}
+
+func decryptFile(ctx context.Context, conf *Config, kmsClient kmsiface.KMSAPI, data []byte) ([]byte, error) {
+	headerSize := len(encryptionMagic) + 3
+	if len(data) < headerSize || string(data[:len(encryptionMagic)]) != encryptionMagic {
+		return nil, errors.New("the file isn't encrypted by dumpling")
+	}
+	version, method, ivSize := data[len(encryptionMagic)], data[len(encryptionMagic)+1], int(data[len(encryptionMagic)+2])
+	if version != encryptionVersion {
+		return nil, errors.Errorf("unsupported encryption version %d", version)
+	}
+	if len(data) < headerSize+ivSize+2 {
+		return nil, errors.New("the header of the encrypted file is truncated")
+	}
+	iv := data[headerSize : headerSize+ivSize]
+	headerSize += ivSize
+	wrappedKeySize := int(binary.BigEndian.Uint16(data[headerSize:]))
+	headerSize += 2
+	if len(data) < headerSize+wrappedKeySize {
+		return nil, errors.New("the header of the encrypted file is truncated")
+	}
+	wrappedKey := data[headerSize : headerSize+wrappedKeySize]
+	headerSize += wrappedKeySize
+	header, body := data[:headerSize], data[headerSize:]
+
+	var methodName string
+	switch method {
+	case encryptMethodIDAES256CTR:
+		methodName = EncryptMethodAES256CTR
+	case encryptMethodIDAES128GCM:
+		methodName = EncryptMethodAES128GCM
+	default:
+		return nil, errors.Errorf("unknown encrypt method id %d", method)
+	}
+	_, keySize, _ := encryptMethodID(methodName)
+	key, err := decryptionKey(ctx, conf, kmsClient, wrappedKey, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if method == encryptMethodIDAES256CTR {
+		if len(iv) != aes.BlockSize {
+			return nil, errors.Errorf("invalid IV size %d", len(iv))
+		}
+		plain := make([]byte, len(body))
+		cipher.NewCTR(block, iv).XORKeyStream(plain, body)
+		return plain, nil
+	}
+	if len(iv) != gcmNoncePrefixSize {
+		return nil, errors.Errorf("invalid nonce prefix size %d", len(iv))
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	sealedSize := encryptSegmentSize + aead.Overhead()
+	plain := make([]byte, 0, len(body))
+	for index := uint32(0); ; index++ {
+		last := len(body) <= sealedSize
+		segment := body
+		if !last {
+			segment = body[:sealedSize]
+		}
+		plain, err = aead.Open(plain, gcmSegmentNonce(iv, index, last), segment, header)
+		if err != nil {
+			return nil, errors.Annotatef(err, "segment %d fails the authentication, the key is wrong or the file is corrupted", index)
+		}
+		if last {
+			return plain, nil
+		}
+		body = body[sealedSize:]
+	}
+}
+
+func decryptionKey(ctx context.Context, conf *Config, kmsClient kmsiface.KMSAPI, wrappedKey []byte, keySize int) ([]byte, error) {
+	if len(wrappedKey) == 0 {
+		if conf.EncryptKey == "" {
+			return nil, errors.New("the file is encrypted by a key, but config.EncryptKey isn't set")
+		}
+		return decodeEncryptKey(conf.EncryptKey, keySize)
+	}
+	if kmsClient == nil {
+		return nil, errors.New("the file is encrypted by a KMS data key, but config.EncryptKMSKeyID isn't set")
+	}
+	out, err := kmsClient.DecryptWithContext(ctx, &kms.DecryptInput{
+		CiphertextBlob: wrappedKey,
+		KeyId:          aws.String(conf.EncryptKMSKeyID),
+	})
+	if err != nil {
+		return nil, errors.Annotate(err, "fail to unwrap the data key by KMS")
+	}
+	if len(out.Plaintext) != keySize {
+		return nil, errors.Errorf("the data key from KMS should be %d bytes, but it's %d bytes", keySize, len(out.Plaintext))
+	}
+	return out.Plaintext, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+// mockKMS wraps the data keys by XOR-ing them with a mask
+type mockKMS struct {
+	kmsiface.KMSAPI
+	dataKey []byte
+}
+
+func (m *mockKMS) wrap(key []byte) []byte {
+	wrapped := make([]byte, len(key))
+	for i := range key {
+		wrapped[i] = key[i] ^ 0x5a
+	}
+	return wrapped
+}
+
+func (m *mockKMS) GenerateDataKeyWithContext(_ aws.Context, input *kms.GenerateDataKeyInput, _ ...request.Option) (*kms.GenerateDataKeyOutput, error) {
+	if aws.StringValue(input.KeyId) != "alias/dump" {
+		return nil, errors.New("key not found")
+	}
+	m.dataKey = bytes.Repeat([]byte{7}, int(aws.Int64Value(input.NumberOfBytes)))
+	return &kms.GenerateDataKeyOutput{Plaintext: m.dataKey, CiphertextBlob: m.wrap(m.dataKey)}, nil
+}
+
+func (m *mockKMS) DecryptWithContext(_ aws.Context, input *kms.DecryptInput, _ ...request.Option) (*kms.DecryptOutput, error) {
+	return &kms.DecryptOutput{Plaintext: m.wrap(input.CiphertextBlob)}, nil
+}
+
+func (s *testWriterSuite) TestEncryptedStorageRoundTrip(c *C) {
+	ctx := context.Background()
+	data := []byte(strings.Repeat("INSERT INTO `t` VALUES (1,'secret');\n", 5000))
+	for _, t := range []struct {
+		method string
+		key    string
+		kmsID  string
+	}{
+		{EncryptMethodAES256CTR, strings.Repeat("ab", 32), ""},
+		{EncryptMethodAES128GCM, strings.Repeat("cd", 16), ""},
+		{EncryptMethodAES128GCM, "", "alias/dump"},
+	} {
+		comment := Commentf("method %s, kms key %s", t.method, t.kmsID)
+		conf := DefaultConfig()
+		conf.EncryptMethod, conf.EncryptKey, conf.EncryptKMSKeyID = t.method, t.key, t.kmsID
+		c.Assert(adjustEncryption(conf), IsNil)
+		raw, err := storage.NewLocalStorage(c.MkDir())
+		c.Assert(err, IsNil)
+		kmsClient := &mockKMS{}
+		encrypted, err := newEncryptedStorage(ctx, raw, conf, kmsClient)
+		c.Assert(err, IsNil)
+
+		// the empty file, a file of exactly one segment and a file of several segments written in pieces
+		for name, content := range map[string][]byte{
+			"empty.sql":   {},
+			"segment.sql": data[:encryptSegmentSize],
+			"t.000.sql":   data,
+		} {
+			w, err := encrypted.Create(ctx, name)
+			c.Assert(err, IsNil)
+			for rest := content; len(rest) > 0; {
+				n := 10000
+				if n > len(rest) {
+					n = len(rest)
+				}
+				_, err = w.Write(ctx, rest[:n])
+				c.Assert(err, IsNil)
+				rest = rest[n:]
+			}
+			c.Assert(w.Close(ctx), IsNil)
+
+			stored, err := raw.ReadFile(ctx, name)
+			c.Assert(err, IsNil)
+			c.Assert(bytes.HasPrefix(stored, []byte(encryptionMagic)), IsTrue, comment)
+			c.Assert(bytes.Contains(stored, []byte("secret")), IsFalse, comment)
+			decrypted, err := decryptFile(ctx, conf, kmsClient, stored)
+			c.Assert(err, IsNil, comment)
+			c.Assert(decrypted, DeepEquals, content, comment)
+			read, err := encrypted.ReadFile(ctx, name)
+			c.Assert(err, IsNil)
+			c.Assert(read, DeepEquals, content, comment)
+		}
+
+		c.Assert(encrypted.WriteFile(ctx, "metadata", []byte("Started dump at: 2021-06-01 00:00:00\n")), IsNil)
+		r, err := encrypted.Open(ctx, "metadata")
+		c.Assert(err, IsNil)
+		read, err := ioutil.ReadAll(r)
+		c.Assert(err, IsNil)
+		c.Assert(r.Close(), IsNil)
+		c.Assert(string(read), Equals, "Started dump at: 2021-06-01 00:00:00\n", comment)
+
+		// the files are compressed before they're encrypted
+		w, err := newCompressedStorage(encrypted, CompressGzip).Create(ctx, "t.001.sql.gz")
+		c.Assert(err, IsNil)
+		_, err = w.Write(ctx, data)
+		c.Assert(err, IsNil)
+		c.Assert(w.Close(ctx), IsNil)
+		stored, err := raw.ReadFile(ctx, "t.001.sql.gz")
+		c.Assert(err, IsNil)
+		c.Assert(len(stored) < len(data), IsTrue)
+		decrypted, err := decryptFile(ctx, conf, kmsClient, stored)
+		c.Assert(err, IsNil)
+		decompressed, err := newDecompressReader(CompressGzip, bytes.NewReader(decrypted), nil)
+		c.Assert(err, IsNil)
+		read, err = ioutil.ReadAll(decompressed)
+		c.Assert(err, IsNil)
+		c.Assert(read, DeepEquals, data, comment)
+	}
+}
+
+func (s *testWriterSuite) TestDecryptFileWithWrongKey(c *C) {
+	ctx := context.Background()
+	data := []byte(strings.Repeat("0123456789", 20000))
+	conf := DefaultConfig()
+	conf.EncryptMethod, conf.EncryptKey = EncryptMethodAES128GCM, strings.Repeat("cd", 16)
+	raw, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	encrypted, err := newEncryptedStorage(ctx, raw, conf, nil)
+	c.Assert(err, IsNil)
+	c.Assert(encrypted.WriteFile(ctx, "t.000.sql", data), IsNil)
+	stored, err := raw.ReadFile(ctx, "t.000.sql")
+	c.Assert(err, IsNil)
+
+	decrypted, err := DecryptFile(ctx, conf, stored)
+	c.Assert(err, IsNil)
+	c.Assert(decrypted, DeepEquals, data)
+
+	wrongConf := DefaultConfig()
+	wrongConf.EncryptKey = strings.Repeat("ce", 16)
+	_, err = DecryptFile(ctx, wrongConf, stored)
+	c.Assert(err, ErrorMatches, "segment 0 fails the authentication, the key is wrong or the file is corrupted.*")
+
+	// the file truncated at the end of a segment or tampered with fails the authentication too
+	headerSize := len(stored) - len(data) - 4*16
+	_, err = DecryptFile(ctx, conf, stored[:headerSize+encryptSegmentSize+16])
+	c.Assert(err, ErrorMatches, "segment 0 fails the authentication.*")
+	tampered := append([]byte{}, stored...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = DecryptFile(ctx, conf, tampered)
+	c.Assert(err, ErrorMatches, "segment 3 fails the authentication.*")
+
+	_, err = DecryptFile(ctx, conf, data)
+	c.Assert(err, ErrorMatches, "the file isn't encrypted by dumpling")
+}
+
+func (s *testConfigSuite) TestAdjustEncryption(c *C) {
+	conf := DefaultConfig()
+	c.Assert(adjustEncryption(conf), IsNil)
+	conf.EncryptKey = hex.EncodeToString(make([]byte, 16))
+	c.Assert(adjustEncryption(conf), ErrorMatches, "config.EncryptKey and config.EncryptKMSKeyID require config.EncryptMethod")
+
+	conf.EncryptMethod = "AES128-GCM"
+	c.Assert(adjustEncryption(conf), IsNil)
+	c.Assert(conf.EncryptMethod, Equals, EncryptMethodAES128GCM)
+	conf.EncryptMethod = EncryptMethodAES256CTR
+	c.Assert(adjustEncryption(conf), ErrorMatches, "config.EncryptKey should be 32 bytes for the encrypt method, but it's 16 bytes")
+	conf.EncryptKey = "not hex"
+	c.Assert(adjustEncryption(conf), ErrorMatches, "config.EncryptKey should be hex encoded.*")
+	conf.EncryptKMSKeyID = "alias/dump"
+	c.Assert(adjustEncryption(conf), ErrorMatches, "exactly one of config.EncryptKey and config.EncryptKMSKeyID should be set.*")
+	conf.EncryptMethod = "des"
+	c.Assert(adjustEncryption(conf), ErrorMatches, "unknown encrypt method 'des'.*")
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// errorReportHints are the suggestions to fix the failures of the server error codes
+var errorReportHints = map[uint16]string{
+	1040: "the server has too many connections, dump with fewer --threads or raise max_connections",
+	1044: "the user has no privilege to access the database, grant it the privileges required by Dumpling",
+	1142: "the user has no privilege to access the table, grant it the privileges required by Dumpling",
+	1205: "the query waits for a lock too long, dump with --consistency snapshot or when the tables aren't locked",
+	1227: "the user has no privilege to run the statement, grant it or dump with another --consistency",
+	1146: "the table is dropped during the dump, exclude it by the filter, skip it by --on-table-error or dump again",
+	1317: "the query is interrupted, check whether it's killed or exceeds max_execution_time",
+	8175: "the query exceeds the memory quota of TiDB, split the tables into smaller chunks by --rows or raise tidb_mem_quota_query by --params",
+	9006: "the snapshot is garbage collected, raise tikv_gc_life_time or dump with a newer --snapshot",
+}
+
+const writerErrorHint = "fail to write the output, check the space and the permissions of the output storage"
+
+// errorReport is what's written into Config.ErrorReportFile when Dump fails
+type errorReport struct {
+	Time     time.Time `json:"time"`
+	Error    string    `json:"error"`
+	Database string    `json:"database,omitempty"`
+	Table    string    `json:"table,omitempty"`
+	// ChunkIndex is null if the failure doesn't happen in a chunk
+	ChunkIndex *int   `json:"chunk_index"`
+	Query      string `json:"query,omitempty"`
+	// ServerErrorCode is 0 if the failure isn't returned by the server
+	ServerErrorCode uint16              `json:"server_error_code,omitempty"`
+	Hint            string              `json:"hint,omitempty"`
+	ServerType      string              `json:"server_type"`
+	Consistency     string              `json:"consistency"`
+	Snapshot        string              `json:"snapshot,omitempty"`
+	Progress        errorReportProgress `json:"progress"`
+}
+
+// errorReportProgress is the data written before the failure
+type errorReportProgress struct {
+	TotalTables int                `json:"total_tables"`
+	Rows        uint64             `json:"rows"`
+	Bytes       uint64             `json:"bytes"`
+	Tables      []errorReportTable `json:"tables"`
+}
+
+type errorReportTable struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Rows     uint64 `json:"rows"`
+	Bytes    uint64 `json:"bytes"`
+	Chunks   int    `json:"chunks"`
+}
+
+// chunkError is the error of dumping a chunk, it carries the chunk and the query failing to the error report
+type chunkError struct {
+	err        error
+	database   string
+	table      string
+	chunkIndex int
+	query      string
+}
+
+func (e *chunkError) Error() string {
+	return e.err.Error()
+}
+
+// Cause implements the causer of github.com/pingcap/errors
+func (e *chunkError) Cause() error {
+	return e.err
+}
+
+func (e *chunkError) Unwrap() error {
+	return e.err
+}
+
+// newChunkError wraps the error of dumping the chunk of meta by ir, the error already wrapped is returned as is
+func newChunkError(meta TableMeta, chunkIndex int, ir TableDataIR, err error) error {
+	if err == nil || findChunkError(err) != nil {
+		return err
+	}
+	e := &chunkError{err: err, database: meta.DatabaseName(), table: meta.TableName(), chunkIndex: chunkIndex}
+	if td, ok := ir.(*tableData); ok {
+		e.query = td.query
+	}
+	return e
+}
+
+func findChunkError(err error) *chunkError {
+	for err != nil {
+		if e, ok := err.(*chunkError); ok {
+			return e
+		}
+		causer, ok := err.(interface{ Cause() error })
+		if !ok {
+			return nil
+		}
+		err = causer.Cause()
+	}
+	return nil
+}
+
+func buildErrorReport(conf *Config, result DumpResult) *errorReport {
+	report := &errorReport{
+		Time:        time.Now(),
+		Error:       result.Err.Error(),
+		ServerType:  conf.ServerInfo.ServerType.String(),
+		Consistency: result.Consistency,
+		Snapshot:    result.Snapshot,
+		Progress: errorReportProgress{
+			TotalTables: result.TotalTables,
+			Rows:        result.TotalRows,
+			Bytes:       result.TotalBytes,
+			Tables:      make([]errorReportTable, 0, len(result.Tables)),
+		},
+	}
+	for _, t := range result.Tables {
+		report.Progress.Tables = append(report.Progress.Tables,
+			errorReportTable{Database: t.Database, Table: t.Table, Rows: t.Rows, Bytes: t.Bytes, Chunks: t.Chunks})
+	}
+	if e := findChunkError(result.Err); e != nil {
+		chunkIndex := e.chunkIndex
+		report.Database, report.Table, report.ChunkIndex, report.Query = e.database, e.table, &chunkIndex, e.query
+	}
+	switch cause := errors.Cause(result.Err).(type) {
+	case *mysql.MySQLError:
+		report.ServerErrorCode = cause.Number
+		report.Hint = errorReportHints[cause.Number]
+	case *writerError:
+		report.Hint = writerErrorHint
+	}
+	return report
+}
+
+// writeErrorReport writes the report of the failure of result into Config.ErrorReportFile. The failure to write
+// the report is only logged, so the error of the dump isn't hidden.
+func (d *Dumper) writeErrorReport(tctx *tcontext.Context, result DumpResult) {
+	conf := d.conf
+	data, err := json.MarshalIndent(buildErrorReport(conf, result), "", "  ")
+	if err == nil {
+		if filepath.IsAbs(conf.ErrorReportFile) {
+			err = ioutil.WriteFile(conf.ErrorReportFile, data, 0o644)
+		} else {
+			err = d.extStore.WriteFile(tctx, conf.ErrorReportFile, data)
+		}
+	}
+	if err != nil {
+		tctx.L().Warn("fail to write the error report", zap.String("file", conf.ErrorReportFile), zap.Error(err))
+		return
+	}
+	tctx.L().Info("the error report is written", zap.String("file", conf.ErrorReportFile))
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"regexp"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+func (s *testWriterSuite) TestWriteTableDataChunkError(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	writer := NewWriter(tcontext.Background().WithLogger(appLogger), 0, conf, conn, extStore)
+
+	query := "SELECT * FROM `test`.`t` WHERE (`id` >= 1 AND `id` < 51) ORDER BY `id`"
+	mock.ExpectQuery(regexp.QuoteMeta(query)).
+		WillReturnError(&mysql.MySQLError{Number: 1142, Message: "SELECT command denied to user 'u'@'%' for table 't'"})
+	meta := newMockTableIR("test", "t", nil, nil, []string{"INT"})
+	err = writer.WriteTableData(meta, newTableData(query, 1, false), 3)
+	c.Assert(err, ErrorMatches, ".*SELECT command denied.*")
+	c.Assert(errors.Cause(err), FitsTypeOf, &mysql.MySQLError{})
+	e := findChunkError(errors.Annotate(err, "dump failed"))
+	c.Assert(e, NotNil)
+	c.Assert(e.database, Equals, "test")
+	c.Assert(e.table, Equals, "t")
+	c.Assert(e.chunkIndex, Equals, 3)
+	c.Assert(e.query, Equals, query)
+	c.Assert(newChunkError(meta, 4, nil, err), Equals, err)
+}
+
+func (s *testUtilSuite) TestBuildErrorReport(c *C) {
+	conf := DefaultConfig()
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeTiDB}
+	result := DumpResult{
+		TotalTables: 2,
+		TotalRows:   10,
+		TotalBytes:  100,
+		Snapshot:    "424242",
+		Consistency: consistencyTypeSnapshot,
+		Tables:      []TableDumpResult{{Database: "test", Table: "t1", Rows: 10, Bytes: 100, Chunks: 1}},
+		Err: errors.Trace(&chunkError{
+			err:        errors.Annotate(&mysql.MySQLError{Number: 9006, Message: "GC life time is shorter than transaction duration"}, "sql: SELECT"),
+			database:   "test",
+			table:      "t2",
+			chunkIndex: 0,
+			query:      "SELECT * FROM `test`.`t2`",
+		}),
+	}
+	report := buildErrorReport(conf, result)
+	c.Assert(report.Error, Equals, "sql: SELECT: Error 9006: GC life time is shorter than transaction duration")
+	c.Assert(report.Database, Equals, "test")
+	c.Assert(report.Table, Equals, "t2")
+	c.Assert(*report.ChunkIndex, Equals, 0)
+	c.Assert(report.Query, Equals, "SELECT * FROM `test`.`t2`")
+	c.Assert(report.ServerErrorCode, Equals, uint16(9006))
+	c.Assert(report.Hint, Equals, errorReportHints[9006])
+	c.Assert(report.ServerType, Equals, "TiDB")
+	c.Assert(report.Snapshot, Equals, "424242")
+	c.Assert(report.Progress, DeepEquals, errorReportProgress{
+		TotalTables: 2,
+		Rows:        10,
+		Bytes:       100,
+		Tables:      []errorReportTable{{Database: "test", Table: "t1", Rows: 10, Bytes: 100, Chunks: 1}},
+	})
+
+	// the failure out of the chunks
+	result.Err = errors.Trace(newWriterError(errors.New("disk full")))
+	report = buildErrorReport(conf, result)
+	c.Assert(report.ChunkIndex, IsNil)
+	c.Assert(report.Query, Equals, "")
+	c.Assert(report.ServerErrorCode, Equals, uint16(0))
+	c.Assert(report.Hint, Equals, writerErrorHint)
+}
+
+func (s *testUtilSuite) TestWriteErrorReport(c *C) {
+	dir, localDir := c.MkDir(), c.MkDir()
+	conf := DefaultConfig()
+	conf.OutputDirPath = dir
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	d := &Dumper{conf: conf, extStore: extStore}
+	result := DumpResult{Err: errors.New("dump failed")}
+
+	for _, file := range []string{"error-report.json", path.Join(localDir, "error-report.json")} {
+		conf.ErrorReportFile = file
+		d.writeErrorReport(tcontext.Background(), result)
+		if !path.IsAbs(file) {
+			file = path.Join(dir, file)
+		}
+		data, err := ioutil.ReadFile(file)
+		c.Assert(err, IsNil)
+		var report map[string]interface{}
+		c.Assert(json.Unmarshal(data, &report), IsNil)
+		c.Assert(report["error"], Equals, "dump failed")
+		c.Assert(report["chunk_index"], IsNil)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+// fifoFileHeader precedes the content of every file in the FIFO, so the reader can split the stream into the files
+const fifoFileHeader = "-- dumpling file: %s\n"
+
+// adjustOutputFIFO forces the dump to be written sequentially if the output is a FIFO,
+// and rejects the options which re-write the files or need the output directory
+func adjustOutputFIFO(conf *Config) error {
+	if conf.OutputFIFO == "" {
+		return nil
+	}
+	switch {
+	case conf.CompressType != CompressNone:
+		return errors.New("--output-fifo can't be used with --compress")
+	case conf.ServerSideDump:
+		return errors.New("--output-fifo can't be used with --server-side-dump")
+	case conf.ChunkTimeout > 0:
+		return errors.New("--output-fifo can't be used with --chunk-timeout")
+	case conf.FileMode != 0:
+		return errors.New("--output-fifo can't be used with --file-mode")
+	case conf.MinFreeSpace > 0:
+		return errors.New("--output-fifo can't be used with --min-free-space")
+	}
+	conf.Threads = 1
+	return nil
+}
+
+// fifoStorage is an ExternalStorage which writes all the files into a FIFO one after another.
+// A FIFO can't seek or be re-opened, so the files are serialized, and can't be read or re-written.
+type fifoStorage struct {
+	path string
+	// mu is held from creating a file until closing it, so the files don't interleave
+	mu   sync.Mutex
+	file *os.File
+	buf  *bufio.Writer
+}
+
+// openFIFOStorage opens the pre-created FIFO, it blocks until the FIFO is opened by the reader
+func openFIFOStorage(path string) (*fifoStorage, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "fail to stat output FIFO %s", path)
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		return nil, errors.Errorf("output FIFO %s isn't a named pipe, please create it by mkfifo", path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, errors.Annotatef(err, "fail to open output FIFO %s", path)
+	}
+	return &fifoStorage{path: path, file: f, buf: bufio.NewWriter(f)}, nil
+}
+
+func (s *fifoStorage) writeHeader(name string) error {
+	_, err := fmt.Fprintf(s.buf, fifoFileHeader, name)
+	return errors.Trace(err)
+}
+
+// WriteFile implements ExternalStorage.WriteFile
+func (s *fifoStorage) WriteFile(_ context.Context, name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.writeHeader(name); err != nil {
+		return err
+	}
+	if _, err := s.buf.Write(data); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.buf.Flush())
+}
+
+// ReadFile implements ExternalStorage.ReadFile
+func (s *fifoStorage) ReadFile(_ context.Context, name string) ([]byte, error) {
+	return nil, errors.Errorf("can't read %s from output FIFO", name)
+}
+
+// FileExists implements ExternalStorage.FileExists
+func (s *fifoStorage) FileExists(_ context.Context, name string) (bool, error) {
+	return false, errors.Errorf("can't check whether %s exists in output FIFO", name)
+}
+
+// Open implements ExternalStorage.Open
+func (s *fifoStorage) Open(_ context.Context, name string) (storage.ExternalFileReader, error) {
+	return nil, errors.Errorf("can't open %s from output FIFO", name)
+}
+
+// WalkDir implements ExternalStorage.WalkDir
+func (s *fifoStorage) WalkDir(_ context.Context, _ *storage.WalkOption, _ func(path string, size int64) error) error {
+	return errors.New("can't walk output FIFO")
+}
+
+// URI implements ExternalStorage.URI
+func (s *fifoStorage) URI() string {
+	return s.path
+}
+
+// Create implements ExternalStorage.Create. The other files can't be written until the returned writer is closed.
+func (s *fifoStorage) Create(_ context.Context, name string) (storage.ExternalFileWriter, error) {
+	s.mu.Lock()
+	if err := s.writeHeader(name); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return &fifoFileWriter{storage: s}, nil
+}
+
+func (s *fifoStorage) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.buf.Flush(); err != nil {
+		s.file.Close()
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.file.Close())
+}
+
+type fifoFileWriter struct {
+	storage *fifoStorage
+	closed  bool
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *fifoFileWriter) Write(_ context.Context, p []byte) (int, error) {
+	n, err := w.storage.buf.Write(p)
+	return n, errors.Trace(err)
+}
+
+// Close implements ExternalFileWriter.Close
+func (w *fifoFileWriter) Close(_ context.Context) error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.storage.mu.Unlock()
+	return errors.Trace(w.storage.buf.Flush())
+}
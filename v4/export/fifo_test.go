@@ -0,0 +1,75 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+//go:build !windows
+// +build !windows
+
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestAdjustOutputFIFO(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustOutputFIFO(conf), IsNil)
+	c.Assert(conf.Threads, Equals, 4)
+
+	conf.OutputFIFO = "/tmp/dumpling.fifo"
+	c.Assert(adjustOutputFIFO(conf), IsNil)
+	c.Assert(conf.Threads, Equals, 1)
+
+	conf.CompressType = CompressGzip
+	c.Assert(adjustOutputFIFO(conf), ErrorMatches, ".*can't be used with --compress")
+}
+
+func (s *testWriterSuite) TestFIFOStorage(c *C) {
+	dir := c.MkDir()
+	_, err := openFIFOStorage(dir)
+	c.Assert(err, ErrorMatches, ".*isn't a named pipe.*")
+
+	fifoPath := path.Join(dir, "dumpling.fifo")
+	c.Assert(syscall.Mkfifo(fifoPath, 0o600), IsNil)
+	type result struct {
+		data []byte
+		err  error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		f, err := os.Open(fifoPath)
+		if err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		defer f.Close()
+		data, err := ioutil.ReadAll(f)
+		resultCh <- result{data: data, err: err}
+	}()
+
+	fifo, err := openFIFOStorage(fifoPath)
+	c.Assert(err, IsNil)
+	ctx := context.Background()
+	c.Assert(fifo.WriteFile(ctx, "test-schema-create.sql", []byte("CREATE DATABASE `test`;\n")), IsNil)
+	w, err := fifo.Create(ctx, "test.t.000000000.sql")
+	c.Assert(err, IsNil)
+	_, err = w.Write(ctx, []byte("INSERT INTO `t` VALUES\n"))
+	c.Assert(err, IsNil)
+	_, err = w.Write(ctx, []byte("(1);\n"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(ctx), IsNil)
+	_, err = fifo.ReadFile(ctx, "metadata")
+	c.Assert(err, NotNil)
+	c.Assert(fifo.close(), IsNil)
+
+	res := <-resultCh
+	c.Assert(res.err, IsNil)
+	c.Assert(string(res.data), Equals, "-- dumpling file: test-schema-create.sql\n"+
+		"CREATE DATABASE `test`;\n"+
+		"-- dumpling file: test.t.000000000.sql\n"+
+		"INSERT INTO `t` VALUES\n(1);\n")
+}
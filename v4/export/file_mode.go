@@ -0,0 +1,92 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+// ParseFileMode parses the octal permission of the output files, such as `0600`
+func ParseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode == 0 || mode > 0o777 {
+		return 0, errors.Errorf("file mode `%s` should be an octal permission between 0001 and 0777, such as 0600", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// fileModeStorage is an ExternalStorage on the local file system which creates the files with the given permission.
+// The permission is set before any data is written, and isn't affected by the umask.
+type fileModeStorage struct {
+	storage.ExternalStorage
+
+	dir  string
+	mode os.FileMode
+}
+
+func newFileModeStorage(s storage.ExternalStorage, dir string, mode os.FileMode) *fileModeStorage {
+	return &fileModeStorage{ExternalStorage: s, dir: dir, mode: mode}
+}
+
+func (s *fileModeStorage) openFile(name string) (*os.File, error) {
+	path := filepath.Join(s.dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, s.mode)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// the file may exist before, or the mode is masked by the umask
+	if err = f.Chmod(s.mode); err != nil {
+		f.Close()
+		return nil, errors.Annotatef(err, "fail to change the mode of %s", path)
+	}
+	return f, nil
+}
+
+// WriteFile implements ExternalStorage.WriteFile
+func (s *fileModeStorage) WriteFile(_ context.Context, name string, data []byte) error {
+	f, err := s.openFile(name)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.Close())
+}
+
+// Create implements ExternalStorage.Create
+func (s *fileModeStorage) Create(_ context.Context, name string) (storage.ExternalFileWriter, error) {
+	f, err := s.openFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &localFileWriter{file: f, buf: bufio.NewWriter(f)}, nil
+}
+
+// localFileWriter is a buffered ExternalFileWriter of a local file
+type localFileWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *localFileWriter) Write(_ context.Context, p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+// Close implements ExternalFileWriter.Close
+func (w *localFileWriter) Close(_ context.Context) error {
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return errors.Trace(err)
+	}
+	return errors.Trace(w.file.Close())
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testFileModeSuite{})
+
+type testFileModeSuite struct{}
+
+func (s *testFileModeSuite) TestParseFileMode(c *C) {
+	mode, err := ParseFileMode("0600")
+	c.Assert(err, IsNil)
+	c.Assert(mode, Equals, os.FileMode(0o600))
+	mode, err = ParseFileMode("640")
+	c.Assert(err, IsNil)
+	c.Assert(mode, Equals, os.FileMode(0o640))
+
+	for _, spec := range []string{"0", "0800", "1777", "rw-------", "-600"} {
+		_, err = ParseFileMode(spec)
+		c.Assert(err, ErrorMatches, "file mode `.*` should be an octal permission between 0001 and 0777, such as 0600", Commentf("spec %s", spec))
+	}
+}
+
+func (s *testFileModeSuite) TestFileModeStorage(c *C) {
+	dir := c.MkDir()
+	conf := DefaultConfig()
+	conf.OutputDirPath = dir
+	conf.FileMode = 0o600
+	conf.EmitChecksums = true
+	d := &Dumper{tctx: tcontext.Background().WithLogger(appLogger), conf: conf}
+	c.Assert(createExternalStore(d), IsNil)
+
+	ctx := context.Background()
+	// the permission is also set on the existing files
+	c.Assert(ioutil.WriteFile(path.Join(dir, "metadata"), []byte("old"), 0o644), IsNil)
+	c.Assert(d.extStore.WriteFile(ctx, "metadata", []byte("meta")), IsNil)
+	w, err := storage.WithCompression(d.extStore, storage.Gzip).Create(ctx, "test.t.000000000.sql.gz")
+	c.Assert(err, IsNil)
+	_, err = w.Write(ctx, []byte("INSERT INTO `t` VALUES\n(1);\n"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(ctx), IsNil)
+	c.Assert(d.checksums.writeChecksums(ctx), IsNil)
+
+	for _, name := range []string{"metadata", "test.t.000000000.sql.gz", checksumsFileName} {
+		info, err := os.Stat(path.Join(dir, name))
+		c.Assert(err, IsNil)
+		c.Assert(info.Mode().Perm(), Equals, os.FileMode(0o600), Commentf("file %s", name))
+	}
+	data, err := ioutil.ReadFile(path.Join(dir, "metadata"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "meta")
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/docker/go-units"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+const freeSpaceCheckInterval = 10 * time.Second
+
+// localOutputDir returns the output directory if it's on the local file system, otherwise returns ""
+func localOutputDir(conf *Config) (string, error) {
+	if isHDFSURL(conf.OutputDirPath) {
+		return "", nil
+	}
+	b, err := storage.ParseBackend(conf.OutputDirPath, &conf.BackendOptions)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if local := b.GetLocal(); local != nil {
+		return local.Path, nil
+	}
+	return "", nil
+}
+
+// outputLocation returns the location of the dump for the tools loading it, it's the absolute path
+// of the output directory if it's on the local file system, otherwise it's the URI of the storage
+func outputLocation(conf *Config) (string, error) {
+	dir, err := localOutputDir(conf)
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		return conf.OutputDirPath, nil
+	}
+	dir, err = filepath.Abs(dir)
+	return dir, errors.Trace(err)
+}
+
+// checkFreeSpace returns an error if the free space of the file system where dir is on is less than minFreeSpace
+func checkFreeSpace(dir string, minFreeSpace uint64) error {
+	free, err := getFreeSpace(dir)
+	if err != nil {
+		return errors.Annotatef(err, "fail to get the free space of %s", dir)
+	}
+	if free < minFreeSpace {
+		return errors.Errorf("free space of %s is %s, less than the minimum free space %s",
+			dir, units.BytesSize(float64(free)), units.BytesSize(float64(minFreeSpace)))
+	}
+	return nil
+}
+
+// monitorFreeSpace checks the free space of the local output directory periodically,
+// and aborts the dump when it drops below conf.MinFreeSpace.
+func (d *Dumper) monitorFreeSpace(tctx *tcontext.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := checkFreeSpace(d.freeSpaceDir, d.conf.MinFreeSpace); err != nil {
+			tctx.L().Error("abort dumping because of insufficient free space", zap.Error(err))
+			d.abort(err)
+			return
+		}
+	}
+}
+
+// removePartialFile removes the data file which fails to be written completely on the local file system
+func (w *Writer) removePartialFile(fileName string) {
+	if w.freeSpaceDir == "" {
+		return
+	}
+	filePath := filepath.Join(w.freeSpaceDir, fileName+compressFileSuffix(w.conf.CompressType))
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		w.tctx.L().Warn("fail to remove partial file", zap.String("path", filePath), zap.Error(err))
+		return
+	}
+	w.tctx.L().Info("removed partial file", zap.String("path", filePath))
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql/driver"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+func (s *testWriterSuite) TestCheckFreeSpace(c *C) {
+	dir := c.MkDir()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = dir
+	localDir, err := localOutputDir(conf)
+	c.Assert(err, IsNil)
+	c.Assert(localDir, Equals, dir)
+	conf.OutputDirPath = "s3://bucket/prefix"
+	localDir, err = localOutputDir(conf)
+	c.Assert(err, IsNil)
+	c.Assert(localDir, Equals, "")
+
+	c.Assert(checkFreeSpace(dir, 1), IsNil)
+	c.Assert(checkFreeSpace(dir, math.MaxUint64), ErrorMatches, "free space of .* is .*, less than the minimum free space .*")
+
+	// the monitor aborts the dump when the free space is insufficient
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conf.MinFreeSpace = math.MaxUint64
+	d := &Dumper{tctx: tctx, conf: conf, cancelCtx: cancel, freeSpaceDir: dir}
+	done := make(chan struct{})
+	go func() {
+		d.monitorFreeSpace(tctx, 10*time.Millisecond)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("dump is not aborted")
+	}
+	c.Assert(d.abortError(), ErrorMatches, "free space of .*")
+	c.Assert(tctx.Err(), Equals, context.Canceled)
+}
+
+func (s *testWriterSuite) TestWriteTableDataWithMinFreeSpace(c *C) {
+	dir := c.MkDir()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = dir
+	conf.MinFreeSpace = math.MaxUint64
+	writer := s.newWriter(conf, c)
+	writer.freeSpaceDir = dir
+
+	data := [][]driver.Value{{"1"}}
+	tableIR := newMockTableIR("test", "t", data, nil, []string{"INT"})
+	err := writer.WriteTableData(tableIR, tableIR, 0)
+	c.Assert(err, ErrorMatches, "free space of .*")
+	c.Assert(errors.Cause(err), FitsTypeOf, &writerError{})
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+
+	// the partial file is removed
+	c.Assert(ioutil.WriteFile(path.Join(dir, "test.t.000000000.sql"), []byte("INSERT"), 0o644), IsNil)
+	writer.removePartialFile("test.t.000000000.sql")
+	_, err = os.Stat(path.Join(dir, "test.t.000000000.sql"))
+	c.Assert(os.IsNotExist(err), IsTrue)
+}
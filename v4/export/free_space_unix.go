@@ -0,0 +1,16 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+//go:build !windows
+// +build !windows
+
+package export
+
+import "syscall"
+
+func getFreeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,9 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import "github.com/pingcap/errors"
+
+func getFreeSpace(string) (uint64, error) {
+	return 0, errors.New("checking free space isn't supported on windows")
+}
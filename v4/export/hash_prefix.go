@@ -0,0 +1,60 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pingcap/errors"
+)
+
+// hashPrefixWidth is the minimum number of digits of the hashed prefixes
+const hashPrefixWidth = 3
+
+// hashPrefix returns the prefix of the bucket of fileName in prefixes, like `003`
+func hashPrefix(fileName string, prefixes int) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(fileName))
+	return fmt.Sprintf("%0*d", hashPrefixDigits(prefixes), h.Sum32()%uint32(prefixes))
+}
+
+func hashPrefixDigits(prefixes int) int {
+	if digits := len(strconv.Itoa(prefixes - 1)); digits > hashPrefixWidth {
+		return digits
+	}
+	return hashPrefixWidth
+}
+
+// hashPrefixedName puts fileName under the hashed prefix of its name with Config.HashPrefixFiles,
+// so the keys of the data files are spread across the prefixes of the object storage.
+// It returns fileName itself if prefixes is 0.
+func hashPrefixedName(fileName string, prefixes int) string {
+	if prefixes <= 0 {
+		return fileName
+	}
+	return hashPrefix(fileName, prefixes) + "/" + fileName
+}
+
+// createHashPrefixDirs is an initialization step of Dumper.
+// The local storage doesn't create the directories of the files, so all the hashed prefixes are created ahead.
+func createHashPrefixDirs(d *Dumper) error {
+	conf := d.conf
+	if conf.HashPrefixFiles <= 0 {
+		return nil
+	}
+	dir, err := localOutputDir(conf)
+	if err != nil || dir == "" {
+		return err
+	}
+	digits := hashPrefixDigits(conf.HashPrefixFiles)
+	for i := 0; i < conf.HashPrefixFiles; i++ {
+		if err = os.MkdirAll(filepath.Join(dir, fmt.Sprintf("%0*d", digits, i)), 0o755); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"os"
+	"path"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestHashPrefixedName(c *C) {
+	c.Assert(hashPrefixedName("test.t.000000000.sql", 0), Equals, "test.t.000000000.sql")
+	name := hashPrefixedName("test.t.000000000.sql", 16)
+	c.Assert(name, Matches, `0(0[0-9]|1[0-5])/test\.t\.000000000\.sql`)
+	c.Assert(hashPrefixedName("test.t.000000000.sql", 16), Equals, name)
+	c.Assert(hashPrefixedName("test.t.000000000.sql", 1), Equals, "000/test.t.000000000.sql")
+	c.Assert(hashPrefixedName("test.t.000000000.sql", 10000), Matches, `[0-9]{4}/test\.t\.000000000\.sql`)
+
+	// the files are spread across the prefixes
+	prefixes := make(map[string]struct{})
+	for i := 0; i < 64; i++ {
+		namer := &outputFileNamer{DB: "test", Table: "t", ChunkIndex: i, format: "%09[1]d", hashPrefixes: 4}
+		name, err := namer.NextName(DefaultOutputFileTemplate, "sql")
+		c.Assert(err, IsNil)
+		prefixes[path.Dir(name)] = struct{}{}
+	}
+	c.Assert(prefixes, HasLen, 4)
+}
+
+func (s *testWriterSuite) TestWriteTableDataWithHashPrefix(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.HashPrefixFiles = 4
+	c.Assert(createHashPrefixDirs(&Dumper{conf: conf}), IsNil)
+	for _, prefix := range []string{"000", "001", "002", "003"} {
+		info, err := os.Stat(path.Join(conf.OutputDirPath, prefix))
+		c.Assert(err, IsNil)
+		c.Assert(info.IsDir(), IsTrue)
+	}
+
+	writer := s.newWriter(conf, c)
+	writer.catalog = newCatalogRecorder()
+	data := [][]driver.Value{{"1"}, {"2"}}
+	tableIR := newMockTableIR("test", "t", data, nil, []string{"INT"})
+	c.Assert(writer.writeTableData(tableIR, tableIR, 0, ""), IsNil)
+
+	// the catalog records the actual path of the data file
+	fileName := hashPrefixedName("test.t.000000000.sql", 4)
+	c.Assert(writer.catalog.tables["test"]["t"].Files, DeepEquals, []string{fileName})
+	_, err := os.Stat(path.Join(conf.OutputDirPath, fileName))
+	c.Assert(err, IsNil)
+}
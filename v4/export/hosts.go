@@ -0,0 +1,72 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// hostPingTimeout is the timeout to check whether a host candidate is reachable
+const hostPingTimeout = 10 * time.Second
+
+// splitHostPort splits a host candidate in the format of `host` or `host:port`,
+// the port is defaultPort if it's not specified
+func splitHostPort(candidate string, defaultPort int) (string, int, error) {
+	candidate = strings.TrimSpace(candidate)
+	host, portStr, err := net.SplitHostPort(candidate)
+	if err != nil {
+		// no port is specified
+		host = strings.Trim(candidate, "[]")
+		if host == "" {
+			return "", 0, errors.Errorf("host `%s` should be in the format of host or host:port", candidate)
+		}
+		return host, defaultPort, nil
+	}
+	if host == "" {
+		return "", 0, errors.Errorf("host `%s` should be in the format of host or host:port", candidate)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, errors.Errorf("port of host `%s` should be an integer between 1 and 65535", candidate)
+	}
+	return host, port, nil
+}
+
+// openFirstReachableHost tries the hosts of conf.Hosts in order, and returns the pool of the first reachable one.
+// conf.Host and conf.Port are set to the chosen host, so the other connections are made to the same host.
+func openFirstReachableHost(tctx *tcontext.Context, conf *Config) (*sql.DB, error) {
+	var lastErr error
+	defaultPort := conf.Port
+	for _, candidate := range conf.Hosts {
+		host, port, err := splitHostPort(candidate, defaultPort)
+		if err != nil {
+			return nil, err
+		}
+		conf.Host, conf.Port = host, port
+		pool, err := sql.Open("mysql", conf.GetDSN(""))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		ctx, cancel := context.WithTimeout(tctx, hostPingTimeout)
+		err = pool.PingContext(ctx)
+		cancel()
+		if err == nil {
+			tctx.L().Info("connect to host", zap.String("host", host), zap.Int("port", port))
+			return pool, nil
+		}
+		tctx.L().Warn("host is unreachable, try the next one", zap.String("host", host), zap.Int("port", port), zap.Error(err))
+		pool.Close()
+		lastErr = err
+	}
+	return nil, errors.Annotatef(lastErr, "none of the hosts %s is reachable", strings.Join(conf.Hosts, ","))
+}
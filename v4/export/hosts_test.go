@@ -0,0 +1,54 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+	"net"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testConfigSuite) TestSplitHostPort(c *C) {
+	for _, testCase := range []struct {
+		candidate string
+		host      string
+		port      int
+	}{
+		{"10.0.0.1", "10.0.0.1", 4000},
+		{"10.0.0.1:3306", "10.0.0.1", 3306},
+		{" db.example.com:3307 ", "db.example.com", 3307},
+		{"::1", "::1", 4000},
+		{"[::1]", "::1", 4000},
+		{"[::1]:3306", "::1", 3306},
+	} {
+		host, port, err := splitHostPort(testCase.candidate, 4000)
+		c.Assert(err, IsNil, Commentf("candidate %s", testCase.candidate))
+		c.Assert(host, Equals, testCase.host)
+		c.Assert(port, Equals, testCase.port)
+	}
+
+	for _, candidate := range []string{"", ":3306", "10.0.0.1:", "10.0.0.1:port", "10.0.0.1:0", "10.0.0.1:65536"} {
+		_, _, err := splitHostPort(candidate, 4000)
+		c.Assert(err, NotNil, Commentf("candidate %s", candidate))
+	}
+}
+
+func (s *testConfigSuite) TestOpenFirstReachableHost(c *C) {
+	// get the ports which refuse the connections
+	var closedAddrs []string
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		c.Assert(err, IsNil)
+		closedAddrs = append(closedAddrs, l.Addr().String())
+		c.Assert(l.Close(), IsNil)
+	}
+
+	conf := DefaultConfig()
+	conf.Hosts = closedAddrs
+	_, err := openFirstReachableHost(tcontext.Background().WithLogger(appLogger), conf)
+	c.Assert(err, ErrorMatches, "none of the hosts "+closedAddrs[0]+","+closedAddrs[1]+" is reachable.*")
+	c.Assert(net.JoinHostPort(conf.Host, fmt.Sprint(conf.Port)), Equals, closedAddrs[1])
+}
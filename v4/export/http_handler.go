@@ -3,6 +3,8 @@
 package export
 
 import (
+	"encoding/json"
+	"math"
 	"net"
 	"net/http"
 	"net/http/pprof"
@@ -12,6 +14,7 @@ import (
 	tcontext "github.com/pingcap/dumpling/v4/context"
 
 	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/soheilhy/cmux"
 	"go.uber.org/zap"
@@ -19,9 +22,13 @@ import (
 
 var cmuxReadTimeout = 10 * time.Second
 
-func startHTTPServer(tctx *tcontext.Context, lis net.Listener) {
+func startHTTPServer(tctx *tcontext.Context, lis net.Listener, d *Dumper) {
 	router := http.NewServeMux()
 	router.Handle("/metrics", promhttp.Handler())
+	router.HandleFunc("/pause", d.handlePause)
+	router.HandleFunc("/resume", d.handleResume)
+	router.HandleFunc("/progress", d.handleProgress)
+	router.HandleFunc("/status", d.handleStatus)
 
 	router.HandleFunc("/debug/pprof/", pprof.Index)
 	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
@@ -39,7 +46,7 @@ func startHTTPServer(tctx *tcontext.Context, lis net.Listener) {
 	}
 }
 
-func startDumplingService(tctx *tcontext.Context, addr string) error {
+func startDumplingService(tctx *tcontext.Context, addr string, d *Dumper) error {
 	rootLis, err := net.Listen("tcp", addr)
 	if err != nil {
 		return errors.Annotate(err, "start listening")
@@ -50,7 +57,7 @@ func startDumplingService(tctx *tcontext.Context, addr string) error {
 	m.SetReadTimeout(cmuxReadTimeout) // set a timeout, ref: https://github.com/pingcap/tidb-binlog/pull/352
 
 	httpL := m.Match(cmux.HTTP1Fast())
-	go startHTTPServer(tctx, httpL)
+	go startHTTPServer(tctx, httpL, d)
 
 	err = m.Serve() // start serving, block
 	if err != nil && isErrNetClosing(err) {
@@ -59,6 +66,157 @@ func startDumplingService(tctx *tcontext.Context, addr string) error {
 	return err
 }
 
+// dumpProgress is the response body of the /progress API.
+// EstimateTotalRows is null if the rows aren't estimated, and UploadConcurrency is null if the uploads aren't limited.
+// ReplicaLagSeconds is null if the replication lag isn't checked or the replication isn't running.
+// ActiveWriters is null if the writers aren't scaled by the memory in use.
+type dumpProgress struct {
+	Paused            bool     `json:"paused"`
+	FinishedTables    float64  `json:"finished_tables"`
+	TotalTables       int      `json:"total_tables"`
+	FinishedRows      float64  `json:"finished_rows"`
+	EstimateTotalRows *float64 `json:"estimate_total_rows"`
+	FinishedBytes     float64  `json:"finished_bytes"`
+	UploadConcurrency *int64   `json:"upload_concurrency"`
+	ReplicaLagSeconds *int64   `json:"replica_lag_seconds"`
+	ReplicaLagPaused  bool     `json:"replica_lag_paused"`
+	ActiveWriters     *int     `json:"active_writers"`
+}
+
+// tableStatus is the progress of the chunks of a table in the response body of the /status API.
+// TotalChunks grows while the table is being split, it's the total chunks of the split if they're known before.
+// EstimateRows is null if the rows aren't estimated.
+type tableStatus struct {
+	Database       string  `json:"database"`
+	Table          string  `json:"table"`
+	TotalChunks    int     `json:"total_chunks"`
+	FinishedChunks int     `json:"finished_chunks"`
+	InFlightChunks []int   `json:"in_flight_chunks"`
+	EstimateRows   *uint64 `json:"estimate_rows"`
+}
+
+// dumpStatus is the response body of the /status API.
+// The throughput is measured since the first chunk is sent. ETASeconds is estimated by the rows left if the rows are
+// estimated, or by the chunks left otherwise, and it's null before any progress is made.
+type dumpStatus struct {
+	dumpProgress
+	FinishedChunks int           `json:"finished_chunks"`
+	TotalChunks    int           `json:"total_chunks"`
+	RowsPerSecond  float64       `json:"rows_per_second"`
+	ETASeconds     *float64      `json:"eta_seconds"`
+	Tables         []tableStatus `json:"tables"`
+}
+
+// handlePause stops the writers from picking up new tasks. Tasks being written won't be interrupted.
+func (d *Dumper) handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if d.pauseCtl.Pause() {
+		d.L().Info("dump is paused by http request")
+	}
+	d.writeProgress(w)
+}
+
+// handleResume resumes the paused writers.
+func (d *Dumper) handleResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if d.pauseCtl.Resume() {
+		d.L().Info("dump is resumed by http request")
+	}
+	d.writeProgress(w)
+}
+
+func (d *Dumper) handleProgress(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	d.writeProgress(w)
+}
+
+// handleStatus reports the progress of each table with the chunks being written, and the ETA of the dump
+func (d *Dumper) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	status := dumpStatus{dumpProgress: d.readDumpProgress(), Tables: d.progress.tableStatuses()}
+	if status.Tables == nil {
+		status.Tables = []tableStatus{}
+	}
+	status.FinishedChunks, status.TotalChunks = d.progress.chunkCounts()
+	if since, ok := d.progress.throughputSince(); ok {
+		seconds := time.Since(since).Seconds()
+		status.RowsPerSecond = status.FinishedRows / seconds
+		var eta float64
+		switch {
+		case status.EstimateTotalRows != nil && status.FinishedRows > 0:
+			eta = math.Max(*status.EstimateTotalRows-status.FinishedRows, 0) / status.RowsPerSecond
+			status.ETASeconds = &eta
+		case status.EstimateTotalRows == nil && status.FinishedChunks > 0:
+			eta = float64(status.TotalChunks-status.FinishedChunks) / (float64(status.FinishedChunks) / seconds)
+			status.ETASeconds = &eta
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		d.L().Warn("fail to write status response", zap.Error(err))
+	}
+}
+
+func (d *Dumper) writeProgress(w http.ResponseWriter) {
+	progress := d.readDumpProgress()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(progress); err != nil {
+		d.L().Warn("fail to write progress response", zap.Error(err))
+	}
+}
+
+// readDumpProgress reads the progress of the dump for the /progress API
+func (d *Dumper) readDumpProgress() dumpProgress {
+	labels := d.conf.Labels
+	progress := dumpProgress{
+		Paused:         d.pauseCtl.IsPaused(),
+		FinishedTables: readCounterOrZero(finishedTablesCounter, labels),
+		TotalTables:    calculateTableCount(d.conf.Tables),
+		FinishedRows:   readCounterOrZero(finishedRowsCounter, labels),
+		FinishedBytes:  readCounterOrZero(finishedSizeCounter, labels),
+	}
+	if !d.conf.SkipEstimate {
+		estimateTotalRows := readCounterOrZero(estimateTotalRowsCounter, labels)
+		progress.EstimateTotalRows = &estimateTotalRows
+	}
+	if d.uploads != nil {
+		uploadConcurrency := d.uploads.concurrency()
+		progress.UploadConcurrency = &uploadConcurrency
+	}
+	if d.replicaLag != nil {
+		if lag, ok := d.replicaLag.currentLag(); ok {
+			progress.ReplicaLagSeconds = &lag
+		}
+		progress.ReplicaLagPaused = d.replicaLag.pauseCtl.IsPaused()
+	}
+	if d.threads != nil {
+		activeWriters := d.threads.activeWriters()
+		progress.ActiveWriters = &activeWriters
+	}
+	return progress
+}
+
+// readCounterOrZero is like ReadCounter but returns 0 instead of NaN, which can't be encoded as json.
+func readCounterOrZero(counterVec *prometheus.CounterVec, labels prometheus.Labels) float64 {
+	v := ReadCounter(counterVec, labels)
+	if math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
+
 var useOfClosedErrMsg = "use of closed network connection"
 
 // isErrNetClosing checks whether is an ErrNetClosing error
@@ -0,0 +1,34 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"strings"
+)
+
+// quoteIdentifier quotes name in style, which is one of the Config.IdentifierQuote values
+func quoteIdentifier(style, name string) string {
+	switch style {
+	case IdentifierQuoteDouble:
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	case IdentifierQuoteNone:
+		return name
+	default:
+		return wrapBackTicks(escapeString(name))
+	}
+}
+
+// requoteIdentifiers rewrites the backtick quoted identifiers in stmt, e.g. from SHOW CREATE TABLE, into style.
+// The string literals and comments in quotes are kept as they are.
+func requoteIdentifiers(style, stmt string) string {
+	if style == "" || style == IdentifierQuoteBacktick {
+		return stmt
+	}
+	return quotedLiteralPattern.ReplaceAllStringFunc(stmt, func(literal string) string {
+		if literal[0] != '`' {
+			return literal
+		}
+		name := strings.ReplaceAll(literal[1:len(literal)-1], "``", "`")
+		return quoteIdentifier(style, name)
+	})
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"io/ioutil"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestQuoteIdentifier(c *C) {
+	c.Assert(quoteIdentifier(IdentifierQuoteBacktick, "a`b"), Equals, "`a``b`")
+	c.Assert(quoteIdentifier(IdentifierQuoteDouble, `a"b`), Equals, `"a""b"`)
+	c.Assert(quoteIdentifier(IdentifierQuoteNone, "ab"), Equals, "ab")
+
+	createTableSQL := "CREATE TABLE `t``1` (\n" +
+		"  `id` int(11) NOT NULL COMMENT 'the `id`',\n" +
+		"  `na\"me` varchar(20) DEFAULT 'it''s',\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB"
+	c.Assert(requoteIdentifiers(IdentifierQuoteBacktick, createTableSQL), Equals, createTableSQL)
+	c.Assert(requoteIdentifiers(IdentifierQuoteDouble, createTableSQL), Equals, "CREATE TABLE \"t`1\" (\n"+
+		"  \"id\" int(11) NOT NULL COMMENT 'the `id`',\n"+
+		"  \"na\"\"me\" varchar(20) DEFAULT 'it''s',\n"+
+		"  PRIMARY KEY (\"id\")\n"+
+		") ENGINE=InnoDB")
+	c.Assert(requoteIdentifiers(IdentifierQuoteNone, "`a`,`b`"), Equals, "a,b")
+}
+
+func (s *testUtilSuite) TestWriteInsertWithIdentifierQuote(c *C) {
+	data := [][]driver.Value{
+		{"1", "bob"},
+	}
+	tableIR := newMockTableIR("test", "employee", data, nil, []string{"INT", "VARCHAR"})
+	tableIR.selectedField = "(`id`,`name`)"
+	bf := storage.NewBufferWriter()
+
+	conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+	conf.IdentifierQuote = IdentifierQuoteDouble
+	n, err := WriteInsert(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(n, Equals, uint64(1))
+	c.Assert(err, IsNil)
+	c.Assert(bf.String(), Equals, "INSERT INTO \"employee\" (\"id\",\"name\") VALUES\n(1,'bob');\n")
+}
+
+func (s *testWriterSuite) TestWriteTableMetaWithIdentifierQuote(c *C) {
+	dir := c.MkDir()
+
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = dir
+	config.IdentifierQuote = IdentifierQuoteNone
+
+	writer := s.newWriter(config, c)
+	err := writer.WriteTableMeta("test", "t", "CREATE TABLE `t` (`a` INT)")
+	c.Assert(err, IsNil)
+	bytes, err := ioutil.ReadFile(path.Join(dir, "test.t-schema.sql"))
+	c.Assert(err, IsNil)
+	c.Assert(string(bytes), Equals, "/*!40101 SET NAMES binary*/;\nCREATE TABLE t (a INT);\n")
+}
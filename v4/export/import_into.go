@@ -0,0 +1,147 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+const importIntoPath = "import-into.sql"
+
+// importIntoVersion is the first TiDB version supporting `IMPORT INTO`
+var importIntoVersion = semver.New("7.2.0")
+
+// importIntoFileNameEscaper escapes the wildcards of `IMPORT INTO` besides the characters escaped by escapeFileName,
+// so the glob of the data files of a table doesn't match the files of the other tables
+var importIntoFileNameEscaper = strings.NewReplacer("[", "%5B", "]", "%5D")
+
+func escapeImportIntoFileName(input string) string {
+	return importIntoFileNameEscaper.Replace(escapeFileName(input))
+}
+
+// importIntoFileTemplate returns tmpl which names the files for `IMPORT INTO`
+func importIntoFileTemplate(tmpl *template.Template) *template.Template {
+	return template.Must(tmpl.Clone()).Funcs(template.FuncMap{"fn": escapeImportIntoFileName})
+}
+
+// importIntoGlob returns the glob matching all the data files of the table named by tmpl
+func importIntoGlob(tmpl *template.Template, db, table, extension string) (string, error) {
+	var bf bytes.Buffer
+	namer := struct{ DB, Table, Index string }{db, table, "*"}
+	if err := tmpl.ExecuteTemplate(&bf, outputFileTemplateData, namer); err != nil {
+		return "", errors.Trace(err)
+	}
+	return bf.String() + "." + extension, nil
+}
+
+// parseImportIntoVersion parses the version of the target TiDB of Config.ImportIntoCompat
+func parseImportIntoVersion(version string) (*semver.Version, error) {
+	v, err := semver.NewVersion(strings.TrimPrefix(strings.ToLower(version), "v"))
+	if err != nil {
+		return nil, errors.Annotatef(err, "fail to parse the target TiDB version '%s'", version)
+	}
+	return v, nil
+}
+
+// importIntoRecorder records the tables which have data files, and writes the `IMPORT INTO` statements
+// loading them into importIntoPath
+type importIntoRecorder struct {
+	mu sync.Mutex
+	// database -> tables
+	tables map[string]map[string]struct{}
+}
+
+func newImportIntoRecorder() *importIntoRecorder {
+	return &importIntoRecorder{tables: make(map[string]map[string]struct{})}
+}
+
+func (r *importIntoRecorder) addTable(meta TableMeta) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tables, ok := r.tables[meta.DatabaseName()]
+	if !ok {
+		tables = make(map[string]struct{})
+		r.tables[meta.DatabaseName()] = tables
+	}
+	tables[meta.TableName()] = struct{}{}
+}
+
+// importIntoURI appends the glob to the path of the location, before the parameters of the URI if any
+func importIntoURI(location, glob string) string {
+	query := ""
+	if i := strings.IndexByte(location, '?'); i >= 0 {
+		location, query = location[:i], location[i:]
+	}
+	return strings.TrimSuffix(location, "/") + "/" + glob + query
+}
+
+// importIntoOptions returns the format and the options of `IMPORT INTO` to read the data files written by conf
+func importIntoOptions(conf *Config) string {
+	if conf.FileType != FileFormatCSVString {
+		return "FORMAT 'sql'"
+	}
+	var bf strings.Builder
+	fmt.Fprintf(&bf, "FORMAT 'csv' WITH FIELDS_TERMINATED_BY='%s', FIELDS_ENCLOSED_BY='%s'",
+		escapeSQLString(conf.CsvSeparator), escapeSQLString(conf.CsvDelimiter))
+	if conf.EscapeBackslash {
+		bf.WriteString(", FIELDS_ESCAPED_BY='\\\\'")
+	} else {
+		bf.WriteString(", FIELDS_ESCAPED_BY=''")
+	}
+	fmt.Fprintf(&bf, ", FIELDS_DEFINED_NULL_BY='%s'", escapeSQLString(conf.CsvNullValue))
+	if !conf.NoHeader {
+		bf.WriteString(", SKIP_ROWS=1")
+	}
+	return bf.String()
+}
+
+// write writes an `IMPORT INTO` statement for each table which has data files, the target tables should be
+// created by the schema files before running them
+func (r *importIntoRecorder) write(tctx *tcontext.Context, extStore storage.ExternalStorage, conf *Config) error {
+	// the local output directory is an absolute path on the TiDB server
+	location, err := outputLocation(conf)
+	if err != nil {
+		return err
+	}
+	// the data files are in the sql or csv file type of the same name
+	extension := strings.ToLower(conf.FileType) + compressFileSuffix(conf.CompressType)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dbNames := make([]string, 0, len(r.tables))
+	for db := range r.tables {
+		dbNames = append(dbNames, db)
+	}
+	sort.Strings(dbNames)
+	var bf bytes.Buffer
+	for _, db := range dbNames {
+		tables := make([]string, 0, len(r.tables[db]))
+		for table := range r.tables[db] {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		for _, table := range tables {
+			glob, err := importIntoGlob(conf.OutputFileTemplate, outputIdentifier(conf, db), outputIdentifier(conf, table), extension)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(&bf, "IMPORT INTO %s.%s FROM '%s' %s;\n", wrapBackTicks(escapeString(outputIdentifier(conf, db))), wrapBackTicks(escapeString(outputIdentifier(conf, table))),
+				escapeSQLString(importIntoURI(location, glob)), importIntoOptions(conf))
+		}
+	}
+	return errors.Trace(extStore.WriteFile(tctx, importIntoPath, bf.Bytes()))
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestImportIntoFileTemplate(c *C) {
+	tmpl := importIntoFileTemplate(DefaultOutputFileTemplate)
+	fileName, err := newOutputFileNamer(&tableMeta{database: "db", table: "t[1]"}, 0, false, false).
+		NextName(tmpl, FileFormatCSVString)
+	c.Assert(err, IsNil)
+	c.Assert(fileName, Equals, "db.t%5B1%5D.000000000.csv")
+	glob, err := importIntoGlob(tmpl, "db", "t[1]", "csv.gz")
+	c.Assert(err, IsNil)
+	c.Assert(glob, Equals, "db.t%5B1%5D.*.csv.gz")
+
+	// the default template isn't changed
+	fileName, err = newOutputFileNamer(&tableMeta{database: "db", table: "t[1]"}, 0, false, false).
+		NextName(DefaultOutputFileTemplate, FileFormatCSVString)
+	c.Assert(err, IsNil)
+	c.Assert(fileName, Equals, "db.t[1].000000000.csv")
+
+	c.Assert(importIntoURI("/data/dump", "db.t.*.sql"), Equals, "/data/dump/db.t.*.sql")
+	c.Assert(importIntoURI("s3://bucket/dump/?region=us-west-2", "db.t.*.sql"), Equals, "s3://bucket/dump/db.t.*.sql?region=us-west-2")
+}
+
+func (s *testUtilSuite) TestImportIntoRecorder(c *C) {
+	dir := c.MkDir()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = dir
+	conf.ImportIntoCompat = "v7.5.0"
+	conf.FileType = FileFormatCSVString
+	conf.CsvSeparator, conf.CsvDelimiter, conf.EscapeBackslash = ",", "\"", true
+	c.Assert(adjustImportIntoCompat(conf), IsNil)
+	extStore, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+
+	r := newImportIntoRecorder()
+	r.addTable(&tableMeta{database: "test", table: "t2"})
+	r.addTable(&tableMeta{database: "test", table: "t1"})
+	r.addTable(&tableMeta{database: "test", table: "t1"})
+	r.addTable(&tableMeta{database: "a`b", table: "t.1"})
+	c.Assert(r.write(tctx, extStore, conf), IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(dir, importIntoPath))
+	c.Assert(err, IsNil)
+	options := `FORMAT 'csv' WITH FIELDS_TERMINATED_BY=',', FIELDS_ENCLOSED_BY='\"', FIELDS_ESCAPED_BY='\\', FIELDS_DEFINED_NULL_BY='\\N', SKIP_ROWS=1;`
+	c.Assert(string(data), Equals,
+		"IMPORT INTO `a``b`.`t.1` FROM '"+dir+"/a`b.t%2E1.*.csv' "+options+"\n"+
+			"IMPORT INTO `test`.`t1` FROM '"+dir+"/test.t1.*.csv' "+options+"\n"+
+			"IMPORT INTO `test`.`t2` FROM '"+dir+"/test.t2.*.csv' "+options+"\n")
+
+	conf.FileType = FileFormatSQLTextString
+	conf.CompressType = CompressGzip
+	conf.OutputDirPath = "s3://bucket/dump?endpoint=http://127.0.0.1:9000"
+	r = newImportIntoRecorder()
+	r.addTable(&tableMeta{database: "test", table: "t1"})
+	c.Assert(r.write(tctx, extStore, conf), IsNil)
+	data, err = ioutil.ReadFile(filepath.Join(dir, importIntoPath))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals,
+		"IMPORT INTO `test`.`t1` FROM 's3://bucket/dump/test.t1.*.sql.gz?endpoint=http://127.0.0.1:9000' FORMAT 'sql';\n")
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// unchangedTableStatus is the status of the tables in the catalog whose data isn't dumped again
+const unchangedTableStatus = "unchanged, see prior"
+
+// priorCatalog is the catalog of a previous dump which Config.IncrementalAgainst compares the tables against
+type priorCatalog struct {
+	// location is the directory of the previous dump
+	location string
+	// database -> table -> catalog
+	tables map[string]map[string]*catalogTable
+}
+
+// loadPriorCatalog reads the catalog of a previous dump. All the tables are dumped if it doesn't exist,
+// so the first one of the periodic dumps can use the same option as the later ones.
+func loadPriorCatalog(tctx *tcontext.Context, path string) (*priorCatalog, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		tctx.L().Warn("the prior catalog doesn't exist, dump all the tables", zap.String("path", path))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "fail to read the prior catalog %s", path)
+	}
+	var catalog struct {
+		Databases []*catalogDatabase `json:"databases"`
+	}
+	if err = json.Unmarshal(data, &catalog); err != nil {
+		return nil, errors.Annotatef(err, "fail to parse the prior catalog %s", path)
+	}
+	prior := &priorCatalog{location: filepath.Dir(path), tables: make(map[string]map[string]*catalogTable)}
+	for _, d := range catalog.Databases {
+		prior.tables[d.Name] = make(map[string]*catalogTable, len(d.Tables))
+		for _, t := range d.Tables {
+			prior.tables[d.Name][t.Name] = t
+		}
+	}
+	return prior, nil
+}
+
+// setTableVersion records the update time and the checksum of the table in information_schema into t,
+// they are null if the server doesn't maintain them
+func setTableVersion(conn *sql.Conn, db string, t *catalogTable) error {
+	query := "SELECT UPDATE_TIME,CHECKSUM FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA=? AND TABLE_NAME=?"
+	var updateTime, checksum sql.NullString
+	err := conn.QueryRowContext(context.Background(), query, db, t.Name).Scan(&updateTime, &checksum)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Annotatef(err, "sql: %s", query)
+	}
+	if updateTime.Valid {
+		t.UpdateTime = &updateTime.String
+	}
+	if checksum.Valid {
+		t.Checksum = &checksum.String
+	}
+	return nil
+}
+
+// unchanged checks whether the table of t is unchanged since the prior dump. The table is unchanged only if
+// it has the same update time, checksum, columns and primary key, an unknown update time is always changed.
+// The data of the unchanged table is referred to the prior dump in t.
+func (p *priorCatalog) unchanged(db string, t *catalogTable) bool {
+	if p == nil || t.UpdateTime == nil {
+		return false
+	}
+	prior, ok := p.tables[db][t.Name]
+	if !ok || prior.Type != t.Type || prior.UpdateTime == nil || *prior.UpdateTime != *t.UpdateTime {
+		return false
+	}
+	if (prior.Checksum == nil) != (t.Checksum == nil) || (prior.Checksum != nil && *prior.Checksum != *t.Checksum) {
+		return false
+	}
+	if !reflect.DeepEqual(prior.Columns, t.Columns) || !reflect.DeepEqual(prior.PrimaryKey, t.PrimaryKey) {
+		return false
+	}
+	t.Status = unchangedTableStatus
+	t.Rows = prior.Rows
+	t.KeyColumns, t.KeyRanges = prior.KeyColumns, prior.KeyRanges
+	// the prior table may be unchanged since an earlier dump too
+	if prior.Status == unchangedTableStatus {
+		t.Prior, t.PriorFiles = prior.Prior, prior.PriorFiles
+	} else {
+		t.Prior, t.PriorFiles = p.location, prior.Files
+	}
+	return true
+}
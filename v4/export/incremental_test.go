@@ -0,0 +1,101 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestSetTableVersion(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	query := "SELECT UPDATE_TIME,CHECKSUM FROM INFORMATION_SCHEMA.TABLES"
+	mock.ExpectQuery(query).WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"UPDATE_TIME", "CHECKSUM"}).AddRow("2021-06-01 10:00:00", nil))
+	t := &catalogTable{Name: "t"}
+	c.Assert(setTableVersion(conn, "test", t), IsNil)
+	c.Assert(*t.UpdateTime, Equals, "2021-06-01 10:00:00")
+	c.Assert(t.Checksum, IsNil)
+
+	// InnoDB forgets the update time after restarting
+	mock.ExpectQuery(query).WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"UPDATE_TIME", "CHECKSUM"}).AddRow(nil, nil))
+	t = &catalogTable{Name: "t"}
+	c.Assert(setTableVersion(conn, "test", t), IsNil)
+	c.Assert(t.UpdateTime, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testUtilSuite) TestPriorCatalogUnchanged(c *C) {
+	tctx := tcontext.Background().WithLogger(appLogger)
+	dir := c.MkDir()
+	path := filepath.Join(dir, catalogPath)
+	prior, err := loadPriorCatalog(tctx, path)
+	c.Assert(err, IsNil)
+	c.Assert(prior, IsNil)
+	c.Assert(prior.unchanged("test", &catalogTable{Name: "t1"}), IsFalse)
+
+	c.Assert(ioutil.WriteFile(path, []byte(`{"databases": [{"name": "test", "files": [], "tables": [
+		{"name": "t1", "type": "table", "columns": [{"name": "id", "type": "INT"}], "primary_key": ["id"],
+			"rows": 10, "files": ["test.t1-schema.sql", "test.t1.000000000.sql"], "update_time": "2021-06-01 10:00:00"},
+		{"name": "t2", "type": "table", "columns": [], "primary_key": [], "rows": 5, "files": ["test.t2-schema.sql"],
+			"update_time": "2021-06-01 10:00:00", "checksum": "42", "status": "unchanged, see prior",
+			"prior": "/backup/day1", "prior_files": ["test.t2-schema.sql", "test.t2.000000000.sql"]}
+	]}]}`), 0o644), IsNil)
+	prior, err = loadPriorCatalog(tctx, path)
+	c.Assert(err, IsNil)
+
+	updateTime, checksum := "2021-06-01 10:00:00", "42"
+	newTable := func(name string) *catalogTable {
+		return &catalogTable{Name: name, Type: "table", Columns: []catalogColumn{}, PrimaryKey: []string{}, Files: []string{},
+			UpdateTime: &updateTime}
+	}
+	t1 := newTable("t1")
+	t1.Columns, t1.PrimaryKey = []catalogColumn{{Name: "id", Type: "INT"}}, []string{"id"}
+	c.Assert(prior.unchanged("test", t1), IsTrue)
+	c.Assert(t1.Status, Equals, unchangedTableStatus)
+	c.Assert(t1.Rows, Equals, uint64(10))
+	c.Assert(t1.Prior, Equals, dir)
+	c.Assert(t1.PriorFiles, DeepEquals, []string{"test.t1-schema.sql", "test.t1.000000000.sql"})
+
+	// the table unchanged in the prior dump refers to the dump holding its data
+	t2 := newTable("t2")
+	t2.Checksum = &checksum
+	c.Assert(prior.unchanged("test", t2), IsTrue)
+	c.Assert(t2.Prior, Equals, "/backup/day1")
+	c.Assert(t2.PriorFiles, DeepEquals, []string{"test.t2-schema.sql", "test.t2.000000000.sql"})
+
+	// the checksum is changed
+	t2 = newTable("t2")
+	c.Assert(prior.unchanged("test", t2), IsFalse)
+	c.Assert(t2.Status, Equals, "")
+	// the columns are changed
+	t1 = newTable("t1")
+	t1.PrimaryKey = []string{"id"}
+	c.Assert(prior.unchanged("test", t1), IsFalse)
+	// the update time is changed or unknown
+	t1 = newTable("t1")
+	t1.Columns, t1.PrimaryKey = []catalogColumn{{Name: "id", Type: "INT"}}, []string{"id"}
+	otherTime := "2021-06-02 10:00:00"
+	t1.UpdateTime = &otherTime
+	c.Assert(prior.unchanged("test", t1), IsFalse)
+	t1.UpdateTime = nil
+	c.Assert(prior.unchanged("test", t1), IsFalse)
+	// the table isn't in the prior dump
+	c.Assert(prior.unchanged("test", newTable("t3")), IsFalse)
+
+	c.Assert(ioutil.WriteFile(path, []byte(`{"databases": [`), 0o644), IsNil)
+	_, err = loadPriorCatalog(tctx, path)
+	c.Assert(err, ErrorMatches, "fail to parse the prior catalog .*")
+}
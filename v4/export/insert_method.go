@@ -0,0 +1,52 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+const (
+	// InsertMethodInsert writes the rows by INSERT INTO, which fails on the duplicated keys
+	InsertMethodInsert = "insert"
+	// InsertMethodInsertIgnore writes the rows by INSERT IGNORE INTO, which keeps the rows existing in the target
+	InsertMethodInsertIgnore = "insert_ignore"
+	// InsertMethodReplace writes the rows by REPLACE INTO, which overwrites the rows existing in the target.
+	// The generated columns aren't selected, so they're computed again by the target like INSERT INTO.
+	InsertMethodReplace = "replace"
+)
+
+// insertKeywordOf returns the keyword starting the statements of the rows written by method
+func insertKeywordOf(method string) string {
+	switch method {
+	case InsertMethodInsertIgnore:
+		return "INSERT IGNORE INTO"
+	case InsertMethodReplace:
+		return safeModeInsertKeyword
+	default:
+		return "INSERT INTO"
+	}
+}
+
+// adjustInsertMethod normalizes and checks conf.InsertMethod
+func adjustInsertMethod(conf *Config) error {
+	conf.InsertMethod = strings.ToLower(strings.TrimSpace(conf.InsertMethod))
+	switch conf.InsertMethod {
+	case "":
+		conf.InsertMethod = InsertMethodInsert
+		return nil
+	case InsertMethodInsert:
+		return nil
+	case InsertMethodInsertIgnore, InsertMethodReplace:
+	default:
+		return errors.Errorf("unknown config.InsertMethod '%s', please use '%s', '%s' or '%s'",
+			conf.InsertMethod, InsertMethodInsert, InsertMethodInsertIgnore, InsertMethodReplace)
+	}
+	if conf.SafeModeRows != 0 {
+		return errors.Errorf("config.SafeModeRows writes the rows after the ones in safe mode by INSERT INTO, "+
+			"it can't be used with config.InsertMethod '%s'", conf.InsertMethod)
+	}
+	return nil
+}
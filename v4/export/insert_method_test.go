@@ -0,0 +1,79 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"strings"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+func (s *testUtilSuite) TestWriteInsertWithInsertMethod(c *C) {
+	data := [][]driver.Value{
+		{"1", "alice"},
+		{"2", "bob"},
+		{"3", "carol"},
+	}
+	colTypes := []string{"INT", "VARCHAR"}
+	for _, tc := range []struct {
+		method string
+		prefix string
+	}{
+		{"", "INSERT INTO `t` VALUES"},
+		{InsertMethodInsert, "INSERT INTO `t` VALUES"},
+		{InsertMethodInsertIgnore, "INSERT IGNORE INTO `t` VALUES"},
+		{InsertMethodReplace, "REPLACE INTO `t` VALUES"},
+	} {
+		// every statement split by the statement size starts with the keyword of the method
+		tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+		bf := storage.NewBufferWriter()
+		conf := configForWriteSQL(UnspecifiedSize, 40)
+		conf.InsertMethod = tc.method
+		n, err := WriteInsert(tcontext.Background(), conf, tableIR, tableIR, bf)
+		c.Assert(err, IsNil)
+		c.Assert(n, Equals, uint64(3))
+		stmts := strings.SplitAfter(strings.TrimSuffix(bf.String(), "\n"), ";\n")
+		c.Assert(len(stmts), Greater, 1, Commentf("method %s", tc.method))
+		for _, stmt := range stmts {
+			c.Assert(strings.HasPrefix(stmt, tc.prefix+"\n"), IsTrue, Commentf("method %s, statement %s", tc.method, stmt))
+		}
+	}
+
+	// compose with complete insert and without extended insert
+	tableIR := newMockTableIR("test", "t", data[:2], nil, colTypes)
+	tableIR.selectedField = "(`id`,`name`)"
+	bf := storage.NewBufferWriter()
+	conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+	conf.InsertMethod = InsertMethodReplace
+	conf.SingleRowInsert = true
+	n, err := WriteInsert(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, uint64(2))
+	c.Assert(bf.String(), Equals, "REPLACE INTO `t` (`id`,`name`) VALUES (1,'alice');\n"+
+		"REPLACE INTO `t` (`id`,`name`) VALUES (2,'bob');\n")
+}
+
+func (s *testConfigSuite) TestAdjustInsertMethod(c *C) {
+	conf := DefaultConfig()
+	c.Assert(adjustInsertMethod(conf), IsNil)
+	c.Assert(conf.InsertMethod, Equals, InsertMethodInsert)
+	conf.InsertMethod = ""
+	c.Assert(adjustInsertMethod(conf), IsNil)
+	c.Assert(conf.InsertMethod, Equals, InsertMethodInsert)
+	conf.InsertMethod = " Insert_Ignore "
+	c.Assert(adjustInsertMethod(conf), IsNil)
+	c.Assert(conf.InsertMethod, Equals, InsertMethodInsertIgnore)
+	conf.InsertMethod = "upsert"
+	c.Assert(adjustInsertMethod(conf), ErrorMatches, "unknown config.InsertMethod 'upsert'.*")
+
+	// the rows after the ones in safe mode are written by INSERT INTO
+	conf.SafeModeRows = 100
+	conf.InsertMethod = InsertMethodInsert
+	c.Assert(adjustInsertMethod(conf), IsNil)
+	conf.InsertMethod = InsertMethodReplace
+	c.Assert(adjustInsertMethod(conf), ErrorMatches, "config.SafeModeRows .* can't be used with config.InsertMethod 'replace'")
+}
@@ -0,0 +1,165 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+const (
+	// InvalidEnumKeep writes the invalid ENUM values as the empty strings the server returns
+	InvalidEnumKeep = "keep"
+	// InvalidEnumNull writes the invalid ENUM values as NULL
+	InvalidEnumNull = "null"
+	// InvalidEnumFirst writes the invalid ENUM values as the first member of the ENUM
+	InvalidEnumFirst = "first"
+)
+
+// setEnumMembers sets the members of the ENUM columns of meta to replace their invalid values with Config.InvalidEnumHandling.
+// The invalid value of an ENUM is stored as index 0 and read as the empty string, it's rejected on reimport under strict sql_mode.
+// The empty string of a SET is the valid empty set, so the SET columns aren't handled.
+func setEnumMembers(conn *sql.Conn, meta TableMeta) error {
+	tm, ok := meta.(*tableMeta)
+	if !ok {
+		return nil
+	}
+	query := "SELECT COLUMN_NAME,COLUMN_TYPE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=? AND TABLE_NAME=? AND DATA_TYPE='enum'"
+	rows, err := conn.QueryContext(context.Background(), query, tm.database, tm.table)
+	if err != nil {
+		return errors.Annotatef(err, "sql: %s", query)
+	}
+	defer rows.Close()
+	var colName, colType string
+	for rows.Next() {
+		if err = rows.Scan(&colName, &colType); err != nil {
+			return errors.Annotatef(err, "sql: %s", query)
+		}
+		if tm.enumMembers == nil {
+			tm.enumMembers = make(map[string][]string)
+		}
+		tm.enumMembers[strings.ToLower(colName)] = parseEnumMembers(colType)
+	}
+	return errors.Annotatef(rows.Err(), "sql: %s", query)
+}
+
+func enumMembersOf(meta TableMeta) map[string][]string {
+	if tm, ok := meta.(*tableMeta); ok {
+		return tm.enumMembers
+	}
+	return nil
+}
+
+// parseEnumMembers parses the members of the column type like `enum('a','b')` in information_schema,
+// the quotes in the members are escaped
+func parseEnumMembers(colType string) []string {
+	literals := quotedLiteralPattern.FindAllString(colType, -1)
+	members := make([]string, 0, len(literals))
+	for _, literal := range literals {
+		if literal[0] != '\'' {
+			continue
+		}
+		var bf strings.Builder
+		s := literal[1 : len(literal)-1]
+		for i := 0; i < len(s); i++ {
+			if (s[i] == '\'' || s[i] == '\\') && i+1 < len(s) {
+				i++
+			}
+			bf.WriteByte(s[i])
+		}
+		members = append(members, bf.String())
+	}
+	return members
+}
+
+// invalidEnumReplacements returns the replacements of the invalid values of the ENUM columns of meta by their indices,
+// the replacement is nil for NULL. It returns nil if no invalid value is replaced.
+func invalidEnumReplacements(handling string, meta TableMeta) map[int][]byte {
+	enumMembers := enumMembersOf(meta)
+	if handling == InvalidEnumKeep || len(enumMembers) == 0 {
+		return nil
+	}
+	replacements := make(map[int][]byte)
+	for i, col := range meta.ColumnNames() {
+		members, ok := enumMembers[strings.ToLower(col)]
+		if !ok || len(members) == 0 {
+			continue
+		}
+		// the empty string is a valid value if it's a member
+		valid := false
+		for _, member := range members {
+			if member == "" {
+				valid = true
+				break
+			}
+		}
+		if valid {
+			continue
+		}
+		if handling == InvalidEnumFirst {
+			replacements[i] = []byte(members[0])
+		} else {
+			replacements[i] = nil
+		}
+	}
+	if len(replacements) == 0 {
+		return nil
+	}
+	return replacements
+}
+
+// invalidEnumIR replaces the invalid values of the ENUM columns when the rows are decoded
+type invalidEnumIR struct {
+	TableDataIR
+	replacements map[int][]byte
+}
+
+func newInvalidEnumIR(ir TableDataIR, replacements map[int][]byte) *invalidEnumIR {
+	return &invalidEnumIR{TableDataIR: ir, replacements: replacements}
+}
+
+// Rows implements TableDataIR.Rows
+func (e *invalidEnumIR) Rows() SQLRowIter {
+	return &invalidEnumRowIter{SQLRowIter: e.TableDataIR.Rows(), ir: e}
+}
+
+type invalidEnumRowIter struct {
+	SQLRowIter
+	ir *invalidEnumIR
+}
+
+// Decode implements SQLRowIter.Decode
+func (it *invalidEnumRowIter) Decode(row RowReceiver) error {
+	if err := it.SQLRowIter.Decode(row); err != nil {
+		return err
+	}
+	arr, ok := row.(RowReceiverArr)
+	if !ok {
+		return nil
+	}
+	for idx, replacement := range it.ir.replacements {
+		if idx >= len(arr.receivers) {
+			continue
+		}
+		switch r := arr.receivers[idx].(type) {
+		case *SQLTypeString:
+			r.RawBytes = replaceInvalidEnum(r.RawBytes, replacement)
+		case *SQLTypeClientSafeString:
+			r.RawBytes = replaceInvalidEnum(r.RawBytes, replacement)
+		case *SQLTypeBinaryString:
+			r.RawBytes = replaceInvalidEnum(r.RawBytes, replacement)
+		}
+	}
+	return nil
+}
+
+// replaceInvalidEnum returns replacement if value is the invalid value of an ENUM, which is the empty string but not NULL
+func replaceInvalidEnum(value sql.RawBytes, replacement []byte) sql.RawBytes {
+	if value == nil || len(value) > 0 {
+		return value
+	}
+	return replacement
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql/driver"
+	"io/ioutil"
+	"path"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestWriteTableDataWithInvalidEnum(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "e", "e2"}))
+	colTypes, err := GetColumnTypes(conn, "*", "test", "t")
+	c.Assert(err, IsNil)
+	meta := &tableMeta{database: "test", table: "t", colTypes: colTypes, selectedField: "*"}
+	mock.ExpectQuery("SELECT COLUMN_NAME,COLUMN_TYPE FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "COLUMN_TYPE"}).
+			AddRow("E", "enum('it''s','b')").
+			// the empty string is a member of e2
+			AddRow("e2", "enum('','x')"))
+	c.Assert(setEnumMembers(conn, meta), IsNil)
+	c.Assert(meta.enumMembers, DeepEquals, map[string][]string{"e": {"it's", "b"}, "e2": {"", "x"}})
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the invalid value of e is read as the empty string
+	data := [][]driver.Value{{"1", "", ""}, {"2", "b", "x"}, {"3", nil, nil}}
+	cases := map[string]string{
+		InvalidEnumKeep:  "('1','',''),\n('2','b','x'),\n('3',NULL,NULL);\n",
+		InvalidEnumNull:  "('1',NULL,''),\n('2','b','x'),\n('3',NULL,NULL);\n",
+		InvalidEnumFirst: "('1','it''s',''),\n('2','b','x'),\n('3',NULL,NULL);\n",
+	}
+	for handling, values := range cases {
+		conf := defaultConfigForTest(c)
+		conf.OutputDirPath = c.MkDir()
+		conf.InvalidEnumHandling = handling
+		writer := s.newWriter(conf, c)
+		tableIR := newMockTableIR("test", "t", data, nil, []string{"INT", "ENUM", "ENUM"})
+		c.Assert(writer.writeTableData(meta, tableIR, 0, ""), IsNil)
+		bytes, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, "test.t.000000000.sql"))
+		c.Assert(err, IsNil)
+		c.Assert(string(bytes), Equals, "INSERT INTO `t` VALUES\n"+values, Commentf("handling %s", handling))
+	}
+}
@@ -242,6 +242,10 @@ func (td *tableData) Rows() SQLRowIter {
 }
 
 func (td *tableData) Close() error {
+	// the rows may be closed before they are iterated
+	if td.SQLRowIter == nil {
+		return errors.Trace(td.rows.Close())
+	}
 	return td.SQLRowIter.Close()
 }
 
@@ -257,6 +261,36 @@ type tableMeta struct {
 	specCmts        []string
 	showCreateTable string
 	showCreateView  string
+	// columnGroup is the name of the column group if only the columns in the group are selected
+	columnGroup string
+	// skippedColumns is the columns which aren't selected because of their types
+	skippedColumns []string
+	// collationViolations are the collations of the table and its columns which aren't in the allowlist
+	collationViolations []collationViolation
+	// queryField is the fields in the select query if they are different from selectedField,
+	// e.g. a constant partition column is selected as an expression
+	queryField string
+	// dedupKeyColumns is the primary key columns to dedupe the rows by, it's empty if the rows aren't deduplicated
+	dedupKeyColumns []string
+	// sampleKeyColumns is the primary key columns to sample the rows by for the verification, it's empty if the rows aren't sampled
+	sampleKeyColumns []string
+	// sampleCondition is the condition to select the rows by with Config.SampleFraction
+	sampleCondition string
+	// safeMode counts the rows still written by REPLACE INTO with Config.SafeModeRows
+	safeMode *safeModeCounter
+	// budget is the wall-clock budget of dumping the data with Config.PerTableBudget
+	budget *tableBudget
+	// enumMembers is the members of the ENUM columns by the lower case column names, to replace their invalid
+	// values with Config.InvalidEnumHandling
+	enumMembers map[string][]string
+	// partitionByColumn is the column to route the rows to the files by with Config.PartitionByColumn
+	partitionByColumn string
+	// kafkaKeyColumns is the columns whose values are the keys of the messages produced with Config.KafkaTopic
+	kafkaKeyColumns []string
+	// indexHint is the hint of the covering index to select the rows by with Config.UseCoveringIndex
+	indexHint string
+	// pkIndexColumns is the primary key columns written into the index of the table with Config.EmitPKIndex
+	pkIndexColumns []string
 }
 
 func (tm *tableMeta) ColumnTypes() []string {
@@ -0,0 +1,59 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"hash/crc32"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// adjustJob checks conf.JobIndex and conf.JobCount, which split the tables of one dump into several disjoint jobs
+func adjustJob(conf *Config) error {
+	if conf.JobCount <= 1 {
+		if conf.JobIndex != 0 {
+			return errors.Errorf("config.JobIndex %d should be used with config.JobCount greater than 1", conf.JobIndex)
+		}
+		return nil
+	}
+	if conf.JobIndex < 0 || conf.JobIndex >= conf.JobCount {
+		return errors.Errorf("config.JobIndex should be between 0 and %d, got %d", conf.JobCount-1, conf.JobIndex)
+	}
+	if conf.SQL != "" || len(conf.NamedQueries) > 0 {
+		return errors.New("config.JobCount can't be used with --sql or --named-query, which isn't split by tables")
+	}
+	return nil
+}
+
+// tableJob returns the job which dumps the table. It only depends on the names, so every job
+// with the same config agrees on the assignment.
+func tableJob(db, table string, jobCount int) int {
+	h := crc32.NewIEEE()
+	_, _ = h.Write([]byte(db))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(table))
+	return int(h.Sum32() % uint32(jobCount))
+}
+
+// filterTablesByJob keeps the tables of conf.JobIndex. The databases are kept even if none of
+// their tables belong to the job, so every job has the schemas of all the databases.
+func filterTablesByJob(tctx *tcontext.Context, conf *Config) {
+	if conf.JobCount <= 1 {
+		return
+	}
+	dbTables := DatabaseTables{}
+	for dbName, tables := range conf.Tables {
+		dbTables[dbName] = make([]*TableInfo, 0, len(tables))
+		for _, table := range tables {
+			if tableJob(dbName, table.Name, conf.JobCount) == conf.JobIndex {
+				dbTables.AppendTable(dbName, table)
+			}
+		}
+	}
+	tctx.L().Info("dump the tables of the job", zap.Int("job index", conf.JobIndex), zap.Int("job count", conf.JobCount),
+		zap.Int("tables", calculateTableCount(dbTables)))
+	conf.Tables = dbTables
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testConfigSuite) TestAdjustJob(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustJob(conf), IsNil)
+	conf.JobIndex = 1
+	c.Assert(adjustJob(conf), ErrorMatches, "config.JobIndex 1 should be used with config.JobCount greater than 1")
+	conf.JobCount = 2
+	c.Assert(adjustJob(conf), IsNil)
+	conf.JobIndex = 2
+	c.Assert(adjustJob(conf), ErrorMatches, "config.JobIndex should be between 0 and 1, got 2")
+	conf.JobIndex = 0
+	conf.SQL = "SELECT 1"
+	c.Assert(adjustJob(conf), ErrorMatches, "config.JobCount can't be used with --sql.*")
+}
+
+func (s *testConfigSuite) TestFilterTablesByJob(c *C) {
+	tables := DatabaseTables{}
+	for i := 0; i < 20; i++ {
+		tables.AppendTables("test", fmt.Sprintf("t%d", i))
+	}
+	tables.AppendViews("other", "v")
+
+	const jobCount = 3
+	dumped := make(map[string]int)
+	for i := 0; i < jobCount; i++ {
+		conf := defaultConfigForTest(c)
+		conf.Tables = DatabaseTables{}
+		conf.Tables.Merge(tables)
+		conf.JobIndex, conf.JobCount = i, jobCount
+		filterTablesByJob(tcontext.Background(), conf)
+		// every job keeps all the databases
+		c.Assert(conf.Tables, HasLen, 2)
+		for db, infos := range conf.Tables {
+			for _, info := range infos {
+				c.Assert(tableJob(db, info.Name, jobCount), Equals, i)
+				dumped[db+"."+info.Name]++
+			}
+		}
+	}
+	// the jobs are disjoint and cover all the tables
+	c.Assert(dumped, HasLen, 21)
+	for table, n := range dumped {
+		c.Assert(n, Equals, 1, Commentf("table %s", table))
+	}
+
+	// the tables aren't split without jobs
+	conf := defaultConfigForTest(c)
+	conf.Tables = tables
+	filterTablesByJob(tcontext.Background(), conf)
+	c.Assert(conf.Tables["test"], HasLen, 20)
+	c.Assert(conf.Tables["other"], HasLen, 1)
+}
@@ -0,0 +1,68 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strconv"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+)
+
+// maxJSONSafeInteger is the largest integer which a JSON number can represent in a float64 without losing precision
+const maxJSONSafeInteger = 1<<53 - 1
+
+// writeJSONLinesValue writes the raw value of a column as a plain JSON value. The integers are numbers unless they
+// can't be represented by a float64 exactly, then they're strings, so no consumer loses their precision. The floats
+// are numbers, the decimals are strings to keep their precision, the dates are ISO-8601 strings without a time zone,
+// and the binary values are base64 strings.
+func writeJSONLinesValue(bf *bytes.Buffer, tp mongoJSONType, raw []byte) {
+	if raw == nil {
+		bf.WriteString("null")
+		return
+	}
+	switch tp {
+	case mongoJSONInt, mongoJSONLong, mongoJSONUnsignedLong:
+		if isJSONSafeInteger(raw) {
+			bf.Write(raw)
+		} else {
+			writeJSONString(bf, raw)
+		}
+	case mongoJSONDouble, mongoJSONDocument:
+		bf.Write(raw)
+	case mongoJSONDate:
+		writeJSONString(bf, isoDateTime(raw))
+	case mongoJSONBinary:
+		bf.WriteByte('"')
+		bf.WriteString(base64.StdEncoding.EncodeToString(raw))
+		bf.WriteByte('"')
+	default:
+		writeJSONString(bf, raw)
+	}
+}
+
+func isJSONSafeInteger(raw []byte) bool {
+	v, err := strconv.ParseInt(string(raw), 10, 64)
+	return err == nil && v <= maxJSONSafeInteger && v >= -maxJSONSafeInteger
+}
+
+// isoDateTime converts a DATETIME or TIMESTAMP value like `2021-03-04 05:06:07` into ISO-8601 `2021-03-04T05:06:07`.
+// The DATE values are in ISO-8601 already.
+func isoDateTime(raw []byte) []byte {
+	const dateLen = len("2006-01-02")
+	if len(raw) > dateLen && raw[dateLen] == ' ' {
+		iso := append([]byte{}, raw...)
+		iso[dateLen] = 'T'
+		return iso
+	}
+	return raw
+}
+
+// WriteInsertInJSONLines writes TableDataIR to a storage.ExternalFileWriter as newline-delimited JSON,
+// one plain JSON object per row keyed by the column names
+func WriteInsertInJSONLines(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR TableDataIR, w storage.ExternalFileWriter) (uint64, error) {
+	return writeInsertInJSONLines(pCtx, cfg, meta, tblIR, w, nil, nil, writeJSONLinesValue)
+}
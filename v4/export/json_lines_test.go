@@ -0,0 +1,75 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestWriteInsertInJSONLines(c *C) {
+	data := [][]driver.Value{
+		{"1", "9007199254740991", "18446744073709551615", "1.5", "12.340", "2021-03-04 05:06:07.5", []byte{0, 1, 255}, `{"a": [1, "<b>"]}`, "bob \"the\"\nbuilder"},
+		{"2", "-9007199254740992", "1", "-0", "0.000", "0000-00-00 00:00:00", []byte{}, "null", ""},
+		{"3", nil, nil, nil, nil, "2021-03-04", nil, nil, nil},
+	}
+	colTypes := []string{"INT", "BIGINT", "UNSIGNED BIGINT", "DOUBLE", "DECIMAL", "DATETIME", "BLOB", "JSON", "VARCHAR"}
+	tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+	tableIR.colNames = []string{"id", "l", "u", "d", "dec", "dt", "b", "j", "s"}
+	bf := storage.NewBufferWriter()
+
+	conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+	n, err := WriteInsertInJSONLines(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, uint64(3))
+	expected := `{"id":1,"l":9007199254740991,"u":"18446744073709551615","d":1.5,"dec":"12.340","dt":"2021-03-04T05:06:07.5",` +
+		`"b":"AAH/","j":{"a": [1, "<b>"]},"s":"bob \"the\"\nbuilder"}` + "\n" +
+		`{"id":2,"l":"-9007199254740992","u":1,"d":-0,"dec":"0.000","dt":"0000-00-00T00:00:00","b":"","j":null,"s":""}` + "\n" +
+		`{"id":3,"l":null,"u":null,"d":null,"dec":null,"dt":"2021-03-04","b":null,"j":null,"s":null}` + "\n"
+	c.Assert(bf.String(), Equals, expected)
+
+	// decode the rows back, every line is a JSON object and the values are the same as the dumped ones
+	scanner := bufio.NewScanner(bytes.NewReader(bf.Bytes()))
+	var rows []map[string]interface{}
+	for scanner.Scan() {
+		var row map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.UseNumber()
+		c.Assert(decoder.Decode(&row), IsNil)
+		rows = append(rows, row)
+	}
+	c.Assert(rows, HasLen, len(data))
+	c.Assert(rows[0]["id"], Equals, json.Number("1"))
+	c.Assert(rows[0]["l"], Equals, json.Number("9007199254740991"))
+	c.Assert(rows[0]["u"], Equals, "18446744073709551615")
+	c.Assert(rows[0]["d"], Equals, json.Number("1.5"))
+	c.Assert(rows[0]["dec"], Equals, "12.340")
+	b, err := base64.StdEncoding.DecodeString(rows[0]["b"].(string))
+	c.Assert(err, IsNil)
+	c.Assert(b, DeepEquals, []byte{0, 1, 255})
+	c.Assert(rows[0]["j"], DeepEquals, map[string]interface{}{"a": []interface{}{json.Number("1"), "<b>"}})
+	c.Assert(rows[0]["s"], Equals, "bob \"the\"\nbuilder")
+	c.Assert(rows[1]["l"], Equals, "-9007199254740992")
+	for _, col := range []string{"l", "u", "d", "dec", "b", "j", "s"} {
+		value, ok := rows[2][col]
+		c.Assert(ok, IsTrue)
+		c.Assert(value, IsNil)
+	}
+}
+
+func (s *testConfigSuite) TestAdjustFileFormatJSONLines(c *C) {
+	conf := DefaultConfig()
+	conf.FileType = "JSONL"
+	c.Assert(adjustFileFormat(conf), IsNil)
+	c.Assert(conf.FileType, Equals, FileFormatJSONLinesString)
+	c.Assert(FileFormatJSONLines.Extension(), Equals, "jsonl")
+	c.Assert(FileFormatJSONLines.String(), Equals, "JSONL")
+}
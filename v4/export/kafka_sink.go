@@ -0,0 +1,242 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/summary"
+	"github.com/pingcap/errors"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+const (
+	// kafkaMessagesUnit is the name of the rows produced into Config.KafkaTopic in the summary
+	kafkaMessagesUnit = "kafka messages"
+	// kafkaBatchTimeout is how long the messages of a partition wait for more to be batched,
+	// the rows of a buffer written by the data writer are produced together
+	kafkaBatchTimeout = 10 * time.Millisecond
+)
+
+// kafkaProducer produces the messages into a topic, it's the kafka.Writer except in the tests
+type kafkaProducer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// kafkaSink produces the rows dumped into Config.KafkaTopic, one message per row. The rows are serialized as the
+// JSON lines of the data files, and the messages are produced while the files are written. The producer blocks
+// until the messages are acknowledged, so the writers slow down together with the broker.
+type kafkaSink struct {
+	conf     *Config
+	producer kafkaProducer
+}
+
+func newKafkaSink(conf *Config) *kafkaSink {
+	producer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      conf.KafkaBrokers,
+		Topic:        conf.KafkaTopic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: kafkaBatchTimeout,
+	})
+	return &kafkaSink{conf: conf, producer: producer}
+}
+
+func (k *kafkaSink) close() error {
+	if k == nil {
+		return nil
+	}
+	return errors.Trace(k.producer.Close())
+}
+
+// setKafkaKey sets the columns of meta whose values are the keys of its messages, which are Config.KafkaKeyColumn
+// or the primary key. The messages have no key if there isn't any, so they're spread over the partitions.
+func setKafkaKey(tctx *tcontext.Context, conn *sql.Conn, conf *Config, meta TableMeta) error {
+	tm, ok := meta.(*tableMeta)
+	if !ok {
+		return nil
+	}
+	if conf.KafkaKeyColumn != "" {
+		if _, missing := keyColumnIndices(meta, []string{conf.KafkaKeyColumn}); missing != "" {
+			return errors.Errorf("kafka key column `%s` isn't dumped in table `%s`.`%s`", missing, tm.database, tm.table)
+		}
+		tm.kafkaKeyColumns = []string{conf.KafkaKeyColumn}
+		return nil
+	}
+	cols, err := GetPrimaryKeyColumns(conn, tm.database, tm.table)
+	if err != nil {
+		return err
+	}
+	if len(cols) == 0 {
+		tctx.L().Warn("table has no primary key, its kafka messages have no key",
+			zap.String("database", tm.database), zap.String("table", tm.table))
+	}
+	tm.kafkaKeyColumns = cols
+	return nil
+}
+
+func kafkaKeyColumnsOf(meta TableMeta) []string {
+	if tm, ok := meta.(*tableMeta); ok {
+		return tm.kafkaKeyColumns
+	}
+	return nil
+}
+
+// storage returns the storage which produces the rows written into the files of meta while they're written into s.
+// The files aren't written into s with Config.KafkaOnly.
+func (k *kafkaSink) storage(s storage.ExternalStorage, meta TableMeta) storage.ExternalStorage {
+	if k == nil {
+		return s
+	}
+	return &kafkaStorage{ExternalStorage: s, sink: k, keyColumns: kafkaKeyColumnsOf(meta)}
+}
+
+type kafkaStorage struct {
+	storage.ExternalStorage
+	sink       *kafkaSink
+	keyColumns []string
+}
+
+// Create implements ExternalStorage.Create
+func (s *kafkaStorage) Create(ctx context.Context, path string) (storage.ExternalFileWriter, error) {
+	w := &kafkaFileWriter{sink: s.sink, keyColumns: s.keyColumns}
+	if !s.sink.conf.KafkaOnly {
+		var err error
+		if w.ExternalFileWriter, err = s.ExternalStorage.Create(ctx, path); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// kafkaFileWriter produces each line written into it as a message
+type kafkaFileWriter struct {
+	storage.ExternalFileWriter
+	sink       *kafkaSink
+	keyColumns []string
+	// pending is the last line which isn't terminated yet
+	pending  []byte
+	messages uint64
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *kafkaFileWriter) Write(ctx context.Context, p []byte) (int, error) {
+	if w.ExternalFileWriter != nil {
+		if n, err := w.ExternalFileWriter.Write(ctx, p); err != nil {
+			return n, err
+		}
+	}
+	n := len(p)
+	var msgs []kafka.Message
+	for {
+		idx := bytes.IndexByte(p, '\n')
+		if idx < 0 {
+			w.pending = append(w.pending, p...)
+			break
+		}
+		line := p[:idx]
+		if len(w.pending) > 0 {
+			line = append(w.pending, line...)
+			w.pending = nil
+		}
+		p = p[idx+1:]
+		if len(line) == 0 {
+			continue
+		}
+		msg, err := w.message(line)
+		if err != nil {
+			return 0, err
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := w.produce(ctx, msgs); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// message builds the message of a row, whose value is the JSON object of the row
+func (w *kafkaFileWriter) message(line []byte) (kafka.Message, error) {
+	value := append([]byte{}, line...)
+	msg := kafka.Message{Value: value}
+	if len(w.keyColumns) == 0 {
+		return msg, nil
+	}
+	key, err := kafkaMessageKey(value, w.keyColumns, w.sink.conf.FileType == FileFormatChangeFeedString)
+	if err != nil {
+		return msg, err
+	}
+	msg.Key = key
+	return msg, nil
+}
+
+func (w *kafkaFileWriter) produce(ctx context.Context, msgs []kafka.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	if err := w.sink.producer.WriteMessages(ctx, msgs...); err != nil {
+		return newWriterError(errors.Annotatef(err, "fail to produce into kafka topic %s", w.sink.conf.KafkaTopic))
+	}
+	w.messages += uint64(len(msgs))
+	return nil
+}
+
+// Close implements ExternalFileWriter.Close
+func (w *kafkaFileWriter) Close(ctx context.Context) error {
+	var err error
+	if len(w.pending) > 0 {
+		var msg kafka.Message
+		if msg, err = w.message(w.pending); err == nil {
+			err = w.produce(ctx, []kafka.Message{msg})
+		}
+		w.pending = nil
+	}
+	if w.ExternalFileWriter != nil {
+		if closeErr := w.ExternalFileWriter.Close(ctx); err == nil {
+			err = closeErr
+		}
+	}
+	if w.messages > 0 {
+		summary.CollectSuccessUnit(kafkaMessagesUnit, 1, w.messages)
+		w.messages = 0
+	}
+	return err
+}
+
+// kafkaMessageKey returns the key of the message of a row, which is the JSON value of the key column,
+// or the JSON array of the values if the key has several columns. The row is the `after` of the change event
+// in the change-feed files.
+func kafkaMessageKey(line []byte, keyColumns []string, changeFeed bool) ([]byte, error) {
+	var row map[string]json.RawMessage
+	if err := json.Unmarshal(line, &row); err != nil {
+		return nil, errors.Annotate(err, "fail to parse the row to produce into kafka")
+	}
+	if changeFeed {
+		after := row["after"]
+		row = nil
+		if err := json.Unmarshal(after, &row); err != nil {
+			return nil, errors.Annotate(err, "fail to parse the row of the change event to produce into kafka")
+		}
+	}
+	values := make([]json.RawMessage, 0, len(keyColumns))
+	for _, col := range keyColumns {
+		value, ok := row[col]
+		if !ok {
+			return nil, errors.Errorf("kafka key column `%s` isn't in the row", col)
+		}
+		values = append(values, value)
+	}
+	if len(values) == 1 {
+		return values[0], nil
+	}
+	key, err := json.Marshal(values)
+	return key, errors.Trace(err)
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/pingcap/check"
+	"github.com/segmentio/kafka-go"
+)
+
+type mockKafkaProducer struct {
+	messages []kafka.Message
+	calls    int
+	err      error
+}
+
+func (p *mockKafkaProducer) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	p.calls++
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, msgs...)
+	return nil
+}
+
+func (p *mockKafkaProducer) Close() error {
+	return nil
+}
+
+func (s *testUtilSuite) TestKafkaMessageKey(c *C) {
+	line := []byte(`{"id":{"$numberInt":"1"},"name":"a","region":"eu"}`)
+	key, err := kafkaMessageKey(line, []string{"id"}, false)
+	c.Assert(err, IsNil)
+	c.Assert(string(key), Equals, `{"$numberInt":"1"}`)
+	key, err = kafkaMessageKey(line, []string{"region", "name"}, false)
+	c.Assert(err, IsNil)
+	c.Assert(string(key), Equals, `["eu","a"]`)
+	_, err = kafkaMessageKey(line, []string{"missing"}, false)
+	c.Assert(err, ErrorMatches, "kafka key column `missing` isn't in the row")
+
+	event := []byte(`{"op":"r","after":{"id":7,"name":null},"source":{"db":"test","table":"t","ts_ms":0,"tso":null}}`)
+	key, err = kafkaMessageKey(event, []string{"id"}, true)
+	c.Assert(err, IsNil)
+	c.Assert(string(key), Equals, `7`)
+}
+
+func (s *testUtilSuite) TestKafkaSinkStorage(c *C) {
+	conf := DefaultConfig()
+	conf.FileType = FileFormatChangeFeedString
+	conf.KafkaTopic = "dump"
+	conf.KafkaOnly = true
+	producer := &mockKafkaProducer{}
+	sink := &kafkaSink{conf: conf, producer: producer}
+	ctx := context.Background()
+
+	// the files aren't written with KafkaOnly
+	meta := &tableMeta{database: "test", table: "t", kafkaKeyColumns: []string{"id"}}
+	w, err := sink.storage(nil, meta).Create(ctx, "test.t.000000000.json")
+	c.Assert(err, IsNil)
+	// the lines may be split across the writes
+	_, err = w.Write(ctx, []byte(`{"op":"r","after":{"id":1}}`+"\n"+`{"op":"r","aft`))
+	c.Assert(err, IsNil)
+	_, err = w.Write(ctx, []byte(`er":{"id":2}}`+"\n"+`{"op":"r","after":{"id":3}}`))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(ctx), IsNil)
+
+	c.Assert(producer.calls, Equals, 3)
+	c.Assert(producer.messages, HasLen, 3)
+	for i, msg := range producer.messages {
+		c.Assert(string(msg.Key), Equals, string(rune('1'+i)))
+	}
+	c.Assert(string(producer.messages[1].Value), Equals, `{"op":"r","after":{"id":2}}`)
+
+	// the messages have no key without the primary key
+	producer.messages = nil
+	w, err = sink.storage(nil, &tableMeta{database: "test", table: "t"}).Create(ctx, "test.t.000000001.json")
+	c.Assert(err, IsNil)
+	_, err = w.Write(ctx, []byte(`{"op":"r","after":{"id":4}}`+"\n"))
+	c.Assert(err, IsNil)
+	c.Assert(producer.messages, HasLen, 1)
+	c.Assert(producer.messages[0].Key, IsNil)
+
+	producer.err = errors.New("broker unavailable")
+	_, err = w.Write(ctx, []byte(`{"op":"r","after":{"id":5}}`+"\n"))
+	c.Assert(err, ErrorMatches, "fail to produce into kafka topic dump: broker unavailable")
+}
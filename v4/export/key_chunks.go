@@ -0,0 +1,131 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// concurrentDumpTableByKey splits the table by its primary key which has no numeric column, e.g. a VARCHAR UUID or
+// a composite key of strings. The chunks are the lexicographic ranges between the cut points of the key, like the
+// handle values of TiDB. The columns of the primary key are never NULL, so no chunk has to cover NULL values.
+func (d *Dumper) concurrentDumpTableByKey(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta, taskChan chan<- Task,
+	keyColumns, keyColTypes []string, rows uint64) error {
+	conf := d.conf
+	db, tbl := meta.DatabaseName(), meta.TableName()
+	if !conf.SkipEstimate {
+		count := estimateCount(tctx, db, tbl, conn, "", conf)
+		if count < rows {
+			tctx.L().Warn("skip concurrent dump due to estimate count < rows",
+				zap.Uint64("estimate count", count),
+				zap.Uint64("conf.rows", rows),
+				zap.String("database", db),
+				zap.String("table", tbl))
+			return d.dumpWholeTableDirectly(tctx, conn, meta, taskChan, "", 0, 1)
+		}
+	}
+	cutPoints, err := selectKeyCutPoints(tctx, conn, conf, db, tbl, keyColumns, keyColTypes, rows)
+	if err != nil {
+		return err
+	}
+	tctx.L().Debug("get key cut points", zap.String("database", db), zap.String("table", tbl),
+		zap.Strings("key", keyColumns), zap.Int("cut points", len(cutPoints)))
+	return d.sendConcurrentDumpTiDBTasks(tctx, conn, meta, taskChan, keyColumns, cutPoints, "", 0, len(cutPoints)+1)
+}
+
+// selectKeyCutPoints selects the cut points which split the table into chunks of rows rows by the key columns.
+// Each cut point is the key of the rows-th row after the previous one in the order of the key, which is sought
+// from the previous cut point by keyset pagination, so finding a cut point reads rows keys instead of skipping all
+// the rows before it. The points are ordered and compared by the collations of the columns in the server, so the
+// chunks neither overlap nor miss any rows whatever the byte order of the values is. The values are the SQL
+// literals to build the range predicates.
+func selectKeyCutPoints(tctx *tcontext.Context, conn *sql.Conn, conf *Config, db, tbl string,
+	keyColumns, keyColTypes []string, rows uint64) ([][]string, error) {
+	quotaCols := make([]string, len(keyColumns))
+	for i, col := range keyColumns {
+		quotaCols[i] = wrapBackTicks(escapeString(col))
+	}
+	var (
+		cutPoints [][]string
+		last      []string
+		buf       = new(bytes.Buffer)
+	)
+	for {
+		// the first chunk starts from the first row, while the others start from the previous cut point
+		// which isn't selected again
+		limit := rows
+		if last == nil {
+			limit++
+		}
+		query := buildKeyCutPointQuery(conf, db, tbl, quotaCols, last, limit)
+		point, err := selectKeyCutPoint(tctx, conn, query, keyColTypes, limit, buf)
+		if err != nil {
+			return nil, err
+		}
+		if point == nil {
+			return cutPoints, nil
+		}
+		cutPoints = append(cutPoints, point)
+		last = point
+	}
+}
+
+// buildKeyCutPointQuery builds the query of the keys of the next limit rows after last, or from the first row
+// if last is nil. The rows are ordered by the collations of the columns, which the range predicates of the chunks
+// compare by too.
+func buildKeyCutPointQuery(conf *Config, db, tbl string, quotaCols, last []string, limit uint64) string {
+	var conditions []string
+	if conf.Where != "" {
+		conditions = append(conditions, "("+conf.Where+")")
+	}
+	if last != nil {
+		buf := new(bytes.Buffer)
+		buildCompareClause(buf, quotaCols, last, greater, false)
+		conditions = append(conditions, "("+buf.String()+")")
+	}
+	cols := strings.Join(quotaCols, ",")
+	query := fmt.Sprintf("SELECT %s FROM `%s`.`%s`", cols, escapeString(db), escapeString(tbl))
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return fmt.Sprintf("%s ORDER BY %s LIMIT %d", query, cols, limit)
+}
+
+// selectKeyCutPoint returns the key of the last row selected by query as SQL literals. It's nil if query selects
+// fewer than limit rows, then the rest of the table is the last chunk.
+func selectKeyCutPoint(tctx *tcontext.Context, conn *sql.Conn, query string, keyColTypes []string, limit uint64,
+	buf *bytes.Buffer) ([]string, error) {
+	rows, err := conn.QueryContext(tctx, query)
+	if err != nil {
+		return nil, errors.Annotatef(err, "sql: %s", query)
+	}
+	iter := newRowIter(rows, len(keyColTypes))
+	defer iter.Close()
+	var count uint64
+	for ; iter.HasNext(); iter.Next() {
+		// only the last row is decoded, the keys before it are skipped on the client
+		if count++; count < limit {
+			continue
+		}
+		rowRec := MakeRowReceiver(keyColTypes)
+		if err = iter.Decode(rowRec); err != nil {
+			return nil, errors.Annotatef(err, "sql: %s", query)
+		}
+		point := make([]string, 0, len(keyColTypes))
+		for _, rec := range rowRec.receivers {
+			rec.WriteToBuffer(buf, true)
+			point = append(point, buf.String())
+			buf.Reset()
+		}
+		return point, nil
+	}
+	return nil, errors.Annotatef(iter.Error(), "sql: %s", query)
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"regexp"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestConcurrentDumpTableByStringKey(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.Rows = 2
+	conf.SkipEstimate = true
+	conf.VerifyCoverage = true
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "test", table: "fruits", selectedField: "*"}
+
+	// the rows are Äpfel, apple, Apricot, banana and Zucchini in the order of utf8mb4_0900_ai_ci, while Äpfel would be
+	// the last one and apple after Zucchini in the byte order, so the cut points must be kept in the order of the server
+	mock.ExpectQuery("SELECT column_name FROM information_schema.columns").WithArgs("test", "fruits", "PRI").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.columns").WithArgs("test", "fruits", "UNI").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}))
+	mock.ExpectQuery("SELECT c.COLUMN_NAME, DATA_TYPE FROM").WithArgs("test", "fruits").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE"}).AddRow("name", "varchar"))
+	// the cut points are sought from the previous ones, the last key of each page is the next cut point
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `name` FROM `test`.`fruits` ORDER BY `name` LIMIT 3")).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Äpfel").AddRow("apple").AddRow("Apricot"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `name` FROM `test`.`fruits` WHERE (`name`>'Apricot') ORDER BY `name` LIMIT 2")).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("banana").AddRow("Zucchini"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `name` FROM `test`.`fruits` WHERE (`name`>'Zucchini') ORDER BY `name` LIMIT 2")).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+	mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "fruits").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "EXTRA"}).AddRow("name", ""))
+
+	taskChan := make(chan Task, 8)
+	c.Assert(d.concurrentDumpTable(tctx, conn, meta, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	var queries []string
+	for task := range taskChan {
+		td := task.(*TaskTableData)
+		c.Assert(td.TotalChunks, Equals, 3)
+		c.Assert(td.keyColumns, DeepEquals, []string{"name"})
+		queries = append(queries, td.Data.(*tableData).query)
+	}
+	c.Assert(queries, DeepEquals, []string{
+		"SELECT * FROM `test`.`fruits` WHERE (`name`<'Apricot') ORDER BY `name`",
+		"SELECT * FROM `test`.`fruits` WHERE (`name`>='Apricot' and `name`<'Zucchini') ORDER BY `name`",
+		"SELECT * FROM `test`.`fruits` WHERE (`name`>='Zucchini') ORDER BY `name`",
+	})
+}
+
+func (s *testSQLSuite) TestBuildKeyCutPointQuery(c *C) {
+	conf := DefaultConfig()
+	quotaCols := []string{"`tenant`", "`id`"}
+	c.Assert(buildKeyCutPointQuery(conf, "test", "t", quotaCols, nil, 100), Equals,
+		"SELECT `tenant`,`id` FROM `test`.`t` ORDER BY `tenant`,`id` LIMIT 100")
+	conf.Where = "tenant <> 'x' OR id = 'y'"
+	c.Assert(buildKeyCutPointQuery(conf, "test", "t", quotaCols, []string{"'a'", "'it''s'"}, 100), Equals,
+		"SELECT `tenant`,`id` FROM `test`.`t` WHERE (tenant <> 'x' OR id = 'y') AND "+
+			"(`tenant`>'a' or(`tenant`='a' and `id`>'it''s')) ORDER BY `tenant`,`id` LIMIT 100")
+}
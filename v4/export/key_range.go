@@ -0,0 +1,129 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import "math/big"
+
+// catalogKeyRange is the range [Min, Max] of the ordering key of the rows in a data file
+type catalogKeyRange struct {
+	File string   `json:"file"`
+	Min  []string `json:"min"`
+	Max  []string `json:"max"`
+}
+
+// chunkKeyColumnsOf returns the ordering key which the rows of a chunk are split by, it's empty if the table isn't split
+func chunkKeyColumnsOf(keyColumns []string, chunkField string) []string {
+	if len(keyColumns) > 0 {
+		return keyColumns
+	}
+	if chunkField != "" {
+		return []string{chunkField}
+	}
+	return nil
+}
+
+// keyRangeOfChunk returns the range of the integer key of a chunk built from its WHERE bounds [lower, upper)
+func keyRangeOfChunk(r *chunkKeyRange) (min, max []string) {
+	upper := new(big.Int).Sub(r.upper, big.NewInt(1))
+	return []string{r.lower.String()}, []string{upper.String()}
+}
+
+// compareKeys compares the keys column by column with compareChunkValues
+func compareKeys(a [][]byte, b []string) int {
+	for i := range a {
+		if c := compareChunkValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// keyRangeIR observes the min and max ordering keys of the rows of a data file when they are decoded.
+// The rows whose key contains NULL aren't observed.
+type keyRangeIR struct {
+	TableDataIR
+	keyIndices []int
+
+	min, max []string
+}
+
+func newKeyRangeIR(ir TableDataIR, keyIndices []int) *keyRangeIR {
+	return &keyRangeIR{TableDataIR: ir, keyIndices: keyIndices}
+}
+
+// reset starts observing the keys of a new data file
+func (k *keyRangeIR) reset() {
+	k.min, k.max = nil, nil
+}
+
+// Rows implements TableDataIR.Rows
+func (k *keyRangeIR) Rows() SQLRowIter {
+	return &keyRangeRowIter{SQLRowIter: k.TableDataIR.Rows(), ir: k}
+}
+
+type keyRangeRowIter struct {
+	SQLRowIter
+	ir *keyRangeIR
+}
+
+// Decode implements SQLRowIter.Decode
+func (it *keyRangeRowIter) Decode(row RowReceiver) error {
+	if err := it.SQLRowIter.Decode(row); err != nil {
+		return err
+	}
+	ir := it.ir
+	arr, ok := row.(RowReceiverArr)
+	if !ok {
+		return nil
+	}
+	key := make([][]byte, len(ir.keyIndices))
+	for i, idx := range ir.keyIndices {
+		if idx >= len(arr.receivers) {
+			return nil
+		}
+		key[i] = receiverRawBytes(arr.receivers[idx])
+		if key[i] == nil {
+			return nil
+		}
+	}
+	if ir.min == nil || compareKeys(key, ir.min) < 0 {
+		ir.min = keyStrings(key)
+	}
+	if ir.max == nil || compareKeys(key, ir.max) > 0 {
+		ir.max = keyStrings(key)
+	}
+	return nil
+}
+
+func keyStrings(key [][]byte) []string {
+	s := make([]string, len(key))
+	for i, v := range key {
+		s[i] = string(v)
+	}
+	return s
+}
+
+// addKeyRange records the range of the ordering key of a data file of the table
+func (r *catalogRecorder) addKeyRange(db, table string, keyColumns []string, keyRange catalogKeyRange) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.table(db, table)
+	t.KeyColumns = keyColumns
+	t.KeyRanges = append(t.KeyRanges, keyRange)
+}
+
+// fileKeyRange returns the range of the ordering key of the data file just written. The WHERE bounds of
+// the chunk are used if the chunk is written into one file, otherwise the keys observed by keyIR are used.
+func (w *Writer) fileKeyRange(keyIR *keyRangeIR) (min, max []string, ok bool) {
+	if w.keyRange != nil && w.conf.FileSize == UnspecifiedSize {
+		min, max = keyRangeOfChunk(w.keyRange)
+		return min, max, true
+	}
+	if keyIR != nil && keyIR.min != nil {
+		return keyIR.min, keyIR.max, true
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+const lightningConfigPath = "tidb-lightning.toml"
+
+// lightningConfigHeader describes the placeholders of the target in the generated config
+const lightningConfigHeader = `# The config of tidb-lightning to restore the dump, run it by
+#   tidb-lightning --config tidb-lightning.toml
+# The [tidb] section and tikv-importer.sorted-kv-dir are placeholders of the target, change them before running it.
+`
+
+type lightningConfig struct {
+	Lightning    lightningSection         `toml:"lightning"`
+	TikvImporter lightningImporterSection `toml:"tikv-importer"`
+	Mydumper     lightningMydumperSection `toml:"mydumper"`
+	TiDB         lightningTiDBSection     `toml:"tidb"`
+}
+
+type lightningSection struct {
+	Level string `toml:"level"`
+	File  string `toml:"file"`
+}
+
+type lightningImporterSection struct {
+	Backend     string `toml:"backend"`
+	SortedKVDir string `toml:"sorted-kv-dir"`
+}
+
+type lightningMydumperSection struct {
+	DataSourceDir string `toml:"data-source-dir"`
+	NoSchema      bool   `toml:"no-schema"`
+	// CSV is absent for the sql file type
+	CSV *lightningCSVSection `toml:"csv"`
+}
+
+type lightningCSVSection struct {
+	Separator         string `toml:"separator"`
+	Delimiter         string `toml:"delimiter"`
+	Null              string `toml:"null"`
+	Header            bool   `toml:"header"`
+	NotNull           bool   `toml:"not-null"`
+	BackslashEscape   bool   `toml:"backslash-escape"`
+	TrimLastSeparator bool   `toml:"trim-last-separator"`
+}
+
+type lightningTiDBSection struct {
+	Host       string `toml:"host"`
+	Port       int    `toml:"port"`
+	User       string `toml:"user"`
+	Password   string `toml:"password"`
+	StatusPort int    `toml:"status-port"`
+	PDAddr     string `toml:"pd-addr"`
+}
+
+// newLightningConfig builds the config of tidb-lightning reading the files of the dump in the mydumper source type
+func newLightningConfig(conf *Config) (*lightningConfig, error) {
+	location, err := outputLocation(conf)
+	if err != nil {
+		return nil, err
+	}
+	c := &lightningConfig{
+		Lightning:    lightningSection{Level: "info", File: "tidb-lightning.log"},
+		TikvImporter: lightningImporterSection{Backend: "local", SortedKVDir: "/path/to/sorted-kv-dir"},
+		Mydumper:     lightningMydumperSection{DataSourceDir: location, NoSchema: conf.NoSchemas},
+		TiDB: lightningTiDBSection{
+			Host:       "127.0.0.1",
+			Port:       4000,
+			User:       "root",
+			StatusPort: 10080,
+			PDAddr:     "127.0.0.1:2379",
+		},
+	}
+	if conf.FileType == FileFormatCSVString {
+		c.Mydumper.CSV = &lightningCSVSection{
+			Separator:       conf.CsvSeparator,
+			Delimiter:       conf.CsvDelimiter,
+			Null:            conf.CsvNullValue,
+			Header:          !conf.NoHeader,
+			BackslashEscape: conf.EscapeBackslash,
+		}
+	}
+	return c, nil
+}
+
+// lightningFileNotes returns the comments about the layout of the files which tidb-lightning can't be configured by
+func lightningFileNotes(conf *Config) (string, error) {
+	var notes string
+	namer := newOutputFileNamer(&tableMeta{database: "db", table: "t"}, 0, false, false)
+	fileName, err := namer.render(conf.OutputFileTemplate, outputFileTemplateData)
+	if err != nil {
+		return "", err
+	}
+	defaultName, err := namer.render(DefaultOutputFileTemplate, outputFileTemplateData)
+	if err != nil {
+		return "", err
+	}
+	if fileName != defaultName {
+		notes += "# The data files are named by a custom output filename template, add the [[mydumper.files]] rules to route them.\n"
+	}
+	if conf.CompressType != CompressNone {
+		notes += "# The data files are compressed by " + compressTypeName(conf.CompressType) +
+			", use a version of tidb-lightning which reads the compressed files.\n"
+	}
+	return notes, nil
+}
+
+// writeLightningConfig writes the config of tidb-lightning restoring the dump into lightningConfigPath
+func writeLightningConfig(tctx *tcontext.Context, extStore storage.ExternalStorage, conf *Config) error {
+	c, err := newLightningConfig(conf)
+	if err != nil {
+		return err
+	}
+	notes, err := lightningFileNotes(conf)
+	if err != nil {
+		return err
+	}
+	var bf bytes.Buffer
+	bf.WriteString(lightningConfigHeader)
+	bf.WriteString(notes)
+	bf.WriteString("\n")
+	enc := toml.NewEncoder(&bf)
+	enc.Indent = ""
+	if err = enc.Encode(c); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(extStore.WriteFile(tctx, lightningConfigPath, bf.Bytes()))
+}
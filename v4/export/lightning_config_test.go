@@ -0,0 +1,53 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestWriteLightningConfig(c *C) {
+	dir := c.MkDir()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = dir
+	extStore, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	target := "\n[tidb]\n" +
+		"host = \"127.0.0.1\"\nport = 4000\nuser = \"root\"\npassword = \"\"\nstatus-port = 10080\npd-addr = \"127.0.0.1:2379\"\n"
+
+	c.Assert(writeLightningConfig(tctx, extStore, conf), IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(dir, lightningConfigPath))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, lightningConfigHeader+"\n"+
+		"[lightning]\nlevel = \"info\"\nfile = \"tidb-lightning.log\"\n"+
+		"\n[tikv-importer]\nbackend = \"local\"\nsorted-kv-dir = \"/path/to/sorted-kv-dir\"\n"+
+		"\n[mydumper]\ndata-source-dir = \""+dir+"\"\nno-schema = false\n"+
+		target)
+
+	conf.FileType = FileFormatCSVString
+	conf.CsvSeparator, conf.CsvDelimiter, conf.CsvNullValue, conf.EscapeBackslash = ",", "\"", "\\N", true
+	conf.CompressType = CompressGzip
+	conf.NoSchemas = true
+	conf.OutputDirPath = "s3://bucket/dump?region=us-west-2"
+	conf.OutputFileTemplate, err = ParseOutputFileTemplate("{{fn .DB}}-{{fn .Table}}-{{.Index}}")
+	c.Assert(err, IsNil)
+	c.Assert(writeLightningConfig(tctx, extStore, conf), IsNil)
+	data, err = ioutil.ReadFile(filepath.Join(dir, lightningConfigPath))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, lightningConfigHeader+
+		"# The data files are named by a custom output filename template, add the [[mydumper.files]] rules to route them.\n"+
+		"# The data files are compressed by gzip, use a version of tidb-lightning which reads the compressed files.\n\n"+
+		"[lightning]\nlevel = \"info\"\nfile = \"tidb-lightning.log\"\n"+
+		"\n[tikv-importer]\nbackend = \"local\"\nsorted-kv-dir = \"/path/to/sorted-kv-dir\"\n"+
+		"\n[mydumper]\ndata-source-dir = \"s3://bucket/dump?region=us-west-2\"\nno-schema = true\n"+
+		"[mydumper.csv]\nseparator = \",\"\ndelimiter = \"\\\"\"\nnull = \"\\\\N\"\nheader = true\n"+
+		"not-null = false\nbackslash-escape = true\ntrim-last-separator = false\n"+
+		target)
+}
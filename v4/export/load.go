@@ -0,0 +1,357 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/summary"
+	"github.com/pingcap/br/pkg/utils"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.uber.org/zap"
+)
+
+const (
+	// loadedRowsUnit is the name of the rows loaded into Config.TargetDSN in the summary
+	loadedRowsUnit = "loaded rows"
+	// loadErrorStatementLength is how long the statement failing to load is kept in the error
+	loadErrorStatementLength = 256
+)
+
+// loader executes the SQL dumped against Config.TargetDSN, so the data is migrated without intermediate storage.
+// The schemas are loaded by the dumper in order before their data is sent to the writers, and the data files
+// are loaded by the writers in parallel while they're written.
+type loader struct {
+	conf *Config
+	pool *sql.DB
+}
+
+func newLoader(tctx *tcontext.Context, conf *Config) (*loader, error) {
+	pool, err := sql.Open("mysql", conf.TargetDSN)
+	if err != nil {
+		return nil, errors.Annotate(err, "invalid target DSN")
+	}
+	if err = pool.PingContext(tctx); err != nil {
+		pool.Close()
+		return nil, errors.Annotate(err, "fail to connect to the target")
+	}
+	return &loader{conf: conf, pool: pool}, nil
+}
+
+func (l *loader) close() error {
+	if l == nil {
+		return nil
+	}
+	return l.pool.Close()
+}
+
+// loadSchema loads the schema of a database, table, view or sequence task into the target, other tasks are ignored
+func (l *loader) loadSchema(tctx *tcontext.Context, task Task) error {
+	if l == nil || l.conf.NoSchemas {
+		return nil
+	}
+	var (
+		db    string
+		stmts []string
+	)
+	switch t := task.(type) {
+	case *TaskDatabaseMeta:
+		stmts = []string{t.CreateDatabaseSQL}
+	case *TaskTableMeta:
+		db, stmts = t.DatabaseName, []string{t.CreateTableSQL}
+	case *TaskViewMeta:
+		db, stmts = t.DatabaseName, []string{t.CreateTableSQL, t.CreateViewSQL}
+	case *TaskSequenceMeta:
+		db, stmts = t.DatabaseName, []string{t.CreateSequenceSQL, t.SetValueSQL}
+	default:
+		return nil
+	}
+	s := l.newSession(tctx, db)
+	defer s.close()
+	if err := s.exec("/*!40101 SET NAMES binary*/"); err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		// the placeholder table and the definition of a view in a cycle are loaded by separate tasks
+		if stmt == "" {
+			continue
+		}
+		if err := s.write([]byte(stmt)); err != nil {
+			return err
+		}
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+	tctx.L().Debug("loaded schema into target", zap.String("task", task.Brief()))
+	return nil
+}
+
+// storage returns the storage which loads the files created for the data of meta into the target while they're
+// written into s. The files aren't written into s with Config.LoadOnly.
+func (l *loader) storage(s storage.ExternalStorage, meta TableMeta) storage.ExternalStorage {
+	if l == nil {
+		return s
+	}
+	return &loadStorage{ExternalStorage: s, loader: l, meta: meta}
+}
+
+type loadStorage struct {
+	storage.ExternalStorage
+	loader *loader
+	meta   TableMeta
+}
+
+// Create implements ExternalStorage.Create
+func (s *loadStorage) Create(ctx context.Context, path string) (storage.ExternalFileWriter, error) {
+	w := &loadFileWriter{session: s.loader.newSession(tcontext.Background().WithContext(ctx), s.meta.DatabaseName())}
+	if !s.loader.conf.LoadOnly {
+		var err error
+		if w.ExternalFileWriter, err = s.ExternalStorage.Create(ctx, path); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// loadFileWriter executes the statements written into it against the target
+type loadFileWriter struct {
+	storage.ExternalFileWriter
+	session *loadSession
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *loadFileWriter) Write(ctx context.Context, p []byte) (int, error) {
+	if w.ExternalFileWriter != nil {
+		if n, err := w.ExternalFileWriter.Write(ctx, p); err != nil {
+			return n, err
+		}
+	}
+	if err := w.session.write(p); err != nil {
+		return 0, newWriterError(err)
+	}
+	return len(p), nil
+}
+
+// Close implements ExternalFileWriter.Close
+func (w *loadFileWriter) Close(ctx context.Context) error {
+	err := w.session.flush()
+	w.session.close()
+	if w.ExternalFileWriter != nil {
+		if closeErr := w.ExternalFileWriter.Close(ctx); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// loadSession executes the statements of a file on a connection of the target. The session settings like
+// SET NAMES are executed again if the connection is rebuilt to retry a statement.
+type loadSession struct {
+	tctx     *tcontext.Context
+	loader   *loader
+	db       string
+	splitter sqlStatementSplitter
+
+	conn  *sql.Conn
+	setup []string
+	rows  uint64
+}
+
+func (l *loader) newSession(tctx *tcontext.Context, db string) *loadSession {
+	return &loadSession{
+		tctx:     tctx,
+		loader:   l,
+		db:       db,
+		splitter: sqlStatementSplitter{escapeBackslash: l.conf.EscapeBackslash},
+	}
+}
+
+func (s *loadSession) write(p []byte) error {
+	return s.splitter.feed(p, s.exec)
+}
+
+// flush executes the last statement which isn't terminated by a semicolon
+func (s *loadSession) flush() error {
+	return s.splitter.finish(s.exec)
+}
+
+func (s *loadSession) connect() error {
+	conn, err := s.loader.pool.Conn(s.tctx)
+	if err != nil {
+		return errors.Annotate(err, "fail to connect to the target")
+	}
+	stmts := s.setup
+	if s.db != "" {
+		stmts = append([]string{"USE " + wrapBackTicks(escapeString(s.db))}, stmts...)
+	}
+	for _, stmt := range stmts {
+		if _, err = conn.ExecContext(s.tctx, stmt); err != nil {
+			conn.Close()
+			return errors.Annotatef(err, "fail to load into the target, sql: %s", stmt)
+		}
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *loadSession) exec(stmt string) error {
+	return utils.WithRetry(s.tctx, func() error {
+		if s.conn == nil {
+			if err := s.connect(); err != nil {
+				return err
+			}
+		}
+		result, err := s.conn.ExecContext(s.tctx, stmt)
+		if err != nil {
+			s.conn.Close()
+			s.conn = nil
+			shortStmt := stmt
+			if len(shortStmt) > loadErrorStatementLength {
+				shortStmt = shortStmt[:loadErrorStatementLength] + "..."
+			}
+			return errors.Annotatef(err, "fail to load into the target, sql: %s", shortStmt)
+		}
+		if isSessionStatement(stmt) {
+			s.setup = append(s.setup, stmt)
+		}
+		if rows, err := result.RowsAffected(); err == nil && (hasPrefixFold(stmt, "INSERT") || hasPrefixFold(stmt, safeModeInsertKeyword)) {
+			s.rows += uint64(rows)
+		}
+		return nil
+	}, newLoadBackoffer())
+}
+
+// newLoadBackoffer returns the backoffer of the statements loaded into the target, which only retries them on
+// the errors classified by isRetryableLoadError
+func newLoadBackoffer() *dumpChunkBackoffer {
+	b := newDumpChunkBackoffer(true)
+	b.isRetryable = isRetryableLoadError
+	return b
+}
+
+// isRetryableLoadError checks whether a statement failed to load by err can be executed again on a new
+// connection, e.g. on a bad connection or a deadlock. The other errors like duplicate keys or syntax errors
+// fail again however many times the statement is retried.
+func isRetryableLoadError(err error) bool {
+	err = errors.Cause(err)
+	if _, ok := err.(*mysql.MySQLError); ok {
+		return dbutil.IsRetryableError(err)
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return err == driver.ErrBadConn || err == mysql.ErrInvalidConn || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+func (s *loadSession) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	if s.rows > 0 {
+		summary.CollectSuccessUnit(loadedRowsUnit, 1, s.rows)
+		s.rows = 0
+	}
+}
+
+// isSessionStatement checks whether stmt sets the session, like the special comments at the head of the files
+func isSessionStatement(stmt string) bool {
+	return strings.HasPrefix(stmt, "/*!") || hasPrefixFold(stmt, "SET ") || hasPrefixFold(stmt, "USE ")
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// sqlStatementSplitter splits the SQL written by Dumpling into statements by the semicolons outside of
+// the quoted strings, identifiers and comments. It's fed with the SQL piece by piece as the files are written.
+type sqlStatementSplitter struct {
+	escapeBackslash bool
+
+	stmt bytes.Buffer
+	// quote is the quote of the string or identifier being split, it's 0 outside of quotes
+	quote          byte
+	escaped        bool
+	inBlockComment bool
+	inLineComment  bool
+	// hasContent is false if the statement being split only has whitespaces and line comments
+	hasContent bool
+	prev       byte
+}
+
+func (s *sqlStatementSplitter) feed(p []byte, fn func(stmt string) error) error {
+	for _, c := range p {
+		prev := s.prev
+		s.prev = c
+		switch {
+		case s.inLineComment:
+			s.inLineComment = c != '\n'
+		case s.inBlockComment:
+			s.inBlockComment = !(prev == '*' && c == '/')
+			s.stmt.WriteByte(c)
+		case s.quote != 0:
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case c == '\\' && s.quote != '`' && s.escapeBackslash:
+				s.escaped = true
+			case c == s.quote:
+				s.quote = 0
+			}
+			s.stmt.WriteByte(c)
+		case c == '-' && prev == '-' && !s.hasContent:
+			// the line comments before the statements like the annotations of the files are dropped
+			s.inLineComment = true
+			s.stmt.Truncate(s.stmt.Len() - 1)
+			s.prev = 0
+		case c == ';':
+			if err := s.emit(fn); err != nil {
+				return err
+			}
+		default:
+			if c == '\'' || c == '"' || c == '`' {
+				s.quote = c
+			} else if c == '*' && prev == '/' {
+				s.inBlockComment = true
+				// the "*/" shouldn't close the comment by the '*' of "/*"
+				s.prev = 0
+			}
+			if c != '-' && c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				s.hasContent = true
+			}
+			s.stmt.WriteByte(c)
+		}
+	}
+	return nil
+}
+
+// finish emits the statement left without the terminating semicolon
+func (s *sqlStatementSplitter) finish(fn func(stmt string) error) error {
+	if s.quote != 0 || s.inBlockComment {
+		return errors.Errorf("the sql to load is incomplete: %s", fmt.Sprintf("%.*s", loadErrorStatementLength, s.stmt.String()))
+	}
+	return s.emit(fn)
+}
+
+func (s *sqlStatementSplitter) emit(fn func(stmt string) error) error {
+	stmt, hasContent := strings.TrimSpace(s.stmt.String()), s.hasContent
+	s.stmt.Reset()
+	s.hasContent, s.inLineComment, s.prev = false, false, 0
+	if !hasContent || stmt == "" {
+		return nil
+	}
+	return fn(stmt)
+}
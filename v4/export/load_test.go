@@ -0,0 +1,105 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/errno"
+)
+
+func (s *testUtilSuite) TestSQLStatementSplitter(c *C) {
+	sql := "-- Table: `test`.`t` (2 rows est.)\n" +
+		"/*!40101 SET NAMES binary*/;\n" +
+		"INSERT INTO `t;1` VALUES\n" +
+		"(1,'a;\\'b',\"c;\"),\n" +
+		"(2,'it''s;',x'3b');\n" +
+		"/* comment; */ INSERT INTO `t` VALUES (-1,'--')"
+	expected := []string{
+		"/*!40101 SET NAMES binary*/",
+		"INSERT INTO `t;1` VALUES\n(1,'a;\\'b',\"c;\"),\n(2,'it''s;',x'3b')",
+		"/* comment; */ INSERT INTO `t` VALUES (-1,'--')",
+	}
+	// the statements are split the same however the sql is fed
+	for _, size := range []int{1, 7, len(sql)} {
+		splitter := sqlStatementSplitter{escapeBackslash: true}
+		var stmts []string
+		collect := func(stmt string) error {
+			stmts = append(stmts, stmt)
+			return nil
+		}
+		for i := 0; i < len(sql); i += size {
+			end := i + size
+			if end > len(sql) {
+				end = len(sql)
+			}
+			c.Assert(splitter.feed([]byte(sql[i:end]), collect), IsNil)
+		}
+		c.Assert(splitter.finish(collect), IsNil)
+		c.Assert(stmts, DeepEquals, expected)
+	}
+
+	splitter := sqlStatementSplitter{escapeBackslash: true}
+	c.Assert(splitter.feed([]byte("INSERT INTO `t` VALUES ('a"), nil), IsNil)
+	c.Assert(splitter.finish(nil), ErrorMatches, "the sql to load is incomplete: .*")
+}
+
+func (s *testUtilSuite) TestLoadSchemaAndData(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.LoadOnly = true
+	l := &loader{conf: conf, pool: db}
+
+	mock.ExpectExec(regexp.QuoteMeta("USE `test`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("/*!40101 SET NAMES binary*/")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `t` (`a` int)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	c.Assert(l.loadSchema(tctx, NewTaskTableMeta("test", "t", "CREATE TABLE `t` (`a` int)")), IsNil)
+
+	mock.ExpectExec(regexp.QuoteMeta("USE `test`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("/*!40101 SET NAMES binary*/")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `t` VALUES\n(1),\n(2)")).WillReturnResult(sqlmock.NewResult(0, 2))
+	// the files aren't written with LoadOnly
+	extStore := l.storage(nil, &tableMeta{database: "test", table: "t"})
+	w, err := extStore.Create(context.Background(), "test.t.000000000.sql")
+	c.Assert(err, IsNil)
+	_, err = w.Write(context.Background(), []byte("/*!40101 SET NAMES binary*/;\nINSERT INTO `t` VALUES\n(1),\n(2);\n"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(context.Background()), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testUtilSuite) TestLoadRetry(c *C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.LoadOnly = true
+	l := &loader{conf: conf, pool: db}
+	session := l.newSession(tctx, "")
+	defer session.close()
+
+	// the whole statement is executed again on a new connection, only the error shortens it
+	stmt := "INSERT INTO `t` VALUES (" + strings.Repeat("1", loadErrorStatementLength) + ")"
+	mock.ExpectExec(stmt).WillReturnError(mysql.ErrInvalidConn)
+	mock.ExpectExec(stmt).WillReturnError(&mysql.MySQLError{Number: errno.ErrLockDeadlock, Message: "Deadlock found"})
+	mock.ExpectExec(stmt).WillReturnResult(sqlmock.NewResult(0, 1))
+	c.Assert(session.exec(stmt), IsNil)
+	c.Assert(session.rows, Equals, uint64(1))
+
+	// the statement isn't retried on the errors failing again
+	mock.ExpectExec(stmt).WillReturnError(&mysql.MySQLError{Number: errno.ErrDupEntry, Message: "Duplicate entry '1'"})
+	err = session.exec(stmt)
+	c.Assert(err, ErrorMatches, regexp.QuoteMeta("fail to load into the target, sql: "+stmt[:loadErrorStatementLength]+"...")+".*Duplicate entry.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
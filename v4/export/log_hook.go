@@ -0,0 +1,59 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// hookCore is a zap core which calls Config.LogHook with each log entry and its fields
+type hookCore struct {
+	zapcore.LevelEnabler
+	hook   func(level, msg string, fields map[string]interface{})
+	fields []zapcore.Field
+}
+
+// withLogHook returns a logger which calls hook with each entry at or above level, besides writing it to logger
+func withLogHook(logger *zap.Logger, level string, hook func(level, msg string, fields map[string]interface{})) *zap.Logger {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = zapcore.InfoLevel
+	}
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, &hookCore{LevelEnabler: lvl, hook: hook})
+	}))
+}
+
+// With implements zapcore.Core.With
+func (c *hookCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(append([]zapcore.Field(nil), c.fields...), fields...)
+	return &clone
+}
+
+// Check implements zapcore.Core.Check
+func (c *hookCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core.Write
+func (c *hookCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	c.hook(ent.Level.String(), ent.Message, enc.Fields)
+	return nil
+}
+
+// Sync implements zapcore.Core.Sync
+func (c *hookCore) Sync() error {
+	return nil
+}
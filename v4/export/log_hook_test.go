@@ -0,0 +1,37 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"errors"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	. "github.com/pingcap/check"
+	"go.uber.org/zap"
+)
+
+func (s *testConfigSuite) TestLogHook(c *C) {
+	type entry struct {
+		level, msg string
+		fields     map[string]interface{}
+	}
+	var entries []entry
+	conf := defaultConfigForTest(c)
+	conf.Logger = zap.NewNop()
+	conf.LogLevel = "info"
+	conf.LogHook = func(level, msg string, fields map[string]interface{}) {
+		entries = append(entries, entry{level, msg, fields})
+	}
+	d := &Dumper{tctx: tcontext.Background(), conf: conf}
+	c.Assert(initLogger(d), IsNil)
+
+	logger := d.tctx.L().With(zap.String("database", "test"))
+	logger.Debug("ignored")
+	logger.Info("finish dumping table data task", zap.Int("chunkIdx", 1))
+	logger.Warn("retry", zap.Error(errors.New("timeout")))
+	c.Assert(entries, DeepEquals, []entry{
+		{"info", "finish dumping table data task", map[string]interface{}{"database": "test", "chunkIdx": int64(1)}},
+		{"warn", "retry", map[string]interface{}{"database": "test", "error": "timeout"}},
+	})
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// outputIdentifier returns the identifier name as it's written into the schema, the data and the file names,
+// it's lowercased with Config.LowercaseIdentifiers
+func outputIdentifier(conf *Config, name string) string {
+	if !conf.LowercaseIdentifiers {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+// outputIdentifiers lowercases the backtick quoted identifiers in stmt with Config.LowercaseIdentifiers,
+// e.g. the database, table, column and index names from SHOW CREATE TABLE. The string literals are kept as they are.
+func outputIdentifiers(conf *Config, stmt string) string {
+	if !conf.LowercaseIdentifiers {
+		return stmt
+	}
+	return quotedLiteralPattern.ReplaceAllStringFunc(stmt, func(literal string) string {
+		if literal[0] != '`' {
+			return literal
+		}
+		return strings.ToLower(literal)
+	})
+}
+
+// lowercaseCollisions returns the databases and the tables whose names are the same after they're lowercased,
+// their schemas and data would be restored into the same ones
+func lowercaseCollisions(tables DatabaseTables) []string {
+	var collisions []string
+	dbNames := make(map[string][]string)
+	for db, tbls := range tables {
+		lower := strings.ToLower(db)
+		dbNames[lower] = append(dbNames[lower], db)
+		tableNames := make(map[string][]string)
+		for _, t := range tbls {
+			lowerTable := strings.ToLower(t.Name)
+			tableNames[lowerTable] = append(tableNames[lowerTable], t.Name)
+		}
+		for _, names := range tableNames {
+			if len(names) > 1 {
+				sort.Strings(names)
+				quoted := make([]string, 0, len(names))
+				for _, name := range names {
+					quoted = append(quoted, fmt.Sprintf("`%s`.`%s`", escapeString(db), escapeString(name)))
+				}
+				collisions = append(collisions, strings.Join(quoted, ", "))
+			}
+		}
+	}
+	for _, names := range dbNames {
+		if len(names) > 1 {
+			sort.Strings(names)
+			quoted := make([]string, 0, len(names))
+			for _, name := range names {
+				quoted = append(quoted, wrapBackTicks(escapeString(name)))
+			}
+			collisions = append(collisions, strings.Join(quoted, ", "))
+		}
+	}
+	sort.Strings(collisions)
+	return collisions
+}
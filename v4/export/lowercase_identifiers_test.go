@@ -0,0 +1,45 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"io/ioutil"
+	"path"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestWriteWithLowercaseIdentifiers(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.LowercaseIdentifiers = true
+	writer := s.newWriter(conf, c)
+
+	c.Assert(writer.WriteDatabaseMeta("Shop", "CREATE DATABASE `Shop`"), IsNil)
+	c.Assert(writer.WriteTableMeta("Shop", "Orders", "CREATE TABLE `Orders` (\n  `ID` int,\n  `Note` varchar(8) DEFAULT 'KEEP `Me`'\n)"), IsNil)
+	tableIR := newMockTableIR("Shop", "Orders", [][]driver.Value{{"1", "A"}}, nil, []string{"INT", "VARCHAR"})
+	tableIR.selectedField = "(`ID`,`Note`)"
+	c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+
+	for file, expected := range map[string]string{
+		"shop-schema-create.sql":    "/*!40101 SET NAMES binary*/;\nCREATE DATABASE `shop`;\n",
+		"shop.orders-schema.sql":    "/*!40101 SET NAMES binary*/;\nCREATE TABLE `orders` (\n  `id` int,\n  `note` varchar(8) DEFAULT 'KEEP `Me`'\n);\n",
+		"shop.orders.000000000.sql": "INSERT INTO `orders` (`id`,`note`) VALUES\n(1,'A');\n",
+	} {
+		bytes, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, file))
+		c.Assert(err, IsNil)
+		c.Assert(string(bytes), Equals, expected)
+	}
+}
+
+func (s *testUtilSuite) TestLowercaseCollisions(c *C) {
+	tables := DatabaseTables{}.
+		AppendTables("Shop", "Orders", "orders", "Items").
+		AppendTables("shop", "t").
+		AppendTables("other", "t")
+	c.Assert(lowercaseCollisions(tables), DeepEquals, []string{
+		"`Shop`, `shop`",
+		"`Shop`.`Orders`, `Shop`.`orders`",
+	})
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"unicode/utf8"
+)
+
+const (
+	// truncatedFieldMarker is appended to the values truncated by Config.MaxFieldBytes
+	truncatedFieldMarker = "[truncated]"
+	// minMaxFieldBytes leaves room for the marker in the truncated values, even if they're encoded in base64
+	minMaxFieldBytes = 16
+	// truncatedFieldsUnit is the name of the values truncated by Config.MaxFieldBytes in the summary
+	truncatedFieldsUnit = "truncated fields"
+)
+
+// maxFieldBytesIR truncates the string and binary values longer than Config.MaxFieldBytes when the rows are decoded
+type maxFieldBytesIR struct {
+	TableDataIR
+	maxBytes int
+	// truncated is the number of the values truncated
+	truncated uint64
+}
+
+func newMaxFieldBytesIR(ir TableDataIR, maxBytes int) *maxFieldBytesIR {
+	return &maxFieldBytesIR{TableDataIR: ir, maxBytes: maxBytes}
+}
+
+// Rows implements TableDataIR.Rows
+func (m *maxFieldBytesIR) Rows() SQLRowIter {
+	return &maxFieldBytesRowIter{SQLRowIter: m.TableDataIR.Rows(), ir: m}
+}
+
+type maxFieldBytesRowIter struct {
+	SQLRowIter
+	ir *maxFieldBytesIR
+}
+
+// Decode implements SQLRowIter.Decode
+func (it *maxFieldBytesRowIter) Decode(row RowReceiver) error {
+	if err := it.SQLRowIter.Decode(row); err != nil {
+		return err
+	}
+	arr, ok := row.(RowReceiverArr)
+	if !ok {
+		return nil
+	}
+	maxBytes := it.ir.maxBytes
+	for _, receiver := range arr.receivers {
+		var truncated bool
+		switch r := receiver.(type) {
+		case *SQLTypeString:
+			r.RawBytes, truncated = truncateField(r.RawBytes, maxBytes, true)
+		case *SQLTypeClientSafeString:
+			r.RawBytes, truncated = truncateField(r.RawBytes, maxBytes, true)
+		case *SQLTypeBinaryString:
+			// the value is encoded in base64, every 3 bytes are written as 4 bytes
+			r.RawBytes, truncated = truncateField(r.RawBytes, maxBytes/4*3, false)
+		case *SQLTypeBytes:
+			r.RawBytes, truncated = truncateField(r.RawBytes, maxBytes, false)
+		}
+		if truncated {
+			it.ir.truncated++
+		}
+	}
+	return nil
+}
+
+// truncateField truncates value to maxBytes including truncatedFieldMarker if it's longer than maxBytes.
+// The text isn't cut in the middle of a UTF-8 character. The value is copied since it's owned by the driver.
+func truncateField(value sql.RawBytes, maxBytes int, text bool) (sql.RawBytes, bool) {
+	if len(value) <= maxBytes {
+		return value, false
+	}
+	n := maxBytes - len(truncatedFieldMarker)
+	if text {
+		for n > 0 && !utf8.RuneStart(value[n]) {
+			n--
+		}
+	}
+	truncated := make(sql.RawBytes, 0, n+len(truncatedFieldMarker))
+	truncated = append(truncated, value[:n]...)
+	truncated = append(truncated, truncatedFieldMarker...)
+	return truncated, true
+}
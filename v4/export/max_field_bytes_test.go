@@ -0,0 +1,48 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestTruncateField(c *C) {
+	value, truncated := truncateField([]byte("short"), 16, true)
+	c.Assert(truncated, IsFalse)
+	c.Assert(string(value), Equals, "short")
+
+	value, truncated = truncateField([]byte("0123456789abcdefghij"), 16, false)
+	c.Assert(truncated, IsTrue)
+	c.Assert(string(value), Equals, "01234"+truncatedFieldMarker)
+
+	// the text isn't cut in the middle of a character
+	value, truncated = truncateField([]byte("0123中文字符串"), 16, true)
+	c.Assert(truncated, IsTrue)
+	c.Assert(string(value), Equals, "0123"+truncatedFieldMarker)
+	c.Assert(len(value) <= 16, IsTrue)
+}
+
+func (s *testWriterSuite) TestWriteTableDataWithMaxFieldBytes(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.FileType = FileFormatCSVString
+	conf.CsvSeparator, conf.CsvDelimiter = ",", "\""
+	conf.NoHeader = true
+	conf.MaxFieldBytes = 32
+	c.Assert(adjustMaxFieldBytes(conf), IsNil)
+	writer := s.newWriter(conf, c)
+
+	oversized := strings.Repeat("x", 100000)
+	data := [][]driver.Value{{"1", oversized, nil}, {"2", "bob", "ok"}}
+	tableIR := newMockTableIR("test", "t", data, nil, []string{"INT", "TEXT", "TEXT"})
+	c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+	content, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, "test.t.000000000.csv"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "1,\""+strings.Repeat("x", 32-len(truncatedFieldMarker))+truncatedFieldMarker+"\",\\N\n"+
+		"2,\"bob\",\"ok\"\n")
+}
@@ -7,6 +7,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,6 +24,10 @@ type globalMetadata struct {
 	buffer          bytes.Buffer
 	afterConnBuffer bytes.Buffer
 	snapshot        string
+	// statusBuffer is the master and slave status in buffer, which is shared by the metadata of the databases
+	statusBuffer bytes.Buffer
+	startTime    time.Time
+	finishTime   time.Time
 
 	storage storage.ExternalStorage
 }
@@ -49,10 +55,38 @@ func (m globalMetadata) String() string {
 }
 
 func (m *globalMetadata) recordStartTime(t time.Time) {
+	m.startTime = t
 	m.buffer.WriteString("Started dump at: " + t.Format(metadataTimeLayout) + "\n")
 }
 
+func (m *globalMetadata) recordHost(host string, port int) {
+	m.buffer.WriteString("Host: " + net.JoinHostPort(host, strconv.Itoa(port)) + "\n")
+}
+
+func (m *globalMetadata) recordJob(index, count int) {
+	m.buffer.WriteString("Job: " + strconv.Itoa(index) + "/" + strconv.Itoa(count) + "\n")
+}
+
+func (m *globalMetadata) recordBinaryEncoding(encoding string) {
+	m.buffer.WriteString("Binary encoding: " + encoding + "\n")
+}
+
+func (m *globalMetadata) recordSampledTables(seed int64, tables []string) {
+	m.buffer.WriteString("Sampled tables (seed " + strconv.FormatInt(seed, 10) + "): " + strings.Join(tables, ",") + "\n")
+}
+
+func (m *globalMetadata) recordConfig(conf *Config) error {
+	hash, err := conf.Hash()
+	if err != nil {
+		return err
+	}
+	m.buffer.WriteString("Config: " + conf.String() + "\n")
+	m.buffer.WriteString("Config hash: " + hash + "\n")
+	return nil
+}
+
 func (m *globalMetadata) recordFinishTime(t time.Time) {
+	m.finishTime = t
 	m.buffer.Write(m.afterConnBuffer.Bytes())
 	m.buffer.WriteString("Finished dump at: " + t.Format(metadataTimeLayout) + "\n")
 }
@@ -62,7 +96,10 @@ func (m *globalMetadata) recordGlobalMetaData(db *sql.Conn, serverType ServerTyp
 		m.afterConnBuffer.Reset()
 		return recordGlobalMetaData(m.tctx, db, &m.afterConnBuffer, serverType, afterConn, m.snapshot)
 	}
-	return recordGlobalMetaData(m.tctx, db, &m.buffer, serverType, afterConn, m.snapshot)
+	m.statusBuffer.Reset()
+	err := recordGlobalMetaData(m.tctx, db, &m.statusBuffer, serverType, afterConn, m.snapshot)
+	m.buffer.Write(m.statusBuffer.Bytes())
+	return err
 }
 
 func recordGlobalMetaData(tctx *tcontext.Context, db *sql.Conn, buffer *bytes.Buffer, serverType ServerType, afterConn bool, snapshot string) error { // revive:disable-line:flag-parameter
@@ -110,7 +147,7 @@ func recordGlobalMetaData(tctx *tcontext.Context, db *sql.Conn, buffer *bytes.Bu
 
 		if logFile != "" {
 			writeMasterStatusHeader()
-			fmt.Fprintf(buffer, "\tLog: %s\n\tPos: %s\n\tGTID:%s\n", logFile, pos, gtidSet)
+			writeBinlogPos(buffer, logFile, pos, gtidSet)
 		}
 	// For MariaDB:
 	// SHOW MASTER STATUS;
@@ -141,7 +178,7 @@ func recordGlobalMetaData(tctx *tcontext.Context, db *sql.Conn, buffer *bytes.Bu
 
 		if logFile != "" {
 			writeMasterStatusHeader()
-			fmt.Fprintf(buffer, "\tLog: %s\n\tPos: %s\n\tGTID:%s\n", logFile, pos, gtidSet)
+			writeBinlogPos(buffer, logFile, pos, gtidSet)
 		}
 	default:
 		return errors.Errorf("unsupported serverType %s for recordGlobalMetaData", serverType.String())
@@ -199,6 +236,10 @@ func recordGlobalMetaData(tctx *tcontext.Context, db *sql.Conn, buffer *bytes.Bu
 					host = data[i].String
 				case "executed_gtid_set":
 					gtidSet = data[i].String
+				// MariaDB doesn't have Executed_Gtid_Set, the GTID executed by the replica is Gtid_Slave_Pos of
+				// SHOW ALL SLAVES STATUS, which is the same for all the connections
+				case "gtid_slave_pos":
+					gtidSet = data[i].String
 				}
 			}
 		}
@@ -207,15 +248,31 @@ func recordGlobalMetaData(tctx *tcontext.Context, db *sql.Conn, buffer *bytes.Bu
 			if isms {
 				buffer.WriteString("\tConnection name: " + connName + "\n")
 			}
-			fmt.Fprintf(buffer, "\tHost: %s\n\tLog: %s\n\tPos: %s\n\tGTID:%s\n\n", host, logFile, pos, gtidSet)
+			fmt.Fprintf(buffer, "\tHost: %s\n", host)
+			writeBinlogPos(buffer, logFile, pos, gtidSet)
+			buffer.WriteString("\n")
 		}
 		return nil
 	})
 }
 
+// writeBinlogPos writes the binlog position into buffer, the GTID line is omitted if GTID is disabled
+func writeBinlogPos(buffer *bytes.Buffer, logFile, pos, gtidSet string) {
+	fmt.Fprintf(buffer, "\tLog: %s\n\tPos: %s\n", logFile, pos)
+	if gtidSet = formatGTIDSet(gtidSet); gtidSet != "" {
+		fmt.Fprintf(buffer, "\tGTID:%s\n", gtidSet)
+	}
+}
+
+// formatGTIDSet removes the line breaks which MySQL adds after the comma of each UUID in Executed_Gtid_Set,
+// so the GTID set is on a single line like the GTID list of MariaDB, e.g. `0-1-2,1-2-3`
+func formatGTIDSet(gtidSet string) string {
+	return strings.Join(strings.Fields(gtidSet), "")
+}
+
 func (m *globalMetadata) writeGlobalMetaData() error {
 	// keep consistent with mydumper. Never compress metadata
-	fileWriter, tearDown, err := buildFileWriter(m.tctx, m.storage, metadataPath, storage.NoCompression)
+	fileWriter, tearDown, err := buildFileWriter(m.tctx, m.storage, metadataPath, CompressNone, false)
 	if err != nil {
 		return err
 	}
@@ -6,6 +6,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
 
 	tcontext "github.com/pingcap/dumpling/v4/context"
 
@@ -205,6 +209,133 @@ func (s *testMetaDataSuite) TestMariaDBWithFollowersMetaData(c *C) {
 	c.Assert(mock.ExpectationsWereMet(), IsNil)
 }
 
+func (s *testMetaDataSuite) TestMysqlGTIDMetaDataFile(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	// the UUIDs of Executed_Gtid_Set are separated by line breaks
+	rows := sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+		AddRow(logFile, pos, "", "", gtidSet+",\n7f2e1b4c-e359-11e9-87e0-36933cb0ca5a:1-3")
+	followerRows := sqlmock.NewRows([]string{"exec_master_log_pos", "relay_master_log_file", "master_host", "Executed_Gtid_Set", "Seconds_Behind_Master"}).
+		AddRow("256529431", "mysql-bin.001821", "192.168.1.100", gtidSet+",\n7f2e1b4c-e359-11e9-87e0-36933cb0ca5a:1-3", 0)
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(rows)
+	mock.ExpectQuery("SELECT @@default_master_connection").WillReturnError(fmt.Errorf("mock error"))
+	mock.ExpectQuery("SHOW SLAVE STATUS").WillReturnRows(followerRows)
+
+	store := s.createStorage(c)
+	m := newGlobalMetadata(tcontext.Background(), store, "")
+	c.Assert(m.recordGlobalMetaData(conn, ServerTypeMySQL, false), IsNil)
+	c.Assert(m.writeGlobalMetaData(), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	content, err := store.ReadFile(context.Background(), metadataPath)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "SHOW MASTER STATUS:\n"+
+		"\tLog: ON.000001\n"+
+		"\tPos: 7502\n"+
+		"\tGTID:6ce40be3-e359-11e9-87e0-36933cb0ca5a:1-29,7f2e1b4c-e359-11e9-87e0-36933cb0ca5a:1-3\n\n"+
+		"SHOW SLAVE STATUS:\n"+
+		"\tHost: 192.168.1.100\n"+
+		"\tLog: mysql-bin.001821\n"+
+		"\tPos: 256529431\n"+
+		"\tGTID:6ce40be3-e359-11e9-87e0-36933cb0ca5a:1-29,7f2e1b4c-e359-11e9-87e0-36933cb0ca5a:1-3\n\n")
+}
+
+func (s *testMetaDataSuite) TestMysqlGTIDDisabledMetaData(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	rows := sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+		AddRow(logFile, pos, "", "", "")
+	followerRows := sqlmock.NewRows([]string{"exec_master_log_pos", "relay_master_log_file", "master_host", "Executed_Gtid_Set", "Seconds_Behind_Master"}).
+		AddRow("256529431", "mysql-bin.001821", "192.168.1.100", "", 0)
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(rows)
+	mock.ExpectQuery("SELECT @@default_master_connection").WillReturnError(fmt.Errorf("mock error"))
+	mock.ExpectQuery("SHOW SLAVE STATUS").WillReturnRows(followerRows)
+
+	m := newGlobalMetadata(tcontext.Background(), s.createStorage(c), "")
+	c.Assert(m.recordGlobalMetaData(conn, ServerTypeMySQL, false), IsNil)
+
+	c.Assert(m.buffer.String(), Equals, "SHOW MASTER STATUS:\n"+
+		"\tLog: ON.000001\n"+
+		"\tPos: 7502\n\n"+
+		"SHOW SLAVE STATUS:\n"+
+		"\tHost: 192.168.1.100\n"+
+		"\tLog: mysql-bin.001821\n"+
+		"\tPos: 256529431\n\n")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testMetaDataSuite) TestMariaDBGTIDMetaDataFile(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB"}).
+			AddRow("mariadb-bin.000016", "475", "", ""))
+	mock.ExpectQuery("SELECT @@global.gtid_binlog_pos").WillReturnRows(
+		sqlmock.NewRows([]string{"@@global.gtid_binlog_pos"}).AddRow("0-1-2,1-2-30"))
+	mock.ExpectQuery("SELECT @@default_master_connection").WillReturnRows(
+		sqlmock.NewRows([]string{"@@default_master_connection"}).AddRow(""))
+	mock.ExpectQuery("SHOW ALL SLAVES STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"Connection_name", "Master_Host", "Relay_Master_Log_File", "Exec_Master_Log_Pos", "Gtid_IO_Pos", "Gtid_Slave_Pos"}).
+			AddRow("", "192.168.1.100", "mariadb-bin.000010", "1024", "0-1-3", "0-1-2"))
+
+	store := s.createStorage(c)
+	m := newGlobalMetadata(tcontext.Background(), store, "")
+	c.Assert(m.recordGlobalMetaData(conn, ServerTypeMariaDB, false), IsNil)
+	c.Assert(m.writeGlobalMetaData(), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	content, err := store.ReadFile(context.Background(), metadataPath)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "SHOW MASTER STATUS:\n"+
+		"\tLog: mariadb-bin.000016\n"+
+		"\tPos: 475\n"+
+		"\tGTID:0-1-2,1-2-30\n\n"+
+		"SHOW SLAVE STATUS:\n"+
+		"\tConnection name: \n"+
+		"\tHost: 192.168.1.100\n"+
+		"\tLog: mariadb-bin.000010\n"+
+		"\tPos: 1024\n"+
+		"\tGTID:0-1-2\n\n")
+}
+
+func (s *testMetaDataSuite) TestMariaDBGTIDDisabledMetaData(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB"}).
+			AddRow("mariadb-bin.000016", "475", "", ""))
+	mock.ExpectQuery("SELECT @@global.gtid_binlog_pos").WillReturnRows(
+		sqlmock.NewRows([]string{"@@global.gtid_binlog_pos"}).AddRow(""))
+	mock.ExpectQuery("SELECT @@default_master_connection").WillReturnRows(
+		sqlmock.NewRows([]string{"@@default_master_connection"}).AddRow(""))
+	mock.ExpectQuery("SHOW ALL SLAVES STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"Connection_name", "Master_Host"}))
+
+	m := newGlobalMetadata(tcontext.Background(), s.createStorage(c), "")
+	c.Assert(m.recordGlobalMetaData(conn, ServerTypeMariaDB, false), IsNil)
+
+	c.Assert(m.buffer.String(), Equals, "SHOW MASTER STATUS:\n"+
+		"\tLog: mariadb-bin.000016\n"+
+		"\tPos: 475\n\n")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
 func (s *testMetaDataSuite) TestEarlierMysqlMetaData(c *C) {
 	db, mock, err := sqlmock.New()
 	c.Assert(err, IsNil)
@@ -226,8 +357,7 @@ func (s *testMetaDataSuite) TestEarlierMysqlMetaData(c *C) {
 
 	c.Assert(m.buffer.String(), Equals, "SHOW MASTER STATUS:\n"+
 		"\tLog: mysql-bin.000001\n"+
-		"\tPos: 4879\n"+
-		"\tGTID:\n\n")
+		"\tPos: 4879\n\n")
 	c.Assert(mock.ExpectationsWereMet(), IsNil)
 }
 
@@ -248,8 +378,7 @@ func (s *testMetaDataSuite) TestTiDBSnapshotMetaData(c *C) {
 	c.Assert(m.recordGlobalMetaData(conn, ServerTypeTiDB, false), IsNil)
 	c.Assert(m.buffer.String(), Equals, "SHOW MASTER STATUS:\n"+
 		"\tLog: tidb-binlog\n"+
-		"\tPos: 420633329401856001\n"+
-		"\tGTID:\n\n")
+		"\tPos: 420633329401856001\n\n")
 
 	snapshot := "420633273211289601"
 	rows = sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB"}).
@@ -259,8 +388,7 @@ func (s *testMetaDataSuite) TestTiDBSnapshotMetaData(c *C) {
 	c.Assert(m.recordGlobalMetaData(conn, ServerTypeTiDB, false), IsNil)
 	c.Assert(m.buffer.String(), Equals, "SHOW MASTER STATUS:\n"+
 		"\tLog: tidb-binlog\n"+
-		"\tPos: 420633273211289601\n"+
-		"\tGTID:\n\n")
+		"\tPos: 420633273211289601\n\n")
 	c.Assert(mock.ExpectationsWereMet(), IsNil)
 }
 
@@ -278,3 +406,61 @@ func (s *testMetaDataSuite) TestNoPrivilege(c *C) {
 	c.Assert(m.recordGlobalMetaData(conn, ServerTypeTiDB, false), NotNil)
 	c.Assert(m.buffer.String(), Equals, "")
 }
+
+func (s *testMetaDataSuite) TestRecordConfig(c *C) {
+	conf := DefaultConfig()
+	conf.S3.AccessKey = "topsecret"
+	m := newGlobalMetadata(tcontext.Background(), s.createStorage(c), "")
+	c.Assert(m.recordConfig(conf), IsNil)
+	hash, err := conf.Hash()
+	c.Assert(err, IsNil)
+	c.Assert(m.buffer.String(), Equals, "Config: "+conf.String()+"\nConfig hash: "+hash+"\n")
+	c.Assert(m.buffer.String(), Not(Matches), "(?s).*topsecret.*")
+}
+
+func (s *testMetaDataSuite) TestWriteDatabaseMetaData(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	rows := sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+		AddRow(logFile, pos, "", "", gtidSet)
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(rows)
+
+	dir := c.MkDir()
+	extStore, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background()
+	m := newGlobalMetadata(tctx, extStore, "")
+	m.recordStartTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.Local))
+	c.Assert(m.recordGlobalMetaData(conn, ServerTypeTiDB, false), IsNil)
+	m.recordFinishTime(time.Date(2021, 1, 1, 0, 1, 0, 0, time.Local))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	conf := DefaultConfig()
+	conf.OutputDirPath = dir
+	conf.Tables = DatabaseTables{}.AppendTables("test", "t2", "t1").AppendViews("test", "v").AppendTables("a/b", "t")
+	d := &Dumper{tctx: tctx, conf: conf, extStore: extStore, tableStats: newTableStatsCollector()}
+	d.tableStats.add("test", "t1", tableChunkStats{rows: 10, bytes: 100})
+	d.tableStats.add("test", "t1", tableChunkStats{rows: 5, bytes: 50})
+	c.Assert(d.writeDatabaseMetaData(m), IsNil)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "test", metadataPath))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "Started dump at: 2021-01-01 00:00:00\n"+
+		"Database: test\n"+
+		"SHOW MASTER STATUS:\n"+
+		"\tLog: ON.000001\n"+
+		"\tPos: 7502\n"+
+		"\tGTID:6ce40be3-e359-11e9-87e0-36933cb0ca5a:1-29\n\n"+
+		"Tables:\n"+
+		"\tt1: 15 rows\n"+
+		"\tt2: 0 rows\n"+
+		"\tv: view\n"+
+		"Finished dump at: 2021-01-01 00:01:00\n")
+	// the database name is escaped as the other file names
+	_, err = os.Stat(filepath.Join(dir, escapeFileName("a/b"), metadataPath))
+	c.Assert(err, IsNil)
+}
@@ -4,6 +4,7 @@ package export
 
 import (
 	"math"
+	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
@@ -18,6 +19,8 @@ var (
 	receiveWriteChunkTimeHistogram *prometheus.HistogramVec
 	errorCount                     *prometheus.CounterVec
 	taskChannelCapacity            *prometheus.GaugeVec
+	rowsPerSecondGauge             *prometheus.GaugeVec
+	bytesPerSecondGauge            *prometheus.GaugeVec
 )
 
 // InitMetricsVector inits metrics vectors.
@@ -85,6 +88,32 @@ func InitMetricsVector(labels prometheus.Labels) {
 			Name:      "channel_capacity",
 			Help:      "The task channel capacity during dumping progress",
 		}, labelNames)
+	rowsPerSecondGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "dumpling",
+			Subsystem: "dump",
+			Name:      "rows_per_second",
+			Help:      "The rows dumped per second when they're limited by --max-rows-per-second",
+		}, labelNames)
+	bytesPerSecondGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "dumpling",
+			Subsystem: "dump",
+			Name:      "bytes_per_second",
+			Help:      "The bytes written per second when they're limited by --max-bytes-per-second",
+		}, labelNames)
+}
+
+var initMetricsVectorMu sync.Mutex
+
+// initMetricsVectorIfNeeded inits metrics vectors if they aren't, e.g. when Dumpling is used as a library
+// and the progress is read from them
+func initMetricsVectorIfNeeded(labels prometheus.Labels) {
+	initMetricsVectorMu.Lock()
+	defer initMetricsVectorMu.Unlock()
+	if finishedSizeCounter == nil {
+		InitMetricsVector(labels)
+	}
 }
 
 // RegisterMetrics registers metrics.
@@ -100,6 +129,8 @@ func RegisterMetrics(registry *prometheus.Registry) {
 	registry.MustRegister(receiveWriteChunkTimeHistogram)
 	registry.MustRegister(errorCount)
 	registry.MustRegister(taskChannelCapacity)
+	registry.MustRegister(rowsPerSecondGauge)
+	registry.MustRegister(bytesPerSecondGauge)
 }
 
 // RemoveLabelValuesWithTaskInMetrics removes metrics of specified labels.
@@ -115,6 +146,8 @@ func RemoveLabelValuesWithTaskInMetrics(labels prometheus.Labels) {
 	receiveWriteChunkTimeHistogram.Delete(labels)
 	errorCount.Delete(labels)
 	taskChannelCapacity.Delete(labels)
+	rowsPerSecondGauge.Delete(labels)
+	bytesPerSecondGauge.Delete(labels)
 }
 
 // ReadCounter reports the current value of the counter.
@@ -162,6 +195,14 @@ func AddGauge(gaugeVec *prometheus.GaugeVec, labels prometheus.Labels, v float64
 	gaugeVec.With(labels).Add(v)
 }
 
+// SetGauge sets a gauge
+func SetGauge(gaugeVec *prometheus.GaugeVec, labels prometheus.Labels, v float64) {
+	if gaugeVec == nil {
+		return
+	}
+	gaugeVec.With(labels).Set(v)
+}
+
 // IncGauge incs a gauge
 func IncGauge(gaugeVec *prometheus.GaugeVec, labels prometheus.Labels) {
 	if gaugeVec == nil {
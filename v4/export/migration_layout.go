@@ -0,0 +1,204 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+// migrationVersions assigns the version numbers of the schema files in the migration layout.
+// Databases come first, then stored routines, base tables, views, triggers and events, so that the numbering
+// is deterministic and every object is created after the objects it depends on. The routines are created before
+// the tables since their bodies aren't checked until they're called, while the views may call the functions.
+// The base tables are ordered by their foreign keys and the views by their definitions, each by name otherwise.
+type migrationVersions struct {
+	databases map[string]int
+	// database -> routine name -> version
+	routines map[string]map[string]int
+	tables   map[string]map[string]int
+	// uncheckedTables are the tables created before the tables they reference in a cycle of foreign keys
+	uncheckedTables map[[2]string]struct{}
+
+	mu sync.Mutex
+	// last is the last version assigned, the triggers and the events are numbered after it as they're dumped
+	last int
+}
+
+// newMigrationVersions numbers the databases and the tables in allTables, the stored routines in routines which
+// are database -> names, and orders the base tables by fks
+func newMigrationVersions(tctx *tcontext.Context, allTables DatabaseTables, routines map[string][]string, fks []foreignKey) *migrationVersions {
+	v := &migrationVersions{
+		databases:       make(map[string]int, len(allTables)),
+		routines:        make(map[string]map[string]int, len(routines)),
+		tables:          make(map[string]map[string]int, len(allTables)),
+		uncheckedTables: make(map[[2]string]struct{}),
+	}
+	dbNames := make([]string, 0, len(allTables))
+	for dbName := range allTables {
+		dbNames = append(dbNames, dbName)
+	}
+	sort.Strings(dbNames)
+
+	for _, dbName := range dbNames {
+		v.last++
+		v.databases[dbName] = v.last
+		v.tables[dbName] = make(map[string]int, len(allTables[dbName]))
+	}
+	for _, dbName := range dbNames {
+		names := append([]string(nil), routines[dbName]...)
+		sort.Strings(names)
+		v.routines[dbName] = make(map[string]int, len(names))
+		for _, name := range names {
+			if _, ok := v.routines[dbName][name]; !ok {
+				v.last++
+				v.routines[dbName][name] = v.last
+			}
+		}
+	}
+	var baseTables, views [][2]string
+	for _, dbName := range dbNames {
+		var names, viewNames []string
+		for _, table := range allTables[dbName] {
+			if table.Type == TableTypeView {
+				viewNames = append(viewNames, table.Name)
+			} else if table.Type == TableTypeBase {
+				names = append(names, table.Name)
+			}
+		}
+		sort.Strings(names)
+		sort.Strings(viewNames)
+		for _, name := range names {
+			baseTables = append(baseTables, [2]string{dbName, name})
+		}
+		for _, name := range viewNames {
+			views = append(views, [2]string{dbName, name})
+		}
+	}
+	for _, table := range append(v.sortTablesByForeignKeys(tctx, baseTables, fks), views...) {
+		v.last++
+		v.tables[table[0]][table[1]] = v.last
+	}
+	return v
+}
+
+// sortTablesByForeignKeys returns the tables sorted so each table is created after the tables it references.
+// The tables whose references are created are sorted by the database and the name. A cycle of the foreign keys
+// is broken at its first table by the database and the name, which is created with the foreign key checks disabled.
+func (v *migrationVersions) sortTablesByForeignKeys(tctx *tcontext.Context, tables [][2]string, fks []foreignKey) [][2]string {
+	index := make(map[[2]string]int, len(tables))
+	for i, t := range tables {
+		index[t] = i
+	}
+	deps := make([][]int, len(tables))
+	for _, fk := range fks {
+		child, ok1 := index[[2]string{fk.childDB, fk.childTable}]
+		parent, ok2 := index[[2]string{fk.parentDB, fk.parentTable}]
+		// a table referencing itself doesn't affect the order
+		if ok1 && ok2 && child != parent {
+			deps[child] = append(deps[child], parent)
+		}
+	}
+	created := make([]bool, len(tables))
+	ready := func(i int) bool {
+		for _, j := range deps[i] {
+			if !created[j] {
+				return false
+			}
+		}
+		return true
+	}
+	sorted := make([][2]string, 0, len(tables))
+	for first := 0; len(sorted) < len(tables); {
+		for created[first] {
+			first++
+		}
+		next := -1
+		for i := first; i < len(tables); i++ {
+			if !created[i] && ready(i) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			next = first
+			v.uncheckedTables[tables[next]] = struct{}{}
+			tctx.L().Warn("tables reference each other by foreign keys, create the first table with the foreign key checks disabled",
+				zap.String("database", tables[next][0]), zap.String("table", tables[next][1]))
+		}
+		sorted = append(sorted, tables[next])
+		created[next] = true
+	}
+	return sorted
+}
+
+// reorderViews reassigns the versions of the views by the order of the steps to dump them,
+// so a view is created after the views it selects from
+func (v *migrationVersions) reorderViews(steps []viewStep) {
+	versions := make([]int, 0, len(steps))
+	for _, step := range steps {
+		if step.part != viewPartPlaceholder {
+			versions = append(versions, v.tables[step.view.db][step.view.table.Name])
+		}
+	}
+	sort.Ints(versions)
+	for _, step := range steps {
+		if step.part != viewPartPlaceholder {
+			v.tables[step.view.db][step.view.table.Name], versions = versions[0], versions[1:]
+		}
+	}
+}
+
+func (v *migrationVersions) database(db string) int {
+	return v.databases[db]
+}
+
+func (v *migrationVersions) table(db, table string) int {
+	return v.tables[db][table]
+}
+
+// routine returns the version of a stored routine, a routine created after the versions are assigned is numbered
+// after the others
+func (v *migrationVersions) routine(db, name string) int {
+	if version, ok := v.routines[db][name]; ok {
+		return version
+	}
+	return v.next()
+}
+
+// next numbers a trigger or an event after all the other objects
+func (v *migrationVersions) next() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.last++
+	return v.last
+}
+
+// createTableSQL disables the foreign key checks to create a table in a cycle of foreign keys before the tables
+// it references
+func (v *migrationVersions) createTableSQL(db, table, createSQL string) string {
+	if _, ok := v.uncheckedTables[[2]string{db, table}]; ok {
+		return "/*!40014 SET FOREIGN_KEY_CHECKS=0*/;\n" + createSQL
+	}
+	return createSQL
+}
+
+// migrationFileName returns the file name in the form of `V{version}__create_{db}_{table}.sql`,
+// table is empty for the database schema file, or the name of a routine or an event
+func migrationFileName(version int, db, table string) string {
+	name := escapeFileName(db)
+	if table != "" {
+		name += "_" + escapeFileName(table)
+	}
+	return fmt.Sprintf("V%d__create_%s.sql", version, name)
+}
+
+// migrationSQL makes the table or view schema self-contained by switching to its database first
+func migrationSQL(db, createSQL string) string {
+	return fmt.Sprintf("USE `%s`;\n%s", escapeString(db), createSQL)
+}
@@ -0,0 +1,257 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/summary"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// mongoJSONType is the MongoDB extended JSON type which a column is written as
+type mongoJSONType int
+
+const (
+	mongoJSONString mongoJSONType = iota
+	mongoJSONInt
+	mongoJSONLong
+	// mongoJSONUnsignedLong is a long unless the value overflows, then it's a decimal
+	mongoJSONUnsignedLong
+	mongoJSONDouble
+	mongoJSONDecimal
+	mongoJSONDate
+	mongoJSONBinary
+	// mongoJSONDocument is the JSON value, which is written as is
+	mongoJSONDocument
+)
+
+// mongoJSONTypeOf maps the database type name of a column to its extended JSON type
+func mongoJSONTypeOf(colType string) mongoJSONType {
+	switch colType {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "YEAR",
+		"UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT":
+		return mongoJSONInt
+	case "BIGINT", "UNSIGNED INT":
+		return mongoJSONLong
+	case "UNSIGNED BIGINT":
+		return mongoJSONUnsignedLong
+	case "FLOAT", "DOUBLE", "REAL":
+		return mongoJSONDouble
+	case "DECIMAL", "NUMERIC":
+		return mongoJSONDecimal
+	case "DATE", "DATETIME", "TIMESTAMP":
+		return mongoJSONDate
+	case "JSON":
+		return mongoJSONDocument
+	}
+	if _, ok := dataTypeBin[colType]; ok {
+		return mongoJSONBinary
+	}
+	return mongoJSONString
+}
+
+// writeMongoJSONValue writes the raw value of a column in its extended JSON type. The dates are taken as UTC,
+// and the ones which can't be represented, such as the zero date, are written as strings.
+func writeMongoJSONValue(bf *bytes.Buffer, tp mongoJSONType, raw []byte) {
+	if raw == nil {
+		bf.WriteString("null")
+		return
+	}
+	switch tp {
+	case mongoJSONInt:
+		writeMongoJSONWrapped(bf, "$numberInt", raw)
+	case mongoJSONLong:
+		writeMongoJSONWrapped(bf, "$numberLong", raw)
+	case mongoJSONUnsignedLong:
+		if _, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+			writeMongoJSONWrapped(bf, "$numberLong", raw)
+		} else {
+			writeMongoJSONWrapped(bf, "$numberDecimal", raw)
+		}
+	case mongoJSONDouble:
+		writeMongoJSONWrapped(bf, "$numberDouble", raw)
+	case mongoJSONDecimal:
+		writeMongoJSONWrapped(bf, "$numberDecimal", raw)
+	case mongoJSONDate:
+		t, err := parseMongoJSONDate(string(raw))
+		if err != nil {
+			writeJSONString(bf, raw)
+			return
+		}
+		bf.WriteString(`{"$date":`)
+		writeMongoJSONWrapped(bf, "$numberLong", []byte(strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)))
+		bf.WriteByte('}')
+	case mongoJSONBinary:
+		bf.WriteString(`{"$binary":{"base64":"`)
+		bf.WriteString(base64.StdEncoding.EncodeToString(raw))
+		bf.WriteString(`","subType":"00"}}`)
+	case mongoJSONDocument:
+		bf.Write(raw)
+	default:
+		writeJSONString(bf, raw)
+	}
+}
+
+func writeMongoJSONWrapped(bf *bytes.Buffer, key string, raw []byte) {
+	bf.WriteString(`{"`)
+	bf.WriteString(key)
+	bf.WriteString(`":`)
+	writeJSONString(bf, raw)
+	bf.WriteByte('}')
+}
+
+// writeJSONString writes s as a JSON string, the invalid UTF-8 bytes are replaced with U+FFFD
+func writeJSONString(bf *bytes.Buffer, s []byte) {
+	b, _ := json.Marshal(string(s))
+	bf.Write(b)
+}
+
+func parseMongoJSONDate(s string) (time.Time, error) {
+	layout := "2006-01-02"
+	if len(s) > len(layout) {
+		layout = "2006-01-02 15:04:05.999999"
+	}
+	t, err := time.ParseInLocation(layout, s, time.UTC)
+	if err != nil {
+		return t, errors.Trace(err)
+	}
+	return t, nil
+}
+
+// WriteInsertInMongoJSON writes TableDataIR to a storage.ExternalFileWriter in MongoDB extended JSON,
+// one document per row keyed by the column names
+func WriteInsertInMongoJSON(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR TableDataIR, w storage.ExternalFileWriter) (uint64, error) {
+	return writeInsertInJSONLines(pCtx, cfg, meta, tblIR, w, nil, nil, writeMongoJSONValue)
+}
+
+// writeInsertInJSONLines writes TableDataIR to a storage.ExternalFileWriter as one JSON object per line keyed by
+// the column names. The object of a row is wrapped by prefix and suffix, and its values are written by writeValue.
+func writeInsertInJSONLines(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR TableDataIR, w storage.ExternalFileWriter,
+	prefix, suffix []byte, writeValue func(bf *bytes.Buffer, tp mongoJSONType, raw []byte)) (n uint64, err error) {
+	fileRowIter := tblIR.Rows()
+	if !fileRowIter.HasNext() {
+		return 0, fileRowIter.Error()
+	}
+
+	bf := pool.Get().(*bytes.Buffer)
+	if bfCap := bf.Cap(); bfCap < lengthLimit {
+		bf.Grow(lengthLimit - bfCap)
+	}
+
+	wp := newWriterPipe(w, cfg.FileSize, UnspecifiedSize, cfg.Labels)
+
+	// use context.Background here to make sure writerPipe can deplete all the chunks in pipeline
+	ctx, cancel := tcontext.Background().WithLogger(pCtx.L()).WithCancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		wp.Run(ctx)
+		wg.Done()
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	var (
+		row            = makeRowReceiver(meta.ColumnTypes(), false, false, "")
+		numberFmt      = newNumberFormatter(cfg, meta.ColumnTypes())
+		counter        uint64
+		lastCounter    uint64
+		selectedFields = meta.SelectedField()
+	)
+	colTypes := meta.ColumnTypes()
+	types := make([]mongoJSONType, len(colTypes))
+	for i, colType := range colTypes {
+		types[i] = mongoJSONTypeOf(strings.ToUpper(colType))
+	}
+	// the keys of the documents are quoted once
+	keys := make([][]byte, len(colTypes))
+	for i, name := range meta.ColumnNames() {
+		if i < len(keys) {
+			keys[i], _ = json.Marshal(name)
+		}
+	}
+
+	for fileRowIter.HasNext() {
+		lastBfSize := bf.Len()
+		bf.Write(prefix)
+		bf.WriteByte('{')
+		// all the columns are generated ones if no field is selected
+		if selectedFields != "" {
+			if err = fileRowIter.Decode(row); err != nil {
+				pCtx.L().Error("fail to scan from sql.Row", zap.Error(err))
+				return counter, errors.Trace(err)
+			}
+			if numberFmt != nil {
+				numberFmt.format(row)
+			}
+			for i, receiver := range row.receivers {
+				if i > 0 {
+					bf.WriteByte(',')
+				}
+				bf.Write(keys[i])
+				bf.WriteByte(':')
+				writeValue(bf, types[i], receiverRawBytes(receiver))
+			}
+		}
+		bf.WriteByte('}')
+		bf.Write(suffix)
+		counter++
+		wp.currentFileSize += uint64(bf.Len()-lastBfSize) + 1 // 1 is for "\n"
+
+		bf.WriteByte('\n')
+		if bf.Len() >= lengthLimit {
+			select {
+			case <-pCtx.Done():
+				return counter, pCtx.Err()
+			case err = <-wp.errCh:
+				return counter, err
+			case wp.input <- bf:
+				bf = pool.Get().(*bytes.Buffer)
+				if bfCap := bf.Cap(); bfCap < lengthLimit {
+					bf.Grow(lengthLimit - bfCap)
+				}
+				AddCounter(finishedRowsCounter, cfg.Labels, float64(counter-lastCounter))
+				lastCounter = counter
+			}
+		}
+
+		fileRowIter.Next()
+		if wp.ShouldSwitchFile() {
+			break
+		}
+	}
+
+	pCtx.L().Debug("finish dumping table(chunk)",
+		zap.String("database", meta.DatabaseName()),
+		zap.String("table", meta.TableName()),
+		zap.Uint64("total rows", counter))
+	if bf.Len() > 0 {
+		wp.input <- bf
+	}
+	close(wp.input)
+	<-wp.closed
+	defer func() {
+		if err == nil {
+			summary.CollectSuccessUnit(summary.TotalBytes, 1, wp.finishedFileSize)
+			summary.CollectSuccessUnit("total rows", 1, counter)
+		}
+	}()
+	AddCounter(finishedRowsCounter, cfg.Labels, float64(counter-lastCounter))
+	if err = fileRowIter.Error(); err != nil {
+		return counter, errors.Trace(err)
+	}
+	return counter, wp.Error()
+}
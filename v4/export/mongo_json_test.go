@@ -0,0 +1,38 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestWriteInsertInMongoJSON(c *C) {
+	data := [][]driver.Value{
+		{"1", "9223372036854775807", "18446744073709551615", "1.5", "12.340", "2021-03-04 05:06:07.5", []byte{0, 1, 255}, `{"a": [1, "<b>"]}`, "bob \"the\" builder"},
+		{"2", "-1", "1", "-0", "0.000", "0000-00-00 00:00:00", []byte{}, "null", ""},
+		{"3", nil, nil, nil, nil, "2021-03-04", nil, nil, nil},
+	}
+	colTypes := []string{"INT", "BIGINT", "UNSIGNED BIGINT", "DOUBLE", "DECIMAL", "DATETIME", "BLOB", "JSON", "VARCHAR"}
+	tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+	tableIR.colNames = []string{"id", "l", "u", "d", "dec", "dt", "b", "j", "s"}
+	bf := storage.NewBufferWriter()
+
+	conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+	n, err := WriteInsertInMongoJSON(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, uint64(3))
+	expected := `{"id":{"$numberInt":"1"},"l":{"$numberLong":"9223372036854775807"},"u":{"$numberDecimal":"18446744073709551615"},` +
+		`"d":{"$numberDouble":"1.5"},"dec":{"$numberDecimal":"12.340"},"dt":{"$date":{"$numberLong":"1614834367500"}},` +
+		`"b":{"$binary":{"base64":"AAH/","subType":"00"}},"j":{"a": [1, "<b>"]},"s":"bob \"the\" builder"}` + "\n" +
+		`{"id":{"$numberInt":"2"},"l":{"$numberLong":"-1"},"u":{"$numberLong":"1"},` +
+		`"d":{"$numberDouble":"-0"},"dec":{"$numberDecimal":"0.000"},"dt":"0000-00-00 00:00:00",` +
+		`"b":{"$binary":{"base64":"","subType":"00"}},"j":null,"s":""}` + "\n" +
+		`{"id":{"$numberInt":"3"},"l":null,"u":null,"d":null,"dec":null,"dt":{"$date":{"$numberLong":"1614816000000"}},` +
+		`"b":null,"j":null,"s":null}` + "\n"
+	c.Assert(bf.String(), Equals, expected)
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"math/big"
+
+	"go.uber.org/zap"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+// partitionIntChunks is the plan to split a partition of a MySQL partitioned table by the ranges of an integer key
+type partitionIntChunks struct {
+	partition string
+	min, max  *big.Int
+	// step is the width of the range of each chunk, it's 0 if the partition is dumped as a whole
+	step   uint64
+	chunks int
+}
+
+// concurrentDumpMySQLPartitionTable splits every partition of a MySQL partitioned table by the ranges of key separately,
+// so the partitions are dumped concurrently and every chunk only reads one partition. A partition with subpartitions
+// is selected by its name as a whole, which covers all of its subpartitions.
+func (d *Dumper) concurrentDumpMySQLPartitionTable(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta, taskChan chan<- Task,
+	partitions []string, field, key string, rows uint64) error {
+	conf := d.conf
+	db, tbl := meta.DatabaseName(), meta.TableName()
+	tctx.L().Debug("dumping MySQL partition table by the ranges of each partition",
+		zap.String("database", db), zap.String("table", tbl), zap.Strings("partitions", partitions))
+
+	// plan the chunks of all the partitions first to calculate the total chunks
+	plans := make([]*partitionIntChunks, 0, len(partitions))
+	totalChunks := 0
+	for _, partition := range partitions {
+		min, max, err := d.selectMinAndMaxIntValue(conn, db, tbl, partition, key)
+		if err != nil {
+			return err
+		}
+		plan := &partitionIntChunks{partition: partition, min: min, max: max, chunks: 1}
+		var count uint64
+		if conf.SkipEstimate {
+			width := new(big.Int).Sub(max, min)
+			width.Add(width, big.NewInt(1))
+			count = math.MaxUint64
+			if width.IsUint64() {
+				count = width.Uint64()
+			}
+		} else {
+			count = estimatePartitionCount(tctx, conn, conf, db, tbl, partition, field)
+		}
+		if count >= rows {
+			plan.step = new(big.Int).Sub(max, min).Uint64()/(count/rows) + 1
+			plan.chunks = int(new(big.Int).Sub(max, min).Uint64()/plan.step + 1)
+		}
+		tctx.L().Debug("plan chunks of partition",
+			zap.String("database", db), zap.String("table", tbl), zap.String("partition", partition),
+			zap.Uint64("estimateCount", count), zap.Int("chunks", plan.chunks))
+		plans = append(plans, plan)
+		totalChunks += plan.chunks
+	}
+
+	selectField, selectLen, err := buildSelectFieldForMeta(conn, meta, conf.CompleteInsert)
+	if err != nil {
+		return err
+	}
+	orderByClause, err := buildOrderByClause(conf, conn, db, tbl)
+	if err != nil {
+		return err
+	}
+	separateNulls := conf.NullsHandling == NullsHandlingSeparate
+	if separateNulls {
+		// the rows whose key is NULL are dumped by a dedicated chunk after the ranges of each partition
+		for _, plan := range plans {
+			if plan.step > 0 {
+				totalChunks++
+			}
+		}
+	}
+	if conf.NullsHandling == NullsHandlingExclude {
+		if err = warnExcludedNulls(tctx, conn, conf, db, tbl, key); err != nil {
+			return err
+		}
+	}
+
+	chunkExpr := conf.ChunkExpressions[db][tbl]
+	chunkIndex := 0
+	sendTask := func(task *TaskTableData) bool {
+		task.ChunkField = field
+		if chunkExpr != "" {
+			task.keyColumns = []string{chunkExpr}
+		}
+		chunkIndex++
+		return d.sendTaskToChan(tctx, task, taskChan)
+	}
+	for _, plan := range plans {
+		partition := plan.partition
+		if plan.step == 0 {
+			if err = d.dumpWholeTableDirectly(tctx, conn, meta, taskChan, partition, chunkIndex, totalChunks); err != nil {
+				return err
+			}
+			chunkIndex++
+			continue
+		}
+		buildQuery := func(lower, upper *big.Int, withNull bool) string {
+			where := chunkRangeCondition(key, lower, upper, withNull)
+			return buildSelectQueryWithHint(db, tbl, selectField, partition, indexHintOf(meta), buildTableWhereCondition(conf, meta, where), orderByClause)
+		}
+		step := new(big.Int).SetUint64(plan.step)
+		keyRanges := make([]*chunkKeyRange, 0, plan.chunks)
+		for cutoff := new(big.Int).Set(plan.min); plan.max.Cmp(cutoff) >= 0; {
+			nextCutOff := new(big.Int).Add(cutoff, step)
+			keyRanges = append(keyRanges, &chunkKeyRange{lower: cutoff, upper: nextCutOff, colLen: selectLen, buildQuery: buildQuery})
+			cutoff = nextCutOff
+		}
+		nullChunk := nullChunkIndex(conf, len(keyRanges))
+		if nullChunk >= 0 {
+			keyRanges[nullChunk].withNull = true
+		}
+		if conf.VerifyCoverage {
+			if err = verifyIntChunkCoverage(db, tbl+"` partition `"+partition, keyRanges, plan.min, plan.max, nullChunk, plan.chunks); err != nil {
+				return err
+			}
+		}
+		for _, keyRange := range keyRanges {
+			task := NewTaskTableData(meta, newTableData(keyRange.query(), selectLen, false), chunkIndex, totalChunks)
+			task.keyRange = keyRange
+			if sendTask(task) {
+				return tctx.Err()
+			}
+		}
+		if separateNulls {
+			nullQuery := buildSelectQueryWithHint(db, tbl, selectField, partition, indexHintOf(meta), buildTableWhereCondition(conf, meta, key+" IS NULL"), orderByClause)
+			if sendTask(NewTaskTableData(meta, newTableData(nullQuery, selectLen, false), chunkIndex, totalChunks)) {
+				return tctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// estimatePartitionCount estimates the rows of a partition of the table by the execution plan
+func estimatePartitionCount(tctx *tcontext.Context, conn *sql.Conn, conf *Config, db, tbl, partition, field string) uint64 {
+	selected := "*"
+	if field != "" {
+		selected = wrapBackTicks(escapeString(field))
+	}
+	query := fmt.Sprintf("EXPLAIN SELECT %s FROM `%s`.`%s` PARTITION(`%s`)",
+		selected, escapeString(db), escapeString(tbl), escapeString(partition))
+	if conf.Where != "" {
+		query += " WHERE " + conf.Where
+	}
+	return detectEstimateRows(tctx, conn, query, []string{"rows", "estRows", "count"})
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+func (s *testSQLSuite) TestConcurrentDumpMySQLPartitionTable(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.FileType = FileFormatCSVString
+	conf.NoHeader = true
+	conf.CsvSeparator = ","
+	c.Assert(adjustFileFormat(conf), IsNil)
+	conf.Rows = 10
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "test", table: "t"}
+
+	// PARTITION BY RANGE (id) (PARTITION p0 VALUES LESS THAN (100), PARTITION p1 VALUES LESS THAN (200),
+	// PARTITION p2 VALUES LESS THAN MAXVALUE), p2 has 2 subpartitions
+	partitionIDs := map[string][]int64{}
+	for id := int64(1); id <= 35; id++ {
+		partitionIDs["p0"] = append(partitionIDs["p0"], id)
+	}
+	for id := int64(100); id < 105; id++ {
+		partitionIDs["p1"] = append(partitionIDs["p1"], id)
+	}
+	for id := int64(200); id < 220; id++ {
+		partitionIDs["p2"] = append(partitionIDs["p2"], id)
+	}
+	mock.ExpectQuery("SELECT column_name FROM information_schema.columns").WithArgs("test", "t", "PRI").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+	mock.ExpectQuery("SELECT PARTITION_NAME from INFORMATION_SCHEMA.PARTITIONS").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}).AddRow("p0").AddRow("p1").AddRow("p2").AddRow("p2"))
+	for _, partition := range []string{"p0", "p1", "p2"} {
+		ids := partitionIDs[partition]
+		mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf("SELECT MIN(`id`),MAX(`id`) FROM `test`.`t` PARTITION(`%s`)", partition))).
+			WillReturnRows(sqlmock.NewRows([]string{"MIN", "MAX"}).AddRow(ids[0], ids[len(ids)-1]))
+		mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf("EXPLAIN SELECT `id` FROM `test`.`t` PARTITION(`%s`)", partition))).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "rows"}).AddRow("1", len(ids)))
+	}
+	for i := 0; i < 2; i++ {
+		// the second time is for the whole partition p1, which has fewer rows than conf.Rows
+		mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("id", "").AddRow("v", ""))
+		mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").WithArgs("test", "t").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+	}
+
+	taskChan := make(chan Task, 128)
+	c.Assert(d.concurrentDumpTable(tctx, conn, meta, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// write the rows of each chunk, which are in its partition and the range of its key
+	extStore, err := conf.createExternalStorage(tctx)
+	c.Assert(err, IsNil)
+	writer := NewWriter(tctx, 0, conf, conn, extStore)
+	chunks := map[string]int{}
+	for task := range taskChan {
+		td := task.(*TaskTableData)
+		query := td.Data.(*tableData).query
+		var partition string
+		for p := range partitionIDs {
+			if strings.Contains(query, fmt.Sprintf("PARTITION(`%s`)", p)) {
+				partition = p
+			}
+		}
+		c.Assert(partition, Not(Equals), "", Commentf("query %s", query))
+		c.Assert(td.TotalChunks, Equals, 6)
+		chunks[partition]++
+		var data [][]driver.Value
+		for _, id := range partitionIDs[partition] {
+			if td.keyRange == nil || (td.keyRange.lower.Int64() <= id && id < td.keyRange.upper.Int64()) {
+				data = append(data, []driver.Value{id, "v"})
+			}
+		}
+		tableIR := newMockTableIR("test", "t", data, nil, []string{"INT", "VARCHAR"})
+		c.Assert(writer.WriteTableData(tableIR, tableIR, td.ChunkIndex), IsNil)
+	}
+	c.Assert(chunks, DeepEquals, map[string]int{"p0": 3, "p1": 1, "p2": 2})
+
+	// every row of each partition is dumped exactly once
+	files, err := ioutil.ReadDir(conf.OutputDirPath)
+	c.Assert(err, IsNil)
+	seen := map[string]int{}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "test.t.") {
+			continue
+		}
+		content, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, file.Name()))
+		c.Assert(err, IsNil)
+		for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+			seen[strings.Split(line, ",")[0]]++
+		}
+	}
+	expected := map[string]int{}
+	for _, ids := range partitionIDs {
+		for _, id := range ids {
+			expected[fmt.Sprint(id)] = 1
+		}
+	}
+	c.Assert(seen, DeepEquals, expected)
+}
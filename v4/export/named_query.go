@@ -0,0 +1,173 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// NamedQuery is a SELECT statement whose result is dumped as the table Database.Table
+type NamedQuery struct {
+	Database string
+	Table    string
+	SQL      string
+}
+
+// ParseNamedQueries parses the named queries in the format of `db.table=SELECT ...`
+func ParseNamedQueries(specs []string) ([]NamedQuery, error) {
+	queries := make([]NamedQuery, 0, len(specs))
+	seen := make(map[[2]string]struct{}, len(specs))
+	for _, spec := range specs {
+		name, query, ok := cutString(spec, "=")
+		if !ok {
+			return nil, errors.Errorf("named query `%s` should be in the format of db.table=SELECT ...", spec)
+		}
+		db, tbl, ok := cutString(strings.TrimSpace(name), ".")
+		if !ok || db == "" || tbl == "" {
+			return nil, errors.Errorf("named query `%s` only accepts qualified table names", spec)
+		}
+		query = strings.TrimRight(strings.TrimSpace(query), "; \t\r\n")
+		if query == "" {
+			return nil, errors.Errorf("query of table `%s`.`%s` is empty", db, tbl)
+		}
+		key := [2]string{db, tbl}
+		if _, ok := seen[key]; ok {
+			return nil, errors.Errorf("query of table `%s`.`%s` is specified more than once", db, tbl)
+		}
+		seen[key] = struct{}{}
+		queries = append(queries, NamedQuery{Database: db, Table: tbl, SQL: query})
+	}
+	return queries, nil
+}
+
+// dumpNamedQueries dumps the result of each named query as a table with the schema inferred from the result.
+// The results aren't split into chunks.
+func (d *Dumper) dumpNamedQueries(tctx *tcontext.Context, metaConn *sql.Conn, taskChan chan<- Task) error {
+	conf := d.conf
+	dumpedDatabases := make(map[string]struct{})
+	for _, q := range conf.NamedQueries {
+		meta, err := namedQueryMeta(metaConn, q)
+		if err != nil {
+			return err
+		}
+		if _, ok := dumpedDatabases[q.Database]; !ok && !conf.NoSchemas && !conf.NoCreateDatabase {
+			dumpedDatabases[q.Database] = struct{}{}
+			createDatabaseSQL := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", escapeString(q.Database))
+			if d.sendTaskToChan(tctx, NewTaskDatabaseMeta(q.Database, createDatabaseSQL), taskChan) {
+				return tctx.Err()
+			}
+		}
+		if !conf.NoSchemas {
+			if d.sendTaskToChan(tctx, NewTaskTableMeta(q.Database, q.Table, meta.showCreateTable), taskChan) {
+				return tctx.Err()
+			}
+		}
+		if conf.NoData {
+			continue
+		}
+		tctx.L().Info("dump named query", zap.String("database", q.Database), zap.String("table", q.Table),
+			zap.String("query", q.SQL))
+		task := NewTaskTableData(meta, newTableData(q.SQL, len(meta.colTypes), false), 0, 1)
+		if d.sendTaskToChan(tctx, task, taskChan) {
+			return tctx.Err()
+		}
+	}
+	return nil
+}
+
+// namedQueryMeta gets the columns of the result of the query without reading any row,
+// and builds the meta of the table holding the result
+func namedQueryMeta(conn *sql.Conn, q NamedQuery) (*tableMeta, error) {
+	query := fmt.Sprintf("SELECT * FROM (%s) AS `dumpling_named_query` LIMIT 0", q.SQL)
+	rows, err := conn.QueryContext(context.Background(), query)
+	if err != nil {
+		return nil, errors.Annotatef(err, "sql: %s", query)
+	}
+	defer rows.Close()
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, errors.Annotatef(err, "sql: %s", query)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Annotatef(err, "sql: %s", query)
+	}
+	names := make([]string, 0, len(colTypes))
+	seen := make(map[string]struct{}, len(colTypes))
+	for _, ct := range colTypes {
+		lower := strings.ToLower(ct.Name())
+		if _, ok := seen[lower]; ok {
+			return nil, errors.Errorf("result of the query of table `%s`.`%s` has duplicated column `%s`", q.Database, q.Table, ct.Name())
+		}
+		seen[lower] = struct{}{}
+		names = append(names, wrapBackTicks(escapeString(ct.Name())))
+	}
+	return &tableMeta{
+		database:        q.Database,
+		table:           q.Table,
+		colTypes:        colTypes,
+		selectedField:   strings.Join(names, ","),
+		specCmts:        []string{"/*!40101 SET NAMES binary*/;"},
+		showCreateTable: createTableFromColumnTypes(q.Table, colTypes),
+	}, nil
+}
+
+// createTableFromColumnTypes builds the create table SQL of a table holding the rows of the columns.
+// The lengths of the string columns and the values of ENUM and SET columns aren't known from the result,
+// so they are created as the long string types.
+func createTableFromColumnTypes(table string, colTypes []*sql.ColumnType) string {
+	columns := make([]string, 0, len(colTypes))
+	for _, ct := range colTypes {
+		column := fmt.Sprintf("  `%s` %s", escapeString(ct.Name()), columnDefinitionOf(ct))
+		if nullable, ok := ct.Nullable(); ok && !nullable {
+			column += " NOT NULL"
+		}
+		columns = append(columns, column)
+	}
+	return fmt.Sprintf("CREATE TABLE `%s` (\n%s\n)", escapeString(table), strings.Join(columns, ",\n"))
+}
+
+var unsignedScanTypes = map[reflect.Kind]struct{}{
+	reflect.Uint8: {}, reflect.Uint16: {}, reflect.Uint32: {}, reflect.Uint64: {},
+}
+
+func columnDefinitionOf(ct *sql.ColumnType) string {
+	typeName := ct.DatabaseTypeName()
+	switch typeName {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT":
+		if scanType := ct.ScanType(); scanType != nil {
+			if _, ok := unsignedScanTypes[scanType.Kind()]; ok {
+				return typeName + " UNSIGNED"
+			}
+		}
+		return typeName
+	case "DECIMAL":
+		if precision, scale, ok := ct.DecimalSize(); ok && precision > 0 {
+			return fmt.Sprintf("DECIMAL(%d,%d)", precision, scale)
+		}
+		return "DECIMAL(65,30)"
+	case "DATETIME", "TIMESTAMP", "TIME":
+		if _, fsp, ok := ct.DecimalSize(); ok && fsp > 0 && fsp <= 6 {
+			return fmt.Sprintf("%s(%d)", typeName, fsp)
+		}
+		return typeName
+	case "CHAR", "VARCHAR", "ENUM", "SET":
+		return "LONGTEXT"
+	case "BINARY", "VARBINARY", "":
+		return "LONGBLOB"
+	case "BIT":
+		return "BIT(64)"
+	case "NULL":
+		return "BINARY(0)"
+	default:
+		return typeName
+	}
+}
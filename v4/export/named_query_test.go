@@ -0,0 +1,92 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testConfigSuite) TestParseNamedQueries(c *C) {
+	queries, err := ParseNamedQueries([]string{
+		"report.daily = SELECT d, SUM(x) AS total FROM t WHERE a = 'b=c' GROUP BY d;",
+		"report.users=SELECT * FROM users",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(queries, DeepEquals, []NamedQuery{
+		{Database: "report", Table: "daily", SQL: "SELECT d, SUM(x) AS total FROM t WHERE a = 'b=c' GROUP BY d"},
+		{Database: "report", Table: "users", SQL: "SELECT * FROM users"},
+	})
+
+	_, err = ParseNamedQueries([]string{"report.daily"})
+	c.Assert(err, ErrorMatches, "named query `report.daily` should be in the format of db.table=SELECT ...")
+	_, err = ParseNamedQueries([]string{"daily=SELECT 1"})
+	c.Assert(err, ErrorMatches, "named query `daily=SELECT 1` only accepts qualified table names")
+	_, err = ParseNamedQueries([]string{"report.daily= ;"})
+	c.Assert(err, ErrorMatches, "query of table `report`.`daily` is empty")
+	_, err = ParseNamedQueries([]string{"report.daily=SELECT 1", "report.daily=SELECT 2"})
+	c.Assert(err, ErrorMatches, "query of table `report`.`daily` is specified more than once")
+
+	conf := defaultConfigForTest(c)
+	conf.NamedQueries = queries
+	conf.SQL = "SELECT 1"
+	c.Assert(validateSpecifiedSQL(conf), ErrorMatches, "can't specify both --sql and --named-query.*")
+	conf.SQL = ""
+	conf.Where = "a > 1"
+	c.Assert(validateSpecifiedSQL(conf), ErrorMatches, "can't specify both --named-query and --where.*")
+}
+
+func (s *testSQLSuite) TestDumpNamedQueries(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.NamedQueries = []NamedQuery{
+		{Database: "report", Table: "daily", SQL: "SELECT d, COUNT(*) AS n, SUM(x) AS total FROM t GROUP BY d"},
+		{Database: "report", Table: "names", SQL: "SELECT name, b FROM t"},
+	}
+	d := &Dumper{tctx: tctx, conf: conf}
+	mock.ExpectQuery("SELECT \\* FROM \\(SELECT d, COUNT\\(\\*\\) AS n, SUM\\(x\\) AS total FROM t GROUP BY d\\) AS `dumpling_named_query` LIMIT 0").
+		WillReturnRows(mock.NewRowsWithColumnDefinition(
+			mock.NewColumn("d").OfType("DATETIME", "").WithPrecisionAndScale(3, 3).Nullable(true),
+			mock.NewColumn("n").OfType("BIGINT", int64(0)).Nullable(false),
+			mock.NewColumn("total").OfType("DECIMAL", "").WithPrecisionAndScale(32, 2).Nullable(true)))
+	mock.ExpectQuery("SELECT \\* FROM \\(SELECT name, b FROM t\\) AS `dumpling_named_query` LIMIT 0").
+		WillReturnRows(mock.NewRowsWithColumnDefinition(
+			mock.NewColumn("name").OfType("VARCHAR", "").Nullable(false),
+			mock.NewColumn("b").OfType("TINYINT", uint8(0)).Nullable(false)))
+
+	taskChan := make(chan Task, 8)
+	c.Assert(d.dumpNamedQueries(tctx, conn, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	var tasks []Task
+	for task := range taskChan {
+		tasks = append(tasks, task)
+	}
+	c.Assert(tasks, HasLen, 5)
+	dbMeta, ok := tasks[0].(*TaskDatabaseMeta)
+	c.Assert(ok, IsTrue)
+	c.Assert(dbMeta.CreateDatabaseSQL, Equals, "CREATE DATABASE IF NOT EXISTS `report`")
+	tableMeta, ok := tasks[1].(*TaskTableMeta)
+	c.Assert(ok, IsTrue)
+	c.Assert(tableMeta.TableName, Equals, "daily")
+	c.Assert(tableMeta.CreateTableSQL, Equals, "CREATE TABLE `daily` (\n  `d` DATETIME(3),\n  `n` BIGINT NOT NULL,\n  `total` DECIMAL(32,2)\n)")
+	dataTask, ok := tasks[2].(*TaskTableData)
+	c.Assert(ok, IsTrue)
+	c.Assert(dataTask.Meta.TableName(), Equals, "daily")
+	c.Assert(dataTask.Meta.SelectedField(), Equals, "(`d`,`n`,`total`)")
+	c.Assert(dataTask.Data.(*tableData).query, Equals, "SELECT d, COUNT(*) AS n, SUM(x) AS total FROM t GROUP BY d")
+	tableMeta, ok = tasks[3].(*TaskTableMeta)
+	c.Assert(ok, IsTrue)
+	c.Assert(tableMeta.CreateTableSQL, Equals, "CREATE TABLE `names` (\n  `name` LONGTEXT NOT NULL,\n  `b` TINYINT UNSIGNED NOT NULL\n)")
+	_, ok = tasks[4].(*TaskTableData)
+	c.Assert(ok, IsTrue)
+}
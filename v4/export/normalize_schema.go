@@ -0,0 +1,201 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	whitespaceRegexp        = regexp.MustCompile(`\s+`)
+	openParenSpaceRegexp    = regexp.MustCompile(`\(\s+`)
+	closeParenSpaceRegexp   = regexp.MustCompile(`\s+\)`)
+	commaSpaceRegexp        = regexp.MustCompile(`\s*,\s*`)
+	bareWordRegexp          = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_$]*`)
+	columnTypeNameRegexp    = regexp.MustCompile("^(\x00[0-9]+\x00 )([A-Za-z]+)")
+	integerDisplayWidth     = regexp.MustCompile("^(\x00[0-9]+\x00 (?:tinyint|smallint|mediumint|int|bigint))\\(([0-9]+)\\)")
+	keyDefinitionRegexp     = regexp.MustCompile(`^(PRIMARY|KEY|INDEX|UNIQUE|FULLTEXT|SPATIAL|CONSTRAINT|FOREIGN|CHECK)\b`)
+	indexKeywordRegexp      = regexp.MustCompile(`^((?:UNIQUE|FULLTEXT|SPATIAL) )?INDEX\b`)
+	referencesRegexp        = regexp.MustCompile("\\bREFERENCES (\x00[0-9]+\x00(?:\\.\x00[0-9]+\x00)?) ?\\(")
+	checkRegexp             = regexp.MustCompile(`\bCHECK ?\(`)
+	columnCharsetNameRegexp = regexp.MustCompile(`\b(CHARACTER SET|COLLATE) (\w+)`)
+	currentTimestampRegexp  = regexp.MustCompile(`(?i)\b(?:current_timestamp|now)\(([0-9]*)\)`)
+	tableCharsetOptRegexp   = regexp.MustCompile(`(?i)^\s*(?:DEFAULT\s+)?(CHARACTER\s+SET|CHARSET|COLLATE)\s*=?\s*(\w+)`)
+	tableOptRegexp          = regexp.MustCompile("^\\s*(\\w+)\\s*=\\s*(\x00[0-9]+\x00|[\\w.]+)")
+)
+
+// normalizedUpperKeywords are the keywords written in upper case by the normalization like `SHOW CREATE TABLE` does
+var normalizedUpperKeywords = make(map[string]struct{})
+
+// normalizedLowerKeywords are the attributes of the data types written in lower case like `SHOW CREATE TABLE` does
+var normalizedLowerKeywords = map[string]struct{}{"UNSIGNED": {}, "SIGNED": {}, "ZEROFILL": {}}
+
+func init() {
+	for _, keyword := range strings.Fields(`CREATE TEMPORARY GLOBAL TABLE IF NOT EXISTS NULL DEFAULT AUTO_INCREMENT
+		AUTO_RANDOM CHARACTER SET COLLATE COMMENT PRIMARY KEY UNIQUE INDEX FULLTEXT SPATIAL FOREIGN REFERENCES
+		CONSTRAINT CHECK ENFORCED ON UPDATE DELETE CASCADE RESTRICT NO ACTION MATCH FULL PARTIAL SIMPLE USING
+		BTREE HASH RTREE GENERATED ALWAYS AS VIRTUAL STORED CURRENT_TIMESTAMP VISIBLE INVISIBLE SRID COLUMN_FORMAT
+		FIXED DYNAMIC STORAGE DISK MEMORY KEY_BLOCK_SIZE WITH PARSER ASC DESC CLUSTERED NONCLUSTERED`) {
+		normalizedUpperKeywords[keyword] = struct{}{}
+	}
+}
+
+// tableOptionOrder is the order of the table options written by the normalization, which follows the order
+// `SHOW CREATE TABLE` of MySQL writes them. The other options are written after them in their own order.
+var tableOptionOrder = []string{
+	"ENGINE", "AUTO_INCREMENT", "DEFAULT CHARSET", "COLLATE", "MIN_ROWS", "MAX_ROWS", "AVG_ROW_LENGTH",
+	"PACK_KEYS", "STATS_PERSISTENT", "STATS_AUTO_RECALC", "STATS_SAMPLE_PAGES", "CHECKSUM", "DELAY_KEY_WRITE",
+	"ROW_FORMAT", "KEY_BLOCK_SIZE", "COMPRESSION", "ENCRYPTION", "COMMENT",
+}
+
+type tableOption struct {
+	name, value string
+}
+
+// normalizeCreateTable rewrites createTableSQL into a canonical form, so the schemas dumped from different
+// server versions diff cleanly. Only the formatting is rewritten: the whitespaces, the casing of keywords,
+// the synonyms like utf8mb3 and now(), the deprecated display widths of integers and the order of the table
+// options. The quoted identifiers, strings and the clauses which can't be parsed, like partitioning, are kept.
+func normalizeCreateTable(createTableSQL string) string {
+	// hide the quoted identifiers and strings, so they won't be rewritten
+	var literals []string
+	stmt := quotedLiteralPattern.ReplaceAllStringFunc(createTableSQL, func(literal string) string {
+		literals = append(literals, literal)
+		return fmt.Sprintf("\x00%d\x00", len(literals)-1)
+	})
+	start := strings.IndexByte(stmt, '(')
+	end := closingParenIndex(stmt)
+	if start < 0 || end < 0 {
+		return createTableSQL
+	}
+	var bf strings.Builder
+	bf.WriteString(normalizeKeywords(strings.TrimSpace(whitespaceRegexp.ReplaceAllString(stmt[:start], " "))))
+	bf.WriteString(" (\n")
+	for i, def := range splitDefinitions(stmt[start+1 : end]) {
+		if i > 0 {
+			bf.WriteString(",\n")
+		}
+		bf.WriteString("  ")
+		bf.WriteString(normalizeDefinition(def))
+	}
+	bf.WriteString("\n)")
+	bf.WriteString(normalizeTableOptions(stmt[end+1:]))
+	return placeholderRegexp.ReplaceAllStringFunc(bf.String(), func(placeholder string) string {
+		return literals[placeholderIndex(placeholder)]
+	})
+}
+
+// normalizeDefinition normalizes a column, index or constraint definition whose quoted literals are hidden
+func normalizeDefinition(def string) string {
+	def = strings.TrimSpace(whitespaceRegexp.ReplaceAllString(def, " "))
+	def = openParenSpaceRegexp.ReplaceAllString(def, "(")
+	def = closeParenSpaceRegexp.ReplaceAllString(def, ")")
+	def = commaSpaceRegexp.ReplaceAllString(def, ",")
+	def = normalizeKeywords(def)
+	def = currentTimestampRegexp.ReplaceAllStringFunc(def, func(s string) string {
+		if precision := currentTimestampRegexp.FindStringSubmatch(s)[1]; precision != "" {
+			return "CURRENT_TIMESTAMP(" + precision + ")"
+		}
+		return "CURRENT_TIMESTAMP"
+	})
+	def = columnCharsetNameRegexp.ReplaceAllStringFunc(def, func(s string) string {
+		m := columnCharsetNameRegexp.FindStringSubmatch(s)
+		return m[1] + " " + normalizeCharsetName(m[2])
+	})
+	if strings.HasPrefix(def, "\x00") {
+		// the data type is written in lower case
+		def = columnTypeNameRegexp.ReplaceAllStringFunc(def, strings.ToLower)
+		// the display width of integers is deprecated, except for tinyint(1) and the columns with zerofill
+		if m := integerDisplayWidth.FindStringSubmatchIndex(def); m != nil && !strings.Contains(def, " zerofill") {
+			if !(strings.HasSuffix(def[:m[3]], "tinyint") && def[m[4]:m[5]] == "1") {
+				def = def[:m[3]] + def[m[1]:]
+			}
+		}
+		return def
+	}
+	if !keyDefinitionRegexp.MatchString(def) {
+		return def
+	}
+	def = indexKeywordRegexp.ReplaceAllString(def, "${1}KEY")
+	// the key parts are separated from the index name by a space
+	if idx := strings.IndexByte(def, '('); idx > 0 {
+		def = strings.TrimRight(def[:idx], " ") + " " + def[idx:]
+	}
+	def = referencesRegexp.ReplaceAllString(def, "REFERENCES $1 (")
+	return checkRegexp.ReplaceAllString(def, "CHECK (")
+}
+
+// normalizeKeywords writes the keywords in s in the casing of `SHOW CREATE TABLE`, the other words are kept
+func normalizeKeywords(s string) string {
+	return bareWordRegexp.ReplaceAllStringFunc(s, func(word string) string {
+		upper := strings.ToUpper(word)
+		if _, ok := normalizedUpperKeywords[upper]; ok {
+			return upper
+		}
+		if _, ok := normalizedLowerKeywords[upper]; ok {
+			return strings.ToLower(word)
+		}
+		return word
+	})
+}
+
+// normalizeCharsetName writes the name of a character set or a collation in lower case, and utf8mb3 as utf8
+func normalizeCharsetName(name string) string {
+	name = strings.ToLower(name)
+	if name == "utf8mb3" || strings.HasPrefix(name, "utf8mb3_") {
+		return "utf8" + strings.TrimPrefix(name, "utf8mb3")
+	}
+	return name
+}
+
+// normalizeTableOptions normalizes the table options after the definitions, the clauses after the options
+// which can't be parsed are kept as is
+func normalizeTableOptions(options string) string {
+	var opts []tableOption
+	for {
+		if m := tableCharsetOptRegexp.FindStringSubmatch(options); m != nil {
+			name := "DEFAULT CHARSET"
+			if strings.EqualFold(m[1], "COLLATE") {
+				name = "COLLATE"
+			}
+			opts = append(opts, tableOption{name: name, value: normalizeCharsetName(m[2])})
+			options = options[len(m[0]):]
+			continue
+		}
+		if m := tableOptRegexp.FindStringSubmatch(options); m != nil {
+			opt := tableOption{name: strings.ToUpper(m[1]), value: m[2]}
+			if opt.name == "ROW_FORMAT" {
+				opt.value = strings.ToUpper(opt.value)
+			}
+			opts = append(opts, opt)
+			options = options[len(m[0]):]
+			continue
+		}
+		break
+	}
+	rank := func(name string) int {
+		for i, n := range tableOptionOrder {
+			if n == name {
+				return i
+			}
+		}
+		return len(tableOptionOrder)
+	}
+	sort.SliceStable(opts, func(i, j int) bool {
+		return rank(opts[i].name) < rank(opts[j].name)
+	})
+	var bf strings.Builder
+	for _, opt := range opts {
+		bf.WriteString(" " + opt.name + "=" + opt.value)
+	}
+	if rest := strings.TrimLeft(options, " \t"); rest != "" {
+		if !strings.HasPrefix(rest, "\n") {
+			bf.WriteString(" ")
+		}
+		bf.WriteString(strings.TrimRight(rest, " \t\n"))
+	}
+	return bf.String()
+}
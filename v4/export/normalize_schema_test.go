@@ -0,0 +1,92 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestNormalizeCreateTable(c *C) {
+	expected := "CREATE TABLE `t` (\n" +
+		"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+		"  `name` varchar(64) CHARACTER SET utf8 COLLATE utf8_bin DEFAULT NULL COMMENT 'the  name, not null',\n" +
+		"  `flag` tinyint(1) NOT NULL DEFAULT '0',\n" +
+		"  `amount` bigint(20) unsigned zerofill DEFAULT NULL,\n" +
+		"  `price` decimal(10,2) DEFAULT NULL,\n" +
+		"  `created` timestamp(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `uk_name` (`name`(10),`flag`),\n" +
+		"  KEY `idx_amount` (`amount`) USING BTREE,\n" +
+		"  CONSTRAINT `fk` FOREIGN KEY (`amount`) REFERENCES `t2` (`id`) ON DELETE CASCADE\n" +
+		") ENGINE=InnoDB AUTO_INCREMENT=5 DEFAULT CHARSET=latin1 ROW_FORMAT=DYNAMIC COMMENT='ENGINE=MyISAM'"
+
+	// MySQL 5.7 writes the display widths of integers and utf8
+	mysql57 := "CREATE TABLE `t` (\n" +
+		"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+		"  `name` varchar(64) CHARACTER SET utf8 COLLATE utf8_bin DEFAULT NULL COMMENT 'the  name, not null',\n" +
+		"  `flag` tinyint(1) NOT NULL DEFAULT '0',\n" +
+		"  `amount` bigint(20) unsigned zerofill DEFAULT NULL,\n" +
+		"  `price` decimal(10,2) DEFAULT NULL,\n" +
+		"  `created` timestamp(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `uk_name` (`name`(10),`flag`),\n" +
+		"  KEY `idx_amount` (`amount`) USING BTREE,\n" +
+		"  CONSTRAINT `fk` FOREIGN KEY (`amount`) REFERENCES `t2` (`id`) ON DELETE CASCADE\n" +
+		") ENGINE=InnoDB AUTO_INCREMENT=5 DEFAULT CHARSET=latin1 ROW_FORMAT=DYNAMIC COMMENT='ENGINE=MyISAM'"
+	// MySQL 8.0 drops the display widths except for tinyint(1) and zerofill, and writes utf8mb3
+	mysql80 := "CREATE TABLE `t` (\n" +
+		"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+		"  `name` varchar(64) CHARACTER SET utf8mb3 COLLATE utf8mb3_bin DEFAULT NULL COMMENT 'the  name, not null',\n" +
+		"  `flag` tinyint(1) NOT NULL DEFAULT '0',\n" +
+		"  `amount` bigint(20) unsigned zerofill DEFAULT NULL,\n" +
+		"  `price` decimal(10,2) DEFAULT NULL,\n" +
+		"  `created` timestamp(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `uk_name` (`name`(10),`flag`),\n" +
+		"  KEY `idx_amount` (`amount`) USING BTREE,\n" +
+		"  CONSTRAINT `fk` FOREIGN KEY (`amount`) REFERENCES `t2` (`id`) ON DELETE CASCADE\n" +
+		") ENGINE=InnoDB AUTO_INCREMENT=5 DEFAULT CHARSET=latin1 ROW_FORMAT=DYNAMIC COMMENT='ENGINE=MyISAM'"
+	// the other servers write the keywords, the spaces, the synonyms and the table options differently
+	other := "create table `t`(\n" +
+		"    `id` INT(11) not null auto_increment,\n" +
+		"    `name` VARCHAR( 64 ) character set UTF8MB3 collate utf8mb3_bin default null comment 'the  name, not null',\n" +
+		"    `flag` TINYINT(1) NOT NULL DEFAULT '0',\n" +
+		"    `amount` BIGINT(20) UNSIGNED ZEROFILL DEFAULT NULL,\n" +
+		"    `price` DECIMAL(10, 2) DEFAULT NULL,\n" +
+		"    `created` TIMESTAMP(3) NOT NULL DEFAULT current_timestamp(3) ON UPDATE now(3),\n" +
+		"    primary key(`id`),\n" +
+		"    unique index `uk_name`(`name`(10), `flag`),\n" +
+		"    index `idx_amount` (`amount`) using btree,\n" +
+		"    constraint `fk` foreign key(`amount`) references `t2`(`id`) on delete cascade\n" +
+		")   ENGINE = InnoDB COMMENT = 'ENGINE=MyISAM' CHARACTER SET = latin1 row_format=dynamic AUTO_INCREMENT=5"
+	for _, createTableSQL := range []string{mysql57, mysql80, other, expected} {
+		c.Assert(normalizeCreateTable(createTableSQL), Equals, expected)
+	}
+
+	// the clauses after the table options which can't be parsed are kept
+	createTableSQL := "CREATE TABLE `t` (\n" +
+		"  `id` int(11) NOT NULL,\n" +
+		"  `created` datetime DEFAULT now()\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci\n" +
+		"/*!50100 PARTITION BY RANGE (`id`)\n" +
+		"(PARTITION p0 VALUES LESS THAN (10) ENGINE = InnoDB,\n" +
+		" PARTITION p1 VALUES LESS THAN MAXVALUE ENGINE = InnoDB) */"
+	c.Assert(normalizeCreateTable(createTableSQL), Equals, "CREATE TABLE `t` (\n"+
+		"  `id` int NOT NULL,\n"+
+		"  `created` datetime DEFAULT CURRENT_TIMESTAMP\n"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci\n"+
+		"/*!50100 PARTITION BY RANGE (`id`)\n"+
+		"(PARTITION p0 VALUES LESS THAN (10) ENGINE = InnoDB,\n"+
+		" PARTITION p1 VALUES LESS THAN MAXVALUE ENGINE = InnoDB) */")
+
+	createTableSQL = "CREATE GLOBAL TEMPORARY TABLE `t` (\n" +
+		"  `id` bigint(20) NOT NULL,\n" +
+		"  PRIMARY KEY (`id`) /*T![clustered_index] CLUSTERED */\n" +
+		") ENGINE=memory DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin ON COMMIT DELETE ROWS"
+	c.Assert(normalizeCreateTable(createTableSQL), Equals, "CREATE GLOBAL TEMPORARY TABLE `t` (\n"+
+		"  `id` bigint NOT NULL,\n"+
+		"  PRIMARY KEY (`id`) /*T![clustered_index] CLUSTERED */\n"+
+		") ENGINE=memory DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin ON COMMIT DELETE ROWS")
+
+	c.Assert(normalizeCreateTable("CREATE TABLE `t`"), Equals, "CREATE TABLE `t`")
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// nullChunkIndex returns the index of the range among n ranges whose chunk also dumps the rows whose key is NULL
+// according to Config.NullsHandling, -1 if none of them does
+func nullChunkIndex(conf *Config, n int) int {
+	if n == 0 {
+		return -1
+	}
+	switch conf.NullsHandling {
+	case NullsHandlingFirst:
+		return 0
+	case NullsHandlingLast:
+		return n - 1
+	}
+	return -1
+}
+
+// chunkRangeCondition builds the condition of the half-open range [lower, upper) of key, which also selects the rows
+// whose key is NULL if withNull. It's parenthesized, so the NULL values are still selected when it's ANDed with
+// Config.Where, and every row matching Config.Where is selected by exactly one chunk.
+func chunkRangeCondition(key string, lower, upper *big.Int, withNull bool) string {
+	rangeCondition := fmt.Sprintf("(%s >= %d AND %s < %d)", key, lower, key, upper)
+	if withNull {
+		return fmt.Sprintf("(%s IS NULL OR %s)", key, rangeCondition)
+	}
+	return rangeCondition
+}
+
+// countNullKeys counts the rows of the table matching Config.Where whose key is NULL, which are dropped with
+// NullsHandlingExclude
+func countNullKeys(conn *sql.Conn, conf *Config, db, tbl, key string) (uint64, error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM `%s`.`%s` %s", escapeString(db), escapeString(tbl), buildWhereCondition(conf, key+" IS NULL"))
+	var count uint64
+	err := simpleQuery(conn, query, func(rows *sql.Rows) error {
+		return errors.Trace(rows.Scan(&count))
+	})
+	return count, err
+}
+
+// warnExcludedNulls logs the number of the rows excluded from the dump with NullsHandlingExclude
+func warnExcludedNulls(tctx *tcontext.Context, conn *sql.Conn, conf *Config, db, tbl, key string) error {
+	count, err := countNullKeys(conn, conf, db, tbl, key)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		tctx.L().Warn("the rows whose chunk key is NULL are excluded from the dump",
+			zap.String("database", db), zap.String("table", tbl),
+			zap.String("key", key), zap.Uint64("rows", count))
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"math"
+	"regexp"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/opcode"
+	_ "github.com/pingcap/tidb/types/parser_driver"
+)
+
+func (s *testSQLSuite) TestConcurrentDumpTableWithNullsHandling(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.Rows = 10
+	conf.SkipEstimate = true
+	conf.VerifyCoverage = true
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "test", table: "t"}
+
+	// the table is split by the nullable unique column `code`
+	const (
+		first  = "SELECT * FROM `test`.`t` WHERE ((`code` >= 1 AND `code` < 11)) ORDER BY `code`"
+		second = "SELECT * FROM `test`.`t` WHERE ((`code` >= 11 AND `code` < 21)) ORDER BY `code`"
+		nulls  = "SELECT * FROM `test`.`t` WHERE (`code` IS NULL) ORDER BY `code`"
+	)
+	testCases := []struct {
+		nullsHandling string
+		excluded      int
+		queries       []string
+	}{
+		{NullsHandlingFirst, -1, []string{"SELECT * FROM `test`.`t` WHERE ((`code` IS NULL OR (`code` >= 1 AND `code` < 11))) ORDER BY `code`", second}},
+		{NullsHandlingLast, -1, []string{first, "SELECT * FROM `test`.`t` WHERE ((`code` IS NULL OR (`code` >= 11 AND `code` < 21))) ORDER BY `code`"}},
+		{NullsHandlingSeparate, -1, []string{first, second, nulls}},
+		{NullsHandlingExclude, 3, []string{first, second}},
+	}
+	for _, t := range testCases {
+		conf.NullsHandling = t.nullsHandling
+		mock.ExpectQuery("SELECT column_name FROM information_schema.columns").WithArgs("test", "t", "PRI").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name"}))
+		mock.ExpectQuery("SELECT column_name FROM information_schema.columns").WithArgs("test", "t", "UNI").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("code"))
+		mock.ExpectQuery("SELECT MIN\\(`code`\\),MAX\\(`code`\\) FROM `test`.`t`").
+			WillReturnRows(sqlmock.NewRows([]string{"MIN", "MAX"}).AddRow(1, 20))
+		mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("code", ""))
+		mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").WithArgs("test", "t").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("code"))
+		if t.excluded >= 0 {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM `test`.`t` WHERE (`code` IS NULL)")).
+				WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(t.excluded))
+		}
+
+		taskChan := make(chan Task, 16)
+		c.Assert(d.concurrentDumpTable(tctx, conn, meta, taskChan), IsNil)
+		close(taskChan)
+		c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+		var queries []string
+		for task := range taskChan {
+			td := task.(*TaskTableData)
+			c.Assert(td.TotalChunks, Equals, len(t.queries))
+			queries = append(queries, td.Data.(*tableData).query)
+		}
+		c.Assert(queries, DeepEquals, t.queries, Commentf("nulls handling %s", t.nullsHandling))
+	}
+}
+
+// evalCondition evaluates the condition of the queries of the chunks on a row in the three-valued logic of SQL,
+// it returns nil for NULL
+func evalCondition(c *C, expr ast.ExprNode, row map[string]*int64) *int64 {
+	boolValue := func(b bool) *int64 {
+		v := int64(0)
+		if b {
+			v = 1
+		}
+		return &v
+	}
+	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return evalCondition(c, e.Expr, row)
+	case *ast.ColumnNameExpr:
+		v, ok := row[e.Name.Name.L]
+		c.Assert(ok, IsTrue, Commentf("unknown column %s", e.Name.Name.O))
+		return v
+	case ast.ValueExpr:
+		v, ok := e.GetValue().(int64)
+		c.Assert(ok, IsTrue, Commentf("unexpected value %v", e.GetValue()))
+		return &v
+	case *ast.IsNullExpr:
+		return boolValue((evalCondition(c, e.Expr, row) == nil) != e.Not)
+	case *ast.BinaryOperationExpr:
+		l, r := evalCondition(c, e.L, row), evalCondition(c, e.R, row)
+		switch e.Op {
+		case opcode.LogicAnd:
+			if (l != nil && *l == 0) || (r != nil && *r == 0) {
+				return boolValue(false)
+			}
+			if l == nil || r == nil {
+				return nil
+			}
+			return boolValue(true)
+		case opcode.LogicOr:
+			if (l != nil && *l != 0) || (r != nil && *r != 0) {
+				return boolValue(true)
+			}
+			if l == nil || r == nil {
+				return nil
+			}
+			return boolValue(false)
+		}
+		if l == nil || r == nil {
+			return nil
+		}
+		switch e.Op {
+		case opcode.EQ:
+			return boolValue(*l == *r)
+		case opcode.GT:
+			return boolValue(*l > *r)
+		case opcode.GE:
+			return boolValue(*l >= *r)
+		case opcode.LT:
+			return boolValue(*l < *r)
+		}
+	}
+	c.Fatalf("unsupported expression %T", expr)
+	return nil
+}
+
+// selectedRows returns the indexes of the rows selected by the where condition of query
+func selectedRows(c *C, query string, rows []map[string]*int64) []int {
+	stmt, err := parser.New().ParseOneStmt(query, "", "")
+	c.Assert(err, IsNil, Commentf("query %s", query))
+	where := stmt.(*ast.SelectStmt).Where
+	var selected []int
+	for i, row := range rows {
+		if where == nil {
+			selected = append(selected, i)
+		} else if v := evalCondition(c, where, row); v != nil && *v != 0 {
+			selected = append(selected, i)
+		}
+	}
+	return selected
+}
+
+func (s *testSQLSuite) TestConcurrentDumpTableWithNullsAndWhere(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	// the rows of the table whose chunk key `code` is nullable, the user's condition has an OR
+	// which must not take the conditions of the chunks as an operand
+	var rows []map[string]*int64
+	for i := int64(0); i < 100; i++ {
+		code, flag := new(int64), new(int64)
+		*code, *flag = i*7%53, i%3
+		if i%10 == 0 {
+			code = nil
+		}
+		rows = append(rows, map[string]*int64{"code": code, "flag": flag})
+	}
+	conf := DefaultConfig()
+	conf.Where = "flag = 1 OR code > 40"
+	expected := selectedRows(c, "SELECT COUNT(*) FROM `test`.`t` WHERE "+conf.Where, rows)
+	var min, max int64 = math.MaxInt64, math.MinInt64
+	for _, i := range expected {
+		if code := rows[i]["code"]; code != nil {
+			if *code < min {
+				min = *code
+			}
+			if *code > max {
+				max = *code
+			}
+		}
+	}
+
+	conf.Rows = 7
+	conf.SkipEstimate = true
+	conf.VerifyCoverage = true
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "test", table: "t"}
+	for _, nullsHandling := range []string{NullsHandlingFirst, NullsHandlingLast, NullsHandlingSeparate} {
+		comment := Commentf("nulls handling %s", nullsHandling)
+		conf.NullsHandling = nullsHandling
+		mock.ExpectQuery("SELECT column_name FROM information_schema.columns").WithArgs("test", "t", "PRI").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name"}))
+		mock.ExpectQuery("SELECT column_name FROM information_schema.columns").WithArgs("test", "t", "UNI").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("code"))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT MIN(`code`),MAX(`code`) FROM `test`.`t` WHERE " + conf.Where)).
+			WillReturnRows(sqlmock.NewRows([]string{"MIN", "MAX"}).AddRow(min, max))
+		mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("code", "").AddRow("flag", ""))
+		mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").WithArgs("test", "t").
+			WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("code"))
+
+		taskChan := make(chan Task, 16)
+		c.Assert(d.concurrentDumpTable(tctx, conn, meta, taskChan), IsNil)
+		close(taskChan)
+		c.Assert(mock.ExpectationsWereMet(), IsNil, comment)
+
+		// every row matching the user's condition is dumped by exactly one chunk
+		dumped := make(map[int]int)
+		chunks := 0
+		for task := range taskChan {
+			chunks++
+			for _, i := range selectedRows(c, task.(*TaskTableData).Data.(*tableData).query, rows) {
+				dumped[i]++
+			}
+		}
+		c.Assert(chunks > 2, IsTrue, comment)
+		c.Assert(dumped, HasLen, len(expected), comment)
+		for _, i := range expected {
+			c.Assert(dumped[i], Equals, 1, comment)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+type numberKind int
+
+const (
+	numberKindOther numberKind = iota
+	numberKindDecimal
+	numberKindFloat
+	numberKindDouble
+)
+
+func numberKindOf(colType string) numberKind {
+	switch strings.ToUpper(colType) {
+	case "DECIMAL", "NUMERIC", "FIXED":
+		return numberKindDecimal
+	case "FLOAT":
+		return numberKindFloat
+	case "DOUBLE", "DOUBLE PRECISION", "REAL":
+		return numberKindDouble
+	default:
+		return numberKindOther
+	}
+}
+
+// numberFormatter formats the DECIMAL and floating point values of the rows by Config.DecimalFormat
+// and Config.FloatFormat. It's only applied to csv and mongo-json files, the sql files are always exact.
+type numberFormatter struct {
+	decimalFormat string
+	floatFormat   string
+	kinds         []numberKind
+}
+
+// newNumberFormatter returns nil if the values are written as the server returns them
+func newNumberFormatter(cfg *Config, colTypes []string) *numberFormatter {
+	decimalFormat, floatFormat := cfg.DecimalFormat, cfg.FloatFormat
+	if decimalFormat == NumberFormatExact {
+		decimalFormat = ""
+	}
+	if floatFormat == NumberFormatExact {
+		floatFormat = ""
+	}
+	if decimalFormat == "" && floatFormat == "" {
+		return nil
+	}
+	kinds := make([]numberKind, len(colTypes))
+	for i, colType := range colTypes {
+		kinds[i] = numberKindOf(colType)
+	}
+	return &numberFormatter{decimalFormat: decimalFormat, floatFormat: floatFormat, kinds: kinds}
+}
+
+// format formats the numeric values of row in place
+func (f *numberFormatter) format(row RowReceiverArr) {
+	for i, kind := range f.kinds {
+		if kind == numberKindOther || i >= len(row.receivers) {
+			continue
+		}
+		s, ok := row.receivers[i].(*SQLTypeNumber)
+		if !ok || s.RawBytes == nil {
+			continue
+		}
+		switch kind {
+		case numberKindDecimal:
+			if f.decimalFormat == DecimalFormatTrimZeros {
+				s.RawBytes = trimDecimalZeros(s.RawBytes)
+			}
+		case numberKindFloat:
+			s.RawBytes = formatFloat(s.RawBytes, 32, f.floatFormat)
+		case numberKindDouble:
+			s.RawBytes = formatFloat(s.RawBytes, 64, f.floatFormat)
+		}
+	}
+}
+
+// trimDecimalZeros drops the trailing zeros of the fraction of a decimal, and the point if the fraction is empty
+func trimDecimalZeros(b []byte) []byte {
+	if bytes.IndexByte(b, '.') < 0 {
+		return b
+	}
+	b = bytes.TrimRight(b, "0")
+	b = bytes.TrimSuffix(b, []byte{'.'})
+	if string(b) == "-0" {
+		return []byte{'0'}
+	}
+	return b
+}
+
+// formatFloat formats a floating point value in the shortest representation which is parsed into the same value,
+// with or without scientific notation. The value is kept as is if it can't be parsed.
+func formatFloat(b []byte, bitSize int, format string) []byte {
+	var fmtByte byte
+	switch format {
+	case FloatFormatPlain:
+		fmtByte = 'f'
+	case FloatFormatScientific:
+		fmtByte = 'e'
+	default:
+		return b
+	}
+	v, err := strconv.ParseFloat(string(b), bitSize)
+	if err != nil {
+		return b
+	}
+	return strconv.AppendFloat(nil, v, fmtByte, -1, bitSize)
+}
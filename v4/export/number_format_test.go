@@ -0,0 +1,72 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestFormatNumbers(c *C) {
+	data := [][]driver.Value{
+		{"1", "12345678901234567890123456789012345.123456789012345678900", "1.7976931348623157e308", "3.40282e38"},
+		{"2", "-0.000", "5e-324", "1.17549e-38"},
+		{"3", "100.000", "123.5", "0.1"},
+		{"4", "-10", "-0.000001", "-1e-7"},
+		{"5", nil, nil, nil},
+	}
+	colTypes := []string{"INT", "DECIMAL", "DOUBLE", "FLOAT"}
+	opt := &csvOption{separator: []byte(","), nullValue: "\\N"}
+
+	// the values are exact by default
+	tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+	bf := storage.NewBufferWriter()
+	conf := configForWriteCSV(true, opt)
+	_, err := WriteInsertInCsv(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(err, IsNil)
+	c.Assert(bf.String(), Equals, "1,12345678901234567890123456789012345.123456789012345678900,1.7976931348623157e308,3.40282e38\n"+
+		"2,-0.000,5e-324,1.17549e-38\n"+
+		"3,100.000,123.5,0.1\n"+
+		"4,-10,-0.000001,-1e-7\n"+
+		"5,\\N,\\N,\\N\n")
+
+	tableIR = newMockTableIR("test", "t", data, nil, colTypes)
+	bf = storage.NewBufferWriter()
+	conf.DecimalFormat = DecimalFormatTrimZeros
+	conf.FloatFormat = FloatFormatPlain
+	_, err = WriteInsertInCsv(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(err, IsNil)
+	c.Assert(bf.String(), Equals, "1,12345678901234567890123456789012345.1234567890123456789,"+
+		"17976931348623157"+strings.Repeat("0", 292)+",340282000000000000000000000000000000000\n"+
+		"2,0,0."+strings.Repeat("0", 323)+"5,0.0000000000000000000000000000000000000117549\n"+
+		"3,100,123.5,0.1\n"+
+		"4,-10,-0.000001,-0.0000001\n"+
+		"5,\\N,\\N,\\N\n")
+
+	tableIR = newMockTableIR("test", "t", data, nil, colTypes)
+	bf = storage.NewBufferWriter()
+	conf.DecimalFormat = NumberFormatExact
+	conf.FloatFormat = FloatFormatScientific
+	_, err = WriteInsertInCsv(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(err, IsNil)
+	c.Assert(bf.String(), Equals, "1,12345678901234567890123456789012345.123456789012345678900,1.7976931348623157e+308,3.40282e+38\n"+
+		"2,-0.000,5e-324,1.17549e-38\n"+
+		"3,100.000,1.235e+02,1e-01\n"+
+		"4,-10,-1e-06,-1e-07\n"+
+		"5,\\N,\\N,\\N\n")
+
+	// the sql files are always exact
+	tableIR = newMockTableIR("test", "t", data, nil, colTypes)
+	bf = storage.NewBufferWriter()
+	sqlConf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+	sqlConf.DecimalFormat = DecimalFormatTrimZeros
+	sqlConf.FloatFormat = FloatFormatPlain
+	_, err = WriteInsert(tcontext.Background(), sqlConf, tableIR, tableIR, bf)
+	c.Assert(err, IsNil)
+	c.Assert(bf.String(), Matches, "(?s).*\\(3,100.000,123.5,0.1\\).*")
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// buildCollatedOrderByClause builds the ORDER BY clause of the columns like buildOrderByClauseString, the string
+// columns are ordered by Config.OrderByCollation, so the order doesn't depend on the collations of the columns
+// and the session. OrderByCollationBinary orders each column by the binary collation of its character set.
+func buildCollatedOrderByClause(conf *Config, conn *sql.Conn, database, table string, columns []string) (string, error) {
+	if conf.OrderByCollation == "" || len(columns) == 0 {
+		return buildOrderByClauseString(columns), nil
+	}
+	charsets := make(map[string]string)
+	err := simpleQueryWithArgs(conn, func(rows *sql.Rows) error {
+		var column, charset string
+		if err := rows.Scan(&column, &charset); err != nil {
+			return errors.Trace(err)
+		}
+		charsets[strings.ToLower(column)] = strings.ToLower(charset)
+		return nil
+	}, "SELECT COLUMN_NAME,CHARACTER_SET_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=? AND TABLE_NAME=? AND CHARACTER_SET_NAME IS NOT NULL",
+		database, table)
+	if err != nil {
+		return "", err
+	}
+
+	orderBy := make([]string, len(columns))
+	for i, col := range columns {
+		orderBy[i] = fmt.Sprintf("`%s`", escapeString(col))
+		charset, ok := charsets[strings.ToLower(col)]
+		// the binary strings are already ordered by their bytes
+		if !ok || charset == "binary" {
+			continue
+		}
+		collation := conf.OrderByCollation
+		if collation == OrderByCollationBinary {
+			collation = charset + "_bin"
+		} else if collationCharset(collation) != charset {
+			return "", errors.Errorf("can't order column `%s`.`%s`.`%s` of character set %s by collation %s",
+				database, table, col, charset, collation)
+		}
+		orderBy[i] += " COLLATE " + collation
+	}
+	return "ORDER BY " + strings.Join(orderBy, ","), nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestBuildCollatedOrderByClause(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	conf := DefaultConfig()
+	columns := []string{"id", "Name", "data"}
+
+	// the columns are ordered as they are without the option
+	clause, err := buildCollatedOrderByClause(conf, conn, "test", "t", columns)
+	c.Assert(err, IsNil)
+	c.Assert(clause, Equals, "ORDER BY `id`,`Name`,`data`")
+
+	testCases := []struct {
+		collation string
+		clause    string
+		err       string
+	}{
+		{OrderByCollationBinary, "ORDER BY `id`,`Name` COLLATE utf8mb4_bin,`data`", ""},
+		{"utf8mb4_0900_bin", "ORDER BY `id`,`Name` COLLATE utf8mb4_0900_bin,`data`", ""},
+		{"latin1_bin", "", "can't order column `test`.`t`.`Name` of character set utf8mb4 by collation latin1_bin"},
+	}
+	for _, t := range testCases {
+		conf.OrderByCollation = t.collation
+		c.Assert(adjustOrderByCollation(conf), IsNil)
+		mock.ExpectQuery("SELECT COLUMN_NAME,CHARACTER_SET_NAME FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t").
+			WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "CHARACTER_SET_NAME"}).
+				AddRow("name", "utf8mb4").AddRow("data", "binary").AddRow("comment", "latin1"))
+		clause, err = buildCollatedOrderByClause(conf, conn, "test", "t", columns)
+		if t.err != "" {
+			c.Assert(err, ErrorMatches, t.err)
+		} else {
+			c.Assert(err, IsNil)
+			c.Assert(clause, Equals, t.clause)
+		}
+	}
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	conf.OrderByCollation = "utf8mb4_bin; DROP TABLE t"
+	c.Assert(adjustOrderByCollation(conf), ErrorMatches, "invalid config.OrderByCollation .*")
+}
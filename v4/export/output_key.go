@@ -0,0 +1,92 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+const (
+	// outputKeyColumnName is the name of the key column prepended to each row in csv files
+	outputKeyColumnName = "_row_key"
+	// defaultOutputKeySeparator joins the values of the key columns
+	defaultOutputKeySeparator = "|"
+)
+
+// ParseOutputKeyColumns parses the key columns in the format of `db.table:col1,col2`
+// into database -> table -> key columns
+func ParseOutputKeyColumns(specs []string) (map[string]map[string][]string, error) {
+	result := make(map[string]map[string][]string)
+	for _, spec := range specs {
+		tablePart, columnsPart, ok := cutString(spec, ":")
+		if !ok {
+			return nil, errors.Errorf("output key columns `%s` should be in the format of db.table:col1,col2", spec)
+		}
+		db, tbl, ok := cutString(strings.TrimSpace(tablePart), ".")
+		if !ok || db == "" || tbl == "" {
+			return nil, errors.Errorf("output key columns `%s` only accepts qualified table names", spec)
+		}
+		if _, ok := result[db][tbl]; ok {
+			return nil, errors.Errorf("output key columns of table `%s`.`%s` are specified more than once", db, tbl)
+		}
+		var columns []string
+		for _, col := range strings.Split(columnsPart, ",") {
+			if col = strings.TrimSpace(col); col != "" {
+				columns = append(columns, col)
+			}
+		}
+		if len(columns) == 0 {
+			return nil, errors.Errorf("no output key column is specified for table `%s`.`%s`", db, tbl)
+		}
+		if _, ok := result[db]; !ok {
+			result[db] = make(map[string][]string)
+		}
+		result[db][tbl] = columns
+	}
+	return result, nil
+}
+
+// outputKeyIndices returns the indices of the output key columns of meta in the selected columns,
+// or nil if the table has no output key columns
+func outputKeyIndices(cfg *Config, meta TableMeta) ([]int, error) {
+	keyColumns := cfg.OutputKeyColumns[meta.DatabaseName()][meta.TableName()]
+	if len(keyColumns) == 0 {
+		return nil, nil
+	}
+	colNames := meta.ColumnNames()
+	indices := make([]int, 0, len(keyColumns))
+	for _, keyColumn := range keyColumns {
+		idx := -1
+		for i, name := range colNames {
+			if strings.EqualFold(name, keyColumn) {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, errors.Errorf("output key column `%s` isn't dumped in table `%s`.`%s`",
+				keyColumn, meta.DatabaseName(), meta.TableName())
+		}
+		indices = append(indices, idx)
+	}
+	return indices, nil
+}
+
+// writeOutputKeyInCsv writes the values of the key columns in row joined by separator as a csv field.
+// NULL values are written as empty strings.
+func writeOutputKeyInCsv(bf *bytes.Buffer, row RowReceiverArr, indices []int, separator string, escapeBackslash bool, opt *csvOption) { // revive:disable-line:flag-parameter
+	var key bytes.Buffer
+	for i, idx := range indices {
+		if i > 0 {
+			key.WriteString(separator)
+		}
+		key.Write(receiverRawBytes(row.receivers[idx]))
+	}
+	bf.Write(opt.delimiter)
+	escapeCSV(key.Bytes(), bf, escapeBackslash, opt)
+	bf.Write(opt.delimiter)
+	bf.Write(opt.separator)
+}
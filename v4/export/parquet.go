@@ -0,0 +1,337 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/summary"
+	"github.com/pingcap/errors"
+	"github.com/xitongsys/parquet-go/marshal"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultParquetRowGroupSize is the default number of the rows in a row group of the parquet files
+	defaultParquetRowGroupSize = 1024 * 1024
+	// parquetRootName is the name of the root of the parquet schema
+	parquetRootName = "schema"
+)
+
+// parquetType is the parquet type which a column is written as
+type parquetType int
+
+const (
+	parquetString parquetType = iota
+	parquetInt64
+	// parquetUnsignedInt64 is the bits of an unsigned 64-bit integer in INT64
+	parquetUnsignedInt64
+	parquetDouble
+	// parquetDecimal is the unscaled value of a decimal in big-endian two's complement
+	parquetDecimal
+	// parquetDate is the days since the unix epoch
+	parquetDate
+	// parquetTimestamp is the microseconds since the unix epoch
+	parquetTimestamp
+	parquetBinary
+	parquetJSON
+)
+
+// parquetColumn is a column of the parquet files
+type parquetColumn struct {
+	tp    parquetType
+	scale int
+}
+
+// parquetTypeOf maps the database type name of a column to its parquet type
+func parquetTypeOf(colType string) parquetType {
+	switch colType {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR", "BOOL", "BOOLEAN",
+		"UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT":
+		return parquetInt64
+	case "UNSIGNED BIGINT":
+		return parquetUnsignedInt64
+	case "FLOAT", "DOUBLE", "REAL", "DOUBLE PRECISION":
+		return parquetDouble
+	case "DECIMAL", "NUMERIC", "FIXED":
+		return parquetDecimal
+	case "DATE":
+		return parquetDate
+	case "DATETIME", "TIMESTAMP":
+		return parquetTimestamp
+	case "JSON":
+		return parquetJSON
+	}
+	if _, ok := dataTypeBin[colType]; ok {
+		return parquetBinary
+	}
+	return parquetString
+}
+
+// parquetSchemaOf returns the parquet schema of the table and its columns. All the fields are optional for NULL.
+// The fields are named by their positions when they're created, so any column name is kept as is in the footer.
+// The decimals are written as strings if their precision is unknown.
+func parquetSchemaOf(meta TableMeta) ([]*parquet.SchemaElement, []parquetColumn) {
+	colTypes := meta.ColumnTypes()
+	var decimalSizer func(i int) (int64, int64, bool)
+	if tm, ok := meta.(*tableMeta); ok && len(tm.colTypes) == len(colTypes) {
+		decimalSizer = func(i int) (int64, int64, bool) {
+			return tm.colTypes[i].DecimalSize()
+		}
+	}
+
+	numChildren := int32(len(colTypes))
+	elements := make([]*parquet.SchemaElement, 0, len(colTypes)+1)
+	elements = append(elements, &parquet.SchemaElement{
+		Name:           parquetRootName,
+		RepetitionType: parquet.FieldRepetitionTypePtr(parquet.FieldRepetitionType_REQUIRED),
+		NumChildren:    &numChildren,
+	})
+	columns := make([]parquetColumn, len(colTypes))
+	for i, colType := range colTypes {
+		element := &parquet.SchemaElement{
+			Name:           fmt.Sprintf("c%d", i),
+			RepetitionType: parquet.FieldRepetitionTypePtr(parquet.FieldRepetitionType_OPTIONAL),
+		}
+		tp := parquetTypeOf(strings.ToUpper(colType))
+		if tp == parquetDecimal {
+			precision, scale, ok := int64(0), int64(0), false
+			if decimalSizer != nil {
+				precision, scale, ok = decimalSizer(i)
+			}
+			if ok && precision > 0 {
+				element.Precision, element.Scale = int32Ptr(int32(precision)), int32Ptr(int32(scale))
+				columns[i].scale = int(scale)
+			} else {
+				tp = parquetString
+			}
+		}
+		columns[i].tp = tp
+		switch tp {
+		case parquetInt64:
+			element.Type, element.ConvertedType = parquet.TypePtr(parquet.Type_INT64), parquet.ConvertedTypePtr(parquet.ConvertedType_INT_64)
+		case parquetUnsignedInt64:
+			element.Type, element.ConvertedType = parquet.TypePtr(parquet.Type_INT64), parquet.ConvertedTypePtr(parquet.ConvertedType_UINT_64)
+		case parquetDouble:
+			element.Type = parquet.TypePtr(parquet.Type_DOUBLE)
+		case parquetDecimal:
+			element.Type, element.ConvertedType = parquet.TypePtr(parquet.Type_BYTE_ARRAY), parquet.ConvertedTypePtr(parquet.ConvertedType_DECIMAL)
+		case parquetDate:
+			element.Type, element.ConvertedType = parquet.TypePtr(parquet.Type_INT32), parquet.ConvertedTypePtr(parquet.ConvertedType_DATE)
+		case parquetTimestamp:
+			element.Type, element.ConvertedType = parquet.TypePtr(parquet.Type_INT64), parquet.ConvertedTypePtr(parquet.ConvertedType_TIMESTAMP_MICROS)
+		case parquetBinary:
+			element.Type = parquet.TypePtr(parquet.Type_BYTE_ARRAY)
+		case parquetJSON:
+			element.Type, element.ConvertedType = parquet.TypePtr(parquet.Type_BYTE_ARRAY), parquet.ConvertedTypePtr(parquet.ConvertedType_JSON)
+		default:
+			element.Type, element.ConvertedType = parquet.TypePtr(parquet.Type_BYTE_ARRAY), parquet.ConvertedTypePtr(parquet.ConvertedType_UTF8)
+		}
+		elements = append(elements, element)
+	}
+	return elements, columns
+}
+
+func int32Ptr(v int32) *int32 {
+	return &v
+}
+
+// parquetValue converts the raw value of a column to its parquet value. The dates are taken as UTC,
+// and the ones which can't be represented, such as the zero date, are written as NULL.
+func parquetValue(col parquetColumn, raw []byte) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	switch col.tp {
+	case parquetInt64:
+		v, err := strconv.ParseInt(string(raw), 10, 64)
+		return v, errors.Trace(err)
+	case parquetUnsignedInt64:
+		v, err := strconv.ParseUint(string(raw), 10, 64)
+		return int64(v), errors.Trace(err)
+	case parquetDouble:
+		v, err := strconv.ParseFloat(string(raw), 64)
+		return v, errors.Trace(err)
+	case parquetDecimal:
+		return decimalToParquetBytes(string(raw), col.scale)
+	case parquetDate, parquetTimestamp:
+		t, err := parseMongoJSONDate(string(raw))
+		if err != nil {
+			return nil, nil
+		}
+		if col.tp == parquetDate {
+			return int32(t.Unix() / (24 * 60 * 60)), nil
+		}
+		return t.Unix()*1000000 + int64(t.Nanosecond()/1000), nil
+	default:
+		return string(raw), nil
+	}
+}
+
+// decimalToParquetBytes converts a decimal to its unscaled value with scale in big-endian two's complement
+func decimalToParquetBytes(s string, scale int) (interface{}, error) {
+	intPart, fracPart := s, ""
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		intPart, fracPart = s[:dot], s[dot+1:]
+	}
+	if len(fracPart) > scale {
+		fracPart = fracPart[:scale]
+	}
+	fracPart += strings.Repeat("0", scale-len(fracPart))
+	unscaled, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok {
+		return nil, errors.Errorf("invalid decimal '%s'", s)
+	}
+	if unscaled.Sign() >= 0 {
+		b := unscaled.Bytes()
+		// the sign bit must be 0
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return string(b), nil
+	}
+	// the two's complement of a negative value -x in n bytes is 2^(8n) - x
+	n := (unscaled.BitLen() + 8) / 8
+	complement := new(big.Int).Lsh(big.NewInt(1), uint(n*8))
+	return string(complement.Add(complement, unscaled).Bytes()), nil
+}
+
+// parquetFile is the source.ParquetFile which the parquet writer writes a file of the external storage through
+type parquetFile struct {
+	ctx     context.Context
+	w       storage.ExternalFileWriter
+	written uint64
+}
+
+// Write implements io.Writer
+func (f *parquetFile) Write(p []byte) (int, error) {
+	n, err := f.w.Write(f.ctx, p)
+	f.written += uint64(n)
+	return n, err
+}
+
+// Close implements io.Closer, the file is closed by the caller
+func (f *parquetFile) Close() error {
+	return nil
+}
+
+// Read implements io.Reader
+func (f *parquetFile) Read([]byte) (int, error) {
+	return 0, errors.New("can't read the parquet file being written")
+}
+
+// Seek implements io.Seeker
+func (f *parquetFile) Seek(int64, int) (int64, error) {
+	return 0, errors.New("can't seek the parquet file being written")
+}
+
+// Open implements source.ParquetFile.Open
+func (f *parquetFile) Open(string) (source.ParquetFile, error) {
+	return nil, errors.New("can't open another parquet file")
+}
+
+// Create implements source.ParquetFile.Create
+func (f *parquetFile) Create(string) (source.ParquetFile, error) {
+	return nil, errors.New("can't create another parquet file")
+}
+
+// WriteInsertInParquet writes TableDataIR to a storage.ExternalFileWriter in Apache Parquet. The rows are
+// written into a row group every cfg.ParquetRowGroupSize rows, and the pages are compressed by snappy.
+// The binary columns are written as raw bytes.
+func WriteInsertInParquet(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR TableDataIR, w storage.ExternalFileWriter) (n uint64, err error) {
+	fileRowIter := tblIR.Rows()
+	if !fileRowIter.HasNext() {
+		return 0, fileRowIter.Error()
+	}
+	if meta.SelectedField() == "" {
+		return 0, errors.Errorf("can't write the rows of table `%s`.`%s` without any selected column into parquet files",
+			meta.DatabaseName(), meta.TableName())
+	}
+
+	elements, columns := parquetSchemaOf(meta)
+	names := meta.ColumnNames()
+	file := &parquetFile{ctx: pCtx, w: w}
+	pw, err := writer.NewParquetWriter(file, elements, 1)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	// the columns are renamed to their names in the footer
+	for i, name := range names {
+		if i+1 < len(pw.SchemaHandler.Infos) {
+			pw.SchemaHandler.Infos[i+1].ExName = name
+		}
+	}
+	pw.SchemaHandler.CreateInExMap()
+	pw.MarshalFunc = marshal.MarshalCSV
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	rowGroupSize := cfg.ParquetRowGroupSize
+	if rowGroupSize == 0 {
+		rowGroupSize = defaultParquetRowGroupSize
+	}
+
+	var (
+		row         = makeRowReceiver(meta.ColumnTypes(), false, false, "")
+		counter     uint64
+		lastCounter uint64
+		groupRows   uint64
+		rawSize     uint64
+	)
+	for fileRowIter.HasNext() {
+		if err = fileRowIter.Decode(row); err != nil {
+			pCtx.L().Error("fail to scan from sql.Row", zap.Error(err))
+			return counter, errors.Trace(err)
+		}
+		values := make([]interface{}, len(columns))
+		for i, receiver := range row.receivers {
+			raw := receiverRawBytes(receiver)
+			if values[i], err = parquetValue(columns[i], raw); err != nil {
+				return counter, errors.Annotatef(err, "fail to convert column %s of table `%s`.`%s` to parquet",
+					wrapBackTicks(escapeString(names[i])), meta.DatabaseName(), meta.TableName())
+			}
+			rawSize += uint64(len(raw))
+		}
+		if err = pw.Write(values); err != nil {
+			return counter, errors.Trace(err)
+		}
+		counter++
+		groupRows++
+		if groupRows >= rowGroupSize {
+			if err = pw.Flush(true); err != nil {
+				return counter, errors.Trace(err)
+			}
+			groupRows = 0
+			AddCounter(finishedRowsCounter, cfg.Labels, float64(counter-lastCounter))
+			lastCounter = counter
+		}
+
+		fileRowIter.Next()
+		if cfg.FileSize != UnspecifiedSize && rawSize >= cfg.FileSize {
+			break
+		}
+	}
+	if err = fileRowIter.Error(); err != nil {
+		return counter, errors.Trace(err)
+	}
+	if err = pw.WriteStop(); err != nil {
+		return counter, errors.Trace(err)
+	}
+
+	pCtx.L().Debug("finish dumping table(chunk)",
+		zap.String("database", meta.DatabaseName()),
+		zap.String("table", meta.TableName()),
+		zap.Uint64("total rows", counter))
+	summary.CollectSuccessUnit(summary.TotalBytes, 1, file.written)
+	summary.CollectSuccessUnit("total rows", 1, counter)
+	AddCounter(finishedRowsCounter, cfg.Labels, float64(counter-lastCounter))
+	return counter, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql/driver"
+	"io/ioutil"
+	"path"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func (s *testWriterSuite) TestDecimalToParquetBytes(c *C) {
+	for _, t := range []struct {
+		decimal  string
+		scale    int
+		expected string
+	}{
+		{"0", 0, "\x00"},
+		{"1.5", 2, "\x00\x96"},
+		{"127", 0, "\x7f"},
+		{"128", 0, "\x00\x80"},
+		{"-1", 0, "\xff"},
+		{"-1.28", 2, "\xff\x80"},
+		{"-0.01", 2, "\xff"},
+		{"-256", 0, "\xff\x00"},
+	} {
+		b, err := decimalToParquetBytes(t.decimal, t.scale)
+		c.Assert(err, IsNil)
+		c.Assert(b, Equals, t.expected, Commentf("decimal %s", t.decimal))
+	}
+	_, err := decimalToParquetBytes("1e3", 0)
+	c.Assert(err, ErrorMatches, "invalid decimal '1e3'")
+}
+
+func (s *testWriterSuite) TestWriteTableDataInParquet(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	names := []string{"id", "balance", "price", "ratio", "name", "data", "created", "born", "doc", "a,b"}
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t` LIMIT 1").
+		WillReturnRows(mock.NewRowsWithColumnDefinition(
+			mock.NewColumn(names[0]).OfType("INT", 0),
+			mock.NewColumn(names[1]).OfType("UNSIGNED BIGINT", 0),
+			mock.NewColumn(names[2]).OfType("DECIMAL", "").WithPrecisionAndScale(10, 2),
+			mock.NewColumn(names[3]).OfType("DOUBLE", 0),
+			mock.NewColumn(names[4]).OfType("VARCHAR", ""),
+			mock.NewColumn(names[5]).OfType("BLOB", ""),
+			mock.NewColumn(names[6]).OfType("DATETIME", ""),
+			mock.NewColumn(names[7]).OfType("DATE", ""),
+			mock.NewColumn(names[8]).OfType("JSON", ""),
+			mock.NewColumn(names[9]).OfType("TEXT", ""),
+		))
+	colTypes, err := GetColumnTypes(conn, "*", "test", "t")
+	c.Assert(err, IsNil)
+	meta := &tableMeta{database: "test", table: "t", colTypes: colTypes, selectedField: "*"}
+	data := [][]driver.Value{
+		{"1", "18446744073709551615", "-12.50", "1.5", "alice", "\x00\xff\x01", "2021-06-01 12:34:56.789", "2021-06-01", `{"a": 1}`, "x"},
+		{"2", "0", "0.00", "-0.25", "", "", "0000-00-00 00:00:00", "1969-12-31", "[]", "y"},
+		{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil},
+	}
+	tableIR := newMockTableIR("test", "t", data, nil, meta.ColumnTypes())
+
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = c.MkDir()
+	config.FileType = FileFormatParquetString
+	c.Assert(adjustFileFormat(config), IsNil)
+	config.ParquetRowGroupSize = 2
+	writer := s.newWriter(config, c)
+	c.Assert(writer.WriteTableData(meta, tableIR, 0), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	content, err := ioutil.ReadFile(path.Join(config.OutputDirPath, "test.t.000000000.parquet"))
+	c.Assert(err, IsNil)
+	pf, err := buffer.NewBufferFile(content)
+	c.Assert(err, IsNil)
+	pr, err := reader.NewParquetColumnReader(pf, 1)
+	c.Assert(err, IsNil)
+	defer pr.ReadStop()
+	c.Assert(pr.GetNumRows(), Equals, int64(len(data)))
+	c.Assert(pr.Footer.RowGroups, HasLen, 2)
+	for i, name := range names {
+		c.Assert(pr.SchemaHandler.GetExName(i+1), Equals, name)
+	}
+
+	expected := [][]interface{}{
+		{int64(1), int64(2), nil},
+		{int64(-1), int64(0), nil},
+		{"\xfb\x1e", "\x00", nil},
+		{1.5, -0.25, nil},
+		{"alice", "", nil},
+		{"\x00\xff\x01", "", nil},
+		// the zero date can't be represented
+		{int64(1622550896789000), nil, nil},
+		{int32(18779), int32(-1), nil},
+		{`{"a": 1}`, "[]", nil},
+		{"x", "y", nil},
+	}
+	for i, values := range expected {
+		actual, _, _, err := pr.ReadColumnByIndex(int64(i), int64(len(data)))
+		c.Assert(err, IsNil)
+		c.Assert(actual, DeepEquals, values, Commentf("column %s", names[i]))
+	}
+}
+
+func (s *testConfigSuite) TestAdjustParquetFileFormat(c *C) {
+	conf := DefaultConfig()
+	conf.FileType = "Parquet"
+	c.Assert(adjustFileFormat(conf), IsNil)
+	c.Assert(conf.FileType, Equals, FileFormatParquetString)
+
+	conf.CompressType = CompressGzip
+	c.Assert(adjustFileFormat(conf), ErrorMatches, "config.CompressType can't be used with the parquet file type.*")
+	conf.CompressType = CompressNone
+	conf.ParquetRowGroupSize = 0
+	c.Assert(adjustFileFormat(conf), ErrorMatches, "config.ParquetRowGroupSize must be positive")
+}
@@ -0,0 +1,354 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPartitionMaxOpenFiles = 64
+	// partitionNullValue is the value in the directory name of the rows whose partition column is NULL, the same as Hive
+	partitionNullValue = "__HIVE_DEFAULT_PARTITION__"
+	// partitionRowsBuffer is the number of the rows buffered for each open partition file
+	partitionRowsBuffer = 256
+)
+
+// parsePartitionByColumn parses Config.PartitionByColumn in the format of `db.table:column`
+func parsePartitionByColumn(spec string) (db, table, column string, err error) {
+	tablePart, column, ok := cutString(spec, ":")
+	column = strings.TrimSpace(column)
+	if !ok || column == "" {
+		return "", "", "", errors.Errorf("partition by column `%s` should be in the format of db.table:column", spec)
+	}
+	db, table, ok = cutString(strings.TrimSpace(tablePart), ".")
+	if !ok || db == "" || table == "" {
+		return "", "", "", errors.Errorf("partition by column `%s` only accepts a qualified table name", spec)
+	}
+	return db, table, column, nil
+}
+
+// setPartitionByColumn sets the column of meta to route its rows by with Config.PartitionByColumn
+func setPartitionByColumn(conf *Config, meta TableMeta) error {
+	tm, ok := meta.(*tableMeta)
+	if !ok || conf.PartitionByColumn == "" {
+		return nil
+	}
+	db, table, column, err := parsePartitionByColumn(conf.PartitionByColumn)
+	if err != nil {
+		return err
+	}
+	if db != tm.database || table != tm.table {
+		return nil
+	}
+	if _, missing := keyColumnIndices(meta, []string{column}); missing != "" {
+		return errors.Errorf("partition column `%s` isn't dumped in table `%s`.`%s`", column, db, table)
+	}
+	tm.partitionByColumn = column
+	return nil
+}
+
+func partitionByColumnOf(meta TableMeta) string {
+	if tm, ok := meta.(*tableMeta); ok {
+		return tm.partitionByColumn
+	}
+	return ""
+}
+
+// partitionDir returns the Hive-style directory `column=value` of the rows whose partition column is value
+func partitionDir(conf *Config, column string, value sql.RawBytes) string {
+	v := partitionNullValue
+	if value != nil {
+		v = escapeFileName(string(value))
+	}
+	return escapeFileName(outputIdentifier(conf, column)) + "=" + v
+}
+
+// copyRowValues copies the values decoded into row, since they're owned by the driver until the next row is read.
+// All the receivers are bound to *sql.RawBytes.
+func copyRowValues(row RowReceiver, args []interface{}) []sql.RawBytes {
+	row.BindAddress(args)
+	values := make([]sql.RawBytes, len(args))
+	for i, arg := range args {
+		if p, ok := arg.(*sql.RawBytes); ok && *p != nil {
+			values[i] = append(sql.RawBytes{}, *p...)
+		}
+	}
+	return values
+}
+
+// partitionRowsIR is the TableDataIR of the rows routed to a partition file
+type partitionRowsIR struct {
+	rows chan []sql.RawBytes
+	iter *partitionRowIter
+}
+
+func newPartitionRowsIR() *partitionRowsIR {
+	return &partitionRowsIR{rows: make(chan []sql.RawBytes, partitionRowsBuffer)}
+}
+
+// Start implements TableDataIR.Start
+func (p *partitionRowsIR) Start(*tcontext.Context, *sql.Conn) error {
+	return nil
+}
+
+// Rows implements TableDataIR.Rows, it blocks until the first row is routed
+func (p *partitionRowsIR) Rows() SQLRowIter {
+	if p.iter == nil {
+		p.iter = &partitionRowIter{rows: p.rows}
+		p.iter.Next()
+	}
+	return p.iter
+}
+
+// Close implements TableDataIR.Close
+func (p *partitionRowsIR) Close() error {
+	return nil
+}
+
+// RawRows implements TableDataIR.RawRows
+func (p *partitionRowsIR) RawRows() *sql.Rows {
+	return nil
+}
+
+type partitionRowIter struct {
+	rows    <-chan []sql.RawBytes
+	row     []sql.RawBytes
+	hasNext bool
+}
+
+// Decode implements SQLRowIter.Decode
+func (it *partitionRowIter) Decode(row RowReceiver) error {
+	args := make([]interface{}, len(it.row))
+	row.BindAddress(args)
+	for i, arg := range args {
+		if p, ok := arg.(*sql.RawBytes); ok {
+			*p = it.row[i]
+		}
+	}
+	return nil
+}
+
+// Next implements SQLRowIter.Next, it blocks until the next row is routed or there are no more rows
+func (it *partitionRowIter) Next() {
+	it.row, it.hasNext = <-it.rows
+}
+
+// Error implements SQLRowIter.Error
+func (it *partitionRowIter) Error() error {
+	return nil
+}
+
+// HasNext implements SQLRowIter.HasNext
+func (it *partitionRowIter) HasNext() bool {
+	return it.hasNext
+}
+
+// Close implements SQLRowIter.Close
+func (it *partitionRowIter) Close() error {
+	return nil
+}
+
+// partitionFile is an open file of a partition, its rows are written by a goroutine
+type partitionFile struct {
+	fileName string
+	ir       *partitionRowsIR
+	done     chan struct{}
+	lastUsed uint64
+
+	rows, bytes, compressedBytes, checksum uint64
+	err                                    error
+}
+
+// partitionRouter routes the rows of a chunk to the files of the partitions by the value of the partition column.
+// The files are opened lazily as new values appear, and the least recently used one is closed when
+// Config.PartitionMaxOpenFiles files are open. A partition is written into a new file if it's opened again.
+type partitionRouter struct {
+	w        *Writer
+	tctx     *tcontext.Context
+	meta     TableMeta
+	chunkIdx int
+	column   string
+	// localDir is the local output directory to create the partition directories in
+	localDir string
+
+	open map[string]*partitionFile
+	// fileIndex is the index of the next file of each partition
+	fileIndex map[string]int
+	used      uint64
+
+	rows, bytes, compressedBytes, checksum uint64
+}
+
+func (w *Writer) newPartitionRouter(tctx *tcontext.Context, meta TableMeta, chunkIdx int) (*partitionRouter, error) {
+	localDir, err := localOutputDir(w.conf)
+	if err != nil {
+		return nil, err
+	}
+	return &partitionRouter{
+		w:         w,
+		tctx:      tctx,
+		meta:      meta,
+		chunkIdx:  chunkIdx,
+		column:    partitionByColumnOf(meta),
+		localDir:  localDir,
+		open:      make(map[string]*partitionFile),
+		fileIndex: make(map[string]int),
+	}, nil
+}
+
+// file returns the open file of the partition in dir, it opens one if there isn't
+func (r *partitionRouter) file(dir string) (*partitionFile, error) {
+	r.used++
+	if f, ok := r.open[dir]; ok {
+		f.lastUsed = r.used
+		return f, nil
+	}
+	if len(r.open) >= r.w.conf.PartitionMaxOpenFiles {
+		var lru string
+		for d, f := range r.open {
+			if lru == "" || f.lastUsed < r.open[lru].lastUsed {
+				lru = d
+			}
+		}
+		if err := r.closeFile(lru); err != nil {
+			return nil, err
+		}
+	}
+	conf := r.w.conf
+	if r.localDir != "" {
+		// the local storage doesn't create the directories of the files
+		if err := os.MkdirAll(filepath.Join(r.localDir, dir), 0o755); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	namer := newOutputFileNamer(r.meta, r.chunkIdx, true, true)
+	namer.DB, namer.Table = outputIdentifier(conf, namer.DB), outputIdentifier(conf, namer.Table)
+	namer.subChunk = r.w.subChunk
+	namer.FileIndex = r.fileIndex[dir]
+	fileName, err := namer.NextName(conf.OutputFileTemplate, r.w.fileFmt.Extension())
+	if err != nil {
+		return nil, err
+	}
+	r.fileIndex[dir] = namer.FileIndex
+	f := &partitionFile{fileName: path.Join(dir, fileName), ir: newPartitionRowsIR(), done: make(chan struct{}), lastUsed: r.used}
+	r.open[dir] = f
+	go r.write(f)
+	return f, nil
+}
+
+// write writes the rows routed to f until its rows are closed, f.done is closed once it returns,
+// so the router isn't blocked if the file fails
+func (r *partitionRouter) write(f *partitionFile) {
+	defer close(f.done)
+	conf := r.w.conf
+	fileWriter, tearDown := buildInterceptFileWriter(r.tctx, r.w.extStorage, f.fileName, conf.CompressType, conf.EnsureTrailingNewline)
+	dataWriter, checksumWriter := withStatsChecksum(conf, withChunkProgress(withBytesRateLimit(fileWriter, r.w.bytesLimiter), r.w.chunkProgress))
+	f.rows, f.err = r.w.fileFmt.WriteInsert(r.tctx, conf, r.meta, f.ir, dataWriter)
+	tearDown(r.tctx)
+	if iw, ok := fileWriter.(*InterceptFileWriter); ok {
+		f.bytes, f.compressedBytes = iw.WrittenBytes, iw.CompressedBytes
+	}
+	f.checksum = checksumWriter.sum()
+}
+
+// route sends the row to the file of its partition
+func (r *partitionRouter) route(values []sql.RawBytes, colIdx int) error {
+	dir := partitionDir(r.w.conf, r.column, values[colIdx])
+	f, err := r.file(dir)
+	if err != nil {
+		return err
+	}
+	select {
+	case f.ir.rows <- values:
+		return nil
+	case <-f.done:
+		// the file stops reading the rows only if it fails, the error is returned when it's closed
+		return r.closeFile(dir)
+	case <-r.tctx.Done():
+		return r.tctx.Err()
+	}
+}
+
+// closeFile closes the file of the partition in dir and waits for its rows to be written
+func (r *partitionRouter) closeFile(dir string) error {
+	f := r.open[dir]
+	delete(r.open, dir)
+	close(f.ir.rows)
+	<-f.done
+	if f.err != nil {
+		r.w.removePartialFile(f.fileName)
+		return f.err
+	}
+	r.rows += f.rows
+	r.bytes += f.bytes
+	r.compressedBytes += f.compressedBytes
+	r.checksum += f.checksum
+	r.w.catalog.addFile(r.meta.DatabaseName(), r.meta.TableName(), f.fileName+compressFileSuffix(r.w.conf.CompressType))
+	r.w.checksums.addFile(r.meta.DatabaseName(), r.meta.TableName(), r.chunkIdx, f.fileName+compressFileSuffix(r.w.conf.CompressType))
+	return nil
+}
+
+// closeAll closes all the open files, it returns the first error of them
+func (r *partitionRouter) closeAll() error {
+	var firstErr error
+	for dir := range r.open {
+		if err := r.closeFile(dir); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// writePartitionedTableData writes the rows of the chunk into the files of the partitions by Config.PartitionByColumn,
+// it returns the rows, the bytes and the checksum written into all the files
+func (w *Writer) writePartitionedTableData(tctx *tcontext.Context, meta TableMeta, ir TableDataIR, curChkIdx int) (stats tableChunkStats, err error) {
+	conf := w.conf
+	indices, _ := keyColumnIndices(meta, []string{partitionByColumnOf(meta)})
+	colIdx := indices[0]
+	r, err := w.newPartitionRouter(tctx, meta, curChkIdx)
+	if err != nil {
+		return stats, err
+	}
+	defer func() {
+		if closeErr := r.closeAll(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	iter := ir.Rows()
+	row := makeRowReceiver(meta.ColumnTypes(), conf.BinarySafeStrings, conf.BinaryModeHeader, conf.BinaryEncoding)
+	args := make([]interface{}, len(meta.ColumnTypes()))
+	for iter.HasNext() {
+		if err = iter.Decode(row); err != nil {
+			return stats, errors.Trace(err)
+		}
+		values := copyRowValues(row, args)
+		iter.Next()
+		if err = r.route(values, colIdx); err != nil {
+			return stats, err
+		}
+	}
+	if err = iter.Error(); err != nil {
+		return stats, errors.Trace(err)
+	}
+	if err = r.closeAll(); err != nil {
+		return stats, err
+	}
+	tctx.L().Debug("finish dumping table(chunk) into partitions",
+		zap.String("database", meta.DatabaseName()),
+		zap.String("table", meta.TableName()),
+		zap.Int("chunkIdx", curChkIdx),
+		zap.Int("partitions", len(r.fileIndex)),
+		zap.Uint64("total rows", r.rows))
+	return tableChunkStats{rows: r.rows, bytes: r.bytes, compressedBytes: r.compressedBytes, checksum: r.checksum}, nil
+}
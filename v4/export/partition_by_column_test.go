@@ -0,0 +1,84 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestParsePartitionByColumn(c *C) {
+	db, table, column, err := parsePartitionByColumn("test.t:dt")
+	c.Assert(err, IsNil)
+	c.Assert([]string{db, table, column}, DeepEquals, []string{"test", "t", "dt"})
+
+	for _, spec := range []string{"test.t", "test.t:", "t:dt", ".t:dt"} {
+		_, _, _, err = parsePartitionByColumn(spec)
+		c.Assert(err, NotNil, Commentf("spec %s", spec))
+	}
+}
+
+func (s *testWriterSuite) TestWriteTableDataPartitionByColumn(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.PartitionByColumn = "test.t:dt"
+	// the partition opened again is written into a new file
+	conf.PartitionMaxOpenFiles = 2
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	writer := NewWriter(tcontext.Background(), 0, conf, conn, extStore)
+
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "dt"}))
+	colTypes, err := GetColumnTypes(conn, "*", "test", "t")
+	c.Assert(err, IsNil)
+	meta := &tableMeta{database: "test", table: "t", colTypes: colTypes, selectedField: "*"}
+	c.Assert(setPartitionByColumn(conf, meta), IsNil)
+	c.Assert(partitionByColumnOf(meta), Equals, "dt")
+
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "dt"}).
+			AddRow("1", "2021-01-01").
+			AddRow("2", "2021-01-02").
+			AddRow("3", "2021-01-01").
+			AddRow("4", nil).
+			AddRow("5", "2021-01-02"))
+	tableIR := newTableData("SELECT * FROM `test`.`t`", 2, false)
+	c.Assert(writer.writeTableData(meta, tableIR, 0, ""), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	for fileName, expected := range map[string]string{
+		"dt=2021-01-01/test.t.0000000000000.sql":                 "INSERT INTO `t` VALUES\n('1','2021-01-01'),\n('3','2021-01-01');\n",
+		"dt=2021-01-02/test.t.0000000000000.sql":                 "INSERT INTO `t` VALUES\n('2','2021-01-02');\n",
+		"dt=2021-01-02/test.t.0000000000001.sql":                 "INSERT INTO `t` VALUES\n('5','2021-01-02');\n",
+		"dt=__HIVE_DEFAULT_PARTITION__/test.t.0000000000000.sql": "INSERT INTO `t` VALUES\n('4',NULL);\n",
+	} {
+		bytes, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, fileName))
+		c.Assert(err, IsNil, Commentf("file %s", fileName))
+		c.Assert(string(bytes), Equals, expected, Commentf("file %s", fileName))
+	}
+}
+
+func (s *testUtilSuite) TestSetPartitionByColumnNotDumped(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.PartitionByColumn = "test.t:dt"
+	meta := &tableMeta{database: "test", table: "t", colTypes: []*sql.ColumnType{}}
+	c.Assert(setPartitionByColumn(conf, meta), ErrorMatches, "partition column `dt` isn't dumped in table `test`.`t`")
+
+	other := &tableMeta{database: "test", table: "t2"}
+	c.Assert(setPartitionByColumn(conf, other), IsNil)
+	c.Assert(partitionByColumnOf(other), Equals, "")
+}
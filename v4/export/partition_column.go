@@ -0,0 +1,68 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// dumpPartitionsWithColumn dumps every partition of a partitioned table as a chunk, with the partition name
+// appended to each row as the column conf.MaterializePartitionColumn. It returns false if the table isn't partitioned.
+func (d *Dumper) dumpPartitionsWithColumn(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta, taskChan chan<- Task) (bool, error) {
+	db, tbl := meta.DatabaseName(), meta.TableName()
+	partitions, err := GetPartitionNames(conn, db, tbl)
+	if err != nil {
+		return false, err
+	}
+	if len(partitions) == 0 {
+		return false, nil
+	}
+	partitions = recentPartitions(tctx, db, tbl, partitions, d.conf.RecentPartitions)
+	tctx.L().Debug("dumping partition table with partition column",
+		zap.String("database", db), zap.String("table", tbl), zap.Strings("partitions", partitions))
+	for i, partition := range partitions {
+		partitionMeta, err := buildPartitionColumnMeta(conn, meta, partition, d.conf.MaterializePartitionColumn)
+		if err != nil {
+			return true, err
+		}
+		if err = d.dumpWholeTableDirectly(tctx, conn, partitionMeta, taskChan, partition, i, len(partitions)); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// buildPartitionColumnMeta builds the TableMeta which selects the partition name as an extra constant column
+func buildPartitionColumnMeta(conn *sql.Conn, meta TableMeta, partition, column string) (TableMeta, error) {
+	tm, ok := meta.(*tableMeta)
+	if !ok || tm.selectedField == "" {
+		// all the columns are generated, there is nothing to dump
+		return meta, nil
+	}
+	fields := tm.selectedField
+	if fields == "*" {
+		names := tm.ColumnNames()
+		for i, name := range names {
+			names[i] = wrapBackTicks(escapeString(name))
+		}
+		fields = strings.Join(names, ",")
+	}
+	wrappedColumn := wrapBackTicks(escapeString(column))
+	queryField := fmt.Sprintf("%s,'%s' AS %s", fields, escapeSQLString(partition), wrappedColumn)
+	colTypes, err := GetColumnTypes(conn, queryField, tm.database, tm.table)
+	if err != nil {
+		return nil, errors.Annotatef(err, "fail to add partition column to table `%s`.`%s`", tm.database, tm.table)
+	}
+	partitionMeta := *tm
+	partitionMeta.colTypes = colTypes
+	partitionMeta.selectedField = fields + "," + wrappedColumn
+	partitionMeta.queryField = queryField
+	return &partitionMeta, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestDumpPartitionsWithColumn(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.SortByPk = false
+	conf.MaterializePartitionColumn = "_partition"
+	d := &Dumper{tctx: tctx, conf: conf}
+
+	mock.ExpectQuery("SELECT \\* FROM `shop`.`logs` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "msg"}))
+	colTypes, err := GetColumnTypes(conn, "*", "shop", "logs")
+	c.Assert(err, IsNil)
+	meta := &tableMeta{database: "shop", table: "logs", colTypes: colTypes, selectedField: "*"}
+
+	mock.ExpectQuery("SELECT PARTITION_NAME from INFORMATION_SCHEMA.PARTITIONS").WithArgs("shop", "logs").
+		WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}).AddRow("p0").AddRow("p'1"))
+	mock.ExpectQuery("SELECT `id`,`msg`,'p0' AS `_partition` FROM `shop`.`logs` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "msg", "_partition"}))
+	mock.ExpectQuery("SELECT `id`,`msg`,'p\\\\'1' AS `_partition` FROM `shop`.`logs` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "msg", "_partition"}))
+
+	taskChan := make(chan Task, 2)
+	partitioned, err := d.dumpPartitionsWithColumn(tctx, conn, meta, taskChan)
+	c.Assert(err, IsNil)
+	c.Assert(partitioned, IsTrue)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(taskChan, HasLen, 2)
+
+	expectedQueries := []string{
+		"SELECT `id`,`msg`,'p0' AS `_partition` FROM `shop`.`logs` PARTITION(`p0`)",
+		"SELECT `id`,`msg`,'p\\'1' AS `_partition` FROM `shop`.`logs` PARTITION(`p'1`)",
+	}
+	for i, query := range expectedQueries {
+		task := (<-taskChan).(*TaskTableData)
+		c.Assert(task.Data.(*tableData).query, Equals, query)
+		c.Assert(task.Data.(*tableData).colLen, Equals, 3)
+		c.Assert(task.ChunkIndex, Equals, i)
+		c.Assert(task.TotalChunks, Equals, 2)
+		c.Assert(task.Meta.SelectedField(), Equals, "(`id`,`msg`,`_partition`)")
+		c.Assert(task.Meta.ColumnNames(), DeepEquals, []string{"id", "msg", "_partition"})
+	}
+	// the original meta isn't changed
+	c.Assert(meta.SelectedField(), Equals, "*")
+	c.Assert(meta.ColumnNames(), DeepEquals, []string{"id", "msg"})
+
+	// tables which are not partitioned are dumped as usual
+	mock.ExpectQuery("SELECT PARTITION_NAME from INFORMATION_SCHEMA.PARTITIONS").WithArgs("shop", "logs").
+		WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}).AddRow(nil))
+	partitioned, err = d.dumpPartitionsWithColumn(tctx, conn, meta, taskChan)
+	c.Assert(err, IsNil)
+	c.Assert(partitioned, IsFalse)
+	c.Assert(taskChan, HasLen, 0)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
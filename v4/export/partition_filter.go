@@ -0,0 +1,88 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// parsePartitionFilter parses Config.PartitionFilter in the format of `db.table:expr`,
+// the expression may contain `:` itself, e.g. in a time literal
+func parsePartitionFilter(spec string) (db, table, expr string, err error) {
+	tablePart, expr, ok := cutString(spec, ":")
+	expr = strings.TrimSpace(expr)
+	if !ok || expr == "" {
+		return "", "", "", errors.Errorf("partition filter `%s` should be in the format of db.table:expr", spec)
+	}
+	db, table, ok = cutString(strings.TrimSpace(tablePart), ".")
+	if !ok || db == "" || table == "" {
+		return "", "", "", errors.Errorf("partition filter `%s` only accepts a qualified table name", spec)
+	}
+	return db, table, expr, nil
+}
+
+// selectFilteredPartitions returns the partitions of the table in definition order whose rows of
+// information_schema.PARTITIONS match expr. The expression is validated by the server against the columns of
+// information_schema.PARTITIONS, like PARTITION_NAME and PARTITION_DESCRIPTION.
+func selectFilteredPartitions(conn *sql.Conn, db, tbl, expr string) ([]string, error) {
+	partitions := make([]string, 0)
+	var partitionName sql.NullString
+	err := simpleQueryWithArgs(conn, func(rows *sql.Rows) error {
+		if err := rows.Scan(&partitionName); err != nil {
+			return errors.Trace(err)
+		}
+		// a partition has a row for each of its subpartitions
+		if partitionName.Valid && (len(partitions) == 0 || partitions[len(partitions)-1] != partitionName.String) {
+			partitions = append(partitions, partitionName.String)
+		}
+		return nil
+	}, "SELECT PARTITION_NAME FROM INFORMATION_SCHEMA.PARTITIONS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND ("+expr+
+		") ORDER BY PARTITION_ORDINAL_POSITION", db, tbl)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid partition filter `%s` of table `%s`.`%s`", expr, db, tbl)
+	}
+	return partitions, nil
+}
+
+// dumpFilteredPartitions dumps the partitions selected by Config.PartitionFilter of the table, every partition as a chunk.
+// It returns false if the filter isn't for the table.
+func (d *Dumper) dumpFilteredPartitions(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta, taskChan chan<- Task) (bool, error) {
+	db, tbl := meta.DatabaseName(), meta.TableName()
+	filterDB, filterTable, expr, err := parsePartitionFilter(d.conf.PartitionFilter)
+	if err != nil {
+		return false, err
+	}
+	if filterDB != db || filterTable != tbl {
+		return false, nil
+	}
+	partitions, err := selectFilteredPartitions(conn, db, tbl, expr)
+	if err != nil {
+		return true, err
+	}
+	if len(partitions) == 0 {
+		all, err := GetPartitionNames(conn, db, tbl)
+		if err != nil {
+			return true, err
+		}
+		if len(all) == 0 {
+			return true, errors.Errorf("table `%s`.`%s` of the partition filter isn't partitioned", db, tbl)
+		}
+		tctx.L().Info("no partition matches the partition filter, skip dumping data",
+			zap.String("database", db), zap.String("table", tbl), zap.String("filter", expr))
+		return true, nil
+	}
+	tctx.L().Debug("dumping filtered partitions of partition table",
+		zap.String("database", db), zap.String("table", tbl), zap.Strings("partitions", partitions))
+	for i, partition := range partitions {
+		if err = d.dumpWholeTableDirectly(tctx, conn, meta, taskChan, partition, i, len(partitions)); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
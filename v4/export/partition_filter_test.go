@@ -0,0 +1,92 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"errors"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestDumpFilteredPartitions(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.SortByPk = false
+	conf.PartitionFilter = "shop.logs:PARTITION_DESCRIPTION > '2021-01-31 00:00:00'"
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "shop", table: "logs", selectedField: "*"}
+	expectSelectField := func() {
+		mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("shop", "logs").
+			WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "EXTRA"}).AddRow("id", "").AddRow("msg", ""))
+	}
+	filterQuery := "SELECT PARTITION_NAME FROM INFORMATION_SCHEMA.PARTITIONS WHERE TABLE_SCHEMA = \\? AND TABLE_NAME = \\? " +
+		"AND \\(PARTITION_DESCRIPTION > '2021-01-31 00:00:00'\\) ORDER BY PARTITION_ORDINAL_POSITION"
+
+	// the subpartitions of a partition are listed once
+	mock.ExpectQuery(filterQuery).WithArgs("shop", "logs").
+		WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}).AddRow("p202102").AddRow("p202103").AddRow("p202103"))
+	expectSelectField()
+	expectSelectField()
+	taskChan := make(chan Task, 2)
+	filtered, err := d.dumpFilteredPartitions(tctx, conn, meta, taskChan)
+	c.Assert(err, IsNil)
+	c.Assert(filtered, IsTrue)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(taskChan, HasLen, 2)
+	for i, query := range []string{
+		"SELECT * FROM `shop`.`logs` PARTITION(`p202102`)",
+		"SELECT * FROM `shop`.`logs` PARTITION(`p202103`)",
+	} {
+		task := (<-taskChan).(*TaskTableData)
+		c.Assert(task.Data.(*tableData).query, Equals, query)
+		c.Assert(task.ChunkIndex, Equals, i)
+		c.Assert(task.TotalChunks, Equals, 2)
+	}
+
+	// nothing is dumped if no partition matches
+	mock.ExpectQuery(filterQuery).WithArgs("shop", "logs").WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}))
+	mock.ExpectQuery("SELECT PARTITION_NAME from INFORMATION_SCHEMA.PARTITIONS").WithArgs("shop", "logs").
+		WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}).AddRow("p202101"))
+	filtered, err = d.dumpFilteredPartitions(tctx, conn, meta, taskChan)
+	c.Assert(err, IsNil)
+	c.Assert(filtered, IsTrue)
+	c.Assert(taskChan, HasLen, 0)
+
+	// the table of the filter should be partitioned
+	mock.ExpectQuery(filterQuery).WithArgs("shop", "logs").WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}))
+	mock.ExpectQuery("SELECT PARTITION_NAME from INFORMATION_SCHEMA.PARTITIONS").WithArgs("shop", "logs").
+		WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}).AddRow(nil))
+	_, err = d.dumpFilteredPartitions(tctx, conn, meta, taskChan)
+	c.Assert(err, ErrorMatches, "table `shop`.`logs` of the partition filter isn't partitioned")
+
+	// the expression is validated by the server
+	mock.ExpectQuery(filterQuery).WithArgs("shop", "logs").WillReturnError(errors.New("Unknown column 'PARTITION_DESCRIPTION'"))
+	_, err = d.dumpFilteredPartitions(tctx, conn, meta, taskChan)
+	c.Assert(err, ErrorMatches, "invalid partition filter .* of table `shop`.`logs`.*Unknown column.*")
+
+	// the other tables are dumped as usual
+	filtered, err = d.dumpFilteredPartitions(tctx, conn, &tableMeta{database: "shop", table: "users"}, taskChan)
+	c.Assert(err, IsNil)
+	c.Assert(filtered, IsFalse)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testUtilSuite) TestParsePartitionFilter(c *C) {
+	db, table, expr, err := parsePartitionFilter("shop.logs: PARTITION_DESCRIPTION > '2021-01-31 00:00:00'")
+	c.Assert(err, IsNil)
+	c.Assert([]string{db, table, expr}, DeepEquals, []string{"shop", "logs", "PARTITION_DESCRIPTION > '2021-01-31 00:00:00'"})
+
+	for _, spec := range []string{"shop.logs", "shop.logs: ", "logs:PARTITION_NAME = 'p0'"} {
+		_, _, _, err = parsePartitionFilter(spec)
+		c.Assert(err, NotNil, Commentf("spec %s", spec))
+	}
+}
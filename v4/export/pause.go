@@ -0,0 +1,72 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"sync"
+)
+
+// pauseController gates the writers. When paused, writers finish their current
+// task but won't pick up the next one from the task channel until resumed.
+// Writers keep holding their snapshot connections while paused.
+type pauseController struct {
+	mu       sync.Mutex
+	paused   bool
+	resumeCh chan struct{}
+}
+
+func newPauseController() *pauseController {
+	return &pauseController{}
+}
+
+// Pause stops writers from picking up new tasks. It returns false if the dump is already paused.
+func (p *pauseController) Pause() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused {
+		return false
+	}
+	p.paused = true
+	p.resumeCh = make(chan struct{})
+	return true
+}
+
+// Resume wakes up all the paused writers. It returns false if the dump isn't paused.
+func (p *pauseController) Resume() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		return false
+	}
+	p.paused = false
+	close(p.resumeCh)
+	return true
+}
+
+// IsPaused returns whether the dump is paused now.
+func (p *pauseController) IsPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+// waitIfPaused blocks until the dump is resumed or ctx is done.
+func (p *pauseController) waitIfPaused(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	if !p.paused {
+		p.mu.Unlock()
+		return nil
+	}
+	resumeCh := p.resumeCh
+	p.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resumeCh:
+		return nil
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// pkIndexFileSuffix is the suffix of the primary key index of a table written with Config.EmitPKIndex
+	pkIndexFileSuffix = ".pkidx"
+	// pkIndexMagic starts the primary key index files, it's followed by the version
+	pkIndexMagic   = "DPKIDX"
+	pkIndexVersion = 1
+)
+
+// the encodings of the primary key columns in the index files
+const (
+	// pkIndexSignedInt is an 8 bytes big-endian integer whose sign bit is flipped, so the bytes sort as the numbers
+	pkIndexSignedInt byte = 1
+	// pkIndexUnsignedInt is an 8 bytes big-endian unsigned integer
+	pkIndexUnsignedInt byte = 2
+	// pkIndexBytes is the uvarint length followed by the bytes of the value
+	pkIndexBytes byte = 3
+)
+
+var pkIndexIntTypes = map[string]struct{}{
+	"TINYINT": {}, "SMALLINT": {}, "MEDIUMINT": {}, "INT": {}, "INTEGER": {}, "BIGINT": {},
+}
+
+// setPKIndexKey sets the primary key columns of meta to write into its index with Config.EmitPKIndex
+func setPKIndexKey(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta) error {
+	tm, ok := meta.(*tableMeta)
+	if !ok {
+		return nil
+	}
+	cols, err := GetPrimaryKeyColumns(conn, tm.database, tm.table)
+	if err != nil {
+		return err
+	}
+	if len(cols) == 0 {
+		tctx.L().Warn("table has no primary key, its primary key index isn't written",
+			zap.String("database", tm.database), zap.String("table", tm.table))
+		return nil
+	}
+	tm.pkIndexColumns = cols
+	return nil
+}
+
+func pkIndexColumnsOf(meta TableMeta) []string {
+	if tm, ok := meta.(*tableMeta); ok {
+		return tm.pkIndexColumns
+	}
+	return nil
+}
+
+// pkIndexEncodings returns the encodings of the columns of meta at keyIndices by their types
+func pkIndexEncodings(meta TableMeta, keyIndices []int) []byte {
+	colTypes := meta.ColumnTypes()
+	encodings := make([]byte, len(keyIndices))
+	for i, idx := range keyIndices {
+		encodings[i] = pkIndexBytes
+		if idx >= len(colTypes) {
+			continue
+		}
+		tp := colTypes[idx]
+		if _, ok := pkIndexIntTypes[strings.TrimPrefix(tp, "UNSIGNED ")]; ok {
+			encodings[i] = pkIndexSignedInt
+			if strings.HasPrefix(tp, "UNSIGNED ") {
+				encodings[i] = pkIndexUnsignedInt
+			}
+		}
+	}
+	return encodings
+}
+
+// appendPKIndexValue appends the encoded value of a primary key column to buf
+func appendPKIndexValue(buf []byte, encoding byte, value []byte) ([]byte, error) {
+	var fixed [8]byte
+	switch encoding {
+	case pkIndexSignedInt:
+		v, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return buf, errors.Trace(err)
+		}
+		binary.BigEndian.PutUint64(fixed[:], uint64(v)^(1<<63))
+		return append(buf, fixed[:]...), nil
+	case pkIndexUnsignedInt:
+		v, err := strconv.ParseUint(string(value), 10, 64)
+		if err != nil {
+			return buf, errors.Trace(err)
+		}
+		binary.BigEndian.PutUint64(fixed[:], v)
+		return append(buf, fixed[:]...), nil
+	default:
+		var length [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(length[:], uint64(len(value)))
+		buf = append(buf, length[:n]...)
+		return append(buf, value...), nil
+	}
+}
+
+// pkIndexIR encodes the primary keys of the rows when they are decoded
+type pkIndexIR struct {
+	TableDataIR
+	database   string
+	table      string
+	keyIndices []int
+	encodings  []byte
+
+	entries []byte
+	// offsets are where the primary keys of the rows start in entries
+	offsets []int
+}
+
+// Rows implements TableDataIR.Rows
+func (p *pkIndexIR) Rows() SQLRowIter {
+	return &pkIndexRowIter{SQLRowIter: p.TableDataIR.Rows(), ir: p}
+}
+
+type pkIndexRowIter struct {
+	SQLRowIter
+	ir *pkIndexIR
+}
+
+// Decode implements SQLRowIter.Decode
+func (it *pkIndexRowIter) Decode(row RowReceiver) error {
+	if err := it.SQLRowIter.Decode(row); err != nil {
+		return err
+	}
+	ir := it.ir
+	arr, ok := row.(RowReceiverArr)
+	if !ok {
+		return nil
+	}
+	start := len(ir.entries)
+	for i, idx := range ir.keyIndices {
+		if idx >= len(arr.receivers) {
+			ir.entries = ir.entries[:start]
+			return nil
+		}
+		var err error
+		if ir.entries, err = appendPKIndexValue(ir.entries, ir.encodings[i], receiverRawBytes(arr.receivers[idx])); err != nil {
+			return errors.Annotatef(err, "fail to encode the primary key of table `%s`.`%s` into its index",
+				ir.database, ir.table)
+		}
+	}
+	ir.offsets = append(ir.offsets, start)
+	return nil
+}
+
+// keys splits the entries into the primary keys of the rows
+func (p *pkIndexIR) keys() [][]byte {
+	keys := make([][]byte, len(p.offsets))
+	for i, start := range p.offsets {
+		end := len(p.entries)
+		if i+1 < len(p.offsets) {
+			end = p.offsets[i+1]
+		}
+		keys[i] = p.entries[start:end]
+	}
+	return keys
+}
+
+type pkIndexTable struct {
+	database  string
+	table     string
+	encodings []byte
+	keys      [][]byte
+}
+
+// pkIndexRecorder collects the encoded primary keys of the chunks from all writers
+type pkIndexRecorder struct {
+	mu     sync.Mutex
+	tables map[[2]string]*pkIndexTable
+}
+
+func newPKIndexRecorder() *pkIndexRecorder {
+	return &pkIndexRecorder{tables: make(map[[2]string]*pkIndexTable)}
+}
+
+// indexer wraps ir to encode the primary keys of its rows, it returns nil if meta has no primary key dumped
+func (r *pkIndexRecorder) indexer(tctx *tcontext.Context, meta TableMeta, ir TableDataIR) *pkIndexIR {
+	keyColumns := pkIndexColumnsOf(meta)
+	if r == nil || len(keyColumns) == 0 {
+		return nil
+	}
+	keyIndices, missing := keyColumnIndices(meta, keyColumns)
+	if missing != "" {
+		tctx.L().Warn("primary key isn't dumped, its primary key index isn't written",
+			zap.String("database", meta.DatabaseName()), zap.String("table", meta.TableName()),
+			zap.String("column", missing))
+		return nil
+	}
+	return &pkIndexIR{TableDataIR: ir, database: meta.DatabaseName(), table: meta.TableName(),
+		keyIndices: keyIndices, encodings: pkIndexEncodings(meta, keyIndices)}
+}
+
+// add records the encoded primary keys of a chunk of meta
+func (r *pkIndexRecorder) add(meta TableMeta, ir *pkIndexIR) {
+	if r == nil || ir == nil {
+		return
+	}
+	key := [2]string{meta.DatabaseName(), meta.TableName()}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tables[key]
+	if !ok {
+		t = &pkIndexTable{database: key[0], table: key[1], encodings: ir.encodings}
+		r.tables[key] = t
+	}
+	t.keys = append(t.keys, ir.keys()...)
+}
+
+// write writes the primary key index of each table into <db>.<table>.pkidx. The file starts with pkIndexMagic, the
+// version, the number of the primary key columns and their encodings, followed by the encoded primary keys of the
+// rows sorted bytewise. The order doesn't depend on how the table is split or the collations of the server, so the
+// indexes of two dumps can be diffed by merging them.
+func (r *pkIndexRecorder) write(tctx *tcontext.Context, extStore storage.ExternalStorage, conf *Config) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tables {
+		sort.Slice(t.keys, func(i, j int) bool {
+			return bytes.Compare(t.keys[i], t.keys[j]) < 0
+		})
+		var buf bytes.Buffer
+		buf.WriteString(pkIndexMagic)
+		buf.WriteByte(pkIndexVersion)
+		buf.WriteByte(byte(len(t.encodings)))
+		buf.Write(t.encodings)
+		for _, key := range t.keys {
+			buf.Write(key)
+		}
+		namer := &outputFileNamer{DB: outputIdentifier(conf, t.database), Table: outputIdentifier(conf, t.table)}
+		name, err := namer.render(DefaultOutputFileTemplate, "objectName")
+		if err != nil {
+			return err
+		}
+		if err = extStore.WriteFile(tctx, name+pkIndexFileSuffix, buf.Bytes()); err != nil {
+			return errors.Annotatef(err, "fail to write the primary key index of table `%s`.`%s`", t.database, t.table)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"io/ioutil"
+	"path/filepath"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestAppendPKIndexValue(c *C) {
+	testCases := []struct {
+		encoding byte
+		value    string
+		expected []byte
+	}{
+		{pkIndexSignedInt, "-1", []byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{pkIndexSignedInt, "1", []byte{0x80, 0, 0, 0, 0, 0, 0, 1}},
+		{pkIndexUnsignedInt, "18446744073709551615", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{pkIndexBytes, "ab", []byte{2, 'a', 'b'}},
+		{pkIndexBytes, "", []byte{0}},
+	}
+	for _, t := range testCases {
+		buf, err := appendPKIndexValue(nil, t.encoding, []byte(t.value))
+		c.Assert(err, IsNil)
+		c.Assert(buf, DeepEquals, t.expected, Commentf("value %s", t.value))
+	}
+	_, err := appendPKIndexValue(nil, pkIndexSignedInt, []byte("abc"))
+	c.Assert(err, NotNil)
+}
+
+func (s *testUtilSuite) TestWritePKIndex(c *C) {
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	recorder := newPKIndexRecorder()
+	colTypes := []string{"INT", "VARCHAR", "TEXT"}
+
+	// the chunks are recorded in any order by the writers
+	for _, data := range [][][]driver.Value{
+		{{"2", "b", "x"}, {"10", "a", "y"}},
+		{{"-5", "c", "z"}, {"2", "a", "w"}},
+	} {
+		meta := newMockTableIR("test", "t", data, nil, colTypes)
+		meta.colNames = []string{"id", "code", "note"}
+		ir := &pkIndexIR{TableDataIR: meta, database: "test", table: "t", keyIndices: []int{0, 1}}
+		ir.encodings = pkIndexEncodings(meta, ir.keyIndices)
+		c.Assert(ir.encodings, DeepEquals, []byte{pkIndexSignedInt, pkIndexBytes})
+		row := MakeRowReceiver(colTypes)
+		for it := ir.Rows(); it.HasNext(); it.Next() {
+			c.Assert(it.Decode(row), IsNil)
+		}
+		recorder.add(meta, ir)
+	}
+
+	dir := c.MkDir()
+	extStore, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.write(tctx, extStore, conf), IsNil)
+	content, err := ioutil.ReadFile(filepath.Join(dir, "test.t"+pkIndexFileSuffix))
+	c.Assert(err, IsNil)
+
+	expected := append([]byte(pkIndexMagic), pkIndexVersion, 2, pkIndexSignedInt, pkIndexBytes)
+	for _, key := range []struct{ id, code string }{{"-5", "c"}, {"2", "a"}, {"2", "b"}, {"10", "a"}} {
+		expected, err = appendPKIndexValue(expected, pkIndexSignedInt, []byte(key.id))
+		c.Assert(err, IsNil)
+		expected, err = appendPKIndexValue(expected, pkIndexBytes, []byte(key.code))
+		c.Assert(err, IsNil)
+	}
+	c.Assert(content, DeepEquals, expected)
+}
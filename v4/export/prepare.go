@@ -9,6 +9,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/pingcap/errors"
 )
 
@@ -61,15 +62,18 @@ var (
 	DefaultOutputFileTemplate = template.Must(template.New("data").
 					Option("missingkey=error").
 					Funcs(template.FuncMap{
-			"fn": func(input string) string {
-				return filenameEscapeRegexp.ReplaceAllStringFunc(input, func(match string) string {
-					return fmt.Sprintf("%%%02X%s", match[0], match[1:])
-				})
-			},
+			"fn": escapeFileName,
 		}).
 		Parse(defaultOutputFileTemplateBase))
 )
 
+// escapeFileName escapes the characters which are unsafe in file names
+func escapeFileName(input string) string {
+	return filenameEscapeRegexp.ReplaceAllStringFunc(input, func(match string) string {
+		return fmt.Sprintf("%%%02X%s", match[0], match[1:])
+	})
+}
+
 // ParseOutputFileTemplate parses template from the specified text
 func ParseOutputFileTemplate(text string) (*template.Template, error) {
 	return template.Must(DefaultOutputFileTemplate.Clone()).Parse(text)
@@ -96,6 +100,32 @@ func prepareDumpingDatabases(conf *Config, db *sql.Conn) ([]string, error) {
 	return conf.Databases, nil
 }
 
+// ParseStaticTableList parses the qualified table names in the static table list. All of them are treated as base tables.
+func ParseStaticTableList(tablesList []string) (DatabaseTables, error) {
+	tables := NewDatabaseTables()
+	seen := make(map[string]map[string]struct{})
+	for _, table := range tablesList {
+		db, tbl, ok := cutString(strings.TrimSpace(table), ".")
+		if !ok || db == "" || tbl == "" {
+			return nil, errors.Errorf("static table list only accepts qualified table names, but got `%s`", table)
+		}
+		if _, ok := seen[db][tbl]; ok {
+			continue
+		}
+		if _, ok := seen[db]; !ok {
+			seen[db] = make(map[string]struct{})
+		}
+		seen[db][tbl] = struct{}{}
+		tables.AppendTables(db, tbl)
+	}
+	return tables, nil
+}
+
+func isNoSuchTableErr(err error) bool {
+	mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok && mysqlErr.Number == ErrNoSuchTable
+}
+
 func listAllTables(db *sql.Conn, databaseNames []string) (DatabaseTables, error) {
 	return ListAllDatabasesTables(db, databaseNames, TableTypeBase)
 }
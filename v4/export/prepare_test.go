@@ -6,7 +6,10 @@ import (
 	"context"
 	"fmt"
 
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
 	. "github.com/pingcap/check"
 )
 
@@ -112,6 +115,38 @@ func (s *testPrepareSuite) TestListAllTables(c *C) {
 	c.Assert(mock.ExpectationsWereMet(), IsNil)
 }
 
+func (s *testPrepareSuite) TestStaticTableList(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+
+	// no discovery query is sent
+	conf := DefaultConfig()
+	conf.StaticTableList = []string{"db1.t1", " db2.t.2", "db1.t3", "db1.t1"}
+	c.Assert(prepareTableListToDump(tctx, conf, conn), IsNil)
+	c.Assert(conf.Tables, DeepEquals, NewDatabaseTables().
+		AppendTables("db1", "t1", "t3").
+		AppendTables("db2", "t.2"))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	for _, table := range []string{"t1", ".t1", "db1."} {
+		_, err = ParseStaticTableList([]string{table})
+		c.Assert(err, ErrorMatches, "static table list only accepts qualified table names.*")
+	}
+
+	// the table is checked when its meta is fetched
+	mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("db1", "t3").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}))
+	mock.ExpectQuery("SELECT \\* FROM `db1`.`t3` LIMIT 1").
+		WillReturnError(&mysql.MySQLError{Number: ErrNoSuchTable, Message: "Table 'db1.t3' doesn't exist"})
+	_, err = dumpTableMeta(tcontext.Background(), conf, conn, "db1", &TableInfo{Name: "t3", Type: TableTypeBase})
+	c.Assert(err, ErrorMatches, "table `db1`.`t3` in the static table list doesn't exist")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
 func (s *testPrepareSuite) TestConfigValidation(c *C) {
 	conf := defaultConfigForTest(c)
 	conf.Where = "id < 5"
@@ -133,6 +168,8 @@ func (s *testPrepareSuite) TestConfigValidation(c *C) {
 	conf.FileType = ""
 	c.Assert(adjustFileFormat(conf), IsNil)
 	c.Assert(conf.FileType, Equals, FileFormatSQLTextString)
+	conf.FileType = FileFormatChangeFeedString
+	c.Assert(adjustFileFormat(conf), IsNil)
 
 	conf.FileType = "rand_str"
 	c.Assert(adjustFileFormat(conf), ErrorMatches, "unknown config.FileType 'rand_str'")
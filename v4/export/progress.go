@@ -0,0 +1,272 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/br/pkg/storage"
+)
+
+// DumpProgress is the progress of a running dump, which is passed to Config.OnProgress every Config.ProgressInterval
+type DumpProgress struct {
+	FinishedTables int
+	TotalTables    int
+	// FinishedChunks and TotalChunks count the chunks of the table data, TotalChunks grows while the tables
+	// are being split into chunks
+	FinishedChunks int
+	TotalChunks    int
+	FinishedRows   uint64
+	// EstimateTotalRows is 0 if the rows aren't estimated
+	EstimateTotalRows uint64
+	// FinishedBytes is the size of the data written before compression
+	FinishedBytes uint64
+	// RowsPerSecond and BytesPerSecond are the throughput since the last progress
+	RowsPerSecond  float64
+	BytesPerSecond float64
+	// Chunks are the table chunks being written, sorted by database, table and chunk index
+	Chunks []ChunkProgress
+}
+
+// ChunkProgress is the progress of a table chunk being written
+type ChunkProgress struct {
+	Database   string
+	Table      string
+	ChunkIndex int
+	// Bytes is the size of the data written into the files of the chunk so far
+	Bytes   uint64
+	Started time.Time
+}
+
+// chunkProgress is a table chunk being written, its bytes are updated by the writer
+type chunkProgress struct {
+	database, table string
+	chunkIndex      int
+	started         time.Time
+	bytes           uint64
+}
+
+// tableProgress counts the chunks of a table, the counters are updated atomically
+type tableProgress struct {
+	database, table string
+	// totalChunks is the larger of the chunks sent and the total chunks of the split of the table
+	totalChunks    int64
+	sentChunks     int64
+	finishedChunks int64
+	// estimateRows is -1 if the rows of the table aren't estimated
+	estimateRows int64
+}
+
+// progressTracker tracks the table chunks being written for Config.OnProgress and the /status API.
+// A nil progressTracker tracks nothing, so the writers don't pay for it without them.
+type progressTracker struct {
+	totalChunks    int64
+	finishedChunks int64
+	// firstChunkSent is the unix nanoseconds when the first chunk is sent, which the throughput is measured from
+	firstChunkSent int64
+
+	mu     sync.Mutex
+	chunks map[*chunkProgress]struct{}
+
+	// tables are only locked for writing when a table is seen the first time
+	tablesMu sync.RWMutex
+	tables   map[[2]string]*tableProgress
+}
+
+func newProgressTracker(conf *Config) *progressTracker {
+	if conf.OnProgress == nil && conf.StatusAddr == "" {
+		return nil
+	}
+	initMetricsVectorIfNeeded(conf.Labels)
+	return &progressTracker{chunks: make(map[*chunkProgress]struct{}), tables: make(map[[2]string]*tableProgress)}
+}
+
+// table returns the progress of a table, which is added if it isn't tracked yet
+func (t *progressTracker) table(db, table string) *tableProgress {
+	key := [2]string{db, table}
+	t.tablesMu.RLock()
+	p, ok := t.tables[key]
+	t.tablesMu.RUnlock()
+	if ok {
+		return p
+	}
+	t.tablesMu.Lock()
+	defer t.tablesMu.Unlock()
+	if p, ok = t.tables[key]; !ok {
+		p = &tableProgress{database: db, table: table, estimateRows: -1}
+		t.tables[key] = p
+	}
+	return p
+}
+
+// setEstimateRows records the estimated rows of a table
+func (t *progressTracker) setEstimateRows(db, table string, rows uint64) {
+	if t == nil {
+		return
+	}
+	atomic.StoreInt64(&t.table(db, table).estimateRows, int64(rows))
+}
+
+// start records that a writer starts writing a table chunk, the chunk is tracked until finish is called
+func (t *progressTracker) start(meta TableMeta, chunkIndex int) *chunkProgress {
+	if t == nil {
+		return nil
+	}
+	p := &chunkProgress{database: meta.DatabaseName(), table: meta.TableName(), chunkIndex: chunkIndex, started: time.Now()}
+	t.mu.Lock()
+	t.chunks[p] = struct{}{}
+	t.mu.Unlock()
+	return p
+}
+
+func (t *progressTracker) finish(p *chunkProgress) {
+	if t == nil || p == nil {
+		return
+	}
+	t.mu.Lock()
+	delete(t.chunks, p)
+	t.mu.Unlock()
+}
+
+// planChunk counts a chunk sent to the writers
+func (t *progressTracker) planChunk(td *TaskTableData) {
+	if t == nil {
+		return
+	}
+	atomic.AddInt64(&t.totalChunks, 1)
+	atomic.CompareAndSwapInt64(&t.firstChunkSent, 0, time.Now().UnixNano())
+	p := t.table(td.Meta.DatabaseName(), td.Meta.TableName())
+	sent := atomic.AddInt64(&p.sentChunks, 1)
+	if int64(td.TotalChunks) > sent {
+		sent = int64(td.TotalChunks)
+	}
+	for {
+		total := atomic.LoadInt64(&p.totalChunks)
+		if sent <= total || atomic.CompareAndSwapInt64(&p.totalChunks, total, sent) {
+			return
+		}
+	}
+}
+
+// finishChunk counts a chunk finished by the writers, whether it's written or not
+func (t *progressTracker) finishChunk(td *TaskTableData) {
+	if t == nil {
+		return
+	}
+	atomic.AddInt64(&t.finishedChunks, 1)
+	atomic.AddInt64(&t.table(td.Meta.DatabaseName(), td.Meta.TableName()).finishedChunks, 1)
+}
+
+// throughputSince returns when the first chunk is sent, or false if no chunk is sent yet
+func (t *progressTracker) throughputSince() (time.Time, bool) {
+	if t == nil {
+		return time.Time{}, false
+	}
+	sent := atomic.LoadInt64(&t.firstChunkSent)
+	if sent == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, sent), true
+}
+
+// chunkCounts returns the finished and total chunks
+func (t *progressTracker) chunkCounts() (finished, total int) {
+	if t == nil {
+		return 0, 0
+	}
+	return int(atomic.LoadInt64(&t.finishedChunks)), int(atomic.LoadInt64(&t.totalChunks))
+}
+
+// snapshot returns the progress of the chunks being written
+func (t *progressTracker) snapshot() []ChunkProgress {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	chunks := make([]ChunkProgress, 0, len(t.chunks))
+	for p := range t.chunks {
+		chunks = append(chunks, ChunkProgress{
+			Database:   p.database,
+			Table:      p.table,
+			ChunkIndex: p.chunkIndex,
+			Bytes:      atomic.LoadUint64(&p.bytes),
+			Started:    p.started,
+		})
+	}
+	t.mu.Unlock()
+	sort.Slice(chunks, func(i, j int) bool {
+		if chunks[i].Database != chunks[j].Database {
+			return chunks[i].Database < chunks[j].Database
+		}
+		if chunks[i].Table != chunks[j].Table {
+			return chunks[i].Table < chunks[j].Table
+		}
+		return chunks[i].ChunkIndex < chunks[j].ChunkIndex
+	})
+	return chunks
+}
+
+// tableStatuses returns the chunks of each table for the /status API, sorted by database and table. The chunks being
+// written are listed by their indexes.
+func (t *progressTracker) tableStatuses() []tableStatus {
+	if t == nil {
+		return nil
+	}
+	inFlight := make(map[[2]string][]int)
+	for _, chunk := range t.snapshot() {
+		key := [2]string{chunk.Database, chunk.Table}
+		inFlight[key] = append(inFlight[key], chunk.ChunkIndex)
+	}
+	t.tablesMu.RLock()
+	statuses := make([]tableStatus, 0, len(t.tables))
+	for key, p := range t.tables {
+		status := tableStatus{
+			Database:       p.database,
+			Table:          p.table,
+			TotalChunks:    int(atomic.LoadInt64(&p.totalChunks)),
+			FinishedChunks: int(atomic.LoadInt64(&p.finishedChunks)),
+			InFlightChunks: inFlight[key],
+		}
+		if status.InFlightChunks == nil {
+			status.InFlightChunks = []int{}
+		}
+		if rows := atomic.LoadInt64(&p.estimateRows); rows >= 0 {
+			estimateRows := uint64(rows)
+			status.EstimateRows = &estimateRows
+		}
+		statuses = append(statuses, status)
+	}
+	t.tablesMu.RUnlock()
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Database != statuses[j].Database {
+			return statuses[i].Database < statuses[j].Database
+		}
+		return statuses[i].Table < statuses[j].Table
+	})
+	return statuses
+}
+
+// progressFileWriter adds the bytes written into a file to the progress of its chunk
+type progressFileWriter struct {
+	storage.ExternalFileWriter
+	p *chunkProgress
+}
+
+// withChunkProgress wraps w to count its bytes into p, w is returned as is if p is nil
+func withChunkProgress(w storage.ExternalFileWriter, p *chunkProgress) storage.ExternalFileWriter {
+	if p == nil {
+		return w
+	}
+	return &progressFileWriter{ExternalFileWriter: w, p: p}
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *progressFileWriter) Write(ctx context.Context, p []byte) (int, error) {
+	n, err := w.ExternalFileWriter.Write(ctx, p)
+	atomic.AddUint64(&w.p.bytes, uint64(n))
+	return n, err
+}
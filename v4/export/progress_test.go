@@ -0,0 +1,305 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+	"golang.org/x/sync/errgroup"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+func (s *testWriterSuite) TestProgressTracker(c *C) {
+	var nilTracker *progressTracker
+	conf := DefaultConfig()
+	conf.StatusAddr = ""
+	c.Assert(newProgressTracker(conf), IsNil)
+	// the chunks are tracked for the /status API
+	c.Assert(newProgressTracker(DefaultConfig()), NotNil)
+	c.Assert(nilTracker.start(&tableMeta{database: "test", table: "t"}, 0), IsNil)
+	nilTracker.finish(nil)
+	c.Assert(nilTracker.snapshot(), IsNil)
+
+	conf.OnProgress = func(DumpProgress) {}
+	tracker := newProgressTracker(conf)
+	p1 := tracker.start(&tableMeta{database: "test", table: "t2"}, 0)
+	p2 := tracker.start(&tableMeta{database: "test", table: "t1"}, 1)
+	p3 := tracker.start(&tableMeta{database: "test", table: "t1"}, 0)
+
+	extStore, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	fileWriter, err := extStore.Create(context.Background(), "test.t1.0.sql")
+	c.Assert(err, IsNil)
+	w := withChunkProgress(fileWriter, p3)
+	_, err = w.Write(context.Background(), []byte("hello"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(context.Background()), IsNil)
+	c.Assert(withChunkProgress(fileWriter, nil), Equals, fileWriter)
+
+	chunks := tracker.snapshot()
+	c.Assert(chunks, HasLen, 3)
+	c.Assert(chunks[0].Table, Equals, "t1")
+	c.Assert(chunks[0].ChunkIndex, Equals, 0)
+	c.Assert(chunks[0].Bytes, Equals, uint64(5))
+	c.Assert(chunks[1].Table, Equals, "t1")
+	c.Assert(chunks[1].ChunkIndex, Equals, 1)
+	c.Assert(chunks[2].Table, Equals, "t2")
+
+	tracker.finish(p1)
+	tracker.finish(p2)
+	tracker.finish(p3)
+	c.Assert(tracker.snapshot(), HasLen, 0)
+}
+
+func (s *testWriterSuite) TestWriteTableDataWithProgress(c *C) {
+	data := [][]driver.Value{{"1", "a"}, {"2", "b"}}
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = c.MkDir()
+	config.OnProgress = func(DumpProgress) {}
+	writer := s.newWriter(config, c)
+	writer.progress = newProgressTracker(config)
+	tableIR := newMockTableIR("test", "t", data, nil, []string{"INT", "VARCHAR"})
+	c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+	// the chunk is no longer tracked after it's written
+	c.Assert(writer.progress.snapshot(), HasLen, 0)
+	c.Assert(writer.chunkProgress, IsNil)
+}
+
+func (s *testWriterSuite) TestRunLogProgressWithCallback(c *C) {
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conf := DefaultConfig()
+	conf.Tables = NewDatabaseTables().AppendTables("test", "t1", "t2")
+	conf.ProgressInterval = 10 * time.Millisecond
+	progresses := make(chan DumpProgress, 1)
+	conf.OnProgress = func(progress DumpProgress) {
+		select {
+		case progresses <- progress:
+		default:
+		}
+	}
+	d := &Dumper{tctx: tctx, conf: conf, progress: newProgressTracker(conf)}
+	p := d.progress.start(&tableMeta{database: "test", table: "t1"}, 0)
+	defer d.progress.finish(p)
+	go d.runLogProgress(tctx)
+
+	select {
+	case progress := <-progresses:
+		c.Assert(progress.TotalTables, Equals, 2)
+		c.Assert(progress.Chunks, HasLen, 1)
+		c.Assert(progress.Chunks[0].Database, Equals, "test")
+		c.Assert(progress.Chunks[0].Table, Equals, "t1")
+	case <-time.After(5 * time.Second):
+		c.Fatal("OnProgress isn't called")
+	}
+}
+
+func (s *testWriterSuite) TestProgressOfMultiTableDump(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+
+	tables := []string{"t1", "t2", "t3"}
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.Threads = 2
+	conf.Tables = NewDatabaseTables().AppendTables("test", tables...)
+	conf.ProgressInterval = 5 * time.Millisecond
+	var (
+		mu         sync.Mutex
+		progresses []DumpProgress
+	)
+	conf.OnProgress = func(progress DumpProgress) {
+		mu.Lock()
+		progresses = append(progresses, progress)
+		mu.Unlock()
+	}
+	extStore, err := conf.createExternalStorage(tctx)
+	c.Assert(err, IsNil)
+	d := &Dumper{
+		tctx:     tctx,
+		conf:     conf,
+		dbHandle: db,
+		extStore: extStore,
+		progress: newProgressTracker(conf),
+		// the dump is slowed down to report the progress several times
+		rowsLimiter: newRateLimiter(200, nil, nil),
+	}
+	// the metrics are shared by the tests
+	baseline := d.readProgress(len(tables))
+
+	logProgressCtx, logProgressCancel := tctx.WithCancel()
+	logProgressDone := make(chan struct{})
+	go func() {
+		d.runLogProgress(logProgressCtx)
+		close(logProgressDone)
+	}()
+	for i := 0; i < conf.Threads; i++ {
+		mock.ExpectExec("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("START TRANSACTION").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	wg, writingCtx := errgroup.WithContext(tctx)
+	taskChan := make(chan Task, 1)
+	_, tearDownWriters, err := d.startWriters(tctx.WithContext(writingCtx), wg, taskChan, nil, nil)
+	c.Assert(err, IsNil)
+	data := make([][]driver.Value, 0, 10)
+	for i := 0; i < 10; i++ {
+		data = append(data, []driver.Value{fmt.Sprint(i)})
+	}
+	for _, table := range tables {
+		for chunk := 0; chunk < 2; chunk++ {
+			tableIR := newMockTableIR("test", table, data, nil, []string{"INT"})
+			c.Assert(d.sendTaskToChan(tctx, NewTaskTableData(tableIR, tableIR, chunk, 2), taskChan), IsFalse)
+		}
+	}
+	close(taskChan)
+	c.Assert(wg.Wait(), IsNil)
+	tearDownWriters()
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	logProgressCancel()
+	<-logProgressDone
+
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(len(progresses), Greater, 2)
+	for i := 1; i < len(progresses); i++ {
+		prev, cur := progresses[i-1], progresses[i]
+		c.Assert(cur.FinishedTables, GreaterEqual, prev.FinishedTables)
+		c.Assert(cur.FinishedChunks, GreaterEqual, prev.FinishedChunks)
+		c.Assert(cur.TotalChunks, GreaterEqual, prev.TotalChunks)
+		c.Assert(cur.FinishedRows, GreaterEqual, prev.FinishedRows)
+		c.Assert(cur.FinishedBytes, GreaterEqual, prev.FinishedBytes)
+		c.Assert(cur.FinishedChunks, LessEqual, cur.TotalChunks)
+	}
+	// the last progress is reported after all the chunks are written
+	last := progresses[len(progresses)-1]
+	c.Assert(last.TotalTables, Equals, len(tables))
+	c.Assert(last.FinishedTables-baseline.FinishedTables, Equals, len(tables))
+	c.Assert(last.FinishedChunks, Equals, 2*len(tables))
+	c.Assert(last.TotalChunks, Equals, 2*len(tables))
+	c.Assert(last.FinishedRows-baseline.FinishedRows, Equals, uint64(2*len(tables)*len(data)))
+	c.Assert(last.FinishedBytes, Greater, baseline.FinishedBytes)
+	c.Assert(last.Chunks, HasLen, 0)
+}
+
+func (s *testWriterSuite) TestStatusOfMultiTableDump(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+
+	tables := []string{"t1", "t2", "t3"}
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.Threads = 2
+	conf.Tables = NewDatabaseTables().AppendTables("test", tables...)
+	extStore, err := conf.createExternalStorage(tctx)
+	c.Assert(err, IsNil)
+	d := &Dumper{
+		tctx:     tctx,
+		conf:     conf,
+		dbHandle: db,
+		extStore: extStore,
+		pauseCtl: newPauseController(),
+		progress: newProgressTracker(conf),
+		// the dump is slowed down to see the chunks being written
+		rowsLimiter: newRateLimiter(200, nil, nil),
+	}
+	for _, table := range tables {
+		d.progress.setEstimateRows("test", table, 20)
+	}
+	readStatus := func() dumpStatus {
+		recorder := httptest.NewRecorder()
+		d.handleStatus(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+		c.Assert(recorder.Code, Equals, http.StatusOK)
+		var status dumpStatus
+		c.Assert(json.Unmarshal(recorder.Body.Bytes(), &status), IsNil)
+		return status
+	}
+	status := readStatus()
+	c.Assert(status.ETASeconds, IsNil)
+	c.Assert(status.Tables, HasLen, len(tables))
+	c.Assert(status.Tables[0].TotalChunks, Equals, 0)
+	c.Assert(*status.Tables[0].EstimateRows, Equals, uint64(20))
+
+	for i := 0; i < conf.Threads; i++ {
+		mock.ExpectExec("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("START TRANSACTION").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	wg, writingCtx := errgroup.WithContext(tctx)
+	taskChan := make(chan Task, 1)
+	_, tearDownWriters, err := d.startWriters(tctx.WithContext(writingCtx), wg, taskChan, nil, nil)
+	c.Assert(err, IsNil)
+
+	// the status is polled while the chunks are written
+	var statuses []dumpStatus
+	pollDone, pollStopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(pollStopped)
+		for {
+			select {
+			case <-pollDone:
+				return
+			case <-time.After(5 * time.Millisecond):
+				statuses = append(statuses, readStatus())
+			}
+		}
+	}()
+	data := make([][]driver.Value, 0, 10)
+	for i := 0; i < 10; i++ {
+		data = append(data, []driver.Value{fmt.Sprint(i)})
+	}
+	for _, table := range tables {
+		for chunk := 0; chunk < 2; chunk++ {
+			tableIR := newMockTableIR("test", table, data, nil, []string{"INT"})
+			c.Assert(d.sendTaskToChan(tctx, NewTaskTableData(tableIR, tableIR, chunk, 2), taskChan), IsFalse)
+		}
+	}
+	close(taskChan)
+	c.Assert(wg.Wait(), IsNil)
+	tearDownWriters()
+	close(pollDone)
+	<-pollStopped
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	inFlightSeen := false
+	for _, status := range statuses {
+		for _, table := range status.Tables {
+			// the chunks are counted as finished after they're written
+			c.Assert(table.FinishedChunks+len(table.InFlightChunks), LessEqual, table.TotalChunks)
+			// the tables are listed by their estimated rows before their chunks are sent
+			c.Assert(table.TotalChunks == 0 || table.TotalChunks == 2, IsTrue)
+			for _, idx := range table.InFlightChunks {
+				c.Assert(idx >= 0 && idx < 2, IsTrue)
+				inFlightSeen = true
+			}
+		}
+		c.Assert(status.FinishedChunks, LessEqual, status.TotalChunks)
+	}
+	c.Assert(inFlightSeen, IsTrue)
+
+	status = readStatus()
+	c.Assert(status.FinishedChunks, Equals, 2*len(tables))
+	c.Assert(status.TotalChunks, Equals, 2*len(tables))
+	c.Assert(status.ETASeconds, NotNil)
+	c.Assert(status.RowsPerSecond, Greater, float64(0))
+	for i, table := range status.Tables {
+		c.Assert(table.Table, Equals, tables[i])
+		c.Assert(table.FinishedChunks, Equals, 2)
+		c.Assert(table.InFlightChunks, HasLen, 0)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+// queryTimeoutError is returned if a statement of a table isn't done in Config.QueryTimeout.
+// It isn't a MySQL error, so the chunk query is retried on a new connection like the broken connections.
+type queryTimeoutError struct {
+	database, table string
+	query           string
+	timeout         time.Duration
+}
+
+func (e *queryTimeoutError) Error() string {
+	return fmt.Sprintf("query of table `%s`.`%s` isn't done in the query timeout %s, sql: %s", e.database, e.table, e.timeout, e.query)
+}
+
+// withQueryTimeout returns a context of a statement which is done after Config.QueryTimeout
+func withQueryTimeout(tctx *tcontext.Context, conf *Config) (*tcontext.Context, context.CancelFunc) {
+	if conf.QueryTimeout <= 0 {
+		return tctx, func() {}
+	}
+	ctx, cancel := context.WithTimeout(tctx, conf.QueryTimeout)
+	return tctx.WithContext(ctx), cancel
+}
+
+// timedOut checks whether the statement of qctx has been canceled by Config.QueryTimeout rather than tctx
+func timedOut(tctx, qctx *tcontext.Context) bool {
+	return qctx.Err() == context.DeadlineExceeded && tctx.Err() == nil
+}
+
+// runWithQueryTimeout runs the statement query of the table by fn, which should issue it with the given context.
+// If it isn't done in Config.QueryTimeout, a queryTimeoutError naming the table and the query is returned.
+func runWithQueryTimeout(tctx *tcontext.Context, conf *Config, database, table, query string, fn func(*tcontext.Context) error) error {
+	qctx, cancel := withQueryTimeout(tctx, conf)
+	defer cancel()
+	err := runQuery(qctx, fn)
+	if err != nil && timedOut(tctx, qctx) {
+		return &queryTimeoutError{database: database, table: table, query: query, timeout: conf.QueryTimeout}
+	}
+	return err
+}
+
+// runQuery runs fn with tctx. The failpoint SlowQuery blocks it until tctx is done to simulate a stuck statement
+func runQuery(tctx *tcontext.Context, fn func(*tcontext.Context) error) error {
+	failpoint.Inject("SlowQuery", func() {
+		<-tctx.Done()
+		failpoint.Return(errors.Trace(tctx.Err()))
+	})
+	return fn(tctx)
+}
+
+// startChunkQuery starts the chunk query of ir on conn. The rows are bound to a context canceled by the returned
+// function, which should be called after the rows are closed. Only the query is bounded by Config.QueryTimeout
+// until it returns, streaming the rows isn't, since a large chunk is bounded by Config.ChunkTimeout instead.
+func startChunkQuery(tctx *tcontext.Context, conf *Config, meta TableMeta, ir TableDataIR, conn *sql.Conn) (context.CancelFunc, error) {
+	if conf.QueryTimeout <= 0 {
+		return func() {}, ir.Start(tctx, conn)
+	}
+	ctx, cancel := context.WithCancel(tctx)
+	timer := time.AfterFunc(conf.QueryTimeout, cancel)
+	err := runQuery(tctx.WithContext(ctx), func(qctx *tcontext.Context) error {
+		return ir.Start(qctx, conn)
+	})
+	if !timer.Stop() && tctx.Err() == nil {
+		if err == nil {
+			ir.Close()
+		}
+		var query string
+		if td, ok := ir.(*tableData); ok {
+			query = td.query
+		}
+		return cancel, &queryTimeoutError{database: meta.DatabaseName(), table: meta.TableName(), query: query, timeout: conf.QueryTimeout}
+	}
+	return cancel, err
+}
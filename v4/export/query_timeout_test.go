@@ -0,0 +1,101 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
+)
+
+func (s *testSQLSuite) TestSelectMinAndMaxIntValueTimeout(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.QueryTimeout = 10 * time.Millisecond
+	d := &Dumper{tctx: tctx, conf: conf}
+	mock.ExpectQuery("SELECT MIN\\(`a`\\),MAX\\(`a`\\) FROM `test`.`t`").
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"MIN(`a`)", "MAX(`a`)"}).AddRow("1", "100"))
+	_, _, err = d.selectMinAndMaxIntValue(conn, "test", "t", "", "`a`")
+	c.Assert(err, ErrorMatches, "query of table `test`.`t` isn't done in the query timeout 10ms, sql: SELECT MIN\\(`a`\\),MAX\\(`a`\\) FROM `test`.`t`")
+	_, ok := errors.Cause(err).(*queryTimeoutError)
+	c.Assert(ok, IsTrue)
+
+	// the statements done in time aren't affected
+	conn, err = db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	conf.QueryTimeout = time.Minute
+	mock.ExpectQuery("SELECT MIN\\(`a`\\),MAX\\(`a`\\) FROM `test`.`t`").
+		WillReturnRows(sqlmock.NewRows([]string{"MIN(`a`)", "MAX(`a`)"}).AddRow("1", "100"))
+	min, max, err := d.selectMinAndMaxIntValue(conn, "test", "t", "", "`a`")
+	c.Assert(err, IsNil)
+	c.Assert(min.Int64(), Equals, int64(1))
+	c.Assert(max.Int64(), Equals, int64(100))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testWriterSuite) TestWriteTableDataRetryAfterQueryTimeout(c *C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.Consistency = consistencyTypeNone
+	conf.QueryTimeout = 50 * time.Millisecond
+	writer, rebuilt := s.newRetryWriter(conf, db, c)
+
+	// the chunk query which doesn't return in time is retried on a new connection,
+	// but the rows returned in time are streamed without the timeout
+	query := "SELECT * FROM `test`.`t` ORDER BY `a`"
+	mock.ExpectQuery(query).WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1))
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1).AddRow(2))
+	meta := newMockTableIR("test", "t", nil, nil, []string{"INT"})
+	c.Assert(writer.WriteTableData(meta, newTableData(query, 1, false), 0), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(*rebuilt, Equals, 1)
+	bytes, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, "test.t.000000000.sql"))
+	c.Assert(err, IsNil)
+	c.Assert(string(bytes), Equals, "INSERT INTO `t` VALUES\n(1),\n(2);\n")
+
+	// the error names the table and the query after the retries are exhausted
+	conf.MaxRetries = 0
+	mock.ExpectQuery(query).WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1))
+	err = writer.WriteTableData(meta, newTableData(query, 1, false), 1)
+	c.Assert(err, ErrorMatches, "query of table `test`.`t` isn't done in the query timeout 50ms, sql: SELECT \\* FROM `test`.`t` ORDER BY `a`")
+}
+
+func (s *testSQLSuite) TestQueryTimeoutWithFailpoint(c *C) {
+	if !failpointsRewritten(c) {
+		c.Skip("the failpoints aren't enabled, run `make failpoint-enable` first")
+	}
+	fp := "github.com/pingcap/dumpling/v4/export/SlowQuery"
+	c.Assert(failpoint.Enable(fp, "return"), IsNil)
+	defer func() {
+		c.Assert(failpoint.Disable(fp), IsNil)
+	}()
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.QueryTimeout = 10 * time.Millisecond
+	d := &Dumper{tctx: tcontext.Background().WithLogger(appLogger), conf: conf}
+	_, _, err = d.selectMinAndMaxIntValue(conn, "test", "slow", "", "`a`")
+	c.Assert(err, ErrorMatches, "query of table `test`.`slow` isn't done in the query timeout 10ms.*")
+}
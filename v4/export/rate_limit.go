@@ -0,0 +1,157 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// rateLimitBurstDuration is how long the tokens of a rateLimiter can be saved up, so the writers are throttled
+	// smoothly instead of bursting after being idle, e.g. between the chunks
+	rateLimitBurstDuration = 100 * time.Millisecond
+	// rateLimitGaugeInterval is the interval which the throughput gauge of a rateLimiter is updated at
+	rateLimitGaugeInterval = time.Second
+)
+
+// rateLimiter is a token bucket shared by all the writers, which limits the rows or bytes written per second.
+// The tokens can be borrowed, a caller taking more than the saved tokens waits until the debt is paid back.
+// A nil rateLimiter doesn't limit anything.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// taken is the tokens taken since windowStart, which is reported to gauge as the effective throughput
+	taken       float64
+	windowStart time.Time
+	gauge       *prometheus.GaugeVec
+	labels      prometheus.Labels
+}
+
+// newRateLimiter returns a rateLimiter of rate tokens per second, it's nil if rate is 0
+func newRateLimiter(rate uint64, gauge *prometheus.GaugeVec, labels prometheus.Labels) *rateLimiter {
+	if rate == 0 {
+		return nil
+	}
+	burst := math.Max(float64(rate)*rateLimitBurstDuration.Seconds(), 1)
+	now := time.Now()
+	return &rateLimiter{
+		rate:        float64(rate),
+		burst:       burst,
+		tokens:      burst,
+		last:        now,
+		windowStart: now,
+		gauge:       gauge,
+		labels:      labels,
+	}
+}
+
+// wait takes n tokens and waits until they're available, it returns early if ctx is done
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.taken += float64(n)
+	if elapsed := now.Sub(l.windowStart); elapsed >= rateLimitGaugeInterval {
+		SetGauge(l.gauge, l.labels, l.taken/elapsed.Seconds())
+		l.taken, l.windowStart = 0, now
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rateLimitIR limits the rows decoded per second by Config.MaxRowsPerSecond
+type rateLimitIR struct {
+	TableDataIR
+	ctx     context.Context
+	limiter *rateLimiter
+}
+
+// withRowsRateLimit wraps ir to be limited by limiter, ir is returned as is if limiter is nil
+func withRowsRateLimit(ctx context.Context, ir TableDataIR, limiter *rateLimiter) TableDataIR {
+	if limiter == nil {
+		return ir
+	}
+	return &rateLimitIR{TableDataIR: ir, ctx: ctx, limiter: limiter}
+}
+
+// Rows implements TableDataIR.Rows
+func (r *rateLimitIR) Rows() SQLRowIter {
+	return &rateLimitRowIter{SQLRowIter: r.TableDataIR.Rows(), ir: r}
+}
+
+type rateLimitRowIter struct {
+	SQLRowIter
+	ir *rateLimitIR
+}
+
+// Decode implements SQLRowIter.Decode
+func (it *rateLimitRowIter) Decode(row RowReceiver) error {
+	if err := it.ir.limiter.wait(it.ir.ctx, 1); err != nil {
+		return err
+	}
+	return it.SQLRowIter.Decode(row)
+}
+
+// rateLimitFileWriter limits the bytes written per second by Config.MaxBytesPerSecond
+type rateLimitFileWriter struct {
+	storage.ExternalFileWriter
+	limiter *rateLimiter
+}
+
+// withBytesRateLimit wraps w to be limited by limiter, w is returned as is if limiter is nil
+func withBytesRateLimit(w storage.ExternalFileWriter, limiter *rateLimiter) storage.ExternalFileWriter {
+	if limiter == nil {
+		return w
+	}
+	return &rateLimitFileWriter{ExternalFileWriter: w, limiter: limiter}
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *rateLimitFileWriter) Write(ctx context.Context, p []byte) (int, error) {
+	if err := w.limiter.wait(ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return w.ExternalFileWriter.Write(ctx, p)
+}
+
+// adjustRateLimit checks the options which the rows dumped can't be limited with
+func adjustRateLimit(conf *Config) error {
+	if conf.MaxRowsPerSecond == 0 && conf.MaxBytesPerSecond == 0 {
+		return nil
+	}
+	if conf.ServerSideDump {
+		return errors.New("config.MaxRowsPerSecond and config.MaxBytesPerSecond can't be used with config.ServerSideDump, the data isn't read by Dumpling")
+	}
+	return nil
+}
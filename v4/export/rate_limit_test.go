@@ -0,0 +1,85 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func (s *testWriterSuite) TestRateLimiter(c *C) {
+	var nilLimiter *rateLimiter
+	c.Assert(newRateLimiter(0, nil, nil), IsNil)
+	c.Assert(nilLimiter.wait(context.Background(), 1<<30), IsNil)
+
+	const (
+		rate    = 1000
+		threads = 4
+		tokens  = 300
+	)
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_rate"}, []string{"task"})
+	labels := prometheus.Labels{"task": "test"}
+	limiter := newRateLimiter(rate, gauge, labels)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < tokens; j++ {
+				c.Check(limiter.wait(context.Background(), 1), IsNil)
+			}
+		}()
+	}
+	wg.Wait()
+	// the saved tokens are taken at once, the others are limited by the rate
+	measured := (threads*tokens - limiter.burst) / time.Since(start).Seconds()
+	c.Assert(measured, Greater, rate*0.8)
+	c.Assert(measured, Less, rate*1.1)
+
+	var metric dto.Metric
+	c.Assert(gauge.With(labels).Write(&metric), IsNil)
+	c.Assert(metric.Gauge.GetValue(), Greater, rate*0.8)
+	c.Assert(metric.Gauge.GetValue(), Less, rate*1.2)
+}
+
+func (s *testWriterSuite) TestRateLimiterCanceled(c *C) {
+	limiter := newRateLimiter(1, nil, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	c.Assert(limiter.wait(ctx, 100), ErrorMatches, ".*context deadline exceeded")
+	c.Assert(time.Since(start), Less, time.Second)
+}
+
+func (s *testWriterSuite) TestWriteTableDataWithRateLimit(c *C) {
+	data := make([][]driver.Value, 0, 60)
+	for i := 0; i < 60; i++ {
+		data = append(data, []driver.Value{fmt.Sprint(i), "row"})
+	}
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = c.MkDir()
+	writer := s.newWriter(config, c)
+	writer.rowsLimiter = newRateLimiter(200, nil, nil)
+	writer.bytesLimiter = newRateLimiter(1<<20, nil, nil)
+	tableIR := newMockTableIR("test", "t", data, nil, []string{"INT", "VARCHAR"})
+	start := time.Now()
+	c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+	// 20 rows are saved up, the other 40 rows take 200ms
+	c.Assert(time.Since(start), GreaterEqual, 180*time.Millisecond)
+}
+
+func (s *testConfigSuite) TestAdjustRateLimit(c *C) {
+	conf := DefaultConfig()
+	conf.ServerSideDump = true
+	c.Assert(adjustRateLimit(conf), IsNil)
+	conf.MaxBytesPerSecond = 1024
+	c.Assert(adjustRateLimit(conf), ErrorMatches, ".*can't be used with config.ServerSideDump.*")
+}
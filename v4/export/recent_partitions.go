@@ -0,0 +1,48 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"go.uber.org/zap"
+)
+
+// recentPartitions returns the last n partitions, the partitions should be in definition order.
+// All the partitions are returned if n isn't positive or the table has no more than n partitions.
+func recentPartitions(tctx *tcontext.Context, db, tbl string, partitions []string, n int) []string {
+	if n <= 0 || n == len(partitions) {
+		return partitions
+	}
+	if n > len(partitions) {
+		tctx.L().Warn("table has fewer partitions than the recent partitions to dump, dump all of them",
+			zap.String("database", db), zap.String("table", tbl),
+			zap.Int("partitions", len(partitions)), zap.Int("recentPartitions", n))
+		return partitions
+	}
+	return partitions[len(partitions)-n:]
+}
+
+// dumpRecentPartitions dumps the last conf.RecentPartitions partitions of a partitioned table, every partition as a chunk.
+// It returns false if the table isn't partitioned.
+func (d *Dumper) dumpRecentPartitions(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta, taskChan chan<- Task) (bool, error) {
+	db, tbl := meta.DatabaseName(), meta.TableName()
+	partitions, err := GetPartitionNames(conn, db, tbl)
+	if err != nil {
+		return false, err
+	}
+	if len(partitions) == 0 {
+		return false, nil
+	}
+	partitions = recentPartitions(tctx, db, tbl, partitions, d.conf.RecentPartitions)
+	tctx.L().Debug("dumping recent partitions of partition table",
+		zap.String("database", db), zap.String("table", tbl), zap.Strings("partitions", partitions))
+	for i, partition := range partitions {
+		if err = d.dumpWholeTableDirectly(tctx, conn, meta, taskChan, partition, i, len(partitions)); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
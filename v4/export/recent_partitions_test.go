@@ -0,0 +1,74 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestDumpRecentPartitions(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	conf := DefaultConfig()
+	conf.SortByPk = false
+	conf.RecentPartitions = 2
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "shop", table: "logs", selectedField: "*"}
+	expectSelectField := func() {
+		mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("shop", "logs").
+			WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "EXTRA"}).AddRow("id", "").AddRow("msg", ""))
+	}
+
+	// the subpartitions of a partition are listed once
+	mock.ExpectQuery("SELECT PARTITION_NAME from INFORMATION_SCHEMA.PARTITIONS WHERE TABLE_SCHEMA = \\? AND TABLE_NAME = \\? ORDER BY PARTITION_ORDINAL_POSITION").
+		WithArgs("shop", "logs").
+		WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}).AddRow("p202101").AddRow("p202102").AddRow("p202103").AddRow("p202103"))
+	expectSelectField()
+	expectSelectField()
+	taskChan := make(chan Task, 3)
+	partitioned, err := d.dumpRecentPartitions(tctx, conn, meta, taskChan)
+	c.Assert(err, IsNil)
+	c.Assert(partitioned, IsTrue)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(taskChan, HasLen, 2)
+	for i, query := range []string{
+		"SELECT * FROM `shop`.`logs` PARTITION(`p202102`)",
+		"SELECT * FROM `shop`.`logs` PARTITION(`p202103`)",
+	} {
+		task := (<-taskChan).(*TaskTableData)
+		c.Assert(task.Data.(*tableData).query, Equals, query)
+		c.Assert(task.ChunkIndex, Equals, i)
+		c.Assert(task.TotalChunks, Equals, 2)
+	}
+
+	// all the partitions are dumped if there are fewer than N
+	conf.RecentPartitions = 5
+	mock.ExpectQuery("SELECT PARTITION_NAME from INFORMATION_SCHEMA.PARTITIONS").WithArgs("shop", "logs").
+		WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}).AddRow("p202101").AddRow("p202102"))
+	expectSelectField()
+	expectSelectField()
+	partitioned, err = d.dumpRecentPartitions(tctx, conn, meta, taskChan)
+	c.Assert(err, IsNil)
+	c.Assert(partitioned, IsTrue)
+	c.Assert(taskChan, HasLen, 2)
+	<-taskChan
+	<-taskChan
+
+	// tables which are not partitioned are dumped as usual
+	mock.ExpectQuery("SELECT PARTITION_NAME from INFORMATION_SCHEMA.PARTITIONS").WithArgs("shop", "logs").
+		WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}).AddRow(nil))
+	partitioned, err = d.dumpRecentPartitions(tctx, conn, meta, taskChan)
+	c.Assert(err, IsNil)
+	c.Assert(partitioned, IsFalse)
+	c.Assert(taskChan, HasLen, 0)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,161 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// replicaLagPollInterval is how often the replication lag is read with Config.MaxReplicaLagSeconds
+var replicaLagPollInterval = 5 * time.Second
+
+// showReplicaStatusVersion is the first version of MySQL having `SHOW REPLICA STATUS`
+var showReplicaStatusVersion = semver.New("8.0.22")
+
+// unknownReplicaLag is the lag when the replication isn't running
+const unknownReplicaLag = -1
+
+// replicaLagMonitor pauses the writers while the replication lag of the source replica exceeds Config.MaxReplicaLagSeconds.
+// It has its own pauseController so it doesn't resume the dump paused by the http request.
+type replicaLagMonitor struct {
+	maxLag   int64
+	pauseCtl *pauseController
+	// lag is the seconds behind the source read last time, it's unknownReplicaLag if the replication isn't running
+	lag int64
+}
+
+func newReplicaLagMonitor(maxLag int) *replicaLagMonitor {
+	return &replicaLagMonitor{maxLag: int64(maxLag), pauseCtl: newPauseController(), lag: unknownReplicaLag}
+}
+
+// replicaStatusQuery returns the statement to read the replication status of the server
+func replicaStatusQuery(si ServerInfo) string {
+	if si.ServerType == ServerTypeMySQL && si.ServerVersion != nil && si.ServerVersion.Compare(*showReplicaStatusVersion) >= 0 {
+		return "SHOW REPLICA STATUS"
+	}
+	return "SHOW SLAVE STATUS"
+}
+
+// readReplicaLag reads the seconds behind the source by query. It returns the largest one of the replication channels,
+// the lag is unknownReplicaLag if the replication isn't running, and isReplica is false if the server isn't a replica.
+func readReplicaLag(conn *sql.Conn, query string) (lag int64, isReplica bool, err error) {
+	lag = unknownReplicaLag
+	err = simpleQuery(conn, query, func(rows *sql.Rows) error {
+		isReplica = true
+		cols, err := rows.Columns()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		data := make([]sql.NullString, len(cols))
+		args := make([]interface{}, 0, len(cols))
+		for i := range data {
+			args = append(args, &data[i])
+		}
+		if err = rows.Scan(args...); err != nil {
+			return errors.Trace(err)
+		}
+		for i, col := range cols {
+			col = strings.ToLower(col)
+			if (col != "seconds_behind_master" && col != "seconds_behind_source") || !data[i].Valid {
+				continue
+			}
+			seconds, err := strconv.ParseInt(data[i].String, 10, 64)
+			if err != nil {
+				return errors.Annotatef(err, "invalid %s `%s`", cols[i], data[i].String)
+			}
+			if seconds > lag {
+				lag = seconds
+			}
+		}
+		return nil
+	})
+	return lag, isReplica, err
+}
+
+// update pauses or resumes the writers by the lag read last time
+func (m *replicaLagMonitor) update(tctx *tcontext.Context, lag int64) {
+	atomic.StoreInt64(&m.lag, lag)
+	switch {
+	case lag > m.maxLag:
+		if m.pauseCtl.Pause() {
+			tctx.L().Info("replication lag exceeds the threshold, pause the writers until the replica catches up",
+				zap.Int64("lag", lag), zap.Int64("max lag", m.maxLag))
+		}
+	case lag == unknownReplicaLag:
+		// the lag won't recover if the replication isn't running, so the writers aren't blocked by it
+		if m.pauseCtl.Resume() {
+			tctx.L().Warn("replication isn't running, resume the writers")
+		}
+	default:
+		if m.pauseCtl.Resume() {
+			tctx.L().Info("replica has caught up, resume the writers", zap.Int64("lag", lag))
+		}
+	}
+}
+
+// currentLag returns the lag read last time, ok is false if it's unknown
+func (m *replicaLagMonitor) currentLag() (lag int64, ok bool) {
+	lag = atomic.LoadInt64(&m.lag)
+	return lag, lag != unknownReplicaLag
+}
+
+// run polls the lag by query on conn until tctx is done
+func (m *replicaLagMonitor) run(tctx *tcontext.Context, conn *sql.Conn, query string) {
+	defer conn.Close()
+	tick := time.NewTicker(replicaLagPollInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tctx.Done():
+			return
+		case <-tick.C:
+		}
+		lag, _, err := readReplicaLag(conn, query)
+		if err != nil {
+			tctx.L().Warn("fail to read replication lag", zap.Error(err))
+			continue
+		}
+		m.update(tctx, lag)
+	}
+}
+
+// startReplicaLagMonitor is an initialization step of Dumper.
+// It starts polling the replication lag of the source with Config.MaxReplicaLagSeconds.
+func startReplicaLagMonitor(d *Dumper) error {
+	tctx, conf := d.tctx, d.conf
+	if conf.MaxReplicaLagSeconds == 0 {
+		return nil
+	}
+	switch conf.ServerInfo.ServerType {
+	case ServerTypeMySQL, ServerTypeMariaDB:
+	default:
+		return errors.Errorf("config.MaxReplicaLagSeconds doesn't support the server type %s", conf.ServerInfo.ServerType)
+	}
+	conn, err := d.dbHandle.Conn(tctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	query := replicaStatusQuery(conf.ServerInfo)
+	lag, isReplica, err := readReplicaLag(conn, query)
+	if err == nil && !isReplica {
+		err = errors.New("config.MaxReplicaLagSeconds requires the server to be a replica")
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	d.replicaLag = newReplicaLagMonitor(conf.MaxReplicaLagSeconds)
+	d.replicaLag.update(tctx, lag)
+	go d.replicaLag.run(tctx, conn, query)
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coreos/go-semver/semver"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestReplicaStatusQuery(c *C) {
+	c.Assert(replicaStatusQuery(ServerInfo{ServerType: ServerTypeMySQL, ServerVersion: semver.New("8.0.22")}), Equals, "SHOW REPLICA STATUS")
+	c.Assert(replicaStatusQuery(ServerInfo{ServerType: ServerTypeMySQL, ServerVersion: semver.New("5.7.30")}), Equals, "SHOW SLAVE STATUS")
+	c.Assert(replicaStatusQuery(ServerInfo{ServerType: ServerTypeMariaDB, ServerVersion: semver.New("10.5.8")}), Equals, "SHOW SLAVE STATUS")
+}
+
+func (s *testSQLSuite) TestReadReplicaLag(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	mock.ExpectQuery("SHOW REPLICA STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"Channel_Name", "Seconds_Behind_Source"}).AddRow("a", "3").AddRow("b", "12"))
+	lag, isReplica, err := readReplicaLag(conn, "SHOW REPLICA STATUS")
+	c.Assert(err, IsNil)
+	c.Assert(isReplica, IsTrue)
+	c.Assert(lag, Equals, int64(12))
+
+	// the replication isn't running
+	mock.ExpectQuery("SHOW SLAVE STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"Master_Host", "Seconds_Behind_Master"}).AddRow("127.0.0.1", nil))
+	lag, isReplica, err = readReplicaLag(conn, "SHOW SLAVE STATUS")
+	c.Assert(err, IsNil)
+	c.Assert(isReplica, IsTrue)
+	c.Assert(lag, Equals, int64(unknownReplicaLag))
+
+	// the server isn't a replica
+	mock.ExpectQuery("SHOW SLAVE STATUS").WillReturnRows(sqlmock.NewRows([]string{"Master_Host", "Seconds_Behind_Master"}))
+	_, isReplica, err = readReplicaLag(conn, "SHOW SLAVE STATUS")
+	c.Assert(err, IsNil)
+	c.Assert(isReplica, IsFalse)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testSQLSuite) TestReplicaLagMonitor(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	m := newReplicaLagMonitor(10)
+	_, ok := m.currentLag()
+	c.Assert(ok, IsFalse)
+	m.update(tctx, 5)
+	c.Assert(m.pauseCtl.IsPaused(), IsFalse)
+	m.update(tctx, 11)
+	c.Assert(m.pauseCtl.IsPaused(), IsTrue)
+	lag, ok := m.currentLag()
+	c.Assert(ok, IsTrue)
+	c.Assert(lag, Equals, int64(11))
+
+	// the writers are resumed when the replica catches up
+	defer func(interval time.Duration) {
+		replicaLagPollInterval = interval
+	}(replicaLagPollInterval)
+	replicaLagPollInterval = time.Millisecond
+	mock.ExpectQuery("SHOW SLAVE STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"Master_Host", "Seconds_Behind_Master"}).AddRow("127.0.0.1", "10"))
+	go m.run(tctx, conn, "SHOW SLAVE STATUS")
+	c.Assert(m.pauseCtl.waitIfPaused(tctx), IsNil)
+	lag, ok = m.currentLag()
+	c.Assert(ok, IsTrue)
+	c.Assert(lag, Equals, int64(10))
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+// restoreAssertFileSuffix is the suffix of the row-count assertion of a table written with Config.EmitRestoreAsserts.
+// It isn't .sql, otherwise Lightning routes `db.table-assert.sql` as the data of table `table-assert`.
+const restoreAssertFileSuffix = ".assert"
+
+func restoreAssertFileName(conf *Config, db, table string) (string, error) {
+	namer := &outputFileNamer{DB: outputIdentifier(conf, db), Table: outputIdentifier(conf, table)}
+	name, err := namer.render(DefaultOutputFileTemplate, "objectName")
+	if err != nil {
+		return "", err
+	}
+	return name + restoreAssertFileSuffix, nil
+}
+
+// restoreAssertSQL returns the statement which checks that the restored table has the rows dumped. It returns 'OK'
+// if the count matches, and fails with "Subquery returns more than 1 row" otherwise. SIGNAL can only be used in the
+// stored programs, while the subquery is evaluated only if the count doesn't match, and it's correlated to the count
+// so it can't be evaluated in advance. It works on MySQL, MariaDB and TiDB without any privilege to create routines.
+func restoreAssertSQL(db, table string, rows uint64) string {
+	name := wrapBackTicks(escapeString(db)) + "." + wrapBackTicks(escapeString(table))
+	return fmt.Sprintf("-- %s is expected to have %d rows\n"+
+		"SELECT IF(`cnt` = %d, 'OK', (SELECT 'row count mismatch' UNION ALL SELECT `cnt`)) AS `assert_rows` "+
+		"FROM (SELECT COUNT(*) AS `cnt` FROM %s) AS `restored`;\n", name, rows, rows, name)
+}
+
+// writeRestoreAsserts writes the row-count assertion of each dumped table with Config.EmitRestoreAsserts, the counts
+// are the rows actually written by the writers
+func writeRestoreAsserts(tctx *tcontext.Context, extStore storage.ExternalStorage, conf *Config, results []TableDumpResult) error {
+	for _, result := range results {
+		fileName, err := restoreAssertFileName(conf, result.Database, result.Table)
+		if err != nil {
+			return err
+		}
+		db, table := outputIdentifier(conf, result.Database), outputIdentifier(conf, result.Table)
+		if err = extStore.WriteFile(tctx, fileName, []byte(restoreAssertSQL(db, table, result.Rows))); err != nil {
+			return errors.Annotatef(err, "fail to write the row-count assertion of table `%s`.`%s`", result.Database, result.Table)
+		}
+	}
+	return nil
+}
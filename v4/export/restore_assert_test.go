@@ -0,0 +1,40 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestWriteRestoreAsserts(c *C) {
+	conf := DefaultConfig()
+	conf.LowercaseIdentifiers = true
+	collector := newTableStatsCollector()
+	collector.add("Shop", "Orders", tableChunkStats{rows: 10})
+	collector.add("Shop", "Orders", tableChunkStats{rows: 5})
+	collector.add("shop", "empty`t", tableChunkStats{})
+
+	dir := c.MkDir()
+	extStore, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	c.Assert(writeRestoreAsserts(tcontext.Background(), extStore, conf, collector.results()), IsNil)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "shop.orders.assert"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "-- `shop`.`orders` is expected to have 15 rows\n"+
+		"SELECT IF(`cnt` = 15, 'OK', (SELECT 'row count mismatch' UNION ALL SELECT `cnt`)) AS `assert_rows` "+
+		"FROM (SELECT COUNT(*) AS `cnt` FROM `shop`.`orders`) AS `restored`;\n")
+	content, err = ioutil.ReadFile(filepath.Join(dir, "shop.empty`t.assert"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Matches, "(?s).*`cnt` = 0, .* FROM `shop`.`empty``t`\\) .*")
+
+	conf.ColumnGroups = map[string]map[string][]ColumnGroup{"shop": {"orders": {{Name: "a", Columns: []string{"id"}}}}}
+	conf.EmitRestoreAsserts = true
+	c.Assert(adjustRestoreAsserts(conf), ErrorMatches, "config.EmitRestoreAsserts can't be used with config.ColumnGroups.*")
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DumpResult is the summary of a finished dump, which is passed to Config.OnFinish
+type DumpResult struct {
+	// TotalTables is the number of base tables to dump
+	TotalTables int
+	// TotalRows is the number of rows written
+	TotalRows uint64
+	// TotalBytes is the size of data written before compression
+	TotalBytes uint64
+	// TotalCompressedBytes is the size of the data files after compression, it's TotalBytes if they aren't compressed
+	TotalCompressedBytes uint64
+	Duration             time.Duration
+	// Snapshot is the snapshot used to dump TiDB, it's empty for other servers
+	Snapshot    string
+	Consistency string
+	// Tables are the statistics of the tables whose data is written, sorted by database and table name
+	Tables []TableDumpResult
+	// PreCheckFailures are the tables skipped because they fail Config.PreCheckTables
+	PreCheckFailures []TableCheckFailure
+	// SkippedTables are the tables skipped because they're dropped or altered during the dump with
+	// Config.OnTableError, the Message is the error of the table
+	SkippedTables []TableCheckFailure
+	// Err is the error that Dump() returns
+	Err error
+}
+
+// TableDumpResult is the statistics of a dumped table
+type TableDumpResult struct {
+	Database string
+	Table    string
+	Rows     uint64
+	Bytes    uint64
+	// CompressedBytes is the size of the data files after compression, it's Bytes if they aren't compressed
+	CompressedBytes uint64
+	// Chunks is the number of chunks written
+	Chunks int
+	// Duration is the time from the start of the first chunk to the end of the last chunk written
+	Duration time.Duration
+	// Checksum is the sum of the CRC-64 of the uncompressed data files, so it doesn't depend on the order
+	// the files are written in. It's only computed with Config.EmitStatsCSV
+	Checksum uint64
+
+	start, end time.Time
+}
+
+// tableChunkStats is the statistics of a written chunk
+type tableChunkStats struct {
+	rows, bytes, compressedBytes, checksum uint64
+	start, end                             time.Time
+}
+
+// TableCheckFailure is a table which fails Config.PreCheckTables
+type TableCheckFailure struct {
+	Database string
+	Table    string
+	Message  string
+}
+
+// tableStatsCollector collects the rows and bytes written for each table from all writers
+type tableStatsCollector struct {
+	mu     sync.Mutex
+	tables map[string]map[string]*TableDumpResult
+}
+
+func newTableStatsCollector() *tableStatsCollector {
+	return &tableStatsCollector{tables: make(map[string]map[string]*TableDumpResult)}
+}
+
+// add records a successfully written chunk
+func (s *tableStatsCollector) add(db, table string, chunk tableChunkStats) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tables, ok := s.tables[db]
+	if !ok {
+		tables = make(map[string]*TableDumpResult)
+		s.tables[db] = tables
+	}
+	result, ok := tables[table]
+	if !ok {
+		result = &TableDumpResult{Database: db, Table: table}
+		tables[table] = result
+	}
+	result.Rows += chunk.rows
+	result.Bytes += chunk.bytes
+	result.CompressedBytes += chunk.compressedBytes
+	result.Checksum += chunk.checksum
+	result.Chunks++
+	if !chunk.start.IsZero() && (result.start.IsZero() || chunk.start.Before(result.start)) {
+		result.start = chunk.start
+	}
+	if chunk.end.After(result.end) {
+		result.end = chunk.end
+	}
+	if !result.start.IsZero() && !result.end.IsZero() {
+		result.Duration = result.end.Sub(result.start)
+	}
+}
+
+// results returns the statistics of all tables sorted by database and table name
+func (s *tableStatsCollector) results() []TableDumpResult {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]TableDumpResult, 0, len(s.tables))
+	for _, tables := range s.tables {
+		for _, result := range tables {
+			results = append(results, *result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Database != results[j].Database {
+			return results[i].Database < results[j].Database
+		}
+		return results[i].Table < results[j].Table
+	})
+	return results
+}
+
+func (d *Dumper) buildDumpResult(startTime time.Time, err error) DumpResult {
+	conf := d.conf
+	result := DumpResult{
+		TotalTables:      calculateTableCount(conf.Tables),
+		Duration:         time.Since(startTime),
+		Snapshot:         conf.Snapshot,
+		Consistency:      conf.Consistency,
+		Tables:           d.tableStats.results(),
+		PreCheckFailures: d.preCheckFailures,
+		SkippedTables:    d.tableErrors.skippedTables(),
+		Err:              err,
+	}
+	for _, table := range result.Tables {
+		result.TotalRows += table.Rows
+		result.TotalBytes += table.Bytes
+		result.TotalCompressedBytes += table.CompressedBytes
+	}
+	return result
+}
@@ -4,6 +4,7 @@ package export
 
 import (
 	"strings"
+	"sync/atomic"
 	"time"
 
 	tcontext "github.com/pingcap/dumpling/v4/context"
@@ -11,6 +12,7 @@ import (
 	"github.com/go-sql-driver/mysql"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb/errno"
 	"go.uber.org/zap"
 )
 
@@ -36,15 +38,37 @@ func newDumpChunkBackoffer(shouldRetry bool) *dumpChunkBackoffer { // revive:dis
 	}
 }
 
+// newChunkQueryBackoffer returns the backoffer of the chunk queries of a writer, which retries the chunk
+// up to conf.MaxRetries times on the errors classified by isRetryableChunkError
+func newChunkQueryBackoffer(conf *Config, lease *gcSafePointLease) *dumpChunkBackoffer {
+	if !canRetryChunk(conf) {
+		return newDumpChunkBackoffer(false)
+	}
+	return &dumpChunkBackoffer{
+		attempt:      conf.MaxRetries + 1,
+		delayTime:    dumpChunkWaitInterval,
+		maxDelayTime: dumpChunkMaxWaitInterval,
+		isRetryable: func(err error) bool {
+			return isRetryableChunkError(err, conf.RetryableErrors, lease)
+		},
+	}
+}
+
 type dumpChunkBackoffer struct {
 	attempt      int
 	delayTime    time.Duration
 	maxDelayTime time.Duration
+	// isRetryable overrides the default classification of the errors if it's not nil
+	isRetryable func(error) bool
 }
 
 func (b *dumpChunkBackoffer) NextBackoff(err error) time.Duration {
+	if b.isRetryable != nil && !b.isRetryable(err) {
+		b.attempt = 0
+		return 0
+	}
 	err = errors.Cause(err)
-	if _, ok := err.(*mysql.MySQLError); ok && !dbutil.IsRetryableError(err) {
+	if _, ok := err.(*mysql.MySQLError); ok && b.isRetryable == nil && !dbutil.IsRetryableError(err) {
 		b.attempt = 0
 		return 0
 	} else if _, ok := err.(*writerError); ok {
@@ -64,6 +88,52 @@ func (b *dumpChunkBackoffer) Attempt() int {
 	return b.attempt
 }
 
+// defaultRetryableErrors are the MySQL error codes of TiDB which a chunk query is retried on by default
+func defaultRetryableErrors() []uint16 {
+	return []uint16{errno.ErrTiKVServerTimeout, errno.ErrRegionUnavailable, errno.ErrGCTooEarly}
+}
+
+// isRetryableChunkError checks whether a chunk query failed by err can be issued again. The errors other than
+// the MySQL errors come from the connection, e.g. connection reset by peer, they're retried on a new connection.
+// The snapshot too old error is only retried while lease protects the snapshot from GC.
+func isRetryableChunkError(err error, retryableErrors []uint16, lease *gcSafePointLease) bool {
+	switch e := errors.Cause(err).(type) {
+	case *writerError:
+		// the uploader writer's retry logic is already done in aws client. needn't retry here
+		return false
+	case *mysql.MySQLError:
+		if e.Number == errno.ErrGCTooEarly && !lease.valid() {
+			return false
+		}
+		for _, code := range retryableErrors {
+			if e.Number == code {
+				return true
+			}
+		}
+		return dbutil.IsRetryableError(e)
+	default:
+		return true
+	}
+}
+
+// gcSafePointLease records until when the snapshot of the dump is protected from GC by the service safe point.
+// A nil gcSafePointLease protects nothing.
+type gcSafePointLease struct {
+	until int64
+}
+
+// renew extends the lease to ttl after now, it's called after the service safe point is updated
+func (l *gcSafePointLease) renew(ttl time.Duration) {
+	if l == nil {
+		return
+	}
+	atomic.StoreInt64(&l.until, time.Now().Add(ttl).UnixNano())
+}
+
+func (l *gcSafePointLease) valid() bool {
+	return l != nil && time.Now().UnixNano() < atomic.LoadInt64(&l.until)
+}
+
 func newLockTablesBackoffer(tctx *tcontext.Context, blockList map[string]map[string]interface{}) *lockTablesBackoffer {
 	return &lockTablesBackoffer{
 		tctx:      tctx,
@@ -0,0 +1,168 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
+	"github.com/pingcap/tidb/errno"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+func (s *testWriterSuite) TestIsRetryableChunkError(c *C) {
+	retryableErrors := defaultRetryableErrors()
+	lease := &gcSafePointLease{}
+	for _, t := range []struct {
+		err       error
+		retryable bool
+	}{
+		{mysql.ErrInvalidConn, true},
+		{errors.New("read tcp 127.0.0.1:4000: read: connection reset by peer"), true},
+		{&mysql.MySQLError{Number: errno.ErrRegionUnavailable}, true},
+		{errors.Trace(&mysql.MySQLError{Number: errno.ErrTiKVServerTimeout}), true},
+		{&mysql.MySQLError{Number: errno.ErrPDServerTimeout}, true},
+		{&mysql.MySQLError{Number: errno.ErrGCTooEarly}, false},
+		{&mysql.MySQLError{Number: errno.ErrParse}, false},
+		{&writerError{error: errors.New("upload failed")}, false},
+	} {
+		c.Assert(isRetryableChunkError(t.err, retryableErrors, lease), Equals, t.retryable, Commentf("error %v", t.err))
+	}
+
+	// the snapshot too old error is retried while the snapshot is protected
+	lease.renew(time.Minute)
+	c.Assert(isRetryableChunkError(&mysql.MySQLError{Number: errno.ErrGCTooEarly}, retryableErrors, lease), IsTrue)
+	c.Assert(isRetryableChunkError(&mysql.MySQLError{Number: errno.ErrGCTooEarly}, nil, lease), IsFalse)
+	c.Assert(isRetryableChunkError(&mysql.MySQLError{Number: errno.ErrParse}, []uint16{errno.ErrParse}, nil), IsTrue)
+}
+
+func (s *testWriterSuite) TestChunkQueryBackoffer(c *C) {
+	conf := DefaultConfig()
+	conf.Consistency = consistencyTypeNone
+	conf.MaxRetries = 4
+	b := newChunkQueryBackoffer(conf, nil)
+	for i := 0; i < 4; i++ {
+		c.Assert(b.Attempt(), Equals, 5-i)
+		c.Assert(b.NextBackoff(mysql.ErrInvalidConn), LessEqual, dumpChunkMaxWaitInterval)
+	}
+	c.Assert(b.Attempt(), Equals, 1)
+	b = newChunkQueryBackoffer(conf, nil)
+	b.NextBackoff(&mysql.MySQLError{Number: errno.ErrParse})
+	c.Assert(b.Attempt(), Equals, 0)
+
+	// the chunk can't be retried if the connection can't be rebuilt
+	conf.Consistency = consistencyTypeLock
+	conf.TransactionalConsistency = true
+	c.Assert(newChunkQueryBackoffer(conf, nil).Attempt(), Equals, 1)
+}
+
+func (s *testWriterSuite) newRetryWriter(conf *Config, db *sql.DB, c *C) (*Writer, *int) {
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	writer := NewWriter(tcontext.Background().WithLogger(appLogger), 0, conf, conn, extStore)
+	rebuilt := 0
+	writer.rebuildConnFn = func(conn *sql.Conn) (*sql.Conn, error) {
+		rebuilt++
+		conn.Close()
+		return db.Conn(context.Background())
+	}
+	return writer, &rebuilt
+}
+
+func (s *testWriterSuite) TestWriteTableDataRetry(c *C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.Consistency = consistencyTypeNone
+	writer, rebuilt := s.newRetryWriter(conf, db, c)
+
+	// the same query is issued again on a rebuilt connection
+	query := "SELECT * FROM `test`.`t` ORDER BY `a`"
+	mock.ExpectQuery(query).WillReturnError(mysql.ErrInvalidConn)
+	mock.ExpectQuery(query).WillReturnError(&mysql.MySQLError{Number: errno.ErrRegionUnavailable, Message: "Region is unavailable"})
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1).AddRow(2).AddRow(3))
+	meta := newMockTableIR("test", "t", nil, nil, []string{"INT"})
+	c.Assert(writer.WriteTableData(meta, newTableData(query, 1, false), 0), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(*rebuilt, Equals, 2)
+	bytes, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, "test.t.000000000.sql"))
+	c.Assert(err, IsNil)
+	c.Assert(string(bytes), Equals, "INSERT INTO `t` VALUES\n(1),\n(2),\n(3);\n")
+
+	// the retries are capped by MaxRetries
+	conf.MaxRetries = 1
+	mock.ExpectQuery(query).WillReturnError(mysql.ErrInvalidConn)
+	mock.ExpectQuery(query).WillReturnError(mysql.ErrInvalidConn)
+	c.Assert(writer.WriteTableData(meta, newTableData(query, 1, false), 1), NotNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the other errors aren't retried
+	mock.ExpectQuery(query).WillReturnError(&mysql.MySQLError{Number: errno.ErrParse, Message: "syntax error"})
+	c.Assert(writer.WriteTableData(meta, newTableData(query, 1, false), 2), ErrorMatches, ".*syntax error.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(*rebuilt, Equals, 3)
+}
+
+// failpointsRewritten checks whether the failpoint markers are rewritten by failpoint-ctl, e.g. by `make test`
+func failpointsRewritten(c *C) (rewritten bool) {
+	fp := "github.com/pingcap/dumpling/v4/export/FailpointsRewritten"
+	c.Assert(failpoint.Enable(fp, "return"), IsNil)
+	defer func() {
+		c.Assert(failpoint.Disable(fp), IsNil)
+	}()
+	failpoint.Inject("FailpointsRewritten", func() {
+		rewritten = true
+	})
+	return
+}
+
+func (s *testWriterSuite) TestWriteTableDataRetryWithFailpoint(c *C) {
+	if !failpointsRewritten(c) {
+		c.Skip("the failpoints aren't enabled, run `make failpoint-enable` first")
+	}
+	fp := "github.com/pingcap/dumpling/v4/export/FailChunkQuery"
+	c.Assert(failpoint.Enable(fp, "2*return(9005)"), IsNil)
+	defer func() {
+		c.Assert(failpoint.Disable(fp), IsNil)
+	}()
+
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.Consistency = consistencyTypeNone
+	writer, rebuilt := s.newRetryWriter(conf, db, c)
+
+	// the chunk query fails twice, then it's issued only once and the rows aren't duplicated
+	query := "SELECT * FROM `test`.`t` ORDER BY `a`"
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1).AddRow(2))
+	meta := newMockTableIR("test", "t", nil, nil, []string{"INT"})
+	c.Assert(writer.WriteTableData(meta, newTableData(query, 1, false), 0), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(*rebuilt, Equals, 2)
+	bytes, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, "test.t.000000000.sql"))
+	c.Assert(err, IsNil)
+	c.Assert(string(bytes), Equals, "INSERT INTO `t` VALUES\n(1),\n(2);\n")
+}
+
+func (s *testConfigSuite) TestAdjustMaxRetries(c *C) {
+	conf := DefaultConfig()
+	c.Assert(adjustMaxRetries(conf), IsNil)
+	conf.MaxRetries = -1
+	c.Assert(adjustMaxRetries(conf), ErrorMatches, "config.MaxRetries should not be negative, got -1")
+}
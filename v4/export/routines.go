@@ -0,0 +1,276 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+const (
+	// routineTypeEvent is the type of the events. The types of the stored routines are the lowercase ROUTINE_TYPE,
+	// all the types are also the names of their output file templates
+	routineTypeEvent = "event"
+	// outputFileTemplateTrigger is the output file template of the triggers of a table
+	outputFileTemplateTrigger = "trigger"
+)
+
+// dumpRoutinesLast dumps the triggers, the stored routines and the events of all the databases after the tables
+// and the views, so the tables they reference are restored before them. The DEFINER clauses are kept as is,
+// like the views.
+func (d *Dumper) dumpRoutinesLast(tctx *tcontext.Context, metaConn *sql.Conn, taskChan chan<- Task) error {
+	conf := d.conf
+	if conf.NoSchemas || !(conf.DumpTriggers || conf.DumpRoutines || conf.DumpEvents) {
+		return nil
+	}
+	if conf.ServerInfo.ServerType == ServerTypeTiDB {
+		tctx.L().Warn("TiDB doesn't support triggers, stored routines or events, skip dumping them")
+		return nil
+	}
+	dbNames := make([]string, 0, len(conf.Tables))
+	for dbName := range conf.Tables {
+		dbNames = append(dbNames, dbName)
+	}
+	// the migration versions of the triggers and the events are assigned in the order they're dumped
+	sort.Strings(dbNames)
+	var tasks []Task
+	for _, dbName := range dbNames {
+		tables := conf.Tables[dbName]
+		if conf.DumpRoutines {
+			routines, err := d.routineTasks(metaConn, dbName)
+			if err != nil {
+				return err
+			}
+			tasks = append(tasks, routines...)
+		}
+		if conf.DumpTriggers {
+			triggers, err := d.triggerTasks(metaConn, dbName, tables)
+			if err != nil {
+				return err
+			}
+			tasks = append(tasks, triggers...)
+		}
+		if conf.DumpEvents {
+			events, err := d.eventTasks(metaConn, dbName)
+			if err != nil {
+				return err
+			}
+			tasks = append(tasks, events...)
+		}
+	}
+	if d.migration != nil {
+		for _, task := range tasks {
+			switch t := task.(type) {
+			case *TaskTriggerMeta:
+				t.MigrationVersion = d.migration.next()
+			case *TaskRoutineMeta:
+				if t.RoutineType == routineTypeEvent {
+					t.MigrationVersion = d.migration.next()
+				} else {
+					t.MigrationVersion = d.migration.routine(t.DatabaseName, t.RoutineName)
+				}
+			}
+		}
+	}
+	for _, task := range tasks {
+		tctx.L().Debug("dump routine", zap.String("task", task.Brief()))
+		if d.sendTaskToChan(tctx, task, taskChan) {
+			return tctx.Err()
+		}
+	}
+	return nil
+}
+
+// triggerTasks returns a task for each dumped table of dbName with triggers, the triggers are in their action order
+func (d *Dumper) triggerTasks(metaConn *sql.Conn, dbName string, tables []*TableInfo) ([]Task, error) {
+	dumped := make(map[string]struct{}, len(tables))
+	for _, table := range tables {
+		if table.Type == TableTypeBase {
+			dumped[table.Name] = struct{}{}
+		}
+	}
+	query := "SELECT TRIGGER_NAME, EVENT_OBJECT_TABLE FROM INFORMATION_SCHEMA.TRIGGERS WHERE TRIGGER_SCHEMA = ? " +
+		"ORDER BY EVENT_OBJECT_TABLE, ACTION_TIMING, EVENT_MANIPULATION, ACTION_ORDER"
+	var triggers [][2]string
+	if err := simpleQueryWithArgs(metaConn, func(rows *sql.Rows) error {
+		var trigger, table string
+		if err := rows.Scan(&trigger, &table); err != nil {
+			return errors.Trace(err)
+		}
+		if _, ok := dumped[table]; ok {
+			triggers = append(triggers, [2]string{trigger, table})
+		}
+		return nil
+	}, query, dbName); err != nil {
+		return nil, err
+	}
+
+	var (
+		tasks     []Task
+		task      *TaskTriggerMeta
+		createSQL strings.Builder
+	)
+	for _, t := range triggers {
+		trigger, table := t[0], t[1]
+		if task == nil || task.TableName != table {
+			if task != nil {
+				task.CreateTriggerSQL = createSQL.String()
+				tasks = append(tasks, task)
+			}
+			task = NewTaskTriggerMeta(dbName, table, "")
+			createSQL.Reset()
+		}
+		query := fmt.Sprintf("SHOW CREATE TRIGGER `%s`.`%s`", escapeString(dbName), escapeString(trigger))
+		if err := showCreateRoutine(metaConn, &createSQL, query, "SQL ORIGINAL STATEMENT", false); err != nil {
+			return nil, err
+		}
+	}
+	if task != nil {
+		task.CreateTriggerSQL = createSQL.String()
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// routineTasks returns a task for each name of the stored procedures and functions of dbName
+func (d *Dumper) routineTasks(metaConn *sql.Conn, dbName string) ([]Task, error) {
+	routines, err := listRoutines(metaConn, dbName)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]Task, 0, len(routines))
+	for _, r := range routines {
+		name, routineType := r[0], r[1]
+		var createSQL strings.Builder
+		query := fmt.Sprintf("SHOW CREATE %s `%s`.`%s`", strings.ToUpper(routineType), escapeString(dbName), escapeString(name))
+		if err := showCreateRoutine(metaConn, &createSQL, query, "CREATE "+strings.ToUpper(routineType), false); err != nil {
+			return nil, err
+		}
+		// a procedure and a function may have the same name, they're written into the same file
+		if n := len(tasks); n > 0 && tasks[n-1].(*TaskRoutineMeta).RoutineName == name {
+			tasks[n-1].(*TaskRoutineMeta).CreateRoutineSQL += createSQL.String()
+			continue
+		}
+		tasks = append(tasks, NewTaskRoutineMeta(dbName, name, routineType, createSQL.String()))
+	}
+	return tasks, nil
+}
+
+// listRoutines returns the names and the lowercase types of the stored procedures and functions of dbName
+func listRoutines(metaConn *sql.Conn, dbName string) ([][2]string, error) {
+	query := "SELECT ROUTINE_NAME, ROUTINE_TYPE FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_SCHEMA = ? " +
+		"AND ROUTINE_TYPE IN ('PROCEDURE', 'FUNCTION') ORDER BY ROUTINE_NAME, ROUTINE_TYPE"
+	var routines [][2]string
+	if err := simpleQueryWithArgs(metaConn, func(rows *sql.Rows) error {
+		var name, routineType string
+		if err := rows.Scan(&name, &routineType); err != nil {
+			return errors.Trace(err)
+		}
+		routines = append(routines, [2]string{name, strings.ToLower(routineType)})
+		return nil
+	}, query, dbName); err != nil {
+		return nil, err
+	}
+	return routines, nil
+}
+
+// listMigrationRoutines returns the names of the stored routines of each database to number them in the migration
+// layout, it's empty if they aren't dumped
+func listMigrationRoutines(metaConn *sql.Conn, conf *Config) (map[string][]string, error) {
+	routines := make(map[string][]string)
+	if conf.NoSchemas || !conf.DumpRoutines || conf.ServerInfo.ServerType == ServerTypeTiDB {
+		return routines, nil
+	}
+	for dbName := range conf.Tables {
+		rs, err := listRoutines(metaConn, dbName)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rs {
+			routines[dbName] = append(routines[dbName], r[0])
+		}
+	}
+	return routines, nil
+}
+
+// eventTasks returns a task for each event of dbName
+func (d *Dumper) eventTasks(metaConn *sql.Conn, dbName string) ([]Task, error) {
+	query := "SELECT EVENT_NAME FROM INFORMATION_SCHEMA.EVENTS WHERE EVENT_SCHEMA = ? ORDER BY EVENT_NAME"
+	var events []string
+	if err := simpleQueryWithArgs(metaConn, func(rows *sql.Rows) error {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return errors.Trace(err)
+		}
+		events = append(events, name)
+		return nil
+	}, query, dbName); err != nil {
+		return nil, err
+	}
+	tasks := make([]Task, 0, len(events))
+	for _, name := range events {
+		var createSQL strings.Builder
+		query := fmt.Sprintf("SHOW CREATE EVENT `%s`.`%s`", escapeString(dbName), escapeString(name))
+		if err := showCreateRoutine(metaConn, &createSQL, query, "CREATE EVENT", true); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, NewTaskRoutineMeta(dbName, name, routineTypeEvent, createSQL.String()))
+	}
+	return tasks, nil
+}
+
+// showCreateRoutine writes the statement in createColumn of the result of query into w, between the session
+// variables it was created with. The body may contain semicolons, so the statement is delimited by ";;".
+func showCreateRoutine(db *sql.Conn, w *strings.Builder, query, createColumn string, withTimeZone bool) error {
+	rows, err := db.QueryContext(context.Background(), query)
+	if err != nil {
+		return errors.Annotatef(err, "sql: %s", query)
+	}
+	results, err := GetSpecifiedColumnValuesAndClose(rows, createColumn, "SQL_MODE", "CHARACTER_SET_CLIENT", "COLLATION_CONNECTION", "TIME_ZONE")
+	if err != nil {
+		return errors.Annotatef(err, "sql: %s", query)
+	}
+	if len(results) == 0 || results[0][0] == "" {
+		// the definition is NULL without the privilege to read it
+		return errors.Errorf("can't read the definition by %s, please check the privileges of the user", query)
+	}
+	createSQL, sqlMode, charset, collation, timeZone := results[0][0], results[0][1], results[0][2], results[0][3], results[0][4]
+
+	SetCharset(w, charset, collation)
+	w.WriteString("SET @PREV_SQL_MODE=@@SQL_MODE;\n")
+	fmt.Fprintf(w, "SET SQL_MODE='%s';\n", escapeSQLString(sqlMode))
+	if withTimeZone {
+		w.WriteString("SET @PREV_TIME_ZONE=@@TIME_ZONE;\n")
+		fmt.Fprintf(w, "SET TIME_ZONE='%s';\n", escapeSQLString(timeZone))
+	}
+	w.WriteString("DELIMITER ;;\n")
+	w.WriteString(createSQL)
+	w.WriteString(";;\n")
+	w.WriteString("DELIMITER ;\n")
+	if withTimeZone {
+		w.WriteString("SET TIME_ZONE=@PREV_TIME_ZONE;\n")
+	}
+	w.WriteString("SET SQL_MODE=@PREV_SQL_MODE;\n")
+	RestoreCharset(w)
+	return nil
+}
+
+// adjustDumpRoutines checks the options which the triggers, stored routines and events can't be dumped with
+func adjustDumpRoutines(conf *Config) error {
+	if !(conf.DumpTriggers || conf.DumpRoutines || conf.DumpEvents) {
+		return nil
+	}
+	if conf.TargetDSN != "" {
+		return errors.New("config.DumpTriggers, config.DumpRoutines and config.DumpEvents can't be used with config.TargetDSN, " +
+			"their DELIMITER statements can only be restored by the mysql client")
+	}
+	return nil
+}
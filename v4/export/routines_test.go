@@ -0,0 +1,203 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+const (
+	testTriggerSQL = "CREATE DEFINER=`root`@`%` TRIGGER `t1_ai` AFTER INSERT ON `t1` FOR EACH ROW BEGIN\n" +
+		"  INSERT INTO `t2` (`id`) VALUES (NEW.`id`);\n  UPDATE `t2` SET `cnt` = `cnt` + 1 WHERE `id` = NEW.`id`;\nEND"
+	testFunctionSQL = "CREATE DEFINER=`root`@`%` FUNCTION `greet`(`name` varchar(20)) RETURNS varchar(50) CHARSET utf8mb4\n" +
+		"    DETERMINISTIC\nBEGIN\n  RETURN CONCAT('你好，', `name`, ' 🍣');\nEND"
+	testEventSQL = "CREATE DEFINER=`root`@`%` EVENT `purge` ON SCHEDULE EVERY 1 DAY STARTS '2021-06-01 00:00:00' " +
+		"ON COMPLETION NOT PRESERVE ENABLE DO DELETE FROM `t2` WHERE `cnt` = 0"
+)
+
+func (s *testSQLSuite) TestDumpRoutines(c *C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.OutputDirPath = c.MkDir()
+	conf.DumpRoutines, conf.DumpTriggers, conf.DumpEvents = true, true, true
+	conf.Tables = NewDatabaseTables().AppendTables("test", "t1", "t2")
+	d := &Dumper{tctx: tctx, conf: conf}
+
+	mock.ExpectQuery("SELECT ROUTINE_NAME, ROUTINE_TYPE FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_SCHEMA = ? " +
+		"AND ROUTINE_TYPE IN ('PROCEDURE', 'FUNCTION') ORDER BY ROUTINE_NAME, ROUTINE_TYPE").WithArgs("test").
+		WillReturnRows(sqlmock.NewRows([]string{"ROUTINE_NAME", "ROUTINE_TYPE"}).AddRow("greet", "FUNCTION"))
+	mock.ExpectQuery("SHOW CREATE FUNCTION `test`.`greet`").
+		WillReturnRows(sqlmock.NewRows([]string{"Function", "sql_mode", "Create Function", "character_set_client", "collation_connection", "Database Collation"}).
+			AddRow("greet", "STRICT_TRANS_TABLES", testFunctionSQL, "utf8mb4", "utf8mb4_general_ci", "utf8mb4_bin"))
+	// the trigger of the table which isn't dumped is skipped
+	mock.ExpectQuery("SELECT TRIGGER_NAME, EVENT_OBJECT_TABLE FROM INFORMATION_SCHEMA.TRIGGERS WHERE TRIGGER_SCHEMA = ? " +
+		"ORDER BY EVENT_OBJECT_TABLE, ACTION_TIMING, EVENT_MANIPULATION, ACTION_ORDER").WithArgs("test").
+		WillReturnRows(sqlmock.NewRows([]string{"TRIGGER_NAME", "EVENT_OBJECT_TABLE"}).AddRow("t1_ai", "t1").AddRow("t3_ai", "t3"))
+	mock.ExpectQuery("SHOW CREATE TRIGGER `test`.`t1_ai`").
+		WillReturnRows(sqlmock.NewRows([]string{"Trigger", "sql_mode", "SQL Original Statement", "character_set_client", "collation_connection", "Database Collation", "Created"}).
+			AddRow("t1_ai", "", testTriggerSQL, "utf8mb4", "utf8mb4_general_ci", "utf8mb4_bin", "2021-06-01 00:00:00.00"))
+	mock.ExpectQuery("SELECT EVENT_NAME FROM INFORMATION_SCHEMA.EVENTS WHERE EVENT_SCHEMA = ? ORDER BY EVENT_NAME").WithArgs("test").
+		WillReturnRows(sqlmock.NewRows([]string{"EVENT_NAME"}).AddRow("purge"))
+	mock.ExpectQuery("SHOW CREATE EVENT `test`.`purge`").
+		WillReturnRows(sqlmock.NewRows([]string{"Event", "sql_mode", "time_zone", "Create Event", "character_set_client", "collation_connection", "Database Collation"}).
+			AddRow("purge", "NO_ENGINE_SUBSTITUTION", "SYSTEM", testEventSQL, "utf8mb4", "utf8mb4_general_ci", "utf8mb4_bin"))
+
+	taskChan := make(chan Task, 4)
+	c.Assert(d.dumpRoutinesLast(tctx, conn, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	writer := NewWriter(tctx, 0, conf, conn, extStore)
+	var briefs []string
+	for task := range taskChan {
+		briefs = append(briefs, task.Brief())
+		c.Assert(writer.handleTask(task), IsNil)
+	}
+	c.Assert(briefs, DeepEquals, []string{
+		"meta of function 'test'.'greet'",
+		"triggers of table 'test'.'t1'",
+		"meta of event 'test'.'purge'",
+	})
+
+	for _, t := range []struct {
+		fileName string
+		expected string
+	}{
+		{"test.greet-schema-post.sql", "/*!40101 SET NAMES binary*/;\n" +
+			"SET @PREV_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT;\n" +
+			"SET @PREV_CHARACTER_SET_RESULTS=@@CHARACTER_SET_RESULTS;\n" +
+			"SET @PREV_COLLATION_CONNECTION=@@COLLATION_CONNECTION;\n" +
+			"SET character_set_client = utf8mb4;\n" +
+			"SET character_set_results = utf8mb4;\n" +
+			"SET collation_connection = utf8mb4_general_ci;\n" +
+			"SET @PREV_SQL_MODE=@@SQL_MODE;\n" +
+			"SET SQL_MODE='STRICT_TRANS_TABLES';\n" +
+			"DELIMITER ;;\n" +
+			testFunctionSQL + ";;\n" +
+			"DELIMITER ;\n" +
+			"SET SQL_MODE=@PREV_SQL_MODE;\n" +
+			"SET character_set_client = @PREV_CHARACTER_SET_CLIENT;\n" +
+			"SET character_set_results = @PREV_CHARACTER_SET_RESULTS;\n" +
+			"SET collation_connection = @PREV_COLLATION_CONNECTION;\n"},
+		{"test.t1-schema-triggers.sql", "/*!40101 SET NAMES binary*/;\n" +
+			"SET @PREV_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT;\n" +
+			"SET @PREV_CHARACTER_SET_RESULTS=@@CHARACTER_SET_RESULTS;\n" +
+			"SET @PREV_COLLATION_CONNECTION=@@COLLATION_CONNECTION;\n" +
+			"SET character_set_client = utf8mb4;\n" +
+			"SET character_set_results = utf8mb4;\n" +
+			"SET collation_connection = utf8mb4_general_ci;\n" +
+			"SET @PREV_SQL_MODE=@@SQL_MODE;\n" +
+			"SET SQL_MODE='';\n" +
+			"DELIMITER ;;\n" +
+			testTriggerSQL + ";;\n" +
+			"DELIMITER ;\n" +
+			"SET SQL_MODE=@PREV_SQL_MODE;\n" +
+			"SET character_set_client = @PREV_CHARACTER_SET_CLIENT;\n" +
+			"SET character_set_results = @PREV_CHARACTER_SET_RESULTS;\n" +
+			"SET collation_connection = @PREV_COLLATION_CONNECTION;\n"},
+		{"test.purge-schema-post.sql", "/*!40101 SET NAMES binary*/;\n" +
+			"SET @PREV_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT;\n" +
+			"SET @PREV_CHARACTER_SET_RESULTS=@@CHARACTER_SET_RESULTS;\n" +
+			"SET @PREV_COLLATION_CONNECTION=@@COLLATION_CONNECTION;\n" +
+			"SET character_set_client = utf8mb4;\n" +
+			"SET character_set_results = utf8mb4;\n" +
+			"SET collation_connection = utf8mb4_general_ci;\n" +
+			"SET @PREV_SQL_MODE=@@SQL_MODE;\n" +
+			"SET SQL_MODE='NO_ENGINE_SUBSTITUTION';\n" +
+			"SET @PREV_TIME_ZONE=@@TIME_ZONE;\n" +
+			"SET TIME_ZONE='SYSTEM';\n" +
+			"DELIMITER ;;\n" +
+			testEventSQL + ";;\n" +
+			"DELIMITER ;\n" +
+			"SET TIME_ZONE=@PREV_TIME_ZONE;\n" +
+			"SET SQL_MODE=@PREV_SQL_MODE;\n" +
+			"SET character_set_client = @PREV_CHARACTER_SET_CLIENT;\n" +
+			"SET character_set_results = @PREV_CHARACTER_SET_RESULTS;\n" +
+			"SET collation_connection = @PREV_COLLATION_CONNECTION;\n"},
+	} {
+		bytes, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, t.fileName))
+		c.Assert(err, IsNil)
+		c.Assert(string(bytes), Equals, t.expected, Commentf("file %s", t.fileName))
+	}
+}
+
+func (s *testSQLSuite) TestDumpRoutinesWithSameName(c *C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.DumpRoutines = true
+	d := &Dumper{tctx: tcontext.Background().WithLogger(appLogger), conf: conf}
+	mock.ExpectQuery("SELECT ROUTINE_NAME, ROUTINE_TYPE FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_SCHEMA = ? " +
+		"AND ROUTINE_TYPE IN ('PROCEDURE', 'FUNCTION') ORDER BY ROUTINE_NAME, ROUTINE_TYPE").WithArgs("test").
+		WillReturnRows(sqlmock.NewRows([]string{"ROUTINE_NAME", "ROUTINE_TYPE"}).AddRow("r", "FUNCTION").AddRow("r", "PROCEDURE"))
+	columns := []string{"sql_mode", "character_set_client", "collation_connection"}
+	mock.ExpectQuery("SHOW CREATE FUNCTION `test`.`r`").
+		WillReturnRows(sqlmock.NewRows(append(columns, "Create Function")).
+			AddRow("", "utf8mb4", "utf8mb4_bin", "CREATE FUNCTION `r`() RETURNS int RETURN 1"))
+	mock.ExpectQuery("SHOW CREATE PROCEDURE `test`.`r`").
+		WillReturnRows(sqlmock.NewRows(append(columns, "Create Procedure")).
+			AddRow("", "utf8mb4", "utf8mb4_bin", "CREATE PROCEDURE `r`() SELECT 1"))
+	tasks, err := d.routineTasks(conn, "test")
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(tasks, HasLen, 1)
+	task := tasks[0].(*TaskRoutineMeta)
+	c.Assert(task.RoutineType, Equals, "function")
+	c.Assert(task.CreateRoutineSQL, Matches, "(?s).*CREATE FUNCTION `r`.*;;\n.*CREATE PROCEDURE `r`.*;;\n.*")
+
+	// the definition is NULL without the privilege
+	mock.ExpectQuery("SELECT ROUTINE_NAME, ROUTINE_TYPE FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_SCHEMA = ? " +
+		"AND ROUTINE_TYPE IN ('PROCEDURE', 'FUNCTION') ORDER BY ROUTINE_NAME, ROUTINE_TYPE").WithArgs("test").
+		WillReturnRows(sqlmock.NewRows([]string{"ROUTINE_NAME", "ROUTINE_TYPE"}).AddRow("r", "PROCEDURE"))
+	mock.ExpectQuery("SHOW CREATE PROCEDURE `test`.`r`").
+		WillReturnRows(sqlmock.NewRows(append(columns, "Create Procedure")).AddRow("", "utf8mb4", "utf8mb4_bin", nil))
+	_, err = d.routineTasks(conn, "test")
+	c.Assert(err, ErrorMatches, "can't read the definition by SHOW CREATE PROCEDURE `test`.`r`.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testSQLSuite) TestDumpRoutinesOnTiDB(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.DumpRoutines, conf.DumpTriggers, conf.DumpEvents = true, true, true
+	conf.ServerInfo.ServerType = ServerTypeTiDB
+	conf.Tables = NewDatabaseTables().AppendTables("test", "t1")
+	d := &Dumper{tctx: tcontext.Background().WithLogger(appLogger), conf: conf}
+	taskChan := make(chan Task, 1)
+	c.Assert(d.dumpRoutinesLast(d.tctx, conn, taskChan), IsNil)
+	c.Assert(taskChan, HasLen, 0)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testConfigSuite) TestAdjustDumpRoutines(c *C) {
+	conf := DefaultConfig()
+	conf.TargetDSN = "root@tcp(127.0.0.1:3306)/"
+	c.Assert(adjustDumpRoutines(conf), IsNil)
+	conf.DumpTriggers = true
+	c.Assert(adjustDumpRoutines(conf), ErrorMatches, ".*can't be used with config.TargetDSN.*")
+}
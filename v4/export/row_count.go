@@ -0,0 +1,28 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"strconv"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+// rowCountSuffix is the suffix of the sidecar recording the rows written in a csv data file with Config.RowCountTrailer
+const rowCountSuffix = ".rows"
+
+// writeRowCountTrailer ends a sql data file with the comment `-- rows: N` of the rows written in it.
+// It's written through the writer of the data so it's inside the compression stream and covered by the checksums.
+func writeRowCountTrailer(tctx *tcontext.Context, w storage.ExternalFileWriter, rows uint64) error {
+	_, err := w.Write(tctx, []byte("-- rows: "+strconv.FormatUint(rows, 10)+"\n"))
+	return errors.Trace(err)
+}
+
+// writeRowCountSidecar records the rows written in the csv data file fileName into its sidecar,
+// a trailer can't be added to csv without breaking the readers
+func writeRowCountSidecar(tctx *tcontext.Context, s storage.ExternalStorage, fileName string, rows uint64) error {
+	return errors.Trace(s.WriteFile(tctx, fileName+rowCountSuffix, []byte(strconv.FormatUint(rows, 10)+"\n")))
+}
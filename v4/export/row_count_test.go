@@ -0,0 +1,50 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql/driver"
+	"io/ioutil"
+	"path"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestWriteTableDataWithRowCountTrailer(c *C) {
+	data := [][]driver.Value{{"1", "bob"}, {"2", "sarah"}}
+
+	// the trailer of the sql file is inside the compression
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.RowCountTrailer = true
+	conf.CompressType = CompressGzip
+	writer := s.newWriter(conf, c)
+	tableIR := newMockTableIR("test", "employee", data, nil, []string{"INT", "VARCHAR"})
+	c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+	compressed, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, "test.employee.000000000.sql.gz"))
+	c.Assert(err, IsNil)
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "INSERT INTO `employee` VALUES\n(1,'bob'),\n(2,'sarah');\n-- rows: 2\n")
+
+	// the rows of the csv file are in its sidecar
+	conf = defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.RowCountTrailer = true
+	conf.FileType = FileFormatCSVString
+	conf.CsvSeparator, conf.CsvDelimiter = ",", "\""
+	conf.NoHeader = true
+	writer = s.newWriter(conf, c)
+	tableIR = newMockTableIR("test", "employee", data, nil, []string{"INT", "VARCHAR"})
+	c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+	content, err = ioutil.ReadFile(path.Join(conf.OutputDirPath, "test.employee.000000000.csv"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "1,\"bob\"\n2,\"sarah\"\n")
+	content, err = ioutil.ReadFile(path.Join(conf.OutputDirPath, "test.employee.000000000.csv"+rowCountSuffix))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "2\n")
+}
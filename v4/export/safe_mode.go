@@ -0,0 +1,109 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// SafeModeWholeTable is the value of Config.SafeModeRows to write all the rows in safe mode
+	SafeModeWholeTable = -1
+
+	safeModeInsertKeyword = "REPLACE INTO"
+)
+
+// safeModeCounter counts the rows of a table which are still written in safe mode. The rows are taken by
+// the chunks of the table in the order they're written, so the first rows written of the table are in safe mode.
+type safeModeCounter struct {
+	limit     int64
+	remaining int64
+}
+
+func safeModeOf(meta TableMeta) *safeModeCounter {
+	if tm, ok := meta.(*tableMeta); ok {
+		return tm.safeMode
+	}
+	return nil
+}
+
+// take takes a row to write in safe mode, it returns false if the rows in safe mode are exhausted
+func (c *safeModeCounter) take() bool {
+	if c == nil {
+		return false
+	}
+	if atomic.AddInt64(&c.remaining, -1) >= 0 {
+		return true
+	}
+	atomic.AddInt64(&c.remaining, 1)
+	return false
+}
+
+// giveBack returns the rows taken by a failed attempt to write, so they're written in safe mode again
+func (c *safeModeCounter) giveBack(rows int64) {
+	if c == nil || rows == 0 {
+		return
+	}
+	atomic.AddInt64(&c.remaining, rows)
+}
+
+// written returns the rows written in safe mode
+func (c *safeModeCounter) written() int64 {
+	return c.limit - atomic.LoadInt64(&c.remaining)
+}
+
+// safeModeRecorder records the rows written in safe mode of the tables, so the boundary is written into the metadata
+type safeModeRecorder struct {
+	rows int64
+
+	mu       sync.Mutex
+	counters map[TableMeta]*safeModeCounter
+	// metas are the tables in the order they are dumped
+	metas []TableMeta
+}
+
+func newSafeModeRecorder(rows int64) *safeModeRecorder {
+	return &safeModeRecorder{rows: rows, counters: make(map[TableMeta]*safeModeCounter)}
+}
+
+// register starts counting the rows written in safe mode of meta from scratch
+func (r *safeModeRecorder) register(meta TableMeta) {
+	if r == nil {
+		return
+	}
+	tm, ok := meta.(*tableMeta)
+	if !ok {
+		return
+	}
+	limit := r.rows
+	if limit == SafeModeWholeTable {
+		limit = math.MaxInt64
+	}
+	tm.safeMode = &safeModeCounter{limit: limit, remaining: limit}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.counters[meta]; !ok {
+		r.metas = append(r.metas, meta)
+	}
+	r.counters[meta] = tm.safeMode
+}
+
+// recordSafeMode records the rows of each table written by REPLACE INTO, the rows after them are written by INSERT INTO
+func (m *globalMetadata) recordSafeMode(r *safeModeRecorder) {
+	m.buffer.WriteString("SAFE MODE:\n")
+	if r.rows == SafeModeWholeTable {
+		m.buffer.WriteString("\tRows: all\n")
+	} else {
+		m.buffer.WriteString("\tRows: " + strconv.FormatInt(r.rows, 10) + "\n")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, meta := range r.metas {
+		m.buffer.WriteString("\t" + wrapBackTicks(escapeString(meta.DatabaseName())) + "." +
+			wrapBackTicks(escapeString(meta.TableName())) + ": " + strconv.FormatInt(r.counters[meta].written(), 10) + "\n")
+	}
+	m.buffer.WriteString("\n")
+}
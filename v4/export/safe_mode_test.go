@@ -0,0 +1,74 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestWriteInsertWithSafeMode(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	colTypes, err := GetColumnTypes(conn, "*", "test", "t")
+	c.Assert(err, IsNil)
+	meta := &tableMeta{database: "test", table: "t", colTypes: colTypes, selectedField: "*"}
+	recorder := newSafeModeRecorder(3)
+	recorder.register(meta)
+
+	conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+	writeChunk := func(data [][]driver.Value, rowErr error) (string, error) {
+		tableIR := newMockTableIR("test", "t", data, nil, []string{"INT"})
+		tableIR.rowErr = rowErr
+		bf := storage.NewBufferWriter()
+		_, err := WriteInsert(tcontext.Background(), conf, meta, tableIR, bf)
+		return bf.String(), err
+	}
+
+	data, err := writeChunk([][]driver.Value{{"1"}, {"2"}}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(data, Equals, "REPLACE INTO `t` VALUES\n('1'),\n('2');\n")
+
+	// the rows taken by the failed chunk are written in safe mode again
+	_, err = writeChunk([][]driver.Value{{"3"}, {"4"}}, errors.New("connection is closed"))
+	c.Assert(err, NotNil)
+	c.Assert(meta.safeMode.written(), Equals, int64(2))
+
+	// the statement in safe mode ends in the middle of the chunk
+	data, err = writeChunk([][]driver.Value{{"3"}, {"4"}, {"5"}}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(data, Equals, "REPLACE INTO `t` VALUES\n('3');\nINSERT INTO `t` VALUES\n('4'),\n('5');\n")
+
+	data, err = writeChunk([][]driver.Value{{"6"}}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(data, Equals, "INSERT INTO `t` VALUES\n('6');\n")
+	c.Assert(meta.safeMode.written(), Equals, int64(3))
+
+	other := &tableMeta{database: "test", table: "t`2"}
+	recorder.register(other)
+	m := newGlobalMetadata(tcontext.Background(), nil, "")
+	m.recordSafeMode(recorder)
+	c.Assert(m.String(), Equals, "SAFE MODE:\n\tRows: 3\n\t`test`.`t`: 3\n\t`test`.`t``2`: 0\n\n")
+
+	// all the rows are in safe mode
+	recorder = newSafeModeRecorder(SafeModeWholeTable)
+	recorder.register(meta)
+	data, err = writeChunk([][]driver.Value{{"1"}, {"2"}}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(data, Equals, "REPLACE INTO `t` VALUES\n('1'),\n('2');\n")
+	m = newGlobalMetadata(tcontext.Background(), nil, "")
+	m.recordSafeMode(recorder)
+	c.Assert(m.String(), Equals, "SAFE MODE:\n\tRows: all\n\t`test`.`t`: 2\n\n")
+}
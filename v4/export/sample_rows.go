@@ -0,0 +1,98 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+const (
+	// sampleFractionScale is the number of buckets the rows are hashed into with Config.SampleFraction
+	sampleFractionScale = 1000000
+	// sampledRowsUnit is the name of the rows dumped with Config.SampleFraction in the summary
+	sampledRowsUnit = "sampled rows"
+)
+
+// setSampleCondition sets the condition of meta to select about Config.SampleFraction of its rows by. The rows are
+// selected by the CRC32 of the primary key, or _tidb_rowid, or all the dumped columns if the table has neither of
+// them, so the same rows are selected every time and the chunks of the table select the rows independently.
+//
+// TiDB's TABLESAMPLE only samples the first row of each region, which can't select a fraction of the rows,
+// so the same condition is used for TiDB.
+func setSampleCondition(tctx *tcontext.Context, conn *sql.Conn, conf *Config, meta TableMeta) error {
+	tm, ok := meta.(*tableMeta)
+	if !ok {
+		return nil
+	}
+	cols, err := GetPrimaryKeyColumns(conn, tm.database, tm.table)
+	if err != nil {
+		return err
+	}
+	if len(cols) == 0 && conf.ServerInfo.ServerType == ServerTypeTiDB {
+		if ok, err := SelectTiDBRowID(conn, tm.database, tm.table); err == nil && ok {
+			cols = []string{"_tidb_rowid"}
+		}
+	}
+	if len(cols) == 0 {
+		tctx.L().Warn("table has no primary key, sample its rows by all the dumped columns",
+			zap.String("database", tm.database), zap.String("table", tm.table))
+		cols = tm.ColumnNames()
+	}
+	tm.sampleCondition = buildSampleCondition(cols, conf.SampleFraction)
+	return nil
+}
+
+// buildSampleCondition builds the condition to select about fraction of the rows by the hash of cols
+func buildSampleCondition(cols []string, fraction float64) string {
+	fields := make([]string, len(cols))
+	for i, col := range cols {
+		fields[i] = wrapBackTicks(escapeString(col))
+	}
+	hashed := fields[0]
+	if len(fields) > 1 {
+		hashed = "CONCAT_WS(','," + strings.Join(fields, ",") + ")"
+	}
+	threshold := int64(math.Round(fraction * sampleFractionScale))
+	return fmt.Sprintf("CRC32(%s) %% %d < %d", hashed, sampleFractionScale, threshold)
+}
+
+func sampleConditionOf(meta TableMeta) string {
+	if tm, ok := meta.(*tableMeta); ok {
+		return tm.sampleCondition
+	}
+	return ""
+}
+
+// buildTableWhereCondition is like buildWhereCondition, but the rows are also filtered by the sample condition of meta
+func buildTableWhereCondition(conf *Config, meta TableMeta, where string) string {
+	if cond := sampleConditionOf(meta); cond != "" {
+		if where == "" {
+			where = cond
+		} else {
+			where = fmt.Sprintf("(%s) AND %s", where, cond)
+		}
+	}
+	return buildWhereCondition(conf, where)
+}
+
+// adjustSampleFraction checks conf.SampleFraction
+func adjustSampleFraction(conf *Config) error {
+	if conf.SampleFraction == 0 {
+		return nil
+	}
+	if conf.SampleFraction < 0 || conf.SampleFraction > 1 {
+		return errors.Errorf("config.SampleFraction %v should be greater than 0 and at most 1", conf.SampleFraction)
+	}
+	if conf.SQL != "" || len(conf.NamedQueries) > 0 {
+		return errors.New("config.SampleFraction can't be used with --sql or --named-query, which doesn't dump the tables")
+	}
+	return nil
+}
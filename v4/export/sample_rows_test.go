@@ -0,0 +1,91 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"hash/crc32"
+	"strconv"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+func (s *testUtilSuite) TestBuildSampleCondition(c *C) {
+	c.Assert(buildSampleCondition([]string{"id"}, 0.05), Equals, "CRC32(`id`) % 1000000 < 50000")
+	c.Assert(buildSampleCondition([]string{"a", "b`c"}, 0.5), Equals, "CRC32(CONCAT_WS(',',`a`,`b``c`)) % 1000000 < 500000")
+
+	// evaluate the condition of the integer keys like MySQL, which hashes their decimal strings
+	const rows = 100000
+	sampled := func(fraction float64) map[int]struct{} {
+		threshold := uint32(fraction * sampleFractionScale)
+		result := make(map[int]struct{})
+		for id := 1; id <= rows; id++ {
+			if crc32.ChecksumIEEE([]byte(strconv.Itoa(id)))%sampleFractionScale < threshold {
+				result[id] = struct{}{}
+			}
+		}
+		return result
+	}
+	for _, fraction := range []float64{0.01, 0.05, 0.3} {
+		first := sampled(fraction)
+		ratio := float64(len(first)) / rows
+		c.Assert(ratio > fraction*0.9 && ratio < fraction*1.1, IsTrue, Commentf("fraction %v, sampled %v", fraction, ratio))
+		// the same rows are selected again
+		c.Assert(sampled(fraction), DeepEquals, first)
+	}
+}
+
+func (s *testSQLSuite) TestDumpTableDataWithSampleFraction(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.SkipEstimate = true
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	conf.Rows = 50
+	conf.Where = "a > 0"
+	conf.SampleFraction = 0.05
+	c.Assert(adjustSampleFraction(conf), IsNil)
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "test", table: "t"}
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.columns").WithArgs("test", "t", "PRI").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+	mock.ExpectQuery("SELECT MIN\\(`id`\\),MAX\\(`id`\\) FROM `test`.`t` WHERE a > 0").
+		WillReturnRows(sqlmock.NewRows([]string{"MIN", "MAX"}).AddRow(1, 100))
+	mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("id", ""))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+
+	taskChan := make(chan Task, 16)
+	c.Assert(d.dumpTableData(tctx, conn, meta, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	var queries []string
+	for task := range taskChan {
+		queries = append(queries, task.(*TaskTableData).Data.(*tableData).query)
+	}
+	// the sample condition is combined with --where and the ranges of the chunks
+	c.Assert(queries, DeepEquals, []string{
+		"SELECT * FROM `test`.`t` WHERE (a > 0) AND (((`id` IS NULL OR (`id` >= 1 AND `id` < 51))) AND CRC32(`id`) % 1000000 < 50000) ORDER BY `id`",
+		"SELECT * FROM `test`.`t` WHERE (a > 0) AND (((`id` >= 51 AND `id` < 101)) AND CRC32(`id`) % 1000000 < 50000) ORDER BY `id`",
+	})
+
+	for _, fraction := range []float64{-0.1, 1.5} {
+		conf.SampleFraction = fraction
+		c.Assert(adjustSampleFraction(conf), ErrorMatches, "config.SampleFraction .* should be greater than 0 and at most 1")
+	}
+	conf.SampleFraction = 0.1
+	conf.SQL = "SELECT 1"
+	c.Assert(adjustSampleFraction(conf), ErrorMatches, "config.SampleFraction can't be used with --sql or --named-query.*")
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// parseSampleTables parses conf.SampleTables, which is the number of the tables like "10",
+// or the percentage of them like "5%"
+func parseSampleTables(sample string) (count int, percent float64, err error) {
+	if strings.HasSuffix(sample, "%") {
+		percent, err = strconv.ParseFloat(strings.TrimSuffix(sample, "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return 0, 0, errors.Errorf("config.SampleTables '%s' should be a percentage greater than 0%% and at most 100%%", sample)
+		}
+		return 0, percent, nil
+	}
+	count, err = strconv.Atoi(sample)
+	if err != nil || count <= 0 {
+		return 0, 0, errors.Errorf("config.SampleTables '%s' should be a positive number of tables or a percentage like '5%%'", sample)
+	}
+	return count, 0, nil
+}
+
+// adjustSampleTables checks conf.SampleTables
+func adjustSampleTables(conf *Config) error {
+	conf.SampleTables = strings.TrimSpace(conf.SampleTables)
+	if conf.SampleTables == "" {
+		return nil
+	}
+	if conf.SQL != "" || len(conf.NamedQueries) > 0 {
+		return errors.New("config.SampleTables can't be used with --sql or --named-query, which doesn't dump the tables")
+	}
+	_, _, err := parseSampleTables(conf.SampleTables)
+	return err
+}
+
+// sampleTables keeps a random subset of the base tables with conf.SampleTables. The tables are shuffled by
+// conf.SampleTablesSeed, so the same tables are selected from the same tables with the same seed. The seed is
+// set to a random one if it's 0. The views and the databases are kept.
+func sampleTables(tctx *tcontext.Context, conf *Config) {
+	if conf.SampleTables == "" {
+		return
+	}
+	count, percent, err := parseSampleTables(conf.SampleTables)
+	if err != nil {
+		// it's checked by adjustSampleTables
+		return
+	}
+	type sampledTable struct {
+		db    string
+		table *TableInfo
+	}
+	var candidates []sampledTable
+	dbTables := DatabaseTables{}
+	for dbName, tables := range conf.Tables {
+		dbTables[dbName] = make([]*TableInfo, 0, len(tables))
+		for _, table := range tables {
+			if table.Type == TableTypeBase {
+				candidates = append(candidates, sampledTable{db: dbName, table: table})
+			} else {
+				dbTables.AppendTable(dbName, table)
+			}
+		}
+	}
+	if percent > 0 {
+		count = int(math.Ceil(float64(len(candidates)) * percent / 100))
+	}
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+	// the tables are sorted before shuffling, so the selection only depends on the tables and the seed
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].db != candidates[j].db {
+			return candidates[i].db < candidates[j].db
+		}
+		return candidates[i].table.Name < candidates[j].table.Name
+	})
+	if conf.SampleTablesSeed == 0 {
+		conf.SampleTablesSeed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(conf.SampleTablesSeed))
+	rnd.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	for _, t := range candidates[:count] {
+		dbTables.AppendTable(t.db, t.table)
+	}
+	tctx.L().Info("dump a random subset of the tables", zap.String("sample", conf.SampleTables),
+		zap.Int64("seed", conf.SampleTablesSeed), zap.Int("tables", count), zap.Int("candidates", len(candidates)))
+	conf.Tables = dbTables
+}
+
+// sampledTableNames returns the base tables of tables as `db`.`table`, sorted by the names
+func sampledTableNames(tables DatabaseTables) []string {
+	var names []string
+	for dbName, infos := range tables {
+		for _, table := range infos {
+			if table.Type == TableTypeBase {
+				names = append(names, wrapBackTicks(escapeString(dbName))+"."+wrapBackTicks(escapeString(table.Name)))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testConfigSuite) TestAdjustSampleTables(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustSampleTables(conf), IsNil)
+	conf.SampleTables = " 10 "
+	c.Assert(adjustSampleTables(conf), IsNil)
+	c.Assert(conf.SampleTables, Equals, "10")
+	conf.SampleTables = "2.5%"
+	c.Assert(adjustSampleTables(conf), IsNil)
+	conf.SampleTables = "0"
+	c.Assert(adjustSampleTables(conf), ErrorMatches, "config.SampleTables '0' should be a positive number of tables.*")
+	conf.SampleTables = "101%"
+	c.Assert(adjustSampleTables(conf), ErrorMatches, "config.SampleTables '101%' should be a percentage.*")
+	conf.SampleTables = "10"
+	conf.SQL = "SELECT 1"
+	c.Assert(adjustSampleTables(conf), ErrorMatches, "config.SampleTables can't be used with --sql.*")
+}
+
+func (s *testConfigSuite) TestSampleTables(c *C) {
+	tables := DatabaseTables{}
+	for i := 0; i < 20; i++ {
+		tables.AppendTables("test", fmt.Sprintf("t%d", i))
+	}
+	tables.AppendViews("other", "v")
+
+	sample := func(sample string, seed int64) []string {
+		conf := defaultConfigForTest(c)
+		conf.Tables = DatabaseTables{}
+		conf.Tables.Merge(tables)
+		conf.SampleTables, conf.SampleTablesSeed = sample, seed
+		sampleTables(tcontext.Background(), conf)
+		// the views and the databases are kept
+		c.Assert(conf.Tables, HasLen, 2)
+		c.Assert(conf.Tables["other"], HasLen, 1)
+		c.Assert(conf.SampleTablesSeed, Not(Equals), int64(0))
+		return sampledTableNames(conf.Tables)
+	}
+
+	first := sample("5", 42)
+	c.Assert(first, HasLen, 5)
+	// the same tables are selected with the same seed
+	c.Assert(sample("5", 42), DeepEquals, first)
+	c.Assert(sample("5", 7), Not(DeepEquals), first)
+	// the percentage is rounded up
+	c.Assert(sample("12%", 42), HasLen, 3)
+	c.Assert(sample("100", 42), HasLen, 20)
+	c.Assert(sample("3", 0), HasLen, 3)
+}
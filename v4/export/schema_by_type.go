@@ -0,0 +1,52 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pingcap/errors"
+)
+
+// the directories of the schema files of each object type with Config.SplitSchemaByType
+const (
+	schemaDirDatabases = "databases"
+	schemaDirTables    = "tables"
+	// schemaDirViews also holds the placeholder tables of the views
+	schemaDirViews    = "views"
+	schemaDirTriggers = "triggers"
+	// schemaDirRoutines holds the stored procedures, the stored functions and the events
+	schemaDirRoutines  = "routines"
+	schemaDirSequences = "sequences"
+)
+
+var schemaDirs = []string{schemaDirDatabases, schemaDirTables, schemaDirViews, schemaDirTriggers, schemaDirRoutines, schemaDirSequences}
+
+// schemaFilePath puts the schema file fileName into dir of its object type with Config.SplitSchemaByType,
+// it returns fileName itself otherwise
+func schemaFilePath(conf *Config, dir, fileName string) string {
+	if !conf.SplitSchemaByType {
+		return fileName
+	}
+	return dir + "/" + fileName
+}
+
+// createSchemaDirs is an initialization step of Dumper.
+// The local storage doesn't create the directories of the files, so the directories of the object types are created ahead.
+func createSchemaDirs(d *Dumper) error {
+	conf := d.conf
+	if !conf.SplitSchemaByType || conf.NoSchemas {
+		return nil
+	}
+	dir, err := localOutputDir(conf)
+	if err != nil || dir == "" {
+		return err
+	}
+	for _, schemaDir := range schemaDirs {
+		if err = os.MkdirAll(filepath.Join(dir, schemaDir), 0o755); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
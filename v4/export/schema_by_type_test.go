@@ -0,0 +1,35 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"io/ioutil"
+	"path"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestWriteSchemaSplitByType(c *C) {
+	dir := c.MkDir()
+
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = dir
+	config.SplitSchemaByType = true
+	c.Assert(createSchemaDirs(&Dumper{conf: config}), IsNil)
+
+	writer := s.newWriter(config, c)
+	c.Assert(writer.WriteDatabaseMeta("test", "CREATE DATABASE `test`"), IsNil)
+	c.Assert(writer.WriteTableMeta("test", "t", "CREATE TABLE `t` (`a` int);\n"), IsNil)
+	c.Assert(writer.WriteViewMeta("test", "v", "CREATE TABLE `v` (`a` int);\n", "CREATE VIEW `v` AS SELECT `a` FROM `t`;\n"), IsNil)
+
+	for fileName, expected := range map[string]string{
+		"databases/test-schema-create.sql": "CREATE DATABASE `test`;\n",
+		"tables/test.t-schema.sql":         "CREATE TABLE `t` (`a` int);\n",
+		"views/test.v-schema.sql":          "CREATE TABLE `v` (`a` int);\n",
+		"views/test.v-schema-view.sql":     "CREATE VIEW `v` AS SELECT `a` FROM `t`;\n",
+	} {
+		bytes, err := ioutil.ReadFile(path.Join(dir, fileName))
+		c.Assert(err, IsNil, Commentf("file %s", fileName))
+		c.Assert(string(bytes), Equals, "/*!40101 SET NAMES binary*/;\n"+expected, Commentf("file %s", fileName))
+	}
+}
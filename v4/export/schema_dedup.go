@@ -0,0 +1,53 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+const schemaDedupManifestPath = "schema-dedup.json"
+
+// schemaDeduper records the table schema files which have been emitted.
+// A table whose `CREATE TABLE` is byte-identical to an emitted one is recorded in the manifest with the canonical
+// schema file, so the consumers can create the identical tables once. Its schema file is still written in full,
+// so every schema file can be restored on its own, with its foreign keys.
+type schemaDeduper struct {
+	// sha256 of create table sql -> canonical schema file
+	canonicalFiles map[[sha256.Size]byte]string
+	// duplicated schema file -> canonical schema file
+	DuplicatedFiles map[string]string `json:"duplicated_files"`
+}
+
+func newSchemaDeduper() *schemaDeduper {
+	return &schemaDeduper{
+		canonicalFiles:  make(map[[sha256.Size]byte]string),
+		DuplicatedFiles: make(map[string]string),
+	}
+}
+
+// dedup returns the canonical schema file and true if createSQL has been emitted before.
+// Otherwise, fileName is recorded as the canonical file of createSQL.
+func (s *schemaDeduper) dedup(fileName, createSQL string) (string, bool) {
+	key := sha256.Sum256([]byte(createSQL))
+	if canonical, ok := s.canonicalFiles[key]; ok {
+		s.DuplicatedFiles[fileName] = canonical
+		return canonical, true
+	}
+	s.canonicalFiles[key] = fileName
+	return fileName, false
+}
+
+func (s *schemaDeduper) writeManifest(tctx *tcontext.Context, extStore storage.ExternalStorage) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(extStore.WriteFile(tctx, schemaDedupManifestPath, data))
+}
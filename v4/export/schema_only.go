@@ -0,0 +1,44 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"encoding/json"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+const schemaOnlyManifestPath = "schema-only-tables.json"
+
+// schemaOnlyTable marks a table whose data is intentionally not dumped because of --no-data
+type schemaOnlyTable struct {
+	Database   string `json:"database"`
+	Table      string `json:"table"`
+	DataDumped bool   `json:"data_dumped"`
+	Rows       uint64 `json:"rows"`
+}
+
+// schemaOnlyRecorder records the tables dumped with schema only, so downstream tools
+// can tell tables which are intentionally empty from tables which are missed.
+type schemaOnlyRecorder struct {
+	Tables []schemaOnlyTable `json:"tables"`
+}
+
+func newSchemaOnlyRecorder() *schemaOnlyRecorder {
+	return &schemaOnlyRecorder{Tables: []schemaOnlyTable{}}
+}
+
+func (r *schemaOnlyRecorder) record(db, table string) {
+	r.Tables = append(r.Tables, schemaOnlyTable{Database: db, Table: table})
+}
+
+func (r *schemaOnlyRecorder) writeManifest(tctx *tcontext.Context, extStore storage.ExternalStorage) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(extStore.WriteFile(tctx, schemaOnlyManifestPath, data))
+}
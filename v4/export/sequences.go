@@ -0,0 +1,130 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+const (
+	// outputFileTemplateSequence is the output file template of the sequences
+	outputFileTemplateSequence = "sequence"
+	// tidbSequenceIDType is the ID_TYPE of the next value of a sequence in SHOW TABLE NEXT_ROW_ID of TiDB
+	tidbSequenceIDType = "SEQUENCE"
+)
+
+var (
+	tidbSequenceVersion    = semver.New("4.0.0")
+	mariaDBSequenceVersion = semver.New("10.3.0")
+)
+
+// serverHasSequences checks whether the server supports CREATE SEQUENCE, which are TiDB v4.0+ and MariaDB v10.3+
+func serverHasSequences(si ServerInfo) bool {
+	if si.ServerVersion == nil {
+		return false
+	}
+	switch si.ServerType {
+	case ServerTypeTiDB:
+		return si.ServerVersion.Compare(*tidbSequenceVersion) >= 0
+	case ServerTypeMariaDB:
+		return si.ServerVersion.Compare(*mariaDBSequenceVersion) >= 0
+	}
+	return false
+}
+
+// dumpSequences dumps the sequences of dbName which match Config.TableFilter. They're sent before the tables of
+// the database, so the tables whose columns default to the next values of the sequences are restored after them.
+func (d *Dumper) dumpSequences(tctx *tcontext.Context, metaConn *sql.Conn, dbName string, taskChan chan<- Task) error {
+	conf := d.conf
+	if conf.NoSchemas || !conf.DumpSequences || !conf.ServerInfo.HasSequences {
+		return nil
+	}
+	sequences, err := ListSequences(metaConn, dbName)
+	if err != nil {
+		return err
+	}
+	for _, name := range sequences {
+		if conf.TableFilter != nil && !conf.TableFilter.MatchTable(dbName, name) {
+			continue
+		}
+		createSQL, setValueSQL, err := ShowCreateSequence(metaConn, conf.ServerInfo.ServerType, dbName, name)
+		if err != nil {
+			return err
+		}
+		task := NewTaskSequenceMeta(dbName, name, createSQL, setValueSQL)
+		tctx.L().Debug("dump sequence", zap.String("task", task.Brief()))
+		if d.sendTaskToChan(tctx, task, taskChan) {
+			return tctx.Err()
+		}
+	}
+	return nil
+}
+
+// ListSequences returns the names of the sequences of database
+func ListSequences(db *sql.Conn, database string) ([]string, error) {
+	query := "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'SEQUENCE' ORDER BY TABLE_NAME"
+	var sequences []string
+	if err := simpleQueryWithArgs(db, func(rows *sql.Rows) error {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return errors.Trace(err)
+		}
+		sequences = append(sequences, name)
+		return nil
+	}, query, database); err != nil {
+		return nil, err
+	}
+	return sequences, nil
+}
+
+// ShowCreateSequence returns the statement to create the sequence, and the statement to set its value to the next
+// one which isn't allocated or cached yet. The cached values are skipped after restoring, but they're never reused.
+func ShowCreateSequence(db *sql.Conn, serverType ServerType, database, sequence string) (createSQL, setValueSQL string, err error) {
+	var oneRow [2]string
+	query := fmt.Sprintf("SHOW CREATE SEQUENCE `%s`.`%s`", escapeString(database), escapeString(sequence))
+	if err = simpleQuery(db, query, func(rows *sql.Rows) error {
+		return rows.Scan(&oneRow[0], &oneRow[1])
+	}); err != nil {
+		return "", "", errors.Annotatef(err, "sql: %s", query)
+	}
+	createSQL = oneRow[1]
+
+	var nextValue string
+	switch serverType {
+	case ServerTypeTiDB:
+		query = fmt.Sprintf("SHOW TABLE `%s`.`%s` NEXT_ROW_ID", escapeString(database), escapeString(sequence))
+		rows, err := db.QueryContext(context.Background(), query)
+		if err != nil {
+			return "", "", errors.Annotatef(err, "sql: %s", query)
+		}
+		results, err := GetSpecifiedColumnValuesAndClose(rows, "NEXT_GLOBAL_ROW_ID", "ID_TYPE")
+		if err != nil {
+			return "", "", errors.Annotatef(err, "sql: %s", query)
+		}
+		for _, result := range results {
+			if result[1] == tidbSequenceIDType {
+				nextValue = result[0]
+			}
+		}
+	case ServerTypeMariaDB:
+		query = fmt.Sprintf("SELECT NEXT_NOT_CACHED_VALUE FROM `%s`.`%s`", escapeString(database), escapeString(sequence))
+		if err = simpleQuery(db, query, func(rows *sql.Rows) error {
+			return rows.Scan(&nextValue)
+		}); err != nil {
+			return "", "", errors.Annotatef(err, "sql: %s", query)
+		}
+	}
+	if nextValue == "" {
+		return "", "", errors.Errorf("can't read the next value of sequence `%s`.`%s` by %s", database, sequence, query)
+	}
+	setValueSQL = fmt.Sprintf("SELECT SETVAL(`%s`,%s)", escapeString(sequence), nextValue)
+	return createSQL, setValueSQL, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coreos/go-semver/semver"
+	. "github.com/pingcap/check"
+	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+// testSequenceSQL is the same on TiDB and MariaDB
+const testSequenceSQL = "CREATE SEQUENCE `seq` start with 1 minvalue 1 maxvalue 9223372036854775806 " +
+	"increment by 1 cache 1000 nocycle ENGINE=InnoDB"
+
+func (s *testSQLSuite) TestDumpSequences(c *C) {
+	for _, t := range []struct {
+		serverType ServerType
+		expect     func(mock sqlmock.Sqlmock)
+	}{
+		{ServerTypeTiDB, func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("SHOW CREATE SEQUENCE `test`.`seq`").
+				WillReturnRows(sqlmock.NewRows([]string{"Sequence", "Create Sequence"}).AddRow("seq", testSequenceSQL))
+			mock.ExpectQuery("SHOW TABLE `test`.`seq` NEXT_ROW_ID").
+				WillReturnRows(sqlmock.NewRows([]string{"DB_NAME", "TABLE_NAME", "COLUMN_NAME", "NEXT_GLOBAL_ROW_ID", "ID_TYPE"}).
+					AddRow("test", "seq", "_tidb_rowid", "1", "_TIDB_ROWID").
+					AddRow("test", "seq", "", "2001", "SEQUENCE"))
+		}},
+		{ServerTypeMariaDB, func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("SHOW CREATE SEQUENCE `test`.`seq`").
+				WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("seq", testSequenceSQL))
+			mock.ExpectQuery("SELECT NEXT_NOT_CACHED_VALUE FROM `test`.`seq`").
+				WillReturnRows(sqlmock.NewRows([]string{"NEXT_NOT_CACHED_VALUE"}).AddRow("2001"))
+		}},
+	} {
+		comment := Commentf("server type %s", t.serverType)
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		c.Assert(err, IsNil)
+		tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+		conn, err := db.Conn(tctx)
+		c.Assert(err, IsNil)
+
+		conf := DefaultConfig()
+		conf.OutputDirPath = c.MkDir()
+		conf.ServerInfo = ServerInfo{ServerType: t.serverType}
+		d := &Dumper{tctx: tctx, conf: conf}
+
+		// the sequences aren't dumped from the servers without them
+		taskChan := make(chan Task, 4)
+		c.Assert(d.dumpSequences(tctx, conn, "test", taskChan), IsNil)
+		c.Assert(taskChan, HasLen, 0)
+
+		conf.ServerInfo.HasSequences = true
+		// the sequence which doesn't match the filter is skipped
+		mock.ExpectQuery("SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'SEQUENCE' ORDER BY TABLE_NAME").
+			WithArgs("test").WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME"}).AddRow("seq").AddRow("skipped_seq"))
+		t.expect(mock)
+		conf.TableFilter, err = filter.Parse([]string{"test.seq"})
+		c.Assert(err, IsNil)
+		c.Assert(d.dumpSequences(tctx, conn, "test", taskChan), IsNil)
+		close(taskChan)
+		c.Assert(mock.ExpectationsWereMet(), IsNil, comment)
+
+		extStore, err := conf.createExternalStorage(context.Background())
+		c.Assert(err, IsNil)
+		writer := NewWriter(tctx, 0, conf, conn, extStore)
+		var briefs []string
+		for task := range taskChan {
+			briefs = append(briefs, task.Brief())
+			c.Assert(writer.handleTask(task), IsNil)
+		}
+		c.Assert(briefs, DeepEquals, []string{"meta of sequence 'test'.'seq'"}, comment)
+		content, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, "test.seq-schema-sequence.sql"))
+		c.Assert(err, IsNil)
+		c.Assert(string(content), Equals, "/*!40101 SET NAMES binary*/;\n"+testSequenceSQL+";\nSELECT SETVAL(`seq`,2001);\n", comment)
+
+		cancel()
+		db.Close()
+	}
+}
+
+func (s *testSQLSuite) TestServerHasSequences(c *C) {
+	for _, t := range []struct {
+		serverType ServerType
+		version    string
+		expected   bool
+	}{
+		{ServerTypeTiDB, "4.0.0", true},
+		{ServerTypeTiDB, "3.0.20", false},
+		{ServerTypeMariaDB, "10.3.7", true},
+		{ServerTypeMariaDB, "10.2.40", false},
+		{ServerTypeMySQL, "8.0.26", false},
+	} {
+		si := ServerInfo{ServerType: t.serverType, ServerVersion: semver.New(t.version)}
+		c.Assert(serverHasSequences(si), Equals, t.expected, Commentf("%s %s", t.serverType, t.version))
+	}
+	c.Assert(serverHasSequences(ServerInfoUnknown), IsFalse)
+}
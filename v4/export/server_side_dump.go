@@ -0,0 +1,212 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// serverSideDumpCopyBufferSize is the buffer size to copy the files written by the server to the external storage
+const serverSideDumpCopyBufferSize = 1 << 20
+
+// checkServerSideDump is an initialization step of Dumper.
+// It checks whether the data can be dumped by `SELECT ... INTO OUTFILE`, and falls back to dump through the connection if not.
+func checkServerSideDump(d *Dumper) error {
+	conf := d.conf
+	if !conf.ServerSideDump {
+		return nil
+	}
+	reason := serverSideDumpUnsupportedReason(conf)
+	if reason == "" {
+		var dir string
+		dir, reason = secureFileDir(d.tctx, d.dbHandle)
+		if reason == "" {
+			d.serverSideDumpDir = dir
+			d.L().Info("dump data by SELECT ... INTO OUTFILE", zap.String("secure_file_priv", dir))
+			return nil
+		}
+	}
+	d.L().Warn("server side dump is unsupported, fall back to dump through the connection", zap.String("reason", reason))
+	return nil
+}
+
+// serverSideDumpUnsupportedReason returns why the configuration can't be dumped by `SELECT ... INTO OUTFILE`,
+// or "" if it can. The files written by the server are only copied, so any processing of the rows isn't supported.
+func serverSideDumpUnsupportedReason(conf *Config) string {
+	switch {
+	case conf.ServerInfo.ServerType != ServerTypeMySQL && conf.ServerInfo.ServerType != ServerTypeMariaDB:
+		return "the server isn't MySQL or MariaDB"
+	case !isLocalHost(conf.Host):
+		return fmt.Sprintf("the server at %s isn't on the local host", conf.Host)
+	case conf.FileType != FileFormatCSVString:
+		return "the output isn't csv"
+	case conf.SQL != "":
+		return "--sql is specified"
+	case len(conf.NamedQueries) > 0:
+		return "--named-query is specified"
+	case !conf.EscapeBackslash || conf.CsvNullValue != "\\N" || len(conf.CsvDelimiter) > 1:
+		return "the csv format can't be written by the server, backslash escapes, a single char delimiter and the null value `\\N` are required"
+	case conf.FileSize != UnspecifiedSize:
+		return "--filesize is specified"
+	case conf.BinarySafeStrings || binaryEncodingOf(conf) != BinaryEncodingRaw || conf.CsvInvalidUTF8 != "" || len(conf.OutputKeyColumns) > 0 || conf.ChunkMetadata:
+		return "the rows need to be processed by dumpling"
+	}
+	return ""
+}
+
+func isLocalHost(host string) bool {
+	switch strings.ToLower(host) {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+// secureFileDir returns the secure_file_priv directory of the server if it can be read by dumpling,
+// otherwise returns the reason why it can't be used
+func secureFileDir(tctx *tcontext.Context, db *sql.DB) (string, string) {
+	var dir sql.NullString
+	if err := db.QueryRowContext(tctx, "SELECT @@secure_file_priv").Scan(&dir); err != nil {
+		return "", fmt.Sprintf("fail to get secure_file_priv: %s", err)
+	}
+	if !dir.Valid {
+		return "", "secure_file_priv is NULL, which disables SELECT ... INTO OUTFILE"
+	}
+	if dir.String == "" {
+		return "", "secure_file_priv is empty, please set it to a directory dedicated to the exported files"
+	}
+	if info, err := os.Stat(dir.String); err != nil || !info.IsDir() {
+		return "", fmt.Sprintf("secure_file_priv %s isn't a directory accessible by dumpling", dir.String)
+	}
+	return dir.String, ""
+}
+
+// outfileOptions returns the export options of `SELECT ... INTO OUTFILE` which write the same csv format as dumpling
+func outfileOptions(conf *Config) string {
+	var bf strings.Builder
+	fmt.Fprintf(&bf, "CHARACTER SET binary FIELDS TERMINATED BY '%s'", escapeSQLString(conf.CsvSeparator))
+	if conf.CsvDelimiter != "" {
+		fmt.Fprintf(&bf, " OPTIONALLY ENCLOSED BY '%s'", escapeSQLString(conf.CsvDelimiter))
+	}
+	bf.WriteString(" ESCAPED BY '\\\\' LINES TERMINATED BY '\\n'")
+	return bf.String()
+}
+
+// dumpTableDataServerSide dumps a chunk into a file in the secure_file_priv directory by `SELECT ... INTO OUTFILE`,
+// then copies the file to the external storage
+func (w *Writer) dumpTableDataServerSide(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta, td *tableData, curChkIdx int) error {
+	conf, start := w.conf, time.Now()
+	namer := newOutputFileNamer(meta, curChkIdx, conf.chunked(meta.DatabaseName(), meta.TableName()), false)
+	namer.hashPrefixes = conf.HashPrefixFiles
+	namer.DB, namer.Table = outputIdentifier(conf, namer.DB), outputIdentifier(conf, namer.Table)
+	fileName, err := namer.NextName(conf.OutputFileTemplate, w.fileFmt.Extension())
+	if err != nil {
+		return err
+	}
+	serverFile := filepath.Join(w.serverSideDumpDir,
+		fmt.Sprintf("dumpling-%d-%s", os.Getpid(), strings.ReplaceAll(fileName, "/", "_")))
+	res, err := conn.ExecContext(tctx, fmt.Sprintf("%s INTO OUTFILE '%s' %s", td.query, escapeSQLString(serverFile), outfileOptions(conf)))
+	if err != nil {
+		return errors.Annotatef(err, "fail to dump table `%s`.`%s` into %s", meta.DatabaseName(), meta.TableName(), serverFile)
+	}
+	defer func() {
+		if err := os.Remove(serverFile); err != nil {
+			tctx.L().Warn("fail to remove the file written by the server", zap.String("path", serverFile), zap.Error(err))
+		}
+	}()
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if rows == 0 {
+		tctx.L().Warn("no data written in table chunk",
+			zap.String("database", meta.DatabaseName()),
+			zap.String("table", meta.TableName()),
+			zap.Int("chunkIdx", curChkIdx))
+		return nil
+	}
+
+	f, err := os.Open(serverFile)
+	if err != nil {
+		return errors.Annotatef(err, "fail to read the file written by the server")
+	}
+	defer f.Close()
+	fileWriter, tearDown := buildInterceptFileWriter(tctx, w.extStorage, fileName, conf.CompressType, conf.EnsureTrailingNewline)
+	dataWriter, checksumWriter := withStatsChecksum(conf, fileWriter)
+	err = copyServerSideFile(tctx, conf, meta, f, dataWriter)
+	tearDown(tctx)
+	if err != nil {
+		w.removePartialFile(fileName)
+		return err
+	}
+	w.catalog.addFile(meta.DatabaseName(), meta.TableName(), fileName+compressFileSuffix(conf.CompressType))
+	w.chunkCounts.addFile(meta, fileName+compressFileSuffix(conf.CompressType))
+	w.importInto.addTable(meta)
+	AddCounter(finishedRowsCounter, conf.Labels, float64(rows))
+	chunkStats := tableChunkStats{
+		rows:            uint64(rows),
+		bytes:           fileWriter.(*InterceptFileWriter).WrittenBytes,
+		compressedBytes: fileWriter.(*InterceptFileWriter).CompressedBytes,
+		checksum:        checksumWriter.sum(),
+		start:           start,
+		end:             time.Now(),
+	}
+	w.tableStats.add(meta.DatabaseName(), meta.TableName(), chunkStats)
+	w.chunkCounts.addStats(meta, chunkStats)
+	// the rows aren't read by Dumpling, so the primary keys can't be sampled
+	w.verification.add(meta, curChkIdx, w.subChunk, uint64(rows), nil)
+	tctx.L().Debug("finish dumping table(chunk) on server side",
+		zap.String("database", meta.DatabaseName()),
+		zap.String("table", meta.TableName()),
+		zap.Int("chunkIdx", curChkIdx),
+		zap.Int64("total rows", rows))
+	return nil
+}
+
+// copyServerSideFile copies the file written by the server to fileWriter, with the csv header if it's needed
+func copyServerSideFile(tctx *tcontext.Context, conf *Config, meta TableMeta, f io.Reader, fileWriter storage.ExternalFileWriter) error {
+	if !conf.NoHeader && len(meta.ColumnNames()) != 0 {
+		opt := &csvOption{nullValue: conf.CsvNullValue, separator: []byte(conf.CsvSeparator), delimiter: []byte(conf.CsvDelimiter)}
+		var bf bytes.Buffer
+		for i, col := range meta.ColumnNames() {
+			if i > 0 {
+				bf.Write(opt.separator)
+			}
+			bf.Write(opt.delimiter)
+			escapeCSV([]byte(col), &bf, conf.EscapeBackslash, opt)
+			bf.Write(opt.delimiter)
+		}
+		bf.WriteByte('\n')
+		if err := writeBytes(tctx, fileWriter, bf.Bytes()); err != nil {
+			return err
+		}
+	}
+	buf := make([]byte, serverSideDumpCopyBufferSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if err := writeBytes(tctx, fileWriter, buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+}
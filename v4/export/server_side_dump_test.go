@@ -0,0 +1,104 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func serverSideDumpConfigForTest(c *C) *Config {
+	conf := DefaultConfig()
+	conf.ServerSideDump = true
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	conf.FileType = FileFormatCSVString
+	conf.CsvSeparator = ","
+	conf.CsvDelimiter = "\""
+	conf.EscapeBackslash = true
+	c.Assert(adjustFileFormat(conf), IsNil)
+	return conf
+}
+
+func (s *testSQLSuite) TestCheckServerSideDump(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx := tcontext.Background().WithLogger(appLogger)
+	secureDir := c.MkDir()
+
+	conf := serverSideDumpConfigForTest(c)
+	d := &Dumper{tctx: tctx, conf: conf, dbHandle: db}
+	mock.ExpectQuery("SELECT @@secure_file_priv").WillReturnRows(sqlmock.NewRows([]string{"@@secure_file_priv"}).AddRow(secureDir))
+	c.Assert(checkServerSideDump(d), IsNil)
+	c.Assert(d.serverSideDumpDir, Equals, secureDir)
+
+	// fall back if secure_file_priv disables or doesn't restrict the exported files
+	for _, dir := range []interface{}{nil, "", path.Join(secureDir, "not-exist")} {
+		d = &Dumper{tctx: tctx, conf: conf, dbHandle: db}
+		mock.ExpectQuery("SELECT @@secure_file_priv").WillReturnRows(sqlmock.NewRows([]string{"@@secure_file_priv"}).AddRow(dir))
+		c.Assert(checkServerSideDump(d), IsNil)
+		c.Assert(d.serverSideDumpDir, Equals, "")
+	}
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the configurations which can't be dumped by the server are checked without querying
+	for _, adjust := range []func(*Config){
+		func(conf *Config) { conf.Host = "10.0.0.1" },
+		func(conf *Config) { conf.ServerInfo.ServerType = ServerTypeTiDB },
+		func(conf *Config) { conf.FileType = FileFormatSQLTextString },
+		func(conf *Config) { conf.CsvNullValue = "NULL" },
+		func(conf *Config) { conf.FileSize = 1 << 20 },
+		func(conf *Config) { conf.ChunkMetadata = true },
+	} {
+		conf = serverSideDumpConfigForTest(c)
+		adjust(conf)
+		c.Assert(serverSideDumpUnsupportedReason(conf), Not(Equals), "")
+		d = &Dumper{tctx: tctx, conf: conf, dbHandle: db}
+		c.Assert(checkServerSideDump(d), IsNil)
+		c.Assert(d.serverSideDumpDir, Equals, "")
+	}
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testWriterSuite) TestDumpTableDataServerSide(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	dir, secureDir := c.MkDir(), c.MkDir()
+
+	conf := serverSideDumpConfigForTest(c)
+	conf.OutputDirPath = dir
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	writer := NewWriter(tcontext.Background().WithLogger(appLogger), 0, conf, conn, extStore)
+	writer.tableStats = newTableStatsCollector()
+	writer.serverSideDumpDir = secureDir
+
+	meta := newMockTableIR("test", "t", nil, nil, []string{"INT", "VARCHAR"})
+	meta.colNames = []string{"id", "name"}
+	// the server writes the file when the statement is executed
+	serverFile := path.Join(secureDir, fmt.Sprintf("dumpling-%d-test.t.000000000.csv", os.Getpid()))
+	c.Assert(ioutil.WriteFile(serverFile, []byte("1,\"a\\\"b\"\n2,\\N\n"), 0o644), IsNil)
+	mock.ExpectExec(regexp.QuoteMeta("SELECT * FROM `test`.`t` INTO OUTFILE '" + serverFile + "' CHARACTER SET binary " +
+		"FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '\\\"' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n'")).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	c.Assert(writer.WriteTableData(meta, newTableData("SELECT * FROM `test`.`t`", 2, false), 0), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	data, err := ioutil.ReadFile(path.Join(dir, "test.t.000000000.csv"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "\"id\",\"name\"\n1,\"a\\\"b\"\n2,\\N\n")
+	_, err = os.Stat(serverFile)
+	c.Assert(os.IsNotExist(err), IsTrue)
+}
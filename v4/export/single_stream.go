@@ -0,0 +1,401 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// OutputModeFiles writes every schema and chunk into its own file
+	OutputModeFiles = "files"
+	// OutputModeSingle merges all the sql files into one stream, Config.SingleOutputFile
+	OutputModeSingle = "single"
+	// singleOutputStdout is the Config.SingleOutputFile to write the stream into stdout
+	singleOutputStdout      = "-"
+	defaultSingleOutputFile = "dump.sql"
+)
+
+// singleStreamStdout is where the stream is written if Config.SingleOutputFile is singleOutputStdout
+var singleStreamStdout io.Writer = os.Stdout
+
+// streamsToStdout returns whether the sql files are streamed into stdout, where the log isn't written then
+func streamsToStdout(conf *Config) bool {
+	return conf.OutputMode == OutputModeSingle && conf.SingleOutputFile == singleOutputStdout
+}
+
+// adjustOutputMode checks conf.OutputMode, and rejects the options which write the files out of the order of
+// the tasks or write them again
+func adjustOutputMode(conf *Config) error {
+	conf.OutputMode = strings.ToLower(conf.OutputMode)
+	switch conf.OutputMode {
+	case "", OutputModeFiles:
+		return nil
+	case OutputModeSingle:
+	default:
+		return errors.Errorf("unknown config.OutputMode '%s', please use '%s' or '%s'", conf.OutputMode, OutputModeFiles, OutputModeSingle)
+	}
+	switch {
+	case conf.FileType != FileFormatSQLTextString:
+		return errors.Errorf("config.OutputMode '%s' only supports sql files, but config.FileType is '%s'", conf.OutputMode, conf.FileType)
+	case conf.SingleOutputFile == "":
+		return errors.Errorf("config.OutputMode '%s' requires config.SingleOutputFile", conf.OutputMode)
+	case conf.CompressType != CompressNone:
+		return errors.New("config.CompressType can't be used with config.OutputMode 'single', the stream is written uncompressed")
+	case conf.OutputFIFO != "":
+		return errors.New("config.OutputFIFO can't be used with config.OutputMode 'single'")
+	case conf.ChunkTimeout > 0:
+		return errors.New("config.ChunkTimeout can't be used with config.OutputMode 'single', the sub-chunks are written out of the order of the tasks")
+	case conf.VerifyChunkCount:
+		return errors.New("config.VerifyChunkCount can't be used with config.OutputMode 'single', the tables streamed can't be written again")
+	case conf.Checkpoint != "":
+		return errors.New("config.Checkpoint can't be used with config.OutputMode 'single', the stream can't be resumed")
+	}
+	return nil
+}
+
+// singleStream merges the sql files written by the writers into one stream in the order the tasks are sent.
+// The writers still run the queries and write the files concurrently: the files of each task are buffered in
+// temporary files, and the buffered tasks are appended to the stream as soon as all the tasks before them are done.
+// The special comments at the head of the files like SET NAMES are written once, and USE statements are added
+// when the database changes, so the stream can be piped into the mysql client.
+type singleStream struct {
+	conf   *Config
+	sink   storage.ExternalFileWriter
+	tmpDir string
+
+	mu       sync.Mutex
+	seqs     map[Task]int
+	segments map[int]*streamSegment
+	nextSeq  int
+	// next is the sequence number of the next segment to write into sink, and flushing is true while a writer
+	// is writing the segments into sink, then the other writers don't wait for it
+	next     int
+	flushing bool
+
+	// db and headers are only accessed by the writer flushing
+	db      string
+	headers map[string]struct{}
+}
+
+// streamSegment is the sql files written for a task
+type streamSegment struct {
+	db string
+	// createsDB is true for the database schema, which is written before the database can be used
+	createsDB bool
+	files     []*segmentFile
+	done      bool
+}
+
+type segmentFile struct {
+	name string
+	file *os.File
+	buf  *bufio.Writer
+}
+
+func newSingleStream(tctx *tcontext.Context, conf *Config, extStore storage.ExternalStorage) (*singleStream, error) {
+	tmpDir, err := ioutil.TempDir("", "dumpling-single-output-")
+	if err != nil {
+		return nil, errors.Annotate(err, "fail to create the directory to buffer the single output")
+	}
+	s := &singleStream{
+		conf:     conf,
+		tmpDir:   tmpDir,
+		seqs:     make(map[Task]int),
+		segments: make(map[int]*streamSegment),
+		headers:  make(map[string]struct{}),
+	}
+	if conf.SingleOutputFile == singleOutputStdout {
+		s.sink = &stdoutFileWriter{buf: bufio.NewWriter(singleStreamStdout)}
+	} else if s.sink, err = extStore.Create(tctx, conf.SingleOutputFile); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, errors.Annotatef(err, "fail to create single output file %s", conf.SingleOutputFile)
+	}
+	tctx.L().Info("merge the sql files into a single output", zap.String("file", conf.SingleOutputFile))
+	return s, nil
+}
+
+// register assigns the next sequence number to task, it's called in the order the tasks are sent to the writers
+func (s *singleStream) register(task Task) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registerLocked(task)
+}
+
+func (s *singleStream) registerLocked(task Task) *streamSegment {
+	seg := &streamSegment{}
+	switch t := task.(type) {
+	case *TaskDatabaseMeta:
+		seg.db, seg.createsDB = t.DatabaseName, true
+	case *TaskTableMeta:
+		seg.db = t.DatabaseName
+	case *TaskViewMeta:
+		seg.db = t.DatabaseName
+	case *TaskTriggerMeta:
+		seg.db = t.DatabaseName
+	case *TaskRoutineMeta:
+		seg.db = t.DatabaseName
+	case *TaskSequenceMeta:
+		seg.db = t.DatabaseName
+	case *TaskTableData:
+		seg.db = t.Meta.DatabaseName()
+	}
+	s.seqs[task] = s.nextSeq
+	s.segments[s.nextSeq] = seg
+	s.nextSeq++
+	return seg
+}
+
+// segment returns the segment of task, the tasks not registered are appended to the stream
+func (s *singleStream) segment(task Task) *streamSegment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq, ok := s.seqs[task]; ok {
+		delete(s.seqs, task)
+		return s.segments[seq]
+	}
+	return s.registerLocked(task)
+}
+
+// createFile creates the file name in seg. The file written again by a retry replaces the one written before.
+func (s *singleStream) createFile(seg *streamSegment, name string) (*segmentFile, error) {
+	for _, f := range seg.files {
+		if f.name != name {
+			continue
+		}
+		f.buf.Reset(f.file)
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return nil, errors.Trace(err)
+		}
+		return f, errors.Trace(f.file.Truncate(0))
+	}
+	file, err := ioutil.TempFile(s.tmpDir, "segment-")
+	if err != nil {
+		return nil, errors.Annotatef(err, "fail to buffer %s for the single output", name)
+	}
+	f := &segmentFile{name: name, file: file, buf: bufio.NewWriter(file)}
+	seg.files = append(seg.files, f)
+	return f, nil
+}
+
+// finish marks seg done and writes the segments done in order into the stream
+func (s *singleStream) finish(tctx *tcontext.Context, seg *streamSegment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seg.done = true
+	if s.flushing {
+		return nil
+	}
+	s.flushing = true
+	defer func() {
+		s.flushing = false
+	}()
+	for {
+		next, ok := s.segments[s.next]
+		if !ok || !next.done {
+			return nil
+		}
+		delete(s.segments, s.next)
+		s.next++
+		s.mu.Unlock()
+		err := s.writeSegment(tctx, next)
+		s.mu.Lock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *singleStream) writeSegment(tctx *tcontext.Context, seg *streamSegment) error {
+	w := &sinkWriter{ctx: tctx, w: s.sink}
+	if len(seg.files) > 0 && !seg.createsDB && seg.db != "" && seg.db != s.db {
+		if _, err := io.WriteString(w, "USE "+quoteIdentifier(s.conf.IdentifierQuote, seg.db)+";\n"); err != nil {
+			return errors.Trace(err)
+		}
+		s.db = seg.db
+	}
+	for _, f := range seg.files {
+		err := s.writeFile(w, f)
+		f.file.Close()
+		os.Remove(f.file.Name())
+		if err != nil {
+			return errors.Annotatef(err, "fail to write %s into single output %s", f.name, s.conf.SingleOutputFile)
+		}
+	}
+	return nil
+}
+
+// writeFile copies f into w. The comments at the head of f are kept, but each special comment like SET NAMES
+// is only written the first time.
+func (s *singleStream) writeFile(w io.Writer, f *segmentFile) error {
+	if err := f.buf.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+	r := bufio.NewReader(f.file)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return errors.Trace(err)
+		}
+		header := strings.TrimSpace(line)
+		isSpecCmt := strings.HasPrefix(header, "/*") && strings.HasSuffix(header, "*/;")
+		if _, seen := s.headers[header]; !isSpecCmt || !seen {
+			if _, werr := io.WriteString(w, line); werr != nil {
+				return errors.Trace(werr)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if isSpecCmt {
+			s.headers[header] = struct{}{}
+		} else if !strings.HasPrefix(header, "--") {
+			break
+		}
+	}
+	_, err := io.Copy(w, r)
+	return errors.Trace(err)
+}
+
+// close writes the segments left and closes the stream. It should be called after all the writers exit.
+func (s *singleStream) close(tctx *tcontext.Context) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	left := len(s.segments)
+	s.mu.Unlock()
+	if left > 0 {
+		return errors.Errorf("%d tasks aren't written into single output %s", left, s.conf.SingleOutputFile)
+	}
+	return errors.Trace(s.sink.Close(tctx))
+}
+
+// cleanup removes the files buffered
+func (s *singleStream) cleanup() {
+	if s == nil {
+		return
+	}
+	os.RemoveAll(s.tmpDir)
+}
+
+// storage returns the storage of a writer, which buffers the sql files of the task being written into the stream.
+// The other files like the sidecars are written into base.
+func (s *singleStream) storage(base storage.ExternalStorage) *streamStorage {
+	if s == nil {
+		return nil
+	}
+	return &streamStorage{ExternalStorage: base, stream: s}
+}
+
+type streamStorage struct {
+	storage.ExternalStorage
+	stream *singleStream
+	seg    *streamSegment
+}
+
+// begin starts to buffer the files of task
+func (s *streamStorage) begin(task Task) {
+	if s == nil {
+		return
+	}
+	s.seg = s.stream.segment(task)
+}
+
+// finish writes the files of the task into the stream if the tasks before it are done
+func (s *streamStorage) finish(tctx *tcontext.Context) error {
+	if s == nil || s.seg == nil {
+		return nil
+	}
+	seg := s.seg
+	s.seg = nil
+	return s.stream.finish(tctx, seg)
+}
+
+func (s *streamStorage) buffered(name string) bool {
+	return s.seg != nil && strings.HasSuffix(name, "."+FileFormatSQLTextString)
+}
+
+// Create implements ExternalStorage.Create
+func (s *streamStorage) Create(ctx context.Context, name string) (storage.ExternalFileWriter, error) {
+	if !s.buffered(name) {
+		return s.ExternalStorage.Create(ctx, name)
+	}
+	f, err := s.stream.createFile(s.seg, name)
+	if err != nil {
+		return nil, err
+	}
+	return &segmentFileWriter{f: f}, nil
+}
+
+// WriteFile implements ExternalStorage.WriteFile
+func (s *streamStorage) WriteFile(ctx context.Context, name string, data []byte) error {
+	if !s.buffered(name) {
+		return s.ExternalStorage.WriteFile(ctx, name, data)
+	}
+	f, err := s.stream.createFile(s.seg, name)
+	if err != nil {
+		return err
+	}
+	_, err = f.buf.Write(data)
+	return errors.Trace(err)
+}
+
+type segmentFileWriter struct {
+	f *segmentFile
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *segmentFileWriter) Write(_ context.Context, p []byte) (int, error) {
+	n, err := w.f.buf.Write(p)
+	return n, errors.Trace(err)
+}
+
+// Close implements ExternalFileWriter.Close. The file is kept until it's written into the stream.
+func (w *segmentFileWriter) Close(_ context.Context) error {
+	return errors.Trace(w.f.buf.Flush())
+}
+
+// stdoutFileWriter writes the stream into stdout
+type stdoutFileWriter struct {
+	buf *bufio.Writer
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *stdoutFileWriter) Write(_ context.Context, p []byte) (int, error) {
+	n, err := w.buf.Write(p)
+	return n, errors.Trace(err)
+}
+
+// Close implements ExternalFileWriter.Close
+func (w *stdoutFileWriter) Close(_ context.Context) error {
+	return errors.Trace(w.buf.Flush())
+}
+
+// sinkWriter adapts an ExternalFileWriter to io.Writer
+type sinkWriter struct {
+	ctx context.Context
+	w   storage.ExternalFileWriter
+}
+
+func (w *sinkWriter) Write(p []byte) (int, error) {
+	return w.w.Write(w.ctx, p)
+}
@@ -0,0 +1,223 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	. "github.com/pingcap/check"
+	pclog "github.com/pingcap/log"
+	"golang.org/x/sync/errgroup"
+)
+
+func (s *testWriterSuite) TestAdjustOutputMode(c *C) {
+	conf := defaultConfigForTest(c)
+	c.Assert(adjustOutputMode(conf), IsNil)
+	conf.OutputMode = "Single"
+	c.Assert(adjustOutputMode(conf), IsNil)
+	c.Assert(conf.OutputMode, Equals, OutputModeSingle)
+
+	conf.CompressType = CompressGzip
+	c.Assert(adjustOutputMode(conf), ErrorMatches, "config.CompressType can't be used with config.OutputMode 'single'.*")
+	conf.CompressType = CompressNone
+	conf.FileType = FileFormatCSVString
+	c.Assert(adjustOutputMode(conf), ErrorMatches, "config.OutputMode 'single' only supports sql files, but config.FileType is 'csv'")
+	conf.FileType = FileFormatSQLTextString
+	conf.SingleOutputFile = ""
+	c.Assert(adjustOutputMode(conf), ErrorMatches, "config.OutputMode 'single' requires config.SingleOutputFile")
+	conf.OutputMode = "tar"
+	c.Assert(adjustOutputMode(conf), ErrorMatches, "unknown config.OutputMode 'tar'.*")
+}
+
+// singleOutputTestTasks returns the tasks of two databases, a table split into chunks and a view
+func singleOutputTestTasks() []Task {
+	specCmts := []string{"/*!40101 SET NAMES binary*/;"}
+	chunk := func(db, table string, idx, total int, rows ...[]driver.Value) Task {
+		ir := newMockTableIR(db, table, rows, specCmts, []string{"INT", "VARCHAR"})
+		return NewTaskTableData(ir, ir, idx, total)
+	}
+	return []Task{
+		NewTaskDatabaseMeta("test", "CREATE DATABASE `test`"),
+		NewTaskTableMeta("test", "t", "CREATE TABLE `t` (`a` int, `b` varchar(10))"),
+		chunk("test", "t", 0, 3, []driver.Value{1, "a;b"}, []driver.Value{2, "it's"}),
+		chunk("test", "t", 1, 3, []driver.Value{3, nil}),
+		chunk("test", "t", 2, 3, []driver.Value{4, "--d"}),
+		NewTaskDatabaseMeta("other", "CREATE DATABASE `other`"),
+		NewTaskTableMeta("other", "u", "CREATE TABLE `u` (`a` int, `b` varchar(10))"),
+		chunk("other", "u", 0, 1, []driver.Value{5, "e"}),
+		NewTaskViewMeta("test", "v", "CREATE TABLE `v` (`a` int)", "DROP TABLE IF EXISTS `v`;\nCREATE VIEW `v` AS SELECT `a` FROM `t`"),
+	}
+}
+
+// restoredStatements splits the sql into the statements executed by the mysql client, each prefixed by the database
+// used. The session statements like SET NAMES are counted instead.
+func restoredStatements(c *C, db string, sql []byte, stmts *[]string, sessionStmts map[string]int) {
+	splitter := sqlStatementSplitter{}
+	fn := func(stmt string) error {
+		switch {
+		case hasPrefixFold(stmt, "USE "):
+			db = strings.Trim(stmt[len("USE "):], "`")
+		case isSessionStatement(stmt):
+			sessionStmts[stmt]++
+		case hasPrefixFold(stmt, "CREATE DATABASE "):
+			// it doesn't depend on the database used
+			*stmts = append(*stmts, ": "+stmt)
+		default:
+			*stmts = append(*stmts, db+": "+stmt)
+		}
+		return nil
+	}
+	c.Assert(splitter.feed(sql, fn), IsNil)
+	c.Assert(splitter.finish(fn), IsNil)
+}
+
+func (s *testWriterSuite) TestSingleOutputRestoresLikeFiles(c *C) {
+	// the files restored one by one in the order of the tasks, the database is used by the restore tool
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	writer := s.newWriter(conf, c)
+	for _, task := range singleOutputTestTasks() {
+		c.Assert(writer.handleTask(task), IsNil)
+	}
+	var expected []string
+	for _, file := range []string{
+		"test-schema-create.sql", "test.t-schema.sql", "test.t.000000000.sql", "test.t.000000001.sql", "test.t.000000002.sql",
+		"other-schema-create.sql", "other.u-schema.sql", "other.u.000000000.sql",
+		"test.v-schema.sql", "test.v-schema-view.sql",
+	} {
+		data, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, file))
+		c.Assert(err, IsNil)
+		restoredStatements(c, strings.SplitN(file, ".", 2)[0], data, &expected, map[string]int{})
+	}
+
+	// the single output written by the writers in parallel restores the same statements
+	conf = defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.OutputMode = OutputModeSingle
+	c.Assert(adjustOutputMode(conf), IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	extStore, err := conf.createExternalStorage(tctx)
+	c.Assert(err, IsNil)
+	stream, err := newSingleStream(tctx, conf, extStore)
+	c.Assert(err, IsNil)
+	defer stream.cleanup()
+	taskChan := make(chan Task, 16)
+	for _, task := range singleOutputTestTasks() {
+		stream.register(task)
+		taskChan <- task
+	}
+	close(taskChan)
+	wg := new(errgroup.Group)
+	for i := 0; i < 3; i++ {
+		writer := s.newWriter(conf, c)
+		writer.stream = stream.storage(writer.extStorage)
+		writer.extStorage = writer.stream
+		wg.Go(func() error {
+			return writer.run(taskChan)
+		})
+	}
+	c.Assert(wg.Wait(), IsNil)
+	c.Assert(stream.close(tctx), IsNil)
+
+	data, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, defaultSingleOutputFile))
+	c.Assert(err, IsNil)
+	var restored []string
+	sessionStmts := make(map[string]int)
+	restoredStatements(c, "", data, &restored, sessionStmts)
+	c.Assert(restored, DeepEquals, expected)
+	c.Assert(sessionStmts, DeepEquals, map[string]int{"/*!40101 SET NAMES binary*/": 1})
+	c.Assert(strings.HasPrefix(string(data), "/*!40101 SET NAMES binary*/;\nCREATE DATABASE `test`;\nUSE `test`;\n"), IsTrue)
+	// only the single output is written
+	files, err := ioutil.ReadDir(conf.OutputDirPath)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+}
+
+func (s *testWriterSuite) TestSingleOutputInOrderOfTasks(c *C) {
+	conf := defaultConfigForTest(c)
+	conf.OutputMode = OutputModeSingle
+	conf.SingleOutputFile = singleOutputStdout
+	var stdout bytes.Buffer
+	singleStreamStdout = &stdout
+	defer func() {
+		singleStreamStdout = os.Stdout
+	}()
+	tctx := tcontext.Background().WithLogger(appLogger)
+	stream, err := newSingleStream(tctx, conf, nil)
+	c.Assert(err, IsNil)
+	defer stream.cleanup()
+
+	tasks := []Task{NewTaskTableMeta("test", "t1", ""), NewTaskTableMeta("test", "t2", ""), NewTaskTableMeta("test", "t3", "")}
+	for _, task := range tasks {
+		stream.register(task)
+	}
+	write := func(task Task, name, content string) {
+		w := stream.storage(nil)
+		w.begin(task)
+		c.Assert(w.WriteFile(tctx, name, []byte(content)), IsNil)
+		c.Assert(w.finish(tctx), IsNil)
+	}
+	// the later tasks are buffered until the tasks before them are done
+	write(tasks[2], "t3.sql", "/*!40101 SET NAMES binary*/;\nINSERT INTO `t3` VALUES (3);\n")
+	write(tasks[1], "t2.sql", "/*!40101 SET NAMES binary*/;\nINSERT INTO `t2` VALUES (2);\n")
+	c.Assert(stream.sink.(*stdoutFileWriter).buf.Buffered(), Equals, 0)
+	// a retry replaces the file written before
+	w := stream.storage(nil)
+	w.begin(tasks[0])
+	c.Assert(w.WriteFile(tctx, "t1.sql", []byte("INSERT INTO `t1` VALUES (0);\n")), IsNil)
+	c.Assert(w.WriteFile(tctx, "t1.sql", []byte("-- t1\n/*!40101 SET NAMES binary*/;\nINSERT INTO `t1` VALUES (1);\n")), IsNil)
+	c.Assert(w.finish(tctx), IsNil)
+	c.Assert(stream.close(tctx), IsNil)
+	c.Assert(stdout.String(), Equals, "USE `test`;\n-- t1\n/*!40101 SET NAMES binary*/;\nINSERT INTO `t1` VALUES (1);\n"+
+		"INSERT INTO `t2` VALUES (2);\nINSERT INTO `t3` VALUES (3);\n")
+}
+
+func (s *testWriterSuite) TestSingleOutputToStdoutLogsToStderr(c *C) {
+	dir := c.MkDir()
+	stdout, err := os.Create(path.Join(dir, "stdout"))
+	c.Assert(err, IsNil)
+	defer stdout.Close()
+	stderr, err := os.Create(path.Join(dir, "stderr"))
+	c.Assert(err, IsNil)
+	defer stderr.Close()
+	oldStdout, oldStderr, oldLogger := os.Stdout, os.Stderr, pclog.L()
+	os.Stdout, os.Stderr, singleStreamStdout = stdout, stderr, stdout
+	defer func() {
+		os.Stdout, os.Stderr, singleStreamStdout = oldStdout, oldStderr, oldStdout
+		pclog.ReplaceGlobals(oldLogger, nil)
+	}()
+
+	conf := defaultConfigForTest(c)
+	conf.OutputMode = OutputModeSingle
+	conf.SingleOutputFile = singleOutputStdout
+	conf.LogLevel = "info"
+	d := &Dumper{tctx: tcontext.Background(), conf: conf}
+	c.Assert(initLogger(d), IsNil)
+	tctx := d.tctx
+	stream, err := newSingleStream(tctx, conf, nil)
+	c.Assert(err, IsNil)
+	defer stream.cleanup()
+	task := NewTaskTableMeta("test", "t", "")
+	stream.register(task)
+	w := stream.storage(nil)
+	w.begin(task)
+	c.Assert(w.WriteFile(tctx, "test.t.000000000.sql", []byte("/*!40101 SET NAMES binary*/;\nINSERT INTO `t` VALUES (1);\n")), IsNil)
+	c.Assert(w.finish(tctx), IsNil)
+	c.Assert(stream.close(tctx), IsNil)
+	_ = tctx.L().Sync()
+
+	// stdout only has the sql, and the log is written into stderr
+	out, err := ioutil.ReadFile(stdout.Name())
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "USE `test`;\n/*!40101 SET NAMES binary*/;\nINSERT INTO `t` VALUES (1);\n")
+	logs, err := ioutil.ReadFile(stderr.Name())
+	c.Assert(err, IsNil)
+	c.Assert(string(logs), Matches, "(?s).*merge the sql files into a single output.*")
+}
@@ -0,0 +1,196 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// isSkippedColumnType checks whether the data type of a column is one of skipTypes.
+// BLOB and TEXT also match their TINY, MEDIUM and LONG variants.
+func isSkippedColumnType(dataType string, skipTypes []string) bool {
+	dataType = strings.ToUpper(dataType)
+	for _, tp := range skipTypes {
+		if dataType == tp {
+			return true
+		}
+		if tp == "BLOB" || tp == "TEXT" {
+			for _, prefix := range []string{"TINY", "MEDIUM", "LONG"} {
+				if dataType == prefix+tp {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func skippedColumnsOf(meta TableMeta) []string {
+	if tm, ok := meta.(*tableMeta); ok {
+		return tm.skippedColumns
+	}
+	return nil
+}
+
+// buildSelectFieldSkippingTypes is like buildSelectField, but the columns of skipTypes aren't selected.
+// It also returns the skipped columns, the fields are always listed if any column is skipped.
+func buildSelectFieldSkippingTypes(db *sql.Conn, dbName, tableName string, completeInsert bool, skipTypes []string) (string, []string, error) { // revive:disable-line:flag-parameter
+	query := `SELECT COLUMN_NAME,DATA_TYPE,EXTRA FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA=? AND TABLE_NAME=? ORDER BY ORDINAL_POSITION;`
+	rows, err := db.QueryContext(context.Background(), query, dbName, tableName)
+	if err != nil {
+		return "", nil, errors.Annotatef(err, "sql: %s", query)
+	}
+	defer rows.Close()
+	var (
+		availableFields   []string
+		skipped           []string
+		hasGenerateColumn bool
+		fieldName         string
+		dataType          string
+		extra             string
+	)
+	for rows.Next() {
+		err = rows.Scan(&fieldName, &dataType, &extra)
+		if err != nil {
+			return "", nil, errors.Annotatef(err, "sql: %s", query)
+		}
+		switch extra {
+		case "STORED GENERATED", "VIRTUAL GENERATED":
+			hasGenerateColumn = true
+			continue
+		}
+		if isSkippedColumnType(dataType, skipTypes) {
+			skipped = append(skipped, fieldName)
+			continue
+		}
+		availableFields = append(availableFields, wrapBackTicks(escapeString(fieldName)))
+	}
+	if err = rows.Err(); err != nil {
+		return "", nil, errors.Annotatef(err, "sql: %s", query)
+	}
+	if len(skipped) > 0 && len(availableFields) == 0 {
+		return "", nil, errors.Errorf("all the columns of table `%s`.`%s` are skipped by their types %s, please exclude the table instead",
+			dbName, tableName, strings.Join(skipTypes, ","))
+	}
+	if completeInsert || hasGenerateColumn || len(skipped) > 0 {
+		return strings.Join(availableFields, ","), skipped, nil
+	}
+	return "*", nil, nil
+}
+
+// dropColumnsFromCreateTable drops the definitions of columns from createTableSQL, together with the indexes,
+// constraints and generated columns referring to them
+func dropColumnsFromCreateTable(createTableSQL string, columns []string) string {
+	// hide the quoted identifiers and strings, so the commas and parentheses in them aren't parsed
+	var literals []string
+	stmt := quotedLiteralPattern.ReplaceAllStringFunc(createTableSQL, func(literal string) string {
+		literals = append(literals, literal)
+		return fmt.Sprintf("\x00%d\x00", len(literals)-1)
+	})
+	start := strings.IndexByte(stmt, '(')
+	end := closingParenIndex(stmt)
+	if start < 0 || end < 0 {
+		return createTableSQL
+	}
+
+	dropped := make(map[string]struct{}, len(columns))
+	for _, col := range columns {
+		dropped[wrapBackTicks(escapeString(col))] = struct{}{}
+	}
+	// refersDropped checks whether the definition refers to a dropped column, except the first identifier if skipFirst
+	refersDropped := func(def string, skipFirst bool) bool {
+		for i, m := range placeholderRegexp.FindAllString(def, -1) {
+			if i == 0 && skipFirst {
+				continue
+			}
+			if _, ok := dropped[literals[placeholderIndex(m)]]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	defs := splitDefinitions(stmt[start+1 : end])
+	isColumn := make([]bool, len(defs))
+	for i, def := range defs {
+		isColumn[i] = strings.HasPrefix(strings.TrimSpace(def), "\x00")
+	}
+	// the generated columns may refer to each other, so they are dropped until no more column is dropped
+	keep := make([]bool, len(defs))
+	for i := range keep {
+		keep[i] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for i, def := range defs {
+			if !keep[i] || !isColumn[i] {
+				continue
+			}
+			name := literals[placeholderIndex(placeholderRegexp.FindString(def))]
+			if _, ok := dropped[name]; ok || refersDropped(def, true) {
+				dropped[name] = struct{}{}
+				keep[i] = false
+				changed = true
+			}
+		}
+	}
+	kept := make([]string, 0, len(defs))
+	for i, def := range defs {
+		if !keep[i] {
+			continue
+		}
+		if !isColumn[i] {
+			// only the key parts refer to the columns of the table, not the index name or the referenced table
+			key := def
+			if idx := strings.IndexByte(key, '('); idx >= 0 {
+				key = key[idx:]
+			}
+			if idx := strings.Index(strings.ToUpper(key), " REFERENCES "); idx >= 0 {
+				key = key[:idx]
+			}
+			if refersDropped(key, false) {
+				continue
+			}
+		}
+		kept = append(kept, def)
+	}
+	stmt = stmt[:start+1] + strings.Join(kept, ",") + "\n" + stmt[end:]
+	return placeholderRegexp.ReplaceAllStringFunc(stmt, func(placeholder string) string {
+		return literals[placeholderIndex(placeholder)]
+	})
+}
+
+func placeholderIndex(placeholder string) int {
+	idx, _ := strconv.Atoi(strings.Trim(placeholder, "\x00"))
+	return idx
+}
+
+// splitDefinitions splits the definitions in the parentheses of CREATE TABLE by the commas at the top level,
+// the trailing newline of the last definition is trimmed
+func splitDefinitions(body string) []string {
+	var (
+		defs  []string
+		depth int
+		from  int
+	)
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				defs = append(defs, body[from:i])
+				from = i + 1
+			}
+		}
+	}
+	defs = append(defs, strings.TrimRight(body[from:], "\n"))
+	return defs
+}
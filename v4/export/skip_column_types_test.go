@@ -0,0 +1,81 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestBuildSelectFieldSkippingTypes(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	skipTypes := []string{"BLOB", "TEXT", "JSON"}
+
+	mock.ExpectQuery("SELECT COLUMN_NAME,DATA_TYPE,EXTRA").
+		WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "extra"}).
+			AddRow("id", "int", "").AddRow("doc", "json", "").AddRow("body", "mediumtext", "").
+			AddRow("g", "int", "VIRTUAL GENERATED").AddRow("quo`te", "varchar", "").AddRow("img", "longblob", ""))
+	selectedField, skipped, err := buildSelectFieldSkippingTypes(conn, "test", "t", false, skipTypes)
+	c.Assert(err, IsNil)
+	c.Assert(selectedField, Equals, "`id`,`quo``te`")
+	c.Assert(skipped, DeepEquals, []string{"doc", "body", "img"})
+
+	// nothing is skipped
+	mock.ExpectQuery("SELECT COLUMN_NAME,DATA_TYPE,EXTRA").
+		WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "extra"}).
+			AddRow("id", "int", "").AddRow("name", "varchar", ""))
+	selectedField, skipped, err = buildSelectFieldSkippingTypes(conn, "test", "t", false, skipTypes)
+	c.Assert(err, IsNil)
+	c.Assert(selectedField, Equals, "*")
+	c.Assert(skipped, IsNil)
+
+	mock.ExpectQuery("SELECT COLUMN_NAME,DATA_TYPE,EXTRA").
+		WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "data_type", "extra"}).
+			AddRow("doc", "json", ""))
+	_, _, err = buildSelectFieldSkippingTypes(conn, "test", "t", false, skipTypes)
+	c.Assert(err, ErrorMatches, "all the columns of table `test`.`t` are skipped by their types BLOB,TEXT,JSON.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testUtilSuite) TestIsSkippedColumnType(c *C) {
+	skipTypes := []string{"BLOB", "TEXT", "JSON"}
+	for _, tp := range []string{"blob", "TINYBLOB", "mediumblob", "longtext", "text", "json"} {
+		c.Assert(isSkippedColumnType(tp, skipTypes), IsTrue, Commentf("type %s", tp))
+	}
+	for _, tp := range []string{"int", "varchar", "varbinary", "tinyint", "geometry"} {
+		c.Assert(isSkippedColumnType(tp, skipTypes), IsFalse, Commentf("type %s", tp))
+	}
+}
+
+func (s *testUtilSuite) TestDropColumnsFromCreateTable(c *C) {
+	createTableSQL := "CREATE TABLE `t` (\n" +
+		"  `id` int(11) NOT NULL,\n" +
+		"  `body` text COMMENT 'the `body`, (maybe) long',\n" +
+		"  `len` int(11) GENERATED ALWAYS AS (length(`body`)) VIRTUAL,\n" +
+		"  `len2` int(11) GENERATED ALWAYS AS ((`len` * 2)) VIRTUAL,\n" +
+		"  `name` varchar(20) DEFAULT 'a,b',\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `body` (`name`),\n" +
+		"  KEY `idx_body` (`name`,`body`(10)),\n" +
+		"  FULLTEXT KEY `ft` (`body`),\n" +
+		"  CONSTRAINT `fk` FOREIGN KEY (`id`) REFERENCES `p` (`body`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	expected := "CREATE TABLE `t` (\n" +
+		"  `id` int(11) NOT NULL,\n" +
+		"  `name` varchar(20) DEFAULT 'a,b',\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `body` (`name`),\n" +
+		"  CONSTRAINT `fk` FOREIGN KEY (`id`) REFERENCES `p` (`body`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	c.Assert(dropColumnsFromCreateTable(createTableSQL, []string{"body"}), Equals, expected)
+	c.Assert(dropColumnsFromCreateTable(createTableSQL, []string{"other"}), Equals, createTableSQL)
+}
@@ -8,12 +8,15 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
+	"math/big"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 
 	tcontext "github.com/pingcap/dumpling/v4/context"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/parser/model"
 	"github.com/pingcap/tidb/store/helper"
@@ -58,12 +61,16 @@ func ShowCreateDatabase(db *sql.Conn, database string) (string, error) {
 // ShowCreateTable constructs the create table SQL for a specified table
 // returns (createTableSQL, error)
 func ShowCreateTable(db *sql.Conn, database, table string) (string, error) {
+	return showCreateTable(context.Background(), db, database, table)
+}
+
+func showCreateTable(ctx context.Context, db *sql.Conn, database, table string) (string, error) {
 	var oneRow [2]string
 	handleOneRow := func(rows *sql.Rows) error {
 		return rows.Scan(&oneRow[0], &oneRow[1])
 	}
 	query := fmt.Sprintf("SHOW CREATE TABLE `%s`.`%s`", escapeString(database), escapeString(table))
-	err := simpleQuery(db, query, handleOneRow)
+	err := queryWithArgs(ctx, db, handleOneRow, query)
 	if err != nil {
 		return "", errors.Annotatef(err, "sql: %s", query)
 	}
@@ -192,7 +199,7 @@ func SelectVersion(db *sql.DB) (string, error) {
 // SelectAllFromTable dumps data serialized from a specified table
 func SelectAllFromTable(conf *Config, db *sql.Conn, meta TableMeta, partition string) (TableDataIR, error) {
 	database, table := meta.DatabaseName(), meta.TableName()
-	selectedField, selectLen, err := buildSelectField(db, database, table, conf.CompleteInsert)
+	selectedField, selectLen, err := buildSelectFieldForMeta(db, meta, conf.CompleteInsert)
 	if err != nil {
 		return nil, err
 	}
@@ -201,7 +208,7 @@ func SelectAllFromTable(conf *Config, db *sql.Conn, meta TableMeta, partition st
 	if err != nil {
 		return nil, err
 	}
-	query := buildSelectQuery(database, table, selectedField, partition, buildWhereCondition(conf, ""), orderByClause)
+	query := buildSelectQueryWithHint(database, table, selectedField, partition, indexHintOf(meta), buildTableWhereCondition(conf, meta, ""), orderByClause)
 
 	return &tableData{
 		query:  query,
@@ -210,6 +217,11 @@ func SelectAllFromTable(conf *Config, db *sql.Conn, meta TableMeta, partition st
 }
 
 func buildSelectQuery(database, table, fields, partition, where, orderByClause string) string {
+	return buildSelectQueryWithHint(database, table, fields, partition, "", where, orderByClause)
+}
+
+// buildSelectQueryWithHint builds the select query with the index hint of the table, like USE INDEX(`idx`)
+func buildSelectQueryWithHint(database, table, fields, partition, indexHint, where, orderByClause string) string {
 	var query strings.Builder
 	query.WriteString("SELECT ")
 	if fields == "" {
@@ -228,6 +240,10 @@ func buildSelectQuery(database, table, fields, partition, where, orderByClause s
 		query.WriteString(escapeString(partition))
 		query.WriteString("`)")
 	}
+	if indexHint != "" {
+		query.WriteString(" ")
+		query.WriteString(indexHint)
+	}
 
 	if where != "" {
 		query.WriteString(" ")
@@ -259,7 +275,7 @@ func buildOrderByClause(conf *Config, db *sql.Conn, database, table string) (str
 	if err != nil {
 		return "", errors.Trace(err)
 	}
-	return buildOrderByClauseString(cols), nil
+	return buildCollatedOrderByClause(conf, db, database, table, cols)
 }
 
 // SelectTiDBRowID checks whether this table has _tidb_rowid column
@@ -532,6 +548,18 @@ func GetPdAddrs(tctx *tcontext.Context, db *sql.DB) ([]string, error) {
 	return GetSpecifiedColumnValueAndClose(rows, "STATUS_ADDRESS")
 }
 
+// GetTiDBStatusAddrs gets the status addresses of the TiDB servers of the cluster
+func GetTiDBStatusAddrs(tctx *tcontext.Context, db *sql.DB) ([]string, error) {
+	query := "SELECT * FROM information_schema.cluster_info where type = 'tidb';"
+	rows, err := db.QueryContext(tctx, query)
+	if err != nil {
+		tctx.L().Warn("can't execute query from db",
+			zap.String("query", query), zap.Error(err))
+		return []string{}, errors.Annotatef(err, "sql: %s", query)
+	}
+	return GetSpecifiedColumnValueAndClose(rows, "STATUS_ADDRESS")
+}
+
 // GetTiDBDDLIDs gets DDL IDs from TiDB
 func GetTiDBDDLIDs(tctx *tcontext.Context, db *sql.DB) ([]string, error) {
 	query := "SELECT * FROM information_schema.tidb_servers_info;"
@@ -568,7 +596,64 @@ func isUnknownSystemVariableErr(err error) bool {
 	return strings.Contains(err.Error(), "Unknown system variable")
 }
 
+// schemaLossySQLModes are the sql modes which make `SHOW CREATE TABLE` omit column, index or table options,
+// such as `DEFAULT (expr)` or `ON UPDATE CURRENT_TIMESTAMP`. See https://dev.mysql.com/doc/refman/5.7/en/sql-mode.html
+var schemaLossySQLModes = map[string]struct{}{
+	"NO_FIELD_OPTIONS": {},
+	"NO_KEY_OPTIONS":   {},
+	"NO_TABLE_OPTIONS": {},
+	"MYSQL323":         {},
+	"MYSQL40":          {},
+	"DB2":              {},
+	"MAXDB":            {},
+	"MSSQL":            {},
+	"ORACLE":           {},
+	"POSTGRESQL":       {},
+}
+
+// removeSchemaLossySQLModes removes the sql modes that would make the dumped schema lose information.
+// It returns the new sql mode and the removed modes.
+func removeSchemaLossySQLModes(sqlMode string) (string, []string) {
+	var kept, removed []string
+	for _, mode := range strings.Split(sqlMode, ",") {
+		mode = strings.TrimSpace(mode)
+		if mode == "" {
+			continue
+		}
+		if _, ok := schemaLossySQLModes[strings.ToUpper(mode)]; ok {
+			removed = append(removed, mode)
+			continue
+		}
+		kept = append(kept, mode)
+	}
+	return strings.Join(kept, ","), removed
+}
+
 func resetDBWithSessionParams(tctx *tcontext.Context, db *sql.DB, dsn string, params map[string]interface{}) (*sql.DB, error) {
+	support, err := checkSessionParams(tctx, db, params)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range support {
+		var s string
+		// Wrap string with quote to handle string with space. For example, '2020-10-20 13:41:40'
+		// For --params argument, quote doesn't matter because it doesn't affect the actual value
+		if str, ok := v.(string); ok {
+			s = wrapStringWith(str, "'")
+		} else {
+			s = fmt.Sprintf("%v", v)
+		}
+		dsn += fmt.Sprintf("&%s=%s", k, url.QueryEscape(s))
+	}
+
+	newDB, err := sql.Open("mysql", dsn)
+	return newDB, errors.Trace(err)
+}
+
+// checkSessionParams sets the session params on db to check whether they are supported by the server,
+// and returns the supported ones with their values converted
+func checkSessionParams(tctx *tcontext.Context, db *sql.DB, params map[string]interface{}) (map[string]interface{}, error) {
 	support := make(map[string]interface{})
 	for k, v := range params {
 		var pv interface{}
@@ -595,39 +680,60 @@ func resetDBWithSessionParams(tctx *tcontext.Context, db *sql.DB, dsn string, pa
 
 		support[k] = pv
 	}
+	return support, nil
+}
 
-	for k, v := range support {
-		var s string
-		// Wrap string with quote to handle string with space. For example, '2020-10-20 13:41:40'
-		// For --params argument, quote doesn't matter because it doesn't affect the actual value
-		if str, ok := v.(string); ok {
-			s = wrapStringWith(str, "'")
-		} else {
-			s = fmt.Sprintf("%v", v)
-		}
-		dsn += fmt.Sprintf("&%s=%s", k, url.QueryEscape(s))
-	}
+func createConnWithConsistency(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	return createConnWithSessionParams(ctx, db, nil)
+}
 
-	newDB, err := sql.Open("mysql", dsn)
-	return newDB, errors.Trace(err)
+// createConnWithSessionParams creates a connection with consistency after setting the session params on it.
+// It's used for the pool provided by the caller, whose DSN can't carry the session params.
+func createConnWithSessionParams(ctx context.Context, db *sql.DB, params map[string]interface{}) (*sql.Conn, error) {
+	conn, err := openConnWithSessionParams(ctx, db, params)
+	if err != nil {
+		return nil, err
+	}
+	if err = startConsistentSnapshot(ctx, conn); err != nil {
+		return nil, err
+	}
+	return conn, nil
 }
 
-func createConnWithConsistency(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+// openConnWithSessionParams opens a connection and sets the session params on it, without starting any transaction
+func openConnWithSessionParams(ctx context.Context, db *sql.DB, params map[string]interface{}) (*sql.Conn, error) {
 	conn, err := db.Conn(ctx)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	names := make([]string, 0, len(params))
+	for k := range params {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		query := fmt.Sprintf("SET SESSION %s = ?", k)
+		if _, err = conn.ExecContext(ctx, query, params[k]); err != nil {
+			conn.Close()
+			return nil, errors.Annotatef(err, "sql: %s", query)
+		}
+	}
+	return conn, nil
+}
+
+// startConsistentSnapshot starts a transaction with a consistent snapshot on conn, which commits the previous one if any
+func startConsistentSnapshot(ctx context.Context, conn *sql.Conn) error {
 	query := "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"
-	_, err = conn.ExecContext(ctx, query)
+	_, err := conn.ExecContext(ctx, query)
 	if err != nil {
-		return nil, errors.Annotatef(err, "sql: %s", query)
+		return errors.Annotatef(err, "sql: %s", query)
 	}
 	query = "START TRANSACTION /*!40108 WITH CONSISTENT SNAPSHOT */"
 	_, err = conn.ExecContext(ctx, query)
 	if err != nil {
-		return nil, errors.Annotatef(err, "sql: %s", query)
+		return errors.Annotatef(err, "sql: %s", query)
 	}
-	return conn, nil
+	return nil
 }
 
 // buildSelectField returns the selecting fields' string(joined by comma(`,`)),
@@ -669,6 +775,7 @@ func buildWhereClauses(handleColNames []string, handleVals [][]string) []string
 	if len(handleColNames) == 0 || len(handleVals) == 0 {
 		return nil
 	}
+	handleVals, _ = dedupeHandleVals(handleVals)
 	quotaCols := make([]string, len(handleColNames))
 	for i, s := range handleColNames {
 		quotaCols[i] = fmt.Sprintf("`%s`", escapeString(s))
@@ -690,6 +797,39 @@ func buildWhereClauses(handleColNames []string, handleVals [][]string) []string
 	return where
 }
 
+// dedupeHandleVals drops the handle values which aren't strictly greater than their previous ones,
+// which merges the chunks around them. Duplicated values can be returned by sampling or splitting
+// regions of non-unique keys, and would otherwise build empty or overlapping chunks.
+// The values are ordered by the server, so only the numeric values can be checked for the order.
+func dedupeHandleVals(handleVals [][]string) ([][]string, int) {
+	if len(handleVals) <= 1 {
+		return handleVals, 0
+	}
+	deduped := make([][]string, 0, len(handleVals))
+	deduped = append(deduped, handleVals[0])
+	for _, val := range handleVals[1:] {
+		if compareHandleVals(deduped[len(deduped)-1], val) < 0 {
+			deduped = append(deduped, val)
+		}
+	}
+	return deduped, len(handleVals) - len(deduped)
+}
+
+// compareHandleVals compares two handle values by their first different column. It returns -1 if the order of
+// that column can't be decided in dumpling, for example for strings, because the order of the server is trusted.
+func compareHandleVals(low, up []string) int {
+	commonLen := getCommonLength(low, up)
+	if commonLen == len(low) {
+		return 0
+	}
+	lowNum, ok1 := new(big.Rat).SetString(low[commonLen])
+	upNum, ok2 := new(big.Rat).SetString(up[commonLen])
+	if !ok1 || !ok2 {
+		return -1
+	}
+	return lowNum.Cmp(upNum)
+}
+
 // return greater than TableRangeScan where clause
 // the result doesn't contain brackets
 const (
@@ -855,7 +995,11 @@ func simpleQuery(conn *sql.Conn, sql string, handleOneRow func(*sql.Rows) error)
 }
 
 func simpleQueryWithArgs(conn *sql.Conn, handleOneRow func(*sql.Rows) error, sql string, args ...interface{}) error {
-	rows, err := conn.QueryContext(context.Background(), sql, args...)
+	return queryWithArgs(context.Background(), conn, handleOneRow, sql, args...)
+}
+
+func queryWithArgs(ctx context.Context, conn *sql.Conn, handleOneRow func(*sql.Rows) error, sql string, args ...interface{}) error {
+	rows, err := conn.QueryContext(ctx, sql, args...)
 	if err != nil {
 		return errors.Annotatef(err, "sql: %s, args: %s", sql, args)
 	}
@@ -912,7 +1056,9 @@ func estimateCount(tctx *tcontext.Context, dbName, tableName string, db *sql.Con
 		query += conf.Where
 	}
 
-	estRows := detectEstimateRows(tctx, db, query, []string{"rows", "estRows", "count"})
+	qctx, cancel := withQueryTimeout(tctx, conf)
+	defer cancel()
+	estRows := detectEstimateRows(qctx, db, query, []string{"rows", "estRows", "count"})
 	/* tidb results field name is estRows (before 4.0.0-beta.2: count)
 		+-----------------------+----------+-----------+---------------------------------------------------------+
 		| id                    | estRows  | task      | access object | operator info                           |
@@ -1011,30 +1157,126 @@ func parseSnapshotToTSO(pool *sql.DB, snapshot string) (uint64, error) {
 	return (uint64(tso.Int64) << 18) * 1000, nil
 }
 
+// buildWhereCondition builds the WHERE clause of the user's condition and where, it's empty if both are empty.
+// Every condition is parenthesized, so the ORs of either one, like those of the user's condition or of the chunk keys
+// of composite primary keys, don't take the other as an operand.
 func buildWhereCondition(conf *Config, where string) string {
-	var query strings.Builder
-	separator := "WHERE"
-	if conf.Where != "" {
-		query.WriteString(separator)
-		query.WriteByte(' ')
-		query.WriteString(conf.Where)
-		query.WriteByte(' ')
-		separator = "AND"
-		query.WriteByte(' ')
+	conditions := make([]string, 0, 2)
+	for _, condition := range []string{conf.Where, where} {
+		if condition != "" {
+			conditions = append(conditions, "("+condition+")")
+		}
 	}
-	if where != "" {
-		query.WriteString(separator)
-		query.WriteString(" ")
-		query.WriteString(where)
+	if len(conditions) == 0 {
+		return ""
 	}
-	return query.String()
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
+
+// escapeSQLString escapes s to be used in a single-quoted sql string literal
+func escapeSQLString(s string) string {
+	var bf bytes.Buffer
+	escapeBackslashSQL([]byte(s), &bf)
+	return bf.String()
+}
+
+// checkTimeColumn checks the time column exists and is the first column of an index in all the tables to dump
+func checkTimeColumn(conn *sql.Conn, conf *Config) error {
+	const query = "SELECT COUNT(1), IFNULL(SUM(SEQ_IN_INDEX = 1), 0) FROM INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND COLUMN_NAME = ?"
+	const columnQuery = "SELECT COUNT(1) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND COLUMN_NAME = ?"
+	for db, tables := range conf.Tables {
+		for _, tbl := range tables {
+			if tbl.Type != TableTypeBase {
+				continue
+			}
+			var columnCnt int
+			if err := conn.QueryRowContext(context.Background(), columnQuery, db, tbl.Name, conf.TimeColumn).Scan(&columnCnt); err != nil {
+				return errors.Annotatef(err, "sql: %s", columnQuery)
+			}
+			if columnCnt == 0 {
+				return errors.Errorf("time column `%s` doesn't exist in table `%s`.`%s`", conf.TimeColumn, db, tbl.Name)
+			}
+			var indexCnt, leadingCnt int
+			if err := conn.QueryRowContext(context.Background(), query, db, tbl.Name, conf.TimeColumn).Scan(&indexCnt, &leadingCnt); err != nil {
+				return errors.Annotatef(err, "sql: %s", query)
+			}
+			if leadingCnt == 0 {
+				return errors.Errorf("time column `%s` is not the leading column of any index in table `%s`.`%s`", conf.TimeColumn, db, tbl.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// selectPrunedPartitions returns the partitions which may contain rows matching where, in their original order.
+// It relies on the partition pruning result in the execution plan. If the plan doesn't show it, all partitions are returned.
+func selectPrunedPartitions(tctx *tcontext.Context, conn *sql.Conn, db, tbl, where string, partitions []string) []string {
+	query := fmt.Sprintf("EXPLAIN SELECT * FROM `%s`.`%s` WHERE %s", escapeString(db), escapeString(tbl), where)
+	used := make(map[string]struct{})
+	found := false
+	err := simpleQuery(conn, query, func(rows *sql.Rows) error {
+		columns, err := rows.Columns()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		row := make([]sql.NullString, len(columns))
+		addr := make([]interface{}, len(columns))
+		for i := range row {
+			addr[i] = &row[i]
+		}
+		if err = rows.Scan(addr...); err != nil {
+			return errors.Trace(err)
+		}
+		for i, column := range columns {
+			if !row[i].Valid {
+				continue
+			}
+			var names string
+			switch strings.ToLower(column) {
+			case "partitions":
+				// MySQL: p20210101,p20210102
+				names = row[i].String
+			case "access object", "operator info":
+				// TiDB: table:t, partition:p20210101,p20210102
+				idx := strings.Index(row[i].String, "partition:")
+				if idx < 0 {
+					continue
+				}
+				names = row[i].String[idx+len("partition:"):]
+				if end := strings.Index(names, ", "); end >= 0 {
+					names = names[:end]
+				}
+			default:
+				continue
+			}
+			found = true
+			for _, name := range strings.Split(names, ",") {
+				used[strings.TrimSpace(name)] = struct{}{}
+			}
+		}
+		return nil
+	})
+	if _, all := used["all"]; err != nil || !found || all {
+		if err != nil {
+			tctx.L().Warn("fail to get pruned partitions, will dump all partitions",
+				zap.String("query", query), zap.Error(err))
+		}
+		return partitions
+	}
+	pruned := make([]string, 0, len(partitions))
+	for _, partition := range partitions {
+		if _, ok := used[partition]; ok {
+			pruned = append(pruned, partition)
+		}
+	}
+	return pruned
 }
 
 func escapeString(s string) string {
 	return strings.ReplaceAll(s, "`", "``")
 }
 
-// GetPartitionNames get partition names from a specified table
+// GetPartitionNames get partition names from a specified table in definition order
 func GetPartitionNames(db *sql.Conn, schema, table string) (partitions []string, err error) {
 	partitions = make([]string, 0)
 	var partitionName sql.NullString
@@ -1043,11 +1285,12 @@ func GetPartitionNames(db *sql.Conn, schema, table string) (partitions []string,
 		if err != nil {
 			return errors.Trace(err)
 		}
-		if partitionName.Valid {
+		// a partition has a row for each of its subpartitions
+		if partitionName.Valid && (len(partitions) == 0 || partitions[len(partitions)-1] != partitionName.String) {
 			partitions = append(partitions, partitionName.String)
 		}
 		return nil
-	}, "SELECT PARTITION_NAME from INFORMATION_SCHEMA.PARTITIONS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", schema, table)
+	}, "SELECT PARTITION_NAME from INFORMATION_SCHEMA.PARTITIONS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY PARTITION_ORDINAL_POSITION", schema, table)
 	return
 }
 
@@ -1204,3 +1447,45 @@ func GetRegionInfos(db *sql.Conn) (*helper.RegionsInfo, error) {
 	})
 	return regionsInfo, err
 }
+
+// checkTableIntegrity runs the integrity probe on the table before dumping it.
+// It returns the problem found by the probe, or an empty string if the table passes the check.
+func checkTableIntegrity(tctx *tcontext.Context, conn *sql.Conn, serverType ServerType, db, tbl, probe string) (string, error) {
+	if serverType == ServerTypeTiDB {
+		if probe != PreCheckTablesFull {
+			return "", nil
+		}
+		query := fmt.Sprintf("ADMIN CHECK TABLE `%s`.`%s`", escapeString(db), escapeString(tbl))
+		_, err := conn.ExecContext(tctx, query)
+		if mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError); ok {
+			// ADMIN CHECK TABLE reports the inconsistency by error
+			return mysqlErr.Message, nil
+		}
+		return "", errors.Annotatef(err, "sql: %s", query)
+	}
+
+	query := fmt.Sprintf("CHECK TABLE `%s`.`%s`", escapeString(db), escapeString(tbl))
+	if probe == PreCheckTablesQuick {
+		query += " QUICK"
+	}
+	rows, err := conn.QueryContext(tctx, query)
+	if err != nil {
+		return "", errors.Annotatef(err, "sql: %s", query)
+	}
+	results, err := GetSpecifiedColumnValuesAndClose(rows, "MSG_TYPE", "MSG_TEXT")
+	if err != nil {
+		return "", errors.Annotatef(err, "sql: %s", query)
+	}
+	var problems []string
+	for _, result := range results {
+		msgType, msgText := strings.ToLower(result[0]), result[1]
+		switch {
+		case msgType == "error":
+		case msgType == "status" && msgText != "OK" && msgText != "Table is already up to date":
+		default:
+			continue
+		}
+		problems = append(problems, msgText)
+	}
+	return strings.Join(problems, "; "), nil
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/coreos/go-semver/semver"
+	mysqldriver "github.com/go-sql-driver/mysql"
 	. "github.com/pingcap/check"
 	"github.com/siddontang/go-mysql/mysql"
 )
@@ -358,6 +359,129 @@ func (s *testSQLSuite) TestShowCreateView(c *C) {
 	c.Assert(mock.ExpectationsWereMet(), IsNil)
 }
 
+func (s *testSQLSuite) TestDumpTableMetaWithExpressionDefaults(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	createTableSQL := "CREATE TABLE `t` (\n" +
+		"  `id` int NOT NULL,\n" +
+		"  `uuid` binary(16) DEFAULT (uuid_to_bin(uuid())),\n" +
+		"  `created_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+		"  `updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,\n" +
+		"  `total` int GENERATED ALWAYS AS ((`id` * 2)) STORED,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	// columns with expression defaults are not generated columns, they should be dumped
+	mock.ExpectQuery("SELECT COLUMN_NAME").
+		WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).
+			AddRow("id", "").AddRow("uuid", "DEFAULT_GENERATED").
+			AddRow("created_at", "DEFAULT_GENERATED").
+			AddRow("updated_at", "DEFAULT_GENERATED on update CURRENT_TIMESTAMP").
+			AddRow("total", "STORED GENERATED"))
+	mock.ExpectQuery("SELECT `id`,`uuid`,`created_at`,`updated_at` FROM `test`.`t` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "uuid", "created_at", "updated_at"}))
+	mock.ExpectQuery("SHOW CREATE TABLE `test`.`t`").
+		WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t", createTableSQL))
+
+	meta, err := dumpTableMeta(tcontext.Background(), DefaultConfig(), conn, "test", &TableInfo{Name: "t", Type: TableTypeBase})
+	c.Assert(err, IsNil)
+	c.Assert(meta.SelectedField(), Equals, "(`id`,`uuid`,`created_at`,`updated_at`)")
+	c.Assert(meta.ShowCreateTable(), Equals, createTableSQL)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testSQLSuite) TestRemoveSchemaLossySQLModes(c *C) {
+	testCases := []struct {
+		sqlMode  string
+		expected string
+		removed  []string
+	}{
+		{"", "", nil},
+		{"STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION", "STRICT_TRANS_TABLES,NO_ENGINE_SUBSTITUTION", nil},
+		{"NO_FIELD_OPTIONS", "", []string{"NO_FIELD_OPTIONS"}},
+		{"ansi_quotes, no_key_options,NO_TABLE_OPTIONS,ONLY_FULL_GROUP_BY", "ansi_quotes,ONLY_FULL_GROUP_BY", []string{"no_key_options", "NO_TABLE_OPTIONS"}},
+		{"MYSQL40,POSTGRESQL", "", []string{"MYSQL40", "POSTGRESQL"}},
+	}
+	for _, testCase := range testCases {
+		cmt := Commentf("sql mode: %s", testCase.sqlMode)
+		sqlMode, removed := removeSchemaLossySQLModes(testCase.sqlMode)
+		c.Assert(sqlMode, Equals, testCase.expected, cmt)
+		c.Assert(removed, DeepEquals, testCase.removed, cmt)
+	}
+}
+
+func (s *testSQLSuite) TestSelectPrunedPartitions(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	partitions := []string{"p0", "p1", "p2", "p3"}
+	where := "`ts` BETWEEN '2021-01-01' AND '2021-01-02'"
+	query := "EXPLAIN SELECT \\* FROM `test`.`t` WHERE `ts` BETWEEN '2021-01-01' AND '2021-01-02'"
+
+	// mysql
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"id", "select_type", "table", "partitions", "type"}).
+		AddRow("1", "SIMPLE", "t", "p2,p1", "range"))
+	c.Assert(selectPrunedPartitions(tctx, conn, "test", "t", where, partitions), DeepEquals, []string{"p1", "p2"})
+
+	// tidb
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"id", "estRows", "task", "access object", "operator info"}).
+		AddRow("PartitionUnion_8", "2.00", "root", "", "").
+		AddRow("TableReader_10", "1.00", "root", "", "data:Selection_9").
+		AddRow("TableFullScan_8", "1.00", "cop[tikv]", "table:t, partition:p3", "keep order:false").
+		AddRow("TableReader_12", "1.00", "root", "", "data:Selection_11").
+		AddRow("TableFullScan_11", "1.00", "cop[tikv]", "table:t, partition:p0", "keep order:false"))
+	c.Assert(selectPrunedPartitions(tctx, conn, "test", "t", where, partitions), DeepEquals, []string{"p0", "p3"})
+
+	// all partitions are pruned
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"id", "estRows", "task", "access object", "operator info"}).
+		AddRow("TableDual_6", "0.00", "root", "", "rows:0").
+		AddRow("TableFullScan_5", "0.00", "cop[tikv]", "table:t, partition:dual", "keep order:false"))
+	c.Assert(selectPrunedPartitions(tctx, conn, "test", "t", where, partitions), HasLen, 0)
+
+	// can't find pruning info, or meet error
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"id", "rows"}).AddRow("1", "10"))
+	c.Assert(selectPrunedPartitions(tctx, conn, "test", "t", where, partitions), DeepEquals, partitions)
+	mock.ExpectQuery(query).WillReturnError(errors.New("mock error"))
+	c.Assert(selectPrunedPartitions(tctx, conn, "test", "t", where, partitions), DeepEquals, partitions)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testSQLSuite) TestCheckTimeColumn(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.TimeColumn = "ts"
+	conf.Tables = DatabaseTables{}.AppendTables("test", "t").AppendViews("test", "v")
+
+	mock.ExpectQuery("SELECT COUNT\\(1\\) FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t", "ts").
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+	mock.ExpectQuery("FROM INFORMATION_SCHEMA.STATISTICS").WithArgs("test", "t", "ts").
+		WillReturnRows(sqlmock.NewRows([]string{"cnt", "leading"}).AddRow(1, 1))
+	c.Assert(checkTimeColumn(conn, conf), IsNil)
+
+	mock.ExpectQuery("SELECT COUNT\\(1\\) FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t", "ts").
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(1))
+	mock.ExpectQuery("FROM INFORMATION_SCHEMA.STATISTICS").WithArgs("test", "t", "ts").
+		WillReturnRows(sqlmock.NewRows([]string{"cnt", "leading"}).AddRow(1, 0))
+	c.Assert(checkTimeColumn(conn, conf), ErrorMatches, ".*is not the leading column of any index.*")
+
+	mock.ExpectQuery("SELECT COUNT\\(1\\) FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t", "ts").
+		WillReturnRows(sqlmock.NewRows([]string{"cnt"}).AddRow(0))
+	c.Assert(checkTimeColumn(conn, conf), ErrorMatches, ".*doesn't exist in table.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
 func (s *testSQLSuite) TestGetSuitableRows(c *C) {
 	db, mock, err := sqlmock.New()
 	c.Assert(err, IsNil)
@@ -417,6 +541,29 @@ func (s *testSQLSuite) TestGetSuitableRows(c *C) {
 	}
 }
 
+func (s *testSQLSuite) TestDedupeHandleVals(c *C) {
+	testCases := []struct {
+		handleVals [][]string
+		expected   [][]string
+		dropped    int
+	}{
+		{nil, nil, 0},
+		{[][]string{{"1"}}, [][]string{{"1"}}, 0},
+		{[][]string{{"1"}, {"1"}, {"2"}}, [][]string{{"1"}, {"2"}}, 1},
+		{[][]string{{"1"}, {"3"}, {"2"}, {"3"}, {"4"}}, [][]string{{"1"}, {"3"}, {"4"}}, 2},
+		// numbers are compared by their values instead of the literals
+		{[][]string{{"9"}, {"10"}, {"10.0"}, {"-1.5e3"}}, [][]string{{"9"}, {"10"}}, 2},
+		// the order of strings is decided by the server
+		{[][]string{{"'b'"}, {"'a'"}, {"'a'"}}, [][]string{{"'b'"}, {"'a'"}}, 1},
+		{[][]string{{"1", "'b'"}, {"1", "'a'"}, {"0", "'c'"}}, [][]string{{"1", "'b'"}, {"1", "'a'"}}, 1},
+	}
+	for i, testCase := range testCases {
+		deduped, dropped := dedupeHandleVals(testCase.handleVals)
+		c.Assert(deduped, DeepEquals, testCase.expected, Commentf("case #%d", i))
+		c.Assert(dropped, Equals, testCase.dropped, Commentf("case #%d", i))
+	}
+}
+
 func (s *testSQLSuite) TestBuildTableSampleQueries(c *C) {
 	db, mock, err := sqlmock.New()
 	c.Assert(err, IsNil)
@@ -572,11 +719,44 @@ func (s *testSQLSuite) TestBuildTableSampleQueries(c *C) {
 			},
 			[]string{
 				"`a`<1 or(`a`=1 and `b`<2)or(`a`=1 and `b`=2 and `c`<3)",
-				"false",
 				"`a`>1 or(`a`=1 and `b`>2)or(`a`=1 and `b`=2 and `c`>=3)",
 			},
 			false,
 		},
+		// special case: duplicated samples are merged, so no row is dumped twice or skipped
+		{
+			[]string{"a"},
+			[]string{"bigint"},
+			[][]driver.Value{
+				{1},
+				{1},
+				{2},
+				{2},
+				{2},
+				{3},
+			},
+			[]string{"`a`<1", "`a`>=1 and `a`<2", "`a`>=2 and `a`<3", "`a`>=3"},
+			false,
+		},
+		// special case: disordered samples are merged into the previous chunk
+		{
+			[]string{"a", "b"},
+			[]string{"bigint", "varchar"},
+			[][]driver.Value{
+				{1, "x"},
+				{3, "a"},
+				{2, "b"},
+				{3, "a"},
+				{4, "a"},
+			},
+			[]string{
+				"`a`<1 or(`a`=1 and `b`<'x')",
+				"(`a`>1 and `a`<3)or(`a`=1 and(`b`>='x'))or(`a`=3 and(`b`<'a'))",
+				"(`a`>3 and `a`<4)or(`a`=3 and(`b`>='a'))or(`a`=4 and(`b`<'a'))",
+				"`a`>4 or(`a`=4 and `b`>='a')",
+			},
+			false,
+		},
 		// special case: numbers has bigger lexicographically order but lower number
 		{
 			[]string{"a", "b", "c"},
@@ -737,6 +917,91 @@ func (s *testSQLSuite) TestBuildTableSampleQueries(c *C) {
 	}
 }
 
+func (s *testSQLSuite) TestConcurrentDumpTiDBTablesFallback(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+
+	d := &Dumper{tctx: tctx, conf: DefaultConfig(), cancelCtx: cancel}
+	d.conf.ServerInfo = ServerInfo{ServerType: ServerTypeTiDB, ServerVersion: tableSampleVersion}
+	meta := &tableMeta{database: "foo", table: "bar", selectedField: "*"}
+	const (
+		rowIDQuery = "SELECT _tidb_rowid from `foo`.`bar` LIMIT 0"
+		wholeTable = "SELECT * FROM `foo`.`bar` ORDER BY `_tidb_rowid`"
+	)
+	sampleErr := &mysql.MyError{Code: mysql.ER_UNKNOWN_ERROR, State: "HY000", Message: "table bar has no regions"}
+
+	testCases := []struct {
+		hasTiKV   bool
+		regionErr error
+		queries   []string
+	}{
+		// the table is dumped as a whole without TiKV
+		{false, nil, []string{wholeTable}},
+		{true, nil, []string{
+			"SELECT * FROM `foo`.`bar` WHERE (`_tidb_rowid`<100) ORDER BY `_tidb_rowid`",
+			"SELECT * FROM `foo`.`bar` WHERE (`_tidb_rowid`>=100) ORDER BY `_tidb_rowid`",
+		}},
+		{true, errors.New("fail to decode the regions"), []string{wholeTable}},
+	}
+	for _, t := range testCases {
+		d.conf.ServerInfo.HasTiKV = t.hasTiKV
+		regionErr := t.regionErr
+		d.selectTiDBTableRegionFunc = func(*tcontext.Context, *sql.Conn, string, string) ([]string, [][]string, error) {
+			if regionErr != nil {
+				return nil, nil, regionErr
+			}
+			return []string{"_tidb_rowid"}, [][]string{{"100"}}, nil
+		}
+		mock.ExpectExec(rowIDQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT `_tidb_rowid` FROM `foo`.`bar` TABLESAMPLE REGIONS").WillReturnError(sampleErr)
+		if t.hasTiKV {
+			mock.ExpectQuery("SELECT PARTITION_NAME from INFORMATION_SCHEMA.PARTITIONS").WithArgs("foo", "bar").
+				WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}))
+		}
+		mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("foo", "bar").
+			WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "EXTRA"}).AddRow("a", ""))
+		if len(t.queries) == 1 {
+			mock.ExpectExec(rowIDQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+
+		taskChan := make(chan Task, 8)
+		c.Assert(d.concurrentDumpTiDBTables(tctx, conn, meta, taskChan), IsNil)
+		close(taskChan)
+		c.Assert(mock.ExpectationsWereMet(), IsNil)
+		var queries []string
+		for task := range taskChan {
+			queries = append(queries, task.(*TaskTableData).Data.(*tableData).query)
+		}
+		c.Assert(queries, DeepEquals, t.queries)
+	}
+
+	// the errors of the region decode path are returned if TABLESAMPLE isn't tried
+	d.conf.ServerInfo.ServerVersion = gcSafePointVersion
+	mock.ExpectQuery("SELECT PARTITION_NAME from INFORMATION_SCHEMA.PARTITIONS").WithArgs("foo", "bar").
+		WillReturnRows(sqlmock.NewRows([]string{"PARTITION_NAME"}))
+	c.Assert(d.concurrentDumpTiDBTables(tctx, conn, meta, make(chan Task, 1)), ErrorMatches, "fail to decode the regions")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testSQLSuite) TestBuildWhereConditionWithCompositeKeys(c *C) {
+	conf := DefaultConfig()
+	where := buildWhereClauses([]string{"a", "b"}, [][]string{{"1", "2"}})
+	c.Assert(where, DeepEquals, []string{"`a`<1 or(`a`=1 and `b`<2)", "`a`>1 or(`a`=1 and `b`>=2)"})
+
+	c.Assert(buildWhereCondition(conf, ""), Equals, "")
+	c.Assert(buildWhereCondition(conf, where[0]), Equals, "WHERE (`a`<1 or(`a`=1 and `b`<2))")
+	// the ORs of the chunk keys don't escape --where
+	conf.Where = "c = 3"
+	c.Assert(buildWhereCondition(conf, where[0]), Equals, "WHERE (c = 3) AND (`a`<1 or(`a`=1 and `b`<2))")
+	c.Assert(buildWhereCondition(conf, where[1]), Equals, "WHERE (c = 3) AND (`a`>1 or(`a`=1 and `b`>=2))")
+	c.Assert(buildWhereCondition(conf, ""), Equals, "WHERE (c = 3)")
+}
+
 func (s *testSQLSuite) TestBuildPartitionClauses(c *C) {
 	const (
 		dbName        = "test"
@@ -1516,3 +1781,49 @@ func makeVersion(major, minor, patch int64, preRelease string) *semver.Version {
 		Metadata:   "",
 	}
 }
+
+func (s *testSQLSuite) TestCheckTableIntegrity(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	columns := []string{"Table", "Op", "Msg_type", "Msg_text"}
+
+	mock.ExpectQuery("CHECK TABLE `test`.`t` QUICK").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("test.t", "check", "status", "OK"))
+	problem, err := checkTableIntegrity(tctx, conn, ServerTypeMySQL, "test", "t", PreCheckTablesQuick)
+	c.Assert(err, IsNil)
+	c.Assert(problem, Equals, "")
+
+	mock.ExpectQuery("CHECK TABLE `test`.`t`").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("test.t", "check", "warning", "3 clients are using or haven't closed the table properly").
+			AddRow("test.t", "check", "error", "Found 2 keys of 3").
+			AddRow("test.t", "check", "status", "Corrupt"))
+	problem, err = checkTableIntegrity(tctx, conn, ServerTypeMySQL, "test", "t", PreCheckTablesFull)
+	c.Assert(err, IsNil)
+	c.Assert(problem, Equals, "Found 2 keys of 3; Corrupt")
+
+	// quick probe is skipped for TiDB
+	problem, err = checkTableIntegrity(tctx, conn, ServerTypeTiDB, "test", "t", PreCheckTablesQuick)
+	c.Assert(err, IsNil)
+	c.Assert(problem, Equals, "")
+
+	mock.ExpectExec("ADMIN CHECK TABLE `test`.`t`").WillReturnResult(sqlmock.NewResult(0, 0))
+	problem, err = checkTableIntegrity(tctx, conn, ServerTypeTiDB, "test", "t", PreCheckTablesFull)
+	c.Assert(err, IsNil)
+	c.Assert(problem, Equals, "")
+
+	mock.ExpectExec("ADMIN CHECK TABLE `test`.`t`").
+		WillReturnError(&mysqldriver.MySQLError{Number: 8003, Message: "t err:[admin:8223]index:<nil> != record:&admin.RecordData{Handle:1}"})
+	problem, err = checkTableIntegrity(tctx, conn, ServerTypeTiDB, "test", "t", PreCheckTablesFull)
+	c.Assert(err, IsNil)
+	c.Assert(problem, Matches, "t err:.*")
+
+	mock.ExpectExec("ADMIN CHECK TABLE `test`.`t`").WillReturnError(driver.ErrBadConn)
+	_, err = checkTableIntegrity(tctx, conn, ServerTypeTiDB, "test", "t", PreCheckTablesFull)
+	c.Assert(err, NotNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -5,7 +5,9 @@ package export
 import (
 	"bytes"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
+	"unicode/utf8"
 )
 
 var colTypeRowReceiverMap = map[string]func() RowReceiverStringer{}
@@ -61,6 +63,14 @@ func initColTypeRowReceiverMap() {
 
 var dataTypeString, dataTypeNum, dataTypeBin = make(map[string]struct{}), make(map[string]struct{}), make(map[string]struct{})
 
+// characterStringTypes are the string types which may store arbitrary bytes. They will be emitted
+// as binary safe strings when Config.BinarySafeStrings is set. Columns with binary charset are reported
+// as BINARY/VARBINARY/BLOB by the driver, so they are always emitted as bytes.
+var characterStringTypes = map[string]struct{}{
+	"CHAR": {}, "NCHAR": {}, "VARCHAR": {}, "NVARCHAR": {}, "CHARACTER": {}, "VARCHARACTER": {},
+	"TEXT": {}, "TINYTEXT": {}, "MEDIUMTEXT": {}, "LONGTEXT": {}, "VAR_STRING": {},
+}
+
 func escapeBackslashSQL(s []byte, bf *bytes.Buffer) {
 	var (
 		escape byte
@@ -164,20 +174,50 @@ func SQLTypeBytesMaker() RowReceiverStringer {
 	return &SQLTypeBytes{}
 }
 
+// SQLTypeBinaryStringMaker returns a SQLTypeBinaryString
+func SQLTypeBinaryStringMaker() RowReceiverStringer {
+	return &SQLTypeBinaryString{}
+}
+
 // SQLTypeNumberMaker returns a SQLTypeNumber
 func SQLTypeNumberMaker() RowReceiverStringer {
 	return &SQLTypeNumber{}
 }
 
+// SQLTypeClientSafeStringMaker returns a SQLTypeClientSafeString
+func SQLTypeClientSafeStringMaker() RowReceiverStringer {
+	return &SQLTypeClientSafeString{}
+}
+
 // MakeRowReceiver constructs RowReceiverArr from column types
 func MakeRowReceiver(colTypes []string) RowReceiverArr {
+	return makeRowReceiver(colTypes, false, false, "")
+}
+
+// makeRowReceiver constructs RowReceiverArr from column types.
+// If binarySafeStrings is true, character string columns are received by SQLTypeBinaryString.
+// Otherwise if clientSafeStrings is true, string columns are received by SQLTypeClientSafeString.
+// The bytes columns are written in binaryEncoding, or the default encoding of the file type if it's empty.
+func makeRowReceiver(colTypes []string, binarySafeStrings, clientSafeStrings bool, binaryEncoding string) RowReceiverArr { // revive:disable-line:flag-parameter
 	rowReceiverArr := make([]RowReceiverStringer, len(colTypes))
 	for i, colTp := range colTypes {
 		recMaker, ok := colTypeRowReceiverMap[colTp]
 		if !ok {
 			recMaker = SQLTypeStringMaker
 		}
+		_, isCharType := characterStringTypes[colTp]
+		switch {
+		case binarySafeStrings && isCharType:
+			recMaker = SQLTypeBinaryStringMaker
+		case clientSafeStrings:
+			if _, isStringType := dataTypeString[colTp]; isStringType || !ok {
+				recMaker = SQLTypeClientSafeStringMaker
+			}
+		}
 		rowReceiverArr[i] = recMaker()
+		if b, ok := rowReceiverArr[i].(*SQLTypeBytes); ok {
+			b.encoding = binaryEncoding
+		}
 	}
 	return RowReceiverArr{
 		bound:     false,
@@ -214,6 +254,36 @@ func (r RowReceiverArr) WriteToBuffer(bf *bytes.Buffer, escapeBackslash bool) {
 	bf.WriteByte(')')
 }
 
+// invalidUTF8Column returns the index of the first character string column whose value isn't valid UTF-8, or -1
+func (r RowReceiverArr) invalidUTF8Column() int {
+	for i, receiver := range r.receivers {
+		if s, ok := asSQLTypeString(receiver); ok && s.RawBytes != nil && !utf8.Valid(s.RawBytes) {
+			return i
+		}
+	}
+	return -1
+}
+
+// asSQLTypeString returns the SQLTypeString of character string receivers
+func asSQLTypeString(receiver RowReceiverStringer) (*SQLTypeString, bool) {
+	switch s := receiver.(type) {
+	case *SQLTypeString:
+		return s, true
+	case *SQLTypeClientSafeString:
+		return &s.SQLTypeString, true
+	}
+	return nil, false
+}
+
+// replaceInvalidUTF8 replaces the invalid UTF-8 sequences in character string columns with U+FFFD
+func (r RowReceiverArr) replaceInvalidUTF8() {
+	for _, receiver := range r.receivers {
+		if s, ok := asSQLTypeString(receiver); ok && s.RawBytes != nil && !utf8.Valid(s.RawBytes) {
+			s.RawBytes = bytes.ToValidUTF8(s.RawBytes, []byte(string(utf8.RuneError)))
+		}
+	}
+}
+
 // WriteToBufferInCsv implements Stringer.WriteToBufferInCsv
 func (r RowReceiverArr) WriteToBufferInCsv(bf *bytes.Buffer, escapeBackslash bool, opt *csvOption) {
 	for i, receiver := range r.receivers {
@@ -279,9 +349,12 @@ func (s *SQLTypeString) WriteToBufferInCsv(bf *bytes.Buffer, escapeBackslash boo
 	}
 }
 
-// SQLTypeBytes implements RowReceiverStringer which represents bytes type columns in database
+// SQLTypeBytes implements RowReceiverStringer which represents bytes type columns in database.
+// The values are written in encoding, which is one of the BinaryEncoding consts. By default they're
+// written as hex literals in sql and escaped raw bytes in csv.
 type SQLTypeBytes struct {
 	sql.RawBytes
+	encoding string
 }
 
 // BindAddress implements RowReceiver.BindAddress
@@ -290,21 +363,82 @@ func (s *SQLTypeBytes) BindAddress(arg []interface{}) {
 }
 
 // WriteToBuffer implements Stringer.WriteToBuffer
-func (s *SQLTypeBytes) WriteToBuffer(bf *bytes.Buffer, _ bool) {
-	if s.RawBytes != nil {
-		fmt.Fprintf(bf, "x'%x'", s.RawBytes)
-	} else {
+func (s *SQLTypeBytes) WriteToBuffer(bf *bytes.Buffer, escapeBackslash bool) {
+	if s.RawBytes == nil {
 		bf.WriteString(nullValue)
+		return
+	}
+	switch s.encoding {
+	case BinaryEncodingBase64:
+		bf.WriteString("FROM_BASE64('")
+		writeBase64(s.RawBytes, bf)
+		bf.WriteString("')")
+	case BinaryEncodingRaw:
+		bf.WriteString("_binary'")
+		escapeSQL(s.RawBytes, bf, escapeBackslash)
+		bf.Write(quotationMark)
+	default:
+		fmt.Fprintf(bf, "x'%x'", s.RawBytes)
 	}
 }
 
 // WriteToBufferInCsv implements Stringer.WriteToBufferInCsv
 func (s *SQLTypeBytes) WriteToBufferInCsv(bf *bytes.Buffer, escapeBackslash bool, opt *csvOption) {
+	if s.RawBytes == nil {
+		bf.WriteString(opt.nullValue)
+		return
+	}
+	bf.Write(opt.delimiter)
+	switch s.encoding {
+	case BinaryEncodingHex:
+		fmt.Fprintf(bf, "%x", s.RawBytes)
+	case BinaryEncodingBase64:
+		writeBase64(s.RawBytes, bf)
+	default:
+		escapeCSV(s.RawBytes, bf, escapeBackslash, opt)
+	}
+	bf.Write(opt.delimiter)
+}
+
+func writeBase64(s []byte, bf *bytes.Buffer) {
+	encoder := base64.NewEncoder(base64.StdEncoding, bf)
+	_, _ = encoder.Write(s)
+	_ = encoder.Close()
+}
+
+// SQLTypeBinaryString implements RowReceiverStringer which represents string type columns that may contain
+// arbitrary bytes. It's written as a hex literal in sql and encoded in base64 in csv.
+type SQLTypeBinaryString struct {
+	SQLTypeBytes
+}
+
+// WriteToBufferInCsv implements Stringer.WriteToBufferInCsv
+func (s *SQLTypeBinaryString) WriteToBufferInCsv(bf *bytes.Buffer, _ bool, opt *csvOption) {
 	if s.RawBytes != nil {
 		bf.Write(opt.delimiter)
-		escapeCSV(s.RawBytes, bf, escapeBackslash, opt)
+		writeBase64(s.RawBytes, bf)
 		bf.Write(opt.delimiter)
 	} else {
 		bf.WriteString(opt.nullValue)
 	}
 }
+
+// clientUnsafeBytes are the bytes which the mysql client rejects or mangles unless --binary-mode is used
+const clientUnsafeBytes = "\x00\r\x1a"
+
+// SQLTypeClientSafeString implements RowReceiverStringer which represents string type columns that
+// should be replayable by the mysql client without --binary-mode. If the value contains a byte that would
+// be written unescaped and mangled by the client, it's written as a hex literal.
+type SQLTypeClientSafeString struct {
+	SQLTypeString
+}
+
+// WriteToBuffer implements Stringer.WriteToBuffer
+func (s *SQLTypeClientSafeString) WriteToBuffer(bf *bytes.Buffer, escapeBackslash bool) {
+	// with backslash escapes, all the unsafe bytes are escaped already
+	if !escapeBackslash && bytes.ContainsAny(s.RawBytes, clientUnsafeBytes) {
+		fmt.Fprintf(bf, "x'%x'", s.RawBytes)
+		return
+	}
+	s.SQLTypeString.WriteToBuffer(bf, escapeBackslash)
+}
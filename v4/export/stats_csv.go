@@ -0,0 +1,78 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"strconv"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+// statsCSVPath is the file of the statistics of the dumped tables written with Config.EmitStatsCSV
+const statsCSVPath = "dump-stats.csv"
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// checksumFileWriterForStats computes the CRC-64 of the uncompressed bytes written into a data file
+type checksumFileWriterForStats struct {
+	storage.ExternalFileWriter
+	hash hash.Hash64
+}
+
+// withStatsChecksum wraps w to compute the checksum of the data file for the statistics if conf.EmitStatsCSV is set,
+// the returned checksum writer is nil otherwise
+func withStatsChecksum(conf *Config, w storage.ExternalFileWriter) (storage.ExternalFileWriter, *checksumFileWriterForStats) {
+	if !conf.EmitStatsCSV {
+		return w, nil
+	}
+	cw := &checksumFileWriterForStats{ExternalFileWriter: w, hash: crc64.New(crc64Table)}
+	return cw, cw
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *checksumFileWriterForStats) Write(ctx context.Context, p []byte) (int, error) {
+	n, err := w.ExternalFileWriter.Write(ctx, p)
+	_, _ = w.hash.Write(p[:n])
+	return n, err
+}
+
+// sum returns the CRC-64 of the bytes written, it's 0 if w is nil
+func (w *checksumFileWriterForStats) sum() uint64 {
+	if w == nil {
+		return 0
+	}
+	return w.hash.Sum64()
+}
+
+// writeStatsCSV writes the statistics of the dumped tables into statsCSVPath, one row per table
+func writeStatsCSV(tctx *tcontext.Context, extStore storage.ExternalStorage, results []TableDumpResult) error {
+	var bf bytes.Buffer
+	w := csv.NewWriter(&bf)
+	records := make([][]string, 0, len(results)+1)
+	records = append(records, []string{"database", "table", "rows", "bytes", "chunks", "duration_ms", "checksum"})
+	for _, result := range results {
+		records = append(records, []string{
+			result.Database,
+			result.Table,
+			strconv.FormatUint(result.Rows, 10),
+			strconv.FormatUint(result.Bytes, 10),
+			strconv.Itoa(result.Chunks),
+			strconv.FormatInt(int64(result.Duration/time.Millisecond), 10),
+			fmt.Sprintf("%016x", result.Checksum),
+		})
+	}
+	if err := w.WriteAll(records); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(extStore.WriteFile(tctx, statsCSVPath, bf.Bytes()))
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"hash/crc64"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestWriteTableDataStatsChecksum(c *C) {
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = c.MkDir()
+	config.EmitStatsCSV = true
+
+	writer := s.newWriter(config, c)
+	writer.tableStats = newTableStatsCollector()
+	data := [][]driver.Value{
+		{"1", "bob@mail.com"},
+		{"2", "sarah@mail.com"},
+	}
+	colTypes := []string{"INT", "VARCHAR"}
+	for i, tbl := range []string{"employee", "employee", "manager"} {
+		tableIR := newMockTableIR("test", tbl, data, nil, colTypes)
+		c.Assert(writer.WriteTableData(tableIR, tableIR, i), IsNil)
+	}
+
+	checksums := make(map[string]uint64)
+	for _, file := range []struct{ table, name string }{
+		{"employee", "test.employee.000000000.sql"},
+		{"employee", "test.employee.000000001.sql"},
+		{"manager", "test.manager.000000002.sql"},
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(config.OutputDirPath, file.name))
+		c.Assert(err, IsNil)
+		checksums[file.table] += crc64.Checksum(content, crc64Table)
+	}
+	results := writer.tableStats.results()
+	c.Assert(results, HasLen, 2)
+	c.Assert(results[0].Table, Equals, "employee")
+	c.Assert(results[0].Chunks, Equals, 2)
+	c.Assert(results[0].Rows, Equals, uint64(4))
+	c.Assert(results[0].Checksum, Equals, checksums["employee"])
+	c.Assert(results[1].Table, Equals, "manager")
+	c.Assert(results[1].Chunks, Equals, 1)
+	c.Assert(results[1].Checksum, Equals, checksums["manager"])
+}
+
+func (s *testUtilSuite) TestWriteStatsCSV(c *C) {
+	collector := newTableStatsCollector()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	collector.add("test", "t,1", tableChunkStats{rows: 10, bytes: 100, checksum: 1,
+		start: start.Add(time.Second), end: start.Add(3 * time.Second)})
+	collector.add("test", "t,1", tableChunkStats{rows: 5, bytes: 50, checksum: 2,
+		start: start, end: start.Add(1500 * time.Millisecond)})
+	collector.add("test", "t2", tableChunkStats{start: start, end: start.Add(time.Millisecond)})
+
+	dir := c.MkDir()
+	extStore, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	c.Assert(writeStatsCSV(tcontext.Background(), extStore, collector.results()), IsNil)
+	content, err := ioutil.ReadFile(filepath.Join(dir, statsCSVPath))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "database,table,rows,bytes,chunks,duration_ms,checksum\n"+
+		"test,\"t,1\",15,150,2,3000,0000000000000003\n"+
+		"test,t2,0,0,1,1,0000000000000000\n")
+}
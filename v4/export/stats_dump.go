@@ -0,0 +1,135 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb-tools/pkg/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// tableStatsFileSuffix is the suffix of the statistics file of a table, whose name is `{db}.{table}-stats.json`
+	// escaped like the schema files, so it can be matched to the table on restoration
+	tableStatsFileSuffix = "-stats.json"
+	// statsSnapshotLayout is the layout of the snapshot time of the stats dump API of TiDB,
+	// which is parsed in the time zone of the TiDB server
+	statsSnapshotLayout = "20060102150405"
+
+	statsDumpTimeout     = time.Minute
+	systemTimeZoneSQL    = "SELECT @@system_time_zone"
+	tidbStatsDumpAPIPath = "/stats/dump/"
+)
+
+// tableStatsFileName returns the name of the statistics file of the table
+func tableStatsFileName(db, table string) string {
+	return escapeFileName(db) + "." + escapeFileName(table) + tableStatsFileSuffix
+}
+
+// dumpTableStats writes the statistics of each base table to dump into its statistics file in JSON, fetched by
+// the stats dump API of a TiDB server at the snapshot of the dump. The JSON can be loaded by LOAD STATS, so the
+// optimizer doesn't start cold before the tables are analyzed again. It's only supported by TiDB, and it's skipped
+// with a warning if the statistics can't be fetched.
+func (d *Dumper) dumpTableStats(tctx *tcontext.Context, conn *sql.Conn) error {
+	conf := d.conf
+	if conf.ServerInfo.ServerType != ServerTypeTiDB {
+		return nil
+	}
+	statusAddrs, err := GetTiDBStatusAddrs(tctx, d.dbHandle)
+	if err != nil || len(statusAddrs) == 0 {
+		tctx.L().Warn("fail to get the status address of TiDB, skip dumping the statistics of tables", zap.Error(err))
+		return nil
+	}
+	snapshot, err := d.statsSnapshot(tctx, conn)
+	if err != nil {
+		tctx.L().Warn("fail to get the snapshot time of the statistics, skip dumping the statistics of tables", zap.Error(err))
+		return nil
+	}
+	client, scheme := &http.Client{Timeout: statsDumpTimeout}, "http"
+	if len(conf.Security.CAPath) > 0 {
+		tlsConfig, err := utils.ToTLSConfig(conf.Security.CAPath, conf.Security.CertPath, conf.Security.KeyPath)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+		scheme = "https"
+	}
+	baseURL := scheme + "://" + statusAddrs[0] + tidbStatsDumpAPIPath
+	tctx.L().Info("dump the statistics of tables", zap.String("url", baseURL), zap.String("snapshot", snapshot))
+	for db, tables := range conf.Tables {
+		for _, table := range tables {
+			if table.Type != TableTypeBase {
+				continue
+			}
+			data, err := fetchTableStats(tctx, client, baseURL, db, table.Name, snapshot)
+			if err != nil {
+				tctx.L().Warn("fail to fetch the statistics of table, skip it",
+					zap.String("database", db), zap.String("table", table.Name), zap.Error(err))
+				continue
+			}
+			if err = d.extStore.WriteFile(tctx, tableStatsFileName(db, table.Name), data); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
+}
+
+// statsSnapshot returns the snapshot of the dump in the layout of the stats dump API in the time zone of TiDB,
+// or "" for the latest statistics if the dump has no snapshot
+func (d *Dumper) statsSnapshot(tctx *tcontext.Context, conn *sql.Conn) (string, error) {
+	if d.conf.Snapshot == "" {
+		return "", nil
+	}
+	snapshotTS, err := parseSnapshotToTSO(d.dbHandle, d.conf.Snapshot)
+	if err != nil {
+		return "", err
+	}
+	var timeZone string
+	if err = conn.QueryRowContext(tctx, systemTimeZoneSQL).Scan(&timeZone); err != nil {
+		return "", errors.Annotatef(err, "sql: %s", systemTimeZoneSQL)
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return "", errors.Annotatef(err, "unknown system time zone '%s' of TiDB", timeZone)
+	}
+	ms := int64(snapshotTS >> tsoPhysicalShiftBits)
+	return time.Unix(0, ms*int64(time.Millisecond)).In(loc).Format(statsSnapshotLayout), nil
+}
+
+// fetchTableStats fetches the statistics of the table in JSON from the stats dump API at baseURL
+func fetchTableStats(tctx *tcontext.Context, client *http.Client, baseURL, db, table, snapshot string) ([]byte, error) {
+	u := baseURL + url.PathEscape(db) + "/" + url.PathEscape(table)
+	if snapshot != "" {
+		u += "/" + snapshot
+	}
+	req, err := http.NewRequestWithContext(tctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s: %s, %s", u, resp.Status, data)
+	}
+	if !json.Valid(data) {
+		return nil, errors.Errorf("GET %s: the statistics aren't valid JSON", u)
+	}
+	return data, nil
+}
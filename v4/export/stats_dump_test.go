@@ -0,0 +1,111 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestDumpTableStats(c *C) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.EscapedPath())
+		if strings.Contains(r.URL.Path, "/broken/") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"database_name":"test","table_name":"t","columns":{},"indices":{},"count":3,"modify_count":0}`))
+	}))
+	defer server.Close()
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	dir := c.MkDir()
+	conf := DefaultConfig()
+	conf.OutputDirPath = dir
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeTiDB}
+	snapshotTime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	conf.Snapshot = strconv.FormatUint(uint64(snapshotTime.UnixNano()/int64(time.Millisecond))<<tsoPhysicalShiftBits, 10)
+	conf.Tables = NewDatabaseTables().
+		AppendTables("test", "t", "a.b").
+		AppendViews("test", "v").
+		AppendTables("broken", "t")
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	d := &Dumper{tctx: tctx, conf: conf, extStore: extStore, dbHandle: db}
+
+	mock.ExpectQuery("SELECT \\* FROM information_schema.cluster_info where type = 'tidb'").
+		WillReturnRows(sqlmock.NewRows([]string{"TYPE", "INSTANCE", "STATUS_ADDRESS"}).
+			AddRow("tidb", "127.0.0.1:4000", strings.TrimPrefix(server.URL, "http://")))
+	mock.ExpectQuery("SELECT @@system_time_zone").
+		WillReturnRows(sqlmock.NewRows([]string{"@@system_time_zone"}).AddRow("UTC"))
+	c.Assert(d.dumpTableStats(tctx, conn), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the statistics of the base tables are fetched at the snapshot, the table failed is skipped
+	sort.Strings(requested)
+	c.Assert(requested, DeepEquals, []string{
+		"/stats/dump/broken/t/20210102030405",
+		"/stats/dump/test/a.b/20210102030405",
+		"/stats/dump/test/t/20210102030405",
+	})
+	for _, name := range []string{"test.t-stats.json", "test.a%2Eb-stats.json"} {
+		data, err := ioutil.ReadFile(path.Join(dir, name))
+		c.Assert(err, IsNil)
+		c.Assert(json.Valid(data), IsTrue)
+	}
+	_, err = os.Stat(path.Join(dir, "broken.t-stats.json"))
+	c.Assert(os.IsNotExist(err), IsTrue)
+
+	// it's a no-op for MySQL
+	requested = nil
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	c.Assert(d.dumpTableStats(tctx, conn), IsNil)
+	c.Assert(requested, HasLen, 0)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testSQLSuite) TestStatsSnapshot(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	d := &Dumper{conf: conf, dbHandle: db}
+	tctx := tcontext.Background().WithLogger(appLogger)
+	// the latest statistics are dumped without a snapshot
+	snapshot, err := d.statsSnapshot(tctx, conn)
+	c.Assert(err, IsNil)
+	c.Assert(snapshot, Equals, "")
+
+	// the snapshot is formatted in the time zone of TiDB
+	conf.Snapshot = strconv.FormatUint(uint64(time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC).UnixNano()/int64(time.Millisecond))<<tsoPhysicalShiftBits, 10)
+	mock.ExpectQuery("SELECT @@system_time_zone").
+		WillReturnRows(sqlmock.NewRows([]string{"@@system_time_zone"}).AddRow("Etc/GMT-8"))
+	snapshot, err = d.statsSnapshot(tctx, conn)
+	c.Assert(err, IsNil)
+	c.Assert(snapshot, Equals, "20210102110405")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	statsHealthManifestPath = "stats-health.json"
+
+	statsHealthySQL = "SHOW STATS_HEALTHY"
+	statsMetaSQL    = "SELECT t.TABLE_SCHEMA, t.TABLE_NAME, m.modify_count, m.count FROM mysql.stats_meta m " +
+		"JOIN INFORMATION_SCHEMA.TABLES t ON m.table_id = t.TIDB_TABLE_ID"
+)
+
+// tableStatsHealth is the health of the statistics of a table at dump time.
+// The fields are null if the table has no statistics.
+type tableStatsHealth struct {
+	Database    string `json:"database"`
+	Table       string `json:"table"`
+	Healthy     *int64 `json:"healthy"`
+	ModifyCount *int64 `json:"modify_count"`
+	Count       *int64 `json:"count"`
+}
+
+// dumpStatsHealth writes the health of the statistics of the base tables to dump into statsHealthManifestPath,
+// which helps to decide whether to analyze the tables after restoration. It's only supported by TiDB.
+func (d *Dumper) dumpStatsHealth(tctx *tcontext.Context, conn *sql.Conn) error {
+	conf := d.conf
+	if conf.ServerInfo.ServerType != ServerTypeTiDB {
+		tctx.L().Warn("the health of statistics is only dumped for TiDB, skip it",
+			zap.String("server type", conf.ServerInfo.ServerType.String()))
+		return nil
+	}
+	tables, err := collectStatsHealth(conn, conf.Tables)
+	if err != nil {
+		tctx.L().Warn("fail to collect the health of statistics, skip it", zap.Error(err))
+		return nil
+	}
+	return writeStatsHealth(tctx, d.extStore, tables)
+}
+
+// collectStatsHealth queries the health of the statistics of the base tables in allTables
+func collectStatsHealth(conn *sql.Conn, allTables DatabaseTables) ([]*tableStatsHealth, error) {
+	// database -> table -> health
+	healths := make(map[string]map[string]*tableStatsHealth, len(allTables))
+	tables := make([]*tableStatsHealth, 0)
+	for db, infos := range allTables {
+		healths[db] = make(map[string]*tableStatsHealth, len(infos))
+		for _, info := range infos {
+			if info.Type != TableTypeBase {
+				continue
+			}
+			h := &tableStatsHealth{Database: db, Table: info.Name}
+			healths[db][info.Name] = h
+			tables = append(tables, h)
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].Database != tables[j].Database {
+			return tables[i].Database < tables[j].Database
+		}
+		return tables[i].Table < tables[j].Table
+	})
+
+	err := simpleQuery(conn, statsHealthySQL, func(rows *sql.Rows) error {
+		var (
+			db, table, partition string
+			healthy              sql.NullInt64
+		)
+		if err := rows.Scan(&db, &table, &partition, &healthy); err != nil {
+			return errors.Trace(err)
+		}
+		// the partitions of partitioned tables have their own statistics, only the global one is recorded
+		if partition != "" && partition != "global" {
+			return nil
+		}
+		if h, ok := healths[db][table]; ok && healthy.Valid {
+			h.Healthy = &healthy.Int64
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = simpleQuery(conn, statsMetaSQL, func(rows *sql.Rows) error {
+		var (
+			db, table          string
+			modifyCount, count int64
+		)
+		if err := rows.Scan(&db, &table, &modifyCount, &count); err != nil {
+			return errors.Trace(err)
+		}
+		if h, ok := healths[db][table]; ok {
+			h.ModifyCount, h.Count = &modifyCount, &count
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+func writeStatsHealth(tctx *tcontext.Context, extStore storage.ExternalStorage, tables []*tableStatsHealth) error {
+	data, err := json.MarshalIndent(struct {
+		Tables []*tableStatsHealth `json:"tables"`
+	}{tables}, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(extStore.WriteFile(tctx, statsHealthManifestPath, data))
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"regexp"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestDumpStatsHealth(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	dir := c.MkDir()
+	conf := DefaultConfig()
+	conf.OutputDirPath = dir
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeTiDB}
+	conf.Tables = NewDatabaseTables().
+		AppendTables("test", "t1", "t2", "never_analyzed").
+		AppendViews("test", "v").
+		AppendTables("other", "p")
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	d := &Dumper{tctx: tctx, conf: conf, extStore: extStore}
+
+	mock.ExpectQuery(statsHealthySQL).WillReturnRows(
+		sqlmock.NewRows([]string{"Db_name", "Table_name", "Partition_name", "Healthy"}).
+			AddRow("test", "t1", "", 100).
+			AddRow("test", "t2", "", 40).
+			AddRow("other", "p", "p0", 10).
+			AddRow("other", "p", "global", 80).
+			AddRow("test", "not_dumped", "", 0))
+	mock.ExpectQuery(regexp.QuoteMeta(statsMetaSQL)).WillReturnRows(
+		sqlmock.NewRows([]string{"TABLE_SCHEMA", "TABLE_NAME", "modify_count", "count"}).
+			AddRow("test", "t1", 0, 1000).
+			AddRow("test", "t2", 600, 1000).
+			AddRow("other", "p", 20, 100))
+	c.Assert(d.dumpStatsHealth(tctx, conn), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	data, err := ioutil.ReadFile(path.Join(dir, statsHealthManifestPath))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `{
+  "tables": [
+    {
+      "database": "other",
+      "table": "p",
+      "healthy": 80,
+      "modify_count": 20,
+      "count": 100
+    },
+    {
+      "database": "test",
+      "table": "never_analyzed",
+      "healthy": null,
+      "modify_count": null,
+      "count": null
+    },
+    {
+      "database": "test",
+      "table": "t1",
+      "healthy": 100,
+      "modify_count": 0,
+      "count": 1000
+    },
+    {
+      "database": "test",
+      "table": "t2",
+      "healthy": 40,
+      "modify_count": 600,
+      "count": 1000
+    }
+  ]
+}`)
+}
@@ -10,35 +10,66 @@ import (
 	tcontext "github.com/pingcap/dumpling/v4/context"
 
 	"github.com/docker/go-units"
+	"github.com/pingcap/errors"
 	"go.uber.org/zap"
 )
 
 const logProgressTick = 2 * time.Minute
 
+// runLogProgress logs the progress and passes it to conf.OnProgress every conf.ProgressInterval, and once more when
+// it stops. With conf.OnProgress, the progress is logged no more often than every logProgressTick, so short intervals
+// don't flood the log.
 func (d *Dumper) runLogProgress(tctx *tcontext.Context) {
 	conf := d.conf
 	totalTables := float64(calculateTableCount(conf.Tables))
-	logProgressTicker := time.NewTicker(logProgressTick)
-	lastCheckpoint := time.Now()
+	interval := conf.ProgressInterval
+	if interval <= 0 {
+		interval = logProgressTick
+	}
+	logProgressTicker := time.NewTicker(interval)
+	lastCheckpoint, lastReported := time.Now(), time.Now()
 	lastBytes := float64(0)
+	var lastReportedRows, lastReportedBytes uint64
+	reportProgress := func() {
+		progress := d.readProgress(int(totalTables))
+		seconds := time.Since(lastReported).Seconds()
+		progress.RowsPerSecond = float64(progress.FinishedRows-lastReportedRows) / seconds
+		progress.BytesPerSecond = float64(progress.FinishedBytes-lastReportedBytes) / seconds
+		conf.OnProgress(progress)
+		lastReported, lastReportedRows, lastReportedBytes = time.Now(), progress.FinishedRows, progress.FinishedBytes
+	}
 	defer logProgressTicker.Stop()
 	for {
 		select {
 		case <-tctx.Done():
 			tctx.L().Debug("stopping log progress")
+			// the last progress is reported, so the callers see the final counts
+			if conf.OnProgress != nil {
+				reportProgress()
+			}
 			return
 		case <-logProgressTicker.C:
+			if conf.OnProgress != nil {
+				reportProgress()
+				if time.Since(lastCheckpoint) < logProgressTick {
+					continue
+				}
+			}
 			nanoseconds := float64(time.Since(lastCheckpoint).Nanoseconds())
 
 			completedTables := ReadCounter(finishedTablesCounter, conf.Labels)
 			finishedBytes := ReadCounter(finishedSizeCounter, conf.Labels)
 			finishedRows := ReadCounter(finishedRowsCounter, conf.Labels)
-			estimateTotalRows := ReadCounter(estimateTotalRowsCounter, conf.Labels)
+			// the rows aren't estimated with conf.SkipEstimate
+			estimateTotalRows := "unknown"
+			if !conf.SkipEstimate {
+				estimateTotalRows = fmt.Sprintf("%.0f", ReadCounter(estimateTotalRowsCounter, conf.Labels))
+			}
 
 			tctx.L().Info("progress",
 				zap.String("tables", fmt.Sprintf("%.0f/%.0f (%.1f%%)", completedTables, totalTables, completedTables/totalTables*100)),
 				zap.String("finished rows", fmt.Sprintf("%.0f", finishedRows)),
-				zap.String("estimate total rows", fmt.Sprintf("%.0f", estimateTotalRows)),
+				zap.String("estimate total rows", estimateTotalRows),
 				zap.String("finished size", units.HumanSize(finishedBytes)),
 				zap.Float64("average speed(MiB/s)", (finishedBytes-lastBytes)/(1048576e-9*nanoseconds)),
 			)
@@ -49,6 +80,23 @@ func (d *Dumper) runLogProgress(tctx *tcontext.Context) {
 	}
 }
 
+// readProgress reads the progress of the dump for conf.OnProgress, except the throughput
+func (d *Dumper) readProgress(totalTables int) DumpProgress {
+	labels := d.conf.Labels
+	progress := DumpProgress{
+		FinishedTables: int(readCounterOrZero(finishedTablesCounter, labels)),
+		TotalTables:    totalTables,
+		FinishedRows:   uint64(readCounterOrZero(finishedRowsCounter, labels)),
+		FinishedBytes:  uint64(readCounterOrZero(finishedSizeCounter, labels)),
+		Chunks:         d.progress.snapshot(),
+	}
+	progress.FinishedChunks, progress.TotalChunks = d.progress.chunkCounts()
+	if !d.conf.SkipEstimate {
+		progress.EstimateTotalRows = uint64(readCounterOrZero(estimateTotalRowsCounter, labels))
+	}
+	return progress
+}
+
 func calculateTableCount(m DatabaseTables) int {
 	cnt := 0
 	for _, tables := range m {
@@ -64,7 +112,11 @@ func calculateTableCount(m DatabaseTables) int {
 func (d *Dumper) getEstimateTotalRowsCount(tctx *tcontext.Context, conn *sql.Conn) error {
 	conf := d.conf
 	var totalCount uint64
+	d.tableEstimatedSize = make(map[string]map[string]uint64, len(conf.Tables))
+	d.tableEstimatedRows = make(map[string]map[string]uint64, len(conf.Tables))
 	for db, tables := range conf.Tables {
+		d.tableEstimatedSize[db] = make(map[string]uint64, len(tables))
+		d.tableEstimatedRows[db] = make(map[string]uint64, len(tables))
 		for _, m := range tables {
 			if m.Type == TableTypeBase {
 				// get pk or uk for explain
@@ -74,9 +126,49 @@ func (d *Dumper) getEstimateTotalRowsCount(tctx *tcontext.Context, conn *sql.Con
 				}
 				c := estimateCount(tctx, db, m.Name, conn, field, conf)
 				totalCount += c
+				d.tableEstimatedRows[db][m.Name] = c
+				d.progress.setEstimateRows(db, m.Name, c)
+				if conf.LargestFirst || conf.MaxEstimatedBytes > 0 {
+					d.tableEstimatedSize[db][m.Name] = estimateTableSize(tctx, conn, db, m.Name, c)
+				}
 			}
 		}
 	}
 	AddCounter(estimateTotalRowsCounter, conf.Labels, float64(totalCount))
 	return nil
 }
+
+// checkEstimatedSize returns an error if the estimated data size of all the tables exceeds conf.MaxEstimatedBytes
+func (d *Dumper) checkEstimatedSize() error {
+	var (
+		total, largestSize   uint64
+		largestDB, largestTb string
+	)
+	for db, tables := range d.tableEstimatedSize {
+		for table, size := range tables {
+			total += size
+			if size > largestSize {
+				largestDB, largestTb, largestSize = db, table, size
+			}
+		}
+	}
+	if total <= d.conf.MaxEstimatedBytes {
+		return nil
+	}
+	return errors.Errorf("the estimated data size %s exceeds the budget %s of max-estimated-bytes, the largest table is `%s`.`%s` of %s, "+
+		"please check the table filter or raise the budget",
+		units.BytesSize(float64(total)), units.BytesSize(float64(d.conf.MaxEstimatedBytes)),
+		escapeString(largestDB), escapeString(largestTb), units.BytesSize(float64(largestSize)))
+}
+
+// estimateTableSize estimates the data size of a table by its estimated rows and average row length.
+// If the average row length is unavailable, the estimated rows is returned.
+func estimateTableSize(tctx *tcontext.Context, conn *sql.Conn, db, table string, estimateRows uint64) uint64 {
+	avgRowLength, err := GetAVGRowLength(tctx, conn, db, table)
+	if err != nil || avgRowLength == 0 {
+		tctx.L().Debug("fail to get average row length, use estimate rows as table size",
+			zap.String("database", db), zap.String("table", table), zap.Error(err))
+		return estimateRows
+	}
+	return estimateRows * avgRowLength
+}
@@ -0,0 +1,494 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	subsetManifestPath = "subset.json"
+
+	defaultSubsetMaxDepth = 3
+	defaultSubsetMaxRows  = 100000
+	// subsetBatchSize is the number of the key values in an `IN` list read at once in the traversal
+	subsetBatchSize = 1000
+)
+
+// parseSubsetSeed parses Config.SubsetSeed in the format of `db.table:pk1,pk2`
+func parseSubsetSeed(spec string) (db, table string, values []string, err error) {
+	tablePart, valuesPart, ok := cutString(spec, ":")
+	if !ok {
+		return "", "", nil, errors.Errorf("subset seed `%s` should be in the format of db.table:pk1,pk2", spec)
+	}
+	db, table, ok = cutString(strings.TrimSpace(tablePart), ".")
+	if !ok || db == "" || table == "" {
+		return "", "", nil, errors.Errorf("subset seed `%s` only accepts a qualified table name", spec)
+	}
+	for _, value := range strings.Split(valuesPart, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return "", "", nil, errors.Errorf("no primary key value is specified in subset seed `%s`", spec)
+	}
+	return db, table, values, nil
+}
+
+// foreignKey is a foreign key whose child columns reference the parent columns
+type foreignKey struct {
+	childDB, childTable   string
+	childColumns          []string
+	parentDB, parentTable string
+	parentColumns         []string
+}
+
+// subsetKeys are the distinct values of the columns which the rows of a table in the subset are selected by
+type subsetKeys struct {
+	columns []string
+	seen    map[string]struct{}
+	values  [][]string
+}
+
+// subsetTable is a table reached by the traversal
+type subsetTable struct {
+	db, table string
+	// depth is the fewest foreign keys followed from the seed to reach the table
+	depth int
+	keys  []*subsetKeys
+}
+
+// add adds the values of columns, and returns the ones not added before
+func (t *subsetTable) add(columns []string, values [][]string) [][]string {
+	if len(values) == 0 {
+		return nil
+	}
+	var keys *subsetKeys
+	for _, k := range t.keys {
+		if equalStrings(k.columns, columns) {
+			keys = k
+			break
+		}
+	}
+	if keys == nil {
+		keys = &subsetKeys{columns: columns, seen: make(map[string]struct{})}
+		t.keys = append(t.keys, keys)
+	}
+	var added [][]string
+	for _, value := range values {
+		k := strings.Join(value, "\x00")
+		if _, ok := keys.seen[k]; ok {
+			continue
+		}
+		keys.seen[k] = struct{}{}
+		keys.values = append(keys.values, value)
+		added = append(added, value)
+	}
+	return added
+}
+
+// where returns the condition selecting the rows of the table in the subset
+func (t *subsetTable) where() string {
+	conditions := make([]string, 0, len(t.keys))
+	for _, k := range t.keys {
+		conditions = append(conditions, subsetInCondition(k.columns, k.values))
+	}
+	return strings.Join(conditions, " OR ")
+}
+
+// subsetStep reads the rows of a table selected by the new values of columns
+type subsetStep struct {
+	table   *subsetTable
+	columns []string
+	values  [][]string
+	depth   int
+	// down is whether the rows referencing the selected rows are followed, it's false for the rows reached
+	// by following the references upward, which are only read to keep the referential integrity
+	down bool
+}
+
+// subset is the referentially-consistent subset of the rows reached from Config.SubsetSeed by the foreign keys.
+// The rows referencing the reached rows are followed up to Config.SubsetMaxDepth foreign keys from the seed,
+// and the rows referenced by all the reached rows are always followed, so that no reference is dangling.
+type subset struct {
+	tables map[string]map[string]*subsetTable
+	// truncated is whether the traversal stops on Config.SubsetMaxRows, then the references may be dangling
+	truncated bool
+}
+
+// traverseSubset follows the foreign keys among the tables to dump from Config.SubsetSeed
+func traverseSubset(tctx *tcontext.Context, conn *sql.Conn, conf *Config) (*subset, error) {
+	db, table, values, err := parseSubsetSeed(conf.SubsetSeed)
+	if err != nil {
+		return nil, err
+	}
+	if !isBaseTableDumped(conf.Tables, db, table) {
+		return nil, errors.Errorf("the table `%s`.`%s` of the subset seed isn't dumped", db, table)
+	}
+	pkColumns, err := GetPrimaryKeyColumns(conn, db, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkColumns) != 1 {
+		return nil, errors.Errorf("the table `%s`.`%s` of the subset seed should have a primary key of one column", db, table)
+	}
+	fks, err := getForeignKeys(conn, conf.Tables)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &subset{tables: make(map[string]map[string]*subsetTable)}
+	seed := s.table(db, table, 0)
+	seedValues := make([][]string, 0, len(values))
+	for _, value := range values {
+		seedValues = append(seedValues, []string{value})
+	}
+	queue := []subsetStep{{table: seed, columns: pkColumns, values: seed.add(pkColumns, seedValues), down: true}}
+	// totalRows counts the rows read in the traversal, a row selected by several keys is counted more than once
+	totalRows := 0
+	for len(queue) > 0 {
+		step := queue[0]
+		queue = queue[1:]
+		t := step.table
+		var up, down []foreignKey
+		for _, fk := range fks {
+			if fk.childDB == t.db && fk.childTable == t.table {
+				up = append(up, fk)
+			}
+			if step.down && step.depth < conf.SubsetMaxDepth && fk.parentDB == t.db && fk.parentTable == t.table {
+				down = append(down, fk)
+			}
+		}
+		var columns []string
+		for _, fk := range up {
+			columns = appendMissingColumns(columns, fk.childColumns)
+		}
+		for _, fk := range down {
+			columns = appendMissingColumns(columns, fk.parentColumns)
+		}
+		rows, err := readSubsetRows(tctx, conn, t.db, t.table, columns, step.columns, step.values)
+		if err != nil {
+			return nil, err
+		}
+		totalRows += len(rows)
+		if totalRows > conf.SubsetMaxRows {
+			tctx.L().Warn("stop following the foreign keys of the subset, the rows read exceed the limit, the references may be dangling",
+				zap.Int("max rows", conf.SubsetMaxRows))
+			s.truncated = true
+			break
+		}
+		for _, fk := range up {
+			parent := s.table(fk.parentDB, fk.parentTable, step.depth+1)
+			added := parent.add(fk.parentColumns, subsetColumnValues(rows, columns, fk.childColumns))
+			if len(added) > 0 {
+				queue = append(queue, subsetStep{table: parent, columns: fk.parentColumns, values: added, depth: step.depth + 1})
+			}
+		}
+		for _, fk := range down {
+			child := s.table(fk.childDB, fk.childTable, step.depth+1)
+			added := child.add(fk.childColumns, subsetColumnValues(rows, columns, fk.parentColumns))
+			if len(added) > 0 {
+				queue = append(queue, subsetStep{table: child, columns: fk.childColumns, values: added, depth: step.depth + 1, down: true})
+			}
+		}
+	}
+	return s, nil
+}
+
+// table returns the table reached at depth, it's added if the table isn't reached before
+func (s *subset) table(db, table string, depth int) *subsetTable {
+	if s.tables[db] == nil {
+		s.tables[db] = make(map[string]*subsetTable)
+	}
+	t, ok := s.tables[db][table]
+	if !ok {
+		t = &subsetTable{db: db, table: table, depth: depth}
+		s.tables[db][table] = t
+	} else if depth < t.depth {
+		t.depth = depth
+	}
+	return t
+}
+
+// where returns the condition selecting the rows of the table in the subset, ok is false if no row is reached
+func (s *subset) where(db, table string) (string, bool) {
+	t, ok := s.tables[db][table]
+	if !ok || len(t.keys) == 0 {
+		return "", false
+	}
+	return t.where(), true
+}
+
+// getForeignKeys reads the foreign keys whose child and parent tables are both dumped
+func getForeignKeys(conn *sql.Conn, tables DatabaseTables) ([]foreignKey, error) {
+	query := "SELECT CONSTRAINT_NAME,TABLE_SCHEMA,TABLE_NAME,COLUMN_NAME,REFERENCED_TABLE_SCHEMA,REFERENCED_TABLE_NAME,REFERENCED_COLUMN_NAME " +
+		"FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE WHERE REFERENCED_TABLE_NAME IS NOT NULL " +
+		"ORDER BY TABLE_SCHEMA,TABLE_NAME,CONSTRAINT_NAME,ORDINAL_POSITION"
+	rows, err := conn.QueryContext(context.Background(), query)
+	if err != nil {
+		return nil, errors.Annotatef(err, "sql: %s", query)
+	}
+	defer rows.Close()
+	var (
+		fks                                 []foreignKey
+		name, lastName                      string
+		db, table, column                   string
+		parentDB, parentTable, parentColumn string
+	)
+	for rows.Next() {
+		if err = rows.Scan(&name, &db, &table, &column, &parentDB, &parentTable, &parentColumn); err != nil {
+			return nil, errors.Annotatef(err, "sql: %s", query)
+		}
+		if !isBaseTableDumped(tables, db, table) || !isBaseTableDumped(tables, parentDB, parentTable) {
+			continue
+		}
+		if n := len(fks); n > 0 && name == lastName && fks[n-1].childDB == db && fks[n-1].childTable == table {
+			fks[n-1].childColumns = append(fks[n-1].childColumns, column)
+			fks[n-1].parentColumns = append(fks[n-1].parentColumns, parentColumn)
+			continue
+		}
+		lastName = name
+		fks = append(fks, foreignKey{
+			childDB: db, childTable: table, childColumns: []string{column},
+			parentDB: parentDB, parentTable: parentTable, parentColumns: []string{parentColumn},
+		})
+	}
+	return fks, errors.Annotatef(rows.Err(), "sql: %s", query)
+}
+
+// readSubsetRows reads columns of the rows of the table whose keyColumns are in values
+func readSubsetRows(tctx *tcontext.Context, conn *sql.Conn, db, table string, columns, keyColumns []string, values [][]string) ([][]sql.NullString, error) {
+	fields := "1"
+	if len(columns) > 0 {
+		quoted := make([]string, 0, len(columns))
+		for _, col := range columns {
+			quoted = append(quoted, wrapBackTicks(escapeString(col)))
+		}
+		fields = strings.Join(quoted, ",")
+	}
+	var result [][]sql.NullString
+	for start := 0; start < len(values); start += subsetBatchSize {
+		end := start + subsetBatchSize
+		if end > len(values) {
+			end = len(values)
+		}
+		query := buildSelectQuery(db, table, fields, "", "WHERE "+subsetInCondition(keyColumns, values[start:end]), "")
+		err := func() error {
+			rows, err := conn.QueryContext(tctx, query)
+			if err != nil {
+				return errors.Annotatef(err, "sql: %s", query)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				row := make([]sql.NullString, len(columns))
+				dest := make([]interface{}, 0, len(columns))
+				for i := range row {
+					dest = append(dest, &row[i])
+				}
+				if len(dest) == 0 {
+					dest = append(dest, new(sql.RawBytes))
+				}
+				if err = rows.Scan(dest...); err != nil {
+					return errors.Annotatef(err, "sql: %s", query)
+				}
+				result = append(result, row)
+			}
+			return errors.Annotatef(rows.Err(), "sql: %s", query)
+		}()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// subsetInCondition returns the condition like `(a,b) IN (('1','2'),('3','4'))`
+func subsetInCondition(columns []string, values [][]string) string {
+	var bf strings.Builder
+	quoted := make([]string, 0, len(columns))
+	for _, col := range columns {
+		quoted = append(quoted, wrapBackTicks(escapeString(col)))
+	}
+	if len(columns) == 1 {
+		bf.WriteString(quoted[0])
+	} else {
+		bf.WriteString("(" + strings.Join(quoted, ",") + ")")
+	}
+	bf.WriteString(" IN (")
+	for i, value := range values {
+		if i > 0 {
+			bf.WriteByte(',')
+		}
+		if len(columns) > 1 {
+			bf.WriteByte('(')
+		}
+		for j, v := range value {
+			if j > 0 {
+				bf.WriteByte(',')
+			}
+			bf.WriteString("'" + escapeSQLString(v) + "'")
+		}
+		if len(columns) > 1 {
+			bf.WriteByte(')')
+		}
+	}
+	bf.WriteByte(')')
+	return bf.String()
+}
+
+// subsetColumnValues returns the values of keyColumns of rows which are read in columns,
+// the values containing NULL reference nothing, so they're ignored
+func subsetColumnValues(rows [][]sql.NullString, columns, keyColumns []string) [][]string {
+	indices := make([]int, 0, len(keyColumns))
+	for _, keyColumn := range keyColumns {
+		for i, col := range columns {
+			if col == keyColumn {
+				indices = append(indices, i)
+				break
+			}
+		}
+	}
+	values := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		value := make([]string, 0, len(indices))
+		for _, idx := range indices {
+			if !row[idx].Valid {
+				break
+			}
+			value = append(value, row[idx].String)
+		}
+		if len(value) == len(indices) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// isBaseTableDumped returns whether the base table is in the tables to dump
+func isBaseTableDumped(tables DatabaseTables, db, table string) bool {
+	for _, t := range tables[db] {
+		if t.Name == table && t.Type == TableTypeBase {
+			return true
+		}
+	}
+	return false
+}
+
+func appendMissingColumns(columns, added []string) []string {
+	for _, col := range added {
+		found := false
+		for _, c := range columns {
+			if c == col {
+				found = true
+				break
+			}
+		}
+		if !found {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// dumpSubsetTable dumps the rows of the table in the subset, the data of the tables not reached isn't dumped
+func (d *Dumper) dumpSubsetTable(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta, taskChan chan<- Task) error {
+	conf := d.conf
+	db, table := meta.DatabaseName(), meta.TableName()
+	where, ok := d.subset.where(db, table)
+	if !ok {
+		tctx.L().Info("skip dumping the data of table not reached from the subset seed",
+			zap.String("database", db), zap.String("table", table))
+		return nil
+	}
+	selectedField, selectLen, err := buildSelectFieldForMeta(conn, meta, conf.CompleteInsert)
+	if err != nil {
+		return err
+	}
+	orderByClause, err := buildOrderByClause(conf, conn, db, table)
+	if err != nil {
+		return err
+	}
+	query := buildSelectQuery(db, table, selectedField, "", buildTableWhereCondition(conf, meta, where), orderByClause)
+	task := NewTaskTableData(meta, &tableData{query: query, colLen: selectLen}, 0, 1)
+	if ctxDone := d.sendTaskToChan(tctx, task, taskChan); ctxDone {
+		return tctx.Err()
+	}
+	return nil
+}
+
+type subsetManifestTable struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Depth    int    `json:"depth"`
+	Rows     uint64 `json:"rows"`
+}
+
+type subsetManifest struct {
+	Seed      string                `json:"seed"`
+	MaxDepth  int                   `json:"max_depth"`
+	MaxRows   int                   `json:"max_rows"`
+	Truncated bool                  `json:"truncated"`
+	Tables    []subsetManifestTable `json:"tables"`
+}
+
+// write reports the tables included in the subset with the rows written into subsetManifestPath
+func (s *subset) write(tctx *tcontext.Context, extStore storage.ExternalStorage, conf *Config, results []TableDumpResult) error {
+	rows := make(map[string]map[string]uint64)
+	for _, result := range results {
+		if rows[result.Database] == nil {
+			rows[result.Database] = make(map[string]uint64)
+		}
+		rows[result.Database][result.Table] = result.Rows
+	}
+	manifest := subsetManifest{
+		Seed:      conf.SubsetSeed,
+		MaxDepth:  conf.SubsetMaxDepth,
+		MaxRows:   conf.SubsetMaxRows,
+		Truncated: s.truncated,
+		Tables:    []subsetManifestTable{},
+	}
+	for _, tables := range s.tables {
+		for _, t := range tables {
+			if len(t.keys) == 0 {
+				continue
+			}
+			manifest.Tables = append(manifest.Tables, subsetManifestTable{Database: t.db, Table: t.table, Depth: t.depth, Rows: rows[t.db][t.table]})
+			tctx.L().Info("include table in the subset", zap.String("database", t.db), zap.String("table", t.table),
+				zap.Int("depth", t.depth), zap.Uint64("rows", rows[t.db][t.table]))
+		}
+	}
+	sort.Slice(manifest.Tables, func(i, j int) bool {
+		if manifest.Tables[i].Database != manifest.Tables[j].Database {
+			return manifest.Tables[i].Database < manifest.Tables[j].Database
+		}
+		return manifest.Tables[i].Table < manifest.Tables[j].Table
+	})
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(extStore.WriteFile(tctx, subsetManifestPath, data))
+}
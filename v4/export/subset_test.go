@@ -0,0 +1,105 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"regexp"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestParseSubsetSeed(c *C) {
+	db, table, values, err := parseSubsetSeed("test.customers: 1, 2,")
+	c.Assert(err, IsNil)
+	c.Assert(db, Equals, "test")
+	c.Assert(table, Equals, "customers")
+	c.Assert(values, DeepEquals, []string{"1", "2"})
+
+	_, _, _, err = parseSubsetSeed("test.customers")
+	c.Assert(err, ErrorMatches, ".*should be in the format of db.table:pk1,pk2")
+	_, _, _, err = parseSubsetSeed("customers:1")
+	c.Assert(err, ErrorMatches, ".*only accepts a qualified table name")
+	_, _, _, err = parseSubsetSeed("test.customers:")
+	c.Assert(err, ErrorMatches, "no primary key value is specified.*")
+}
+
+func (s *testSQLSuite) TestTraverseSubset(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+
+	conf := defaultConfigForTest(c)
+	conf.SubsetSeed = "test.customers:1"
+	conf.SubsetMaxDepth = 2
+	conf.Tables = DatabaseTables{}.AppendTables("test", "customers", "orders", "items", "products", "logs")
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").WithArgs("test", "customers").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+	mock.ExpectQuery("SELECT CONSTRAINT_NAME,TABLE_SCHEMA,TABLE_NAME,COLUMN_NAME").WillReturnRows(
+		sqlmock.NewRows([]string{"CONSTRAINT_NAME", "TABLE_SCHEMA", "TABLE_NAME", "COLUMN_NAME", "REFERENCED_TABLE_SCHEMA", "REFERENCED_TABLE_NAME", "REFERENCED_COLUMN_NAME"}).
+			AddRow("fk_audit", "test", "audit", "customer_id", "test", "customers", "id").
+			AddRow("fk_order", "test", "items", "order_id", "test", "orders", "id").
+			AddRow("fk_product", "test", "items", "product_id", "test", "products", "id").
+			AddRow("fk_customer", "test", "orders", "customer_id", "test", "customers", "id"))
+	// the orders of the seed customer are followed down to their items
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id` FROM `test`.`customers` WHERE `id` IN ('1')")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `customer_id`,`id` FROM `test`.`orders` WHERE `customer_id` IN ('1')")).
+		WillReturnRows(sqlmock.NewRows([]string{"customer_id", "id"}).AddRow("1", "10").AddRow("1", "11"))
+	// the items are at the max depth, only the rows they reference are followed
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `order_id`,`product_id` FROM `test`.`items` WHERE `order_id` IN ('10','11')")).
+		WillReturnRows(sqlmock.NewRows([]string{"order_id", "product_id"}).AddRow("10", "100").AddRow("11", "100").AddRow("11", nil))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `customer_id` FROM `test`.`orders` WHERE `id` IN ('10','11')")).
+		WillReturnRows(sqlmock.NewRows([]string{"customer_id"}).AddRow("1").AddRow("1"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT 1 FROM `test`.`products` WHERE `id` IN ('100')")).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow("1"))
+
+	subset, err := traverseSubset(tctx, conn, conf)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(subset.truncated, IsFalse)
+	for table, expected := range map[string]string{
+		"customers": "`id` IN ('1')",
+		"orders":    "`customer_id` IN ('1') OR `id` IN ('10','11')",
+		"items":     "`order_id` IN ('10','11')",
+		"products":  "`id` IN ('100')",
+	} {
+		where, ok := subset.where("test", table)
+		c.Assert(ok, IsTrue)
+		c.Assert(where, Equals, expected)
+	}
+	_, ok := subset.where("test", "logs")
+	c.Assert(ok, IsFalse)
+	c.Assert(subset.tables["test"]["products"].depth, Equals, 3)
+}
+
+func (s *testSQLSuite) TestTraverseSubsetExceedingMaxRows(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+
+	conf := defaultConfigForTest(c)
+	conf.SubsetSeed = "test.customers:1,2"
+	conf.SubsetMaxRows = 1
+	conf.Tables = DatabaseTables{}.AppendTables("test", "customers")
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").WithArgs("test", "customers").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+	mock.ExpectQuery("SELECT CONSTRAINT_NAME,TABLE_SCHEMA,TABLE_NAME,COLUMN_NAME").WillReturnRows(
+		sqlmock.NewRows([]string{"CONSTRAINT_NAME", "TABLE_SCHEMA", "TABLE_NAME", "COLUMN_NAME", "REFERENCED_TABLE_SCHEMA", "REFERENCED_TABLE_NAME", "REFERENCED_COLUMN_NAME"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT 1 FROM `test`.`customers` WHERE `id` IN ('1','2')")).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow("1").AddRow("1"))
+
+	subset, err := traverseSubset(tctx, conn, conf)
+	c.Assert(err, IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(subset.truncated, IsTrue)
+}
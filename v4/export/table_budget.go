@@ -0,0 +1,102 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tableBudget is the wall-clock budget of dumping the data of a table with Config.PerTableBudget. It starts
+// when the first chunk of the table is written, and the chunks not started before it elapses are skipped.
+type tableBudget struct {
+	budget time.Duration
+	// deadline is the unix nanoseconds the budget elapses, it's 0 before the first chunk is written
+	deadline int64
+	skipped  int64
+}
+
+func tableBudgetOf(meta TableMeta) *tableBudget {
+	if tm, ok := meta.(*tableMeta); ok {
+		return tm.budget
+	}
+	return nil
+}
+
+// allow checks whether a chunk of the table can be written, the chunk is counted as skipped if not
+func (b *tableBudget) allow() bool {
+	if b == nil {
+		return true
+	}
+	now := time.Now().UnixNano()
+	atomic.CompareAndSwapInt64(&b.deadline, 0, now+int64(b.budget))
+	if now < atomic.LoadInt64(&b.deadline) {
+		return true
+	}
+	atomic.AddInt64(&b.skipped, 1)
+	return false
+}
+
+func (b *tableBudget) skippedChunks() int64 {
+	return atomic.LoadInt64(&b.skipped)
+}
+
+// tableBudgetRecorder records the budgets of the tables, so the partial tables are flagged in the metadata
+type tableBudgetRecorder struct {
+	budget time.Duration
+
+	mu      sync.Mutex
+	budgets map[TableMeta]*tableBudget
+	// metas are the tables in the order they are dumped
+	metas []TableMeta
+}
+
+func newTableBudgetRecorder(budget time.Duration) *tableBudgetRecorder {
+	return &tableBudgetRecorder{budget: budget, budgets: make(map[TableMeta]*tableBudget)}
+}
+
+// register gives meta a new budget
+func (r *tableBudgetRecorder) register(meta TableMeta) {
+	if r == nil {
+		return
+	}
+	tm, ok := meta.(*tableMeta)
+	if !ok {
+		return
+	}
+	tm.budget = &tableBudget{budget: r.budget}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.budgets[meta]; !ok {
+		r.metas = append(r.metas, meta)
+	}
+	r.budgets[meta] = tm.budget
+}
+
+// partialTables returns the tables whose chunks are skipped
+func (r *tableBudgetRecorder) partialTables() []TableMeta {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var metas []TableMeta
+	for _, meta := range r.metas {
+		if r.budgets[meta].skippedChunks() > 0 {
+			metas = append(metas, meta)
+		}
+	}
+	return metas
+}
+
+// recordPartialTables records the tables whose data is partially dumped because their chunks are skipped
+// after the budget elapses
+func (m *globalMetadata) recordPartialTables(r *tableBudgetRecorder) {
+	m.buffer.WriteString("PARTIAL TABLES:\n")
+	m.buffer.WriteString("\tBudget: " + r.budget.String() + "\n")
+	for _, meta := range r.partialTables() {
+		m.buffer.WriteString("\t" + wrapBackTicks(escapeString(meta.DatabaseName())) + "." +
+			wrapBackTicks(escapeString(meta.TableName())) + ": " +
+			strconv.FormatInt(tableBudgetOf(meta).skippedChunks(), 10) + " chunks skipped\n")
+	}
+	m.buffer.WriteString("\n")
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestWriteChunksWithTableBudget(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	colTypes, err := GetColumnTypes(conn, "*", "test", "t")
+	c.Assert(err, IsNil)
+	meta := &tableMeta{database: "test", table: "t", colTypes: colTypes, selectedField: "*"}
+	other := &tableMeta{database: "test", table: "t2"}
+	recorder := newTableBudgetRecorder(time.Hour)
+	recorder.register(meta)
+	recorder.register(other)
+
+	dir := c.MkDir()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = dir
+	conf.PerTableBudget = time.Hour
+	writer := s.newWriter(conf, c)
+	finishedTables := 0
+	writer.setFinishTableCallBack(func(Task) { finishedTables++ })
+	newTask := func(chunkIndex int) *TaskTableData {
+		data := newMockTableIR("test", "t", [][]driver.Value{{"1"}}, nil, []string{"INT"})
+		return NewTaskTableData(meta, data, chunkIndex, 3)
+	}
+
+	c.Assert(writer.handleTask(newTask(0)), IsNil)
+	_, err = os.Stat(path.Join(dir, "test.t.000000000.sql"))
+	c.Assert(err, IsNil)
+
+	// the budget elapses after the first chunk is written
+	atomic.StoreInt64(&meta.budget.deadline, time.Now().Add(-time.Second).UnixNano())
+	c.Assert(writer.handleTask(newTask(1)), IsNil)
+	c.Assert(writer.handleTask(newTask(2)), IsNil)
+	_, err = os.Stat(path.Join(dir, "test.t.000000001.sql"))
+	c.Assert(os.IsNotExist(err), IsTrue)
+	c.Assert(meta.budget.skippedChunks(), Equals, int64(2))
+	// the table is still finished by its last chunk
+	c.Assert(finishedTables, Equals, 1)
+
+	c.Assert(recorder.partialTables(), DeepEquals, []TableMeta{meta})
+	m := newGlobalMetadata(tcontext.Background(), nil, "")
+	m.recordPartialTables(recorder)
+	c.Assert(m.String(), Equals, "PARTIAL TABLES:\n\tBudget: 1h0m0s\n\t`test`.`t`: 2 chunks skipped\n\n")
+}
@@ -0,0 +1,225 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
+	"github.com/pingcap/tidb/errno"
+	"go.uber.org/zap"
+)
+
+const (
+	// TableErrorFail fails the dump when a table is dropped or altered during the dump
+	TableErrorFail = "fail"
+	// TableErrorSkip skips the table dropped or altered during the dump, and records it in the metadata
+	TableErrorSkip = "skip"
+	// TableErrorRetrySnapshot dumps the table dropped or altered during the dump again at the snapshot of TiDB,
+	// and skips it like TableErrorSkip if it still fails
+	TableErrorRetrySnapshot = "retry-snapshot"
+
+	// skippedTablesUnit is the name of the tables skipped by Config.OnTableError in the summary
+	skippedTablesUnit = "tables skipped for being dropped or altered"
+)
+
+func adjustOnTableError(conf *Config) error {
+	conf.OnTableError = strings.ToLower(conf.OnTableError)
+	switch conf.OnTableError {
+	case "":
+		conf.OnTableError = TableErrorFail
+		return nil
+	case TableErrorFail:
+		return nil
+	case TableErrorSkip, TableErrorRetrySnapshot:
+	default:
+		return errors.Errorf("unknown config.OnTableError '%s', please use '%s', '%s' or '%s'",
+			conf.OnTableError, TableErrorFail, TableErrorSkip, TableErrorRetrySnapshot)
+	}
+	switch {
+	case conf.SQL != "":
+		return errors.Errorf("config.OnTableError '%s' can't be used with config.SQL, there's no table to skip", conf.OnTableError)
+	case conf.VerifyChunkCount:
+		return errors.Errorf("config.OnTableError '%s' can't be used with config.VerifyChunkCount, the chunks of the skipped tables can't be counted",
+			conf.OnTableError)
+	}
+	return nil
+}
+
+// checkOnTableError is an initialization step of Dumper.
+func checkOnTableError(d *Dumper) error {
+	conf := d.conf
+	switch conf.OnTableError {
+	case TableErrorSkip:
+	case TableErrorRetrySnapshot:
+		if conf.ServerInfo.ServerType != ServerTypeTiDB || conf.Snapshot == "" {
+			return errors.Errorf("config.OnTableError '%s' requires the snapshot of TiDB, please set config.Snapshot or use '%s'",
+				TableErrorRetrySnapshot, TableErrorSkip)
+		}
+	default:
+		return nil
+	}
+	d.tableErrors = newTableErrorHandler(conf, d.dbHandle, d.connSessionParams)
+	return nil
+}
+
+// isTableChangedErr checks whether err is returned because the table is dropped or altered since the table list
+// is read, e.g. by DDL with consistency none. The other errors like the connection errors aren't, they're retried
+// by the backoffers instead.
+func isTableChangedErr(err error) bool {
+	mysqlErr, ok := errors.Cause(err).(*mysql.MySQLError)
+	if !ok {
+		return false
+	}
+	switch mysqlErr.Number {
+	case errno.ErrNoSuchTable, errno.ErrBadField, errno.ErrBadDB:
+		return true
+	default:
+		return false
+	}
+}
+
+// injectedTableNotExistErr returns the error of the table set by the failpoint TableNotExist as `db.table`,
+// as if it's dropped during the dump
+func injectedTableNotExistErr(db, table string) (err error) {
+	failpoint.Inject("TableNotExist", func(val failpoint.Value) {
+		if val.(string) == db+"."+table {
+			err = &mysql.MySQLError{Number: ErrNoSuchTable, Message: fmt.Sprintf("Table '%s.%s' doesn't exist", db, table)}
+		}
+	})
+	return
+}
+
+// tableErrorHandler handles the tables dropped or altered during the dump by Config.OnTableError, and records the
+// tables skipped. A nil tableErrorHandler handles nothing, so the dump fails with Config.OnTableError fail.
+type tableErrorHandler struct {
+	pool *sql.DB
+	// snapshotParams are the session params of the connections reading at Config.Snapshot, they're nil unless the
+	// tables are dumped again at the snapshot
+	snapshotParams map[string]interface{}
+
+	mu      sync.Mutex
+	skipped map[[2]string]string
+}
+
+func newTableErrorHandler(conf *Config, pool *sql.DB, sessionParams map[string]interface{}) *tableErrorHandler {
+	h := &tableErrorHandler{pool: pool, skipped: make(map[[2]string]string)}
+	if conf.OnTableError == TableErrorRetrySnapshot {
+		h.snapshotParams = make(map[string]interface{}, len(sessionParams)+1)
+		for k, v := range sessionParams {
+			h.snapshotParams[k] = v
+		}
+		h.snapshotParams[snapshotSessionParam] = conf.Snapshot
+	}
+	return h
+}
+
+// handles checks whether the table is skipped or dumped again at the snapshot when it fails with err
+func (h *tableErrorHandler) handles(err error) bool {
+	return h != nil && isTableChangedErr(err)
+}
+
+func (h *tableErrorHandler) retriesAtSnapshot() bool {
+	return h != nil && h.snapshotParams != nil
+}
+
+// snapshotConn opens a connection reading at the snapshot, where the table still exists as it's listed
+func (h *tableErrorHandler) snapshotConn(tctx *tcontext.Context) (*sql.Conn, error) {
+	return openConnWithSessionParams(tctx, h.pool, h.snapshotParams)
+}
+
+// skip records that the table is skipped because of err, with the error of the server without the query.
+// The data files written before are kept.
+func (h *tableErrorHandler) skip(tctx *tcontext.Context, db, table string, err error) {
+	key := [2]string{db, table}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.skipped[key]; ok {
+		return
+	}
+	h.skipped[key] = errors.Cause(err).Error()
+	tctx.L().Warn("skip the table which is dropped or altered during the dump",
+		zap.String("database", db), zap.String("table", table), zap.Error(err))
+}
+
+// isSkipped checks whether the table is skipped, so its other chunks aren't queried
+func (h *tableErrorHandler) isSkipped(db, table string) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.skipped[[2]string{db, table}]
+	return ok
+}
+
+// skippedTables returns the tables skipped with their errors, sorted by database and table name
+func (h *tableErrorHandler) skippedTables() []TableCheckFailure {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	tables := make([]TableCheckFailure, 0, len(h.skipped))
+	for key, msg := range h.skipped {
+		tables = append(tables, TableCheckFailure{Database: key[0], Table: key[1], Message: msg})
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].Database != tables[j].Database {
+			return tables[i].Database < tables[j].Database
+		}
+		return tables[i].Table < tables[j].Table
+	})
+	return tables
+}
+
+// recordSkippedTables records the tables skipped because they're dropped or altered during the dump
+func (m *globalMetadata) recordSkippedTables(tables []TableCheckFailure) {
+	m.buffer.WriteString("SKIPPED TABLES:\n")
+	for _, t := range tables {
+		m.buffer.WriteString("\t" + wrapBackTicks(escapeString(t.Database)) + "." +
+			wrapBackTicks(escapeString(t.Table)) + ": " + t.Message + "\n")
+	}
+	m.buffer.WriteString("\n")
+}
+
+// writeChunkAfterError handles the error of writing a chunk by Config.OnTableError. It returns whether the chunk
+// is written again at the snapshot, or nil if the table is skipped.
+func (w *Writer) writeChunkAfterError(t *TaskTableData, err error) (bool, error) {
+	if !w.tableErrors.handles(err) {
+		return false, err
+	}
+	db, table := t.Meta.DatabaseName(), t.Meta.TableName()
+	if w.tableErrors.retriesAtSnapshot() {
+		w.tctx.L().Warn("the table is dropped or altered during the dump, write the chunk again at the snapshot",
+			zap.String("database", db), zap.String("table", table), zap.Int("chunkIdx", t.ChunkIndex), zap.Error(err))
+		conn, err1 := w.tableErrors.snapshotConn(w.tctx)
+		if err1 != nil {
+			return false, err1
+		}
+		// the retries rebuild the connection at the snapshot too
+		attempt := *w
+		attempt.conn = conn
+		attempt.rebuildConnFn = func(conn *sql.Conn) (*sql.Conn, error) {
+			conn.Close()
+			return w.tableErrors.snapshotConn(w.tctx)
+		}
+		err = attempt.writeTableData(t.Meta, t.Data, t.ChunkIndex, t.ChunkField)
+		if attempt.conn != nil {
+			attempt.conn.Close()
+		}
+		if !w.tableErrors.handles(err) {
+			return err == nil, err
+		}
+	}
+	w.tableErrors.skip(w.tctx, db, table, err)
+	return false, nil
+}
@@ -0,0 +1,235 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
+	"github.com/pingcap/tidb/errno"
+)
+
+func (s *testConfigSuite) TestAdjustOnTableError(c *C) {
+	conf := DefaultConfig()
+	conf.OnTableError = ""
+	c.Assert(adjustOnTableError(conf), IsNil)
+	c.Assert(conf.OnTableError, Equals, TableErrorFail)
+	conf.OnTableError = "Skip"
+	c.Assert(adjustOnTableError(conf), IsNil)
+	c.Assert(conf.OnTableError, Equals, TableErrorSkip)
+	conf.VerifyChunkCount = true
+	c.Assert(adjustOnTableError(conf), ErrorMatches, "config.OnTableError 'skip' can't be used with config.VerifyChunkCount.*")
+	conf.VerifyChunkCount = false
+	conf.SQL = "SELECT 1"
+	c.Assert(adjustOnTableError(conf), ErrorMatches, "config.OnTableError 'skip' can't be used with config.SQL.*")
+	conf.OnTableError = "ignore"
+	c.Assert(adjustOnTableError(conf), ErrorMatches, "unknown config.OnTableError 'ignore'.*")
+
+	// the snapshot of TiDB is required to dump the tables again at it
+	conf = DefaultConfig()
+	conf.OnTableError = TableErrorRetrySnapshot
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	d := &Dumper{conf: conf}
+	c.Assert(checkOnTableError(d), ErrorMatches, "config.OnTableError 'retry-snapshot' requires the snapshot of TiDB.*")
+	conf.ServerInfo.ServerType = ServerTypeTiDB
+	conf.Snapshot = "420000000000000000"
+	c.Assert(checkOnTableError(d), IsNil)
+	c.Assert(d.tableErrors.retriesAtSnapshot(), IsTrue)
+	conf.OnTableError = TableErrorFail
+	d.tableErrors = nil
+	c.Assert(checkOnTableError(d), IsNil)
+	c.Assert(d.tableErrors, IsNil)
+}
+
+func (s *testWriterSuite) TestIsTableChangedErr(c *C) {
+	for _, t := range []struct {
+		err     error
+		changed bool
+	}{
+		{&mysql.MySQLError{Number: errno.ErrNoSuchTable}, true},
+		{errors.Annotate(&mysql.MySQLError{Number: errno.ErrBadField}, "sql: SELECT `a` FROM `test`.`t`"), true},
+		{newChunkError(&tableMeta{database: "test", table: "t"}, 0, nil, &mysql.MySQLError{Number: errno.ErrBadDB}), true},
+		{mysql.ErrInvalidConn, false},
+		{driver.ErrBadConn, false},
+		{&mysql.MySQLError{Number: errno.ErrTiKVServerTimeout}, false},
+		{nil, false},
+	} {
+		c.Assert(isTableChangedErr(t.err), Equals, t.changed, Commentf("error %v", t.err))
+	}
+	var h *tableErrorHandler
+	c.Assert(h.handles(&mysql.MySQLError{Number: errno.ErrNoSuchTable}), IsFalse)
+	c.Assert(h.isSkipped("test", "t"), IsFalse)
+	c.Assert(h.skippedTables(), IsNil)
+}
+
+func (s *testWriterSuite) TestWriteChunksOfDroppedTable(c *C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.Consistency = consistencyTypeNone
+	conf.OnTableError = TableErrorSkip
+	writer, rebuilt := s.newRetryWriter(conf, db, c)
+	writer.tableErrors = newTableErrorHandler(conf, db, nil)
+	chunk := func(table string, idx int) *TaskTableData {
+		meta := newMockTableIR("test", table, nil, nil, []string{"INT"})
+		return NewTaskTableData(meta, newTableData("SELECT * FROM `test`.`"+table+"`", 1, false), idx, 2)
+	}
+
+	// the dropped table is skipped without retries, and its other chunks aren't queried
+	mock.ExpectQuery("SELECT * FROM `test`.`t1`").
+		WillReturnError(&mysql.MySQLError{Number: errno.ErrNoSuchTable, Message: "Table 'test.t1' doesn't exist"})
+	c.Assert(writer.handleTask(chunk("t1", 0)), IsNil)
+	c.Assert(writer.handleTask(chunk("t1", 1)), IsNil)
+	c.Assert(*rebuilt, Equals, 0)
+	// the connection errors are still retried
+	mock.ExpectQuery("SELECT * FROM `test`.`t2`").WillReturnError(mysql.ErrInvalidConn)
+	mock.ExpectQuery("SELECT * FROM `test`.`t2`").WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1))
+	c.Assert(writer.handleTask(chunk("t2", 0)), IsNil)
+	c.Assert(*rebuilt, Equals, 1)
+	// the other errors still fail the dump
+	mock.ExpectQuery("SELECT * FROM `test`.`t2`").WillReturnError(&mysql.MySQLError{Number: errno.ErrParse, Message: "syntax error"})
+	c.Assert(writer.handleTask(chunk("t2", 1)), ErrorMatches, ".*syntax error.*")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	c.Assert(writer.tableErrors.skippedTables(), DeepEquals, []TableCheckFailure{
+		{Database: "test", Table: "t1", Message: "Error 1146: Table 'test.t1' doesn't exist"},
+	})
+	_, err = os.Stat(path.Join(conf.OutputDirPath, "test.t1.000000000.sql"))
+	c.Assert(os.IsNotExist(err), IsTrue)
+	_, err = os.Stat(path.Join(conf.OutputDirPath, "test.t2.000000000.sql"))
+	c.Assert(err, IsNil)
+
+	// the table isn't skipped with OnTableError fail
+	writer.tableErrors = nil
+	mock.ExpectQuery("SELECT * FROM `test`.`t3`").WillReturnError(&mysql.MySQLError{Number: errno.ErrNoSuchTable, Message: "Table 'test.t3' doesn't exist"})
+	c.Assert(writer.handleTask(chunk("t3", 0)), ErrorMatches, ".*Table 'test.t3' doesn't exist")
+}
+
+func (s *testWriterSuite) TestWriteChunkOfDroppedTableAtSnapshot(c *C) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.Consistency = consistencyTypeNone
+	conf.OnTableError = TableErrorRetrySnapshot
+	conf.Snapshot = "420000000000000000"
+	writer, _ := s.newRetryWriter(conf, db, c)
+	writer.tableErrors = newTableErrorHandler(conf, db, nil)
+	meta := newMockTableIR("test", "t", nil, nil, []string{"INT"})
+	query := "SELECT * FROM `test`.`t`"
+
+	// the chunk is written at the snapshot where the table still exists
+	mock.ExpectQuery(query).WillReturnError(&mysql.MySQLError{Number: errno.ErrNoSuchTable, Message: "Table 'test.t' doesn't exist"})
+	mock.ExpectExec("SET SESSION tidb_snapshot = ?").WithArgs(conf.Snapshot).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1).AddRow(2))
+	c.Assert(writer.handleTask(NewTaskTableData(meta, newTableData(query, 1, false), 0, 2)), IsNil)
+	bytes, err := ioutil.ReadFile(path.Join(conf.OutputDirPath, "test.t.000000000.sql"))
+	c.Assert(err, IsNil)
+	c.Assert(string(bytes), Equals, "INSERT INTO `t` VALUES\n(1),\n(2);\n")
+
+	// the table is skipped if it doesn't exist at the snapshot either
+	mock.ExpectQuery(query).WillReturnError(&mysql.MySQLError{Number: errno.ErrBadField, Message: "Unknown column 'a' in 'field list'"})
+	mock.ExpectExec("SET SESSION tidb_snapshot = ?").WithArgs(conf.Snapshot).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(query).WillReturnError(&mysql.MySQLError{Number: errno.ErrNoSuchTable, Message: "Table 'test.t' doesn't exist"})
+	c.Assert(writer.handleTask(NewTaskTableData(meta, newTableData(query, 1, false), 1, 2)), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(writer.tableErrors.isSkipped("test", "t"), IsTrue)
+}
+
+func (s *testSQLSuite) TestDumpDroppedTable(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.OnTableError = TableErrorSkip
+	d := &Dumper{tctx: tctx, conf: conf, tableErrors: newTableErrorHandler(conf, db, nil)}
+	mock.ExpectQuery("SELECT COLUMN_NAME").WithArgs("test", "t").
+		WillReturnError(&mysql.MySQLError{Number: errno.ErrNoSuchTable, Message: "Table 'test.t' doesn't exist"})
+	taskChan := make(chan Task, 1)
+	c.Assert(d.dumpTable(tctx, conn, "test", &TableInfo{Name: "t", Type: TableTypeBase}, taskChan), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	c.Assert(taskChan, HasLen, 0)
+	c.Assert(d.tableErrors.isSkipped("test", "t"), IsTrue)
+
+	// the skipped tables are reported in the result and the metadata
+	result := d.buildDumpResult(d.conf.SnapshotTime, nil)
+	c.Assert(result.SkippedTables, HasLen, 1)
+	c.Assert(result.SkippedTables[0].Table, Equals, "t")
+	m := newGlobalMetadata(tctx, nil, "")
+	m.recordSkippedTables(d.tableErrors.skippedTables())
+	c.Assert(m.buffer.String(), Equals, "SKIPPED TABLES:\n\t`test`.`t`: Error 1146: Table 'test.t' doesn't exist\n\n")
+}
+
+func (s *testWriterSuite) TestDumpWithDroppedTableByFailpoint(c *C) {
+	if !failpointsRewritten(c) {
+		c.Skip("the failpoints aren't enabled, run `make failpoint-enable` first")
+	}
+	fp := "github.com/pingcap/dumpling/v4/export/TableNotExist"
+	c.Assert(failpoint.Enable(fp, `return("test.t2")`), IsNil)
+	defer func() {
+		c.Assert(failpoint.Disable(fp), IsNil)
+	}()
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	conf.OnTableError = TableErrorSkip
+	extStore, err := conf.createExternalStorage(tctx)
+	c.Assert(err, IsNil)
+	d := &Dumper{tctx: tctx, conf: conf, dbHandle: db, extStore: extStore, tableErrors: newTableErrorHandler(conf, db, nil)}
+
+	// the meta of the table is read, then it's dropped before its data is dumped
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+	mock.ExpectQuery("SELECT COLUMN_NAME").WithArgs("test", "t2").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("id", ""))
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t2` LIMIT 1").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SHOW CREATE TABLE `test`.`t2`").
+		WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t2", "CREATE TABLE `t2` (`id` int)"))
+	taskChan := make(chan Task, 1)
+	c.Assert(d.dumpTable(tctx, conn, "test", &TableInfo{Name: "t2", Type: TableTypeBase}, taskChan), IsNil)
+	c.Assert(taskChan, HasLen, 0)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the chunks of the dropped table fail, and the other tables are still written
+	d.tableErrors = newTableErrorHandler(conf, db, nil)
+	writer := s.newWriter(conf, c)
+	writer.tableErrors = d.tableErrors
+	for _, table := range []string{"t1", "t2", "t3"} {
+		tableIR := newMockTableIR("test", table, [][]driver.Value{{"1"}}, nil, []string{"INT"})
+		c.Assert(writer.handleTask(NewTaskTableData(tableIR, tableIR, 0, 1)), IsNil)
+	}
+	files, err := ioutil.ReadDir(conf.OutputDirPath)
+	c.Assert(err, IsNil)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	c.Assert(strings.Join(names, ","), Equals, "test.t1.000000000.sql,test.t3.000000000.sql")
+	c.Assert(d.tableErrors.skippedTables(), DeepEquals, []TableCheckFailure{
+		{Database: "test", Table: "t2", Message: "Error 1146: Table 'test.t2' doesn't exist"},
+	})
+	c.Assert(d.buildDumpResult(conf.SnapshotTime, nil).SkippedTables, HasLen, 1)
+}
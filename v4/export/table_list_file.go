@@ -0,0 +1,126 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+// tableListAllTables is the table name of the entries in Config.TableListFile selecting a whole database
+const tableListAllTables = "*"
+
+// tableList is the entries of Config.TableListFile. The names are matched exactly, not as patterns.
+type tableList struct {
+	// databases is the referenced databases in the order they're first listed
+	databases []string
+	// tables is database -> listed tables, it's nil for the databases listed as `db.*`
+	tables map[string]map[string]struct{}
+}
+
+// parseTableListFile parses the newline-delimited `db.table` and `db.*` entries in the file at path.
+// Blank lines and the lines starting with `#` are skipped.
+func parseTableListFile(path string) (*tableList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "open table list file %s", path)
+	}
+	defer f.Close()
+
+	list := &tableList{tables: make(map[string]map[string]struct{})}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		db, tbl, ok := cutString(line, ".")
+		if !ok || db == "" || tbl == "" || db == tableListAllTables {
+			return nil, errors.Errorf("table list file %s only accepts `db.table` or `db.*` entries, but got `%s` at line %d", path, line, lineNo)
+		}
+		tables, listed := list.tables[db]
+		if !listed {
+			list.databases = append(list.databases, db)
+		}
+		switch {
+		case tbl == tableListAllTables:
+			list.tables[db] = nil
+		case listed && tables == nil:
+			// the database is already listed as a whole
+		case !listed:
+			list.tables[db] = map[string]struct{}{tbl: {}}
+		default:
+			tables[tbl] = struct{}{}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Annotatef(err, "read table list file %s", path)
+	}
+	if len(list.databases) == 0 {
+		return nil, errors.Errorf("table list file %s doesn't list any table", path)
+	}
+	return list, nil
+}
+
+// selectDatabases returns the databases referenced by the list, which must be in databases
+func (l *tableList) selectDatabases(databases []string) ([]string, error) {
+	dbMap := make(map[string]struct{}, len(databases))
+	for _, database := range databases {
+		dbMap[database] = struct{}{}
+	}
+	var notExistsDatabases []string
+	for _, database := range l.databases {
+		if _, ok := dbMap[database]; !ok {
+			notExistsDatabases = append(notExistsDatabases, database)
+		}
+	}
+	if len(notExistsDatabases) > 0 {
+		return nil, errors.Errorf("Unknown databases [%s] in the table list file, or they're not selected by --database",
+			strings.Join(notExistsDatabases, ","))
+	}
+	return l.databases, nil
+}
+
+// filterTablesByList keeps the tables of conf.Tables in the list, before they're filtered by conf.TableFilter
+func filterTablesByList(tctx *tcontext.Context, conf *Config, list *tableList) {
+	dbTables := DatabaseTables{}
+	for dbName, tables := range conf.Tables {
+		listedTables, ok := list.tables[dbName]
+		if !ok {
+			continue
+		}
+		if listedTables == nil {
+			dbTables[dbName] = tables
+			continue
+		}
+		dbTables[dbName] = make([]*TableInfo, 0, len(listedTables))
+		found := make(map[string]struct{}, len(listedTables))
+		for _, table := range tables {
+			if _, ok := listedTables[table.Name]; ok {
+				dbTables.AppendTable(dbName, table)
+				found[table.Name] = struct{}{}
+			}
+		}
+		for tbl := range listedTables {
+			if _, ok := found[tbl]; !ok {
+				tctx.L().Warn("table in the table list file doesn't exist, skip it",
+					zap.String("database", dbName), zap.String("table", tbl))
+			}
+		}
+	}
+	conf.Tables = dbTables
+}
+
+// adjustTableListFile checks conf.TableListFile isn't used with conf.StaticTableList, which isn't filtered
+func adjustTableListFile(conf *Config) error {
+	if conf.TableListFile != "" && len(conf.StaticTableList) > 0 {
+		return errors.New("config.TableListFile can't be used with config.StaticTableList, whose tables are dumped as is")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+func (s *testPrepareSuite) TestTableListFile(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+
+	listFile := path.Join(c.MkDir(), "tables.txt")
+	c.Assert(ioutil.WriteFile(listFile, []byte("# tables of the job\n"+
+		"db1.*\n"+
+		"db1.t1\n"+
+		"\n"+
+		"  db2.t3  \n"+
+		"db2.t5\n"+
+		"db2.missing\n"+
+		"# db4.t9\n"+
+		"db3.v1\n"), 0o644), IsNil)
+	conf := defaultConfigForTest(c)
+	conf.TableListFile = listFile
+	conf.NoViews = false
+	// the listed tables are intersected with the filter
+	conf.TableFilter, err = ParseTableFilter(nil, []string{"*.*", "!db1.t2"})
+	c.Assert(err, IsNil)
+
+	mock.ExpectQuery("SHOW DATABASES").WillReturnRows(sqlmock.NewRows([]string{"Database"}).
+		AddRow("db1").AddRow("db2").AddRow("db3").AddRow("db4"))
+	mock.ExpectQuery("SELECT table_schema,table_name FROM information_schema.tables WHERE table_type = 'BASE TABLE'").
+		WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name"}).
+			AddRow("db1", "t1").AddRow("db1", "t2").
+			AddRow("db2", "t3").AddRow("db2", "t4").AddRow("db2", "t5").
+			AddRow("db3", "t6").
+			AddRow("db4", "t9"))
+	mock.ExpectQuery("SELECT table_schema,table_name FROM information_schema.tables WHERE table_type = 'VIEW'").
+		WillReturnRows(sqlmock.NewRows([]string{"table_schema", "table_name"}).
+			AddRow("db1", "v0").AddRow("db3", "v1"))
+	c.Assert(prepareTableListToDump(tctx, conf, conn), IsNil)
+	c.Assert(conf.Tables, DeepEquals, NewDatabaseTables().
+		AppendTables("db1", "t1").
+		AppendViews("db1", "v0").
+		AppendTables("db2", "t3", "t5").
+		AppendViews("db3", "v1"))
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	// the referenced databases must exist
+	mock.ExpectQuery("SHOW DATABASES").WillReturnRows(sqlmock.NewRows([]string{"Database"}).AddRow("db1"))
+	c.Assert(prepareTableListToDump(tctx, conf, conn), ErrorMatches, `Unknown databases \[db2,db3\] in the table list file.*`)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	for _, entry := range []string{"t1", "db1.", ".t1", "*.t1"} {
+		c.Assert(ioutil.WriteFile(listFile, []byte(entry+"\n"), 0o644), IsNil)
+		_, err = parseTableListFile(listFile)
+		c.Assert(err, ErrorMatches, "table list file .* only accepts `db.table` or `db.\\*` entries.*line 1", Commentf("entry %s", entry))
+	}
+	c.Assert(ioutil.WriteFile(listFile, []byte("# nothing\n\n"), 0o644), IsNil)
+	_, err = parseTableListFile(listFile)
+	c.Assert(err, ErrorMatches, "table list file .* doesn't list any table")
+
+	conf.StaticTableList = []string{"db1.t1"}
+	c.Assert(adjustTableListFile(conf), ErrorMatches, "config.TableListFile can't be used with config.StaticTableList.*")
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	tableEngineRegexp    = regexp.MustCompile(`(?i)\bENGINE\s*=\s*\w+`)
+	tableCharsetRegexp   = regexp.MustCompile(`(?i)\s*(DEFAULT\s+)?(CHARSET|CHARACTER\s+SET)\s*=?\s*\w+`)
+	tableCollateRegexp   = regexp.MustCompile(`(?i)\s*(DEFAULT\s+)?COLLATE\s*=?\s*\w+`)
+	columnCharsetRegexp  = regexp.MustCompile(`(?i)\bCHARACTER\s+SET\s+\w+`)
+	columnCollateRegexp  = regexp.MustCompile(`(?i)\s+COLLATE\s+\w+`)
+	tableOptionRegexp    = regexp.MustCompile(`^\w+$`)
+	partitionByRegexp    = regexp.MustCompile(`(?i)\s*(/\*!\d*\s*)?PARTITION\s+BY\b`)
+	quotedLiteralPattern = regexp.MustCompile("'(?:[^'\\\\]|\\\\.|'')*'|\"(?:[^\"\\\\]|\\\\.|\"\")*\"|`(?:[^`]|``)*`")
+	placeholderRegexp    = regexp.MustCompile("\x00([0-9]+)\x00")
+	columnCommentRegexp  = regexp.MustCompile("(?i)\\s+COMMENT\\s+\x00([0-9]+)\x00")
+	tableCommentRegexp   = regexp.MustCompile("(?i)\\s*\\bCOMMENT\\s*=?\\s*\x00([0-9]+)\x00")
+)
+
+// rewriteTableOptions rewrites the ENGINE, DEFAULT CHARSET and COLLATE table options of createTableSQL
+// according to conf.ForceEngine, conf.ForceCharset and conf.ForceCollation. The character sets and
+// collations of the columns are rewritten too if conf.ForceColumnCharset is set.
+func rewriteTableOptions(conf *Config, createTableSQL string) string {
+	engine, charset, collation := conf.ForceEngine, conf.ForceCharset, conf.ForceCollation
+	if engine == "" && charset == "" && collation == "" {
+		return createTableSQL
+	}
+	if charset == "" && collation != "" {
+		charset = collationCharset(collation)
+	}
+	// the global temporary tables of TiDB only support the memory engine
+	if globalTemporaryTableRegexp.MatchString(createTableSQL) {
+		engine = ""
+	}
+
+	// hide the quoted identifiers and strings, so the options in names and comments won't be rewritten
+	var literals []string
+	stmt := quotedLiteralPattern.ReplaceAllStringFunc(createTableSQL, func(literal string) string {
+		literals = append(literals, literal)
+		return fmt.Sprintf("\x00%d\x00", len(literals)-1)
+	})
+	end := closingParenIndex(stmt)
+	if end < 0 {
+		return createTableSQL
+	}
+	columns, options := stmt[:end+1], stmt[end+1:]
+
+	if engine != "" {
+		if tableEngineRegexp.MatchString(options) {
+			options = tableEngineRegexp.ReplaceAllString(options, "ENGINE="+engine)
+		} else {
+			options = " ENGINE=" + engine + options
+		}
+	}
+	if charset != "" {
+		options = tableCollateRegexp.ReplaceAllString(tableCharsetRegexp.ReplaceAllString(options, ""), "")
+		clause := " DEFAULT CHARSET=" + charset
+		if collation != "" {
+			clause += " COLLATE=" + collation
+		}
+		// keep the character set after the engine like `SHOW CREATE TABLE` does
+		pos := 0
+		if loc := tableEngineRegexp.FindStringIndex(options); loc != nil {
+			pos = loc[1]
+		}
+		options = options[:pos] + clause + options[pos:]
+
+		if conf.ForceColumnCharset {
+			columns = columnCharsetRegexp.ReplaceAllString(columns, "CHARACTER SET "+charset)
+			collateClause := ""
+			if collation != "" {
+				collateClause = " COLLATE " + collation
+			}
+			columns = columnCollateRegexp.ReplaceAllString(columns, collateClause)
+		}
+	}
+
+	return placeholderRegexp.ReplaceAllStringFunc(columns+options, func(placeholder string) string {
+		idx, _ := strconv.Atoi(strings.Trim(placeholder, "\x00"))
+		return literals[idx]
+	})
+}
+
+// stripPartitioning removes the PARTITION BY clause from createTableSQL, together with the version comment
+// which MySQL wraps it in, so the table is created as a non-partitioned table
+func stripPartitioning(createTableSQL string) string {
+	// hide the quoted identifiers and strings, so the clause in names and comments won't be removed
+	var literals []string
+	stmt := quotedLiteralPattern.ReplaceAllStringFunc(createTableSQL, func(literal string) string {
+		literals = append(literals, literal)
+		return fmt.Sprintf("\x00%d\x00", len(literals)-1)
+	})
+	end := closingParenIndex(stmt)
+	if end < 0 {
+		return createTableSQL
+	}
+	columns, options := stmt[:end+1], stmt[end+1:]
+	loc := partitionByRegexp.FindStringSubmatchIndex(options)
+	if loc == nil {
+		return createTableSQL
+	}
+	rest := ""
+	if loc[2] >= 0 {
+		// the clause ends with the version comment, e.g. /*!50100 PARTITION BY RANGE (id) (...) */
+		if idx := strings.Index(options[loc[1]:], "*/"); idx >= 0 {
+			rest = options[loc[1]+idx+len("*/"):]
+		}
+	}
+	options = options[:loc[0]] + rest
+	return placeholderRegexp.ReplaceAllStringFunc(columns+options, func(placeholder string) string {
+		return literals[placeholderIndex(placeholder)]
+	})
+}
+
+// stripComments removes the COMMENT clauses of the columns and the indexes from createTableSQL if columns is set,
+// and the COMMENT table option if table is set. The comments of the partitions are kept.
+func stripComments(createTableSQL string, columns, table bool) string {
+	if !columns && !table {
+		return createTableSQL
+	}
+	// hide the quoted identifiers and strings, so the clauses in names, defaults and the comments themselves won't be matched
+	var literals []string
+	stmt := quotedLiteralPattern.ReplaceAllStringFunc(createTableSQL, func(literal string) string {
+		literals = append(literals, literal)
+		return fmt.Sprintf("\x00%d\x00", len(literals)-1)
+	})
+	end := closingParenIndex(stmt)
+	if end < 0 {
+		return createTableSQL
+	}
+	definitions, options := stmt[:end+1], stmt[end+1:]
+	if columns {
+		definitions = replaceComments(columnCommentRegexp, definitions, literals)
+	}
+	if table {
+		partitioning := ""
+		if loc := partitionByRegexp.FindStringIndex(options); loc != nil {
+			options, partitioning = options[:loc[0]], options[loc[0]:]
+		}
+		options = replaceComments(tableCommentRegexp, options, literals) + partitioning
+	}
+	return placeholderRegexp.ReplaceAllStringFunc(definitions+options, func(placeholder string) string {
+		return literals[placeholderIndex(placeholder)]
+	})
+}
+
+// replaceComments removes the COMMENT clauses matched by re from stmt whose literals are hidden,
+// the clauses followed by a quoted identifier instead of a string are kept
+func replaceComments(re *regexp.Regexp, stmt string, literals []string) string {
+	return re.ReplaceAllStringFunc(stmt, func(clause string) string {
+		literal := literals[placeholderIndex(re.FindStringSubmatch(clause)[1])]
+		if literal[0] == '`' {
+			return clause
+		}
+		return ""
+	})
+}
+
+// closingParenIndex returns the index of the parenthesis which closes the first one in stmt, -1 if not found
+func closingParenIndex(stmt string) int {
+	depth := 0
+	for i := 0; i < len(stmt); i++ {
+		switch stmt[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// collationCharset returns the character set of collation, e.g. utf8mb4 for utf8mb4_general_ci
+func collationCharset(collation string) string {
+	if idx := strings.Index(collation, "_"); idx > 0 {
+		return collation[:idx]
+	}
+	return collation
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestRewriteTableOptions(c *C) {
+	createTableSQL := "CREATE TABLE `t` (\n" +
+		"  `a` int(11) NOT NULL,\n" +
+		"  `b` varchar(10) CHARACTER SET latin1 COLLATE latin1_bin DEFAULT NULL COMMENT 'ENGINE=MyISAM',\n" +
+		"  PRIMARY KEY (`a`)\n" +
+		") ENGINE=MyISAM AUTO_INCREMENT=3 DEFAULT CHARSET=latin1 COLLATE=latin1_bin COMMENT='DEFAULT CHARSET=latin1'"
+	partitionSQL := "CREATE TABLE `p` (\n  `a` int(11) DEFAULT NULL\n) ENGINE=MyISAM DEFAULT CHARSET=latin1\n" +
+		"/*!50100 PARTITION BY RANGE (`a`)\n(PARTITION p0 VALUES LESS THAN (10) ENGINE = MyISAM) */"
+
+	testCases := []struct {
+		engine, charset, collation string
+		columns                    bool
+		origin, expected           string
+	}{
+		{"", "", "", false, createTableSQL, createTableSQL},
+		{
+			"InnoDB", "", "utf8mb4_bin", false, createTableSQL,
+			"CREATE TABLE `t` (\n" +
+				"  `a` int(11) NOT NULL,\n" +
+				"  `b` varchar(10) CHARACTER SET latin1 COLLATE latin1_bin DEFAULT NULL COMMENT 'ENGINE=MyISAM',\n" +
+				"  PRIMARY KEY (`a`)\n" +
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin AUTO_INCREMENT=3 COMMENT='DEFAULT CHARSET=latin1'",
+		},
+		{
+			"", "utf8mb4", "", true, createTableSQL,
+			"CREATE TABLE `t` (\n" +
+				"  `a` int(11) NOT NULL,\n" +
+				"  `b` varchar(10) CHARACTER SET utf8mb4 DEFAULT NULL COMMENT 'ENGINE=MyISAM',\n" +
+				"  PRIMARY KEY (`a`)\n" +
+				") ENGINE=MyISAM DEFAULT CHARSET=utf8mb4 AUTO_INCREMENT=3 COMMENT='DEFAULT CHARSET=latin1'",
+		},
+		{
+			"InnoDB", "", "", false, partitionSQL,
+			"CREATE TABLE `p` (\n  `a` int(11) DEFAULT NULL\n) ENGINE=InnoDB DEFAULT CHARSET=latin1\n" +
+				"/*!50100 PARTITION BY RANGE (`a`)\n(PARTITION p0 VALUES LESS THAN (10) ENGINE=InnoDB) */",
+		},
+		{"", "utf8mb4", "utf8mb4_bin", false, "CREATE TABLE `(t` (`a` int)", "CREATE TABLE `(t` (`a` int) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin"},
+	}
+	conf := DefaultConfig()
+	for _, t := range testCases {
+		conf.ForceEngine, conf.ForceCharset, conf.ForceCollation, conf.ForceColumnCharset = t.engine, t.charset, t.collation, t.columns
+		c.Assert(rewriteTableOptions(conf, t.origin), Equals, t.expected, Commentf("case %+v", t))
+	}
+}
+
+func (s *testSQLSuite) TestAdjustTableOptions(c *C) {
+	conf := DefaultConfig()
+	conf.ForceEngine = "InnoDB"
+	conf.ForceCharset = "utf8mb4"
+	conf.ForceCollation = "utf8mb4_general_ci"
+	c.Assert(adjustTableOptions(conf), IsNil)
+	conf.ForceCollation = "latin1_bin"
+	c.Assert(adjustTableOptions(conf), ErrorMatches, "config.ForceCollation 'latin1_bin' doesn't belong to config.ForceCharset 'utf8mb4'")
+	conf.ForceCollation = ""
+	conf.ForceEngine = "InnoDB; DROP TABLE t"
+	c.Assert(adjustTableOptions(conf), ErrorMatches, "invalid config.ForceEngine .*")
+}
+
+func (s *testSQLSuite) TestStripPartitioning(c *C) {
+	// TiDB writes the clause as is
+	createTableSQL := "CREATE TABLE `t` (\n" +
+		"  `id` int(11) NOT NULL COMMENT 'PARTITION BY id',\n" +
+		"  `created` date NOT NULL\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin\n" +
+		"PARTITION BY RANGE ( `id` ) (\n" +
+		"  PARTITION `p0` VALUES LESS THAN (10),\n" +
+		"  PARTITION `p1` VALUES LESS THAN (MAXVALUE) COMMENT 'the */ rest'\n" +
+		")"
+	c.Assert(stripPartitioning(createTableSQL), Equals, "CREATE TABLE `t` (\n"+
+		"  `id` int(11) NOT NULL COMMENT 'PARTITION BY id',\n"+
+		"  `created` date NOT NULL\n"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin")
+
+	// MySQL wraps the clause in a version comment
+	createTableSQL = "CREATE TABLE `t` (\n" +
+		"  `id` int NOT NULL\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4\n" +
+		"/*!50100 PARTITION BY RANGE (`id`)\n" +
+		"(PARTITION p0 VALUES LESS THAN (10) ENGINE = InnoDB,\n" +
+		" PARTITION p1 VALUES LESS THAN MAXVALUE ENGINE = InnoDB) */"
+	c.Assert(stripPartitioning(createTableSQL), Equals, "CREATE TABLE `t` (\n"+
+		"  `id` int NOT NULL\n"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+
+	createTableSQL = "CREATE TABLE `t` (\n  `id` int NOT NULL\n) ENGINE=InnoDB"
+	c.Assert(stripPartitioning(createTableSQL), Equals, createTableSQL)
+}
+
+func (s *testSQLSuite) TestStripComments(c *C) {
+	createTableSQL := "CREATE TABLE `comment` (\n" +
+		"  `id` int(11) NOT NULL COMMENT 'it''s the \"id\", COMMENT ''x''',\n" +
+		"  `note` varchar(64) DEFAULT ' COMMENT ''default''' COMMENT 'escaped \\' and \\\\ 注释 ☃',\n" +
+		"  `comment` int(11) DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `idx` (`note`) COMMENT 'index, with ) paren'\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='table ''comment'' ENGINE=x'\n" +
+		"PARTITION BY RANGE ( `id` ) (\n" +
+		"  PARTITION `p0` VALUES LESS THAN (10) COMMENT = 'partition'\n" +
+		")"
+	columnsStripped := "CREATE TABLE `comment` (\n" +
+		"  `id` int(11) NOT NULL,\n" +
+		"  `note` varchar(64) DEFAULT ' COMMENT ''default''',\n" +
+		"  `comment` int(11) DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `idx` (`note`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='table ''comment'' ENGINE=x'\n" +
+		"PARTITION BY RANGE ( `id` ) (\n" +
+		"  PARTITION `p0` VALUES LESS THAN (10) COMMENT = 'partition'\n" +
+		")"
+	tableStripped := "CREATE TABLE `comment` (\n" +
+		"  `id` int(11) NOT NULL COMMENT 'it''s the \"id\", COMMENT ''x''',\n" +
+		"  `note` varchar(64) DEFAULT ' COMMENT ''default''' COMMENT 'escaped \\' and \\\\ 注释 ☃',\n" +
+		"  `comment` int(11) DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `idx` (`note`) COMMENT 'index, with ) paren'\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4\n" +
+		"PARTITION BY RANGE ( `id` ) (\n" +
+		"  PARTITION `p0` VALUES LESS THAN (10) COMMENT = 'partition'\n" +
+		")"
+	bothStripped := "CREATE TABLE `comment` (\n" +
+		"  `id` int(11) NOT NULL,\n" +
+		"  `note` varchar(64) DEFAULT ' COMMENT ''default''',\n" +
+		"  `comment` int(11) DEFAULT NULL,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  KEY `idx` (`note`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4\n" +
+		"PARTITION BY RANGE ( `id` ) (\n" +
+		"  PARTITION `p0` VALUES LESS THAN (10) COMMENT = 'partition'\n" +
+		")"
+	c.Assert(stripComments(createTableSQL, false, false), Equals, createTableSQL)
+	c.Assert(stripComments(createTableSQL, true, false), Equals, columnsStripped)
+	c.Assert(stripComments(createTableSQL, false, true), Equals, tableStripped)
+	c.Assert(stripComments(createTableSQL, true, true), Equals, bothStripped)
+
+	// the table comment written without the equal sign
+	c.Assert(stripComments("CREATE TABLE `t` (`a` int) ENGINE=InnoDB COMMENT 'x'", false, true), Equals, "CREATE TABLE `t` (`a` int) ENGINE=InnoDB")
+}
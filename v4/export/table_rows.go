@@ -0,0 +1,52 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// ParseTableRows parses the rows of each chunk of the tables in the format of `db.table:n`
+// into database -> table -> rows
+func ParseTableRows(specs []string) (map[string]map[string]uint64, error) {
+	result := make(map[string]map[string]uint64)
+	for _, spec := range specs {
+		tablePart, rowsPart, ok := cutString(spec, ":")
+		if !ok {
+			return nil, errors.Errorf("table rows `%s` should be in the format of db.table:n", spec)
+		}
+		db, tbl, ok := cutString(strings.TrimSpace(tablePart), ".")
+		if !ok || db == "" || tbl == "" {
+			return nil, errors.Errorf("table rows `%s` only accepts qualified table names", spec)
+		}
+		if _, ok := result[db][tbl]; ok {
+			return nil, errors.Errorf("rows of table `%s`.`%s` are specified more than once", db, tbl)
+		}
+		rows, err := strconv.ParseUint(strings.TrimSpace(rowsPart), 10, 64)
+		if err != nil || rows == 0 {
+			return nil, errors.Errorf("rows of table `%s`.`%s` should be a positive integer, but it's `%s`", db, tbl, rowsPart)
+		}
+		if _, ok := result[db]; !ok {
+			result[db] = make(map[string]uint64)
+		}
+		result[db][tbl] = rows
+	}
+	return result, nil
+}
+
+// rowsOf returns the rows of each chunk to split the table into, which is the one in conf.TableRows
+// if the table has one, otherwise conf.Rows
+func (conf *Config) rowsOf(db, tbl string) uint64 {
+	if rows, ok := conf.TableRows[db][tbl]; ok {
+		return rows
+	}
+	return conf.Rows
+}
+
+// chunked returns whether the table is split into chunks by the rows or the size of each chunk
+func (conf *Config) chunked(db, tbl string) bool {
+	return conf.rowsOf(db, tbl) != UnspecifiedSize || conf.ChunkByFileSize
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestParseTableRows(c *C) {
+	rows, err := ParseTableRows([]string{"db.t1: 100000", "db.t2:5000", "db2.t:1"})
+	c.Assert(err, IsNil)
+	c.Assert(rows, DeepEquals, map[string]map[string]uint64{
+		"db":  {"t1": 100000, "t2": 5000},
+		"db2": {"t": 1},
+	})
+
+	_, err = ParseTableRows([]string{"db.t"})
+	c.Assert(err, ErrorMatches, "table rows `db.t` should be in the format of db.table:n")
+	_, err = ParseTableRows([]string{"t:10"})
+	c.Assert(err, ErrorMatches, "table rows `t:10` only accepts qualified table names")
+	_, err = ParseTableRows([]string{"db.t:0"})
+	c.Assert(err, ErrorMatches, "rows of table `db`.`t` should be a positive integer, but it's `0`")
+	_, err = ParseTableRows([]string{"db.t:10", "db.t:20"})
+	c.Assert(err, ErrorMatches, "rows of table `db`.`t` are specified more than once")
+
+	conf := DefaultConfig()
+	conf.Rows = 200
+	conf.TableRows = rows
+	c.Assert(conf.rowsOf("db", "t2"), Equals, uint64(5000))
+	c.Assert(conf.rowsOf("db", "t3"), Equals, uint64(200))
+}
+
+func (s *testSQLSuite) TestConcurrentDumpTableWithTableRows(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.SkipEstimate = true
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	// the table is split into chunks of 50 rows though --rows isn't specified
+	conf.TableRows = map[string]map[string]uint64{"test": {"t": 50}}
+	d := &Dumper{tctx: tctx, conf: conf}
+	meta := &tableMeta{database: "test", table: "t"}
+	mock.ExpectQuery("SELECT column_name FROM information_schema.columns").WithArgs("test", "t", "PRI").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+	mock.ExpectQuery("SELECT MIN\\(`id`\\),MAX\\(`id`\\) FROM `test`.`t`").
+		WillReturnRows(sqlmock.NewRows([]string{"MIN", "MAX"}).AddRow(1, 100))
+	mock.ExpectQuery("SELECT COLUMN_NAME,EXTRA FROM INFORMATION_SCHEMA.COLUMNS").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("id", ""))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").WithArgs("test", "t").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+
+	taskChan := make(chan Task, 16)
+	c.Assert(d.dumpTableData(tctx, conn, meta, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	var queries []string
+	for task := range taskChan {
+		c.Assert(task.(*TaskTableData).TotalChunks, Equals, 2)
+		queries = append(queries, task.(*TaskTableData).Data.(*tableData).query)
+	}
+	c.Assert(queries, DeepEquals, []string{
+		"SELECT * FROM `test`.`t` WHERE ((`id` IS NULL OR (`id` >= 1 AND `id` < 51))) ORDER BY `id`",
+		"SELECT * FROM `test`.`t` WHERE ((`id` >= 51 AND `id` < 101)) ORDER BY `id`",
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"strconv"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/errors"
+)
+
+// ParseTableThreads parses the per-table parallelism in the format of `db.table:n`
+// into database -> table -> the maximum number of chunks in flight
+func ParseTableThreads(specs []string) (map[string]map[string]int, error) {
+	result := make(map[string]map[string]int)
+	for _, spec := range specs {
+		tablePart, threadsPart, ok := cutString(spec, ":")
+		if !ok {
+			return nil, errors.Errorf("table threads `%s` should be in the format of db.table:n", spec)
+		}
+		db, tbl, ok := cutString(strings.TrimSpace(tablePart), ".")
+		if !ok || db == "" || tbl == "" {
+			return nil, errors.Errorf("table threads `%s` only accepts qualified table names", spec)
+		}
+		if _, ok := result[db][tbl]; ok {
+			return nil, errors.Errorf("threads of table `%s`.`%s` are specified more than once", db, tbl)
+		}
+		threads, err := strconv.Atoi(strings.TrimSpace(threadsPart))
+		if err != nil || threads <= 0 {
+			return nil, errors.Errorf("threads of table `%s`.`%s` should be a positive integer, got `%s`", db, tbl, threadsPart)
+		}
+		if _, ok := result[db]; !ok {
+			result[db] = make(map[string]int)
+		}
+		result[db][tbl] = threads
+	}
+	return result, nil
+}
+
+// tableThreadsLimiter limits how many data chunks of a table can be in flight at the same time.
+// The chunks of the other tables are only limited by the number of writers.
+type tableThreadsLimiter struct {
+	// database -> table -> semaphore
+	slots map[string]map[string]chan struct{}
+}
+
+func newTableThreadsLimiter(tableThreads map[string]map[string]int) *tableThreadsLimiter {
+	if len(tableThreads) == 0 {
+		return nil
+	}
+	l := &tableThreadsLimiter{slots: make(map[string]map[string]chan struct{}, len(tableThreads))}
+	for db, tables := range tableThreads {
+		l.slots[db] = make(map[string]chan struct{}, len(tables))
+		for tbl, threads := range tables {
+			l.slots[db][tbl] = make(chan struct{}, threads)
+		}
+	}
+	return l
+}
+
+// acquire waits until the table of the task has a free slot, and sets the task to release it when it's finished
+func (l *tableThreadsLimiter) acquire(tctx *tcontext.Context, task *TaskTableData) (ctxDone bool) {
+	if l == nil {
+		return false
+	}
+	slot, ok := l.slots[task.Meta.DatabaseName()][task.Meta.TableName()]
+	if !ok {
+		return false
+	}
+	select {
+	case <-tctx.Done():
+		return true
+	case slot <- struct{}{}:
+		task.release = func() { <-slot }
+		return false
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testTableThreadsSuite{})
+
+type testTableThreadsSuite struct{}
+
+func (s *testTableThreadsSuite) TestParseTableThreads(c *C) {
+	threads, err := ParseTableThreads([]string{"shop.orders:8", "shop.users: 1", "log.events:2"})
+	c.Assert(err, IsNil)
+	c.Assert(threads, DeepEquals, map[string]map[string]int{
+		"shop": {"orders": 8, "users": 1},
+		"log":  {"events": 2},
+	})
+
+	for _, testCase := range []struct {
+		spec []string
+		err  string
+	}{
+		{[]string{"orders:2"}, ".*only accepts qualified table names"},
+		{[]string{"shop.orders"}, ".*should be in the format of db.table:n"},
+		{[]string{"shop.orders:a"}, "threads of table `shop`.`orders` should be a positive integer, got `a`"},
+		{[]string{"shop.orders:0"}, ".*should be a positive integer.*"},
+		{[]string{"shop.orders:1", "shop.orders:2"}, "threads of table `shop`.`orders` are specified more than once"},
+	} {
+		_, err = ParseTableThreads(testCase.spec)
+		c.Assert(err, ErrorMatches, testCase.err, Commentf("spec %v", testCase.spec))
+	}
+}
+
+func (s *testTableThreadsSuite) TestLimitTableThreads(c *C) {
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conf := DefaultConfig()
+	conf.TableThreads = map[string]map[string]int{"shop": {"orders": 2}}
+	d := &Dumper{tctx: tctx, conf: conf, tableThreads: newTableThreadsLimiter(conf.TableThreads)}
+	taskChan := make(chan Task, 16)
+
+	orders := &tableMeta{database: "shop", table: "orders", selectedField: "*"}
+	users := &tableMeta{database: "shop", table: "users", selectedField: "*"}
+	var sent []*TaskTableData
+	for i := 0; i < 2; i++ {
+		task := NewTaskTableData(orders, nil, i, 3)
+		c.Assert(d.sendTaskToChan(tctx, task, taskChan), IsFalse)
+		sent = append(sent, task)
+	}
+	// the other tables aren't limited
+	for i := 0; i < 3; i++ {
+		c.Assert(d.sendTaskToChan(tctx, NewTaskTableData(users, nil, i, 3), taskChan), IsFalse)
+	}
+
+	// the third chunk waits until one of the chunks in flight is finished
+	blockedCtx, cancelBlocked := tctx.WithCancel()
+	cancelBlocked()
+	third := NewTaskTableData(orders, nil, 2, 3)
+	c.Assert(d.sendTaskToChan(blockedCtx, third, taskChan), IsTrue)
+	c.Assert(third.release, IsNil)
+
+	sent[0].finish()
+	c.Assert(d.sendTaskToChan(tctx, third, taskChan), IsFalse)
+	c.Assert(len(taskChan), Equals, 6)
+}
@@ -0,0 +1,265 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// targetLockPath is the advisory lock of the output written with Config.ExclusiveTarget
+	targetLockPath = "LOCK"
+
+	defaultExclusiveTargetStaleAfter = 10 * time.Minute
+)
+
+// targetLockInfo is the content of targetLockPath
+type targetLockInfo struct {
+	Host string `json:"host"`
+	PID  int    `json:"pid"`
+	// Token identifies the dump holding the lock
+	Token     string    `json:"token"`
+	StartTime time.Time `json:"start_time"`
+	// HeartbeatTime is refreshed while the dump is running, the lock is stale if it isn't refreshed in time
+	HeartbeatTime time.Time `json:"heartbeat_time"`
+	// Released is true if the lock is released but the storage can't delete it
+	Released bool `json:"released,omitempty"`
+}
+
+// targetLock is the advisory lock preventing the concurrent dumps to the same output with Config.ExclusiveTarget.
+// It's created atomically in the local output directory. The other storages have no create-if-not-exists,
+// so the lock is checked, written and read back to find the races, which is best-effort.
+type targetLock struct {
+	extStore   storage.ExternalStorage
+	localDir   string
+	staleAfter time.Duration
+	info       targetLockInfo
+	// stopKeepAlive stops refreshing the heartbeat, and keepAliveDone is closed once it stops
+	stopKeepAlive context.CancelFunc
+	keepAliveDone chan struct{}
+}
+
+func newTargetLock(conf *Config, extStore storage.ExternalStorage) (*targetLock, error) {
+	localDir, err := localOutputDir(conf)
+	if err != nil {
+		return nil, err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	now := time.Now()
+	return &targetLock{
+		extStore:   extStore,
+		localDir:   localDir,
+		staleAfter: conf.ExclusiveTargetStaleAfter,
+		info: targetLockInfo{
+			Host:          host,
+			PID:           os.Getpid(),
+			Token:         fmt.Sprintf("%s-%d-%d", host, os.Getpid(), now.UnixNano()),
+			StartTime:     now,
+			HeartbeatTime: now,
+		},
+	}, nil
+}
+
+// checkHeld returns an error if data is a lock held by another dump, which is neither released nor stale.
+// The lock is taken over with force.
+func (l *targetLock) checkHeld(tctx *tcontext.Context, data []byte, force bool) error {
+	var held targetLockInfo
+	if err := json.Unmarshal(data, &held); err != nil {
+		tctx.L().Warn("the lock of the output is corrupted, take it over", zap.String("file", targetLockPath), zap.Error(err))
+		return nil
+	}
+	if held.Released {
+		return nil
+	}
+	if idle := time.Since(held.HeartbeatTime); idle > l.staleAfter {
+		tctx.L().Warn("the lock of the output is stale, take it over",
+			zap.String("host", held.Host), zap.Int("pid", held.PID), zap.Duration("idle", idle))
+		return nil
+	}
+	if force {
+		tctx.L().Warn("the output is locked by another dump, take it over by force",
+			zap.String("host", held.Host), zap.Int("pid", held.PID), zap.Time("start time", held.StartTime))
+		return nil
+	}
+	return errors.Errorf("output is locked by another dump on host %s with pid %d since %s, the last heartbeat is at %s. "+
+		"Please wait for it to finish, or take the lock over by --%s if it isn't running",
+		held.Host, held.PID, held.StartTime.Format(time.RFC3339), held.HeartbeatTime.Format(time.RFC3339), flagExclusiveTargetForce)
+}
+
+// acquire writes the lock into the output if it isn't held by another dump
+func (l *targetLock) acquire(tctx *tcontext.Context, force bool) error {
+	data, err := json.Marshal(l.info)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if l.localDir != "" {
+		return l.acquireLocal(tctx, data, force)
+	}
+	exists, err := l.extStore.FileExists(tctx, targetLockPath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if exists {
+		held, err := l.extStore.ReadFile(tctx, targetLockPath)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err = l.checkHeld(tctx, held, force); err != nil {
+			return err
+		}
+	}
+	if err = l.extStore.WriteFile(tctx, targetLockPath, data); err != nil {
+		return errors.Trace(err)
+	}
+	// another dump may check and write the lock at the same time, the last one writing it wins
+	return l.verify(tctx)
+}
+
+// acquireLocal creates the lock exclusively in the local output directory, the lock held by another dump
+// is removed before creating it again if it can be taken over
+func (l *targetLock) acquireLocal(tctx *tcontext.Context, data []byte, force bool) error {
+	path := filepath.Join(l.localDir, targetLockPath)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			return errors.Trace(err)
+		}
+		if !os.IsExist(err) {
+			return errors.Trace(err)
+		}
+		held, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// the lock is released after the creation fails
+				continue
+			}
+			return errors.Trace(err)
+		}
+		if err = l.checkHeld(tctx, held, force); err != nil {
+			return err
+		}
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Trace(err)
+		}
+	}
+}
+
+// verify checks the lock in the output is still held by this dump
+func (l *targetLock) verify(ctx context.Context) error {
+	data, err := l.extStore.ReadFile(ctx, targetLockPath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var held targetLockInfo
+	if err = json.Unmarshal(data, &held); err != nil {
+		return errors.Annotate(err, "the lock of the output is corrupted")
+	}
+	if held.Token != l.info.Token {
+		return errors.Errorf("the lock of the output is taken over by another dump on host %s with pid %d", held.Host, held.PID)
+	}
+	return nil
+}
+
+// startKeepAlive refreshes the heartbeat of the lock in the background until it's released,
+// abort is called if the lock is taken over
+func (l *targetLock) startKeepAlive(tctx *tcontext.Context, abort func(error)) {
+	tctx, l.stopKeepAlive = tctx.WithCancel()
+	l.keepAliveDone = make(chan struct{})
+	go l.keepAlive(tctx, abort)
+}
+
+func (l *targetLock) keepAlive(tctx *tcontext.Context, abort func(error)) {
+	defer close(l.keepAliveDone)
+	tick := time.NewTicker(l.staleAfter / 3)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tctx.Done():
+			return
+		case <-tick.C:
+		}
+		if err := l.verify(tctx); err != nil {
+			if tctx.Err() == nil {
+				abort(err)
+			}
+			return
+		}
+		l.info.HeartbeatTime = time.Now()
+		data, err := json.Marshal(l.info)
+		if err == nil {
+			err = l.extStore.WriteFile(tctx, targetLockPath, data)
+		}
+		if err != nil {
+			tctx.L().Warn("fail to refresh the lock of the output", zap.Error(err))
+		}
+	}
+}
+
+// release removes the lock if it's still held by this dump, it's marked released if the storage can't delete it
+func (l *targetLock) release(ctx context.Context) error {
+	if l.stopKeepAlive != nil {
+		// the heartbeat isn't written after the lock is removed
+		l.stopKeepAlive()
+		<-l.keepAliveDone
+	}
+	if err := l.verify(ctx); err != nil {
+		return err
+	}
+	if l.localDir != "" {
+		return errors.Trace(os.Remove(filepath.Join(l.localDir, targetLockPath)))
+	}
+	if deleter, ok := l.extStore.(fileDeleter); ok {
+		return errors.Trace(deleter.DeleteFile(ctx, targetLockPath))
+	}
+	l.info.Released = true
+	data, err := json.Marshal(l.info)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(l.extStore.WriteFile(ctx, targetLockPath, data))
+}
+
+// acquireTargetLock locks the output with Config.ExclusiveTarget, the lock is kept alive until the dumper is closed
+func acquireTargetLock(d *Dumper, extStore storage.ExternalStorage) error {
+	tctx, conf := d.tctx, d.conf
+	l, err := newTargetLock(conf, extStore)
+	if err != nil {
+		return err
+	}
+	if err = l.acquire(tctx, conf.ExclusiveTargetForce); err != nil {
+		return err
+	}
+	d.targetLock = l
+	l.startKeepAlive(tctx, d.abort)
+	return nil
+}
+
+// releaseTargetLock releases the lock of the output acquired with Config.ExclusiveTarget
+func (d *Dumper) releaseTargetLock() {
+	if d.targetLock == nil {
+		return
+	}
+	if err := d.targetLock.release(context.Background()); err != nil {
+		d.L().Warn("fail to release the lock of the output", zap.String("file", targetLockPath), zap.Error(err))
+	}
+	d.targetLock = nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestTargetLock(c *C) {
+	tctx := tcontext.Background()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+
+	first, err := newTargetLock(conf, extStore)
+	c.Assert(err, IsNil)
+	c.Assert(first.acquire(tctx, false), IsNil)
+
+	// the lock held by another dump can only be taken over by force
+	second, err := newTargetLock(conf, extStore)
+	c.Assert(err, IsNil)
+	second.info.Token += "-second"
+	c.Assert(second.acquire(tctx, false), ErrorMatches, "output is locked by another dump on host .* with pid .*")
+	c.Assert(second.acquire(tctx, true), IsNil)
+	c.Assert(first.release(context.Background()), ErrorMatches, "the lock of the output is taken over by another dump.*")
+	c.Assert(second.release(context.Background()), IsNil)
+	_, err = os.Stat(filepath.Join(conf.OutputDirPath, targetLockPath))
+	c.Assert(os.IsNotExist(err), IsTrue)
+
+	// the stale lock is taken over
+	first.info.HeartbeatTime = time.Now().Add(-2 * conf.ExclusiveTargetStaleAfter)
+	data, err := json.Marshal(first.info)
+	c.Assert(err, IsNil)
+	c.Assert(extStore.WriteFile(tctx, targetLockPath, data), IsNil)
+	c.Assert(second.acquire(tctx, false), IsNil)
+	c.Assert(second.verify(tctx), IsNil)
+}
+
+func (s *testUtilSuite) TestTargetLockBestEffort(c *C) {
+	tctx := tcontext.Background()
+	conf := defaultConfigForTest(c)
+	conf.OutputDirPath = c.MkDir()
+	extStore, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+
+	// the lock is checked and written through the storage if it isn't in a local directory
+	first, err := newTargetLock(conf, extStore)
+	c.Assert(err, IsNil)
+	first.localDir = ""
+	c.Assert(first.acquire(tctx, false), IsNil)
+	second, err := newTargetLock(conf, extStore)
+	c.Assert(err, IsNil)
+	second.localDir = ""
+	second.info.Token += "-second"
+	c.Assert(second.acquire(tctx, false), ErrorMatches, "output is locked by another dump.*")
+
+	// the storage can't delete the lock, so it's marked released
+	c.Assert(first.release(context.Background()), IsNil)
+	data, err := extStore.ReadFile(tctx, targetLockPath)
+	c.Assert(err, IsNil)
+	var info targetLockInfo
+	c.Assert(json.Unmarshal(data, &info), IsNil)
+	c.Assert(info.Released, IsTrue)
+	c.Assert(second.acquire(tctx, false), IsNil)
+}
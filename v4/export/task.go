@@ -15,6 +15,8 @@ type TaskDatabaseMeta struct {
 	Task
 	DatabaseName      string
 	CreateDatabaseSQL string
+	// MigrationVersion is the version of the schema file in the migration layout, 0 if the layout isn't used
+	MigrationVersion int
 }
 
 // TaskTableMeta is a dumping table metadata task
@@ -23,6 +25,8 @@ type TaskTableMeta struct {
 	DatabaseName   string
 	TableName      string
 	CreateTableSQL string
+	// MigrationVersion is the version of the schema file in the migration layout, 0 if the layout isn't used
+	MigrationVersion int
 }
 
 // TaskViewMeta is a dumping view metadata task
@@ -32,15 +36,70 @@ type TaskViewMeta struct {
 	ViewName       string
 	CreateTableSQL string
 	CreateViewSQL  string
+	// MigrationVersion is the version of the schema file in the migration layout, 0 if the layout isn't used
+	MigrationVersion int
+}
+
+// TaskTriggerMeta is a dumping task of the triggers of a table
+type TaskTriggerMeta struct {
+	Task
+	DatabaseName string
+	TableName    string
+	// CreateTriggerSQL creates all the triggers of the table in their action order
+	CreateTriggerSQL string
+	// MigrationVersion is the version of the schema file in the migration layout, 0 if the layout isn't used
+	MigrationVersion int
+}
+
+// TaskRoutineMeta is a dumping task of a stored procedure, a stored function or an event
+type TaskRoutineMeta struct {
+	Task
+	DatabaseName string
+	RoutineName  string
+	// RoutineType is "procedure", "function" or "event"
+	RoutineType string
+	// CreateRoutineSQL creates all the routines and events of the name, which don't share the namespace
+	CreateRoutineSQL string
+	// MigrationVersion is the version of the schema file in the migration layout, 0 if the layout isn't used
+	MigrationVersion int
+}
+
+// TaskSequenceMeta is a dumping task of a sequence
+type TaskSequenceMeta struct {
+	Task
+	DatabaseName      string
+	SequenceName      string
+	CreateSequenceSQL string
+	// SetValueSQL sets the next value of the restored sequence to the one of the source
+	SetValueSQL string
 }
 
 // TaskTableData is a dumping table data task
 type TaskTableData struct {
 	Task
-	Meta        TableMeta
-	Data        TableDataIR
+	Meta TableMeta
+	Data TableDataIR
+	// ChunkIndex is assigned when the table is split, it only depends on the split of the table
+	// and not on the number of writers or which writer dumps the chunk, so a dump can be resumed
+	// from the checkpoint with another Config.Threads
 	ChunkIndex  int
 	TotalChunks int
+	// ChunkField is the column used to split the table into chunks, it's empty if the table isn't split
+	ChunkField string
+	// keyColumns are the columns of the ordering key of the chunk, it's only ChunkField if it's empty
+	keyColumns []string
+	// keyRange is the range of ChunkField of the chunk to split it further, it's nil if the chunk can't be split
+	keyRange *chunkKeyRange
+
+	// release frees the slot of the table taken by this chunk, it's nil if the table threads aren't limited
+	release func()
+}
+
+func (t *TaskTableData) finish() {
+	if t.release != nil {
+		t.release()
+		t.release = nil
+	}
 }
 
 // NewTaskDatabaseMeta returns a new dumping database metadata task
@@ -70,6 +129,35 @@ func NewTaskViewMeta(dbName, tblName, createTableSQL, createViewSQL string) *Tas
 	}
 }
 
+// NewTaskTriggerMeta returns a new dumping task of the triggers of a table
+func NewTaskTriggerMeta(dbName, tblName, createSQL string) *TaskTriggerMeta {
+	return &TaskTriggerMeta{
+		DatabaseName:     dbName,
+		TableName:        tblName,
+		CreateTriggerSQL: createSQL,
+	}
+}
+
+// NewTaskRoutineMeta returns a new dumping task of a stored procedure, a stored function or an event
+func NewTaskRoutineMeta(dbName, routineName, routineType, createSQL string) *TaskRoutineMeta {
+	return &TaskRoutineMeta{
+		DatabaseName:     dbName,
+		RoutineName:      routineName,
+		RoutineType:      routineType,
+		CreateRoutineSQL: createSQL,
+	}
+}
+
+// NewTaskSequenceMeta returns a new dumping task of a sequence
+func NewTaskSequenceMeta(dbName, sequenceName, createSQL, setValueSQL string) *TaskSequenceMeta {
+	return &TaskSequenceMeta{
+		DatabaseName:      dbName,
+		SequenceName:      sequenceName,
+		CreateSequenceSQL: createSQL,
+		SetValueSQL:       setValueSQL,
+	}
+}
+
 // NewTaskTableData returns a new dumping table data task
 func NewTaskTableData(meta TableMeta, data TableDataIR, currentChunk, totalChunks int) *TaskTableData {
 	return &TaskTableData{
@@ -95,6 +183,21 @@ func (t *TaskViewMeta) Brief() string {
 	return fmt.Sprintf("meta of view '%s'.'%s'", t.DatabaseName, t.ViewName)
 }
 
+// Brief implements task.Brief
+func (t *TaskTriggerMeta) Brief() string {
+	return fmt.Sprintf("triggers of table '%s'.'%s'", t.DatabaseName, t.TableName)
+}
+
+// Brief implements task.Brief
+func (t *TaskRoutineMeta) Brief() string {
+	return fmt.Sprintf("meta of %s '%s'.'%s'", t.RoutineType, t.DatabaseName, t.RoutineName)
+}
+
+// Brief implements task.Brief
+func (t *TaskSequenceMeta) Brief() string {
+	return fmt.Sprintf("meta of sequence '%s'.'%s'", t.DatabaseName, t.SequenceName)
+}
+
 // Brief implements task.Brief
 func (t *TaskTableData) Brief() string {
 	db, tbl := t.Meta.DatabaseName(), t.Meta.TableName()
@@ -0,0 +1,103 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// preserveTiDBHandlesVersion is the first TiDB version supporting @@allow_auto_random_explicit_insert
+var preserveTiDBHandlesVersion = semver.New("4.0.3")
+
+var (
+	// TiDB shows the AUTO_RANDOM columns and the SHARD_ROW_ID_BITS option in these comments in `SHOW CREATE TABLE`
+	autoRandomRegexp      = regexp.MustCompile(`(?i)\bAUTO_RANDOM\s*\(`)
+	shardRowIDBitsRegexp  = regexp.MustCompile(`(?i)\bSHARD_ROW_ID_BITS\s*=\s*[1-9]`)
+	autoRandomInsertCmt   = "/*T! SET @@SESSION.allow_auto_random_explicit_insert = 1*/;"
+	writeTiDBRowIDCmt     = "/*T! SET @@SESSION.tidb_opt_write_row_id = 1*/;"
+	wrappedTiDBRowIDField = "`_tidb_rowid`"
+)
+
+// checkPreserveTiDBHandles checks whether the server supports Config.PreserveTiDBHandles
+func checkPreserveTiDBHandles(d *Dumper) error {
+	conf := d.conf
+	if !conf.PreserveTiDBHandles {
+		return nil
+	}
+	serverInfo := conf.ServerInfo
+	if serverInfo.ServerType != ServerTypeTiDB {
+		return errors.Errorf("config.PreserveTiDBHandles only supports TiDB, but the server type is %s", serverInfo.ServerType)
+	}
+	if serverInfo.ServerVersion != nil && serverInfo.ServerVersion.Compare(*preserveTiDBHandlesVersion) < 0 {
+		return errors.Errorf("config.PreserveTiDBHandles requires TiDB %s or later, but the server version is %s",
+			preserveTiDBHandlesVersion, serverInfo.ServerVersion)
+	}
+	return nil
+}
+
+// adjustPreserveTiDBHandles checks the options which select the columns differently
+func adjustPreserveTiDBHandles(conf *Config) error {
+	if !conf.PreserveTiDBHandles {
+		return nil
+	}
+	switch {
+	case conf.SQL != "" || len(conf.NamedQueries) > 0:
+		return errors.New("config.PreserveTiDBHandles can't be used with --sql or --named-query")
+	case len(conf.ColumnGroups) > 0 || conf.MaterializePartitionColumn != "":
+		return errors.New("config.PreserveTiDBHandles can't be used with config.ColumnGroups or config.MaterializePartitionColumn")
+	}
+	return nil
+}
+
+// preserveTiDBHandles keeps the handles of the AUTO_RANDOM and SHARD_ROW_ID_BITS tables after they're restored,
+// so the data is distributed as before instead of being written into the hotspot of a new allocator.
+// The AUTO_RANDOM columns are dumped already, the sql data files allow inserting them explicitly.
+// The implicit `_tidb_rowid` of the SHARD_ROW_ID_BITS tables is selected as an extra column, which the sql data
+// files allow writing, and TiDB Lightning restores from the csv files.
+func preserveTiDBHandles(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta) error {
+	tm, ok := meta.(*tableMeta)
+	if !ok || tm.selectedField == "" {
+		// all the columns are generated, there is nothing to dump
+		return nil
+	}
+	createTableSQL := tm.showCreateTable
+	// the schema isn't queried with NoSchemas
+	if createTableSQL == "" {
+		var err error
+		if createTableSQL, err = ShowCreateTable(conn, tm.database, tm.table); err != nil {
+			return err
+		}
+	}
+	switch {
+	case autoRandomRegexp.MatchString(createTableSQL):
+		tm.specCmts = append(tm.specCmts, autoRandomInsertCmt)
+		tctx.L().Debug("preserve the AUTO_RANDOM handles", zap.String("database", tm.database), zap.String("table", tm.table))
+	case shardRowIDBitsRegexp.MatchString(createTableSQL):
+		fields := tm.selectedField
+		if fields == "*" {
+			names := tm.ColumnNames()
+			for i, name := range names {
+				names[i] = wrapBackTicks(escapeString(name))
+			}
+			fields = strings.Join(names, ",")
+		}
+		fields += "," + wrappedTiDBRowIDField
+		colTypes, err := GetColumnTypes(conn, fields, tm.database, tm.table)
+		if err != nil {
+			return errors.Annotatef(err, "fail to select _tidb_rowid of table `%s`.`%s`", tm.database, tm.table)
+		}
+		tm.colTypes = colTypes
+		tm.selectedField, tm.queryField = fields, fields
+		tm.specCmts = append(tm.specCmts, writeTiDBRowIDCmt)
+		tctx.L().Debug("preserve the _tidb_rowid handles", zap.String("database", tm.database), zap.String("table", tm.table))
+	}
+	return nil
+}
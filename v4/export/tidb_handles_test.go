@@ -0,0 +1,85 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coreos/go-semver/semver"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestPreserveTiDBHandles(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+
+	// the AUTO_RANDOM column is dumped already, the data files allow inserting it explicitly
+	mock.ExpectQuery("SELECT \\* FROM `test`.`orders` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "amount"}))
+	colTypes, err := GetColumnTypes(conn, "*", "test", "orders")
+	c.Assert(err, IsNil)
+	meta := &tableMeta{database: "test", table: "orders", colTypes: colTypes, selectedField: "*",
+		specCmts: []string{"/*!40101 SET NAMES binary*/;"},
+		showCreateTable: "CREATE TABLE `orders` (\n" +
+			"  `id` bigint(20) NOT NULL /*T![auto_rand] AUTO_RANDOM(5) */,\n" +
+			"  `amount` int(11) DEFAULT NULL,\n" +
+			"  PRIMARY KEY (`id`) /*T![clustered_index] CLUSTERED */\n" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin /*T![auto_rand_base] AUTO_RANDOM_BASE=30001 */"}
+	c.Assert(preserveTiDBHandles(tctx, conn, meta), IsNil)
+	c.Assert(meta.SelectedField(), Equals, "*")
+	c.Assert(meta.specCmts, DeepEquals, []string{"/*!40101 SET NAMES binary*/;", autoRandomInsertCmt})
+
+	// _tidb_rowid of the SHARD_ROW_ID_BITS table is selected as an extra column
+	mock.ExpectQuery("SELECT \\* FROM `test`.`logs` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "msg"}))
+	colTypes, err = GetColumnTypes(conn, "*", "test", "logs")
+	c.Assert(err, IsNil)
+	meta = &tableMeta{database: "test", table: "logs", colTypes: colTypes, selectedField: "*"}
+	// the schema is queried with NoSchemas
+	mock.ExpectQuery("SHOW CREATE TABLE `test`.`logs`").
+		WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).
+			AddRow("logs", "CREATE TABLE `logs` (\n  `id` varchar(32) NOT NULL,\n  `msg` text\n"+
+				") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin /*T! SHARD_ROW_ID_BITS=4 */"))
+	mock.ExpectQuery("SELECT `id`,`msg`,`_tidb_rowid` FROM `test`.`logs` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "msg", "_tidb_rowid"}))
+	c.Assert(preserveTiDBHandles(tctx, conn, meta), IsNil)
+	c.Assert(meta.SelectedField(), Equals, "(`id`,`msg`,`_tidb_rowid`)")
+	c.Assert(meta.ColumnNames(), DeepEquals, []string{"id", "msg", "_tidb_rowid"})
+	c.Assert(meta.specCmts, DeepEquals, []string{writeTiDBRowIDCmt})
+	selectField, selectLen, err := buildSelectFieldForMeta(conn, meta, false)
+	c.Assert(err, IsNil)
+	c.Assert(selectField, Equals, "`id`,`msg`,`_tidb_rowid`")
+	c.Assert(selectLen, Equals, 3)
+
+	// the other tables are dumped as usual
+	meta = &tableMeta{database: "test", table: "t", colTypes: colTypes, selectedField: "*",
+		showCreateTable: "CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n  PRIMARY KEY (`id`)\n) /*T! SHARD_ROW_ID_BITS=0 */"}
+	c.Assert(preserveTiDBHandles(tctx, conn, meta), IsNil)
+	c.Assert(meta.SelectedField(), Equals, "*")
+	c.Assert(meta.specCmts, HasLen, 0)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testSQLSuite) TestCheckPreserveTiDBHandles(c *C) {
+	conf := DefaultConfig()
+	d := &Dumper{conf: conf}
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeMySQL}
+	c.Assert(checkPreserveTiDBHandles(d), IsNil)
+
+	conf.PreserveTiDBHandles = true
+	c.Assert(checkPreserveTiDBHandles(d), ErrorMatches, "config.PreserveTiDBHandles only supports TiDB.*")
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeTiDB, ServerVersion: semver.New("4.0.0")}
+	c.Assert(checkPreserveTiDBHandles(d), ErrorMatches, "config.PreserveTiDBHandles requires TiDB 4.0.3 or later.*")
+	conf.ServerInfo.ServerVersion = semver.New("5.1.0")
+	c.Assert(checkPreserveTiDBHandles(d), IsNil)
+
+	conf.ColumnGroups = map[string]map[string][]ColumnGroup{"test": {"t": {{Name: "a", Columns: []string{"a"}}}}}
+	c.Assert(adjustPreserveTiDBHandles(conf), ErrorMatches, ".*can't be used with config.ColumnGroups.*")
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"github.com/coreos/go-semver/semver"
+)
+
+var (
+	globalTemporaryTableVersion = semver.New("5.3.0")
+	cachedTableVersion          = semver.New("6.0.0")
+
+	globalTemporaryTableRegexp = regexp.MustCompile(`(?i)^\s*CREATE\s+GLOBAL\s+TEMPORARY\s+TABLE\b`)
+	// TiDB shows the cached tables with this comment in `SHOW CREATE TABLE`, which is ignored when it's restored
+	cachedTableRegexp = regexp.MustCompile(`(?i)/\*\s*CACHED\s+ON\s*\*/`)
+)
+
+type tidbTableMode int
+
+const (
+	tidbTableNormal tidbTableMode = iota
+	// tidbTableGlobalTemporary has no persistent data, only its schema is dumped
+	tidbTableGlobalTemporary
+	// tidbTableCached is read normally, and is cached again after it's restored
+	tidbTableCached
+)
+
+// tidbTableModeOf detects the mode of a TiDB table from its `SHOW CREATE TABLE`
+func tidbTableModeOf(serverInfo ServerInfo, createTableSQL string) tidbTableMode {
+	if serverInfo.ServerType != ServerTypeTiDB || serverInfo.ServerVersion == nil {
+		return tidbTableNormal
+	}
+	if serverInfo.ServerVersion.Compare(*globalTemporaryTableVersion) >= 0 && globalTemporaryTableRegexp.MatchString(createTableSQL) {
+		return tidbTableGlobalTemporary
+	}
+	if serverInfo.ServerVersion.Compare(*cachedTableVersion) >= 0 && cachedTableRegexp.MatchString(createTableSQL) {
+		return tidbTableCached
+	}
+	return tidbTableNormal
+}
+
+// preserveCachedTable appends the statement to cache the table again after it's restored to the schema of a cached table
+func preserveCachedTable(serverInfo ServerInfo, table, createTableSQL string) string {
+	if tidbTableModeOf(serverInfo, createTableSQL) != tidbTableCached {
+		return createTableSQL
+	}
+	return fmt.Sprintf("%s;\nALTER TABLE `%s` CACHE", createTableSQL, escapeString(table))
+}
+
+// isGlobalTemporaryTable checks whether the table of meta is a TiDB global temporary table
+func isGlobalTemporaryTable(conf *Config, conn *sql.Conn, meta TableMeta) (bool, error) {
+	serverInfo := conf.ServerInfo
+	if serverInfo.ServerType != ServerTypeTiDB || serverInfo.ServerVersion == nil ||
+		serverInfo.ServerVersion.Compare(*globalTemporaryTableVersion) < 0 {
+		return false, nil
+	}
+	createTableSQL := meta.ShowCreateTable()
+	// the schema isn't queried with NoSchemas
+	if createTableSQL == "" {
+		var err error
+		if createTableSQL, err = ShowCreateTable(conn, meta.DatabaseName(), meta.TableName()); err != nil {
+			return false, err
+		}
+	}
+	return tidbTableModeOf(serverInfo, createTableSQL) == tidbTableGlobalTemporary, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coreos/go-semver/semver"
+	. "github.com/pingcap/check"
+)
+
+const (
+	globalTemporaryTableSQL = "CREATE GLOBAL TEMPORARY TABLE `t` (\n  `a` int(11) DEFAULT NULL\n) ENGINE=memory DEFAULT CHARSET=utf8mb4 ON COMMIT DELETE ROWS"
+	cachedTableSQL          = "CREATE TABLE `t` (\n  `a` int(11) DEFAULT NULL\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 /* CACHED ON */"
+)
+
+func (s *testSQLSuite) TestTiDBTableMode(c *C) {
+	tidb := func(version string) ServerInfo {
+		return ServerInfo{ServerType: ServerTypeTiDB, ServerVersion: semver.New(version)}
+	}
+	normalSQL := "CREATE TABLE `t` (\n  `a` int(11) DEFAULT NULL\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	c.Assert(tidbTableModeOf(tidb("6.0.0"), normalSQL), Equals, tidbTableNormal)
+	c.Assert(tidbTableModeOf(tidb("5.3.0"), globalTemporaryTableSQL), Equals, tidbTableGlobalTemporary)
+	c.Assert(tidbTableModeOf(tidb("6.0.0"), cachedTableSQL), Equals, tidbTableCached)
+	// the modes aren't supported by the earlier versions
+	c.Assert(tidbTableModeOf(tidb("5.2.0"), globalTemporaryTableSQL), Equals, tidbTableNormal)
+	c.Assert(tidbTableModeOf(tidb("5.4.0"), cachedTableSQL), Equals, tidbTableNormal)
+	c.Assert(tidbTableModeOf(ServerInfo{ServerType: ServerTypeMySQL, ServerVersion: semver.New("8.0.0")}, cachedTableSQL), Equals, tidbTableNormal)
+	c.Assert(tidbTableModeOf(ServerInfoUnknown, globalTemporaryTableSQL), Equals, tidbTableNormal)
+
+	c.Assert(preserveCachedTable(tidb("6.0.0"), "t", cachedTableSQL), Equals, cachedTableSQL+";\nALTER TABLE `t` CACHE")
+	c.Assert(preserveCachedTable(tidb("6.0.0"), "t", normalSQL), Equals, normalSQL)
+	c.Assert(preserveCachedTable(tidb("6.0.0"), "t", globalTemporaryTableSQL), Equals, globalTemporaryTableSQL)
+
+	// the engine of the global temporary tables isn't rewritten
+	conf := DefaultConfig()
+	conf.ForceEngine = "InnoDB"
+	conf.ForceCharset = "utf8"
+	c.Assert(rewriteTableOptions(conf, globalTemporaryTableSQL), Equals,
+		"CREATE GLOBAL TEMPORARY TABLE `t` (\n  `a` int(11) DEFAULT NULL\n) ENGINE=memory DEFAULT CHARSET=utf8 ON COMMIT DELETE ROWS")
+}
+
+func (s *testSQLSuite) TestDumpGlobalTemporaryTableData(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.ServerInfo = ServerInfo{ServerType: ServerTypeTiDB, ServerVersion: semver.New("5.3.0")}
+	d := &Dumper{tctx: tctx, conf: conf}
+	taskChan := make(chan Task, 1)
+
+	// no data is dumped from the global temporary table
+	meta := &tableMeta{database: "test", table: "t", showCreateTable: globalTemporaryTableSQL}
+	c.Assert(d.dumpTableData(tctx, conn, meta, taskChan), IsNil)
+	c.Assert(taskChan, HasLen, 0)
+
+	// the schema is queried to detect the mode with NoSchemas
+	mock.ExpectQuery("SHOW CREATE TABLE `test`.`t`").
+		WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("t", globalTemporaryTableSQL))
+	meta = &tableMeta{database: "test", table: "t"}
+	c.Assert(d.dumpTableData(tctx, conn, meta, taskChan), IsNil)
+	c.Assert(taskChan, HasLen, 0)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
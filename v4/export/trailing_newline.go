@@ -0,0 +1,84 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+// trailingNewlineWriter makes a file end with exactly one "\n" with Config.EnsureTrailingNewline, so the strict
+// parsers don't reject its last line. The newlines at the end of each write are held back until some data follows
+// them, and only one of them is written if the file ends there.
+type trailingNewlineWriter struct {
+	storage.ExternalFileWriter
+	// pending is the number of the newlines held back
+	pending            int
+	somethingIsWritten bool
+	// written is the size of the data written into the file
+	written uint64
+}
+
+func newTrailingNewlineWriter(w storage.ExternalFileWriter) *trailingNewlineWriter {
+	return &trailingNewlineWriter{ExternalFileWriter: w}
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *trailingNewlineWriter) Write(ctx context.Context, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	w.somethingIsWritten = true
+	data := bytes.TrimRight(p, "\n")
+	if len(data) > 0 {
+		if w.pending > 0 {
+			if err := w.write(ctx, bytes.Repeat([]byte{'\n'}, w.pending)); err != nil {
+				return 0, err
+			}
+			w.pending = 0
+		}
+		if err := w.write(ctx, data); err != nil {
+			return 0, err
+		}
+	}
+	w.pending += len(p) - len(data)
+	return len(p), nil
+}
+
+func (w *trailingNewlineWriter) write(ctx context.Context, p []byte) error {
+	n, err := w.ExternalFileWriter.Write(ctx, p)
+	w.written += uint64(n)
+	return errors.Trace(err)
+}
+
+// Close implements ExternalFileWriter.Close, it ends the file with a newline if anything is written
+func (w *trailingNewlineWriter) Close(ctx context.Context) error {
+	if w.somethingIsWritten {
+		if err := w.write(ctx, []byte{'\n'}); err != nil {
+			_ = w.ExternalFileWriter.Close(ctx)
+			return err
+		}
+		w.pending = 0
+	}
+	return w.ExternalFileWriter.Close(ctx)
+}
+
+// withTrailingNewline wraps w to end the file with exactly one newline if ensure is true
+func withTrailingNewline(w storage.ExternalFileWriter, ensure bool) storage.ExternalFileWriter {
+	if !ensure {
+		return w
+	}
+	return newTrailingNewlineWriter(w)
+}
+
+// writtenFileSizes returns the size of the data written into the file by w and the size of the file after it's closed,
+// written is the size written into w
+func writtenFileSizes(w storage.ExternalFileWriter, written uint64) (uint64, uint64) {
+	if nw, ok := w.(*trailingNewlineWriter); ok {
+		written, w = nw.written, nw.ExternalFileWriter
+	}
+	return written, compressedSize(w, written)
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestTrailingNewlineWriter(c *C) {
+	tctx := tcontext.Background().WithLogger(appLogger)
+	extStore, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	testCases := []struct {
+		writes   []string
+		expected string
+	}{
+		{[]string{"a"}, "a\n"},
+		{[]string{"a\n"}, "a\n"},
+		{[]string{"a\n\n\n"}, "a\n"},
+		{[]string{"a\n", "\n", "b"}, "a\n\nb\n"},
+		{[]string{"a\n", "", "b\n", "\n"}, "a\nb\n"},
+		{[]string{"\n\n"}, "\n"},
+		{[]string{""}, ""},
+	}
+	for i, t := range testCases {
+		name := fmt.Sprintf("file%d", i)
+		fw, err := extStore.Create(tctx, name)
+		c.Assert(err, IsNil)
+		w := newTrailingNewlineWriter(fw)
+		for _, p := range t.writes {
+			n, err := w.Write(tctx, []byte(p))
+			c.Assert(err, IsNil)
+			c.Assert(n, Equals, len(p))
+		}
+		c.Assert(w.Close(tctx), IsNil)
+		data, err := extStore.ReadFile(tctx, name)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, t.expected, Commentf("writes %q", t.writes))
+		c.Assert(w.written, Equals, uint64(len(t.expected)))
+	}
+}
+
+func (s *testWriterSuite) TestWriteTableDataWithTrailingNewline(c *C) {
+	data := make([][]driver.Value, 0, 50)
+	for i := 0; i < 50; i++ {
+		data = append(data, []driver.Value{fmt.Sprint(i), "line\nbreak", nil})
+	}
+	colTypes := []string{"INT", "VARCHAR", "TEXT"}
+	for _, fileType := range []string{FileFormatSQLTextString, FileFormatCSVString} {
+		config := defaultConfigForTest(c)
+		config.OutputDirPath = c.MkDir()
+		config.FileType = fileType
+		c.Assert(adjustFileFormat(config), IsNil)
+		config.NoHeader = true
+		config.CsvSeparator, config.CsvDelimiter = ",", "\""
+		// the files are rotated in the middle of the rows
+		config.FileSize = 200
+		config.StatementSize = 100
+		writer := s.newWriter(config, c)
+		tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+		c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+
+		files, err := ioutil.ReadDir(config.OutputDirPath)
+		c.Assert(err, IsNil)
+		c.Assert(len(files), Greater, 1)
+		var rows int
+		for _, f := range files {
+			content, err := ioutil.ReadFile(path.Join(config.OutputDirPath, f.Name()))
+			c.Assert(err, IsNil)
+			comment := Commentf("file %s: %q", f.Name(), content)
+			c.Assert(strings.HasSuffix(string(content), "\n"), IsTrue, comment)
+			c.Assert(strings.HasSuffix(string(content), "\n\n"), IsFalse, comment)
+			if fileType == FileFormatSQLTextString {
+				// every file starts a new statement and ends it
+				c.Assert(strings.HasPrefix(string(content), "INSERT INTO `t` VALUES\n"), IsTrue, comment)
+				c.Assert(strings.HasSuffix(string(content), ");\n"), IsTrue, comment)
+				rows += strings.Count(string(content), "'line\nbreak'")
+			} else {
+				// every file ends with a whole row
+				c.Assert(strings.HasSuffix(string(content), `,"line`+"\n"+`break",\N`+"\n"), IsTrue, comment)
+				rows += strings.Count(string(content), `"line`+"\n"+`break"`)
+			}
+		}
+		c.Assert(rows, Equals, len(data))
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+const uncompressedSizesManifestPath = "uncompressed-sizes.json"
+
+type uncompressedSize struct {
+	File             string `json:"file"`
+	UncompressedSize uint64 `json:"uncompressed_size"`
+}
+
+// uncompressedSizeStorage is an ExternalStorage which records the uncompressed size of every compressed file
+// written through it, since the size isn't available without decompressing the file.
+type uncompressedSizeStorage struct {
+	storage.ExternalStorage
+
+	mu sync.Mutex
+	// file name -> uncompressed size
+	sizes map[string]uint64
+}
+
+func newUncompressedSizeStorage(s storage.ExternalStorage) *uncompressedSizeStorage {
+	return &uncompressedSizeStorage{
+		ExternalStorage: s,
+		sizes:           make(map[string]uint64),
+	}
+}
+
+func (s *uncompressedSizeStorage) record(name string, size uint64) {
+	s.mu.Lock()
+	s.sizes[name] = size
+	s.mu.Unlock()
+}
+
+// forget drops the size of a deleted file
+func (s *uncompressedSizeStorage) forget(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.sizes, name)
+	s.mu.Unlock()
+}
+
+func (s *uncompressedSizeStorage) writeManifest(tctx *tcontext.Context) error {
+	s.mu.Lock()
+	files := make([]uncompressedSize, 0, len(s.sizes))
+	for name, size := range s.sizes {
+		files = append(files, uncompressedSize{File: name, UncompressedSize: size})
+	}
+	s.mu.Unlock()
+	sort.Slice(files, func(i, j int) bool { return files[i].File < files[j].File })
+	data, err := json.MarshalIndent(struct {
+		Files []uncompressedSize `json:"files"`
+	}{files}, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.ExternalStorage.WriteFile(tctx, uncompressedSizesManifestPath, data))
+}
+
+// recordUncompressedSize records the uncompressed size of a compressed file if s records them
+func recordUncompressedSize(s storage.ExternalStorage, compressType CompressType, name string, size uint64) {
+	if ds, ok := s.(*zstdDictStorage); ok {
+		s = ds.ExternalStorage
+	}
+	if r, ok := s.(*uncompressedSizeStorage); ok && compressType != CompressNone {
+		r.record(name, size)
+	}
+}
+
+// countingFileWriter counts the bytes written to the file before compression
+type countingFileWriter struct {
+	storage.ExternalFileWriter
+	writtenBytes uint64
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *countingFileWriter) Write(ctx context.Context, p []byte) (int, error) {
+	n, err := w.ExternalFileWriter.Write(ctx, p)
+	w.writtenBytes += uint64(n)
+	return n, err
+}
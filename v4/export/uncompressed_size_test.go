@@ -0,0 +1,69 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testWriterSuite) TestRecordUncompressedSize(c *C) {
+	dir := c.MkDir()
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = dir
+	config.CompressType = CompressGzip
+	config.ChunkMetadata = true
+
+	extStore, err := config.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	sizes := newUncompressedSizeStorage(extStore)
+	db, _, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	tctx := tcontext.Background().WithLogger(appLogger)
+	writer := NewWriter(tctx, 0, config, conn, sizes)
+
+	c.Assert(writer.WriteTableMeta("test", "t", "CREATE TABLE t (a INT)"), IsNil)
+	tableIR := newMockTableIR("test", "t", [][]driver.Value{{"1"}, {"2"}}, nil, []string{"INT"})
+	c.Assert(writer.WriteTableData(tableIR, tableIR, 0), IsNil)
+	c.Assert(sizes.writeManifest(tctx), IsNil)
+
+	uncompressedSizeOf := func(name string) uint64 {
+		data, err := ioutil.ReadFile(path.Join(dir, name))
+		c.Assert(err, IsNil)
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		c.Assert(err, IsNil)
+		uncompressed, err := ioutil.ReadAll(r)
+		c.Assert(err, IsNil)
+		return uint64(len(uncompressed))
+	}
+	data, err := ioutil.ReadFile(path.Join(dir, uncompressedSizesManifestPath))
+	c.Assert(err, IsNil)
+	var manifest struct {
+		Files []uncompressedSize `json:"files"`
+	}
+	c.Assert(json.Unmarshal(data, &manifest), IsNil)
+	c.Assert(manifest.Files, HasLen, 2)
+	for i, name := range []string{"test.t-schema.sql.gz", "test.t.000000000.sql.gz"} {
+		c.Assert(manifest.Files[i].File, Equals, name)
+		c.Assert(manifest.Files[i].UncompressedSize, Equals, uncompressedSizeOf(name))
+	}
+
+	// the chunk metadata has the uncompressed size too
+	data, err = ioutil.ReadFile(path.Join(dir, "test.t.000000000.sql.gz"+chunkMetadataSuffix))
+	c.Assert(err, IsNil)
+	var meta chunkMetadata
+	c.Assert(json.Unmarshal(data, &meta), IsNil)
+	c.Assert(meta.UncompressedSize, Equals, uncompressedSizeOf("test.t.000000000.sql.gz"))
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+// uploadLimitStorage is an ExternalStorage which bounds the storage requests in flight, such as the PUTs of S3,
+// to the given number. The writers keep reading and serializing the rows while they wait for an upload slot.
+type uploadLimitStorage struct {
+	storage.ExternalStorage
+
+	slots     chan struct{}
+	uploading int64
+}
+
+func newUploadLimitStorage(s storage.ExternalStorage, maxConcurrentUploads int) *uploadLimitStorage {
+	return &uploadLimitStorage{ExternalStorage: s, slots: make(chan struct{}, maxConcurrentUploads)}
+}
+
+func (s *uploadLimitStorage) acquire(ctx context.Context) error {
+	select {
+	case s.slots <- struct{}{}:
+		atomic.AddInt64(&s.uploading, 1)
+		return nil
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	}
+}
+
+func (s *uploadLimitStorage) release() {
+	atomic.AddInt64(&s.uploading, -1)
+	<-s.slots
+}
+
+// concurrency returns the storage requests in flight
+func (s *uploadLimitStorage) concurrency() int64 {
+	return atomic.LoadInt64(&s.uploading)
+}
+
+// WriteFile implements ExternalStorage.WriteFile
+func (s *uploadLimitStorage) WriteFile(ctx context.Context, name string, data []byte) error {
+	if err := s.acquire(ctx); err != nil {
+		return err
+	}
+	defer s.release()
+	return s.ExternalStorage.WriteFile(ctx, name, data)
+}
+
+// Create implements ExternalStorage.Create
+func (s *uploadLimitStorage) Create(ctx context.Context, name string) (storage.ExternalFileWriter, error) {
+	// creating a file may start an upload, e.g. the multipart upload of S3
+	if err := s.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer s.release()
+	w, err := s.ExternalStorage.Create(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadLimitFileWriter{ExternalFileWriter: w, s: s}, nil
+}
+
+type uploadLimitFileWriter struct {
+	storage.ExternalFileWriter
+	s *uploadLimitStorage
+}
+
+// Write implements ExternalFileWriter.Write
+func (w *uploadLimitFileWriter) Write(ctx context.Context, p []byte) (int, error) {
+	if err := w.s.acquire(ctx); err != nil {
+		return 0, err
+	}
+	defer w.s.release()
+	return w.ExternalFileWriter.Write(ctx, p)
+}
+
+// Close implements ExternalFileWriter.Close
+func (w *uploadLimitFileWriter) Close(ctx context.Context) error {
+	// closing a file uploads the remaining data
+	if err := w.s.acquire(ctx); err != nil {
+		return err
+	}
+	defer w.s.release()
+	return w.ExternalFileWriter.Close(ctx)
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+// slowStorage records the maximum concurrency of its slow writes
+type slowStorage struct {
+	storage.ExternalStorage
+	cur, max int64
+}
+
+func (s *slowStorage) WriteFile(context.Context, string, []byte) error {
+	cur := atomic.AddInt64(&s.cur, 1)
+	for {
+		max := atomic.LoadInt64(&s.max)
+		if cur <= max || atomic.CompareAndSwapInt64(&s.max, max, cur) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	atomic.AddInt64(&s.cur, -1)
+	return nil
+}
+
+func (s *testUtilSuite) TestUploadLimitStorage(c *C) {
+	slow := &slowStorage{}
+	limited := newUploadLimitStorage(slow, 2)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Check(limited.WriteFile(context.Background(), fmt.Sprintf("%d.sql", i), nil), IsNil)
+		}(i)
+	}
+	wg.Wait()
+	c.Assert(slow.max, Equals, int64(2))
+	c.Assert(limited.concurrency(), Equals, int64(0))
+
+	// the write waiting for a slot is cancelled
+	c.Assert(limited.acquire(context.Background()), IsNil)
+	c.Assert(limited.acquire(context.Background()), IsNil)
+	c.Assert(limited.concurrency(), Equals, int64(2))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(limited.WriteFile(ctx, "cancelled.sql", nil), ErrorMatches, ".*context deadline exceeded")
+	limited.release()
+	limited.release()
+	c.Assert(limited.concurrency(), Equals, int64(0))
+}
@@ -0,0 +1,224 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"encoding/json"
+	"hash/crc32"
+	"sort"
+	"sync"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	verificationSamplePath = "verification.json"
+
+	defaultVerificationSampleInterval = 1000
+)
+
+// setSampleKey sets the primary key columns of meta to sample its rows by with Config.EmitVerificationSample
+func setSampleKey(tctx *tcontext.Context, conn *sql.Conn, meta TableMeta) error {
+	tm, ok := meta.(*tableMeta)
+	if !ok {
+		return nil
+	}
+	cols, err := GetPrimaryKeyColumns(conn, tm.database, tm.table)
+	if err != nil {
+		return err
+	}
+	if len(cols) == 0 {
+		tctx.L().Warn("table has no primary key, only its rows are counted for verification",
+			zap.String("database", tm.database), zap.String("table", tm.table))
+		return nil
+	}
+	tm.sampleKeyColumns = cols
+	return nil
+}
+
+func sampleKeyColumnsOf(meta TableMeta) []string {
+	if tm, ok := meta.(*tableMeta); ok {
+		return tm.sampleKeyColumns
+	}
+	return nil
+}
+
+// isSampledKey checks whether the row of the primary key values is sampled. It only depends on the values,
+// so the same rows are sampled no matter how the table is split or the rows are ordered.
+func isSampledKey(key []string, interval uint64) bool {
+	h := crc32.NewIEEE()
+	for i, v := range key {
+		if i > 0 {
+			_, _ = h.Write([]byte{0})
+		}
+		_, _ = h.Write([]byte(v))
+	}
+	return uint64(h.Sum32())%interval == 0
+}
+
+// sampleRowsIR counts the rows when they are decoded, and samples the primary keys of the rows
+type sampleRowsIR struct {
+	TableDataIR
+	keyIndices []int
+	interval   uint64
+
+	rows    uint64
+	samples [][]string
+}
+
+func newSampleRowsIR(ir TableDataIR, keyIndices []int, interval uint64) *sampleRowsIR {
+	return &sampleRowsIR{TableDataIR: ir, keyIndices: keyIndices, interval: interval}
+}
+
+// Rows implements TableDataIR.Rows
+func (s *sampleRowsIR) Rows() SQLRowIter {
+	return &sampleRowIter{SQLRowIter: s.TableDataIR.Rows(), ir: s}
+}
+
+type sampleRowIter struct {
+	SQLRowIter
+	ir *sampleRowsIR
+}
+
+// Decode implements SQLRowIter.Decode
+func (it *sampleRowIter) Decode(row RowReceiver) error {
+	if err := it.SQLRowIter.Decode(row); err != nil {
+		return err
+	}
+	ir := it.ir
+	ir.rows++
+	arr, ok := row.(RowReceiverArr)
+	if len(ir.keyIndices) == 0 || !ok {
+		return nil
+	}
+	key := make([]string, len(ir.keyIndices))
+	for i, idx := range ir.keyIndices {
+		if idx >= len(arr.receivers) {
+			return nil
+		}
+		key[i] = string(receiverRawBytes(arr.receivers[idx]))
+	}
+	if isSampledKey(key, ir.interval) {
+		ir.samples = append(ir.samples, key)
+	}
+	return nil
+}
+
+type verificationChunk struct {
+	index    int
+	subChunk string
+	samples  [][]string
+}
+
+// verificationTable is the rows and the sampled primary keys of a table at the snapshot
+type verificationTable struct {
+	Database    string `json:"database"`
+	Table       string `json:"table"`
+	ColumnGroup string `json:"column_group,omitempty"`
+	Count       uint64 `json:"count"`
+	// PrimaryKey is empty if the primary keys aren't sampled
+	PrimaryKey []string   `json:"primary_key"`
+	Samples    [][]string `json:"samples"`
+
+	chunks []verificationChunk
+}
+
+// verificationRecorder collects the rows and the sampled primary keys of the tables from all writers,
+// so a comparator can verify the target against them
+type verificationRecorder struct {
+	interval uint64
+
+	mu     sync.Mutex
+	tables map[[3]string]*verificationTable
+}
+
+func newVerificationRecorder(interval uint64) *verificationRecorder {
+	if interval == 0 {
+		interval = defaultVerificationSampleInterval
+	}
+	return &verificationRecorder{interval: interval, tables: make(map[[3]string]*verificationTable)}
+}
+
+// sampler wraps ir to sample its rows if they can be sampled
+func (r *verificationRecorder) sampler(tctx *tcontext.Context, meta TableMeta, ir TableDataIR) *sampleRowsIR {
+	if r == nil {
+		return nil
+	}
+	keyColumns := sampleKeyColumnsOf(meta)
+	keyIndices, missing := keyColumnIndices(meta, keyColumns)
+	if missing != "" {
+		tctx.L().Warn("primary key isn't dumped, only the rows are counted for verification",
+			zap.String("database", meta.DatabaseName()), zap.String("table", meta.TableName()),
+			zap.String("column", missing))
+		keyIndices = nil
+	}
+	return newSampleRowsIR(ir, keyIndices, r.interval)
+}
+
+// add records the rows and the sampled primary keys of a chunk of meta
+func (r *verificationRecorder) add(meta TableMeta, chunkIndex int, subChunk string, rows uint64, samples [][]string) {
+	if r == nil {
+		return
+	}
+	var columnGroup string
+	if tm, ok := meta.(*tableMeta); ok {
+		columnGroup = tm.columnGroup
+	}
+	key := [3]string{meta.DatabaseName(), meta.TableName(), columnGroup}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tables[key]
+	if !ok {
+		primaryKey := sampleKeyColumnsOf(meta)
+		if primaryKey == nil {
+			primaryKey = []string{}
+		}
+		t = &verificationTable{Database: key[0], Table: key[1], ColumnGroup: key[2], PrimaryKey: primaryKey}
+		r.tables[key] = t
+	}
+	t.Count += rows
+	t.chunks = append(t.chunks, verificationChunk{index: chunkIndex, subChunk: subChunk, samples: samples})
+}
+
+// write writes the rows and the sampled primary keys of all the tables into verificationSamplePath.
+// The samples of a table are ordered by the chunks, so they don't depend on which writer dumps the chunks.
+func (r *verificationRecorder) write(tctx *tcontext.Context, extStore storage.ExternalStorage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tables := make([]*verificationTable, 0, len(r.tables))
+	for _, t := range r.tables {
+		sort.Slice(t.chunks, func(i, j int) bool {
+			if t.chunks[i].index != t.chunks[j].index {
+				return t.chunks[i].index < t.chunks[j].index
+			}
+			return t.chunks[i].subChunk < t.chunks[j].subChunk
+		})
+		t.Samples = [][]string{}
+		for _, chunk := range t.chunks {
+			t.Samples = append(t.Samples, chunk.samples...)
+		}
+		tables = append(tables, t)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].Database != tables[j].Database {
+			return tables[i].Database < tables[j].Database
+		}
+		if tables[i].Table != tables[j].Table {
+			return tables[i].Table < tables[j].Table
+		}
+		return tables[i].ColumnGroup < tables[j].ColumnGroup
+	})
+	data, err := json.MarshalIndent(struct {
+		SampleInterval uint64               `json:"sample_interval"`
+		Tables         []*verificationTable `json:"tables"`
+	}{r.interval, tables}, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(extStore.WriteFile(tctx, verificationSamplePath, data))
+}
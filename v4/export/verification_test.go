@@ -0,0 +1,65 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+)
+
+func (s *testUtilSuite) TestIsSampledKey(c *C) {
+	c.Assert(isSampledKey([]string{"1", "a"}, 1), IsTrue)
+	// the result only depends on the key values
+	for _, key := range [][]string{{"1"}, {"2"}, {"1", "a"}, {"1a"}} {
+		c.Assert(isSampledKey(key, 7), Equals, isSampledKey(append([]string(nil), key...), 7))
+	}
+}
+
+func (s *testUtilSuite) TestWriteVerificationSample(c *C) {
+	data := [][]driver.Value{
+		{"1", "a"},
+		{"2", "b"},
+		{"3", "c"},
+	}
+	colTypes := []string{"INT", "VARCHAR"}
+	tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+	r := newVerificationRecorder(1)
+	ir := newSampleRowsIR(tableIR, []int{0}, r.interval)
+	conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+	n, err := WriteInsert(tcontext.Background(), conf, tableIR, ir, storage.NewBufferWriter())
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, uint64(3))
+	c.Assert(ir.rows, Equals, uint64(3))
+	c.Assert(ir.samples, DeepEquals, [][]string{{"1"}, {"2"}, {"3"}})
+
+	// the chunks are added out of order
+	r.add(tableIR, 1, "", 2, [][]string{{"4"}})
+	r.add(tableIR, 0, "", ir.rows, ir.samples)
+	r.add(newMockTableIR("test", "s", nil, nil, nil), 0, "", 0, nil)
+
+	dir := c.MkDir()
+	extStore, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	c.Assert(r.write(tcontext.Background(), extStore), IsNil)
+	bytes, err := ioutil.ReadFile(path.Join(dir, verificationSamplePath))
+	c.Assert(err, IsNil)
+	var result struct {
+		SampleInterval uint64               `json:"sample_interval"`
+		Tables         []*verificationTable `json:"tables"`
+	}
+	c.Assert(json.Unmarshal(bytes, &result), IsNil)
+	c.Assert(result.SampleInterval, Equals, uint64(1))
+	c.Assert(result.Tables, HasLen, 2)
+	c.Assert(result.Tables[0].Table, Equals, "s")
+	c.Assert(result.Tables[0].Samples, HasLen, 0)
+	c.Assert(result.Tables[1].Table, Equals, "t")
+	c.Assert(result.Tables[1].Count, Equals, uint64(5))
+	c.Assert(result.Tables[1].Samples, DeepEquals, [][]string{{"1"}, {"2"}, {"3"}, {"4"}})
+}
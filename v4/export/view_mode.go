@@ -0,0 +1,59 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// adjustViewMode derives conf.ViewMode from conf.NoViews if it's not set, and keeps conf.NoViews consistent with it
+func adjustViewMode(conf *Config) error {
+	conf.ViewMode = strings.ToLower(conf.ViewMode)
+	switch conf.ViewMode {
+	case "":
+		if conf.NoViews {
+			conf.ViewMode = ViewModeSkip
+		} else {
+			conf.ViewMode = ViewModeDefinition
+		}
+	case ViewModeDefinition, ViewModeMaterialize, ViewModeSkip:
+	default:
+		return errors.Errorf("unknown config.ViewMode '%s', please use '%s', '%s' or '%s'",
+			conf.ViewMode, ViewModeDefinition, ViewModeMaterialize, ViewModeSkip)
+	}
+	conf.NoViews = conf.ViewMode == ViewModeSkip
+	return nil
+}
+
+// ShowCreateMaterializedView constructs the create table SQL of the base table holding the rows of a view,
+// whose columns have the same types and collations as the columns of the view
+func ShowCreateMaterializedView(db *sql.Conn, database, view string) (string, error) {
+	var columns []string
+	handleFieldRow := func(rows *sql.Rows) error {
+		// Field, Type, Collation, Null, Key, Default, Extra, Privileges, Comment
+		var oneRow [9]sql.NullString
+		scanErr := rows.Scan(&oneRow[0], &oneRow[1], &oneRow[2], &oneRow[3], &oneRow[4],
+			&oneRow[5], &oneRow[6], &oneRow[7], &oneRow[8])
+		if scanErr != nil {
+			return errors.Trace(scanErr)
+		}
+		column := fmt.Sprintf("  `%s` %s", escapeString(oneRow[0].String), oneRow[1].String)
+		if oneRow[2].Valid && oneRow[2].String != "" {
+			column += " COLLATE " + oneRow[2].String
+		}
+		if oneRow[3].String == "NO" {
+			column += " NOT NULL"
+		}
+		columns = append(columns, column)
+		return nil
+	}
+	query := fmt.Sprintf("SHOW FULL FIELDS FROM `%s`.`%s`", escapeString(database), escapeString(view))
+	if err := simpleQuery(db, query, handleFieldRow); err != nil {
+		return "", errors.Annotatef(err, "sql: %s", query)
+	}
+	return fmt.Sprintf("CREATE TABLE `%s` (\n%s\n)", escapeString(view), strings.Join(columns, ",\n")), nil
+}
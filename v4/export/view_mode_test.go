@@ -0,0 +1,121 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestShowCreateMaterializedView(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	mock.ExpectQuery("SHOW FULL FIELDS FROM `test`.`v`").
+		WillReturnRows(sqlmock.NewRows([]string{"Field", "Type", "Collation", "Null", "Key", "Default", "Extra", "Privileges", "Comment"}).
+			AddRow("a", "int(11)", nil, "NO", "", nil, "", "select", "").
+			AddRow("b", "varchar(10)", "utf8mb4_bin", "YES", "", nil, "", "select", ""))
+
+	createTableSQL, err := ShowCreateMaterializedView(conn, "test", "v")
+	c.Assert(err, IsNil)
+	c.Assert(createTableSQL, Equals, "CREATE TABLE `v` (\n  `a` int(11) NOT NULL,\n  `b` varchar(10) COLLATE utf8mb4_bin\n)")
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+}
+
+func (s *testSQLSuite) TestDumpViewDefinitionsLast(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.NoData = true
+	conf.NoCreateDatabase = true
+	conf.ViewMode = ViewModeDefinition
+	conf.Tables = DatabaseTables{}.AppendViews("test", "v").AppendTables("test", "t1")
+	d := &Dumper{tctx: tctx, conf: conf}
+	// the table is dumped before the view listed first
+	mock.ExpectQuery("SELECT COLUMN_NAME").WithArgs("test", "t1").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("a", ""))
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t1` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"a"}))
+	mock.ExpectQuery("SHOW CREATE TABLE `test`.`t1`").
+		WillReturnRows(sqlmock.NewRows([]string{"Table", "Create Table"}).
+			AddRow("t1", "CREATE TABLE `t1` (`a` int)"))
+	mock.ExpectQuery("SELECT COLUMN_NAME").WithArgs("test", "v").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("a", ""))
+	mock.ExpectQuery("SELECT \\* FROM `test`.`v` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"a"}))
+	mock.ExpectQuery("SHOW FIELDS FROM `test`.`v`").
+		WillReturnRows(sqlmock.NewRows([]string{"Field", "Type", "Null", "Key", "Default", "Extra"}).
+			AddRow("a", "int(11)", "YES", nil, "NULL", nil))
+	mock.ExpectQuery("SHOW CREATE VIEW `test`.`v`").
+		WillReturnRows(sqlmock.NewRows([]string{"View", "Create View", "character_set_client", "collation_connection"}).
+			AddRow("v", "CREATE VIEW `v` (`a`) AS SELECT `t1`.`a` AS `a` FROM `test`.`t1`", "utf8", "utf8_general_ci"))
+
+	taskChan := make(chan Task, 4)
+	c.Assert(d.dumpDatabases(tctx, conn, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	var tasks []Task
+	for task := range taskChan {
+		tasks = append(tasks, task)
+	}
+	c.Assert(tasks, HasLen, 2)
+	_, ok := tasks[0].(*TaskTableMeta)
+	c.Assert(ok, IsTrue)
+	_, ok = tasks[1].(*TaskViewMeta)
+	c.Assert(ok, IsTrue)
+}
+
+func (s *testSQLSuite) TestDumpMaterializedView(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.ViewMode = ViewModeMaterialize
+	conf.Tables = DatabaseTables{}.AppendViews("test", "v")
+	d := &Dumper{tctx: tctx, conf: conf}
+	mock.ExpectQuery("SELECT COLUMN_NAME").WithArgs("test", "v").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("a", ""))
+	mock.ExpectQuery("SELECT \\* FROM `test`.`v` LIMIT 1").
+		WillReturnRows(sqlmock.NewRows([]string{"a"}))
+	mock.ExpectQuery("SHOW FULL FIELDS FROM `test`.`v`").
+		WillReturnRows(sqlmock.NewRows([]string{"Field", "Type", "Collation", "Null", "Key", "Default", "Extra", "Privileges", "Comment"}).
+			AddRow("a", "int(11)", nil, "YES", "", nil, "", "select", ""))
+	mock.ExpectQuery("SELECT COLUMN_NAME").WithArgs("test", "v").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("a", ""))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.KEY_COLUMN_USAGE").WithArgs("test", "v").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}))
+
+	taskChan := make(chan Task, 4)
+	c.Assert(d.dumpTable(tctx, conn, "test", conf.Tables["test"][0], taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	var tasks []Task
+	for task := range taskChan {
+		tasks = append(tasks, task)
+	}
+	c.Assert(tasks, HasLen, 2)
+	tableMeta, ok := tasks[0].(*TaskTableMeta)
+	c.Assert(ok, IsTrue)
+	c.Assert(tableMeta.CreateTableSQL, Equals, "CREATE TABLE `v` (\n  `a` int(11)\n)")
+	dataTask, ok := tasks[1].(*TaskTableData)
+	c.Assert(ok, IsTrue)
+	c.Assert(dataTask.Data.(*tableData).query, Equals, "SELECT * FROM `test`.`v`")
+}
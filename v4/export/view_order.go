@@ -0,0 +1,161 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+)
+
+// viewPart is the part of a view sent in a step of dumping the views in the dependency order
+type viewPart int
+
+const (
+	// viewPartAll is both the placeholder table and the definition of the view
+	viewPartAll viewPart = iota
+	// viewPartPlaceholder is the placeholder table with the columns of the view, which the views of a cycle select from
+	// before the view is created
+	viewPartPlaceholder
+	// viewPartDefinition drops the placeholder table and creates the view
+	viewPartDefinition
+)
+
+// viewToDump is a view whose definition is dumped after all the tables
+type viewToDump struct {
+	db    string
+	table *TableInfo
+	meta  TableMeta
+}
+
+func (v *viewToDump) String() string {
+	return fmt.Sprintf("`%s`.`%s`", v.db, v.table.Name)
+}
+
+type viewStep struct {
+	view *viewToDump
+	part viewPart
+}
+
+// viewDefinitionMeta is the meta of a view whose placeholder table has been dumped before its definition
+type viewDefinitionMeta struct {
+	TableMeta
+}
+
+// ShowCreateTable implements TableMeta.ShowCreateTable
+func (viewDefinitionMeta) ShowCreateTable() string {
+	return ""
+}
+
+// sortViewsByDependencies returns the steps to dump the views, so each view is created after the views it selects
+// from, even in other databases. The views whose dependencies are satisfied are dumped by the database and the name.
+// A cycle of the views, which can be made by ALTER VIEW, is broken at its first view by the database and the name:
+// the placeholder table of the view is dumped first, and its definition replaces the placeholder after the other
+// views of the cycle are created on the placeholder.
+func sortViewsByDependencies(tctx *tcontext.Context, views []*viewToDump) []viewStep {
+	sort.Slice(views, func(i, j int) bool {
+		if views[i].db != views[j].db {
+			return views[i].db < views[j].db
+		}
+		return views[i].table.Name < views[j].table.Name
+	})
+	index := make(map[[2]string]int, len(views))
+	for i, v := range views {
+		index[[2]string{v.db, v.table.Name}] = i
+	}
+	deps := make([][]int, len(views))
+	for i, v := range views {
+		seen := make(map[int]bool)
+		for _, ref := range viewReferences(v.db, v.meta.ShowCreateView()) {
+			if j, ok := index[ref]; ok && j != i && !seen[j] {
+				seen[j] = true
+				deps[i] = append(deps[i], j)
+			}
+		}
+		sort.Ints(deps[i])
+	}
+
+	// a view is satisfied after it's created or its placeholder table is created, so the views selecting from it
+	// can be created
+	satisfied := make([]bool, len(views))
+	defined := make([]bool, len(views))
+	ready := func(i int) bool {
+		for _, j := range deps[i] {
+			if !satisfied[j] {
+				return false
+			}
+		}
+		return true
+	}
+	steps := make([]viewStep, 0, len(views))
+	for hasUndefined(defined) {
+		next := -1
+		for i := range views {
+			if !defined[i] && ready(i) {
+				next = i
+				break
+			}
+		}
+		if next >= 0 {
+			part := viewPartAll
+			if satisfied[next] {
+				part = viewPartDefinition
+			}
+			steps = append(steps, viewStep{view: views[next], part: part})
+			satisfied[next], defined[next] = true, true
+			continue
+		}
+		cycle := findViewCycle(deps, satisfied)
+		broken := cycle[0]
+		names := make([]string, 0, len(cycle))
+		for _, i := range cycle {
+			names = append(names, views[i].String())
+		}
+		tctx.L().Warn("views depend on each other, create the placeholder table of the first view before the others",
+			zap.Strings("cycle", names), zap.Stringer("view", views[broken]))
+		steps = append(steps, viewStep{view: views[broken], part: viewPartPlaceholder})
+		satisfied[broken] = true
+	}
+	return steps
+}
+
+func hasUndefined(defined []bool) bool {
+	for _, d := range defined {
+		if !d {
+			return true
+		}
+	}
+	return false
+}
+
+// findViewCycle returns the views of a cycle of the unsatisfied views sorted by their indexes. It's called when
+// every unsatisfied view depends on another one, so the walk from the first of them always comes back to a cycle.
+func findViewCycle(deps [][]int, satisfied []bool) []int {
+	unsatisfiedDep := func(i int) int {
+		for _, j := range deps[i] {
+			if !satisfied[j] {
+				return j
+			}
+		}
+		return -1
+	}
+	current := 0
+	for satisfied[current] {
+		current++
+	}
+	visited := make(map[int]int)
+	var path []int
+	for {
+		if at, ok := visited[current]; ok {
+			cycle := append([]int{}, path[at:]...)
+			sort.Ints(cycle)
+			return cycle
+		}
+		visited[current] = len(path)
+		path = append(path, current)
+		current = unsatisfiedDep(current)
+	}
+}
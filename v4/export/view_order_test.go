@@ -0,0 +1,94 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/pingcap/check"
+)
+
+func (s *testSQLSuite) TestDumpViewsInDependencyOrder(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	tctx, cancel := tcontext.Background().WithLogger(appLogger).WithCancel()
+	defer cancel()
+	conn, err := db.Conn(tctx)
+	c.Assert(err, IsNil)
+
+	conf := DefaultConfig()
+	conf.ViewMode = ViewModeDefinition
+	d := &Dumper{tctx: tctx, conf: conf}
+	// c selects from b, which selects from a, but they're listed in the reverse order
+	views := DatabaseTables{}.AppendViews("test", "c", "b", "a")
+	definitions := map[string]string{
+		"c": "CREATE VIEW `c` (`id`) AS SELECT `b`.`id` AS `id` FROM `test`.`b`",
+		"b": "CREATE VIEW `b` (`id`) AS SELECT `a`.`id` AS `id` FROM `a`",
+		"a": "CREATE VIEW `a` (`id`) AS SELECT 1 AS `id`",
+	}
+	for _, name := range []string{"c", "b", "a"} {
+		mock.ExpectQuery("SELECT COLUMN_NAME").WithArgs("test", name).
+			WillReturnRows(sqlmock.NewRows([]string{"column_name", "extra"}).AddRow("id", ""))
+		mock.ExpectQuery(fmt.Sprintf("SELECT \\* FROM `test`.`%s` LIMIT 1", name)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery(fmt.Sprintf("SHOW FIELDS FROM `test`.`%s`", name)).
+			WillReturnRows(sqlmock.NewRows([]string{"Field", "Type", "Null", "Key", "Default", "Extra"}).
+				AddRow("id", "int(11)", "YES", nil, "NULL", nil))
+		mock.ExpectQuery(fmt.Sprintf("SHOW CREATE VIEW `test`.`%s`", name)).
+			WillReturnRows(sqlmock.NewRows([]string{"View", "Create View", "character_set_client", "collation_connection"}).
+				AddRow(name, definitions[name], "utf8", "utf8_general_ci"))
+	}
+
+	taskChan := make(chan Task, 4)
+	c.Assert(d.dumpViewsLast(tctx, conn, views, taskChan), IsNil)
+	close(taskChan)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+	var names []string
+	for task := range taskChan {
+		t, ok := task.(*TaskViewMeta)
+		c.Assert(ok, IsTrue)
+		c.Assert(t.CreateTableSQL, Not(Equals), "")
+		c.Assert(strings.Contains(t.CreateViewSQL, definitions[t.ViewName]), IsTrue)
+		names = append(names, t.ViewName)
+	}
+	c.Assert(names, DeepEquals, []string{"a", "b", "c"})
+}
+
+func (s *testUtilSuite) TestSortViewsByDependencies(c *C) {
+	newView := func(db, name, createViewSQL string) *viewToDump {
+		return &viewToDump{db: db, table: &TableInfo{Name: name, Type: TableTypeView},
+			meta: &tableMeta{database: db, table: name, showCreateTable: "CREATE TABLE `" + name + "`", showCreateView: createViewSQL}}
+	}
+	// x and y select from each other after ALTER VIEW, z selects from x, and w in another database selects from z
+	views := []*viewToDump{
+		newView("other", "w", "CREATE VIEW `w` AS SELECT * FROM `test`.`z`"),
+		newView("test", "z", "CREATE VIEW `z` AS SELECT * FROM `x`"),
+		newView("test", "y", "CREATE VIEW `y` AS SELECT * FROM `x` JOIN `other`.`missing`"),
+		newView("test", "x", "CREATE VIEW `x` AS SELECT * FROM `y` JOIN `x`"),
+	}
+	steps := sortViewsByDependencies(tcontext.Background().WithLogger(appLogger), views)
+	var order []string
+	for _, step := range steps {
+		order = append(order, fmt.Sprintf("%s:%d", step.view, step.part))
+	}
+	c.Assert(order, DeepEquals, []string{
+		fmt.Sprintf("`test`.`x`:%d", viewPartPlaceholder),
+		fmt.Sprintf("`test`.`y`:%d", viewPartAll),
+		fmt.Sprintf("`test`.`x`:%d", viewPartDefinition),
+		fmt.Sprintf("`test`.`z`:%d", viewPartAll),
+		fmt.Sprintf("`other`.`w`:%d", viewPartAll),
+	})
+	c.Assert(viewDefinitionMeta{steps[2].view.meta}.ShowCreateTable(), Equals, "")
+
+	// the views in the migration layout are numbered in the same order
+	v := newMigrationVersions(tcontext.Background().WithLogger(appLogger), DatabaseTables{}.AppendViews("other", "w").AppendViews("test", "x", "y", "z").AppendTables("test", "t"), nil, nil)
+	c.Assert([]int{v.table("other", "w"), v.table("test", "x"), v.table("test", "y"), v.table("test", "z")}, DeepEquals, []int{4, 5, 6, 7})
+	v.reorderViews(steps)
+	c.Assert([]int{v.table("test", "y"), v.table("test", "x"), v.table("test", "z"), v.table("other", "w")}, DeepEquals, []int{4, 5, 6, 7})
+	c.Assert(v.table("test", "t"), Equals, 3)
+}
@@ -0,0 +1,368 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+)
+
+const (
+	webHDFSScheme = "webhdfs"
+	// swebHDFSScheme is WebHDFS over https, like in Hadoop
+	swebHDFSScheme = "swebhdfs"
+	hdfsScheme     = "hdfs"
+	webHDFSPrefix  = "/webhdfs/v1"
+	webHDFSBufSize = 8 * 1024 * 1024
+)
+
+// HDFSConfig is the config used to access HDFS through the WebHDFS REST API.
+// Kerberos (SPNEGO) authentication isn't supported, a cluster secured by Kerberos is accessed by a delegation token
+// fetched beforehand, e.g. by `hdfs fetchdt`.
+type HDFSConfig struct {
+	// User is passed as `user.name` when the cluster uses simple authentication.
+	User string
+	// DelegationToken is passed as `delegation` when the cluster is secured by Kerberos.
+	DelegationToken string `json:"-"`
+	// CAPath is the CA certificate to verify the namenode and the datanodes of swebhdfs:// output, the system
+	// CA certificates are used if it's empty.
+	CAPath string
+}
+
+func isHDFSURL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, webHDFSScheme+"://") || strings.HasPrefix(rawURL, swebHDFSScheme+"://") ||
+		strings.HasPrefix(rawURL, hdfsScheme+"://")
+}
+
+// webHDFSStorage is an ExternalStorage which writes files to HDFS through the WebHDFS REST API.
+type webHDFSStorage struct {
+	scheme string
+	base   *url.URL
+	root   string
+	conf   HDFSConfig
+	client *http.Client
+}
+
+func newWebHDFSStorage(rawURL string, conf HDFSConfig, client *http.Client) (*webHDFSStorage, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if u.Scheme == hdfsScheme {
+		return nil, errors.Errorf("hdfs RPC protocol is not supported, please use webhdfs://<namenode-http-address>%s instead", u.Path)
+	}
+	if u.Host == "" {
+		return nil, errors.Errorf("please specify the namenode http address for webhdfs in %s", rawURL)
+	}
+	httpScheme := "http"
+	if u.Scheme == swebHDFSScheme {
+		httpScheme = "https"
+	} else if conf.CAPath != "" {
+		return nil, errors.Errorf("the CA certificate of hdfs is only used by %s://, but the output is %s", swebHDFSScheme, rawURL)
+	}
+	// don't follow the redirection to datanodes automatically, the request body must be sent to datanode only
+	noRedirectClient := *client
+	noRedirectClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	if conf.CAPath != "" {
+		pem, err := ioutil.ReadFile(conf.CAPath)
+		if err != nil {
+			return nil, errors.Annotate(err, "fail to read the CA certificate of hdfs")
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no CA certificate is found in %s", conf.CAPath)
+		}
+		transport, ok := client.Transport.(*http.Transport)
+		if !ok {
+			transport = http.DefaultTransport.(*http.Transport)
+		}
+		transport = transport.Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+		noRedirectClient.Transport = transport
+	}
+	return &webHDFSStorage{
+		scheme: u.Scheme,
+		base:   &url.URL{Scheme: httpScheme, Host: u.Host},
+		root:   path.Clean("/" + u.Path),
+		conf:   conf,
+		client: &noRedirectClient,
+	}, nil
+}
+
+func (s *webHDFSStorage) opURL(name, op string, params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("op", op)
+	if s.conf.User != "" {
+		params.Set("user.name", s.conf.User)
+	}
+	if s.conf.DelegationToken != "" {
+		params.Set("delegation", s.conf.DelegationToken)
+	}
+	u := *s.base
+	u.Path = webHDFSPrefix + path.Join(s.root, name)
+	u.RawQuery = params.Encode()
+	return u.String()
+}
+
+// do sends a request to namenode, and resends it with body to datanode if namenode redirects it.
+func (s *webHDFSStorage) do(ctx context.Context, method, reqURL string, body []byte, expectedStatus int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Trace(redactWebHDFSError(err))
+	}
+	if resp.StatusCode == http.StatusTemporaryRedirect {
+		location, err := resp.Location()
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		req, err = http.NewRequestWithContext(ctx, method, location.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/octet-stream")
+		}
+		resp, err = s.client.Do(req)
+		if err != nil {
+			return nil, errors.Trace(redactWebHDFSError(err))
+		}
+	}
+	if resp.StatusCode == http.StatusUnauthorized && strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Negotiate") {
+		resp.Body.Close()
+		return nil, errors.Errorf("webhdfs %s %s requires Kerberos (SPNEGO) authentication which isn't supported, "+
+			"please fetch a delegation token, e.g. by `hdfs fetchdt`, and pass it by --hdfs-delegation-token", method, redactWebHDFSURL(reqURL))
+	}
+	if resp.StatusCode != expectedStatus {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(resp.Body)
+		if s.conf.DelegationToken != "" {
+			msg = bytes.ReplaceAll(msg, []byte(s.conf.DelegationToken), []byte(redactedValue))
+		}
+		return resp, errors.Errorf("webhdfs %s %s failed, status: %s, message: %s", method, redactWebHDFSURL(reqURL), resp.Status, msg)
+	}
+	return resp, nil
+}
+
+// redactWebHDFSURL hides the delegation token in the query of rawURL, so it's never logged or reported in the errors
+func redactWebHDFSURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redactedValue
+	}
+	query := u.Query()
+	if query.Get("delegation") == "" {
+		return rawURL
+	}
+	query.Set("delegation", redactedValue)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// redactWebHDFSError hides the delegation token in the URL of the error returned by http.Client.Do
+func redactWebHDFSError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		redacted := *urlErr
+		redacted.URL = redactWebHDFSURL(urlErr.URL)
+		return &redacted
+	}
+	return err
+}
+
+func (s *webHDFSStorage) mkdirs(ctx context.Context) error {
+	resp, err := s.do(ctx, http.MethodPut, s.opURL("", "MKDIRS", nil), nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Boolean bool `json:"boolean"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return errors.Trace(err)
+	}
+	if !result.Boolean {
+		return errors.Errorf("fail to create webhdfs directory %s", s.root)
+	}
+	return nil
+}
+
+// WriteFile implements ExternalStorage.WriteFile.
+func (s *webHDFSStorage) WriteFile(ctx context.Context, name string, data []byte) error {
+	params := url.Values{"overwrite": []string{"true"}}
+	resp, err := s.do(ctx, http.MethodPut, s.opURL(name, "CREATE", params), data, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *webHDFSStorage) appendFile(ctx context.Context, name string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPost, s.opURL(name, "APPEND", nil), data, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// DeleteFile deletes the file.
+func (s *webHDFSStorage) DeleteFile(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.opURL(name, "DELETE", nil), nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// ReadFile implements ExternalStorage.ReadFile.
+func (s *webHDFSStorage) ReadFile(ctx context.Context, name string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.opURL(name, "OPEN", nil), nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	return data, errors.Trace(err)
+}
+
+// FileExists implements ExternalStorage.FileExists.
+func (s *webHDFSStorage) FileExists(ctx context.Context, name string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.opURL(name, "GETFILESTATUS", nil), nil, http.StatusOK)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, resp.Body.Close()
+}
+
+type webHDFSFileStatus struct {
+	PathSuffix string `json:"pathSuffix"`
+	Type       string `json:"type"`
+	Length     int64  `json:"length"`
+}
+
+// WalkDir implements ExternalStorage.WalkDir.
+func (s *webHDFSStorage) WalkDir(ctx context.Context, opt *storage.WalkOption, fn func(path string, size int64) error) error {
+	dir := ""
+	if opt != nil {
+		dir = opt.SubDir
+	}
+	return s.walkDir(ctx, dir, fn)
+}
+
+func (s *webHDFSStorage) walkDir(ctx context.Context, dir string, fn func(path string, size int64) error) error {
+	resp, err := s.do(ctx, http.MethodGet, s.opURL(dir, "LISTSTATUS", nil), nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		FileStatuses struct {
+			FileStatus []webHDFSFileStatus `json:"FileStatus"`
+		} `json:"FileStatuses"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return errors.Trace(err)
+	}
+	for _, status := range result.FileStatuses.FileStatus {
+		name := path.Join(dir, status.PathSuffix)
+		if status.Type == "DIRECTORY" {
+			err = s.walkDir(ctx, name, fn)
+		} else {
+			err = fn(name, status.Length)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// URI implements ExternalStorage.URI.
+func (s *webHDFSStorage) URI() string {
+	return fmt.Sprintf("%s://%s%s", s.scheme, s.base.Host, s.root)
+}
+
+// Open implements ExternalStorage.Open. The whole file is read into memory.
+func (s *webHDFSStorage) Open(ctx context.Context, name string) (storage.ExternalFileReader, error) {
+	data, err := s.ReadFile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return webHDFSFileReader{bytes.NewReader(data)}, nil
+}
+
+type webHDFSFileReader struct {
+	*bytes.Reader
+}
+
+// Close implements io.Closer.
+func (webHDFSFileReader) Close() error {
+	return nil
+}
+
+// Create implements ExternalStorage.Create.
+func (s *webHDFSStorage) Create(_ context.Context, name string) (storage.ExternalFileWriter, error) {
+	return &webHDFSFileWriter{storage: s, name: name}, nil
+}
+
+// webHDFSFileWriter buffers the written data, creates the file on the first flush and appends to it afterwards.
+type webHDFSFileWriter struct {
+	storage *webHDFSStorage
+	name    string
+	buf     bytes.Buffer
+	created bool
+}
+
+// Write implements ExternalFileWriter.Write.
+func (w *webHDFSFileWriter) Write(ctx context.Context, p []byte) (int, error) {
+	n, _ := w.buf.Write(p)
+	if w.buf.Len() >= webHDFSBufSize {
+		if err := w.flush(ctx); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+func (w *webHDFSFileWriter) flush(ctx context.Context) error {
+	var err error
+	if !w.created {
+		err = w.storage.WriteFile(ctx, w.name, w.buf.Bytes())
+		w.created = err == nil
+	} else if w.buf.Len() > 0 {
+		err = w.storage.appendFile(ctx, w.name, w.buf.Bytes())
+	}
+	if err != nil {
+		return err
+	}
+	w.buf.Reset()
+	return nil
+}
+
+// Close implements ExternalFileWriter.Close.
+func (w *webHDFSFileWriter) Close(ctx context.Context) error {
+	return w.flush(ctx)
+}
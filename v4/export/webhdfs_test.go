@@ -0,0 +1,195 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+// mockWebHDFS is a minimal in-memory WebHDFS server, which redirects data requests to "/datanode".
+type mockWebHDFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+	users []string
+}
+
+func (m *mockWebHDFS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	query := r.URL.Query()
+	if strings.HasPrefix(r.URL.Path, "/datanode") {
+		name := strings.TrimPrefix(r.URL.Path, "/datanode")
+		data, _ := ioutil.ReadAll(r.Body)
+		switch query.Get("op") {
+		case "CREATE":
+			m.files[name] = data
+			w.WriteHeader(http.StatusCreated)
+		case "APPEND":
+			m.files[name] = append(m.files[name], data...)
+		case "OPEN":
+			_, _ = w.Write(m.files[name])
+		}
+		return
+	}
+	m.users = append(m.users, query.Get("user.name"))
+	name := strings.TrimPrefix(r.URL.Path, webHDFSPrefix)
+	switch query.Get("op") {
+	case "MKDIRS":
+		m.dirs[name] = true
+		_, _ = w.Write([]byte(`{"boolean":true}`))
+	case "DELETE":
+		delete(m.files, name)
+		_, _ = w.Write([]byte(`{"boolean":true}`))
+	case "GETFILESTATUS":
+		if _, ok := m.files[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case "LISTSTATUS":
+		var statuses []webHDFSFileStatus
+		for file, data := range m.files {
+			if strings.HasPrefix(file, name+"/") {
+				statuses = append(statuses, webHDFSFileStatus{PathSuffix: strings.TrimPrefix(file, name+"/"), Type: "FILE", Length: int64(len(data))})
+			}
+		}
+		resp := map[string]interface{}{"FileStatuses": map[string]interface{}{"FileStatus": statuses}}
+		_ = json.NewEncoder(w).Encode(resp)
+	default:
+		http.Redirect(w, r, "/datanode"+name+"?"+r.URL.RawQuery, http.StatusTemporaryRedirect)
+	}
+}
+
+func (s *testUtilSuite) TestWebHDFSStorage(c *C) {
+	mock := &mockWebHDFS{files: map[string][]byte{}, dirs: map[string]bool{}}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	ctx := context.Background()
+
+	_, err := newWebHDFSStorage("hdfs://"+host+"/dump", HDFSConfig{}, http.DefaultClient)
+	c.Assert(err, ErrorMatches, ".*hdfs RPC protocol is not supported.*")
+
+	conf := DefaultConfig()
+	conf.OutputDirPath = "webhdfs://" + host + "/dump"
+	conf.HDFS.User = "hadoop"
+	extStore, err := conf.createExternalStorage(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(mock.dirs["/dump"], IsTrue)
+	c.Assert(extStore.URI(), Equals, "webhdfs://"+host+"/dump")
+
+	c.Assert(extStore.WriteFile(ctx, "metadata", []byte("meta")), IsNil)
+	writer, err := extStore.Create(ctx, "test.t.000000000.sql")
+	c.Assert(err, IsNil)
+	_, err = writer.Write(ctx, []byte("INSERT INTO `t` VALUES\n"))
+	c.Assert(err, IsNil)
+	_, err = writer.Write(ctx, []byte("(1);\n"))
+	c.Assert(err, IsNil)
+	c.Assert(writer.Close(ctx), IsNil)
+
+	data, err := extStore.ReadFile(ctx, "test.t.000000000.sql")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "INSERT INTO `t` VALUES\n(1);\n")
+	exists, err := extStore.FileExists(ctx, "metadata")
+	c.Assert(err, IsNil)
+	c.Assert(exists, IsTrue)
+	exists, err = extStore.FileExists(ctx, "not-exist")
+	c.Assert(err, IsNil)
+	c.Assert(exists, IsFalse)
+	c.Assert(extStore.WriteFile(ctx, writeCheckPath, []byte("test")), IsNil)
+	c.Assert(extStore.(fileDeleter).DeleteFile(ctx, writeCheckPath), IsNil)
+	exists, err = extStore.FileExists(ctx, writeCheckPath)
+	c.Assert(err, IsNil)
+	c.Assert(exists, IsFalse)
+
+	files := map[string]int64{}
+	err = extStore.WalkDir(ctx, nil, func(path string, size int64) error {
+		files[path] = size
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(files, DeepEquals, map[string]int64{"metadata": 4, "test.t.000000000.sql": 28})
+	for _, user := range mock.users {
+		c.Assert(user, Equals, "hadoop")
+	}
+}
+
+func (s *testUtilSuite) TestSecureWebHDFSStorage(c *C) {
+	mock := &mockWebHDFS{files: map[string][]byte{}, dirs: map[string]bool{}}
+	server := httptest.NewTLSServer(mock)
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+	ctx := context.Background()
+
+	caPath := path.Join(c.MkDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	c.Assert(ioutil.WriteFile(caPath, ca, 0o644), IsNil)
+	_, err := newWebHDFSStorage("webhdfs://"+host+"/dump", HDFSConfig{CAPath: caPath}, http.DefaultClient)
+	c.Assert(err, ErrorMatches, "the CA certificate of hdfs is only used by swebhdfs://.*")
+
+	conf := DefaultConfig()
+	conf.OutputDirPath = "swebhdfs://" + host + "/dump"
+	_, err = conf.createExternalStorage(ctx)
+	c.Assert(err, ErrorMatches, ".*certificate.*")
+	conf.HDFS.CAPath = caPath
+	extStore, err := conf.createExternalStorage(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(mock.dirs["/dump"], IsTrue)
+	c.Assert(extStore.URI(), Equals, "swebhdfs://"+host+"/dump")
+	c.Assert(extStore.WriteFile(ctx, "metadata", []byte("meta")), IsNil)
+	data, err := extStore.ReadFile(ctx, "metadata")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "meta")
+}
+
+func (s *testUtilSuite) TestWebHDFSStorageKerberos(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", "Negotiate")
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	conf := DefaultConfig()
+	conf.OutputDirPath = "webhdfs://" + strings.TrimPrefix(server.URL, "http://") + "/dump"
+	_, err := conf.createExternalStorage(context.Background())
+	c.Assert(err, ErrorMatches, ".*requires Kerberos \\(SPNEGO\\) authentication which isn't supported.*--hdfs-delegation-token")
+}
+
+func (s *testUtilSuite) TestWebHDFSStorageRedactsDelegationToken(c *C) {
+	const token = "secret-delegation-token"
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", "Negotiate")
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("request " + r.URL.String() + " failed"))
+	}))
+	host := strings.TrimPrefix(server.URL, "http://")
+	ctx := context.Background()
+	extStore, err := newWebHDFSStorage("webhdfs://"+host+"/dump", HDFSConfig{DelegationToken: token}, http.DefaultClient)
+	c.Assert(err, IsNil)
+
+	for _, code := range []int{http.StatusInternalServerError, http.StatusUnauthorized, http.StatusForbidden} {
+		status = code
+		err = extStore.WriteFile(ctx, "metadata", []byte("meta"))
+		c.Assert(err, NotNil)
+		c.Assert(strings.Contains(err.Error(), token), IsFalse, Commentf("status %d: %s", code, err))
+		c.Assert(strings.Contains(err.Error(), "delegation=%2A%2A%2A%2A%2A%2A"), IsTrue, Commentf("status %d: %s", code, err))
+	}
+	// the URL of the connection error is redacted too
+	server.Close()
+	_, err = extStore.ReadFile(ctx, "metadata")
+	c.Assert(err, NotNil)
+	c.Assert(strings.Contains(errors.ErrorStack(err), token), IsFalse, Commentf("%s", err))
+}
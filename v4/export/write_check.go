@@ -0,0 +1,52 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/errors"
+	"go.uber.org/zap"
+)
+
+// writeCheckPath is the marker written into the output to check it's writable before dumping
+const writeCheckPath = ".dumpling-write-test"
+
+// fileDeleter is implemented by the storages which can delete a file
+type fileDeleter interface {
+	DeleteFile(ctx context.Context, name string) error
+}
+
+// checkWritable writes and deletes a marker in the output, so a read-only or missing output and the wrong
+// credentials fail the dump before any data is read. The marker is left if the storage can't delete it.
+func checkWritable(tctx *tcontext.Context, conf *Config, extStore storage.ExternalStorage) error {
+	if err := extStore.WriteFile(tctx, writeCheckPath, []byte("dumpling write test\n")); err != nil {
+		return errors.Annotatef(err, "output %s isn't writable, please check it exists and the permissions and credentials, "+
+			"or skip this check by --%s", extStore.URI(), flagSkipWriteCheck)
+	}
+	var err error
+	if deleter, ok := extStore.(fileDeleter); ok {
+		err = deleter.DeleteFile(tctx, writeCheckPath)
+	} else {
+		var dir string
+		dir, err = localOutputDir(conf)
+		if err != nil {
+			return err
+		}
+		if dir == "" {
+			tctx.L().Info("output is writable, the write test marker is left since the storage can't delete it",
+				zap.String("file", writeCheckPath))
+			return nil
+		}
+		err = os.Remove(filepath.Join(dir, writeCheckPath))
+	}
+	if err != nil {
+		tctx.L().Warn("fail to delete the write test marker", zap.String("file", writeCheckPath), zap.Error(err))
+	}
+	return nil
+}
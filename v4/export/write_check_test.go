@@ -0,0 +1,55 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package export
+
+import (
+	"context"
+	"os"
+	"path"
+
+	tcontext "github.com/pingcap/dumpling/v4/context"
+
+	"github.com/pingcap/br/pkg/storage"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type readOnlyStorage struct {
+	storage.ExternalStorage
+}
+
+func (readOnlyStorage) WriteFile(context.Context, string, []byte) error {
+	return errors.New("access denied")
+}
+
+type deletableStorage struct {
+	storage.ExternalStorage
+	deleted []string
+}
+
+func (s *deletableStorage) DeleteFile(_ context.Context, name string) error {
+	s.deleted = append(s.deleted, name)
+	return nil
+}
+
+func (s *testFileModeSuite) TestCheckWritable(c *C) {
+	tctx := tcontext.Background().WithLogger(appLogger)
+	dir := c.MkDir()
+	conf := DefaultConfig()
+	conf.OutputDirPath = dir
+	extStore, err := conf.createExternalStorage(tctx)
+	c.Assert(err, IsNil)
+
+	// the marker is deleted from the local output
+	c.Assert(checkWritable(tctx, conf, extStore), IsNil)
+	_, err = os.Stat(path.Join(dir, writeCheckPath))
+	c.Assert(os.IsNotExist(err), IsTrue)
+
+	// the marker is deleted by the storage if it can delete files
+	deletable := &deletableStorage{ExternalStorage: extStore}
+	c.Assert(checkWritable(tctx, conf, deletable), IsNil)
+	c.Assert(deletable.deleted, DeepEquals, []string{writeCheckPath})
+
+	err = checkWritable(tctx, conf, readOnlyStorage{extStore})
+	c.Assert(err, ErrorMatches, "output .* isn't writable, .* or skip this check by --skip-write-check: access denied")
+}
@@ -8,12 +8,16 @@ import (
 	"fmt"
 	"strings"
 	"text/template"
+	"time"
 
 	tcontext "github.com/pingcap/dumpling/v4/context"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/pingcap/br/pkg/storage"
+	"github.com/pingcap/br/pkg/summary"
 	"github.com/pingcap/br/pkg/utils"
 	"github.com/pingcap/errors"
+	"github.com/pingcap/failpoint"
 	"go.uber.org/zap"
 )
 
@@ -28,8 +32,50 @@ type Writer struct {
 	fileFmt    FileFormat
 
 	receivedTaskCount int
+	pauseCtl          *pauseController
+	tableStats        *tableStatsCollector
+	catalog           *catalogRecorder
+	checksums         *checksumStorage
+	importInto        *importIntoRecorder
+	verification      *verificationRecorder
+	pkIndex           *pkIndexRecorder
+	chunkCounts       *chunkCountRecorder
+	loader            *loader
+	kafkaSink         *kafkaSink
+	// replicaLagPauseCtl is paused while the replication lag exceeds Config.MaxReplicaLagSeconds
+	replicaLagPauseCtl *pauseController
+	// threads throttles the writer while the memory in use exceeds Config.MemoryWatermark
+	threads *adaptiveThreads
+	// startDelay is how long the writer waits before picking up the first task, to ramp up the load gradually
+	startDelay time.Duration
+	// freeSpaceDir is the local output directory whose free space is checked before writing each file
+	freeSpaceDir string
+	// serverSideDumpDir is the directory where the server writes the chunks by SELECT ... INTO OUTFILE
+	serverSideDumpDir string
+	// rowsLimiter and bytesLimiter limit the rows and bytes dumped per second by all the writers
+	rowsLimiter  *rateLimiter
+	bytesLimiter *rateLimiter
+	// progress tracks the table chunks being written, and chunkProgress is the chunk being written by this writer
+	progress      *progressTracker
+	chunkProgress *chunkProgress
+	// stream buffers the sql files of the task being written into the single output with Config.OutputMode single
+	stream *streamStorage
+	// gcLease tells whether the snapshot is still protected from GC, so the snapshot too old error can be retried
+	gcLease *gcSafePointLease
+	// tableErrors skips the tables dropped or altered during the dump, or writes them again at the snapshot
+	tableErrors *tableErrorHandler
+
+	// subChunk is appended to the indexes of the data files written for a sub-chunk of a slow chunk
+	subChunk string
+	// keyColumns and keyRange are the ordering key of the chunk being written and its WHERE bounds,
+	// they are recorded in the catalog for each data file
+	keyColumns []string
+	keyRange   *chunkKeyRange
+	// binlogPos is the binlog position before the chunk being written is read, with Config.PerChunkBinlogPos
+	binlogPos *chunkBinlogPos
 
 	rebuildConnFn       func(*sql.Conn) (*sql.Conn, error)
+	newConnFn           func() (*sql.Conn, error)
 	finishTaskCallBack  func(Task)
 	finishTableCallBack func(Task)
 }
@@ -50,6 +96,14 @@ func NewWriter(tctx *tcontext.Context, id int64, config *Config, conn *sql.Conn,
 		sw.fileFmt = FileFormatSQLText
 	case FileFormatCSVString:
 		sw.fileFmt = FileFormatCSV
+	case FileFormatMongoJSONString:
+		sw.fileFmt = FileFormatMongoJSON
+	case FileFormatChangeFeedString:
+		sw.fileFmt = FileFormatChangeFeed
+	case FileFormatParquetString:
+		sw.fileFmt = FileFormatParquet
+	case FileFormatJSONLinesString:
+		sw.fileFmt = FileFormatJSONLines
 	}
 	return sw
 }
@@ -71,7 +125,33 @@ func countTotalTask(writers []*Writer) int {
 }
 
 func (w *Writer) run(taskStream <-chan Task) error {
+	if w.startDelay > 0 {
+		timer := time.NewTimer(w.startDelay)
+		select {
+		case <-w.tctx.Done():
+			timer.Stop()
+			w.tctx.L().Warn("context has been done before the writer starts, the writer will exit",
+				zap.Int64("writer ID", w.id))
+			return nil
+		case <-timer.C:
+		}
+	}
 	for {
+		if err := w.pauseCtl.waitIfPaused(w.tctx); err != nil {
+			w.tctx.L().Warn("context has been done while paused, the writer will exit",
+				zap.Int64("writer ID", w.id))
+			return nil
+		}
+		if err := w.replicaLagPauseCtl.waitIfPaused(w.tctx); err != nil {
+			w.tctx.L().Warn("context has been done while paused by the replication lag, the writer will exit",
+				zap.Int64("writer ID", w.id))
+			return nil
+		}
+		if err := w.threads.waitIfThrottled(w.tctx, w.id); err != nil {
+			w.tctx.L().Warn("context has been done while throttled by the memory in use, the writer will exit",
+				zap.Int64("writer ID", w.id))
+			return nil
+		}
 		select {
 		case <-w.tctx.Done():
 			w.tctx.L().Warn("context has been done, the writer will exit",
@@ -82,7 +162,11 @@ func (w *Writer) run(taskStream <-chan Task) error {
 				return nil
 			}
 			w.receivedTaskCount++
+			w.stream.begin(task)
 			err := w.handleTask(task)
+			if err == nil {
+				err = w.stream.finish(w.tctx)
+			}
 			if err != nil {
 				return err
 			}
@@ -94,15 +178,51 @@ func (w *Writer) run(taskStream <-chan Task) error {
 func (w *Writer) handleTask(task Task) error {
 	switch t := task.(type) {
 	case *TaskDatabaseMeta:
+		if t.MigrationVersion > 0 {
+			return w.writeMigrationFile(t.MigrationVersion, t.DatabaseName, "", t.CreateDatabaseSQL)
+		}
 		return w.WriteDatabaseMeta(t.DatabaseName, t.CreateDatabaseSQL)
 	case *TaskTableMeta:
+		if t.MigrationVersion > 0 {
+			return w.writeMigrationFile(t.MigrationVersion, t.DatabaseName, t.TableName, migrationSQL(t.DatabaseName, t.CreateTableSQL))
+		}
 		return w.WriteTableMeta(t.DatabaseName, t.TableName, t.CreateTableSQL)
 	case *TaskViewMeta:
+		if t.MigrationVersion > 0 {
+			return w.writeMigrationFile(t.MigrationVersion, t.DatabaseName, t.ViewName, migrationSQL(t.DatabaseName, t.CreateViewSQL))
+		}
 		return w.WriteViewMeta(t.DatabaseName, t.ViewName, t.CreateTableSQL, t.CreateViewSQL)
+	case *TaskTriggerMeta:
+		if t.MigrationVersion > 0 {
+			return w.writeMigrationFile(t.MigrationVersion, t.DatabaseName, t.TableName+"_triggers", migrationSQL(t.DatabaseName, t.CreateTriggerSQL))
+		}
+		return w.WriteTriggerMeta(t.DatabaseName, t.TableName, t.CreateTriggerSQL)
+	case *TaskRoutineMeta:
+		if t.MigrationVersion > 0 {
+			return w.writeMigrationFile(t.MigrationVersion, t.DatabaseName, t.RoutineName, migrationSQL(t.DatabaseName, t.CreateRoutineSQL))
+		}
+		return w.WriteRoutineMeta(t.DatabaseName, t.RoutineName, t.RoutineType, t.CreateRoutineSQL)
+	case *TaskSequenceMeta:
+		return w.WriteSequenceMeta(t.DatabaseName, t.SequenceName, t.CreateSequenceSQL, t.SetValueSQL)
 	case *TaskTableData:
-		err := w.WriteTableData(t.Meta, t.Data, t.ChunkIndex)
-		if err != nil {
-			return err
+		if w.tableErrors.isSkipped(t.Meta.DatabaseName(), t.Meta.TableName()) {
+			w.tctx.L().Debug("skip the chunk of the table skipped",
+				zap.String("database", t.Meta.DatabaseName()), zap.String("table", t.Meta.TableName()),
+				zap.Int("chunkIdx", t.ChunkIndex))
+		} else if tableBudgetOf(t.Meta).allow() {
+			written := true
+			if err := w.writeChunk(t); err != nil {
+				if written, err = w.writeChunkAfterError(t, err); err != nil {
+					return err
+				}
+			}
+			if written {
+				w.chunkCounts.written(t)
+			}
+		} else {
+			w.tctx.L().Debug("skip the chunk after the budget of the table elapses",
+				zap.String("database", t.Meta.DatabaseName()), zap.String("table", t.Meta.TableName()),
+				zap.Int("chunkIdx", t.ChunkIndex))
 		}
 		if t.ChunkIndex+1 == t.TotalChunks {
 			w.finishTableCallBack(task)
@@ -116,48 +236,107 @@ func (w *Writer) handleTask(task Task) error {
 
 // WriteDatabaseMeta writes database meta to a file
 func (w *Writer) WriteDatabaseMeta(db, createSQL string) error {
-	tctx, conf := w.tctx, w.conf
-	fileName, err := (&outputFileNamer{DB: db}).render(conf.OutputFileTemplate, outputFileTemplateSchema)
+	conf := w.conf
+	fileName, err := (&outputFileNamer{DB: outputIdentifier(conf, db)}).render(conf.OutputFileTemplate, outputFileTemplateSchema)
 	if err != nil {
 		return err
 	}
-	return writeMetaToFile(tctx, db, createSQL, w.extStorage, fileName+".sql", conf.CompressType)
+	return w.writeSchemaFile(db, "", createSQL, schemaFilePath(conf, schemaDirDatabases, fileName+".sql"))
 }
 
 // WriteTableMeta writes table meta to a file
 func (w *Writer) WriteTableMeta(db, table, createSQL string) error {
-	tctx, conf := w.tctx, w.conf
-	fileName, err := (&outputFileNamer{DB: db, Table: table}).render(conf.OutputFileTemplate, outputFileTemplateTable)
+	conf := w.conf
+	fileName, err := (&outputFileNamer{DB: outputIdentifier(conf, db), Table: outputIdentifier(conf, table)}).render(conf.OutputFileTemplate, outputFileTemplateTable)
 	if err != nil {
 		return err
 	}
-	return writeMetaToFile(tctx, db, createSQL, w.extStorage, fileName+".sql", conf.CompressType)
+	return w.writeSchemaFile(db, table, createSQL, schemaFilePath(conf, schemaDirTables, fileName+".sql"))
 }
 
 // WriteViewMeta writes view meta to a file
 func (w *Writer) WriteViewMeta(db, view, createTableSQL, createViewSQL string) error {
-	tctx, conf := w.tctx, w.conf
-	fileNameTable, err := (&outputFileNamer{DB: db, Table: view}).render(conf.OutputFileTemplate, outputFileTemplateTable)
+	conf := w.conf
+	fileNameTable, err := (&outputFileNamer{DB: outputIdentifier(conf, db), Table: outputIdentifier(conf, view)}).render(conf.OutputFileTemplate, outputFileTemplateTable)
+	if err != nil {
+		return err
+	}
+	fileNameView, err := (&outputFileNamer{DB: outputIdentifier(conf, db), Table: outputIdentifier(conf, view)}).render(conf.OutputFileTemplate, outputFileTemplateView)
 	if err != nil {
 		return err
 	}
-	fileNameView, err := (&outputFileNamer{DB: db, Table: view}).render(conf.OutputFileTemplate, outputFileTemplateView)
+	// the placeholder table and the definition of a view are written separately if the view is in a cycle
+	if createTableSQL != "" {
+		err = w.writeSchemaFile(db, view, createTableSQL, schemaFilePath(conf, schemaDirViews, fileNameTable+".sql"))
+		if err != nil {
+			return err
+		}
+	}
+	if createViewSQL == "" {
+		return nil
+	}
+	return w.writeSchemaFile(db, view, createViewSQL, schemaFilePath(conf, schemaDirViews, fileNameView+".sql"))
+}
+
+// WriteTriggerMeta writes the triggers of a table to a file
+func (w *Writer) WriteTriggerMeta(db, table, createSQL string) error {
+	conf := w.conf
+	fileName, err := (&outputFileNamer{DB: outputIdentifier(conf, db), Table: outputIdentifier(conf, table)}).render(conf.OutputFileTemplate, outputFileTemplateTrigger)
 	if err != nil {
 		return err
 	}
-	err = writeMetaToFile(tctx, db, createTableSQL, w.extStorage, fileNameTable+".sql", conf.CompressType)
+	return w.writeSchemaFile(db, table, createSQL, schemaFilePath(conf, schemaDirTriggers, fileName+".sql"))
+}
+
+// WriteRoutineMeta writes a stored procedure, a stored function or an event to a file, routineType is the name
+// of its output file template
+func (w *Writer) WriteRoutineMeta(db, routine, routineType, createSQL string) error {
+	conf := w.conf
+	fileName, err := (&outputFileNamer{DB: outputIdentifier(conf, db), Table: outputIdentifier(conf, routine)}).render(conf.OutputFileTemplate, routineType)
 	if err != nil {
 		return err
 	}
-	return writeMetaToFile(tctx, db, createViewSQL, w.extStorage, fileNameView+".sql", conf.CompressType)
+	return w.writeSchemaFile(db, "", createSQL, schemaFilePath(conf, schemaDirRoutines, fileName+".sql"))
+}
+
+// WriteSequenceMeta writes a sequence and the statement setting its next value to a file
+func (w *Writer) WriteSequenceMeta(db, sequence, createSQL, setValueSQL string) error {
+	conf := w.conf
+	fileName, err := (&outputFileNamer{DB: outputIdentifier(conf, db), Table: outputIdentifier(conf, sequence)}).render(conf.OutputFileTemplate, outputFileTemplateSequence)
+	if err != nil {
+		return err
+	}
+	return w.writeSchemaFile(db, "", createSQL+";\n"+setValueSQL, schemaFilePath(conf, schemaDirSequences, fileName+".sql"))
+}
+
+// writeMigrationFile writes the schema of a database, table, view, trigger or routine to a migration-tool-friendly file
+func (w *Writer) writeMigrationFile(version int, db, table, createSQL string) error {
+	conf := w.conf
+	return w.writeSchemaFile(db, table, createSQL, migrationFileName(version, outputIdentifier(conf, db), outputIdentifier(conf, table)))
+}
+
+// writeSchemaFile writes the schema of a database, table or view to fileName, and records it in the catalog
+func (w *Writer) writeSchemaFile(db, table, createSQL, fileName string) error {
+	compressType := w.conf.CompressType
+	createSQL = requoteIdentifiers(w.conf.IdentifierQuote, outputIdentifiers(w.conf, createSQL))
+	if err := writeMetaToFile(w.tctx, db, createSQL, w.extStorage, fileName, compressType, w.conf.EnsureTrailingNewline); err != nil {
+		return err
+	}
+	w.catalog.addFile(db, table, fileName+compressFileSuffix(compressType))
+	w.checksums.addFile(db, table, -1, fileName+compressFileSuffix(compressType))
+	return nil
 }
 
 // WriteTableData writes table data to a file with retry
 func (w *Writer) WriteTableData(meta TableMeta, ir TableDataIR, currentChunk int) error {
+	return w.writeTableData(meta, ir, currentChunk, "")
+}
+
+func (w *Writer) writeTableData(meta TableMeta, ir TableDataIR, currentChunk int, chunkField string) error {
 	tctx, conf, conn := w.tctx, w.conf, w.conn
 	retryTime := 0
 	var lastErr error
-	return utils.WithRetry(tctx, func() (err error) {
+	err := utils.WithRetry(tctx, func() (err error) {
 		defer func() {
 			lastErr = err
 			if err != nil {
@@ -175,7 +354,23 @@ func (w *Writer) WriteTableData(meta TableMeta, ir TableDataIR, currentChunk int
 				return
 			}
 		}
-		err = ir.Start(tctx, conn)
+		if td, ok := ir.(*tableData); ok && w.serverSideDumpDir != "" {
+			return w.dumpTableDataServerSide(tctx, conn, meta, td, currentChunk)
+		}
+		if conf.PerChunkBinlogPos {
+			w.binlogPos, err = readChunkBinlogPos(tctx, conn, conf.ServerInfo.ServerType)
+			if err != nil {
+				return
+			}
+		}
+		failpoint.Inject("FailChunkQuery", func(val failpoint.Value) {
+			failpoint.Return(&mysql.MySQLError{Number: uint16(val.(int)), Message: "injected chunk query error"})
+		})
+		if err = injectedTableNotExistErr(meta.DatabaseName(), meta.TableName()); err != nil {
+			return
+		}
+		stopQuery, err := startChunkQuery(tctx, conf, meta, ir, conn)
+		defer stopQuery()
 		if err != nil {
 			return
 		}
@@ -186,29 +381,151 @@ func (w *Writer) WriteTableData(meta TableMeta, ir TableDataIR, currentChunk int
 			}
 		}
 		defer ir.Close()
-		return w.tryToWriteTableData(tctx, meta, ir, currentChunk)
-	}, newDumpChunkBackoffer(canRebuildConn(conf.Consistency, conf.TransactionalConsistency)))
+		if meta, err = checkColumnCount(tctx, conf, meta, ir); err != nil {
+			return err
+		}
+		return w.tryToWriteTableData(tctx, meta, ir, currentChunk, chunkField)
+	}, newChunkQueryBackoffer(conf, w.gcLease))
+	return newChunkError(meta, currentChunk, ir, err)
+}
+
+// canRetryChunk checks whether a chunk can be dumped again after it fails
+func canRetryChunk(conf *Config) bool {
+	// the partial file written into the FIFO or loaded into the target can't be re-written
+	return canRebuildConn(conf.Consistency, conf.TransactionalConsistency) && conf.OutputFIFO == "" && conf.TargetDSN == ""
 }
 
-func (w *Writer) tryToWriteTableData(tctx *tcontext.Context, meta TableMeta, ir TableDataIR, curChkIdx int) error {
-	conf, format := w.conf, w.fileFmt
-	namer := newOutputFileNamer(meta, curChkIdx, conf.Rows != UnspecifiedSize, conf.FileSize != UnspecifiedSize)
+func (w *Writer) tryToWriteTableData(tctx *tcontext.Context, meta TableMeta, ir TableDataIR, curChkIdx int, chunkField string) error {
+	conf, format, start := w.conf, w.fileFmt, time.Now()
+	ir = withRowsRateLimit(tctx, ir, w.rowsLimiter)
+	w.chunkProgress = w.progress.start(meta, curChkIdx)
+	defer func() {
+		w.progress.finish(w.chunkProgress)
+		w.chunkProgress = nil
+	}()
+	var dedupIR *dedupRowsIR
+	if keyIndices := dedupKeyIndices(tctx, meta); len(keyIndices) > 0 {
+		dedupIR = newDedupRowsIR(ir, keyIndices)
+		ir = dedupIR
+	}
+	if replacements := invalidEnumReplacements(conf.InvalidEnumHandling, meta); replacements != nil {
+		ir = newInvalidEnumIR(ir, replacements)
+	}
+	if transforms := columnTransformsOf(tctx, conf, meta); transforms != nil {
+		ir = newColumnTransformIR(ir, transforms)
+	}
+	var truncateIR *maxFieldBytesIR
+	if conf.MaxFieldBytes > 0 {
+		truncateIR = newMaxFieldBytesIR(ir, conf.MaxFieldBytes)
+		ir = truncateIR
+	}
+	sampleIR := w.verification.sampler(tctx, meta, ir)
+	if sampleIR != nil {
+		ir = sampleIR
+	}
+	pkIndexIR := w.pkIndex.indexer(tctx, meta, ir)
+	if pkIndexIR != nil {
+		ir = pkIndexIR
+	}
+	var metadataIR *chunkMetadataIR
+	if conf.ChunkMetadata {
+		metadataIR = newChunkMetadataIR(ir, meta, chunkField)
+		ir = metadataIR
+	}
+	var keyIR *keyRangeIR
+	keyColumns := chunkKeyColumnsOf(w.keyColumns, chunkField)
+	if w.catalog != nil && len(keyColumns) > 0 && (w.keyRange == nil || conf.FileSize != UnspecifiedSize) {
+		if keyIndices, missing := keyColumnIndices(meta, keyColumns); missing == "" {
+			keyIR = newKeyRangeIR(ir, keyIndices)
+			ir = keyIR
+		}
+	}
+	namer := newOutputFileNamer(meta, curChkIdx, conf.chunked(meta.DatabaseName(), meta.TableName()), conf.FileSize != UnspecifiedSize)
+	namer.hashPrefixes = conf.HashPrefixFiles
+	namer.DB, namer.Table = outputIdentifier(conf, namer.DB), outputIdentifier(conf, namer.Table)
+	namer.subChunk = w.subChunk
 	fileName, err := namer.NextName(conf.OutputFileTemplate, w.fileFmt.Extension())
 	if err != nil {
 		return err
 	}
 
+	writeConf := conf
+	if fileSize := conf.fileSizeOf(meta.DatabaseName(), meta.TableName()); fileSize != conf.FileSize {
+		c := *conf
+		c.FileSize = fileSize
+		writeConf = &c
+	}
+
 	somethingIsWritten := false
-	for {
-		fileWriter, tearDown := buildInterceptFileWriter(tctx, w.extStorage, fileName, conf.CompressType)
-		n, err := format.WriteInsert(tctx, conf, meta, ir, fileWriter)
+	var writtenRows, writtenBytes, compressedBytes, checksum uint64
+	partitioned := partitionByColumnOf(meta) != ""
+	if partitioned {
+		stats, err := w.writePartitionedTableData(tctx, meta, ir, curChkIdx)
+		if err != nil {
+			return err
+		}
+		writtenRows, writtenBytes, compressedBytes, checksum = stats.rows, stats.bytes, stats.compressedBytes, stats.checksum
+		somethingIsWritten = writtenRows > 0
+	}
+	for !partitioned {
+		var fileMeta *chunkMetadata
+		if metadataIR != nil {
+			fileMeta = &chunkMetadata{File: fileName + compressFileSuffix(conf.CompressType), ChunkIndex: curChkIdx, Column: chunkField,
+				BinlogPos: w.binlogPos}
+			metadataIR.reset(fileMeta)
+		}
+		if keyIR != nil {
+			keyIR.reset()
+		}
+		if w.freeSpaceDir != "" {
+			if err = checkFreeSpace(w.freeSpaceDir, conf.MinFreeSpace); err != nil {
+				return newWriterError(err)
+			}
+		}
+		fileWriter, tearDown := buildInterceptFileWriter(tctx, w.kafkaSink.storage(w.loader.storage(w.extStorage, meta), meta), fileName, conf.CompressType,
+			conf.EnsureTrailingNewline && format != FileFormatParquet)
+		dataWriter, checksumWriter := withStatsChecksum(conf, withChunkProgress(withBytesRateLimit(fileWriter, w.bytesLimiter), w.chunkProgress))
+		n, err := format.WriteInsert(tctx, writeConf, meta, ir, dataWriter)
+		if iw, ok := fileWriter.(*InterceptFileWriter); err == nil && ok && iw.SomethingIsWritten &&
+			conf.RowCountTrailer && w.fileFmt == FileFormatSQLText {
+			err = writeRowCountTrailer(tctx, dataWriter, n)
+		}
 		tearDown(tctx)
 		if err != nil {
+			w.removePartialFile(fileName)
 			return err
 		}
+		writtenRows += n
+		checksum += checksumWriter.sum()
 
-		if w, ok := fileWriter.(*InterceptFileWriter); ok && !w.SomethingIsWritten {
-			break
+		if w, ok := fileWriter.(*InterceptFileWriter); ok {
+			writtenBytes += w.WrittenBytes
+			compressedBytes += w.CompressedBytes
+			if !w.SomethingIsWritten {
+				break
+			}
+		}
+		w.catalog.addFile(meta.DatabaseName(), meta.TableName(), fileName+compressFileSuffix(conf.CompressType))
+		w.checksums.addFile(meta.DatabaseName(), meta.TableName(), curChkIdx, fileName+compressFileSuffix(conf.CompressType))
+		w.chunkCounts.addFile(meta, fileName+compressFileSuffix(conf.CompressType))
+		w.importInto.addTable(meta)
+		if min, max, ok := w.fileKeyRange(keyIR); ok {
+			w.catalog.addKeyRange(meta.DatabaseName(), meta.TableName(), keyColumns,
+				catalogKeyRange{File: fileName + compressFileSuffix(conf.CompressType), Min: min, Max: max})
+		}
+		if conf.RowCountTrailer && w.fileFmt == FileFormatCSV {
+			if err = writeRowCountSidecar(tctx, w.extStorage, fileName+compressFileSuffix(conf.CompressType), n); err != nil {
+				return err
+			}
+		}
+		if fileMeta != nil {
+			fileMeta.Rows = n
+			if conf.CompressType != CompressNone {
+				fileMeta.UncompressedSize = fileWriter.(*InterceptFileWriter).WrittenBytes
+			}
+			if err = fileMeta.write(tctx, w.extStorage); err != nil {
+				return err
+			}
 		}
 
 		tctx.L().Debug("finish dumping table(chunk)",
@@ -232,11 +549,47 @@ func (w *Writer) tryToWriteTableData(tctx *tcontext.Context, meta TableMeta, ir
 			zap.String("table", meta.TableName()),
 			zap.Int("chunkIdx", curChkIdx))
 	}
+	if dedupIR != nil && dedupIR.dropped > 0 {
+		tctx.L().Warn("drop rows with duplicated primary key in table chunk",
+			zap.String("database", meta.DatabaseName()),
+			zap.String("table", meta.TableName()),
+			zap.Int("chunkIdx", curChkIdx),
+			zap.Uint64("dropped rows", dedupIR.dropped))
+		summary.CollectSuccessUnit(droppedDuplicatedRowsUnit, 1, dedupIR.dropped)
+	}
+	if truncateIR != nil && truncateIR.truncated > 0 {
+		tctx.L().Warn("truncate the values longer than --max-field-bytes in table chunk",
+			zap.String("database", meta.DatabaseName()),
+			zap.String("table", meta.TableName()),
+			zap.Int("chunkIdx", curChkIdx),
+			zap.Uint64("truncated fields", truncateIR.truncated))
+		summary.CollectSuccessUnit(truncatedFieldsUnit, 1, truncateIR.truncated)
+	}
+	if conf.CompressType != CompressNone {
+		summary.CollectSuccessUnit(compressedBytesUnit, 1, compressedBytes)
+	}
+	chunkStats := tableChunkStats{
+		rows:            writtenRows,
+		bytes:           writtenBytes,
+		compressedBytes: compressedBytes,
+		checksum:        checksum,
+		start:           start,
+		end:             time.Now(),
+	}
+	w.tableStats.add(meta.DatabaseName(), meta.TableName(), chunkStats)
+	w.chunkCounts.addStats(meta, chunkStats)
+	if conf.SampleFraction > 0 {
+		summary.CollectSuccessUnit(sampledRowsUnit, 1, writtenRows)
+	}
+	if sampleIR != nil {
+		w.verification.add(meta, curChkIdx, w.subChunk, sampleIR.rows, sampleIR.samples)
+	}
+	w.pkIndex.add(meta, pkIndexIR)
 	return nil
 }
 
-func writeMetaToFile(tctx *tcontext.Context, target, metaSQL string, s storage.ExternalStorage, path string, compressType storage.CompressType) error {
-	fileWriter, tearDown, err := buildFileWriter(tctx, s, path, compressType)
+func writeMetaToFile(tctx *tcontext.Context, target, metaSQL string, s storage.ExternalStorage, path string, compressType CompressType, ensureTrailingNewline bool) error {
+	fileWriter, tearDown, err := buildFileWriter(tctx, s, path, compressType, ensureTrailingNewline)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -257,6 +610,9 @@ type outputFileNamer struct {
 	DB         string
 	Table      string
 	format     string
+	subChunk   string
+	// hashPrefixes is Config.HashPrefixFiles
+	hashPrefixes int
 }
 
 type csvOption struct {
@@ -268,7 +624,7 @@ type csvOption struct {
 func newOutputFileNamer(meta TableMeta, chunkIdx int, rows, fileSize bool) *outputFileNamer {
 	o := &outputFileNamer{
 		DB:    meta.DatabaseName(),
-		Table: meta.TableName(),
+		Table: outputTableName(meta),
 	}
 	o.ChunkIndex = chunkIdx
 	o.FileIndex = 0
@@ -292,11 +648,11 @@ func (namer *outputFileNamer) render(tmpl *template.Template, subName string) (s
 }
 
 func (namer *outputFileNamer) Index() string {
-	return fmt.Sprintf(namer.format, namer.ChunkIndex, namer.FileIndex)
+	return fmt.Sprintf(namer.format, namer.ChunkIndex, namer.FileIndex) + namer.subChunk
 }
 
 func (namer *outputFileNamer) NextName(tmpl *template.Template, fileType string) (string, error) {
 	res, err := namer.render(tmpl, outputFileTemplateData)
 	namer.FileIndex++
-	return res + "." + fileType, err
+	return hashPrefixedName(res+"."+fileType, namer.hashPrefixes), err
 }
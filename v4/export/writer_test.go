@@ -3,15 +3,19 @@
 package export
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"database/sql/driver"
 	"io/ioutil"
 	"os"
 	"path"
+	"time"
 
 	tcontext "github.com/pingcap/dumpling/v4/context"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pingcap/br/pkg/storage"
 	. "github.com/pingcap/check"
 )
 
@@ -97,6 +101,76 @@ func (s *testWriterSuite) TestWriteViewMeta(c *C) {
 	c.Assert(string(bytes), Equals, specCmt+createViewSQL)
 }
 
+func (s *testWriterSuite) TestWriteMigrationLayout(c *C) {
+	dir := c.MkDir()
+
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = dir
+	config.MigrationLayout = true
+
+	tctx := tcontext.Background().WithLogger(appLogger)
+	versions := newMigrationVersions(tctx, DatabaseTables{}.
+		AppendTables("b", "t2", "t1").
+		AppendViews("a", "v1").
+		AppendTables("a", "t.3"),
+		map[string][]string{"a": {"f1"}},
+		[]foreignKey{{childDB: "a", childTable: "t.3", parentDB: "b", parentTable: "t2"}})
+	c.Assert(versions.database("a"), Equals, 1)
+	c.Assert(versions.database("b"), Equals, 2)
+	c.Assert(versions.routine("a", "f1"), Equals, 3)
+	// a table is created after the tables it references
+	c.Assert(versions.table("b", "t1"), Equals, 4)
+	c.Assert(versions.table("b", "t2"), Equals, 5)
+	c.Assert(versions.table("a", "t.3"), Equals, 6)
+	c.Assert(versions.table("a", "v1"), Equals, 7)
+	c.Assert(versions.next(), Equals, 8)
+	c.Assert(versions.routine("a", "f2"), Equals, 9)
+
+	// a cycle of foreign keys is broken at the first table, which is created with the foreign key checks disabled
+	cyclic := newMigrationVersions(tctx, DatabaseTables{}.AppendTables("c", "x", "y", "z"), nil, []foreignKey{
+		{childDB: "c", childTable: "x", parentDB: "c", parentTable: "y"},
+		{childDB: "c", childTable: "y", parentDB: "c", parentTable: "x"},
+		{childDB: "c", childTable: "y", parentDB: "c", parentTable: "z"},
+		{childDB: "c", childTable: "z", parentDB: "c", parentTable: "z"},
+	})
+	c.Assert(cyclic.table("c", "z"), Equals, 2)
+	c.Assert(cyclic.table("c", "x"), Equals, 3)
+	c.Assert(cyclic.table("c", "y"), Equals, 4)
+	c.Assert(cyclic.createTableSQL("c", "x", "CREATE TABLE `x` (a INT)"), Equals, "/*!40014 SET FOREIGN_KEY_CHECKS=0*/;\nCREATE TABLE `x` (a INT)")
+	c.Assert(cyclic.createTableSQL("c", "y", "CREATE TABLE `y` (a INT)"), Equals, "CREATE TABLE `y` (a INT)")
+
+	writer := s.newWriter(config, c)
+	tasks := []Task{
+		&TaskDatabaseMeta{DatabaseName: "a", CreateDatabaseSQL: "CREATE DATABASE `a`", MigrationVersion: 1},
+		&TaskRoutineMeta{DatabaseName: "a", RoutineName: "f1", RoutineType: "function",
+			CreateRoutineSQL: "DELIMITER ;;\nCREATE FUNCTION `f1`() RETURNS INT RETURN 1;;\nDELIMITER ;\n", MigrationVersion: 3},
+		&TaskTableMeta{DatabaseName: "a", TableName: "t.3", CreateTableSQL: "CREATE TABLE `t.3` (a INT)", MigrationVersion: 6},
+		&TaskViewMeta{DatabaseName: "a", ViewName: "v1", CreateTableSQL: "CREATE TABLE `v1` (a INT)",
+			CreateViewSQL: "CREATE VIEW `v1` AS SELECT 1", MigrationVersion: 7},
+		&TaskTriggerMeta{DatabaseName: "a", TableName: "t.3",
+			CreateTriggerSQL: "DELIMITER ;;\nCREATE TRIGGER `tr` BEFORE INSERT ON `t.3` FOR EACH ROW SET @a = 1;;\nDELIMITER ;\n", MigrationVersion: 8},
+	}
+	for _, task := range tasks {
+		c.Assert(writer.handleTask(task), IsNil)
+	}
+	cases := map[string]string{
+		"V1__create_a.sql":       "/*!40101 SET NAMES binary*/;\nCREATE DATABASE `a`;\n",
+		"V3__create_a_f1.sql":    "/*!40101 SET NAMES binary*/;\nUSE `a`;\nDELIMITER ;;\nCREATE FUNCTION `f1`() RETURNS INT RETURN 1;;\nDELIMITER ;\n",
+		"V6__create_a_t%2E3.sql": "/*!40101 SET NAMES binary*/;\nUSE `a`;\nCREATE TABLE `t.3` (a INT);\n",
+		"V7__create_a_v1.sql":    "/*!40101 SET NAMES binary*/;\nUSE `a`;\nCREATE VIEW `v1` AS SELECT 1;\n",
+		"V8__create_a_t%2E3_triggers.sql": "/*!40101 SET NAMES binary*/;\nUSE `a`;\n" +
+			"DELIMITER ;;\nCREATE TRIGGER `tr` BEFORE INSERT ON `t.3` FOR EACH ROW SET @a = 1;;\nDELIMITER ;\n",
+	}
+	for name, expected := range cases {
+		bytes, err := ioutil.ReadFile(path.Join(dir, name))
+		c.Assert(err, IsNil)
+		c.Assert(string(bytes), Equals, expected)
+	}
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, len(cases))
+}
+
 func (s *testWriterSuite) TestWriteTableData(c *C) {
 	dir := c.MkDir()
 
@@ -136,6 +210,46 @@ func (s *testWriterSuite) TestWriteTableData(c *C) {
 	c.Assert(string(bytes), Equals, expected)
 }
 
+func (s *testWriterSuite) TestWriteTableDataWithAnnotation(c *C) {
+	dir := c.MkDir()
+
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = dir
+	config.AnnotateFiles = true
+
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+	mock.ExpectQuery("SELECT \\* FROM `test`.`t` LIMIT 1").WillReturnRows(mock.NewRowsWithColumnDefinition(
+		mock.NewColumn("id").OfType("INT", 0), mock.NewColumn("name").OfType("VARCHAR", "")))
+	colTypes, err := GetColumnTypes(conn, "*", "test", "t")
+	c.Assert(err, IsNil)
+	meta := &tableMeta{
+		database:      "test",
+		table:         "t",
+		colTypes:      colTypes,
+		selectedField: "*",
+		specCmts:      []string{"/*!40101 SET NAMES binary*/;"},
+		showCreateTable: "CREATE TABLE `t` (\n  `id` int(11) NOT NULL,\n  `name` varchar(10) DEFAULT NULL,\n" +
+			"  PRIMARY KEY (`id`),\n  UNIQUE KEY `uk_name` (`name`)\n) ENGINE=InnoDB",
+	}
+	annotateTableMeta(meta, 42)
+
+	writer := s.newWriter(config, c)
+	tableIR := newMockTableIR("test", "t", [][]driver.Value{{"1", "a"}}, nil, []string{"INT", "VARCHAR"})
+	c.Assert(writer.WriteTableData(meta, tableIR, 0), IsNil)
+	bytes, err := ioutil.ReadFile(path.Join(dir, "test.t.000000000.sql"))
+	c.Assert(err, IsNil)
+	c.Assert(string(bytes), Equals, "-- Table: `test`.`t` (42 rows est.)\n"+
+		"-- Columns: `id` INT, `name` VARCHAR\n"+
+		"-- Indexes: PRIMARY KEY (`id`), UNIQUE KEY `uk_name` (`name`)\n"+
+		"/*!40101 SET NAMES binary*/;\n"+
+		"INSERT INTO `t` VALUES\n"+
+		"(1,'a');\n")
+}
+
 func (s *testWriterSuite) TestWriteTableDataWithFileSize(c *C) {
 	dir := c.MkDir()
 
@@ -186,6 +300,88 @@ func (s *testWriterSuite) TestWriteTableDataWithFileSize(c *C) {
 	}
 }
 
+func (s *testWriterSuite) TestWriteTableDataStats(c *C) {
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = c.MkDir()
+	config.OnFinish = func(DumpResult) {}
+
+	writer := s.newWriter(config, c)
+	writer.tableStats = newTableStatsCollector()
+	data := [][]driver.Value{
+		{"1", "male", "bob@mail.com", "020-1234", nil},
+		{"2", "female", "sarah@mail.com", "020-1253", "healthy"},
+		{"3", "male", "john@mail.com", "020-1256", "healthy"},
+		{"4", "female", "sarah@mail.com", "020-1235", "healthy"},
+	}
+	colTypes := []string{"INT", "SET", "VARCHAR", "VARCHAR", "TEXT"}
+	specCmts := []string{"/*!40101 SET NAMES binary*/;"}
+	for i, tbl := range []string{"employee", "employee", "manager"} {
+		tableIR := newMockTableIR("test", tbl, data, specCmts, colTypes)
+		c.Assert(writer.WriteTableData(tableIR, tableIR, i), IsNil)
+	}
+
+	var totalBytes uint64
+	err := writer.extStorage.WalkDir(context.Background(), &storage.WalkOption{}, func(_ string, size int64) error {
+		totalBytes += uint64(size)
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	d := &Dumper{conf: config, tableStats: writer.tableStats}
+	config.Tables = DatabaseTables{}.AppendTables("test", "employee", "manager")
+	config.Snapshot = "424242"
+	result := d.buildDumpResult(time.Now(), nil)
+	c.Assert(result.TotalTables, Equals, 2)
+	c.Assert(result.TotalRows, Equals, uint64(12))
+	c.Assert(result.TotalBytes, Equals, totalBytes)
+	c.Assert(result.Snapshot, Equals, "424242")
+	c.Assert(result.Consistency, Equals, consistencyTypeAuto)
+	c.Assert(result.Tables, HasLen, 2)
+	c.Assert(result.Tables[0].Table, Equals, "employee")
+	c.Assert(result.Tables[0].Rows, Equals, uint64(8))
+	c.Assert(result.Tables[1].Table, Equals, "manager")
+	c.Assert(result.Tables[1].Rows, Equals, uint64(4))
+}
+
+func (s *testWriterSuite) TestWriteTableDataWithChunkMetadata(c *C) {
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = c.MkDir()
+	config.FileSize = 50
+	config.ChunkMetadata = true
+
+	writer := s.newWriter(config, c)
+	data := [][]driver.Value{
+		{"9", "bob"},
+		{"10", "sarah"},
+		{nil, "john"},
+		{"100", "lisa"},
+	}
+	tableIR := newMockTableIR("test", "employee", data, nil, []string{"INT", "VARCHAR"})
+	tableIR.colNames = []string{"id", "name"}
+	err := writer.writeTableData(tableIR, tableIR, 3, "id")
+	c.Assert(err, IsNil)
+
+	expected := map[string]string{
+		"test.employee.000000000.sql.meta": `{"file":"test.employee.000000000.sql","chunk_index":3,"rows":2,"column":"id","min":"9","max":"10"}`,
+		"test.employee.000000001.sql.meta": `{"file":"test.employee.000000001.sql","chunk_index":3,"rows":2,"column":"id","min":"100","max":"100"}`,
+	}
+	for p, content := range expected {
+		bytes, err := ioutil.ReadFile(path.Join(config.OutputDirPath, p))
+		c.Assert(err, IsNil)
+		c.Assert(string(bytes), Equals, content)
+	}
+
+	// the column isn't dumped
+	tableIR = newMockTableIR("test", "manager", data, nil, []string{"INT", "VARCHAR"})
+	tableIR.colNames = []string{"id", "name"}
+	config.FileSize = UnspecifiedSize
+	err = writer.writeTableData(tableIR, tableIR, 0, "_tidb_rowid")
+	c.Assert(err, IsNil)
+	bytes, err := ioutil.ReadFile(path.Join(config.OutputDirPath, "test.manager.000000000.sql.meta"))
+	c.Assert(err, IsNil)
+	c.Assert(string(bytes), Equals, `{"file":"test.manager.000000000.sql","chunk_index":0,"rows":4,"column":"_tidb_rowid"}`)
+}
+
 func (s *testWriterSuite) TestWriteTableDataWithFileSizeAndRows(c *C) {
 	dir := c.MkDir()
 
@@ -326,3 +522,47 @@ func (s *testWriterSuite) TestWriteTableDataWithStatementSize(c *C) {
 		c.Assert(string(bytes), Equals, expected)
 	}
 }
+
+func (s *testWriterSuite) TestWriteCompressedMultiQueriesChunk(c *C) {
+	db, mock, err := sqlmock.New()
+	c.Assert(err, IsNil)
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	c.Assert(err, IsNil)
+
+	config := defaultConfigForTest(c)
+	config.OutputDirPath = c.MkDir()
+	config.CompressType = CompressGzip
+	extStore, err := config.createExternalStorage(context.Background())
+	c.Assert(err, IsNil)
+	writer := NewWriter(tcontext.Background(), 0, config, conn, extStore)
+
+	// the chunks of a table concatenated into one file are written through the same compressed writer,
+	// so the file decompresses fully as a single gzip member
+	mock.ExpectQuery("SELECT \\* FROM `test`.`employee` WHERE `id`<3").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "bob").AddRow(2, "sarah"))
+	mock.ExpectQuery("SELECT \\* FROM `test`.`employee` WHERE `id`>=3").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "john"))
+	meta := newMockTableIR("test", "employee", nil, nil, []string{"INT", "VARCHAR"})
+	ir := newMultiQueriesChunk([]string{
+		"SELECT * FROM `test`.`employee` WHERE `id`<3",
+		"SELECT * FROM `test`.`employee` WHERE `id`>=3",
+	}, 2)
+	c.Assert(writer.WriteTableData(meta, ir, 0), IsNil)
+	c.Assert(mock.ExpectationsWereMet(), IsNil)
+
+	compressed, err := ioutil.ReadFile(path.Join(config.OutputDirPath, "test.employee.000000000.sql.gz"))
+	c.Assert(err, IsNil)
+	br := bytes.NewReader(compressed)
+	r, err := gzip.NewReader(br)
+	c.Assert(err, IsNil)
+	r.Multistream(false)
+	content, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "INSERT INTO `employee` VALUES\n"+
+		"(1,'bob'),\n"+
+		"(2,'sarah'),\n"+
+		"(3,'john');\n")
+	// nothing follows the member
+	c.Assert(br.Len(), Equals, 0)
+}
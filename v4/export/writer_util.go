@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,6 +25,12 @@ import (
 
 const lengthLimit = 1048576
 
+// the statements wrapping the INSERT statements with Config.RowsPerTransaction or Config.TransactionPerTable
+const (
+	beginTransactionStatement  = "BEGIN;\n"
+	commitTransactionStatement = "COMMIT;\n"
+)
+
 var pool = sync.Pool{New: func() interface{} {
 	return &bytes.Buffer{}
 }}
@@ -169,7 +176,7 @@ func WriteInsert(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR Tabl
 
 	var (
 		insertStatementPrefix string
-		row                   = MakeRowReceiver(meta.ColumnTypes())
+		row                   = makeRowReceiver(meta.ColumnTypes(), cfg.BinarySafeStrings, cfg.BinaryModeHeader, cfg.BinaryEncoding)
 		counter               uint64
 		lastCounter           uint64
 		escapeBackslash       = cfg.EscapeBackslash
@@ -177,20 +184,51 @@ func WriteInsert(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR Tabl
 
 	selectedField := meta.SelectedField()
 
+	// with extended insert, rows start on a new line after VALUES;
+	// otherwise every row is written in its own single-line statement
+	valuesKeyword := "VALUES\n"
+	if cfg.SingleRowInsert {
+		valuesKeyword = "VALUES "
+	}
 	// if has generated column
 	if selectedField != "" && selectedField != "*" {
-		insertStatementPrefix = fmt.Sprintf("INSERT INTO %s %s VALUES\n",
-			wrapBackTicks(escapeString(meta.TableName())), selectedField)
+		insertStatementPrefix = fmt.Sprintf("%s %s %s",
+			quoteIdentifier(cfg.IdentifierQuote, outputIdentifier(cfg, meta.TableName())), requoteIdentifiers(cfg.IdentifierQuote, outputIdentifiers(cfg, selectedField)), valuesKeyword)
 	} else {
-		insertStatementPrefix = fmt.Sprintf("INSERT INTO %s VALUES\n",
-			wrapBackTicks(escapeString(meta.TableName())))
+		insertStatementPrefix = fmt.Sprintf("%s %s",
+			quoteIdentifier(cfg.IdentifierQuote, outputIdentifier(cfg, meta.TableName())), valuesKeyword)
+	}
+	// the first rows of the table are written by REPLACE INTO in safe mode
+	safeMode := safeModeOf(meta)
+	replaceStatementPrefix := safeModeInsertKeyword + " " + insertStatementPrefix
+	insertStatementPrefix = insertKeywordOf(cfg.InsertMethod) + " " + insertStatementPrefix
+	var safeModeRows int64
+	defer func() {
+		if err != nil {
+			safeMode.giveBack(safeModeRows)
+		}
+	}()
+	// rows of the transaction written in this file, the transaction is open if it's positive
+	var txnRows uint64
+	// the whole file is the data of a table with TransactionPerTable
+	if cfg.TransactionPerTable {
+		bf.WriteString(beginTransactionStatement)
+		wp.currentFileSize += uint64(len(beginTransactionStatement))
 	}
-	insertStatementPrefixLen := uint64(len(insertStatementPrefix))
 
 	for fileRowIter.HasNext() {
+		if cfg.RowsPerTransaction > 0 && txnRows == 0 {
+			bf.WriteString(beginTransactionStatement)
+			wp.currentFileSize += uint64(len(beginTransactionStatement))
+		}
 		wp.currentStatementSize = 0
-		bf.WriteString(insertStatementPrefix)
-		wp.AddFileSize(insertStatementPrefixLen)
+		statementPrefix, inSafeMode := insertStatementPrefix, safeMode.take()
+		if inSafeMode {
+			statementPrefix = replaceStatementPrefix
+			safeModeRows++
+		}
+		bf.WriteString(statementPrefix)
+		wp.AddFileSize(uint64(len(statementPrefix)))
 
 		for fileRowIter.HasNext() {
 			lastBfSize := bf.Len()
@@ -204,18 +242,33 @@ func WriteInsert(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR Tabl
 				bf.WriteString("()")
 			}
 			counter++
+			txnRows++
 			wp.AddFileSize(uint64(bf.Len()-lastBfSize) + 2) // 2 is for ",\n" and ";\n"
 			failpoint.Inject("ChaosBrokenMySQLConn", func(_ failpoint.Value) {
 				failpoint.Return(0, errors.New("connection is closed"))
 			})
 
 			fileRowIter.Next()
-			shouldSwitch := wp.ShouldSwitchStatement()
+			shouldCommit := cfg.RowsPerTransaction > 0 && txnRows >= cfg.RowsPerTransaction
+			shouldSwitch := cfg.SingleRowInsert || shouldCommit || wp.ShouldSwitchStatement()
+			// the statement in safe mode ends once the rows in safe mode are exhausted
+			if inSafeMode && !shouldSwitch && fileRowIter.HasNext() {
+				if safeMode.take() {
+					safeModeRows++
+				} else {
+					shouldSwitch = true
+				}
+			}
 			if fileRowIter.HasNext() && !shouldSwitch {
 				bf.WriteString(",\n")
 			} else {
 				bf.WriteString(";\n")
 			}
+			if cfg.RowsPerTransaction > 0 && (shouldCommit || !fileRowIter.HasNext() || wp.ShouldSwitchFile()) {
+				bf.WriteString(commitTransactionStatement)
+				wp.currentFileSize += uint64(len(commitTransactionStatement))
+				txnRows = 0
+			}
 			if bf.Len() >= lengthLimit {
 				select {
 				case <-pCtx.Done():
@@ -240,6 +293,10 @@ func WriteInsert(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR Tabl
 			break
 		}
 	}
+	if cfg.TransactionPerTable {
+		bf.WriteString(commitTransactionStatement)
+		wp.currentFileSize += uint64(len(commitTransactionStatement))
+	}
 	pCtx.L().Debug("finish dumping table(chunk)",
 		zap.String("database", meta.DatabaseName()),
 		zap.String("table", meta.TableName()),
@@ -295,17 +352,29 @@ func WriteInsertInCsv(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR
 	}()
 
 	var (
-		row             = MakeRowReceiver(meta.ColumnTypes())
+		row             = makeRowReceiver(meta.ColumnTypes(), cfg.BinarySafeStrings, false, cfg.BinaryEncoding)
+		numberFmt       = newNumberFormatter(cfg, meta.ColumnTypes())
 		counter         uint64
 		lastCounter     uint64
 		escapeBackslash = cfg.EscapeBackslash
 		selectedFields  = meta.SelectedField()
+		invalidUTF8Mode = csvInvalidUTF8Mode(cfg)
 	)
+	keyIndices, err := outputKeyIndices(cfg, meta)
+	if err != nil {
+		return 0, err
+	}
 
 	if !cfg.NoHeader && len(meta.ColumnNames()) != 0 && selectedFields != "" {
+		if keyIndices != nil {
+			bf.Write(opt.delimiter)
+			bf.WriteString(outputKeyColumnName)
+			bf.Write(opt.delimiter)
+			bf.Write(opt.separator)
+		}
 		for i, col := range meta.ColumnNames() {
 			bf.Write(opt.delimiter)
-			escapeCSV([]byte(col), bf, escapeBackslash, opt)
+			escapeCSV([]byte(outputIdentifier(cfg, col)), bf, escapeBackslash, opt)
 			bf.Write(opt.delimiter)
 			if i != len(meta.ColumnTypes())-1 {
 				bf.Write(opt.separator)
@@ -322,6 +391,23 @@ func WriteInsertInCsv(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR
 				pCtx.L().Error("fail to scan from sql.Row", zap.Error(err))
 				return counter, errors.Trace(err)
 			}
+			if invalidUTF8Mode != "" {
+				var keep bool
+				keep, err = handleCsvInvalidUTF8(pCtx, invalidUTF8Mode, meta, row)
+				if err != nil {
+					return counter, err
+				}
+				if !keep {
+					fileRowIter.Next()
+					continue
+				}
+			}
+			if numberFmt != nil {
+				numberFmt.format(row)
+			}
+			if keyIndices != nil {
+				writeOutputKeyInCsv(bf, row, keyIndices, cfg.OutputKeySeparator, escapeBackslash, opt)
+			}
 			row.WriteToBufferInCsv(bf, escapeBackslash, opt)
 		}
 		counter++
@@ -372,6 +458,45 @@ func WriteInsertInCsv(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR
 	return counter, wp.Error()
 }
 
+// csvInvalidUTF8Mode returns Config.CsvInvalidUTF8 if the results are expected to be UTF-8, otherwise returns ""
+func csvInvalidUTF8Mode(cfg *Config) string {
+	if charset, ok := cfg.SessionParams["character_set_results"]; ok {
+		switch strings.ToLower(fmt.Sprint(charset)) {
+		case "utf8", "utf8mb4":
+		default:
+			return ""
+		}
+	}
+	return cfg.CsvInvalidUTF8
+}
+
+// handleCsvInvalidUTF8 handles the string values which aren't valid UTF-8 in row by mode.
+// It returns false if the row should be skipped.
+func handleCsvInvalidUTF8(tctx *tcontext.Context, mode string, meta TableMeta, row RowReceiverArr) (bool, error) {
+	idx := row.invalidUTF8Column()
+	if idx < 0 {
+		return true, nil
+	}
+	column := strconv.Itoa(idx)
+	if colNames := meta.ColumnNames(); idx < len(colNames) {
+		column = colNames[idx]
+	}
+	switch mode {
+	case CsvInvalidUTF8Skip:
+		tctx.L().Warn("skip row with invalid UTF-8 value",
+			zap.String("database", meta.DatabaseName()),
+			zap.String("table", meta.TableName()),
+			zap.String("column", column))
+		return false, nil
+	case CsvInvalidUTF8Replace:
+		row.replaceInvalidUTF8()
+		return true, nil
+	default:
+		return false, errors.Errorf("invalid UTF-8 value in column `%s` of table `%s`.`%s`, please set --csv-invalid-utf8 to skip or replace it",
+			column, meta.DatabaseName(), meta.TableName())
+	}
+}
+
 func write(tctx *tcontext.Context, writer storage.ExternalFileWriter, str string) error {
 	_, err := writer.Write(tctx, []byte(str))
 	if err != nil {
@@ -403,10 +528,10 @@ func writeBytes(tctx *tcontext.Context, writer storage.ExternalFileWriter, p []b
 	return errors.Trace(err)
 }
 
-func buildFileWriter(tctx *tcontext.Context, s storage.ExternalStorage, fileName string, compressType storage.CompressType) (storage.ExternalFileWriter, func(ctx context.Context), error) {
+func buildFileWriter(tctx *tcontext.Context, s storage.ExternalStorage, fileName string, compressType CompressType, ensureTrailingNewline bool) (storage.ExternalFileWriter, func(ctx context.Context), error) {
 	fileName += compressFileSuffix(compressType)
 	fullPath := path.Join(s.URI(), fileName)
-	writer, err := storage.WithCompression(s, compressType).Create(tctx, fileName)
+	writer, err := newCompressedStorage(s, compressType).Create(tctx, fileName)
 	if err != nil {
 		tctx.L().Error("open file failed",
 			zap.String("path", fullPath),
@@ -414,9 +539,13 @@ func buildFileWriter(tctx *tcontext.Context, s storage.ExternalStorage, fileName
 		return nil, nil, errors.Trace(err)
 	}
 	tctx.L().Debug("opened file", zap.String("path", fullPath))
+	writer = withTrailingNewline(writer, ensureTrailingNewline)
+	counter := &countingFileWriter{ExternalFileWriter: writer}
 	tearDownRoutine := func(ctx context.Context) {
 		err := writer.Close(ctx)
 		if err == nil {
+			written, _ := writtenFileSizes(writer, counter.writtenBytes)
+			recordUncompressedSize(s, compressType, fileName, written)
 			return
 		}
 		err = errors.Trace(err)
@@ -424,10 +553,10 @@ func buildFileWriter(tctx *tcontext.Context, s storage.ExternalStorage, fileName
 			zap.String("path", fullPath),
 			zap.Error(err))
 	}
-	return writer, tearDownRoutine, nil
+	return counter, tearDownRoutine, nil
 }
 
-func buildInterceptFileWriter(pCtx *tcontext.Context, s storage.ExternalStorage, fileName string, compressType storage.CompressType) (storage.ExternalFileWriter, func(context.Context)) {
+func buildInterceptFileWriter(pCtx *tcontext.Context, s storage.ExternalStorage, fileName string, compressType CompressType, ensureTrailingNewline bool) (storage.ExternalFileWriter, func(context.Context)) {
 	fileName += compressFileSuffix(compressType)
 	var writer storage.ExternalFileWriter
 	fullPath := path.Join(s.URI(), fileName)
@@ -435,14 +564,14 @@ func buildInterceptFileWriter(pCtx *tcontext.Context, s storage.ExternalStorage,
 	initRoutine := func() error {
 		// use separated context pCtx here to make sure context used in ExternalFile won't be canceled before close,
 		// which will cause a context canceled error when closing gcs's Writer
-		w, err := storage.WithCompression(s, compressType).Create(pCtx, fileName)
+		w, err := newCompressedStorage(s, compressType).Create(pCtx, fileName)
 		if err != nil {
 			pCtx.L().Error("open file failed",
 				zap.String("path", fullPath),
 				zap.Error(err))
 			return newWriterError(err)
 		}
-		writer = w
+		writer = withTrailingNewline(w, ensureTrailingNewline)
 		pCtx.L().Debug("opened file", zap.String("path", fullPath))
 		fileWriter.ExternalFileWriter = writer
 		return nil
@@ -459,7 +588,10 @@ func buildInterceptFileWriter(pCtx *tcontext.Context, s storage.ExternalStorage,
 			pCtx.L().Error("close file failed",
 				zap.String("path", fullPath),
 				zap.Error(err))
+			return
 		}
+		fileWriter.WrittenBytes, fileWriter.CompressedBytes = writtenFileSizes(writer, fileWriter.WrittenBytes)
+		recordUncompressedSize(s, compressType, fileName, fileWriter.WrittenBytes)
 	}
 	return fileWriter, tearDownRoutine
 }
@@ -503,6 +635,10 @@ type InterceptFileWriter struct {
 	storage.ExternalFileWriter
 	sync.Once
 	SomethingIsWritten bool
+	// WrittenBytes is the size of data written before compression
+	WrittenBytes uint64
+	// CompressedBytes is the size of the file after it's closed, it's WrittenBytes if the file isn't compressed
+	CompressedBytes uint64
 
 	initRoutine func() error
 	err         error
@@ -518,6 +654,7 @@ func (w *InterceptFileWriter) Write(ctx context.Context, p []byte) (int, error)
 		return 0, errors.Annotate(w.err, "open file error")
 	}
 	n, err := w.ExternalFileWriter.Write(ctx, p)
+	w.WrittenBytes += uint64(n)
 	return n, newWriterError(err)
 }
 
@@ -537,18 +674,23 @@ func wrapStringWith(str string, wrapper string) string {
 	return fmt.Sprintf("%s%s%s", wrapper, str, wrapper)
 }
 
-func compressFileSuffix(compressType storage.CompressType) string {
+func compressFileSuffix(compressType CompressType) string {
 	switch compressType {
-	case storage.NoCompression:
+	case CompressNone:
 		return ""
-	case storage.Gzip:
+	case CompressGzip:
 		return ".gz"
+	case CompressSnappy:
+		return ".snappy"
+	case CompressZstd:
+		return ".zst"
 	default:
 		return ""
 	}
 }
 
-// FileFormat is the format that output to file. Currently we support SQL text and CSV file format.
+// FileFormat is the format that output to file. Currently we support SQL text, CSV, MongoDB extended JSON,
+// change feed and Apache Parquet file format.
 type FileFormat int32
 
 const (
@@ -558,6 +700,14 @@ const (
 	FileFormatSQLText
 	// FileFormatCSV indicates the given file type is csv type
 	FileFormatCSV
+	// FileFormatMongoJSON indicates the given file type is MongoDB extended JSON, one document per line
+	FileFormatMongoJSON
+	// FileFormatChangeFeed indicates the given file type is change events in a Debezium-like JSON envelope, one per line
+	FileFormatChangeFeed
+	// FileFormatParquet indicates the given file type is Apache Parquet
+	FileFormatParquet
+	// FileFormatJSONLines indicates the given file type is newline-delimited JSON, one plain object per line
+	FileFormatJSONLines
 )
 
 const (
@@ -565,6 +715,27 @@ const (
 	FileFormatSQLTextString = "sql"
 	// FileFormatCSVString indicates the string/suffix of csv type file
 	FileFormatCSVString = "csv"
+	// FileFormatMongoJSONString indicates the string of MongoDB extended JSON type file
+	FileFormatMongoJSONString = "mongo-json"
+	// fileFormatMongoJSONExtension is the suffix of MongoDB extended JSON type file
+	fileFormatMongoJSONExtension = "json"
+	// FileFormatChangeFeedString indicates the string of change feed type file
+	FileFormatChangeFeedString = "change-feed"
+	// fileFormatChangeFeedExtension is the suffix of change feed type file
+	fileFormatChangeFeedExtension = "json"
+	// FileFormatParquetString indicates the string/suffix of Apache Parquet type file
+	FileFormatParquetString = "parquet"
+	// FileFormatJSONLinesString indicates the string/suffix of newline-delimited JSON type file
+	FileFormatJSONLinesString = "jsonl"
+)
+
+const (
+	// CsvInvalidUTF8Error makes dumpling fail on the string values which aren't valid UTF-8 in csv files
+	CsvInvalidUTF8Error = "error"
+	// CsvInvalidUTF8Skip makes dumpling skip the rows with string values which aren't valid UTF-8 in csv files
+	CsvInvalidUTF8Skip = "skip"
+	// CsvInvalidUTF8Replace makes dumpling replace the invalid UTF-8 bytes with U+FFFD in csv files
+	CsvInvalidUTF8Replace = "replace"
 )
 
 // String implement Stringer.String method.
@@ -574,6 +745,14 @@ func (f FileFormat) String() string {
 		return strings.ToUpper(FileFormatSQLTextString)
 	case FileFormatCSV:
 		return strings.ToUpper(FileFormatCSVString)
+	case FileFormatMongoJSON:
+		return strings.ToUpper(FileFormatMongoJSONString)
+	case FileFormatChangeFeed:
+		return strings.ToUpper(FileFormatChangeFeedString)
+	case FileFormatParquet:
+		return strings.ToUpper(FileFormatParquetString)
+	case FileFormatJSONLines:
+		return strings.ToUpper(FileFormatJSONLinesString)
 	default:
 		return "unknown"
 	}
@@ -582,24 +761,44 @@ func (f FileFormat) String() string {
 // Extension returns the extension for specific format.
 //  text -> "sql"
 //  csv  -> "csv"
+//  mongo-json -> "json"
+//  change-feed -> "json"
+//  parquet -> "parquet"
+//  jsonl -> "jsonl"
 func (f FileFormat) Extension() string {
 	switch f {
 	case FileFormatSQLText:
 		return FileFormatSQLTextString
 	case FileFormatCSV:
 		return FileFormatCSVString
+	case FileFormatMongoJSON:
+		return fileFormatMongoJSONExtension
+	case FileFormatChangeFeed:
+		return fileFormatChangeFeedExtension
+	case FileFormatParquet:
+		return FileFormatParquetString
+	case FileFormatJSONLines:
+		return FileFormatJSONLinesString
 	default:
 		return "unknown_format"
 	}
 }
 
-// WriteInsert writes TableDataIR to a storage.ExternalFileWriter in sql/csv type
+// WriteInsert writes TableDataIR to a storage.ExternalFileWriter in sql/csv/mongo-json/change-feed/parquet/jsonl type
 func (f FileFormat) WriteInsert(pCtx *tcontext.Context, cfg *Config, meta TableMeta, tblIR TableDataIR, w storage.ExternalFileWriter) (uint64, error) {
 	switch f {
 	case FileFormatSQLText:
 		return WriteInsert(pCtx, cfg, meta, tblIR, w)
 	case FileFormatCSV:
 		return WriteInsertInCsv(pCtx, cfg, meta, tblIR, w)
+	case FileFormatMongoJSON:
+		return WriteInsertInMongoJSON(pCtx, cfg, meta, tblIR, w)
+	case FileFormatChangeFeed:
+		return WriteInsertInChangeFeed(pCtx, cfg, meta, tblIR, w)
+	case FileFormatParquet:
+		return WriteInsertInParquet(pCtx, cfg, meta, tblIR, w)
+	case FileFormatJSONLines:
+		return WriteInsertInJSONLines(pCtx, cfg, meta, tblIR, w)
 	default:
 		return 0, errors.Errorf("unknown file format")
 	}
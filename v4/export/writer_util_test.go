@@ -4,6 +4,7 @@ package export
 
 import (
 	"database/sql/driver"
+	"encoding/base64"
 	"fmt"
 	"strings"
 	"testing"
@@ -91,6 +92,133 @@ func (s *testUtilSuite) TestWriteInsert(c *C) {
 	c.Assert(bf.String(), Equals, expected)
 }
 
+func (s *testUtilSuite) TestWriteInsertWithoutExtendedInsert(c *C) {
+	data := [][]driver.Value{
+		{"1", "male", "bob@mail.com", "020-1234", nil},
+		{"2", "female", "sarah@mail.com", "020-1253", "healthy"},
+		{"3", "male", "john@mail.com", "020-1256", "healthy"},
+	}
+	colTypes := []string{"INT", "SET", "VARCHAR", "VARCHAR", "TEXT"}
+	specCmts := []string{
+		"/*!40101 SET NAMES binary*/;",
+	}
+	tableIR := newMockTableIR("test", "employee", data, specCmts, colTypes)
+	bf := storage.NewBufferWriter()
+
+	conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+	conf.SingleRowInsert = true
+	n, err := WriteInsert(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(n, Equals, uint64(3))
+	c.Assert(err, IsNil)
+	expected := "/*!40101 SET NAMES binary*/;\n" +
+		"INSERT INTO `employee` VALUES (1,'male','bob@mail.com','020-1234',NULL);\n" +
+		"INSERT INTO `employee` VALUES (2,'female','sarah@mail.com','020-1253','healthy');\n" +
+		"INSERT INTO `employee` VALUES (3,'male','john@mail.com','020-1256','healthy');\n"
+	c.Assert(bf.String(), Equals, expected)
+
+	// compose with complete insert
+	tableIR = newMockTableIR("test", "employee", data[:2], specCmts, colTypes)
+	tableIR.selectedField = "(`id`,`gender`,`email`,`phone_number`,`status`)"
+	bf = storage.NewBufferWriter()
+	n, err = WriteInsert(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(n, Equals, uint64(2))
+	c.Assert(err, IsNil)
+	expected = "/*!40101 SET NAMES binary*/;\n" +
+		"INSERT INTO `employee` (`id`,`gender`,`email`,`phone_number`,`status`) VALUES (1,'male','bob@mail.com','020-1234',NULL);\n" +
+		"INSERT INTO `employee` (`id`,`gender`,`email`,`phone_number`,`status`) VALUES (2,'female','sarah@mail.com','020-1253','healthy');\n"
+	c.Assert(bf.String(), Equals, expected)
+}
+
+func (s *testUtilSuite) TestWriteInsertWithRowsPerTransaction(c *C) {
+	data := [][]driver.Value{
+		{"1", "male", "bob@mail.com", "020-1234", nil},
+		{"2", "female", "sarah@mail.com", "020-1253", "healthy"},
+		{"3", "male", "john@mail.com", "020-1256", "healthy"},
+		{"4", "female", "sarah@mail.com", "020-1235", "healthy"},
+		{"5", "male", "bob@mail.com", "020-1236", nil},
+	}
+	colTypes := []string{"INT", "SET", "VARCHAR", "VARCHAR", "TEXT"}
+	specCmts := []string{
+		"/*!40101 SET NAMES binary*/;",
+	}
+	tableIR := newMockTableIR("test", "employee", data, specCmts, colTypes)
+	bf := storage.NewBufferWriter()
+
+	conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+	conf.RowsPerTransaction = 2
+	n, err := WriteInsert(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(n, Equals, uint64(5))
+	c.Assert(err, IsNil)
+	expected := "/*!40101 SET NAMES binary*/;\n" +
+		"BEGIN;\n" +
+		"INSERT INTO `employee` VALUES\n" +
+		"(1,'male','bob@mail.com','020-1234',NULL),\n" +
+		"(2,'female','sarah@mail.com','020-1253','healthy');\n" +
+		"COMMIT;\n" +
+		"BEGIN;\n" +
+		"INSERT INTO `employee` VALUES\n" +
+		"(3,'male','john@mail.com','020-1256','healthy'),\n" +
+		"(4,'female','sarah@mail.com','020-1235','healthy');\n" +
+		"COMMIT;\n" +
+		"BEGIN;\n" +
+		"INSERT INTO `employee` VALUES\n" +
+		"(5,'male','bob@mail.com','020-1236',NULL);\n" +
+		"COMMIT;\n"
+	c.Assert(bf.String(), Equals, expected)
+
+	// a transaction contains multiple statements if they are split by the statement size
+	tableIR = newMockTableIR("test", "employee", data[:3], specCmts, colTypes)
+	bf = storage.NewBufferWriter()
+	conf = configForWriteSQL(UnspecifiedSize, 1)
+	conf.RowsPerTransaction = 2
+	n, err = WriteInsert(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(n, Equals, uint64(3))
+	c.Assert(err, IsNil)
+	expected = "/*!40101 SET NAMES binary*/;\n" +
+		"BEGIN;\n" +
+		"INSERT INTO `employee` VALUES\n" +
+		"(1,'male','bob@mail.com','020-1234',NULL);\n" +
+		"INSERT INTO `employee` VALUES\n" +
+		"(2,'female','sarah@mail.com','020-1253','healthy');\n" +
+		"COMMIT;\n" +
+		"BEGIN;\n" +
+		"INSERT INTO `employee` VALUES\n" +
+		"(3,'male','john@mail.com','020-1256','healthy');\n" +
+		"COMMIT;\n"
+	c.Assert(bf.String(), Equals, expected)
+}
+
+func (s *testUtilSuite) TestWriteInsertWithTransactionPerTable(c *C) {
+	data := [][]driver.Value{
+		{"1", "male", "bob@mail.com", "020-1234", nil},
+		{"2", "female", "sarah@mail.com", "020-1253", "healthy"},
+		{"3", "male", "john@mail.com", "020-1256", "healthy"},
+	}
+	colTypes := []string{"INT", "SET", "VARCHAR", "VARCHAR", "TEXT"}
+	specCmts := []string{
+		"/*!40101 SET NAMES binary*/;",
+	}
+	tableIR := newMockTableIR("test", "employee", data, specCmts, colTypes)
+	bf := storage.NewBufferWriter()
+
+	// all the statements are in one transaction
+	conf := configForWriteSQL(UnspecifiedSize, 1)
+	conf.TransactionPerTable = true
+	n, err := WriteInsert(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(n, Equals, uint64(3))
+	c.Assert(err, IsNil)
+	expected := "/*!40101 SET NAMES binary*/;\n" +
+		"BEGIN;\n" +
+		"INSERT INTO `employee` VALUES\n" +
+		"(1,'male','bob@mail.com','020-1234',NULL);\n" +
+		"INSERT INTO `employee` VALUES\n" +
+		"(2,'female','sarah@mail.com','020-1253','healthy');\n" +
+		"INSERT INTO `employee` VALUES\n" +
+		"(3,'male','john@mail.com','020-1256','healthy');\n" +
+		"COMMIT;\n"
+	c.Assert(bf.String(), Equals, expected)
+}
+
 func (s *testUtilSuite) TestWriteInsertReturnsError(c *C) {
 	data := [][]driver.Value{
 		{"1", "male", "bob@mail.com", "020-1234", nil},
@@ -191,6 +319,220 @@ func (s *testUtilSuite) TestWriteInsertInCsv(c *C) {
 	c.Assert(bf.String(), Equals, expected)
 }
 
+func (s *testUtilSuite) TestWriteInsertInCsvWithOutputKey(c *C) {
+	data := [][]driver.Value{
+		{"1", "a|b", "x"},
+		{"2", "c", nil},
+	}
+	colTypes := []string{"INT", "VARCHAR", "TEXT"}
+	opt := &csvOption{separator: []byte(","), delimiter: doubleQuotationMark, nullValue: "\\N"}
+	conf := configForWriteCSV(false, opt)
+	conf.OutputKeyColumns, _ = ParseOutputKeyColumns([]string{"test.t:ID,name"})
+	conf.OutputKeySeparator = "|"
+
+	tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+	tableIR.colNames = []string{"id", "name", "note"}
+	bf := storage.NewBufferWriter()
+	n, err := WriteInsertInCsv(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(n, Equals, uint64(2))
+	c.Assert(err, IsNil)
+	c.Assert(bf.String(), Equals, "\"_row_key\",\"id\",\"name\",\"note\"\n"+
+		"\"1|a|b\",1,\"a|b\",\"x\"\n"+
+		"\"2|c\",2,\"c\",\\N\n")
+
+	// the key columns must be dumped
+	tableIR = newMockTableIR("test", "t", data, nil, colTypes)
+	tableIR.colNames = []string{"id", "title", "note"}
+	_, err = WriteInsertInCsv(tcontext.Background(), conf, tableIR, tableIR, storage.NewBufferWriter())
+	c.Assert(err, ErrorMatches, "output key column `name` isn't dumped in table `test`.`t`")
+
+	for _, testCase := range []struct {
+		spec []string
+		err  string
+	}{
+		{[]string{"t:id"}, ".*only accepts qualified table names"},
+		{[]string{"test.t"}, ".*should be in the format of db.table:col1,col2"},
+		{[]string{"test.t: ,"}, "no output key column is specified for table `test`.`t`"},
+		{[]string{"test.t:id", "test.t:name"}, ".*are specified more than once"},
+	} {
+		_, err = ParseOutputKeyColumns(testCase.spec)
+		c.Assert(err, ErrorMatches, testCase.err, Commentf("spec %v", testCase.spec))
+	}
+}
+
+func (s *testUtilSuite) TestWriteInsertInCsvWithInvalidUTF8(c *C) {
+	data := [][]driver.Value{
+		{"1", "caf\xe9", []byte{0xff}},
+		{"2", "café", nil},
+	}
+	colTypes := []string{"INT", "VARCHAR", "BLOB"}
+	opt := &csvOption{separator: []byte(","), delimiter: doubleQuotationMark, nullValue: "\\N"}
+	writeCsv := func(mode string) (uint64, string, error) {
+		tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+		tableIR.colNames = []string{"id", "name", "data"}
+		bf := storage.NewBufferWriter()
+		conf := configForWriteCSV(true, opt)
+		conf.CsvInvalidUTF8 = mode
+		n, err := WriteInsertInCsv(tcontext.Background(), conf, tableIR, tableIR, bf)
+		return n, bf.String(), err
+	}
+
+	// default behavior writes the bytes as is
+	n, output, err := writeCsv("")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, uint64(2))
+	c.Assert(output, Equals, "1,\"caf\xe9\",\"\xff\"\n2,\"café\",\\N\n")
+
+	_, _, err = writeCsv(CsvInvalidUTF8Error)
+	c.Assert(err, ErrorMatches, "invalid UTF-8 value in column `name` of table `test`.`t`.*")
+
+	n, output, err = writeCsv(CsvInvalidUTF8Skip)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, uint64(1))
+	c.Assert(output, Equals, "2,\"café\",\\N\n")
+
+	// binary columns are kept as is
+	n, output, err = writeCsv(CsvInvalidUTF8Replace)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, uint64(2))
+	c.Assert(output, Equals, "1,\"caf\uFFFD\",\"\xff\"\n2,\"café\",\\N\n")
+}
+
+func (s *testUtilSuite) TestWriteBinarySafeStrings(c *C) {
+	raw := "a\x00b'\xff\n"
+	data := [][]driver.Value{
+		{"1", raw, "male", nil},
+	}
+	colTypes := []string{"INT", "VARCHAR", "ENUM", "TEXT"}
+
+	// sql
+	tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+	bf := storage.NewBufferWriter()
+	conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+	conf.BinarySafeStrings = true
+	n, err := WriteInsert(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(n, Equals, uint64(1))
+	c.Assert(err, IsNil)
+	c.Assert(bf.String(), Equals, "INSERT INTO `t` VALUES\n(1,x'61006227ff0a','male',NULL);\n")
+	var decoded []byte
+	_, err = fmt.Sscanf(strings.Split(bf.String(), "'")[1], "%x", &decoded)
+	c.Assert(err, IsNil)
+	c.Assert(string(decoded), Equals, raw)
+
+	// csv
+	tableIR = newMockTableIR("test", "t", data, nil, colTypes)
+	bf = storage.NewBufferWriter()
+	opt := &csvOption{separator: []byte(","), delimiter: doubleQuotationMark, nullValue: "\\N"}
+	conf = configForWriteCSV(true, opt)
+	conf.BinarySafeStrings = true
+	n, err = WriteInsertInCsv(tcontext.Background(), conf, tableIR, tableIR, bf)
+	c.Assert(n, Equals, uint64(1))
+	c.Assert(err, IsNil)
+	c.Assert(bf.String(), Equals, "1,\"YQBiJ/8K\",\"male\",\\N\n")
+	decoded, err = base64.StdEncoding.DecodeString(strings.Split(bf.String(), "\"")[1])
+	c.Assert(err, IsNil)
+	c.Assert(string(decoded), Equals, raw)
+}
+
+func (s *testUtilSuite) TestWriteClientSafeStrings(c *C) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	data := [][]driver.Value{
+		{"1", string(all), all},
+		{"2", "plain 'text'", nil},
+	}
+	colTypes := []string{"INT", "VARCHAR", "BLOB"}
+
+	for _, escapeBackslash := range []bool{true, false} {
+		tableIR := newMockTableIR("test", "t", data, nil, colTypes)
+		bf := storage.NewBufferWriter()
+		conf := configForWriteSQL(UnspecifiedSize, UnspecifiedSize)
+		conf.EscapeBackslash = escapeBackslash
+		conf.BinaryModeHeader = true
+		n, err := WriteInsert(tcontext.Background(), conf, tableIR, tableIR, bf)
+		c.Assert(n, Equals, uint64(2))
+		c.Assert(err, IsNil)
+		output := bf.String()
+		c.Assert(strings.ContainsAny(output, clientUnsafeBytes), IsFalse, Commentf("output %q", output))
+
+		// replay the values like the server does
+		rows := strings.Split(strings.TrimSuffix(strings.TrimPrefix(output, "INSERT INTO `t` VALUES\n"), ";\n"), ",\n")
+		c.Assert(rows, HasLen, 2)
+		values := splitSQLValues(c, rows[0], escapeBackslash)
+		c.Assert(values, DeepEquals, []string{"1", string(all), string(all)})
+		values = splitSQLValues(c, rows[1], escapeBackslash)
+		c.Assert(values, DeepEquals, []string{"2", "plain 'text'", "NULL"})
+	}
+}
+
+// splitSQLValues decodes the values of a row written by WriteInsert
+func splitSQLValues(c *C, row string, escapeBackslash bool) []string { // revive:disable-line:flag-parameter
+	c.Assert(row[0], Equals, byte('('))
+	c.Assert(row[len(row)-1], Equals, byte(')'))
+	row = row[1 : len(row)-1]
+	var values []string
+	for len(row) > 0 {
+		var value strings.Builder
+		switch {
+		case strings.HasPrefix(row, "x'"):
+			end := strings.IndexByte(row[2:], '\'') + 2
+			var decoded []byte
+			if end > 2 {
+				_, err := fmt.Sscanf(row[2:end], "%x", &decoded)
+				c.Assert(err, IsNil)
+			}
+			value.Write(decoded)
+			row = row[end+1:]
+		case row[0] == '\'':
+			i := 1
+			for ; ; i++ {
+				ch := row[i]
+				if escapeBackslash && ch == '\\' {
+					i++
+					value.WriteByte(unescapeSQLByte(row[i]))
+					continue
+				}
+				if ch == '\'' {
+					if i+1 < len(row) && row[i+1] == '\'' {
+						value.WriteByte('\'')
+						i++
+						continue
+					}
+					break
+				}
+				value.WriteByte(ch)
+			}
+			row = row[i+1:]
+		default:
+			end := strings.IndexByte(row, ',')
+			if end < 0 {
+				end = len(row)
+			}
+			value.WriteString(row[:end])
+			row = row[end:]
+		}
+		values = append(values, value.String())
+		row = strings.TrimPrefix(row, ",")
+	}
+	return values
+}
+
+func unescapeSQLByte(ch byte) byte {
+	switch ch {
+	case '0':
+		return 0
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 'Z':
+		return '\032'
+	}
+	return ch
+}
+
 func (s *testUtilSuite) TestSQLDataTypes(c *C) {
 	data := [][]driver.Value{
 		{"CHAR", "char1", `'char1'`},
@@ -6,6 +6,7 @@ import (
 	"github.com/pingcap/errors"
 	pclog "github.com/pingcap/log"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 var appLogger = Logger{zap.NewNop()}
@@ -35,11 +36,13 @@ type Config struct {
 	FileMaxBackups int `toml:"max-backups" json:"max-backups"`
 	// Format of the log, one of `text`, `json` or `console`.
 	Format string `toml:"format" json:"format"`
+	// Stderr writes the log into stderr instead of stdout when File is empty.
+	Stderr bool `toml:"-" json:"-"`
 }
 
 // InitAppLogger inits the wrapped logger from config.
 func InitAppLogger(cfg *Config) (Logger, *pclog.ZapProperties, error) {
-	logger, props, err := pclog.InitLogger(&pclog.Config{
+	pcfg := &pclog.Config{
 		Level: cfg.Level,
 		File: pclog.FileLogConfig{
 			Filename:   cfg.File,
@@ -48,7 +51,20 @@ func InitAppLogger(cfg *Config) (Logger, *pclog.ZapProperties, error) {
 			MaxBackups: cfg.FileMaxBackups,
 		},
 		Format: cfg.Format,
-	})
+	}
+	var (
+		logger *zap.Logger
+		props  *pclog.ZapProperties
+		err    error
+	)
+	if cfg.File == "" && cfg.Stderr {
+		var stderr zapcore.WriteSyncer
+		if stderr, _, err = zap.Open("stderr"); err == nil {
+			logger, props, err = pclog.InitLoggerWithWriteSyncer(pcfg, stderr)
+		}
+	} else {
+		logger, props, err = pclog.InitLogger(pcfg)
+	}
 	if err != nil {
 		return appLogger, props, errors.Trace(err)
 	}